@@ -0,0 +1,75 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"fmt"
+)
+
+// AbsentTest is used to assert that something is not present, without
+// having to write an inverted regular expression.
+//
+// If Expression is set, the test is true only if no criteria returned by
+// the object has a value matching the expression. For example an object
+// returning the PermitRootLogin settings in sshd_config, with an
+// Expression of ^yes$, asserts root login is never enabled.
+//
+// If NoCriteria is true, the test is true only if the object returns no
+// criteria at all, for example asserting no .rhosts files exist in any home
+// directory.
+//
+// The result for each individual criteria is false if the criteria
+// violates the assertion, so the offending criteria can be identified in
+// the results. Unlike most evaluators, the test is true if the object
+// returns no criteria.
+type AbsentTest struct {
+	Expression string `json:"expression,omitempty" yaml:"expression,omitempty"`
+	NoCriteria bool   `json:"nocriteria,omitempty" yaml:"nocriteria,omitempty"`
+
+	re compiledRegexp
+}
+
+func (a *AbsentTest) validate() error {
+	if a.Expression != "" && a.NoCriteria {
+		return fmt.Errorf("absent expression and nocriteria cannot both be set")
+	}
+	if a.Expression != "" {
+		_, err := a.re.compile(a.Expression)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *AbsentTest) evaluate(c evaluationCriteria) (ret evaluationResult, err error) {
+	res, _, err := a.evaluateSet([]evaluationCriteria{c})
+	if err != nil {
+		return
+	}
+	return res[0], nil
+}
+
+func (a *AbsentTest) evaluateSet(c []evaluationCriteria) ([]evaluationResult, bool, error) {
+	err := a.validate()
+	if err != nil {
+		return nil, false, err
+	}
+	ret := make([]evaluationResult, 0, len(c))
+	absent := true
+	for _, x := range c {
+		res := evaluationResult{criteria: x, result: true}
+		if a.NoCriteria || a.re.re.MatchString(x.testValue) {
+			debugPrint("evaluateSet(): absent assertion violated by %v \"%v\"\n", x.identifier, x.testValue)
+			res.result = false
+			absent = false
+		}
+		ret = append(ret, res)
+	}
+	return ret, absent, nil
+}
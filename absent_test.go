@@ -0,0 +1,90 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"testing"
+
+	"github.com/mozilla/scribe"
+)
+
+// Used in TestAbsent
+var absentPolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "settings",
+		"raw": {
+			"identifiers": [
+			{ "identifier": "PermitRootLogin", "value": "no" },
+			{ "identifier": "PasswordAuthentication", "value": "yes" }
+			]
+		}
+	},
+
+	{
+		"object": "nosuchfile",
+		"filename": {
+			"path": "./test/filename",
+			"file": "^(nosuchfile)$"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "absent-value",
+		"object": "settings",
+		"expectedresult": true,
+		"absent": {
+			"expression": "^without-password$"
+		}
+	},
+
+	{
+		"test": "present-value",
+		"object": "settings",
+		"expectedresult": false,
+		"absent": {
+			"expression": "^yes$"
+		}
+	},
+
+	{
+		"test": "no-criteria",
+		"object": "nosuchfile",
+		"expectedresult": true,
+		"absent": {
+			"nocriteria": true
+		}
+	},
+
+	{
+		"test": "has-criteria",
+		"object": "settings",
+		"expectedresult": false,
+		"absent": {
+			"nocriteria": true
+		}
+	}
+	]
+}
+`
+
+func TestAbsent(t *testing.T) {
+	doc := genericTestExec(t, absentPolicyDoc)
+	tr, err := scribe.GetResults(doc, "present-value")
+	if err != nil {
+		t.Fatalf("scribe.GetResults: %v", err)
+	}
+	for _, x := range tr.Results {
+		if x.Result != (x.Identifier == "PermitRootLogin") {
+			t.Fatalf("unexpected result %v for %v", x.Result, x.Identifier)
+		}
+	}
+}
@@ -0,0 +1,617 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+// Package agent runs scribe as a long running agent, evaluating a set of
+// documents periodically and reporting its health over HTTP.
+//
+// Documents are evaluated every interval, or on a cron schedule given per
+// document. Runs can be delayed by a random jitter so a fleet of agents
+// does not evaluate at the same time, and blackout windows prevent runs
+// during maintenance.
+//
+// Documents are checked for changes before each run, and optionally
+// periodically between runs. A changed document is validated before it
+// replaces the version being evaluated, so a document that fails to parse
+// does not stop evaluation; the last good version continues to be used.
+// The set of documents can also change while the agent runs, for example
+// when documents are fetched from a policy server.
+//
+// The agent can also update itself periodically between runs. When an
+// update is installed Run returns ErrUpdated, so the caller can restart
+// the new version.
+//
+// The health endpoint reports the version of the agent, the hash of each
+// document as last loaded, the time each document was last evaluated
+// successfully and error counts, so fleet monitoring can detect scanners
+// that are stuck, failing or running outdated documents.
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mozilla/scribe"
+)
+
+// The default time between runs.
+const defaultInterval = time.Hour
+
+// ErrUpdated is returned by Run when Update reports that the agent has been
+// updated.
+var ErrUpdated = errors.New("agent has been updated")
+
+// Agent evaluates documents periodically. Changes to documents are picked
+// up without restarting the agent.
+type Agent struct {
+	Documents []string      // Paths of the documents to evaluate.
+	Interval  time.Duration // Time between runs, defaults to one hour.
+
+	// Schedules maps document paths to the schedule the document is
+	// evaluated on, and Schedule is the schedule for documents not in
+	// Schedules. Documents without a schedule are evaluated when the agent
+	// starts and every interval after that.
+	Schedules map[string]*Schedule
+	Schedule  *Schedule
+
+	// Jitter is the maximum random delay added to each run, so agents
+	// started or scheduled at the same time spread their load.
+	Jitter time.Duration
+
+	// Blackouts match the minutes during which documents are not
+	// evaluated, for example maintenance windows. Runs falling in a
+	// blackout are delayed until it ends.
+	Blackouts []*Schedule
+
+	// Reload is how often documents are checked for changes between
+	// runs, 0 to only check before a document is evaluated. When Run
+	// finds a changed document between runs, it is evaluated immediately,
+	// subject to jitter and blackouts.
+	Reload time.Duration
+
+	// StaleAfter is how long a document can go without being evaluated
+	// successfully before the agent is considered unhealthy. It defaults
+	// to three times the interval, or for scheduled documents the time
+	// until the third scheduled run.
+	StaleAfter time.Duration
+
+	// Open is used to open documents, defaults to os.Open.
+	Open func(path string) (io.ReadCloser, error)
+
+	// Results, if set, is called with each document once it has been
+	// analyzed, for example to write the results to an output sink. An
+	// error counts as a failed run of the document.
+	Results func(path string, doc *scribe.Document) error
+
+	// Sync, if set, is called before documents are evaluated or checked
+	// for changes, and returns the paths of the documents to evaluate,
+	// replacing Documents. If it returns an error the documents are left
+	// unchanged.
+	Sync func() ([]string, error)
+
+	// OnError, if set, is called when a document can not be evaluated,
+	// or with an empty path when Sync fails.
+	OnError func(path string, err error)
+
+	// Update, if set, is called every UpdateInterval between runs to
+	// update the agent, and returns true if an update was installed, in
+	// which case Run returns ErrUpdated. An error is reported in the
+	// status of the agent, and the agent continues with the current
+	// version.
+	Update         func() (bool, error)
+	UpdateInterval time.Duration
+
+	mu        sync.Mutex
+	started   time.Time
+	syncError string
+	updateErr string
+	status    map[string]*DocumentStatus
+	docs      map[string]*document
+	rand      *rand.Rand
+}
+
+// document is the version of a document being evaluated.
+type document struct {
+	buf    []byte
+	hash   string
+	failed string // The hash of the last version that failed to load.
+}
+
+// Status describes the health of an agent.
+type Status struct {
+	Version     string           `json:"version"`
+	Started     time.Time        `json:"started"`
+	Healthy     bool             `json:"healthy"`
+	Reasons     []string         `json:"reasons,omitempty"` // Why the agent is not healthy.
+	SyncError   string           `json:"syncerror,omitempty"`
+	UpdateError string           `json:"updateerror,omitempty"` // Why the last update check failed.
+	Documents   []DocumentStatus `json:"documents"`
+}
+
+// DocumentStatus describes the evaluation of a document by an agent. Times
+// are zero if the document has not been evaluated, or has never been
+// evaluated successfully.
+type DocumentStatus struct {
+	Path        string    `json:"path"`
+	SHA256      string    `json:"sha256,omitempty"` // The hash of the version being evaluated.
+	Loaded      time.Time `json:"loaded"`           // When the version being evaluated was loaded.
+	Reloads     int       `json:"reloads"`          // Times a changed version replaced the previous one.
+	ReloadError string    `json:"reloaderror,omitempty"`
+	LastRun     time.Time `json:"lastrun"`
+	LastSuccess time.Time `json:"lastsuccess"`
+	Runs        int       `json:"runs"`
+	Errors      int       `json:"errors"`     // Runs where the document could not be loaded or analyzed.
+	TestErrors  int       `json:"testerrors"` // Tests resulting in an error in the last successful run.
+	LastError   string    `json:"lasterror,omitempty"`
+	NextRun     time.Time `json:"nextrun"` // Zero unless the agent is running.
+}
+
+func (a *Agent) init() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.status != nil {
+		return
+	}
+	a.started = time.Now().UTC()
+	a.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	a.status = make(map[string]*DocumentStatus)
+	a.docs = make(map[string]*document)
+	for _, x := range a.Documents {
+		a.status[x] = &DocumentStatus{Path: x}
+		a.docs[x] = &document{}
+	}
+}
+
+func (a *Agent) interval() time.Duration {
+	if a.Interval <= 0 {
+		return defaultInterval
+	}
+	return a.Interval
+}
+
+// Return the schedule of the document at path, or nil if the document is
+// evaluated every interval.
+func (a *Agent) schedule(path string) *Schedule {
+	if s, ok := a.Schedules[path]; ok {
+		return s
+	}
+	return a.Schedule
+}
+
+// Return the time after which the document at path, last evaluated
+// successfully at since, is stale.
+func (a *Agent) staleAt(path string, since time.Time) time.Time {
+	if a.StaleAfter > 0 {
+		return since.Add(a.StaleAfter)
+	}
+	sched := a.schedule(path)
+	if sched == nil {
+		return since.Add(3 * a.interval())
+	}
+	t := since
+	for i := 0; i < 3; i++ {
+		t = a.unblocked(sched.Next(t))
+		if t.IsZero() {
+			// The document will not run again, so it can not be stale.
+			return time.Time{}
+		}
+	}
+	return t.Add(a.Jitter)
+}
+
+// Return the first time not in a blackout from t, or the zero time if
+// there is none within the next year.
+func (a *Agent) unblocked(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	for i := 0; i < 366*24*60; i++ {
+		blocked := false
+		for _, x := range a.Blackouts {
+			if x.Matches(t) {
+				blocked = true
+				break
+			}
+		}
+		if !blocked {
+			return t
+		}
+		t = t.Truncate(time.Minute).Add(time.Minute)
+	}
+	return time.Time{}
+}
+
+// Return the time the document at path should next be evaluated, after
+// the run at last, or the zero time if it will not be evaluated again. If
+// first is true the document has not been evaluated since the agent
+// started.
+func (a *Agent) nextRun(path string, last time.Time, first bool) time.Time {
+	var t time.Time
+	if sched := a.schedule(path); sched != nil {
+		t = sched.Next(last)
+	} else if first {
+		t = last
+	} else {
+		t = last.Add(a.interval())
+	}
+	if t.IsZero() {
+		return t
+	}
+	return a.unblocked(a.jitter(t))
+}
+
+// Return t delayed by a random duration of up to the jitter.
+func (a *Agent) jitter(t time.Time) time.Time {
+	if a.Jitter <= 0 {
+		return t
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return t.Add(time.Duration(a.rand.Int63n(int64(a.Jitter))))
+}
+
+// Run evaluates the documents on their schedules until ctx is cancelled,
+// or until an update is installed if Update is set.
+func (a *Agent) Run(ctx context.Context) error {
+	a.init()
+	a.sync()
+	next := make(map[string]time.Time)
+	now := time.Now()
+	var reload <-chan time.Time
+	if a.Reload > 0 {
+		ticker := time.NewTicker(a.Reload)
+		defer ticker.Stop()
+		reload = ticker.C
+	}
+	var update <-chan time.Time
+	if a.Update != nil && a.UpdateInterval > 0 {
+		ticker := time.NewTicker(a.UpdateInterval)
+		defer ticker.Stop()
+		update = ticker.C
+	}
+	for _, x := range a.Documents {
+		next[x] = a.nextRun(x, now, true)
+	}
+	for {
+		var first time.Time
+		a.mu.Lock()
+		for _, x := range a.Documents {
+			a.status[x].NextRun = time.Time{}
+			if next[x].IsZero() {
+				continue
+			}
+			a.status[x].NextRun = next[x].UTC()
+			if first.IsZero() || next[x].Before(first) {
+				first = next[x]
+			}
+		}
+		a.mu.Unlock()
+		// If no document will be evaluated again, wait for
+		// cancellation so the status remains available.
+		var timer *time.Timer
+		var wait <-chan time.Time
+		if !first.IsZero() {
+			timer = time.NewTimer(time.Until(first))
+			wait = timer.C
+		}
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return ctx.Err()
+		case <-wait:
+		case <-update:
+			if timer != nil {
+				timer.Stop()
+			}
+			if a.update() {
+				return ErrUpdated
+			}
+		case <-reload:
+			if timer != nil {
+				timer.Stop()
+			}
+			for _, x := range a.Documents {
+				changed, err := a.reload(x)
+				if err != nil && a.OnError != nil {
+					a.OnError(x, err)
+				}
+				if changed {
+					next[x] = a.unblocked(a.jitter(time.Now()))
+				}
+			}
+		}
+		// Documents added by Sync are evaluated as if the agent had
+		// just started.
+		a.sync()
+		now = time.Now()
+		for x := range next {
+			if a.status[x] == nil {
+				delete(next, x)
+			}
+		}
+		for _, x := range a.Documents {
+			if _, ok := next[x]; !ok {
+				next[x] = a.nextRun(x, now, true)
+			}
+		}
+		for _, x := range a.Documents {
+			if next[x].IsZero() || next[x].After(now) {
+				continue
+			}
+			a.runDocument(x)
+			next[x] = a.nextRun(x, time.Now(), false)
+		}
+	}
+}
+
+// RunOnce evaluates each document once, returning the number of documents
+// that could not be evaluated.
+func (a *Agent) RunOnce() int {
+	a.init()
+	a.sync()
+	nerr := 0
+	for _, x := range a.Documents {
+		if !a.runDocument(x) {
+			nerr++
+		}
+	}
+	return nerr
+}
+
+// Call Update, recording an error in the status. Returns true if an update
+// was installed.
+func (a *Agent) update() bool {
+	updated, err := a.Update()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.updateErr = ""
+	if err != nil {
+		a.updateErr = err.Error()
+	}
+	return updated
+}
+
+// Call Sync if set, replacing the documents with those it returns.
+func (a *Agent) sync() {
+	if a.Sync == nil {
+		return
+	}
+	paths, err := a.Sync()
+	if err != nil && a.OnError != nil {
+		a.OnError("", err)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err != nil {
+		a.syncError = err.Error()
+		return
+	}
+	a.syncError = ""
+	keep := make(map[string]bool)
+	for _, x := range paths {
+		keep[x] = true
+		if a.status[x] == nil {
+			a.status[x] = &DocumentStatus{Path: x}
+			a.docs[x] = &document{}
+		}
+	}
+	for x := range a.status {
+		if !keep[x] {
+			delete(a.status, x)
+			delete(a.docs, x)
+		}
+	}
+	a.Documents = paths
+}
+
+// Evaluate the document at path and record the result in its status,
+// returning false if the document could not be evaluated.
+func (a *Agent) runDocument(path string) bool {
+	ntesterr, err := a.evaluate(path)
+	if err != nil && a.OnError != nil {
+		a.OnError(path, err)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	s := a.status[path]
+	s.Runs++
+	s.LastRun = time.Now().UTC()
+	if err != nil {
+		s.Errors++
+		s.LastError = err.Error()
+		return false
+	}
+	s.LastSuccess = s.LastRun
+	s.TestErrors = ntesterr
+	s.LastError = ""
+	return true
+}
+
+// Check the document at path for changes. A changed document is loaded to
+// validate it before it replaces the version being evaluated; if it can
+// not be read or loaded the previous version is kept. Returns true if the
+// version being evaluated was replaced. An error is returned when the
+// document first fails to reload, so the failure is reported once.
+func (a *Agent) reload(path string) (bool, error) {
+	open := a.Open
+	if open == nil {
+		open = func(p string) (io.ReadCloser, error) { return os.Open(p) }
+	}
+	var buf []byte
+	fd, err := open(path)
+	if err == nil {
+		buf, err = ioutil.ReadAll(fd)
+		fd.Close()
+	}
+	sum := sha256.Sum256(buf)
+	hash := hex.EncodeToString(sum[:])
+
+	a.mu.Lock()
+	d, s := a.docs[path], a.status[path]
+	if err == nil {
+		if hash == d.hash {
+			d.failed = ""
+			s.ReloadError = ""
+			a.mu.Unlock()
+			return false, nil
+		}
+		if hash == d.failed {
+			a.mu.Unlock()
+			return false, nil
+		}
+	}
+	a.mu.Unlock()
+
+	if err == nil {
+		_, err = scribe.LoadDocument(bytes.NewReader(buf))
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err != nil {
+		if s.ReloadError == err.Error() {
+			return false, nil
+		}
+		d.failed = ""
+		if buf != nil {
+			d.failed = hash
+		}
+		s.ReloadError = err.Error()
+		return false, err
+	}
+	if d.buf != nil {
+		s.Reloads++
+	}
+	d.buf, d.hash, d.failed = buf, hash, ""
+	s.SHA256 = hash
+	s.Loaded = time.Now().UTC()
+	s.ReloadError = ""
+	return true, nil
+}
+
+// Evaluate the document at path, returning the number of tests resulting
+// in an error.
+func (a *Agent) evaluate(path string) (int, error) {
+	_, err := a.reload(path)
+	a.mu.Lock()
+	buf, reloadErr := a.docs[path].buf, a.status[path].ReloadError
+	a.mu.Unlock()
+	if buf == nil {
+		return 0, errors.New(reloadErr)
+	}
+	if err != nil && a.OnError != nil {
+		a.OnError(path, fmt.Errorf("%v, evaluating previous version", err))
+	}
+	doc, err := scribe.LoadDocument(bytes.NewReader(buf))
+	if err != nil {
+		return 0, err
+	}
+	err = scribe.AnalyzeDocument(doc)
+	if err != nil {
+		return 0, err
+	}
+	ntesterr := 0
+	for _, x := range doc.GetTestIdentifiers() {
+		tr, err := scribe.GetResults(&doc, x)
+		if err != nil {
+			return 0, err
+		}
+		if tr.IsError {
+			ntesterr++
+		}
+	}
+	if a.Results != nil {
+		err = a.Results(path, &doc)
+		if err != nil {
+			return ntesterr, err
+		}
+	}
+	return ntesterr, nil
+}
+
+// Status returns the current status of the agent.
+func (a *Agent) Status() Status {
+	a.init()
+	// The status is copied while holding the lock, and staleness computed
+	// after releasing it, as finding the next runs outside of blackouts can
+	// take some time.
+	a.mu.Lock()
+	ret := Status{
+		Version:     scribe.Version,
+		Started:     a.started,
+		Healthy:     true,
+		SyncError:   a.syncError,
+		UpdateError: a.updateErr,
+		Documents:   make([]DocumentStatus, 0, len(a.status)),
+	}
+	for _, x := range a.status {
+		ret.Documents = append(ret.Documents, *x)
+	}
+	a.mu.Unlock()
+	now := time.Now()
+	for _, x := range ret.Documents {
+		since := x.LastSuccess
+		if since.IsZero() {
+			since = ret.Started
+		}
+		stale := a.staleAt(x.Path, since)
+		if !stale.IsZero() && now.After(stale) {
+			ret.Healthy = false
+			if x.LastSuccess.IsZero() {
+				ret.Reasons = append(ret.Reasons, fmt.Sprintf("%v has not been evaluated successfully", x.Path))
+			} else {
+				ret.Reasons = append(ret.Reasons, fmt.Sprintf("%v has not been evaluated successfully since %v",
+					x.Path, x.LastSuccess.Format(time.RFC3339)))
+			}
+		}
+	}
+	sort.Slice(ret.Documents, func(i, j int) bool { return ret.Documents[i].Path < ret.Documents[j].Path })
+	sort.Strings(ret.Reasons)
+	return ret
+}
+
+// Handler returns an http.Handler serving the status of the agent as JSON.
+// Requests for /health return status 200 if the agent is healthy and 503
+// if not, so the endpoint can be used directly by health checks; requests
+// for /status always return status 200.
+func (a *Agent) Handler() http.Handler {
+	mux := http.NewServeMux()
+	write := func(w http.ResponseWriter, r *http.Request, health bool) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s := a.Status()
+		buf, err := json.MarshalIndent(s, "", "    ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if health && !s.Healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		w.Write(append(buf, '\n'))
+	}
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) { write(w, r, true) })
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) { write(w, r, false) })
+	return mux
+}
@@ -0,0 +1,250 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package agent_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mozilla/scribe"
+	"github.com/mozilla/scribe/agent"
+)
+
+var agentDoc = `
+{
+	"objects": [
+	{
+		"object": "raw",
+		"raw": {
+			"identifiers": [
+			{ "identifier": "a", "value": "b" }
+			]
+		}
+	}
+	],
+	"tests": [
+	{ "test": "ok", "object": "raw" },
+	{ "test": "broken", "object": "missing" }
+	]
+}
+`
+
+func TestAgent(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.json")
+	bad := filepath.Join(dir, "bad.json")
+	err := ioutil.WriteFile(good, []byte(agentDoc), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(bad, []byte("{ not a document }"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := 0
+	a := &agent.Agent{
+		Documents:  []string{good, bad},
+		StaleAfter: time.Hour,
+		Results: func(path string, doc *scribe.Document) error {
+			results++
+			return nil
+		},
+	}
+	if n := a.RunOnce(); n != 1 {
+		t.Fatalf("RunOnce returned %v", n)
+	}
+	a.RunOnce()
+	s := a.Status()
+	if !s.Healthy || s.Version != scribe.Version || len(s.Documents) != 2 || results != 2 {
+		t.Fatalf("unexpected status %+v", s)
+	}
+	sum := sha256.Sum256([]byte(agentDoc))
+	b, g := s.Documents[0], s.Documents[1]
+	if g.Path != good || g.SHA256 != hex.EncodeToString(sum[:]) || g.Runs != 2 || g.Errors != 0 ||
+		g.TestErrors != 1 || g.LastSuccess.IsZero() || g.LastError != "" {
+		t.Fatalf("unexpected document status %+v", g)
+	}
+	if b.Path != bad || b.Runs != 2 || b.Errors != 2 || !b.LastSuccess.IsZero() || b.LastError == "" {
+		t.Fatalf("unexpected document status %+v", b)
+	}
+
+	srv := httptest.NewServer(a.Handler())
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected health status %v", resp.StatusCode)
+	}
+
+	// Once the document has not been evaluated successfully within
+	// StaleAfter the agent is unhealthy, but the status is still
+	// available.
+	a.StaleAfter = time.Nanosecond
+	resp, err = http.Get(srv.URL + "/health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hs agent.Status
+	err = json.NewDecoder(resp.Body).Decode(&hs)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable || hs.Healthy || len(hs.Reasons) != 2 ||
+		!strings.Contains(hs.Reasons[0], "bad.json has not been evaluated successfully") {
+		t.Fatalf("unexpected health %v %+v", resp.StatusCode, hs)
+	}
+	resp, err = http.Get(srv.URL + "/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status code %v", resp.StatusCode)
+	}
+}
+
+func TestAgentReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "doc.json")
+	err := ioutil.WriteFile(path, []byte(agentDoc), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errs []string
+	a := &agent.Agent{
+		Documents: []string{path},
+		Interval:  time.Hour,
+		Reload:    10 * time.Millisecond,
+		OnError:   func(path string, err error) { errs = append(errs, err.Error()) },
+	}
+	a.RunOnce()
+	first := a.Status().Documents[0]
+
+	// A version that fails to load is reported once, and the previous
+	// version continues to be evaluated.
+	err = ioutil.WriteFile(path, []byte("{ not a document }"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.RunOnce()
+	a.RunOnce()
+	s := a.Status().Documents[0]
+	if s.Runs != 3 || s.Errors != 0 || s.SHA256 != first.SHA256 || s.Reloads != 0 || s.ReloadError == "" ||
+		len(errs) != 1 || !strings.Contains(errs[0], "evaluating previous version") {
+		t.Fatalf("unexpected document status %+v %v", s, errs)
+	}
+
+	// A valid change is picked up between runs and evaluated immediately.
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- a.Run(ctx) }()
+	wait := func(runs int) agent.DocumentStatus {
+		for i := 0; i < 100; i++ {
+			s := a.Status().Documents[0]
+			if s.Runs >= runs {
+				return s
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("document was not evaluated %v times", runs)
+		return agent.DocumentStatus{}
+	}
+	wait(4)
+	changed := strings.Replace(agentDoc, `"value": "b"`, `"value": "c"`, 1)
+	err = ioutil.WriteFile(path, []byte(changed), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = wait(5)
+	cancel()
+	<-done
+	sum := sha256.Sum256([]byte(changed))
+	if s.Runs != 5 || s.SHA256 != hex.EncodeToString(sum[:]) || s.Reloads != 1 || s.ReloadError != "" ||
+		!s.Loaded.After(first.Loaded) {
+		t.Fatalf("unexpected document status %+v", s)
+	}
+}
+
+func TestAgentUpdate(t *testing.T) {
+	var a *agent.Agent
+	calls := 0
+	updateErr := errors.New("release manifest signature is invalid")
+	a = &agent.Agent{
+		Documents:      []string{"a"},
+		Interval:       time.Hour,
+		UpdateInterval: 10 * time.Millisecond,
+		Open: func(path string) (io.ReadCloser, error) {
+			return ioutil.NopCloser(strings.NewReader(agentDoc)), nil
+		},
+		// The first check fails, the second installs an update.
+		Update: func() (bool, error) {
+			calls++
+			if calls == 1 {
+				return false, updateErr
+			}
+			if s := a.Status(); s.UpdateError != updateErr.Error() {
+				t.Errorf("update error not reported in status %+v", s)
+			}
+			return true, nil
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := a.Run(ctx)
+	if err != agent.ErrUpdated {
+		t.Fatalf("Run returned %v", err)
+	}
+	s := a.Status()
+	if calls != 2 || s.UpdateError != "" || s.Documents[0].Runs != 1 {
+		t.Fatalf("unexpected status after %v update checks %+v", calls, s)
+	}
+}
+
+func TestAgentSync(t *testing.T) {
+	docs := []string{"a", "b"}
+	var syncErr error
+	a := &agent.Agent{
+		Sync: func() ([]string, error) { return docs, syncErr },
+		Open: func(path string) (io.ReadCloser, error) {
+			return ioutil.NopCloser(strings.NewReader(agentDoc)), nil
+		},
+	}
+	if n := a.RunOnce(); n != 0 {
+		t.Fatalf("RunOnce returned %v", n)
+	}
+	docs = []string{"b", "c"}
+	a.RunOnce()
+	s := a.Status()
+	if len(s.Documents) != 2 || s.Documents[0].Path != "b" || s.Documents[0].Runs != 2 ||
+		s.Documents[1].Path != "c" || s.Documents[1].Runs != 1 || s.SyncError != "" {
+		t.Fatalf("unexpected status %+v", s)
+	}
+
+	// If Sync fails the documents are left unchanged.
+	docs, syncErr = nil, errors.New("policy server unavailable")
+	a.RunOnce()
+	s = a.Status()
+	if len(s.Documents) != 2 || s.Documents[1].Runs != 2 || s.SyncError != syncErr.Error() {
+		t.Fatalf("unexpected status %+v", s)
+	}
+}
@@ -0,0 +1,199 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package agent
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a cron expression, matching the minutes a document is
+// evaluated at, or the minutes of a blackout window.
+//
+// Expressions have the five standard fields: minute (0-59), hour (0-23),
+// day of month (1-31), month (1-12 or jan-dec) and day of week (0-7 or
+// sun-sat, with 0 and 7 both Sunday). Each field is *, a value, a range
+// such as 1-5, or a comma separated list of these, optionally followed by
+// a step such as */15 or 0-30/10. As with cron, if both the day of month
+// and day of week are restricted, a time matches if either matches. The
+// shortcuts @hourly, @daily (or @midnight), @weekly, @monthly and @yearly
+// (or @annually) can also be used. Times are matched in local time.
+type Schedule struct {
+	expr string
+
+	minute, hour, dom, month, dow uint64 // Bit sets of matching values.
+	domStar, dowStar              bool   // True if the field is unrestricted.
+}
+
+var cronShortcuts = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var cronMonths = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+
+var cronDays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// The maximum number of days searched for a time matching a schedule, so
+// expressions that can never match (such as February 30) terminate.
+const cronSearchDays = 5 * 366
+
+// ParseSchedule parses a cron expression.
+func ParseSchedule(expr string) (*Schedule, error) {
+	s := &Schedule{expr: expr}
+	fields := strings.Fields(expr)
+	if len(fields) == 1 {
+		if v, ok := cronShortcuts[strings.ToLower(fields[0])]; ok {
+			fields = strings.Fields(v)
+		}
+	}
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("schedule %q must have 5 fields", expr)
+	}
+	var err error
+	for i, x := range []struct {
+		set      *uint64
+		min, max int
+		names    []string
+		nameBase int
+	}{
+		{&s.minute, 0, 59, nil, 0},
+		{&s.hour, 0, 23, nil, 0},
+		{&s.dom, 1, 31, nil, 0},
+		{&s.month, 1, 12, cronMonths, 1},
+		{&s.dow, 0, 7, cronDays, 0},
+	} {
+		*x.set, err = parseCronField(fields[i], x.min, x.max, x.names, x.nameBase)
+		if err != nil {
+			return nil, fmt.Errorf("schedule %q: %v", expr, err)
+		}
+	}
+	// Sunday can be given as 7.
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domStar = strings.HasPrefix(fields[2], "*")
+	s.dowStar = strings.HasPrefix(fields[4], "*")
+	return s, nil
+}
+
+// Parse a field of a cron expression, returning the set of matching values.
+func parseCronField(f string, min int, max int, names []string, nameBase int) (uint64, error) {
+	var ret uint64
+	value := func(v string) (int, error) {
+		for i, x := range names {
+			if strings.EqualFold(v, x) {
+				return i + nameBase, nil
+			}
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < min || n > max {
+			return 0, fmt.Errorf("invalid value %q, must be %v-%v", v, min, max)
+		}
+		return n, nil
+	}
+	for _, x := range strings.Split(f, ",") {
+		step := 1
+		if i := strings.Index(x, "/"); i != -1 {
+			n, err := strconv.Atoi(x[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", x)
+			}
+			step = n
+			x = x[:i]
+		}
+		lo, hi := min, max
+		switch {
+		case x == "*":
+		case strings.Contains(x, "-"):
+			i := strings.Index(x, "-")
+			var err error
+			if lo, err = value(x[:i]); err != nil {
+				return 0, err
+			}
+			if hi, err = value(x[i+1:]); err != nil {
+				return 0, err
+			}
+			if hi < lo {
+				return 0, fmt.Errorf("invalid range %q", x)
+			}
+		default:
+			var err error
+			if lo, err = value(x); err != nil {
+				return 0, err
+			}
+			// A single value with a step, such as 5/15, runs from
+			// the value to the maximum.
+			hi = lo
+			if step != 1 {
+				hi = max
+			}
+		}
+		for n := lo; n <= hi; n += step {
+			ret |= 1 << uint(n)
+		}
+	}
+	return ret, nil
+}
+
+// String returns the expression the schedule was parsed from.
+func (s *Schedule) String() string {
+	return s.expr
+}
+
+func (s *Schedule) matchDay(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Matches returns true if the minute containing t matches the schedule.
+func (s *Schedule) Matches(t time.Time) bool {
+	t = t.Local()
+	return s.minute&(1<<uint(t.Minute())) != 0 && s.hour&(1<<uint(t.Hour())) != 0 &&
+		s.month&(1<<uint(t.Month())) != 0 && s.matchDay(t)
+}
+
+// Next returns the start of the first minute matching the schedule after t,
+// or the zero time if the schedule does not match any time in the next five
+// years.
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.Local()
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, t.Location()).Add(time.Minute)
+	limit := t.AddDate(0, 0, cronSearchDays)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
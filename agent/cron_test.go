@@ -0,0 +1,124 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package agent_test
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mozilla/scribe/agent"
+)
+
+func TestSchedule(t *testing.T) {
+	at := func(s string) time.Time {
+		ret, err := time.ParseInLocation("2006-01-02 15:04", s, time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ret
+	}
+	for _, x := range []struct {
+		expr, from, next string
+	}{
+		{"*/15 * * * *", "2024-03-01 10:07", "2024-03-01 10:15"},
+		{"*/15 * * * *", "2024-03-01 10:15", "2024-03-01 10:30"},
+		{"0 3 * * *", "2024-03-01 10:07", "2024-03-02 03:00"},
+		{"30 2 * * sat", "2024-03-01 10:07", "2024-03-02 02:30"},
+		{"0 0 * * 7", "2024-03-01 10:07", "2024-03-03 00:00"},
+		{"0 9-17/4 * * mon-fri", "2024-03-01 14:00", "2024-03-01 17:00"},
+		{"0 9-17/4 * * mon-fri", "2024-03-01 17:00", "2024-03-04 09:00"},
+		{"0 0 1,15 feb *", "2024-03-01 10:07", "2025-02-01 00:00"},
+		{"0 0 29 2 *", "2024-03-01 10:07", "2028-02-29 00:00"},
+		// Day of month and day of week match either when both are set.
+		{"0 0 13 * fri", "2024-03-01 10:07", "2024-03-08 00:00"},
+		{"@monthly", "2024-03-01 10:07", "2024-04-01 00:00"},
+		{"0 0 30 2 *", "2024-03-01 10:07", ""},
+	} {
+		s, err := agent.ParseSchedule(x.expr)
+		if err != nil {
+			t.Fatalf("agent.ParseSchedule: %v", err)
+		}
+		next := s.Next(at(x.from))
+		if x.next == "" {
+			if !next.IsZero() {
+				t.Fatalf("%v from %v returned %v", x.expr, x.from, next)
+			}
+			continue
+		}
+		if !next.Equal(at(x.next)) || !s.Matches(next) {
+			t.Fatalf("%v from %v returned %v", x.expr, x.from, next)
+		}
+		if s.Matches(next.Add(-time.Minute)) {
+			t.Fatalf("%v should not match before %v", x.expr, next)
+		}
+	}
+
+	for _, x := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "5-1 * * * *",
+		"*/0 * * * *", "* * * foo *", "@often"} {
+		_, err := agent.ParseSchedule(x)
+		if err == nil {
+			t.Fatalf("agent.ParseSchedule should have failed for %q", x)
+		}
+	}
+}
+
+func TestAgentRun(t *testing.T) {
+	every := agent.Agent{
+		Documents: []string{"every", "scheduled"},
+		Interval:  50 * time.Millisecond,
+		Jitter:    10 * time.Millisecond,
+		Open: func(path string) (io.ReadCloser, error) {
+			return ioutil.NopCloser(strings.NewReader(agentDoc)), nil
+		},
+	}
+	sched, err := agent.ParseSchedule("@yearly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	every.Schedules = map[string]*agent.Schedule{"scheduled": sched}
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	err = every.Run(ctx)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Run returned %v", err)
+	}
+	s := every.Status()
+	e, y := s.Documents[0], s.Documents[1]
+	if e.Runs < 2 || e.NextRun.IsZero() {
+		t.Fatalf("unexpected document status %+v", e)
+	}
+	// The scheduled document has not run yet, but is not stale until it
+	// has missed scheduled runs.
+	due := sched.Next(time.Now())
+	if y.Runs != 0 || y.NextRun.Before(due) || !y.NextRun.Before(due.Add(every.Jitter)) || !s.Healthy {
+		t.Fatalf("unexpected status %+v", s)
+	}
+
+	// A blackout covering every minute defers all runs.
+	all, err := agent.ParseSchedule("* * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocked := agent.Agent{
+		Documents: []string{"every"},
+		Interval:  time.Millisecond,
+		Blackouts: []*agent.Schedule{all},
+		Open:      every.Open,
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	blocked.Run(ctx)
+	s = blocked.Status()
+	if s.Documents[0].Runs != 0 || !s.Documents[0].NextRun.IsZero() {
+		t.Fatalf("unexpected status %+v", s)
+	}
+}
@@ -0,0 +1,135 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// AllowlistTest is used to verify file hashes, as returned by a filehash
+// object, against an external allowlist of known good files. This provides
+// lightweight file integrity monitoring, where the allowlist is generated
+// from a known good system.
+//
+// File is the path to the allowlist, which uses the format produced by
+// sha256sum: each line contains a hex encoded hash and a path separated by
+// white space. Blank lines and lines starting with # are ignored. A path
+// may be listed more than once if several versions of a file are allowed.
+//
+// A criteria is true if the hash is listed for the path of the file. If
+// AnyPath is true, the hash may be listed for any path, which is useful if
+// binaries are installed in varying locations. Files with a path not in the
+// allowlist are reported as unknown, and files with a hash not listed for
+// their path as mismatched, in the debug output.
+//
+// Unlike other evaluators where the test is true if any criteria matches,
+// the test is only true if all criteria are allowed.
+type AllowlistTest struct {
+	File    string `json:"file,omitempty" yaml:"file,omitempty"`
+	AnyPath bool   `json:"anypath,omitempty" yaml:"anypath,omitempty"`
+
+	paths  map[string]map[string]bool
+	hashes map[string]bool
+}
+
+func (a *AllowlistTest) load() error {
+	if a.paths != nil {
+		return nil
+	}
+	fd, err := os.Open(a.File)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	paths := make(map[string]map[string]bool)
+	hashes := make(map[string]bool)
+	scanner := bufio.NewScanner(fd)
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		ln := strings.TrimSpace(scanner.Text())
+		if ln == "" || strings.HasPrefix(ln, "#") {
+			continue
+		}
+		s := strings.Fields(ln)
+		if len(s) < 2 {
+			return fmt.Errorf("allowlist %v line %v: expected hash and path", a.File, lineno)
+		}
+		h := strings.ToLower(s[0])
+		// sha256sum prefixes the path with * for files hashed in
+		// binary mode.
+		p := strings.TrimPrefix(strings.TrimSpace(ln[len(s[0]):]), "*")
+		if paths[p] == nil {
+			paths[p] = make(map[string]bool)
+		}
+		paths[p][h] = true
+		hashes[h] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	debugPrint("loaded %v allowlist path(s) from %v\n", len(paths), a.File)
+	a.paths = paths
+	a.hashes = hashes
+	return nil
+}
+
+func (a *AllowlistTest) evaluate(c evaluationCriteria) (ret evaluationResult, err error) {
+	err = a.load()
+	if err != nil {
+		return
+	}
+	ret.criteria = c
+	h := strings.ToLower(c.testValue)
+	if a.AnyPath {
+		ret.result = a.hashes[h]
+		if !ret.result {
+			debugPrint("evaluate(): allowlist %v unknown hash %v\n", c.identifier, h)
+		}
+		return
+	}
+	// The identifier lists each path if the locator has deduplicated
+	// the file, the file is allowed if any path is allowed.
+	known := false
+	for _, p := range strings.Split(c.identifier, ", ") {
+		hs, ok := a.paths[p]
+		if !ok {
+			continue
+		}
+		known = true
+		if hs[h] {
+			ret.result = true
+			return
+		}
+	}
+	if known {
+		debugPrint("evaluate(): allowlist %v mismatched hash %v\n", c.identifier, h)
+	} else {
+		debugPrint("evaluate(): allowlist %v unknown path\n", c.identifier)
+	}
+	return
+}
+
+func (a *AllowlistTest) evaluateSet(c []evaluationCriteria) ([]evaluationResult, bool, error) {
+	ret := make([]evaluationResult, 0, len(c))
+	all := true
+	for _, x := range c {
+		res, err := a.evaluate(x)
+		if err != nil {
+			return nil, false, err
+		}
+		if !res.result {
+			all = false
+		}
+		ret = append(ret, res)
+	}
+	return ret, all, nil
+}
@@ -0,0 +1,382 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// Files located within archives are identified using the path to the
+// archive, followed by this separator and the path of the member within the
+// archive.
+const archiveSeparator = "!"
+
+// Default limits applied to archive descent if not specified in the
+// locator options.
+const (
+	defaultArchiveDepth   = 1
+	defaultArchiveMaxSize = 64 * 1024 * 1024
+)
+
+type archiveOpenFunc func() (io.ReadCloser, error)
+
+// Return the type of archive based on the file name, or an empty string if
+// the file is not a supported archive type.
+func archiveType(name string) string {
+	n := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(n, ".tar.gz"), strings.HasSuffix(n, ".tgz"):
+		return "tgz"
+	case strings.HasSuffix(n, ".tar"):
+		return "tar"
+	case strings.HasSuffix(n, ".zip"), strings.HasSuffix(n, ".jar"),
+		strings.HasSuffix(n, ".war"), strings.HasSuffix(n, ".ear"):
+		return "zip"
+	}
+	return ""
+}
+
+// Call fn for each regular file within the archive. The open function passed
+// to fn is only valid for the duration of the call.
+func walkArchive(name string, ra io.ReaderAt, size int64, fn func(string, int64, archiveOpenFunc) error) error {
+	switch archiveType(name) {
+	case "zip":
+		zr, err := zip.NewReader(ra, size)
+		if err != nil {
+			return err
+		}
+		for _, x := range zr.File {
+			if !x.Mode().IsRegular() {
+				continue
+			}
+			err = fn(x.Name, int64(x.UncompressedSize64), x.Open)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case "tar", "tgz":
+		var rdr io.Reader = io.NewSectionReader(ra, 0, size)
+		if archiveType(name) == "tgz" {
+			gz, err := gzip.NewReader(rdr)
+			if err != nil {
+				return err
+			}
+			defer gz.Close()
+			rdr = gz
+		}
+		tr := tar.NewReader(rdr)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if hdr.Typeflag != tar.TypeReg {
+				continue
+			}
+			open := func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(tr), nil
+			}
+			err = fn(hdr.Name, hdr.Size, open)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("%v is not a supported archive type", name)
+}
+
+// Read the content of an archive member, returning an error if it is larger
+// than maxsize.
+func archiveReadMember(open archiveOpenFunc, maxsize int64) ([]byte, error) {
+	rc, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	buf, err := ioutil.ReadAll(io.LimitReader(rc, maxsize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(buf)) > maxsize {
+		return nil, fmt.Errorf("archive member exceeds maximum size of %v bytes", maxsize)
+	}
+	return buf, nil
+}
+
+// Return the maximum archive size and nesting depth, applying the defaults.
+func (o LocatorOptions) archiveLimits() (int64, int) {
+	maxsize := o.ArchiveMaxSize
+	if maxsize == 0 {
+		maxsize = defaultArchiveMaxSize
+	}
+	maxdepth := o.ArchiveDepth
+	if maxdepth == 0 {
+		maxdepth = defaultArchiveDepth
+	}
+	return maxsize, maxdepth
+}
+
+// Search the archive at apath for members matching the locator target,
+// adding any matches to the locator.
+func (s *simpleFileLocator) locateArchive(apath string, match locateMatchFunc) {
+	maxsize, maxdepth := s.opts.archiveLimits()
+	fd, err := os.Open(apath)
+	if err != nil {
+		return
+	}
+	defer fd.Close()
+	fi, err := fd.Stat()
+	if err != nil || fi.Size() > maxsize {
+		debugPrint("locateArchive(): skipping %v\n", apath)
+		return
+	}
+	var descend func(string, io.ReaderAt, int64, int)
+	descend = func(ident string, ra io.ReaderAt, size int64, depth int) {
+		err := walkArchive(ident, ra, size, func(name string, msize int64, open archiveOpenFunc) error {
+			mident := ident + archiveSeparator + name
+			if match(mident, path.Base(name)) {
+				s.addMatch(mident, path.Base(name), fileID{})
+			}
+			if depth < maxdepth && archiveType(name) != "" && msize <= maxsize {
+				buf, err := archiveReadMember(open, maxsize)
+				if err != nil {
+					return nil
+				}
+				descend(mident, bytes.NewReader(buf), int64(len(buf)), depth+1)
+			}
+			return nil
+		})
+		if err != nil {
+			debugPrint("locateArchive(): error reading %v: %v\n", ident, err)
+		}
+	}
+	descend(apath, fd, fi.Size(), 1)
+}
+
+// Open a file returned by the locator, which may be a member of an archive.
+// The options of the locator control whether the file is opened with the
+// privileges of its owner, and the size of archive members that can be read.
+func openLocated(p string, opts LocatorOptions) (io.ReadCloser, error) {
+	err := usageCheck()
+	if err != nil {
+		return nil, err
+	}
+	var rc io.ReadCloser
+	if e := evidenceReplaying(); e != nil {
+		rc, err = e.open(p)
+	} else {
+		rc, err = openLocatedFile(p, opts)
+		if e := evidenceRecording(); e != nil && err == nil {
+			rc, err = e.addFile(p, rc)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Files are accounted to the document being analyzed, whether read
+	// from the file system or an evidence archive.
+	err = usageAdd(1, 0)
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	return &usageReader{rc}, nil
+}
+
+func openLocatedFile(p string, opts LocatorOptions) (io.ReadCloser, error) {
+	open := os.Open
+	if opts.AsOwner {
+		open = openAsOwner
+	}
+	fd, err := open(p)
+	if err == nil {
+		return fd, nil
+	}
+	if !strings.Contains(p, archiveSeparator) {
+		return nil, err
+	}
+	// Find the archive on the file system that contains the member.
+	idx := 0
+	for {
+		i := strings.Index(p[idx:], archiveSeparator)
+		if i == -1 {
+			return nil, err
+		}
+		idx += i
+		fi, serr := os.Stat(p[:idx])
+		if serr == nil && fi.Mode().IsRegular() {
+			break
+		}
+		idx++
+	}
+	afd, err := open(p[:idx])
+	if err != nil {
+		return nil, err
+	}
+	defer afd.Close()
+	fi, err := afd.Stat()
+	if err != nil {
+		return nil, err
+	}
+	buf, err := archiveMember(p[:idx], afd, fi, p[idx+1:], opts)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(buf)), nil
+}
+
+// The members of the archive read most recently, so sources reading several
+// members of an archive do not walk the archive for each member. Members
+// are cached up to a total of the maximum archive size, and if the archive
+// holds more than that complete is false and members not cached are
+// extracted individually.
+var archiveCache struct {
+	sync.Mutex
+	key      string
+	members  map[string][]byte
+	errs     map[string]error
+	complete bool
+}
+
+// Return the content of member in the archive at apath, where member may
+// refer to a file inside a nested archive. The archive has already been
+// opened as fd, so the caller had permission to read it.
+func archiveMember(apath string, fd *os.File, fi os.FileInfo, member string, opts LocatorOptions) ([]byte, error) {
+	maxsize, maxdepth := opts.archiveLimits()
+	if fi.Size() > maxsize {
+		return nil, fmt.Errorf("%v exceeds maximum archive size of %v bytes", apath, maxsize)
+	}
+	key := fmt.Sprintf("%v %v %v %v %v", apath, fi.Size(), fi.ModTime().UnixNano(), maxsize, maxdepth)
+	archiveCache.Lock()
+	if archiveCache.key != key {
+		archiveCache.Unlock()
+		members, errs, complete := archiveLoad(apath, fd, fi.Size(), maxsize, maxdepth)
+		archiveCache.Lock()
+		archiveCache.key = key
+		archiveCache.members = members
+		archiveCache.errs = errs
+		archiveCache.complete = complete
+	}
+	buf, ok := archiveCache.members[member]
+	err, failed := archiveCache.errs[member]
+	complete := archiveCache.complete
+	archiveCache.Unlock()
+	switch {
+	case ok:
+		return buf, nil
+	case failed:
+		return nil, err
+	case complete:
+		return nil, fmt.Errorf("%v not found in %v", member, apath)
+	}
+	return archiveExtract(apath, fd, fi.Size(), member, maxsize)
+}
+
+// Read the members of the archive, descending into nested archives up to
+// maxdepth levels. The members returned are keyed by their path in the
+// archive, and members that could not be read are returned in errs. If the
+// total size of the members exceeds maxsize the remaining members are not
+// returned, and complete is false.
+func archiveLoad(name string, ra io.ReaderAt, size int64, maxsize int64, maxdepth int) (members map[string][]byte, errs map[string]error, complete bool) {
+	members = make(map[string][]byte)
+	errs = make(map[string]error)
+	complete = true
+	var total int64
+	var descend func(string, string, io.ReaderAt, int64, int) error
+	descend = func(ident string, prefix string, ra io.ReaderAt, size int64, depth int) error {
+		return walkArchive(ident, ra, size, func(mname string, msize int64, open archiveOpenFunc) error {
+			if !complete {
+				return nil
+			}
+			key := prefix + mname
+			if msize > maxsize-total {
+				if msize > maxsize {
+					errs[key] = fmt.Errorf("archive member exceeds maximum size of %v bytes", maxsize)
+					return nil
+				}
+				complete = false
+				return nil
+			}
+			buf, err := archiveReadMember(open, maxsize-total)
+			if err != nil {
+				// The member is extracted individually if
+				// requested, returning the error.
+				complete = false
+				return nil
+			}
+			total += int64(len(buf))
+			members[key] = buf
+			if depth < maxdepth && archiveType(mname) != "" {
+				err = descend(mname, key+archiveSeparator, bytes.NewReader(buf), int64(len(buf)), depth+1)
+				if err != nil {
+					complete = false
+				}
+			}
+			return nil
+		})
+	}
+	err := descend(name, "", ra, size, 1)
+	if err != nil {
+		debugPrint("archiveLoad(): error reading %v: %v\n", name, err)
+		complete = false
+	}
+	return members, errs, complete
+}
+
+// Extract member from the archive, where member may refer to a file inside
+// a nested archive, returning an error if the member is larger than maxsize.
+func archiveExtract(name string, ra io.ReaderAt, size int64, member string, maxsize int64) ([]byte, error) {
+	var ret []byte
+	found := false
+	err := walkArchive(name, ra, size, func(mname string, msize int64, open archiveOpenFunc) error {
+		if found {
+			return nil
+		}
+		var rest string
+		if mname == member {
+			found = true
+		} else if strings.HasPrefix(member, mname+archiveSeparator) {
+			found = true
+			rest = member[len(mname)+1:]
+		} else {
+			return nil
+		}
+		buf, err := archiveReadMember(open, maxsize)
+		if err != nil {
+			return err
+		}
+		if rest == "" {
+			ret = buf
+			return nil
+		}
+		ret, err = archiveExtract(mname, bytes.NewReader(buf), int64(len(buf)), rest, maxsize)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("%v not found in %v", member, name)
+	}
+	return ret, nil
+}
@@ -0,0 +1,285 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+// Package auth authenticates requests to the HTTP servers scribe runs, the
+// agent status endpoint and the collector, so they can be exposed beyond
+// localhost.
+//
+// An Authenticator returns the Identity of the client making a request.
+// Tokens authenticates static bearer tokens, ClientCert the certificate a
+// client presented over mutual TLS, and Validator passes bearer tokens to
+// a custom TokenValidator, such as an Introspector validating OAuth 2.0 or
+// OIDC access tokens with the authorization server. Any combines
+// authenticators, and Middleware wraps an http.Handler so only
+// authenticated requests reach it.
+package auth
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mozilla/scribe"
+)
+
+// Identity describes an authenticated client. Method is how the client was
+// authenticated: bearer, clientcert, or the method set by a TokenValidator.
+type Identity struct {
+	Name   string `json:"name"`
+	Method string `json:"method"`
+}
+
+// ErrNoCredentials is returned by authenticators when a request does not
+// include the credentials they authenticate.
+var ErrNoCredentials = errors.New("no credentials")
+
+// Authenticator authenticates HTTP requests, returning the identity of the
+// client, ErrNoCredentials if the request has no credentials of the kind
+// the authenticator handles, or another error if the credentials are
+// invalid.
+type Authenticator interface {
+	Authenticate(r *http.Request) (Identity, error)
+}
+
+// Func adapts a function to an Authenticator.
+type Func func(r *http.Request) (Identity, error)
+
+// Authenticate calls f(r).
+func (f Func) Authenticate(r *http.Request) (Identity, error) {
+	return f(r)
+}
+
+// TokenValidator validates a bearer token, returning the identity it was
+// issued to.
+type TokenValidator func(token string) (Identity, error)
+
+// BearerToken returns the bearer token in the Authorization header of the
+// request, or an empty string if there is none.
+func BearerToken(r *http.Request) string {
+	h := r.Header.Get("Authorization")
+	if len(h) < 7 || !strings.EqualFold(h[:7], "bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(h[7:])
+}
+
+// Tokens returns an Authenticator accepting the bearer tokens in tokens,
+// which maps each token to the name of the identity it authenticates.
+// Every token is compared, in constant time, so authentication does not
+// reveal valid tokens.
+func Tokens(tokens map[string]string) Authenticator {
+	return Validator(func(token string) (Identity, error) {
+		ret, ok := Identity{}, false
+		for k, v := range tokens {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(k)) == 1 {
+				ret, ok = Identity{Name: v, Method: "bearer"}, true
+			}
+		}
+		if !ok {
+			return ret, fmt.Errorf("invalid token")
+		}
+		return ret, nil
+	})
+}
+
+// Validator returns an Authenticator passing the bearer token of each
+// request to v.
+func Validator(v TokenValidator) Authenticator {
+	return Func(func(r *http.Request) (Identity, error) {
+		token := BearerToken(r)
+		if token == "" {
+			return Identity{}, ErrNoCredentials
+		}
+		return v(token)
+	})
+}
+
+// ClientCert returns an Authenticator accepting clients that presented a
+// certificate verified by the server, as configured by
+// scribe.TLSOptions.ServerConfig(). The name of the identity is the common
+// name of the certificate, or its first DNS name if the common name is
+// empty. If names are given only those identities are accepted.
+func ClientCert(names ...string) Authenticator {
+	return Func(func(r *http.Request) (Identity, error) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+			return Identity{}, ErrNoCredentials
+		}
+		cert := r.TLS.VerifiedChains[0][0]
+		ret := Identity{Name: cert.Subject.CommonName, Method: "clientcert"}
+		if ret.Name == "" && len(cert.DNSNames) != 0 {
+			ret.Name = cert.DNSNames[0]
+		}
+		if len(names) == 0 {
+			return ret, nil
+		}
+		for _, x := range names {
+			if x == ret.Name {
+				return ret, nil
+			}
+		}
+		return Identity{}, fmt.Errorf("client certificate %q is not allowed", ret.Name)
+	})
+}
+
+// Any returns an Authenticator trying each of authenticators in turn,
+// returning the first identity authenticated. If none authenticates the
+// request the first error other than ErrNoCredentials is returned.
+func Any(authenticators ...Authenticator) Authenticator {
+	return Func(func(r *http.Request) (Identity, error) {
+		var ret error = ErrNoCredentials
+		for _, x := range authenticators {
+			id, err := x.Authenticate(r)
+			if err == nil {
+				return id, nil
+			}
+			if ret == ErrNoCredentials {
+				ret = err
+			}
+		}
+		return Identity{}, ret
+	})
+}
+
+type contextKey struct{}
+
+// Middleware returns an http.Handler passing requests authenticated by a
+// to next, with the identity of the client available using FromContext().
+// Other requests are rejected with status 401.
+func Middleware(a Authenticator, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := a.Authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, fmt.Sprintf("unauthorized: %v", err), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, id)))
+	})
+}
+
+// FromContext returns the identity of the client set by Middleware.
+func FromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(contextKey{}).(Identity)
+	return id, ok
+}
+
+// LoadTokens loads the bearer tokens in the file at path for use with
+// Tokens(). Each line that is not blank or a comment holds a token,
+// optionally followed by the name of the identity it authenticates.
+func LoadTokens(path string) (map[string]string, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	ret := make(map[string]string)
+	scanner := bufio.NewScanner(fd)
+	n := 0
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		f := strings.Fields(line)
+		if len(f) > 2 {
+			return nil, fmt.Errorf("%v: line %v must be a token and optional name", path, n)
+		}
+		ret[f[0]] = ""
+		if len(f) == 2 {
+			ret[f[0]] = f[1]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("%v: no tokens found", path)
+	}
+	return ret, nil
+}
+
+// Introspector validates OAuth 2.0 access tokens, such as those issued by
+// an OIDC provider, using the token introspection endpoint (RFC 7662) of
+// the authorization server at URL, which must use HTTPS. Requests are
+// authenticated to the server using ClientID and ClientSecret. If Client
+// is nil scribe.HTTPClient() is used with a timeout of 30 seconds.
+//
+// The name of the identity is the subject of the token, or the user name
+// or client identifier if the server does not return a subject, and the
+// method is oidc.
+type Introspector struct {
+	URL          string
+	ClientID     string
+	ClientSecret string
+	Client       *http.Client
+}
+
+const introspectTimeout = 30 * time.Second
+
+// Validate is a TokenValidator introspecting the token.
+func (i *Introspector) Validate(token string) (Identity, error) {
+	p, err := url.Parse(i.URL)
+	if err != nil {
+		return Identity{}, err
+	}
+	if p.Scheme != "https" {
+		return Identity{}, fmt.Errorf("%v: introspection URL must use https", i.URL)
+	}
+	req, err := http.NewRequest(http.MethodPost, i.URL, strings.NewReader(url.Values{"token": {token}}.Encode()))
+	if err != nil {
+		return Identity{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if i.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(i.ClientID), url.QueryEscape(i.ClientSecret))
+	}
+	client := i.Client
+	if client == nil {
+		client = scribe.HTTPClient(introspectTimeout)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Identity{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Identity{}, fmt.Errorf("introspection: %v", resp.Status)
+	}
+	var v struct {
+		Active   bool   `json:"active"`
+		Subject  string `json:"sub"`
+		Username string `json:"username"`
+		ClientID string `json:"client_id"`
+		Expires  int64  `json:"exp"`
+	}
+	err = json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&v)
+	if err != nil {
+		return Identity{}, fmt.Errorf("introspection: %v", err)
+	}
+	if !v.Active || (v.Expires != 0 && time.Now().Unix() >= v.Expires) {
+		return Identity{}, fmt.Errorf("token is not active")
+	}
+	ret := Identity{Name: v.Subject, Method: "oidc"}
+	if ret.Name == "" {
+		ret.Name = v.Username
+	}
+	if ret.Name == "" {
+		ret.Name = v.ClientID
+	}
+	return ret, nil
+}
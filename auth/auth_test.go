@@ -0,0 +1,129 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package auth_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/mozilla/scribe/auth"
+)
+
+func TestMiddleware(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens")
+	err := ioutil.WriteFile(path, []byte("# health checks\nlb-token loadbalancer\nops-token\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := auth.LoadTokens(path)
+	if err != nil {
+		t.Fatalf("auth.LoadTokens: %v", err)
+	}
+
+	// A custom validator accepting a single token.
+	custom := auth.Validator(func(token string) (auth.Identity, error) {
+		if token != "custom-token" {
+			return auth.Identity{}, fmt.Errorf("unknown token")
+		}
+		return auth.Identity{Name: "custom", Method: "custom"}, nil
+	})
+	h := auth.Middleware(auth.Any(auth.Tokens(tokens), auth.ClientCert("web1"), custom),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id, _ := auth.FromContext(r.Context())
+			json.NewEncoder(w).Encode(id)
+		}))
+
+	web1 := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "web1"}}}}}
+	db1 := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{DNSNames: []string{"db1"}}}}}
+	for _, x := range []struct {
+		token  string
+		state  *tls.ConnectionState
+		code   int
+		expect auth.Identity
+	}{
+		{"lb-token", nil, http.StatusOK, auth.Identity{Name: "loadbalancer", Method: "bearer"}},
+		{"ops-token", nil, http.StatusOK, auth.Identity{Method: "bearer"}},
+		{"custom-token", nil, http.StatusOK, auth.Identity{Name: "custom", Method: "custom"}},
+		{"", web1, http.StatusOK, auth.Identity{Name: "web1", Method: "clientcert"}},
+		{"invalid", web1, http.StatusOK, auth.Identity{Name: "web1", Method: "clientcert"}},
+		{"", db1, http.StatusUnauthorized, auth.Identity{}},
+		{"invalid", nil, http.StatusUnauthorized, auth.Identity{}},
+		{"", nil, http.StatusUnauthorized, auth.Identity{}},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/status", nil)
+		if x.token != "" {
+			r.Header.Set("Authorization", "Bearer "+x.token)
+		}
+		r.TLS = x.state
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != x.code {
+			t.Fatalf("request with token %q returned %v", x.token, w.Code)
+		}
+		if x.code != http.StatusOK {
+			continue
+		}
+		var id auth.Identity
+		err := json.NewDecoder(w.Body).Decode(&id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != x.expect {
+			t.Fatalf("request with token %q has identity %+v", x.token, id)
+		}
+	}
+}
+
+func TestIntrospector(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if id != "scribe" || secret != "secret" {
+			http.Error(w, "invalid client", http.StatusUnauthorized)
+			return
+		}
+		switch r.PostFormValue("token") {
+		case "active":
+			fmt.Fprintf(w, `{"active": true, "sub": "alice", "client_id": "dashboard"}`)
+		case "service":
+			fmt.Fprintf(w, `{"active": true, "client_id": "dashboard"}`)
+		case "expired":
+			fmt.Fprintf(w, `{"active": true, "sub": "alice", "exp": 1}`)
+		default:
+			fmt.Fprintf(w, `{"active": false}`)
+		}
+	}))
+	defer srv.Close()
+
+	i := &auth.Introspector{URL: srv.URL, ClientID: "scribe", ClientSecret: "secret", Client: srv.Client()}
+	for token, expect := range map[string]string{"active": "alice", "service": "dashboard"} {
+		id, err := i.Validate(token)
+		if err != nil {
+			t.Fatalf("Introspector.Validate: %v", err)
+		}
+		if id.Name != expect || id.Method != "oidc" {
+			t.Fatalf("unexpected identity %+v", id)
+		}
+	}
+	for _, x := range []string{"expired", "revoked"} {
+		if _, err := i.Validate(x); err == nil {
+			t.Fatalf("Introspector.Validate should have failed for %v token", x)
+		}
+	}
+	i.ClientSecret = "invalid"
+	if _, err := i.Validate("active"); err == nil {
+		t.Fatalf("Introspector.Validate should have failed with invalid client secret")
+	}
+}
@@ -0,0 +1,174 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// BaselineTest is used to detect drift in the criteria returned by an
+// object, compared to a baseline recorded on a previous run. This allows
+// change detection (for example of the set of SUID files, the installed
+// packages, or the hash of a configuration file) without specifying
+// expected values in the document.
+//
+// Name identifies the entry in the baseline the criteria are recorded
+// under, and would typically be the test identifier.
+//
+// When recording is enabled using RecordBaseline(), the identifier and
+// value of each criteria are recorded and the test is true. When a baseline
+// has been loaded using LoadBaseline(), a criteria is true if the same
+// identifier and value is present in the baseline. Criteria in the baseline
+// that are no longer returned by the object are included in the results as
+// false. The test is only true if no drift was detected. Baseline tests
+// result in an error if no baseline is loaded or being recorded, or if the
+// loaded baseline has no entry for Name.
+type BaselineTest struct {
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+}
+
+// A baseline value, the identifier and test value of a criteria.
+type baselineValue struct {
+	Identifier string `json:"identifier"`
+	Value      string `json:"value"`
+}
+
+// The baseline format written by WriteBaseline().
+type baselineData struct {
+	Hostname string                     `json:"hostname"`
+	Created  time.Time                  `json:"created"`
+	Entries  map[string][]baselineValue `json:"entries"`
+}
+
+type baselineStore struct {
+	recording bool
+	data      baselineData
+}
+
+// RecordBaseline enables or disables recording of a baseline.
+//
+// When enabled, the criteria evaluated by baseline tests during analysis
+// are retained so they can be written using WriteBaseline(). Enabling
+// recording discards any previously loaded or recorded baseline.
+func RecordBaseline(f bool) {
+	if !f {
+		sRuntime.baseline = nil
+		return
+	}
+	b := &baselineStore{recording: true}
+	b.data.Hostname, _ = os.Hostname()
+	b.data.Created = time.Now().UTC()
+	b.data.Entries = make(map[string][]baselineValue)
+	sRuntime.baseline = b
+}
+
+// WriteBaseline writes the baseline recorded since recording was enabled to
+// w.
+func WriteBaseline(w io.Writer) error {
+	b := sRuntime.baseline
+	if b == nil || !b.recording {
+		return fmt.Errorf("baseline recording is not enabled")
+	}
+	buf, err := json.MarshalIndent(b.data, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", buf)
+	return err
+}
+
+// LoadBaseline loads a baseline written by WriteBaseline() from r, and
+// enables comparison of baseline tests against it. Call LoadBaseline with a
+// nil reader to unload the baseline.
+func LoadBaseline(r io.Reader) error {
+	if r == nil {
+		sRuntime.baseline = nil
+		return nil
+	}
+	b := &baselineStore{}
+	err := json.NewDecoder(r).Decode(&b.data)
+	if err != nil {
+		return fmt.Errorf("baseline: %v", err)
+	}
+	if b.data.Entries == nil {
+		b.data.Entries = make(map[string][]baselineValue)
+	}
+	debugPrint("loaded baseline with %v entries, recorded %v on %v\n",
+		len(b.data.Entries), b.data.Created, b.data.Hostname)
+	sRuntime.baseline = b
+	return nil
+}
+
+func (b *BaselineTest) evaluate(c evaluationCriteria) (ret evaluationResult, err error) {
+	res, _, err := b.evaluateSet([]evaluationCriteria{c})
+	if err != nil {
+		return
+	}
+	return res[0], nil
+}
+
+func (b *BaselineTest) evaluateSet(c []evaluationCriteria) ([]evaluationResult, bool, error) {
+	store := sRuntime.baseline
+	if store == nil {
+		return nil, false, fmt.Errorf("no baseline loaded")
+	}
+	ret := make([]evaluationResult, 0, len(c))
+	if store.recording {
+		values := make([]baselineValue, 0, len(c))
+		for _, x := range c {
+			values = append(values, baselineValue{x.identifier, x.testValue})
+			ret = append(ret, evaluationResult{criteria: x, result: true})
+		}
+		sort.Slice(values, func(i, j int) bool {
+			if values[i].Identifier != values[j].Identifier {
+				return values[i].Identifier < values[j].Identifier
+			}
+			return values[i].Value < values[j].Value
+		})
+		store.data.Entries[b.Name] = values
+		debugPrint("evaluateSet(): recorded %v baseline value(s) for %v\n", len(values), b.Name)
+		return ret, true, nil
+	}
+
+	values, ok := store.data.Entries[b.Name]
+	if !ok {
+		return nil, false, fmt.Errorf("baseline has no entry for %v", b.Name)
+	}
+	expected := make(map[baselineValue]bool)
+	for _, x := range values {
+		expected[x] = true
+	}
+	nodrift := true
+	found := make(map[baselineValue]bool)
+	for _, x := range c {
+		v := baselineValue{x.identifier, x.testValue}
+		found[v] = true
+		res := evaluationResult{criteria: x, result: expected[v]}
+		if !res.result {
+			debugPrint("evaluateSet(): baseline %v added %v %v\n", b.Name, v.Identifier, v.Value)
+			nodrift = false
+		}
+		ret = append(ret, res)
+	}
+	for _, x := range values {
+		if found[x] {
+			continue
+		}
+		debugPrint("evaluateSet(): baseline %v removed %v %v\n", b.Name, x.Identifier, x.Value)
+		nodrift = false
+		ret = append(ret, evaluationResult{
+			criteria: evaluationCriteria{identifier: x.Identifier, testValue: x.Value},
+		})
+	}
+	return ret, nodrift, nil
+}
@@ -0,0 +1,185 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/mozilla/scribe"
+)
+
+// Used in TestBaselineDrift, the root path is substituted with a temporary
+// directory.
+var baselinePolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "binaries",
+		"filename": {
+			"path": "%v",
+			"file": "^(.*)$"
+		}
+	},
+
+	{
+		"object": "config",
+		"filecontent": {
+			"path": "%v",
+			"file": "app.conf",
+			"expression": "^version = (\\S+)"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "binaries-drift",
+		"object": "binaries",
+		"baseline": {
+			"name": "binaries"
+		}
+	},
+
+	{
+		"test": "config-drift",
+		"object": "config",
+		"baseline": {
+			"name": "config"
+		}
+	}
+	]
+}
+`
+
+func baselineAnalyze(t *testing.T, docstr string) map[string]scribe.TestResult {
+	doc, err := scribe.LoadDocument(strings.NewReader(docstr))
+	if err != nil {
+		t.Fatalf("scribe.LoadDocument: %v", err)
+	}
+	err = scribe.AnalyzeDocument(doc)
+	if err != nil {
+		t.Fatalf("scribe.AnalyzeDocument: %v", err)
+	}
+	ret := make(map[string]scribe.TestResult)
+	for _, x := range doc.GetTestIdentifiers() {
+		tr, err := scribe.GetResults(&doc, x)
+		if err != nil {
+			t.Fatalf("scribe.GetResults: %v", err)
+		}
+		ret[x] = tr
+	}
+	return ret
+}
+
+func baselineFalseIdentifiers(tr scribe.TestResult) string {
+	ret := make([]string, 0)
+	for _, x := range tr.Results {
+		if !x.Result {
+			ret = append(ret, filepath.Base(x.Identifier))
+		}
+	}
+	sort.Strings(ret)
+	return strings.Join(ret, ",")
+}
+
+func TestBaselineDrift(t *testing.T) {
+	root, err := ioutil.TempDir("", "scribe-baseline")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(root)
+	writeFile := func(name string, content string) {
+		err := ioutil.WriteFile(filepath.Join(root, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatalf("ioutil.WriteFile: %v", err)
+		}
+	}
+	writeFile("app.conf", "version = 1.2\n")
+	writeFile("tool", "")
+	writeFile("helper", "")
+	docstr := fmt.Sprintf(baselinePolicyDoc, root, root)
+
+	scribe.Bootstrap()
+	defer scribe.LoadBaseline(nil)
+
+	// Without a baseline, baseline tests result in an error.
+	res := baselineAnalyze(t, docstr)
+	if !res["config-drift"].IsError {
+		t.Fatalf("baseline test without baseline did not result in error")
+	}
+
+	scribe.RecordBaseline(true)
+	res = baselineAnalyze(t, docstr)
+	for k, v := range res {
+		if v.IsError || !v.MasterResult {
+			t.Fatalf("%v: recording baseline did not result in true", k)
+		}
+	}
+	var buf bytes.Buffer
+	err = scribe.WriteBaseline(&buf)
+	if err != nil {
+		t.Fatalf("scribe.WriteBaseline: %v", err)
+	}
+	saved := buf.String()
+
+	// Compare against the baseline with no changes.
+	err = scribe.LoadBaseline(strings.NewReader(saved))
+	if err != nil {
+		t.Fatalf("scribe.LoadBaseline: %v", err)
+	}
+	res = baselineAnalyze(t, docstr)
+	for k, v := range res {
+		if v.IsError || !v.MasterResult {
+			t.Fatalf("%v: unexpected drift without changes", k)
+		}
+	}
+
+	// Add and remove a file, and change the configuration.
+	writeFile("app.conf", "version = 1.3\n")
+	writeFile("backdoor", "")
+	err = os.Remove(filepath.Join(root, "helper"))
+	if err != nil {
+		t.Fatalf("os.Remove: %v", err)
+	}
+	err = scribe.WriteBaseline(&buf)
+	if err == nil {
+		t.Fatalf("scribe.WriteBaseline should fail when comparing")
+	}
+	res = baselineAnalyze(t, docstr)
+	tr := res["binaries-drift"]
+	if tr.IsError || tr.MasterResult {
+		t.Fatalf("binaries-drift: drift not detected")
+	}
+	if s := baselineFalseIdentifiers(tr); s != "backdoor,helper" {
+		t.Fatalf("binaries-drift: unexpected drifted identifiers %v", s)
+	}
+	tr = res["config-drift"]
+	if tr.IsError || tr.MasterResult {
+		t.Fatalf("config-drift: drift not detected")
+	}
+	if s := baselineFalseIdentifiers(tr); s != "app.conf,app.conf" {
+		t.Fatalf("config-drift: unexpected drifted identifiers %v", s)
+	}
+
+	// A baseline missing an entry for a test results in an error.
+	err = scribe.LoadBaseline(strings.NewReader(`{"entries": {"config": []}}`))
+	if err != nil {
+		t.Fatalf("scribe.LoadBaseline: %v", err)
+	}
+	res = baselineAnalyze(t, docstr)
+	if !res["binaries-drift"].IsError {
+		t.Fatalf("binaries-drift: missing baseline entry did not result in error")
+	}
+}
@@ -0,0 +1,281 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Bootloader is used to perform tests against the kernel command line
+// parameters configured in the boot loader.
+//
+// Loader can be set to grub, systemd-boot or all. GRUB configuration is
+// read from grub.cfg, with variables such as $kernelopts expanded using
+// grubenv. systemd-boot and GRUB boot loader specification entries are read
+// from loader/entries. Paths can optionally be set to a list of glob
+// patterns to override the default configuration file locations.
+//
+// A criteria is returned for each kernel parameter in each boot entry, with
+// the configuration file and entry title as the identifier and the
+// parameter (for example audit=1) as the value. If Parameter is set, only
+// parameters with this name are returned, and the value is the value of the
+// parameter (for example 1).
+type Bootloader struct {
+	Loader    string   `json:"loader,omitempty" yaml:"loader,omitempty"`
+	Parameter string   `json:"parameter,omitempty" yaml:"parameter,omitempty"`
+	Paths     []string `json:"paths,omitempty" yaml:"paths,omitempty"`
+
+	matches []bootMatch
+}
+
+type bootMatch struct {
+	identifier string
+	value      string
+}
+
+type bootEntry struct {
+	identifier string
+	cmdline    string
+}
+
+var grubConfigPaths = []string{
+	"/boot/grub2/grub.cfg",
+	"/boot/grub/grub.cfg",
+	"/boot/efi/EFI/*/grub.cfg",
+	"/boot/grub2/grubenv",
+	"/boot/grub/grubenv",
+	"/boot/efi/EFI/*/grubenv",
+}
+
+var blsConfigPaths = []string{
+	"/boot/loader/entries/*.conf",
+	"/boot/efi/loader/entries/*.conf",
+	"/efi/loader/entries/*.conf",
+}
+
+func (b *Bootloader) isChain() bool {
+	return false
+}
+
+func (b *Bootloader) fireChains(d *Document) ([]evaluationCriteria, error) {
+	return nil, nil
+}
+
+func (b *Bootloader) mergeCriteria(c []evaluationCriteria) {
+}
+
+func (b *Bootloader) validate(d *Document) error {
+	switch b.Loader {
+	case "grub", "systemd-boot", "all":
+	default:
+		return fmt.Errorf("bootloader loader must be grub, systemd-boot or all")
+	}
+	return nil
+}
+
+func (b *Bootloader) expandVariables(v []Variable) {
+	for i := range b.Paths {
+		b.Paths[i] = variableExpansion(v, b.Paths[i])
+	}
+}
+
+func (b *Bootloader) getCriteria() (ret []evaluationCriteria) {
+	for _, x := range b.matches {
+		n := evaluationCriteria{}
+		n.identifier = x.identifier
+		n.testValue = x.value
+		ret = append(ret, n)
+	}
+	return ret
+}
+
+func (b *Bootloader) configPaths() []string {
+	patterns := b.Paths
+	if len(patterns) == 0 {
+		if b.Loader != "systemd-boot" {
+			patterns = append(patterns, grubConfigPaths...)
+		}
+		// GRUB on some distributions also uses boot loader
+		// specification entries.
+		patterns = append(patterns, blsConfigPaths...)
+	}
+	ret := make([]string, 0)
+	for _, x := range patterns {
+		m, err := filepath.Glob(x)
+		if err != nil {
+			continue
+		}
+		ret = append(ret, m...)
+	}
+	return ret
+}
+
+func (b *Bootloader) prepare() error {
+	debugPrint("prepare(): analyzing boot loader configuration, loader \"%v\"\n", b.Loader)
+	var (
+		entries []bootEntry
+		grubenv = make(map[string]string)
+	)
+	paths := b.configPaths()
+	// Read any GRUB environment files first, so variables can be expanded
+	// in the remaining configuration.
+	for _, x := range paths {
+		if filepath.Base(x) == "grubenv" {
+			grubReadEnv(x, grubenv)
+		}
+	}
+	for _, x := range paths {
+		var (
+			e   []bootEntry
+			err error
+		)
+		switch {
+		case filepath.Base(x) == "grubenv":
+			continue
+		case filepath.Ext(x) == ".conf":
+			e, err = blsReadEntry(x)
+		default:
+			e, err = grubReadConfig(x)
+		}
+		if err != nil {
+			debugPrint("prepare(): skipping %v: %v\n", x, err)
+			continue
+		}
+		entries = append(entries, e...)
+	}
+
+	for _, x := range entries {
+		cmdline := grubExpand(x.cmdline, grubenv)
+		for _, y := range strings.Fields(cmdline) {
+			if b.Parameter == "" {
+				b.matches = append(b.matches, bootMatch{x.identifier, y})
+				continue
+			}
+			s := strings.SplitN(y, "=", 2)
+			if s[0] != b.Parameter {
+				continue
+			}
+			if len(s) == 2 {
+				b.matches = append(b.matches, bootMatch{x.identifier, s[1]})
+			} else {
+				b.matches = append(b.matches, bootMatch{x.identifier, y})
+			}
+		}
+	}
+	return nil
+}
+
+func grubReadEnv(path string, env map[string]string) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer fd.Close()
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		ln := scanner.Text()
+		if strings.HasPrefix(ln, "#") {
+			continue
+		}
+		s := strings.SplitN(ln, "=", 2)
+		if len(s) == 2 {
+			env[s[0]] = s[1]
+		}
+	}
+}
+
+// Expand GRUB variable references in s.
+func grubExpand(s string, env map[string]string) string {
+	return os.Expand(s, func(k string) string {
+		return env[k]
+	})
+}
+
+// Return the title of a menu entry, which is the first (possibly quoted)
+// argument to menuentry.
+func grubMenuTitle(ln string) string {
+	ln = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(ln), "menuentry"))
+	if len(ln) > 0 && (ln[0] == '\'' || ln[0] == '"') {
+		if i := strings.IndexByte(ln[1:], ln[0]); i != -1 {
+			return ln[1 : i+1]
+		}
+	}
+	s := strings.Fields(ln)
+	if len(s) == 0 {
+		return ""
+	}
+	return s[0]
+}
+
+func grubReadConfig(path string) ([]bootEntry, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	ret := make([]bootEntry, 0)
+	title := ""
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		s := strings.Fields(scanner.Text())
+		if len(s) == 0 {
+			continue
+		}
+		switch s[0] {
+		case "menuentry":
+			title = grubMenuTitle(scanner.Text())
+		case "linux", "linux16", "linuxefi":
+			if len(s) < 2 {
+				continue
+			}
+			ne := bootEntry{identifier: path + ":" + title}
+			ne.cmdline = strings.Join(s[2:], " ")
+			ret = append(ret, ne)
+		}
+	}
+	return ret, scanner.Err()
+}
+
+// Read a boot loader specification entry, as used by systemd-boot and some
+// GRUB configurations.
+func blsReadEntry(path string) ([]bootEntry, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	var (
+		title   string
+		options []string
+	)
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		s := strings.SplitN(strings.TrimSpace(scanner.Text()), " ", 2)
+		if len(s) != 2 {
+			continue
+		}
+		switch s[0] {
+		case "title":
+			title = strings.TrimSpace(s[1])
+		case "options":
+			options = append(options, strings.TrimSpace(s[1]))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(options) == 0 {
+		return nil, nil
+	}
+	ne := bootEntry{identifier: path + ":" + title, cmdline: strings.Join(options, " ")}
+	return []bootEntry{ne}, nil
+}
@@ -0,0 +1,323 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+// Package builder provides a programmatic interface for constructing scribe
+// documents.
+//
+// Programs that generate policies dynamically (for example from advisory
+// feeds) can use a Builder rather than assembling document structures
+// directly. Objects and tests are added using chained calls, and the
+// document is validated when Build() is called.
+//
+//	doc, err := builder.NewDocument().
+//		AddFileContentObject("sshd-config", "/etc/ssh", "^sshd_config$",
+//			"^PermitRootLogin\\s+(\\S+)").
+//		AddTest("sshd-root-login", "sshd-config",
+//			builder.Description("root login is disabled"),
+//			builder.ExactMatch("no")).
+//		Build()
+package builder
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/mozilla/scribe"
+)
+
+// Builder constructs a scribe document.
+type Builder struct {
+	doc scribe.Document
+}
+
+// TestOption sets optional parameters on a test added with AddTest().
+type TestOption func(*scribe.Test)
+
+// NewDocument returns a new Builder for an empty document.
+func NewDocument() *Builder {
+	return &Builder{}
+}
+
+// AddVariable adds a variable to the document.
+func (b *Builder) AddVariable(key string, value string) *Builder {
+	b.doc.Variables = append(b.doc.Variables, scribe.Variable{Key: key, Value: value})
+	return b
+}
+
+// AddTable adds an external data table loaded from file to the document,
+// which can be referenced by tests using the Lookup option.
+func (b *Builder) AddTable(name string, file string) *Builder {
+	b.doc.Tables = append(b.doc.Tables, scribe.Table{Name: name, File: file})
+	return b
+}
+
+// AddObject adds a fully specified object to the document. The object name
+// is set to name.
+func (b *Builder) AddObject(name string, o scribe.Object) *Builder {
+	o.Object = name
+	b.doc.Objects = append(b.doc.Objects, o)
+	return b
+}
+
+// AddFileContentObject adds an object that returns matches of expression in
+// files with names matching file, located under path.
+func (b *Builder) AddFileContentObject(name string, path string, file string, expression string) *Builder {
+	var o scribe.Object
+	o.FileContent.Path = path
+	o.FileContent.File = file
+	o.FileContent.Expression = expression
+	return b.AddObject(name, o)
+}
+
+// AddFileNameObject adds an object that returns files with names matching
+// file, located under path.
+func (b *Builder) AddFileNameObject(name string, path string, file string) *Builder {
+	var o scribe.Object
+	o.FileName.Path = path
+	o.FileName.File = file
+	return b.AddObject(name, o)
+}
+
+// AddHasLineObject adds an object that returns whether files with names
+// matching file located under path contain a line matching expression.
+func (b *Builder) AddHasLineObject(name string, path string, file string, expression string) *Builder {
+	var o scribe.Object
+	o.HasLine.Path = path
+	o.HasLine.File = file
+	o.HasLine.Expression = expression
+	return b.AddObject(name, o)
+}
+
+// AddPackageObject adds an object that returns the installed versions of
+// package pkg.
+func (b *Builder) AddPackageObject(name string, pkg string) *Builder {
+	var o scribe.Object
+	o.Package.Name = pkg
+	return b.AddObject(name, o)
+}
+
+// AddRawObject adds an object populated with the identifiers and values in
+// values.
+func (b *Builder) AddRawObject(name string, values map[string]string) *Builder {
+	var o scribe.Object
+	for _, k := range sortedKeys(values) {
+		o.Raw.Identifiers = append(o.Raw.Identifiers,
+			scribe.RawIdentifiers{Identifier: k, Value: values[k]})
+	}
+	return b.AddObject(name, o)
+}
+
+// AddTest adds a test with identifier id that references the object named
+// object. Evaluation criteria and other optional test parameters are
+// specified using opts; if no evaluation criteria is specified the test will
+// be true if the object returns any data.
+func (b *Builder) AddTest(id string, object string, opts ...TestOption) *Builder {
+	t := scribe.Test{TestID: id, Object: object}
+	for _, f := range opts {
+		f(&t)
+	}
+	b.doc.Tests = append(b.doc.Tests, t)
+	return b
+}
+
+// Build validates the document and returns it. An error is returned if the
+// document is not valid, including if object or test names are duplicated
+// or a test references an object that does not exist.
+func (b *Builder) Build() (scribe.Document, error) {
+	doc := b.doc
+	objects := make(map[string]bool)
+	for _, x := range doc.Objects {
+		if objects[x.Object] {
+			return doc, fmt.Errorf("duplicate object \"%v\"", x.Object)
+		}
+		objects[x.Object] = true
+	}
+	tests := make(map[string]bool)
+	for _, x := range doc.Tests {
+		if tests[x.TestID] {
+			return doc, fmt.Errorf("duplicate test \"%v\"", x.TestID)
+		}
+		tests[x.TestID] = true
+		if !objects[x.Object] {
+			return doc, fmt.Errorf("%v: unknown object \"%v\"", x.TestID, x.Object)
+		}
+	}
+	err := doc.Validate()
+	if err != nil {
+		return doc, err
+	}
+	return doc, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	ret := make([]string, 0, len(m))
+	for k := range m {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Name sets the name of the test.
+func Name(name string) TestOption {
+	return func(t *scribe.Test) {
+		t.TestName = name
+	}
+}
+
+// Description sets the description of the test.
+func Description(desc string) TestOption {
+	return func(t *scribe.Test) {
+		t.Description = desc
+	}
+}
+
+// Remediation sets the remediation text for the test.
+func Remediation(text string) TestOption {
+	return func(t *scribe.Test) {
+		t.Remediation = text
+	}
+}
+
+// Owner sets the owner of the test, and contact details for the owner.
+func Owner(owner string, contact string) TestOption {
+	return func(t *scribe.Test) {
+		t.Owner = owner
+		t.Contact = contact
+	}
+}
+
+// EVR sets version comparison criteria for the test, op is one of the
+// operations supported by scribe.EVRTest (for example <, or =).
+func EVR(op string, value string) TestOption {
+	return func(t *scribe.Test) {
+		t.EVR = scribe.EVRTest{Operation: op, Value: value}
+	}
+}
+
+// Regexp sets regular expression criteria for the test.
+func Regexp(expr string) TestOption {
+	return func(t *scribe.Test) {
+		t.Regexp = scribe.Regex{Value: expr}
+	}
+}
+
+// ExactMatch sets exact match criteria for the test.
+func ExactMatch(value string) TestOption {
+	return func(t *scribe.Test) {
+		t.EMatch = scribe.ExactMatch{Value: value}
+	}
+}
+
+// Compare sets typed comparison criteria for the test, typ is one of the
+// value types (for example scribe.ValueInt) and op one of the operations
+// supported by scribe.CompareTest.
+func Compare(typ string, op string, value string) TestOption {
+	return func(t *scribe.Test) {
+		t.Compare = scribe.CompareTest{Type: typ, Operation: op, Value: value}
+	}
+}
+
+// Custom sets the test to use the evaluator registered with
+// scribe.RegisterEvaluator() as typ, params being the parameters passed to
+// the evaluator (nil if it has none).
+func Custom(typ string, params interface{}) TestOption {
+	return func(t *scribe.Test) {
+		t.Custom = scribe.CustomTest{Type: typ, Parameters: params}
+	}
+}
+
+// Script sets the test to evaluate criteria using the Starlark script src,
+// which must define a check(criteria) function.
+func Script(src string) TestOption {
+	return func(t *scribe.Test) {
+		t.Script = scribe.ScriptTest{Source: src}
+	}
+}
+
+// CIDR sets IP address range criteria for the test, ranges are in CIDR
+// notation or single addresses.
+func CIDR(ranges ...string) TestOption {
+	return func(t *scribe.Test) {
+		t.CIDR = scribe.CIDRTest{Ranges: ranges}
+	}
+}
+
+// Set sets set comparison criteria for the test, op is one of exact, subset
+// or superset.
+func Set(op string, values ...string) TestOption {
+	return func(t *scribe.Test) {
+		t.Set = scribe.SetTest{Operation: op, Values: values}
+	}
+}
+
+// Allowlist sets file hash allowlist criteria for the test, path is the
+// path to the allowlist file.
+func Allowlist(path string) TestOption {
+	return func(t *scribe.Test) {
+		t.Allowlist = scribe.AllowlistTest{File: path}
+	}
+}
+
+// Baseline sets baseline drift criteria for the test, name identifies the
+// entry in the baseline.
+func Baseline(name string) TestOption {
+	return func(t *scribe.Test) {
+		t.Baseline = scribe.BaselineTest{Name: name}
+	}
+}
+
+// Lookup sets criteria comparing the test value with column of the table
+// named table, which must be added to the document using AddTable(). The
+// comparison is an exact match.
+func Lookup(table string, column string) TestOption {
+	return func(t *scribe.Test) {
+		t.Lookup = scribe.LookupTest{Table: table, Column: column}
+	}
+}
+
+// Absent sets criteria asserting no criteria returned by the object has a
+// value matching expr. If expr is empty, the object must return no criteria
+// at all.
+func Absent(expr string) TestOption {
+	return func(t *scribe.Test) {
+		if expr == "" {
+			t.Absent = scribe.AbsentTest{NoCriteria: true}
+			return
+		}
+		t.Absent = scribe.AbsentTest{Expression: expr}
+	}
+}
+
+// Tag adds a tag to the test.
+func Tag(key string, value string) TestOption {
+	return func(t *scribe.Test) {
+		t.Tags = append(t.Tags, scribe.TestTag{Key: key, Value: value})
+	}
+}
+
+// If adds dependencies on other tests to the test.
+func If(tests ...string) TestOption {
+	return func(t *scribe.Test) {
+		t.If = append(t.If, tests...)
+	}
+}
+
+// ExpectedResult sets the expected result of the test.
+func ExpectedResult(r bool) TestOption {
+	return func(t *scribe.Test) {
+		t.ExpectedResult = r
+	}
+}
+
+// MaxFailures limits the number of false sub-results included in the
+// results of the test.
+func MaxFailures(n int) TestOption {
+	return func(t *scribe.Test) {
+		t.MaxFailures = n
+	}
+}
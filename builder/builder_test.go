@@ -0,0 +1,83 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package builder_test
+
+import (
+	"testing"
+
+	"github.com/mozilla/scribe"
+	"github.com/mozilla/scribe/builder"
+)
+
+func TestBuilder(t *testing.T) {
+	doc, err := builder.NewDocument().
+		AddVariable("root", "../test/filecontent").
+		AddFileContentObject("version", "${root}", "^testfile1$", "^Version = (\\S+)").
+		AddRawObject("raw", map[string]string{"a": "1", "b": "2"}).
+		AddTest("version-check", "version",
+			builder.Description("version is older than 1.0.0"),
+			builder.EVR("<", "1.0.0"),
+			builder.Tag("severity", "low")).
+		AddTest("raw-check", "raw", builder.ExactMatch("2"), builder.If("version-check")).
+		Build()
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if len(doc.Objects) != 2 || len(doc.Tests) != 2 {
+		t.Fatalf("unexpected document contents")
+	}
+	tst, err := doc.GetTest("version-check")
+	if err != nil {
+		t.Fatalf("Document.GetTest: %v", err)
+	}
+	if tst.EVR.Operation != "<" || len(tst.Tags) != 1 {
+		t.Fatalf("test options not applied: %+v", tst)
+	}
+	scribe.Bootstrap()
+	err = scribe.AnalyzeDocument(doc)
+	if err != nil {
+		t.Fatalf("scribe.AnalyzeDocument: %v", err)
+	}
+	tr, err := scribe.GetResults(&doc, "raw-check")
+	if err != nil {
+		t.Fatalf("scribe.GetResults: %v", err)
+	}
+	if !tr.MasterResult {
+		t.Fatalf("raw-check should be true")
+	}
+	tr, err = scribe.GetResults(&doc, "version-check")
+	if err != nil {
+		t.Fatalf("scribe.GetResults: %v", err)
+	}
+	if !tr.MasterResult {
+		t.Fatalf("version-check should be true")
+	}
+}
+
+func TestBuilderInvalid(t *testing.T) {
+	_, err := builder.NewDocument().
+		AddPackageObject("pkg", "openssl").
+		AddTest("t", "nosuchobject").
+		Build()
+	if err == nil {
+		t.Fatalf("test referencing unknown object should fail")
+	}
+	_, err = builder.NewDocument().
+		AddPackageObject("pkg", "openssl").
+		AddPackageObject("pkg", "libbind").
+		Build()
+	if err == nil {
+		t.Fatalf("duplicate objects should fail")
+	}
+	_, err = builder.NewDocument().
+		AddFileNameObject("files", "/etc", "([").
+		Build()
+	if err == nil {
+		t.Fatalf("invalid expression should fail")
+	}
+}
@@ -0,0 +1,153 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"database/sql"
+	"os/exec"
+	"reflect"
+	goruntime "runtime"
+	"sort"
+	"strings"
+)
+
+// Capabilities describes the features supported by this build of the
+// library on the system it is running on, so a control plane can determine
+// if documents are compatible with a deployed agent before dispatching
+// them.
+type Capabilities struct {
+	Version         string       `json:"version" yaml:"version"`
+	Platform        string       `json:"platform" yaml:"platform"` // The operating system and architecture, such as linux/amd64.
+	Sources         []Capability `json:"sources" yaml:"sources"`
+	Evaluators      []Capability `json:"evaluators" yaml:"evaluators"`
+	PackageBackends []Capability `json:"packagebackends" yaml:"packagebackends"`
+	DatabaseDrivers []string     `json:"databasedrivers" yaml:"databasedrivers"` // The drivers registered with database/sql.
+	SecretProviders []string     `json:"secretproviders" yaml:"secretproviders"`
+	Secrets         []string     `json:"secrets" yaml:"secrets"` // The names of the secrets set with SetSecrets().
+}
+
+// Capability describes a single feature, such as a source type, using the
+// name of the feature in documents.
+//
+// Supported is true if the feature can be used on this system. Features
+// limited to certain platforms list them in Platforms. Package backends are
+// supported if the package manager command is present.
+type Capability struct {
+	Name      string   `json:"name" yaml:"name"`
+	Supported bool     `json:"supported" yaml:"supported"`
+	Platforms []string `json:"platforms,omitempty" yaml:"platforms,omitempty"`
+}
+
+// Sources that only return criteria on some platforms; on other platforms
+// the source can be used in a document but never returns criteria.
+var sourcePlatforms = map[string][]string{
+	"bootloader": {"linux"},
+	"encryption": {"linux"},
+	"firmware":   {"linux"},
+	"fileattr":   {"linux"},
+	"journal":    {"linux"},
+	"repository": {"linux"},
+	"restart":    {"linux"},
+	"sharedlib":  {"linux"},
+	"winevent":   {"windows"},
+	"winservice": {"windows"},
+	"wintask":    {"windows"},
+}
+
+// The package managers queried for the package inventory, and the command
+// each requires.
+var packageBackends = []struct {
+	name    string
+	command string
+}{
+	{"rpm", "rpm"},
+	{"dpkg", "dpkg"},
+	{"pkgutil", "pkgutil"},
+	{"brew", "brew"},
+}
+
+// GetCapabilities returns the features supported by this build of the
+// library on the system it is running on.
+func GetCapabilities() Capabilities {
+	ret := Capabilities{
+		Version:         Version,
+		Platform:        goruntime.GOOS + "/" + goruntime.GOARCH,
+		Sources:         make([]Capability, 0),
+		Evaluators:      make([]Capability, 0),
+		PackageBackends: make([]Capability, 0),
+		DatabaseDrivers: sql.Drivers(),
+	}
+	for _, x := range interfaceFields(reflect.TypeOf(Object{}), reflect.TypeOf((*genericSource)(nil)).Elem()) {
+		c := Capability{Name: x, Supported: true, Platforms: sourcePlatforms[x]}
+		if len(c.Platforms) != 0 {
+			c.Supported = false
+			for _, y := range c.Platforms {
+				if y == goruntime.GOOS {
+					c.Supported = true
+				}
+			}
+		}
+		ret.Sources = append(ret.Sources, c)
+	}
+	for _, x := range interfaceFields(reflect.TypeOf(Test{}), reflect.TypeOf((*genericEvaluator)(nil)).Elem(),
+		reflect.TypeOf((*setEvaluator)(nil)).Elem()) {
+		ret.Evaluators = append(ret.Evaluators, Capability{Name: x, Supported: true})
+	}
+	// Registered evaluators are listed using the name tests reference
+	// them by, as custom:name.
+	for _, x := range customEvaluators() {
+		ret.Evaluators = append(ret.Evaluators, Capability{Name: "custom:" + x, Supported: true})
+	}
+	for _, x := range packageBackends {
+		_, err := exec.LookPath(x.command)
+		ret.PackageBackends = append(ret.PackageBackends, Capability{Name: x.name, Supported: err == nil})
+	}
+	providers := make(map[string]bool)
+	for k := range builtinSecretProviders {
+		providers[k] = true
+	}
+	sRuntime.secretLock.Lock()
+	for k := range sRuntime.secretProviders {
+		providers[k] = true
+	}
+	sRuntime.secretLock.Unlock()
+	for k := range providers {
+		ret.SecretProviders = append(ret.SecretProviders, k)
+	}
+	sort.Strings(ret.SecretProviders)
+	ret.Secrets = secretNames()
+	return ret
+}
+
+// Return the JSON names of the fields of struct type t where a pointer to
+// the field implements one of ifaces, sorted by name.
+func interfaceFields(t reflect.Type, ifaces ...reflect.Type) []string {
+	ret := make([]string, 0)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Type.Kind() != reflect.Struct {
+			continue
+		}
+		found := false
+		for _, x := range ifaces {
+			if reflect.PtrTo(f.Type).Implements(x) {
+				found = true
+			}
+		}
+		if !found {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
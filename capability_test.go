@@ -0,0 +1,61 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/mozilla/scribe"
+)
+
+func findCapability(c []scribe.Capability, name string) (scribe.Capability, bool) {
+	for _, x := range c {
+		if x.Name == name {
+			return x, true
+		}
+	}
+	return scribe.Capability{}, false
+}
+
+func TestGetCapabilities(t *testing.T) {
+	caps := scribe.GetCapabilities()
+	if caps.Version != scribe.Version || caps.Platform != runtime.GOOS+"/"+runtime.GOARCH {
+		t.Fatalf("unexpected version or platform %v %v", caps.Version, caps.Platform)
+	}
+	for _, x := range []string{"filecontent", "package", "ldap", "xml"} {
+		c, ok := findCapability(caps.Sources, x)
+		if !ok || !c.Supported {
+			t.Fatalf("source %v should be supported", x)
+		}
+	}
+	c, ok := findCapability(caps.Sources, "winservice")
+	if !ok || c.Supported != (runtime.GOOS == "windows") {
+		t.Fatalf("unexpected winservice capability %+v", c)
+	}
+	seen := make(map[string]bool)
+	for _, x := range caps.Evaluators {
+		if seen[x.Name] {
+			t.Fatalf("evaluator %v listed twice", x.Name)
+		}
+		seen[x.Name] = true
+	}
+	for _, x := range []string{"exactmatch", "regexp", "evr", "set", "absent"} {
+		if !seen[x] {
+			t.Fatalf("evaluator %v not listed", x)
+		}
+	}
+	if _, ok := findCapability(caps.PackageBackends, "rpm"); !ok {
+		t.Fatalf("package backend rpm not listed")
+	}
+	providers := strings.Join(caps.SecretProviders, ",")
+	if !strings.Contains(providers, "env,exec,file") {
+		t.Fatalf("unexpected secret providers %v", caps.SecretProviders)
+	}
+}
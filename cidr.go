@@ -0,0 +1,100 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// CIDRTest is used to test if criteria are IP addresses within a set of
+// network ranges. Each entry in Ranges is a range in CIDR notation (for
+// example 10.0.0.0/8 or fd00::/8) or a single address.
+//
+// The test value can be an address, an address with a port as reported for
+// listening sockets (10.0.0.1:22 or [::1]:22), or an address with a prefix
+// length as reported for interfaces (10.0.0.1/24). If the test value is not
+// an IP address the result is false.
+//
+// If Outside is true, the result is true for addresses that are not within
+// any of the ranges. As a test is true if any criteria is true, this can be
+// combined with an expected result of false to assert all addresses are
+// within the approved ranges.
+type CIDRTest struct {
+	Ranges  []string `json:"ranges,omitempty" yaml:"ranges,omitempty"`
+	Outside bool     `json:"outside,omitempty" yaml:"outside,omitempty"`
+
+	nets []*net.IPNet
+}
+
+func (c *CIDRTest) compile() error {
+	if c.nets != nil {
+		return nil
+	}
+	nets := make([]*net.IPNet, 0)
+	for _, x := range c.Ranges {
+		if !strings.Contains(x, "/") {
+			ip := net.ParseIP(x)
+			if ip == nil {
+				return fmt.Errorf("invalid address %q in cidr ranges", x)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(x)
+		if err != nil {
+			return fmt.Errorf("invalid range %q in cidr ranges", x)
+		}
+		nets = append(nets, n)
+	}
+	c.nets = nets
+	return nil
+}
+
+// Extract the IP address from a test value.
+func cidrAddress(s string) net.IP {
+	s = strings.TrimSpace(s)
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	if i := strings.Index(s, "/"); i != -1 {
+		s = s[:i]
+	}
+	if i := strings.Index(s, "%"); i != -1 {
+		s = s[:i]
+	}
+	return net.ParseIP(strings.Trim(s, "[]"))
+}
+
+func (c *CIDRTest) evaluate(cr evaluationCriteria) (ret evaluationResult, err error) {
+	debugPrint("evaluate(): cidr %v \"%v\", %v\n", cr.identifier, cr.testValue, c.Ranges)
+	err = c.compile()
+	if err != nil {
+		return
+	}
+	ret.criteria = cr
+	ip := cidrAddress(cr.testValue)
+	if ip == nil {
+		return
+	}
+	found := false
+	for _, x := range c.nets {
+		if x.Contains(ip) {
+			found = true
+			break
+		}
+	}
+	ret.result = found != c.Outside
+	return
+}
@@ -0,0 +1,110 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mozilla/scribe"
+)
+
+// Used in TestCIDRPolicy
+var cidrPolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "listeners",
+		"raw": {
+			"identifiers": [
+			{ "identifier": "sshd", "value": "10.1.2.3:22" },
+			{ "identifier": "nginx", "value": "[2001:db8::10]:443" },
+			{ "identifier": "exporter", "value": "127.0.0.1:9100" }
+			]
+		}
+	},
+
+	{
+		"object": "wildcard",
+		"raw": {
+			"identifiers": [
+			{ "identifier": "redis", "value": "0.0.0.0:6379" },
+			{ "identifier": "eth0", "value": "192.168.1.10/24" },
+			{ "identifier": "invalid", "value": "localhost" }
+			]
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "cidr0",
+		"expectedresult": false,
+		"object": "listeners",
+		"cidr": {
+			"ranges": [ "10.0.0.0/8", "2001:db8::/32", "127.0.0.1" ],
+			"outside": true
+		}
+	},
+
+	{
+		"test": "cidr1",
+		"expectedresult": true,
+		"object": "wildcard",
+		"cidr": {
+			"ranges": [ "10.0.0.0/8", "127.0.0.0/8" ],
+			"outside": true
+		}
+	},
+
+	{
+		"test": "cidr2",
+		"expectedresult": true,
+		"object": "wildcard",
+		"cidr": {
+			"ranges": [ "192.168.0.0/16" ]
+		}
+	},
+
+	{
+		"test": "cidr3",
+		"expectedresult": false,
+		"object": "listeners",
+		"cidr": {
+			"ranges": [ "172.16.0.0/12" ]
+		}
+	}
+	]
+}
+`
+
+func TestCIDRPolicy(t *testing.T) {
+	doc := genericTestExec(t, cidrPolicyDoc)
+	tr, err := scribe.GetResults(doc, "cidr1")
+	if err != nil {
+		t.Fatalf("scribe.GetResults: %v", err)
+	}
+	for _, x := range tr.Results {
+		want := x.Identifier == "redis" || x.Identifier == "eth0"
+		if x.Result != want {
+			t.Fatalf("unexpected cidr result for %v: %v", x.Identifier, x.Result)
+		}
+	}
+}
+
+func TestCIDRInvalidRange(t *testing.T) {
+	docstr := `{"objects": [{"object": "o", "raw": {"identifiers": [{"identifier": "a", "value": "10.0.0.1"}]}}],
+		"tests": [{"test": "t", "object": "o", "cidr": {"ranges": ["10.0.0.0/33"]}}]}`
+	doc, err := scribe.LoadDocument(strings.NewReader(docstr))
+	if err == nil {
+		err = doc.Validate()
+	}
+	if err == nil {
+		t.Fatalf("document with invalid cidr range should not validate")
+	}
+}
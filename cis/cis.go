@@ -0,0 +1,185 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+// Package cis generates the objects and tests for common CIS benchmark style
+// checks from concise declarations.
+//
+// Each check adds an object and a test to a document being constructed with
+// the builder package. The expected result of each test is set to the result
+// of a compliant system, so non-compliant systems can be identified by
+// comparing the master result of a test to the expected result (for example
+// using the exit policy of scribecmd). Additional test options such as
+// descriptions and tags can be passed to each check.
+//
+//	b := builder.NewDocument()
+//	cis.Add(b,
+//		cis.PasswordMaxDays("5.4.1.1", 365, builder.Tag("level", "1")),
+//		cis.FileMode("6.1.2", "/etc/passwd", 0644),
+//		cis.ServiceDisabled("2.2.2", "avahi-daemon"))
+//	doc, err := b.Build()
+package cis
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/mozilla/scribe"
+	"github.com/mozilla/scribe/builder"
+)
+
+const (
+	loginDefsPath = "/etc/login.defs"
+	systemdPath   = "/etc/systemd/system"
+)
+
+// Check is a single check that can be added to a document.
+type Check struct {
+	id     string
+	object scribe.Object
+	opts   []builder.TestOption
+}
+
+// Add adds the objects and tests for checks to b.
+func Add(b *builder.Builder, checks ...Check) *builder.Builder {
+	for _, x := range checks {
+		name := x.id + "-source"
+		b.AddObject(name, x.object).AddTest(x.id, name, x.opts...)
+	}
+	return b
+}
+
+// Return an expression matching exactly the file at path.
+func pathExpression(path string) string {
+	return "^" + regexp.QuoteMeta(filepath.Clean(path)) + "$"
+}
+
+// Return a file stat object for the file at path.
+func fileStatObject(path string, property string) scribe.Object {
+	var o scribe.Object
+	o.FileStat.Path = filepath.Dir(path)
+	o.FileStat.File = pathExpression(path)
+	o.FileStat.PathMatch = true
+	o.FileStat.Property = property
+	return o
+}
+
+func loginDefsCheck(id string, param string, op string, value int, opts []builder.TestOption) Check {
+	var o scribe.Object
+	o.FileContent.Path = filepath.Dir(loginDefsPath)
+	o.FileContent.File = pathExpression(loginDefsPath)
+	o.FileContent.PathMatch = true
+	o.FileContent.Expression = fmt.Sprintf("^\\s*%v\\s+(\\d+)", param)
+	return Check{
+		id:     id,
+		object: o,
+		opts: append([]builder.TestOption{
+			builder.EVR(op, strconv.Itoa(value)),
+			builder.ExpectedResult(true),
+		}, opts...),
+	}
+}
+
+// PasswordMaxDays checks PASS_MAX_DAYS in login.defs is no greater than max.
+func PasswordMaxDays(id string, max int, opts ...builder.TestOption) Check {
+	return loginDefsCheck(id, "PASS_MAX_DAYS", "<", max+1, opts)
+}
+
+// PasswordMinDays checks PASS_MIN_DAYS in login.defs is at least min.
+func PasswordMinDays(id string, min int, opts ...builder.TestOption) Check {
+	return loginDefsCheck(id, "PASS_MIN_DAYS", ">", min-1, opts)
+}
+
+// PasswordWarnAge checks PASS_WARN_AGE in login.defs is at least min.
+func PasswordWarnAge(id string, min int, opts ...builder.TestOption) Check {
+	return loginDefsCheck(id, "PASS_WARN_AGE", ">", min-1, opts)
+}
+
+// FileMode checks the file at path grants no permissions beyond those in max,
+// for example a max of 0644 is satisfied by 0600 or 0644 but not by 0664.
+func FileMode(id string, path string, max os.FileMode, opts ...builder.TestOption) Check {
+	return Check{
+		id:     id,
+		object: fileStatObject(path, "mode"),
+		opts: append([]builder.TestOption{
+			builder.Regexp(modeExpression(max)),
+			builder.ExpectedResult(true),
+		}, opts...),
+	}
+}
+
+// Return an expression matching four digit octal modes that do not set any
+// bits not set in max.
+func modeExpression(max os.FileMode) string {
+	v := uint32(max.Perm())
+	if max&os.ModeSetuid != 0 {
+		v |= 04000
+	}
+	if max&os.ModeSetgid != 0 {
+		v |= 02000
+	}
+	if max&os.ModeSticky != 0 {
+		v |= 01000
+	}
+	ret := "^"
+	for shift := uint(9); ; shift -= 3 {
+		allowed := (v >> shift) & 07
+		ret += "["
+		for d := uint32(0); d < 8; d++ {
+			if d&^allowed == 0 {
+				ret += strconv.Itoa(int(d))
+			}
+		}
+		ret += "]"
+		if shift == 0 {
+			break
+		}
+	}
+	return ret + "$"
+}
+
+// FileOwner checks the file at path is owned by the user owner.
+func FileOwner(id string, path string, owner string, opts ...builder.TestOption) Check {
+	return Check{
+		id:     id,
+		object: fileStatObject(path, "owner"),
+		opts: append([]builder.TestOption{
+			builder.ExactMatch(owner),
+			builder.ExpectedResult(true),
+		}, opts...),
+	}
+}
+
+// FileGroup checks the file at path is owned by the group group.
+func FileGroup(id string, path string, group string, opts ...builder.TestOption) Check {
+	return Check{
+		id:     id,
+		object: fileStatObject(path, "group"),
+		opts: append([]builder.TestOption{
+			builder.ExactMatch(group),
+			builder.ExpectedResult(true),
+		}, opts...),
+	}
+}
+
+// ServiceDisabled checks the systemd service is not enabled for any target.
+// The test is true if the service is enabled, so the expected result of the
+// test is false.
+func ServiceDisabled(id string, service string, opts ...builder.TestOption) Check {
+	var o scribe.Object
+	o.FileName.Path = systemdPath
+	o.FileName.File = fmt.Sprintf("^%v/[^/]+\\.wants/(%v)\\.service$",
+		regexp.QuoteMeta(systemdPath), regexp.QuoteMeta(service))
+	o.FileName.PathMatch = true
+	return Check{
+		id:     id,
+		object: o,
+		opts:   append([]builder.TestOption{builder.ExpectedResult(false)}, opts...),
+	}
+}
@@ -0,0 +1,83 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package cis_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"testing"
+
+	"github.com/mozilla/scribe"
+	"github.com/mozilla/scribe/builder"
+	"github.com/mozilla/scribe/cis"
+)
+
+func TestChecks(t *testing.T) {
+	root, err := ioutil.TempDir("", "scribe-cis")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(root)
+	path := filepath.Join(root, "shadow")
+	err = ioutil.WriteFile(path, []byte("root:*:1:0:99999:7:::\n"), 0600)
+	if err != nil {
+		t.Fatalf("ioutil.WriteFile: %v", err)
+	}
+	err = os.Chmod(path, 0640)
+	if err != nil {
+		t.Fatalf("os.Chmod: %v", err)
+	}
+	u, err := user.Current()
+	if err != nil {
+		t.Fatalf("user.Current: %v", err)
+	}
+
+	b := builder.NewDocument()
+	cis.Add(b,
+		cis.FileMode("mode-ok", path, 0644, builder.Tag("level", "1")),
+		cis.FileMode("mode-strict", path, 0600),
+		cis.FileOwner("owner", path, u.Username),
+		cis.PasswordMaxDays("max-days", 365),
+		cis.ServiceDisabled("avahi", "avahi-daemon"))
+	doc, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if len(doc.Objects) != 5 || len(doc.Tests) != 5 {
+		t.Fatalf("unexpected document contents")
+	}
+	tst, err := doc.GetTest("max-days")
+	if err != nil {
+		t.Fatalf("Document.GetTest: %v", err)
+	}
+	if tst.EVR.Operation != "<" || tst.EVR.Value != "366" || !tst.ExpectedResult {
+		t.Fatalf("unexpected password max days test: %+v", tst.EVR)
+	}
+
+	scribe.Bootstrap()
+	err = scribe.AnalyzeDocument(doc)
+	if err != nil {
+		t.Fatalf("scribe.AnalyzeDocument: %v", err)
+	}
+	expect := map[string]bool{
+		"mode-ok":     true,
+		"mode-strict": false,
+		"owner":       true,
+	}
+	for k, v := range expect {
+		tr, err := scribe.GetResults(&doc, k)
+		if err != nil {
+			t.Fatalf("scribe.GetResults: %v", err)
+		}
+		if tr.IsError || tr.MasterResult != v {
+			t.Fatalf("unexpected result for %v: %v", k, tr.String())
+		}
+	}
+}
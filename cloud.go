@@ -0,0 +1,326 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Cloud is used to perform tests against information returned by
+// the metadata service of the cloud provider the system is running in.
+// Supported providers are aws, gcp and azure; by default the provider is
+// detected automatically but it can be set using Provider.
+//
+// Field specifies which value is returned as the test value, and can be one
+// of:
+//
+// provider: the detected provider, or "none" if the system does not appear
+// to be running in a supported cloud environment
+//
+// instanceid: the instance identifier
+//
+// imdsv2: on aws, "true" if the metadata service requires session tokens
+//
+// instanceprofile: the instance profile (aws) or service account (gcp)
+// associated with the instance
+//
+// tag: the value of the instance tag (aws, azure) or attribute (gcp) named
+// by Tag
+//
+// The identifier for the criteria is the provider name. If the metadata
+// service is not available, no criteria are returned for fields other than
+// provider.
+type Cloud struct {
+	Field    string `json:"field,omitempty" yaml:"field,omitempty"`
+	Tag      string `json:"tag,omitempty" yaml:"tag,omitempty"`
+	Provider string `json:"provider,omitempty" yaml:"provider,omitempty"`
+
+	matches []cloudMatch
+}
+
+type cloudMatch struct {
+	provider string
+	value    string
+}
+
+// Requests to metadata services are subject to a strict timeout, so systems
+// that are not running in a cloud environment are not delayed.
+const cloudTimeout = 2 * time.Second
+
+const (
+	awsMetadataBase   = "http://169.254.169.254/latest"
+	gcpMetadataBase   = "http://metadata.google.internal/computeMetadata/v1"
+	azureMetadataBase = "http://169.254.169.254/metadata"
+)
+
+func (c *Cloud) isChain() bool {
+	return false
+}
+
+func (c *Cloud) fireChains(d *Document) ([]evaluationCriteria, error) {
+	return nil, nil
+}
+
+func (c *Cloud) mergeCriteria(cr []evaluationCriteria) {
+}
+
+func (c *Cloud) validate(d *Document) error {
+	switch c.Field {
+	case "provider", "instanceid", "imdsv2", "instanceprofile":
+	case "tag":
+		if len(c.Tag) == 0 {
+			return fmt.Errorf("cloud tag must be set for tag field")
+		}
+	default:
+		return fmt.Errorf("cloud field %v is not supported", c.Field)
+	}
+	switch c.Provider {
+	case "", "aws", "gcp", "azure":
+	default:
+		return fmt.Errorf("cloud provider must be aws, gcp or azure")
+	}
+	return nil
+}
+
+func (c *Cloud) expandVariables(v []Variable) {
+	c.Tag = variableExpansion(v, c.Tag)
+}
+
+func (c *Cloud) getCriteria() (ret []evaluationCriteria) {
+	for _, x := range c.matches {
+		n := evaluationCriteria{}
+		n.identifier = x.provider
+		n.testValue = x.value
+		ret = append(ret, n)
+	}
+	return ret
+}
+
+func (c *Cloud) prepare() error {
+	debugPrint("prepare(): querying cloud metadata, field \"%v\"\n", c.Field)
+	provider := c.Provider
+	if provider == "" {
+		provider = cloudDetect()
+	}
+	if provider == "none" {
+		if c.Field == "provider" {
+			c.matches = append(c.matches, cloudMatch{provider, provider})
+		}
+		return nil
+	}
+	if c.Field == "provider" {
+		c.matches = append(c.matches, cloudMatch{provider, provider})
+		return nil
+	}
+	v, err := cloudQuery(provider, c.Field, c.Tag)
+	if err != nil {
+		return err
+	}
+	debugPrint("prepare(): %v %v: %v\n", provider, c.Field, v)
+	c.matches = append(c.matches, cloudMatch{provider, v})
+	return nil
+}
+
+func cloudRequest(method string, url string, hdrs map[string]string) (int, string, error) {
+	client := &http.Client{Timeout: cloudTimeout}
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return 0, "", err
+	}
+	for k, v := range hdrs {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	buf, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, "", err
+	}
+	return resp.StatusCode, strings.TrimSpace(string(buf)), nil
+}
+
+func awsToken() (string, error) {
+	code, tok, err := cloudRequest("PUT", awsMetadataBase+"/api/token",
+		map[string]string{"X-aws-ec2-metadata-token-ttl-seconds": "60"})
+	if err != nil {
+		return "", err
+	}
+	if code != http.StatusOK {
+		return "", fmt.Errorf("aws metadata token request returned %v", code)
+	}
+	return tok, nil
+}
+
+// Detect the cloud provider the system is running in, returns "none" if no
+// metadata service responds.
+func cloudDetect() string {
+	if sRuntime.testHooks {
+		return "aws"
+	}
+	if _, err := awsToken(); err == nil {
+		return "aws"
+	}
+	code, _, err := cloudRequest("GET", gcpMetadataBase+"/instance/id",
+		map[string]string{"Metadata-Flavor": "Google"})
+	if err == nil && code == http.StatusOK {
+		return "gcp"
+	}
+	code, _, err = cloudRequest("GET", azureMetadataBase+"/instance?api-version=2021-02-01",
+		map[string]string{"Metadata": "true"})
+	if err == nil && code == http.StatusOK {
+		return "azure"
+	}
+	return "none"
+}
+
+func cloudQuery(provider string, field string, tag string) (string, error) {
+	if sRuntime.testHooks {
+		return testCloudQuery(field, tag)
+	}
+	switch provider {
+	case "aws":
+		return awsQuery(field, tag)
+	case "gcp":
+		return gcpQuery(field, tag)
+	case "azure":
+		return azureQuery(field, tag)
+	}
+	return "", fmt.Errorf("unsupported cloud provider %v", provider)
+}
+
+func awsQuery(field string, tag string) (string, error) {
+	if field == "imdsv2" {
+		// If a request without a session token is rejected, the
+		// instance requires IMDSv2.
+		code, _, err := cloudRequest("GET", awsMetadataBase+"/meta-data/instance-id", nil)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%v", code == http.StatusUnauthorized), nil
+	}
+	tok, err := awsToken()
+	if err != nil {
+		return "", err
+	}
+	var path string
+	switch field {
+	case "instanceid":
+		path = "/meta-data/instance-id"
+	case "instanceprofile":
+		path = "/meta-data/iam/info"
+	case "tag":
+		path = "/meta-data/tags/instance/" + tag
+	}
+	code, buf, err := cloudRequest("GET", awsMetadataBase+path,
+		map[string]string{"X-aws-ec2-metadata-token": tok})
+	if err != nil {
+		return "", err
+	}
+	if code == http.StatusNotFound && field != "instanceid" {
+		return "", nil
+	}
+	if code != http.StatusOK {
+		return "", fmt.Errorf("aws metadata request for %v returned %v", path, code)
+	}
+	if field == "instanceprofile" {
+		var info struct {
+			InstanceProfileArn string
+		}
+		err = json.Unmarshal([]byte(buf), &info)
+		if err != nil {
+			return "", err
+		}
+		return info.InstanceProfileArn, nil
+	}
+	return buf, nil
+}
+
+func gcpQuery(field string, tag string) (string, error) {
+	var path string
+	switch field {
+	case "instanceid":
+		path = "/instance/id"
+	case "instanceprofile":
+		path = "/instance/service-accounts/default/email"
+	case "tag":
+		path = "/instance/attributes/" + tag
+	case "imdsv2":
+		return "", fmt.Errorf("imdsv2 is not applicable to gcp")
+	}
+	code, buf, err := cloudRequest("GET", gcpMetadataBase+path,
+		map[string]string{"Metadata-Flavor": "Google"})
+	if err != nil {
+		return "", err
+	}
+	if code == http.StatusNotFound && field != "instanceid" {
+		return "", nil
+	}
+	if code != http.StatusOK {
+		return "", fmt.Errorf("gcp metadata request for %v returned %v", path, code)
+	}
+	return buf, nil
+}
+
+func azureQuery(field string, tag string) (string, error) {
+	if field == "imdsv2" || field == "instanceprofile" {
+		return "", fmt.Errorf("%v is not applicable to azure", field)
+	}
+	code, buf, err := cloudRequest("GET", azureMetadataBase+"/instance/compute?api-version=2021-02-01",
+		map[string]string{"Metadata": "true"})
+	if err != nil {
+		return "", err
+	}
+	if code != http.StatusOK {
+		return "", fmt.Errorf("azure metadata request returned %v", code)
+	}
+	var compute struct {
+		VMID     string `json:"vmId"`
+		TagsList []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"tagsList"`
+	}
+	err = json.Unmarshal([]byte(buf), &compute)
+	if err != nil {
+		return "", err
+	}
+	if field == "instanceid" {
+		return compute.VMID, nil
+	}
+	for _, x := range compute.TagsList {
+		if x.Name == tag {
+			return x.Value, nil
+		}
+	}
+	return "", nil
+}
+
+// Functions and data related to cloud metadata tests
+
+var testCloudTable = map[string]string{
+	"instanceid":      "i-0123456789abcdef0",
+	"imdsv2":          "true",
+	"instanceprofile": "arn:aws:iam::123456789012:instance-profile/web",
+	"tag:environment": "production",
+}
+
+func testCloudQuery(field string, tag string) (string, error) {
+	key := field
+	if field == "tag" {
+		key = "tag:" + tag
+	}
+	return testCloudTable[key], nil
+}
@@ -0,0 +1,358 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+// Package collector receives the results of scribe runs from many hosts
+// and answers queries over them, giving fleet visibility without a
+// separate results backend.
+//
+// Agents submit the results of each run to a Server over HTTP using a
+// Client, or the collector output sink, authenticating with a bearer
+// token or a client certificate. The server keeps the submissions in a Store and serves the
+// following endpoints as JSON, authenticated with a query token:
+//
+// /api/v1/hosts: each host, when it last submitted results, and the
+// outcome counts of the latest run of each document
+//
+// /api/v1/results: the results of the latest run of each document on each
+// host, filtered by the host, document, test and outcome query parameters
+//
+// /api/v1/summary: for each test, the hosts with each outcome in their
+// latest run, filtered by the document query parameter
+//
+// /api/v1/history: the outcome counts of each run over time, filtered by
+// the host and document query parameters
+//
+// Outcomes are true, false, error, waived and notapplicable, as used in
+// reports.
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mozilla/scribe"
+	"github.com/mozilla/scribe/auth"
+)
+
+// Submission is the results of a run of a document on a host.
+type Submission struct {
+	Host     string              `json:"host"`
+	Document string              `json:"document"`
+	Time     time.Time           `json:"time"`               // When the run started.
+	Received time.Time           `json:"received,omitempty"` // Set by the server.
+	Results  []scribe.TestResult `json:"results"`
+}
+
+// DocumentSummary describes a run of a document on a host.
+type DocumentSummary struct {
+	Host     string         `json:"host"`
+	Document string         `json:"document"`
+	Time     time.Time      `json:"time"`
+	Counts   map[string]int `json:"counts"` // Number of tests with each outcome.
+}
+
+// HostStatus describes the latest runs on a host.
+type HostStatus struct {
+	Host      string            `json:"host"`
+	LastSeen  time.Time         `json:"lastseen"` // When results were last received.
+	Documents []DocumentSummary `json:"documents"`
+}
+
+// ResultRecord is a test result with the run it is from.
+type ResultRecord struct {
+	Host     string            `json:"host"`
+	Document string            `json:"document"`
+	Time     time.Time         `json:"time"`
+	Outcome  string            `json:"outcome"`
+	Result   scribe.TestResult `json:"result"`
+}
+
+// TestSummary describes the outcomes of a test across hosts.
+type TestSummary struct {
+	TestID string              `json:"testid"`
+	Name   string              `json:"name,omitempty"`
+	Counts map[string]int      `json:"counts"`
+	Hosts  map[string][]string `json:"hosts"` // The hosts with each outcome.
+}
+
+// The default maximum size of a submission.
+const defaultMaxSubmission = 32 << 20
+
+// Server is a collector. AgentTokens maps the bearer tokens agents submit
+// results with to the host each may submit results for, or * for any
+// host, and QueryTokens are the bearer tokens accepted for queries.
+//
+// If AgentAuth is set it authenticates submissions instead of AgentTokens,
+// for example to accept client certificates or OIDC access tokens, and
+// AgentHost returns the host an authenticated identity may submit results
+// for, * for any host, or an empty string if the identity may not submit
+// results. If AgentHost is nil the name of the identity is the host, and
+// only identities authenticated with a bearer token may be named *. If
+// QueryAuth is set it authenticates queries instead of QueryTokens.
+//
+// If MaxSubmission is 0 submissions are limited to 32 MiB.
+type Server struct {
+	Store         *Store
+	AgentTokens   map[string]string
+	AgentAuth     auth.Authenticator
+	AgentHost     func(id auth.Identity) string
+	QueryTokens   []string
+	QueryAuth     auth.Authenticator
+	MaxSubmission int64
+}
+
+// Return the outcome of a test result.
+func outcome(r scribe.TestResult) string {
+	if r.Waived {
+		return "waived"
+	}
+	if r.NotApplicable {
+		return "notapplicable"
+	}
+	if r.IsError {
+		return "error"
+	}
+	if r.MasterResult {
+		return "true"
+	}
+	return "false"
+}
+
+func summarize(sub Submission) DocumentSummary {
+	ret := DocumentSummary{Host: sub.Host, Document: sub.Document, Time: sub.Time, Counts: make(map[string]int)}
+	for _, x := range sub.Results {
+		ret.Counts[outcome(x)]++
+	}
+	return ret
+}
+
+// Authenticate the agent submitting r, returning the host it may submit
+// results for, * for any host, or an empty string if it may not submit
+// results.
+func (s *Server) agentHost(r *http.Request) (string, error) {
+	if s.AgentAuth == nil {
+		id, err := auth.Tokens(s.AgentTokens).Authenticate(r)
+		return id.Name, err
+	}
+	id, err := s.AgentAuth.Authenticate(r)
+	if err != nil {
+		return "", err
+	}
+	if s.AgentHost != nil {
+		return s.AgentHost(id), nil
+	}
+	if id.Name == "*" && id.Method != "bearer" {
+		return "", nil
+	}
+	return id.Name, nil
+}
+
+// Return the authenticator for queries.
+func (s *Server) queryAuth() auth.Authenticator {
+	if s.QueryAuth != nil {
+		return s.QueryAuth
+	}
+	tokens := make(map[string]string)
+	for _, x := range s.QueryTokens {
+		tokens[x] = ""
+	}
+	return auth.Tokens(tokens)
+}
+
+// Handler returns an http.Handler serving the collector endpoints.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/results", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			s.submit(w, r)
+			return
+		}
+		s.query(w, r, s.results)
+	})
+	mux.HandleFunc("/api/v1/hosts", func(w http.ResponseWriter, r *http.Request) { s.query(w, r, s.hosts) })
+	mux.HandleFunc("/api/v1/summary", func(w http.ResponseWriter, r *http.Request) { s.query(w, r, s.summary) })
+	mux.HandleFunc("/api/v1/history", func(w http.ResponseWriter, r *http.Request) { s.query(w, r, s.history) })
+	return mux
+}
+
+func (s *Server) submit(w http.ResponseWriter, r *http.Request) {
+	allowed, err := s.agentHost(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unauthorized: %v", err), http.StatusUnauthorized)
+		return
+	}
+	max := s.MaxSubmission
+	if max == 0 {
+		max = defaultMaxSubmission
+	}
+	var sub Submission
+	err = json.NewDecoder(http.MaxBytesReader(w, r.Body, max)).Decode(&sub)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid submission: %v", err), http.StatusBadRequest)
+		return
+	}
+	if sub.Host == "" || sub.Document == "" {
+		http.Error(w, "submission must include host and document", http.StatusBadRequest)
+		return
+	}
+	if allowed != "*" && allowed != sub.Host {
+		http.Error(w, fmt.Sprintf("agent can not submit results for %v", sub.Host), http.StatusForbidden)
+		return
+	}
+	sub.Received = time.Now().UTC()
+	if sub.Time.IsZero() {
+		sub.Time = sub.Received
+	}
+	err = s.Store.Add(sub)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Authenticate a query and write the value returned by f as JSON.
+func (s *Server) query(w http.ResponseWriter, r *http.Request, f func(r *http.Request) interface{}) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, err := s.queryAuth().Authenticate(r); err != nil {
+		http.Error(w, fmt.Sprintf("unauthorized: %v", err), http.StatusUnauthorized)
+		return
+	}
+	buf, err := json.MarshalIndent(f(r), "", "    ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(buf, '\n'))
+}
+
+func (s *Server) hosts(r *http.Request) interface{} {
+	ret := []HostStatus{}
+	idx := make(map[string]int)
+	for _, x := range s.Store.Latest() {
+		i, ok := idx[x.Host]
+		if !ok {
+			i = len(ret)
+			idx[x.Host] = i
+			ret = append(ret, HostStatus{Host: x.Host})
+		}
+		if x.Received.After(ret[i].LastSeen) {
+			ret[i].LastSeen = x.Received
+		}
+		ret[i].Documents = append(ret[i].Documents, summarize(x))
+	}
+	return ret
+}
+
+func (s *Server) results(r *http.Request) interface{} {
+	q := r.URL.Query()
+	ret := []ResultRecord{}
+	for _, x := range s.Store.Latest() {
+		if (q.Get("host") != "" && x.Host != q.Get("host")) ||
+			(q.Get("document") != "" && x.Document != q.Get("document")) {
+			continue
+		}
+		for _, y := range x.Results {
+			o := outcome(y)
+			if (q.Get("test") != "" && y.TestID != q.Get("test")) ||
+				(q.Get("outcome") != "" && o != q.Get("outcome")) {
+				continue
+			}
+			ret = append(ret, ResultRecord{Host: x.Host, Document: x.Document, Time: x.Time, Outcome: o, Result: y})
+		}
+	}
+	return ret
+}
+
+func (s *Server) summary(r *http.Request) interface{} {
+	doc := r.URL.Query().Get("document")
+	tests := make(map[string]*TestSummary)
+	for _, x := range s.Store.Latest() {
+		if doc != "" && x.Document != doc {
+			continue
+		}
+		for _, y := range x.Results {
+			ts, ok := tests[y.TestID]
+			if !ok {
+				ts = &TestSummary{TestID: y.TestID, Name: y.TestName,
+					Counts: make(map[string]int), Hosts: make(map[string][]string)}
+				tests[y.TestID] = ts
+			}
+			o := outcome(y)
+			ts.Counts[o]++
+			ts.Hosts[o] = append(ts.Hosts[o], x.Host)
+		}
+	}
+	ret := make([]TestSummary, 0, len(tests))
+	for _, x := range tests {
+		ret = append(ret, *x)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].TestID < ret[j].TestID })
+	return ret
+}
+
+func (s *Server) history(r *http.Request) interface{} {
+	q := r.URL.Query()
+	ret := []DocumentSummary{}
+	for _, x := range s.Store.History(q.Get("host"), q.Get("document")) {
+		ret = append(ret, summarize(x))
+	}
+	return ret
+}
+
+// Client submits results to a collector at URL, the base URL of the
+// server, authenticating with Token if it is set. If HTTPClient is nil
+// scribe.HTTPClient() is used with a timeout of 60 seconds, presenting the
+// client certificate set with scribe.SetTLSOptions().
+type Client struct {
+	URL        string
+	Token      string
+	HTTPClient *http.Client
+}
+
+const defaultTimeout = 60 * time.Second
+
+// Submit sends the submission to the collector.
+func (c *Client) Submit(sub Submission) error {
+	buf, err := json.Marshal(sub)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(c.URL, "/")+"/api/v1/results", bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	client := c.HTTPClient
+	if client == nil {
+		client = scribe.HTTPClient(defaultTimeout)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("collector: %v %v", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
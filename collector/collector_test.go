@@ -0,0 +1,203 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package collector_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mozilla/scribe"
+	"github.com/mozilla/scribe/auth"
+	"github.com/mozilla/scribe/collector"
+	"github.com/mozilla/scribe/output"
+)
+
+func query(t *testing.T, url string, token string, v interface{}) int {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK && v != nil {
+		err = json.NewDecoder(resp.Body).Decode(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestCollector(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "submissions.jsonl")
+	store, err := collector.OpenStore(path, time.Hour)
+	if err != nil {
+		t.Fatalf("collector.OpenStore: %v", err)
+	}
+	s := &collector.Server{
+		Store:       store,
+		AgentTokens: map[string]string{"web1-token": "web1", "fleet-token": "*"},
+		QueryTokens: []string{"query-token"},
+	}
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+
+	submit := func(token string, host string, results ...scribe.TestResult) error {
+		c := collector.Client{URL: srv.URL, Token: token}
+		return c.Submit(collector.Submission{Host: host, Document: "base.json", Time: time.Now().UTC(), Results: results})
+	}
+	pass := scribe.TestResult{TestID: "ssh", MasterResult: true}
+	fail := scribe.TestResult{TestID: "ssh", MasterResult: false}
+	broken := scribe.TestResult{TestID: "ntp", IsError: true, Error: "no such file"}
+	if err := submit("web1-token", "web1", fail, broken); err != nil {
+		t.Fatalf("Client.Submit: %v", err)
+	}
+	if err := submit("web1-token", "web1", pass, broken); err != nil {
+		t.Fatalf("Client.Submit: %v", err)
+	}
+
+	// Results are submitted through the output sink as agents do.
+	os.Setenv("SCRIBE_COLLECTOR_TOKEN", "fleet-token")
+	defer os.Unsetenv("SCRIBE_COLLECTOR_TOKEN")
+	sink, err := output.New("collector", nil, srv.URL)
+	if err != nil {
+		t.Fatalf("output.New: %v", err)
+	}
+	err = sink.Start(output.RunInfo{Document: "base.json", Host: "db1", Time: time.Now().UTC()})
+	if err == nil {
+		err = sink.WriteResult(fail)
+	}
+	if err == nil {
+		err = sink.Finish()
+	}
+	if err != nil {
+		t.Fatalf("collector sink: %v", err)
+	}
+
+	// A token can only submit for its host.
+	if err := submit("web1-token", "db1", pass); err == nil {
+		t.Fatalf("Client.Submit should have failed for another host")
+	}
+	if err := submit("invalid", "web1", pass); err == nil {
+		t.Fatalf("Client.Submit should have failed for an invalid token")
+	}
+
+	var hosts []collector.HostStatus
+	if code := query(t, srv.URL+"/api/v1/hosts", "web1-token", &hosts); code != http.StatusUnauthorized {
+		t.Fatalf("query with agent token returned %v", code)
+	}
+	query(t, srv.URL+"/api/v1/hosts", "query-token", &hosts)
+	if len(hosts) != 2 || hosts[0].Host != "db1" || hosts[1].Host != "web1" || hosts[1].LastSeen.IsZero() ||
+		!reflect.DeepEqual(hosts[1].Documents[0].Counts, map[string]int{"true": 1, "error": 1}) {
+		t.Fatalf("unexpected hosts %+v", hosts)
+	}
+
+	var results []collector.ResultRecord
+	query(t, srv.URL+"/api/v1/results?test=ssh&outcome=false", "query-token", &results)
+	if len(results) != 1 || results[0].Host != "db1" || results[0].Result.TestID != "ssh" {
+		t.Fatalf("unexpected results %+v", results)
+	}
+
+	var summary []collector.TestSummary
+	query(t, srv.URL+"/api/v1/summary?document=base.json", "query-token", &summary)
+	if len(summary) != 2 || summary[1].TestID != "ssh" ||
+		!reflect.DeepEqual(summary[1].Hosts, map[string][]string{"false": {"db1"}, "true": {"web1"}}) ||
+		summary[0].Counts["error"] != 1 {
+		t.Fatalf("unexpected summary %+v", summary)
+	}
+
+	var history []collector.DocumentSummary
+	query(t, srv.URL+"/api/v1/history?host=web1", "query-token", &history)
+	if len(history) != 2 || history[0].Counts["false"] != 1 || history[1].Counts["true"] != 1 {
+		t.Fatalf("unexpected history %+v", history)
+	}
+
+	// Submissions are kept across a restart.
+	store.Close()
+	store, err = collector.OpenStore(path, time.Hour)
+	if err != nil {
+		t.Fatalf("collector.OpenStore: %v", err)
+	}
+	defer store.Close()
+	if n := len(store.History("", "")); n != 3 || len(store.Latest()) != 2 {
+		t.Fatalf("unexpected submissions after reopening store: %v", n)
+	}
+}
+
+func TestCollectorAgentAuth(t *testing.T) {
+	store, err := collector.OpenStore("", 0)
+	if err != nil {
+		t.Fatalf("collector.OpenStore: %v", err)
+	}
+	// Stands in for a client certificate or OIDC authenticator, naming the
+	// identity after the bearer token.
+	ids := auth.Validator(func(token string) (auth.Identity, error) {
+		return auth.Identity{Name: token, Method: "oidc"}, nil
+	})
+	s := &collector.Server{Store: store, AgentAuth: ids, QueryTokens: []string{"query-token"}}
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+	submit := func(token string, host string) error {
+		c := collector.Client{URL: srv.URL, Token: token}
+		return c.Submit(collector.Submission{Host: host, Document: "base.json"})
+	}
+
+	// By default an identity may only submit results for the host it is
+	// named after, and can not be named *.
+	if err := submit("web1", "web1"); err != nil {
+		t.Fatalf("Client.Submit: %v", err)
+	}
+	for _, x := range [][]string{{"web1", "db1"}, {"*", "db1"}, {"", "web1"}} {
+		if err := submit(x[0], x[1]); err == nil {
+			t.Fatalf("Client.Submit should have failed for %q submitting for %v", x[0], x[1])
+		}
+	}
+
+	s.AgentHost = func(id auth.Identity) string {
+		return map[string]string{"svc-db": "db1", "svc-fleet": "*"}[id.Name]
+	}
+	if err := submit("svc-db", "db1"); err != nil {
+		t.Fatalf("Client.Submit: %v", err)
+	}
+	if err := submit("svc-fleet", "web2"); err != nil {
+		t.Fatalf("Client.Submit: %v", err)
+	}
+	if err := submit("web1", "web1"); err == nil {
+		t.Fatalf("Client.Submit should have failed for unmapped identity")
+	}
+
+	// The bearer scheme is matched without regard to case.
+	var hosts []collector.HostStatus
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/api/v1/hosts", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "bearer query-token")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("query returned %v", resp.Status)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&hosts)
+	if err != nil || len(hosts) != 3 {
+		t.Fatalf("unexpected hosts %+v: %v", hosts, err)
+	}
+}
@@ -0,0 +1,189 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package collector
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Store keeps the submissions received by a collector. Submissions are
+// held in memory and, if the store has a path, appended to the file at
+// path as JSON, one submission per line, so they survive a restart.
+type Store struct {
+	retention time.Duration
+
+	mu   sync.Mutex
+	fd   *os.File
+	subs []Submission // In the order received.
+}
+
+// The maximum size of a line in a store file.
+const maxStoreLine = 64 << 20
+
+// OpenStore opens the store kept in the file at path, creating it if it
+// does not exist. If path is empty submissions are only kept in memory.
+// Submissions received more than retention ago are discarded, if retention
+// is not 0.
+func OpenStore(path string, retention time.Duration) (*Store, error) {
+	s := &Store{retention: retention}
+	if path == "" {
+		return s, nil
+	}
+	fd, err := os.Open(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		scanner := bufio.NewScanner(fd)
+		scanner.Buffer(nil, maxStoreLine)
+		for scanner.Scan() {
+			var sub Submission
+			if json.Unmarshal(scanner.Bytes(), &sub) != nil {
+				// Skip a partially written last line.
+				continue
+			}
+			s.subs = append(s.subs, sub)
+		}
+		err = scanner.Err()
+		fd.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	s.expire(time.Now())
+
+	// Rewrite the file without expired submissions, and keep it open
+	// to append new submissions.
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".compact")
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(tmp)
+	for _, x := range s.subs {
+		buf, err := json.Marshal(x)
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return nil, err
+		}
+		w.Write(append(buf, '\n'))
+	}
+	err = w.Flush()
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	s.fd, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Discard submissions received before the retention period.
+func (s *Store) expire(now time.Time) {
+	if s.retention <= 0 {
+		return
+	}
+	cutoff := now.Add(-s.retention)
+	n := sort.Search(len(s.subs), func(i int) bool { return !s.subs[i].Received.Before(cutoff) })
+	if n > 0 {
+		s.subs = append([]Submission(nil), s.subs[n:]...)
+	}
+}
+
+// Add adds a submission to the store.
+func (s *Store) Add(sub Submission) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fd != nil {
+		buf, err := json.Marshal(sub)
+		if err != nil {
+			return err
+		}
+		_, err = s.fd.Write(append(buf, '\n'))
+		if err != nil {
+			return err
+		}
+	}
+	s.subs = append(s.subs, sub)
+	s.expire(sub.Received)
+	return nil
+}
+
+// Latest returns the most recent submission for each host and document,
+// sorted by host and document.
+func (s *Store) Latest() []Submission {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	type key struct{ host, document string }
+	latest := make(map[key]int)
+	for i, x := range s.subs {
+		k := key{x.Host, x.Document}
+		if j, ok := latest[k]; !ok || !x.Time.Before(s.subs[j].Time) {
+			latest[k] = i
+		}
+	}
+	ret := make([]Submission, 0, len(latest))
+	for _, i := range latest {
+		ret = append(ret, s.subs[i])
+	}
+	sortSubmissions(ret)
+	return ret
+}
+
+// History returns the submissions for host and document in the order they
+// were received. An empty host or document matches any.
+func (s *Store) History(host string, document string) []Submission {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ret []Submission
+	for _, x := range s.subs {
+		if (host == "" || x.Host == host) && (document == "" || x.Document == document) {
+			ret = append(ret, x)
+		}
+	}
+	return ret
+}
+
+// Close closes the store file.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fd == nil {
+		return nil
+	}
+	err := s.fd.Close()
+	s.fd = nil
+	return err
+}
+
+func sortSubmissions(subs []Submission) {
+	sort.Slice(subs, func(i, j int) bool {
+		if subs[i].Host != subs[j].Host {
+			return subs[i].Host < subs[j].Host
+		}
+		return subs[i].Document < subs[j].Document
+	})
+}
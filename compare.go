@@ -0,0 +1,80 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"fmt"
+)
+
+// CompareTest is used to compare criteria with Value as a typed value,
+// rather than as a string. Type is one of string, int, bool or version,
+// and the test value is coerced to the type as described for ValueInt and
+// related constants. For example, with a type of int "10" is greater than
+// "9", where compared as strings it is less.
+//
+// Operation is one of =, !=, <, <=, > or >=. Values of type bool can only
+// be compared using = and !=.
+//
+// Value must be valid for the type or the document fails to load. If a test
+// value can not be coerced to the type, the test results in an error.
+type CompareTest struct {
+	Type      string `json:"type,omitempty" yaml:"type,omitempty"`
+	Operation string `json:"operation,omitempty" yaml:"operation,omitempty"`
+	Value     string `json:"value,omitempty" yaml:"value,omitempty"`
+
+	value typedValue
+}
+
+func (c *CompareTest) validate() error {
+	if c.Type == "" {
+		return fmt.Errorf("compare type must be set")
+	}
+	switch c.Operation {
+	case "=", "!=":
+	case "<", "<=", ">", ">=":
+		if c.Type == ValueBool {
+			return fmt.Errorf("compare operation %v is not valid for bool values", c.Operation)
+		}
+	default:
+		return fmt.Errorf("invalid compare operation %q", c.Operation)
+	}
+	var err error
+	c.value, err = parseTypedValue(c.Type, c.Value)
+	if err != nil {
+		return fmt.Errorf("compare: %v", err)
+	}
+	return nil
+}
+
+func (c *CompareTest) evaluate(cr evaluationCriteria) (ret evaluationResult, err error) {
+	debugPrint("evaluate(): compare %v \"%v\", %v %v \"%v\"\n", cr.identifier, cr.testValue, c.Type, c.Operation, c.Value)
+	ret.criteria = cr
+	v, err := parseTypedValue(c.Type, cr.testValue)
+	if err != nil {
+		return ret, fmt.Errorf("%v: %v", cr.identifier, err)
+	}
+	r, err := v.compare(c.value)
+	if err != nil {
+		return ret, err
+	}
+	switch c.Operation {
+	case "=":
+		ret.result = r == 0
+	case "!=":
+		ret.result = r != 0
+	case "<":
+		ret.result = r < 0
+	case "<=":
+		ret.result = r <= 0
+	case ">":
+		ret.result = r > 0
+	case ">=":
+		ret.result = r >= 0
+	}
+	return ret, nil
+}
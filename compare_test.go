@@ -0,0 +1,138 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mozilla/scribe"
+)
+
+// Used in TestComparePolicy
+var comparePolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "maxauthtries",
+		"raw": {
+			"identifiers": [
+			{ "identifier": "sshd_config", "value": " 10" }
+			]
+		}
+	},
+
+	{
+		"object": "permitroot",
+		"raw": {
+			"identifiers": [
+			{ "identifier": "sshd_config", "value": "No" }
+			]
+		}
+	},
+
+	{
+		"object": "openssl",
+		"raw": {
+			"identifiers": [
+			{ "identifier": "openssl", "value": "1.1.10" }
+			]
+		}
+	},
+
+	{
+		"object": "notanumber",
+		"raw": {
+			"identifiers": [
+			{ "identifier": "sshd_config", "value": "ten" }
+			]
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "compare0",
+		"expectedresult": false,
+		"object": "maxauthtries",
+		"compare": { "type": "int", "operation": "<", "value": "9" }
+	},
+
+	{
+		"test": "compare1",
+		"expectedresult": true,
+		"object": "maxauthtries",
+		"compare": { "type": "string", "operation": "<", "value": "9" }
+	},
+
+	{
+		"test": "compare2",
+		"expectedresult": true,
+		"object": "maxauthtries",
+		"compare": { "type": "int", "operation": ">=", "value": "+010" }
+	},
+
+	{
+		"test": "compare3",
+		"expectedresult": true,
+		"object": "permitroot",
+		"compare": { "type": "bool", "operation": "!=", "value": "true" }
+	},
+
+	{
+		"test": "compare4",
+		"expectedresult": true,
+		"object": "openssl",
+		"compare": { "type": "version", "operation": ">", "value": "1.1.9" }
+	},
+
+	{
+		"test": "compare5",
+		"expecterror": true,
+		"object": "notanumber",
+		"compare": { "type": "int", "operation": "=", "value": "10" }
+	},
+
+	{
+		"test": "exactmatch0",
+		"expectedresult": true,
+		"object": "permitroot",
+		"exactmatch": { "type": "bool", "value": "off" }
+	},
+
+	{
+		"test": "exactmatch1",
+		"expectedresult": false,
+		"object": "permitroot",
+		"exactmatch": { "value": "off" }
+	}
+	]
+}
+`
+
+func TestComparePolicy(t *testing.T) {
+	genericTestExec(t, comparePolicyDoc)
+}
+
+func TestCompareInvalidParameters(t *testing.T) {
+	for _, x := range []string{
+		`"compare": {"operation": "<", "value": "9"}`,
+		`"compare": {"type": "float", "operation": "<", "value": "9"}`,
+		`"compare": {"type": "int", "operation": "~", "value": "9"}`,
+		`"compare": {"type": "int", "operation": "<", "value": "9.5"}`,
+		`"compare": {"type": "bool", "operation": "<", "value": "true"}`,
+		`"exactmatch": {"type": "bool", "value": "maybe"}`,
+	} {
+		docstr := `{"objects": [{"object": "o", "raw": {"identifiers": [{"identifier": "a", "value": "1"}]}}],
+			"tests": [{"test": "t", "object": "o", ` + x + `}]}`
+		_, err := scribe.LoadDocument(strings.NewReader(docstr))
+		if err == nil {
+			t.Fatalf("document with %v should not load", x)
+		}
+	}
+}
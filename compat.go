@@ -0,0 +1,137 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"fmt"
+)
+
+// Incompatibility describes a secret, object or test in a document that
+// cannot be evaluated by an agent with a given set of capabilities.
+type Incompatibility struct {
+	Secret string `json:"secret,omitempty" yaml:"secret,omitempty"`
+	Object string `json:"object,omitempty" yaml:"object,omitempty"`
+	Test   string `json:"test,omitempty" yaml:"test,omitempty"`
+	Reason string `json:"reason" yaml:"reason"`
+}
+
+// CheckCompatibility returns the secrets, objects and tests in document d
+// that cannot be evaluated by an agent with capabilities caps, as returned
+// by GetCapabilities() on the agent. An empty result indicates the entire
+// document can be evaluated.
+//
+// Secrets are incompatible if a source refers to a secret that is not set
+// on the agent. Objects are incompatible if the source type is not
+// supported, or depends on a database driver, secret or package backend the
+// agent does not have. Tests are incompatible if the evaluator is not supported, or if
+// the test references an incompatible object or depends on an incompatible
+// test.
+func CheckCompatibility(d *Document, caps Capabilities) []Incompatibility {
+	ret := make([]Incompatibility, 0)
+	sources := make(map[string]bool)
+	for _, x := range caps.Sources {
+		sources[x.Name] = x.Supported
+	}
+	evaluators := make(map[string]bool)
+	for _, x := range caps.Evaluators {
+		evaluators[x.Name] = x.Supported
+	}
+	secrets := make(map[string]bool)
+	for _, x := range caps.Secrets {
+		secrets[x] = true
+	}
+	drivers := make(map[string]bool)
+	for _, x := range caps.DatabaseDrivers {
+		drivers[x] = true
+	}
+	pkgBackend := false
+	for _, x := range caps.PackageBackends {
+		if x.Supported {
+			pkgBackend = true
+		}
+	}
+
+	badSecrets := make(map[string]bool)
+	for i := range d.Objects {
+		for _, x := range []string{d.Objects[i].Database.DSNSecret, d.Objects[i].LDAP.PasswordSecret} {
+			if x == "" || secrets[x] || badSecrets[x] {
+				continue
+			}
+			badSecrets[x] = true
+			ret = append(ret, Incompatibility{Secret: x, Reason: "secret is not set on the agent"})
+		}
+	}
+
+	badObjects := make(map[string]string)
+	for i := range d.Objects {
+		o := &d.Objects[i]
+		name := o.sourceName()
+		if name == "" {
+			continue
+		}
+		reason := ""
+		if ok, found := sources[name]; !found {
+			reason = fmt.Sprintf("source %v is not available", name)
+		} else if !ok {
+			reason = fmt.Sprintf("source %v is not supported on %v", name, caps.Platform)
+		} else if name == "package" && !pkgBackend {
+			reason = "no package manager backend is available"
+		} else if name == "database" && !drivers[o.Database.Driver] {
+			reason = fmt.Sprintf("database driver %v is not available", o.Database.Driver)
+		} else if name == "database" && badSecrets[o.Database.DSNSecret] {
+			reason = fmt.Sprintf("secret %v is not available", o.Database.DSNSecret)
+		} else if name == "ldap" && badSecrets[o.LDAP.PasswordSecret] {
+			reason = fmt.Sprintf("secret %v is not available", o.LDAP.PasswordSecret)
+		}
+		if reason != "" {
+			badObjects[o.Object] = reason
+			ret = append(ret, Incompatibility{Object: o.Object, Reason: reason})
+		}
+	}
+
+	badTests := make(map[string]bool)
+	var checkTest func(t *Test) string
+	checkTest = func(t *Test) string {
+		ev := t.getEvaluationInterface()
+		if _, ok := ev.(*noop); !ok {
+			name, _ := fieldForInterface(t, ev)
+			if name == "custom" {
+				name = "custom:" + t.Custom.Type
+			}
+			if !evaluators[name] {
+				return fmt.Sprintf("evaluator %v is not supported", name)
+			}
+		}
+		if _, ok := badObjects[t.Object]; ok {
+			return fmt.Sprintf("object %v can not be evaluated", t.Object)
+		}
+		for _, x := range t.If {
+			if badTests[x] {
+				return fmt.Sprintf("dependency %v can not be evaluated", x)
+			}
+		}
+		return ""
+	}
+	// Dependencies can appear after the tests that use them, so repeat
+	// until no further tests are found to be incompatible.
+	for changed := true; changed; {
+		changed = false
+		for i := range d.Tests {
+			t := &d.Tests[i]
+			if badTests[t.TestID] {
+				continue
+			}
+			if reason := checkTest(t); reason != "" {
+				badTests[t.TestID] = true
+				ret = append(ret, Incompatibility{Test: t.TestID, Reason: reason})
+				changed = true
+			}
+		}
+	}
+	return ret
+}
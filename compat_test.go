@@ -0,0 +1,112 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mozilla/scribe"
+)
+
+var compatDoc = `
+{
+	"objects": [
+	{
+		"object": "file-hasline",
+		"hasline": {
+			"path": "./test/hasline",
+			"file": ".*\\.txt",
+			"expression": ".*test.*"
+		}
+	},
+	{
+		"object": "directory-admins",
+		"ldap": {
+			"url": "ldaps://ldap.example.com",
+			"binddn": "cn=scribe,dc=example,dc=com",
+			"passwordsecret": "ldap-password",
+			"basedn": "dc=example,dc=com",
+			"filter": "(cn=admins)",
+			"attributes": [ "member" ]
+		}
+	},
+	{
+		"object": "winsvc",
+		"winservice": {
+			"name": "^Spooler$",
+			"property": "starttype"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "depends-on-admins",
+		"object": "file-hasline",
+		"if": [ "admins-small" ]
+	},
+	{
+		"test": "admins-small",
+		"object": "directory-admins",
+		"regexp": { "value": "^cn=" }
+	},
+	{
+		"test": "hasline-true",
+		"object": "file-hasline",
+		"cidr": { "ranges": [ "10.0.0.0/8" ] }
+	},
+	{
+		"test": "hasline-any",
+		"object": "file-hasline"
+	}
+	]
+}
+`
+
+func TestCheckCompatibility(t *testing.T) {
+	scribe.Bootstrap()
+	doc, err := scribe.LoadDocument(strings.NewReader(compatDoc))
+	if err != nil {
+		t.Fatalf("scribe.LoadDocument: %v", err)
+	}
+
+	// An agent without the ldap-password secret or the cidr evaluator,
+	// running on a platform without Windows services.
+	caps := scribe.Capabilities{
+		Platform: "plan9/amd64",
+		Sources: []scribe.Capability{
+			{Name: "hasline", Supported: true},
+			{Name: "ldap", Supported: true},
+			{Name: "winservice", Supported: false, Platforms: []string{"windows"}},
+		},
+		Evaluators:      []scribe.Capability{{Name: "regexp", Supported: true}},
+		SecretProviders: []string{"env", "file", "exec"},
+	}
+	expect := []scribe.Incompatibility{
+		{Secret: "ldap-password", Reason: "secret is not set on the agent"},
+		{Object: "directory-admins", Reason: "secret ldap-password is not available"},
+		{Object: "winsvc", Reason: "source winservice is not supported on plan9/amd64"},
+		{Test: "admins-small", Reason: "object directory-admins can not be evaluated"},
+		{Test: "hasline-true", Reason: "evaluator cidr is not supported"},
+		{Test: "depends-on-admins", Reason: "dependency admins-small can not be evaluated"},
+	}
+	res := scribe.CheckCompatibility(&doc, caps)
+	if !reflect.DeepEqual(res, expect) {
+		t.Fatalf("unexpected incompatibilities %+v", res)
+	}
+
+	caps.Secrets = append(caps.Secrets, "ldap-password")
+	caps.Evaluators = append(caps.Evaluators, scribe.Capability{Name: "cidr", Supported: true})
+	caps.Sources[2].Supported = true
+	res = scribe.CheckCompatibility(&doc, caps)
+	if len(res) != 0 {
+		t.Fatalf("unexpected incompatibilities %+v", res)
+	}
+}
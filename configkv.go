@@ -0,0 +1,278 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ConfigKV is used to perform tests against settings in key value
+// configuration files, without extracting values using regular
+// expressions.
+//
+// Files are located using Path and File in the same way as for FileName.
+// Format describes the syntax of the files, and can be one of:
+//
+// sshd: a keyword followed by white space or = and the value, as used by
+// sshd_config, ssh_config and login.defs. Keywords are case insensitive and
+// are returned in lower case. Settings following a Match keyword are
+// returned in a section named after the Match line, for example
+// "match user backup".
+//
+// sysctl: a key followed by = and the value, as used by sysctl.conf. Keys
+// may use / or . as the separator and are returned using ., and a leading -
+// is ignored.
+//
+// ini: key = value or key: value settings, in sections started with
+// [section].
+//
+// Lines starting with # (and ; for the sysctl and ini formats) are
+// comments. Settings in a section are returned with a key of the section
+// name followed by a . and the key, for example main.port.
+//
+// Key is an optional regular expression; only settings with a key matching
+// the expression are returned. Precedence determines which value is
+// returned if a key is set more than once in a file, and can be first (the
+// first value is used, as for sshd), last (the last value is used, as for
+// sysctl and most other configuration files) or all (every value is
+// returned). The default is first for the sshd format and last otherwise.
+//
+// The identifier of each criteria is the path of the file and the key
+// separated by a colon, for example /etc/ssh/sshd_config:permitrootlogin,
+// and the test value is the value of the setting.
+type ConfigKV struct {
+	Path       string `json:"path,omitempty" yaml:"path,omitempty"`
+	File       string `json:"file,omitempty" yaml:"file,omitempty"`
+	Format     string `json:"format,omitempty" yaml:"format,omitempty"`
+	Key        string `json:"key,omitempty" yaml:"key,omitempty"`
+	Precedence string `json:"precedence,omitempty" yaml:"precedence,omitempty"`
+
+	LocatorOptions `yaml:",inline"`
+
+	fileRe  compiledRegexp
+	keyRe   compiledRegexp
+	matches []configKVMatch
+}
+
+type configKVMatch struct {
+	path   string
+	key    string
+	value  string
+	line   int
+	offset int64
+}
+
+func (c *ConfigKV) isChain() bool {
+	return false
+}
+
+func (c *ConfigKV) fireChains(d *Document) ([]evaluationCriteria, error) {
+	return nil, nil
+}
+
+func (c *ConfigKV) mergeCriteria(ec []evaluationCriteria) {
+}
+
+func (c *ConfigKV) validate(d *Document) error {
+	if len(c.Path) == 0 {
+		return fmt.Errorf("configkv path must be set")
+	}
+	if len(c.File) == 0 {
+		return fmt.Errorf("configkv file must be set")
+	}
+	_, err := c.fileRe.compile(c.fileExpression(c.File))
+	if err != nil {
+		return err
+	}
+	switch c.Format {
+	case "sshd", "sysctl", "ini":
+	default:
+		return fmt.Errorf("configkv format must be sshd, sysctl or ini")
+	}
+	switch c.Precedence {
+	case "", "first", "last", "all":
+	default:
+		return fmt.Errorf("configkv precedence must be first, last or all")
+	}
+	if c.Key != "" {
+		_, err = c.keyRe.compile(c.keyExpression())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Return the key expression, which is case insensitive for formats with
+// case insensitive keys.
+func (c *ConfigKV) keyExpression() string {
+	if c.Format == "sshd" {
+		return "(?i)" + c.Key
+	}
+	return c.Key
+}
+
+func (c *ConfigKV) precedence() string {
+	if c.Precedence != "" {
+		return c.Precedence
+	}
+	if c.Format == "sshd" {
+		return "first"
+	}
+	return "last"
+}
+
+func (c *ConfigKV) expandVariables(v []Variable) {
+	c.Path = variableExpansion(v, c.Path)
+	c.File = variableExpansion(v, c.File)
+}
+
+func (c *ConfigKV) getCriteria() (ret []evaluationCriteria) {
+	for _, x := range c.matches {
+		n := evaluationCriteria{}
+		n.identifier = x.path + ":" + x.key
+		n.testValue = x.value
+		n.location = &Location{Line: x.line, Offset: x.offset}
+		ret = append(ret, n)
+	}
+	return ret
+}
+
+func (c *ConfigKV) prepare() error {
+	debugPrint("prepare(): analyzing file system, path %v, file \"%v\"\n", c.Path, c.File)
+
+	re, err := c.fileRe.compile(c.fileExpression(c.File))
+	if err != nil {
+		return err
+	}
+
+	sfl := newSimpleFileLocator()
+	sfl.root = c.Path
+	sfl.opts = c.LocatorOptions
+	err = sfl.locateRegexp(re)
+	if err != nil {
+		return err
+	}
+
+	for _, x := range sfl.matches {
+		m, err := c.parseFile(x)
+		if err != nil {
+			debugPrint("prepare(): skipping %v: %v\n", x, err)
+			continue
+		}
+		for _, y := range m {
+			debugPrint("prepare(): %v %v = \"%v\"\n", x, y.key, y.value)
+			y.path = sfl.identifier(x)
+			c.matches = append(c.matches, y)
+		}
+	}
+	return nil
+}
+
+// Parse the settings from the file at path, applying the key expression and
+// precedence.
+func (c *ConfigKV) parseFile(path string) ([]configKVMatch, error) {
+	fd, err := openLocated(path, c.LocatorOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	var keyre *regexp.Regexp
+	if c.Key != "" {
+		keyre, err = c.keyRe.compile(c.keyExpression())
+		if err != nil {
+			return nil, err
+		}
+	}
+	prec := c.precedence()
+	ret := make([]configKVMatch, 0)
+	index := make(map[string]int)
+	section := ""
+	next := forwardScanner(fd)
+	for {
+		sl, err := next()
+		if err != nil {
+			break
+		}
+		ln := strings.TrimSpace(sl.text)
+		if ln == "" || strings.HasPrefix(ln, "#") {
+			continue
+		}
+		if c.Format != "sshd" && strings.HasPrefix(ln, ";") {
+			continue
+		}
+		var key, value string
+		switch c.Format {
+		case "sshd":
+			key, value = splitConfigSSHD(ln)
+			key = strings.ToLower(key)
+			if key == "match" {
+				section = strings.ToLower("match " + value)
+				continue
+			}
+		case "sysctl":
+			i := strings.Index(ln, "=")
+			if i == -1 {
+				continue
+			}
+			key = strings.TrimPrefix(strings.TrimSpace(ln[:i]), "-")
+			key = strings.Replace(key, "/", ".", -1)
+			value = strings.TrimSpace(ln[i+1:])
+		case "ini":
+			if strings.HasPrefix(ln, "[") && strings.HasSuffix(ln, "]") {
+				section = strings.TrimSpace(ln[1 : len(ln)-1])
+				continue
+			}
+			i := strings.IndexAny(ln, "=:")
+			if i == -1 {
+				continue
+			}
+			key = strings.TrimSpace(ln[:i])
+			value = strings.TrimSpace(ln[i+1:])
+		}
+		if key == "" {
+			continue
+		}
+		if section != "" {
+			key = section + "." + key
+		}
+		if keyre != nil && !keyre.MatchString(key) {
+			continue
+		}
+		m := configKVMatch{key: key, value: value, line: sl.line, offset: sl.offset}
+		if i, ok := index[key]; ok && prec != "all" {
+			if prec == "last" {
+				ret[i] = m
+			}
+			continue
+		}
+		index[key] = len(ret)
+		ret = append(ret, m)
+	}
+	return ret, nil
+}
+
+// Split an sshd_config style line into the keyword and value. The keyword
+// is separated from the value by white space or a single =, and the value
+// may be quoted.
+func splitConfigSSHD(ln string) (string, string) {
+	i := strings.IndexAny(ln, " \t=")
+	if i == -1 {
+		return ln, ""
+	}
+	key := ln[:i]
+	value := strings.TrimSpace(ln[i:])
+	value = strings.TrimSpace(strings.TrimPrefix(value, "="))
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		value = value[1 : len(value)-1]
+	}
+	return key, value
+}
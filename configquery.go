@@ -0,0 +1,370 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mozilla/scribe/internal/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// ConfigQuery is used to perform tests against values in structured
+// configuration files, such as JSON, YAML or TOML files.
+//
+// Files are located using Path and File in the same way as for FileName.
+// Format is json, yaml or toml, and if not set is determined from the
+// extension of each file.
+//
+// Query selects the values in the file using a jq like path expression. The
+// expression starts with a ., and is made up of object keys (.tls or
+// ."key.with.dots"), array indexes ([0]) and iterators ([] returns every
+// element of an array or value of an object). For example
+// .tls.min_version, or .servers[].port to return the port of every server.
+// The expression . selects the entire document.
+//
+// Strings, numbers and booleans are returned as the test value, and a
+// null value is returned as null. Objects and arrays selected by the query
+// are returned as JSON.
+//
+// The identifier of each criteria is the path of the file and the path to
+// the value in the file separated by a colon, for example
+// /etc/app/config.yaml:.servers[1].port.
+type ConfigQuery struct {
+	Path   string `json:"path,omitempty" yaml:"path,omitempty"`
+	File   string `json:"file,omitempty" yaml:"file,omitempty"`
+	Format string `json:"format,omitempty" yaml:"format,omitempty"`
+	Query  string `json:"query,omitempty" yaml:"query,omitempty"`
+
+	LocatorOptions `yaml:",inline"`
+
+	fileRe  compiledRegexp
+	steps   []queryStep
+	matches []configQueryMatch
+}
+
+type configQueryMatch struct {
+	path  string
+	key   string
+	value string
+}
+
+// A single step in a query expression. If iterate is set every element of
+// the current value is selected, otherwise the key or index is.
+type queryStep struct {
+	key     string
+	index   int
+	isIndex bool
+	iterate bool
+}
+
+func (c *ConfigQuery) isChain() bool {
+	return false
+}
+
+func (c *ConfigQuery) fireChains(d *Document) ([]evaluationCriteria, error) {
+	return nil, nil
+}
+
+func (c *ConfigQuery) mergeCriteria(ec []evaluationCriteria) {
+}
+
+func (c *ConfigQuery) validate(d *Document) error {
+	if len(c.Path) == 0 {
+		return fmt.Errorf("configquery path must be set")
+	}
+	if len(c.File) == 0 {
+		return fmt.Errorf("configquery file must be set")
+	}
+	if len(c.Query) == 0 {
+		return fmt.Errorf("configquery query must be set")
+	}
+	switch c.Format {
+	case "", "json", "yaml", "toml":
+	default:
+		return fmt.Errorf("configquery format must be json, yaml or toml")
+	}
+	_, err := c.fileRe.compile(c.fileExpression(c.File))
+	if err != nil {
+		return err
+	}
+	_, err = parseQuery(c.Query)
+	if err != nil {
+		return fmt.Errorf("configquery query: %v", err)
+	}
+	return nil
+}
+
+func (c *ConfigQuery) expandVariables(v []Variable) {
+	c.Path = variableExpansion(v, c.Path)
+	c.File = variableExpansion(v, c.File)
+}
+
+func (c *ConfigQuery) getCriteria() (ret []evaluationCriteria) {
+	for _, x := range c.matches {
+		n := evaluationCriteria{}
+		n.identifier = x.path + ":" + x.key
+		n.testValue = x.value
+		ret = append(ret, n)
+	}
+	return ret
+}
+
+func (c *ConfigQuery) prepare() error {
+	debugPrint("prepare(): analyzing file system, path %v, file \"%v\"\n", c.Path, c.File)
+
+	re, err := c.fileRe.compile(c.fileExpression(c.File))
+	if err != nil {
+		return err
+	}
+	c.steps, err = parseQuery(c.Query)
+	if err != nil {
+		return err
+	}
+
+	sfl := newSimpleFileLocator()
+	sfl.root = c.Path
+	sfl.opts = c.LocatorOptions
+	err = sfl.locateRegexp(re)
+	if err != nil {
+		return err
+	}
+
+	for _, x := range sfl.matches {
+		root, err := c.load(x)
+		if err != nil {
+			debugPrint("prepare(): skipping %v: %v\n", x, err)
+			continue
+		}
+		for _, y := range queryValues(root, c.steps, "") {
+			debugPrint("prepare(): %v %v: %v\n", x, y.key, y.value)
+			y.path = sfl.identifier(x)
+			c.matches = append(c.matches, y)
+		}
+	}
+	return nil
+}
+
+func (c *ConfigQuery) format(path string) string {
+	if c.Format != "" {
+		return c.Format
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".toml":
+		return "toml"
+	}
+	return "json"
+}
+
+// Load and decode the file at path. Objects are returned as
+// map[string]interface{}, and arrays as []interface{}.
+func (c *ConfigQuery) load(path string) (interface{}, error) {
+	fd, err := openLocated(path, c.LocatorOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	buf, err := ioutil.ReadAll(fd)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	switch c.format(path) {
+	case "yaml":
+		err = yaml.Unmarshal(buf, &v)
+		if err != nil {
+			return nil, err
+		}
+		return yamlNormalize(v), nil
+	case "toml":
+		return toml.Decode(buf)
+	}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	err = dec.Decode(&v)
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Convert the maps returned by the YAML decoder, which can have keys of any
+// type, into maps with string keys.
+func yamlNormalize(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		ret := make(map[string]interface{}, len(t))
+		for k, x := range t {
+			ret[fmt.Sprintf("%v", k)] = yamlNormalize(x)
+		}
+		return ret
+	case []interface{}:
+		for i := range t {
+			t[i] = yamlNormalize(t[i])
+		}
+	}
+	return v
+}
+
+// Parse a query expression into the steps used to select values.
+func parseQuery(q string) ([]queryStep, error) {
+	if !strings.HasPrefix(q, ".") && !strings.HasPrefix(q, "[") {
+		return nil, fmt.Errorf("query must start with .")
+	}
+	ret := make([]queryStep, 0)
+	for i := 0; i < len(q); {
+		switch q[i] {
+		case '.':
+			i++
+			if i == len(q) || q[i] == '[' {
+				continue
+			}
+			if q[i] == '"' {
+				key, n, err := parseQueryString(q[i:])
+				if err != nil {
+					return nil, err
+				}
+				ret = append(ret, queryStep{key: key})
+				i += n
+				continue
+			}
+			j := i
+			for j < len(q) && q[j] != '.' && q[j] != '[' {
+				j++
+			}
+			if j == i {
+				return nil, fmt.Errorf("empty key at offset %v", i)
+			}
+			ret = append(ret, queryStep{key: q[i:j]})
+			i = j
+		case '[':
+			j := strings.IndexByte(q[i:], ']')
+			if j == -1 {
+				return nil, fmt.Errorf("unterminated [ at offset %v", i)
+			}
+			inner := q[i+1 : i+j]
+			switch {
+			case inner == "":
+				ret = append(ret, queryStep{iterate: true})
+			case inner[0] == '"':
+				key, n, err := parseQueryString(inner)
+				if err != nil || n != len(inner) {
+					return nil, fmt.Errorf("invalid key %v", inner)
+				}
+				ret = append(ret, queryStep{key: key})
+			default:
+				idx, err := strconv.Atoi(inner)
+				if err != nil || idx < 0 {
+					return nil, fmt.Errorf("invalid index %v", inner)
+				}
+				ret = append(ret, queryStep{index: idx, isIndex: true})
+			}
+			i += j + 1
+		default:
+			return nil, fmt.Errorf("unexpected %q at offset %v", q[i], i)
+		}
+	}
+	return ret, nil
+}
+
+// Parse the quoted string at the start of s, returning the string and the
+// number of bytes consumed.
+func parseQueryString(s string) (string, int, error) {
+	for i := 1; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+		if s[i] == '"' {
+			ret, err := strconv.Unquote(s[:i+1])
+			return ret, i + 1, err
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string in query")
+}
+
+// Format a key for use in the path to a value returned by a query.
+func queryKey(key string) string {
+	for _, x := range key {
+		if x == '.' || x == '[' || x == ']' || x == '"' || x == ' ' {
+			return "." + strconv.Quote(key)
+		}
+	}
+	return "." + key
+}
+
+// Apply the query steps to v, returning each selected value and its path.
+func queryValues(v interface{}, steps []queryStep, path string) []configQueryMatch {
+	if len(steps) == 0 {
+		if path == "" {
+			path = "."
+		}
+		return []configQueryMatch{{key: path, value: queryValueString(v)}}
+	}
+	s := steps[0]
+	ret := make([]configQueryMatch, 0)
+	switch t := v.(type) {
+	case map[string]interface{}:
+		if s.iterate {
+			for _, k := range sortedInterfaceKeys(t) {
+				ret = append(ret, queryValues(t[k], steps[1:], path+queryKey(k))...)
+			}
+		} else if !s.isIndex {
+			if nv, ok := t[s.key]; ok {
+				ret = append(ret, queryValues(nv, steps[1:], path+queryKey(s.key))...)
+			}
+		}
+	case []interface{}:
+		if s.iterate {
+			for i, x := range t {
+				ret = append(ret, queryValues(x, steps[1:], fmt.Sprintf("%v[%v]", path, i))...)
+			}
+		} else if s.isIndex && s.index < len(t) {
+			ret = append(ret, queryValues(t[s.index], steps[1:],
+				fmt.Sprintf("%v[%v]", path, s.index))...)
+		}
+	}
+	return ret
+}
+
+func sortedInterfaceKeys(m map[string]interface{}) []string {
+	ret := make([]string, 0, len(m))
+	for k := range m {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Convert a value selected by a query into a test value.
+func queryValueString(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case map[string]interface{}, []interface{}:
+		buf, err := json.Marshal(t)
+		if err != nil {
+			return fmt.Sprintf("%v", t)
+		}
+		return string(buf)
+	}
+	return fmt.Sprintf("%v", v)
+}
@@ -0,0 +1,216 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Container is used to perform tests against containers running on the
+// system, by querying the Docker API on the local container runtime socket.
+// Runtimes providing a Docker compatible API (such as podman) can be used by
+// setting Socket.
+//
+// Property specifies which property of each running container is returned
+// as the test value, and can be one of:
+//
+// image: the image reference the container was created from
+//
+// privileged: "true" if the container is running in privileged mode
+//
+// mount: the source path of each mount in the container, a criteria is
+// returned for each mount
+//
+// The identifier for each criteria is the container name. If Name is set,
+// only containers with a name matching this regular expression are
+// included.
+type Container struct {
+	Property string `json:"property,omitempty" yaml:"property,omitempty"`
+	Name     string `json:"name,omitempty" yaml:"name,omitempty"`
+	Socket   string `json:"socket,omitempty" yaml:"socket,omitempty"`
+
+	matches []containerMatch
+}
+
+type containerMatch struct {
+	name  string
+	value string
+}
+
+type containerInfo struct {
+	ID         string
+	Name       string
+	Image      string
+	Privileged bool
+	Mounts     []string
+}
+
+const defaultContainerSocket = "/var/run/docker.sock"
+
+// The timeout applied to requests made to the container runtime.
+const containerTimeout = 10 * time.Second
+
+func (c *Container) isChain() bool {
+	return false
+}
+
+func (c *Container) fireChains(d *Document) ([]evaluationCriteria, error) {
+	return nil, nil
+}
+
+func (c *Container) mergeCriteria(cr []evaluationCriteria) {
+}
+
+func (c *Container) validate(d *Document) error {
+	switch c.Property {
+	case "image", "privileged", "mount":
+	default:
+		return fmt.Errorf("container property must be image, privileged or mount")
+	}
+	if len(c.Name) > 0 {
+		_, err := regexp.Compile(c.Name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Container) expandVariables(v []Variable) {
+	c.Socket = variableExpansion(v, c.Socket)
+}
+
+func (c *Container) getCriteria() (ret []evaluationCriteria) {
+	for _, x := range c.matches {
+		n := evaluationCriteria{}
+		n.identifier = x.name
+		n.testValue = x.value
+		ret = append(ret, n)
+	}
+	return ret
+}
+
+func (c *Container) prepare() error {
+	var re *regexp.Regexp
+	debugPrint("prepare(): inspecting containers, property \"%v\"\n", c.Property)
+	if len(c.Name) > 0 {
+		var err error
+		re, err = regexp.Compile(c.Name)
+		if err != nil {
+			return err
+		}
+	}
+	sock := c.Socket
+	if sock == "" {
+		sock = defaultContainerSocket
+	}
+	containers, err := getContainers(sock, c.Property == "privileged")
+	if err != nil {
+		return err
+	}
+	for _, x := range containers {
+		if re != nil && !re.MatchString(x.Name) {
+			continue
+		}
+		switch c.Property {
+		case "image":
+			c.matches = append(c.matches, containerMatch{x.Name, x.Image})
+		case "privileged":
+			c.matches = append(c.matches, containerMatch{x.Name, fmt.Sprintf("%v", x.Privileged)})
+		case "mount":
+			for _, y := range x.Mounts {
+				c.matches = append(c.matches, containerMatch{x.Name, y})
+			}
+		}
+	}
+	return nil
+}
+
+func getContainers(sock string, inspect bool) ([]containerInfo, error) {
+	if sRuntime.testHooks {
+		return testGetContainers(), nil
+	}
+	client := &http.Client{
+		Timeout: containerTimeout,
+		Transport: &http.Transport{
+			Dial: func(network, addr string) (net.Conn, error) {
+				return net.DialTimeout("unix", sock, containerTimeout)
+			},
+		},
+	}
+	var list []struct {
+		ID     string `json:"Id"`
+		Names  []string
+		Image  string
+		Mounts []struct {
+			Source string
+		}
+	}
+	err := containerAPIGet(client, "/containers/json", &list)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]containerInfo, 0)
+	for _, x := range list {
+		nc := containerInfo{ID: x.ID, Image: x.Image}
+		if len(x.Names) > 0 {
+			nc.Name = strings.TrimPrefix(x.Names[0], "/")
+		}
+		for _, y := range x.Mounts {
+			nc.Mounts = append(nc.Mounts, y.Source)
+		}
+		if inspect {
+			var details struct {
+				HostConfig struct {
+					Privileged bool
+				}
+			}
+			err = containerAPIGet(client, "/containers/"+x.ID+"/json", &details)
+			if err != nil {
+				return nil, err
+			}
+			nc.Privileged = details.HostConfig.Privileged
+		}
+		debugPrint("getContainers(): found %v (%v)\n", nc.Name, nc.Image)
+		ret = append(ret, nc)
+	}
+	return ret, nil
+}
+
+func containerAPIGet(client *http.Client, path string, v interface{}) error {
+	// The host portion of the URL is ignored as the transport always
+	// connects to the runtime socket.
+	resp, err := client.Get("http://localhost" + path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("container runtime returned %v for %v", resp.Status, path)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Functions and data related to container tests
+
+var testContainerTable = []containerInfo{
+	{"0001", "web", "registry.example.com/web:1.2", false, []string{"/srv/www"}},
+	{"0002", "agent", "docker.io/library/agent:latest", true, []string{"/", "/var/run/docker.sock"}},
+}
+
+func testGetContainers() []containerInfo {
+	ret := make([]containerInfo, 0)
+	ret = append(ret, testContainerTable...)
+	return ret
+}
@@ -0,0 +1,120 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"testing"
+)
+
+// Used in TestContainerPolicy
+var containerPolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "privileged",
+		"container": {
+			"property": "privileged"
+		}
+	},
+
+	{
+		"object": "web-image",
+		"container": {
+			"property": "image",
+			"name": "^web$"
+		}
+	},
+
+	{
+		"object": "mounts",
+		"container": {
+			"property": "mount"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "container0",
+		"expectedresult": true,
+		"object": "privileged",
+		"exactmatch": {
+			"value": "true"
+		}
+	},
+
+	{
+		"test": "container1",
+		"expectedresult": false,
+		"object": "web-image",
+		"regexp": {
+			"value": "^docker\\.io/"
+		}
+	},
+
+	{
+		"test": "container2",
+		"expectedresult": true,
+		"object": "mounts",
+		"exactmatch": {
+			"value": "/var/run/docker.sock"
+		}
+	}
+	]
+}
+`
+
+func TestContainerPolicy(t *testing.T) {
+	genericTestExec(t, containerPolicyDoc)
+}
+
+// Used in TestCloudPolicy
+var cloudMetadataPolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "imdsv2",
+		"cloud": {
+			"field": "imdsv2"
+		}
+	},
+
+	{
+		"object": "environment",
+		"cloud": {
+			"field": "tag",
+			"tag": "environment"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "cloud0",
+		"expectedresult": true,
+		"object": "imdsv2",
+		"exactmatch": {
+			"value": "true"
+		}
+	},
+
+	{
+		"test": "cloud1",
+		"expectedresult": true,
+		"object": "environment",
+		"exactmatch": {
+			"value": "production"
+		}
+	}
+	]
+}
+`
+
+func TestCloudPolicy(t *testing.T) {
+	genericTestExec(t, cloudMetadataPolicyDoc)
+}
@@ -0,0 +1,120 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"sort"
+)
+
+// CoverageReport describes the coverage of a document, as returned by
+// Coverage(). It can be used by maintainers of large documents to identify
+// unused objects and tests that are missing evaluation criteria, and to
+// review which areas of the host the document inspects.
+type CoverageReport struct {
+	UnusedObjects []string `json:"unusedobjects" yaml:"unusedobjects"` // Objects not referenced by any test or chain.
+	NoEvaluation  []string `json:"noevaluation" yaml:"noevaluation"`   // Tests with no evaluation criteria.
+	Paths         []string `json:"paths" yaml:"paths"`                 // File system paths inspected by objects.
+	Packages      []string `json:"packages" yaml:"packages"`           // Packages inspected by objects.
+}
+
+// Coverage analyzes the document and returns a CoverageReport. The
+// document does not need to have been analyzed.
+func (d *Document) Coverage() CoverageReport {
+	ret := CoverageReport{
+		UnusedObjects: make([]string, 0),
+		NoEvaluation:  make([]string, 0),
+		Paths:         make([]string, 0),
+		Packages:      make([]string, 0),
+	}
+
+	used := make(map[string]bool)
+	for i := range d.Tests {
+		used[d.Tests[i].Object] = true
+		if _, ok := d.Tests[i].getEvaluationInterface().(*noop); ok {
+			ret.NoEvaluation = append(ret.NoEvaluation, d.Tests[i].TestID)
+		}
+	}
+	paths := make(map[string]bool)
+	pkgs := make(map[string]bool)
+	for i := range d.Objects {
+		o := &d.Objects[i]
+		if o.FileContent.Path != "" {
+			for _, x := range o.FileContent.ImportChain {
+				used[x] = true
+			}
+		}
+		switch s := o.getSourceInterface().(type) {
+		case *FileContent:
+			addRoots(paths, variableExpansion(d.Variables, s.Path))
+		case *FileName:
+			addRoots(paths, variableExpansion(d.Variables, s.Path))
+		case *HasLine:
+			addRoots(paths, variableExpansion(d.Variables, s.Path))
+		case *ELF:
+			addRoots(paths, variableExpansion(d.Variables, s.Path))
+		case *JAR:
+			addRoots(paths, variableExpansion(d.Variables, s.Path))
+		case *FileStat:
+			addRoots(paths, variableExpansion(d.Variables, s.Path))
+		case *FileAttr:
+			addRoots(paths, variableExpansion(d.Variables, s.Path))
+		case *Plist:
+			addRoots(paths, variableExpansion(d.Variables, s.Path))
+		case *FileHash:
+			addRoots(paths, variableExpansion(d.Variables, s.Path))
+		case *ConfigKV:
+			addRoots(paths, variableExpansion(d.Variables, s.Path))
+		case *ConfigQuery:
+			addRoots(paths, variableExpansion(d.Variables, s.Path))
+		case *XML:
+			addRoots(paths, variableExpansion(d.Variables, s.Path))
+		case *PAM:
+			if s.Path == "" {
+				paths[defaultPAMPath] = true
+			} else {
+				paths[variableExpansion(d.Variables, s.Path)] = true
+			}
+		case *WASM:
+			for _, x := range s.Files {
+				addRoots(paths, variableExpansion(d.Variables, x))
+			}
+		case *Pkg:
+			if s.CollectMatch != "" {
+				pkgs[s.CollectMatch] = true
+			} else {
+				pkgs[variableExpansion(d.Variables, s.Name)] = true
+			}
+		}
+	}
+	for i := range d.Objects {
+		if !used[d.Objects[i].Object] {
+			ret.UnusedObjects = append(ret.UnusedObjects, d.Objects[i].Object)
+		}
+	}
+	for x := range paths {
+		// Chain objects reference paths relative to the root object,
+		// these are already covered by the root object.
+		if hasChainVariables(x) {
+			continue
+		}
+		ret.Paths = append(ret.Paths, x)
+	}
+	for x := range pkgs {
+		ret.Packages = append(ret.Packages, x)
+	}
+	sort.Strings(ret.Paths)
+	sort.Strings(ret.Packages)
+	return ret
+}
+
+// Add each root listed in the path of a filesystem based object to paths.
+func addRoots(paths map[string]bool, p string) {
+	for _, x := range locatorRoots(p) {
+		paths[x] = true
+	}
+}
@@ -0,0 +1,130 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Documents can be encrypted at rest for cases where the policy itself is
+// sensitive, for example if it reveals detection logic or the location of
+// sensitive data. An encrypted document consists of encryptedDocumentPrefix
+// followed by the base64 encoded nonce and AES-256-GCM ciphertext of the
+// document. Encrypted documents are decrypted transparently by
+// LoadDocument().
+const encryptedDocumentPrefix = "scribe-aesgcm-v1:"
+
+// DocumentKeyEnv is the environment variable the document key is read from
+// if no key function has been installed using SetDocumentKeyFunc(). The
+// value is the base64 encoded 32 byte key.
+const DocumentKeyEnv = "SCRIBE_DOCUMENT_KEY"
+
+// SetDocumentKeyFunc installs a function that returns the key used to
+// encrypt and decrypt documents, for example to fetch the key from a key
+// management service. Passing nil restores the default, where the key is
+// read from the environment variable named by DocumentKeyEnv.
+func SetDocumentKeyFunc(f func() ([]byte, error)) {
+	sRuntime.documentKey = f
+}
+
+func documentKey() ([]byte, error) {
+	var (
+		key []byte
+		err error
+	)
+	if sRuntime.documentKey != nil {
+		key, err = sRuntime.documentKey()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		v := os.Getenv(DocumentKeyEnv)
+		if v == "" {
+			return nil, fmt.Errorf("document is encrypted and %v is not set", DocumentKeyEnv)
+		}
+		key, err = base64.StdEncoding.DecodeString(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("invalid document key: %v", err)
+		}
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("document key must be 32 bytes")
+	}
+	return key, nil
+}
+
+func documentCipher() (cipher.AEAD, error) {
+	key, err := documentKey()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptDocument reads a document from r, and writes the document
+// encrypted using the document key to w.
+func EncryptDocument(w io.Writer, r io.Reader) error {
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if isEncryptedDocument(buf) {
+		return fmt.Errorf("document is already encrypted")
+	}
+	gcm, err := documentCipher()
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return err
+	}
+	sealed := gcm.Seal(nonce, nonce, buf, []byte(encryptedDocumentPrefix))
+	_, err = fmt.Fprintf(w, "%v%v\n", encryptedDocumentPrefix,
+		base64.StdEncoding.EncodeToString(sealed))
+	return err
+}
+
+func isEncryptedDocument(b []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(b), []byte(encryptedDocumentPrefix))
+}
+
+func decryptDocument(b []byte) ([]byte, error) {
+	b = bytes.TrimPrefix(bytes.TrimSpace(b), []byte(encryptedDocumentPrefix))
+	sealed, err := base64.StdEncoding.DecodeString(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("invalid encrypted document: %v", err)
+	}
+	gcm, err := documentCipher()
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid encrypted document")
+	}
+	nonce := sealed[:gcm.NonceSize()]
+	ret, err := gcm.Open(nil, nonce, sealed[gcm.NonceSize():], []byte(encryptedDocumentPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt document: %v", err)
+	}
+	return ret, nil
+}
@@ -0,0 +1,58 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mozilla/scribe"
+)
+
+func TestDocumentEncryption(t *testing.T) {
+	key := bytes.Repeat([]byte{0x42}, 32)
+	scribe.SetDocumentKeyFunc(func() ([]byte, error) { return key, nil })
+	defer scribe.SetDocumentKeyFunc(nil)
+
+	var buf bytes.Buffer
+	err := scribe.EncryptDocument(&buf, strings.NewReader(setPolicyDoc))
+	if err != nil {
+		t.Fatalf("scribe.EncryptDocument: %v", err)
+	}
+	if strings.Contains(buf.String(), "bash-users") {
+		t.Fatalf("encrypted document contains plaintext")
+	}
+	enc := buf.String()
+
+	doc, err := scribe.LoadDocument(strings.NewReader(enc))
+	if err != nil {
+		t.Fatalf("scribe.LoadDocument: %v", err)
+	}
+	if len(doc.Tests) != 6 {
+		t.Fatalf("decrypted document has %v tests", len(doc.Tests))
+	}
+
+	// A different key must not decrypt the document.
+	key = bytes.Repeat([]byte{0x43}, 32)
+	_, err = scribe.LoadDocument(strings.NewReader(enc))
+	if err == nil {
+		t.Fatalf("scribe.LoadDocument should have failed with incorrect key")
+	}
+
+	// Without a key function, the key is read from the environment.
+	scribe.SetDocumentKeyFunc(nil)
+	os.Setenv(scribe.DocumentKeyEnv, base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{0x42}, 32)))
+	defer os.Unsetenv(scribe.DocumentKeyEnv)
+	_, err = scribe.LoadDocument(strings.NewReader(enc))
+	if err != nil {
+		t.Fatalf("scribe.LoadDocument with environment key: %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Evaluator is implemented by custom evaluation types, so applications can
+// add comparison logic scribe does not provide, such as an internal
+// version scheme. Evaluate returns true if the value returned by an object
+// for identifier satisfies the test.
+type Evaluator interface {
+	Evaluate(identifier string, value string) (bool, error)
+}
+
+// EvaluatorFactory returns an Evaluator for a test, params being the JSON
+// encoding of the parameters in the test (null if the test has none). The
+// factory would typically unmarshal params into its own parameter struct,
+// returning an error if they are not valid, which causes the document to
+// fail to load.
+type EvaluatorFactory func(params []byte) (Evaluator, error)
+
+// CustomTest is used to evaluate criteria using an evaluator registered with
+// RegisterEvaluator(). Type is the name the evaluator was registered with,
+// and Parameters are passed to the evaluator factory when the document is
+// loaded.
+type CustomTest struct {
+	Type       string      `json:"type,omitempty" yaml:"type,omitempty"`
+	Parameters interface{} `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+
+	ev Evaluator
+}
+
+// RegisterEvaluator installs an evaluator factory that tests can reference
+// by name using the custom evaluator, for documents loaded after the call.
+// Registering a factory with the name of an existing one replaces it.
+// Passing a nil factory removes it.
+func RegisterEvaluator(name string, f EvaluatorFactory) {
+	sRuntime.evaluatorLock.Lock()
+	defer sRuntime.evaluatorLock.Unlock()
+	if f == nil {
+		delete(sRuntime.evaluators, name)
+		return
+	}
+	if sRuntime.evaluators == nil {
+		sRuntime.evaluators = make(map[string]EvaluatorFactory)
+	}
+	sRuntime.evaluators[name] = f
+}
+
+func getEvaluatorFactory(name string) (EvaluatorFactory, bool) {
+	sRuntime.evaluatorLock.Lock()
+	defer sRuntime.evaluatorLock.Unlock()
+	f, ok := sRuntime.evaluators[name]
+	return f, ok
+}
+
+// Return the names of the registered evaluators, sorted.
+func customEvaluators() []string {
+	sRuntime.evaluatorLock.Lock()
+	defer sRuntime.evaluatorLock.Unlock()
+	ret := make([]string, 0, len(sRuntime.evaluators))
+	for k := range sRuntime.evaluators {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func (c *CustomTest) validate() error {
+	f, ok := getEvaluatorFactory(c.Type)
+	if !ok {
+		return fmt.Errorf("custom evaluator \"%v\" is not registered", c.Type)
+	}
+	// Parameters from YAML documents can contain maps with keys that
+	// can not be encoded as JSON.
+	buf, err := json.Marshal(yamlNormalize(c.Parameters))
+	if err != nil {
+		return fmt.Errorf("custom evaluator %v: %v", c.Type, err)
+	}
+	c.ev, err = f(buf)
+	if err != nil {
+		return fmt.Errorf("custom evaluator %v: %v", c.Type, err)
+	}
+	if c.ev == nil {
+		return fmt.Errorf("custom evaluator %v: factory returned no evaluator", c.Type)
+	}
+	return nil
+}
+
+func (c *CustomTest) evaluate(cr evaluationCriteria) (ret evaluationResult, err error) {
+	debugPrint("evaluate(): custom %v \"%v\", \"%v\"\n", c.Type, cr.identifier, cr.testValue)
+	ret.criteria = cr
+	if c.ev == nil {
+		return ret, fmt.Errorf("custom evaluator %v has not been validated", c.Type)
+	}
+	ret.result, err = c.ev.Evaluate(cr.identifier, cr.testValue)
+	if err != nil {
+		return ret, fmt.Errorf("%v: %v", cr.identifier, err)
+	}
+	return ret, nil
+}
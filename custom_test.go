@@ -0,0 +1,171 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mozilla/scribe"
+)
+
+// An evaluator for release names in the form R<year>.<quarter>, returning
+// true for releases at or after a minimum release.
+type releaseEvaluator struct {
+	Minimum string `json:"minimum"`
+
+	year, quarter int
+}
+
+func parseRelease(s string) (int, int, error) {
+	var y, q int
+	_, err := fmt.Sscanf(s, "R%d.%d", &y, &q)
+	if err != nil || q < 1 || q > 4 {
+		return 0, 0, fmt.Errorf("invalid release %q", s)
+	}
+	return y, q, nil
+}
+
+func newReleaseEvaluator(params []byte) (scribe.Evaluator, error) {
+	ret := &releaseEvaluator{}
+	err := json.Unmarshal(params, ret)
+	if err != nil {
+		return nil, err
+	}
+	ret.year, ret.quarter, err = parseRelease(ret.Minimum)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (r *releaseEvaluator) Evaluate(identifier string, value string) (bool, error) {
+	y, q, err := parseRelease(value)
+	if err != nil {
+		return false, err
+	}
+	return y > r.year || (y == r.year && q >= r.quarter), nil
+}
+
+// Used in TestCustomEvaluator
+var customEvaluatorDoc = `
+{
+	"objects": [
+	{
+		"object": "releases",
+		"raw": {
+			"identifiers": [
+			{ "identifier": "web", "value": "R2023.4" },
+			{ "identifier": "db", "value": "R2022.2" }
+			]
+		}
+	},
+
+	{
+		"object": "badrelease",
+		"raw": {
+			"identifiers": [
+			{ "identifier": "cache", "value": "2023.1" }
+			]
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "custom0",
+		"expectedresult": true,
+		"object": "releases",
+		"custom": {
+			"type": "release",
+			"parameters": { "minimum": "R2023.1" }
+		}
+	},
+
+	{
+		"test": "custom1",
+		"expectedresult": false,
+		"object": "releases",
+		"custom": {
+			"type": "release",
+			"parameters": { "minimum": "R2024.1" }
+		}
+	},
+
+	{
+		"test": "custom2",
+		"expecterror": true,
+		"object": "badrelease",
+		"custom": {
+			"type": "release",
+			"parameters": { "minimum": "R2023.1" }
+		}
+	}
+	]
+}
+`
+
+// Used in TestCustomEvaluator
+var customEvaluatorYAMLDoc = `
+objects:
+- object: releases
+  raw:
+    identifiers:
+    - identifier: web
+      value: R2023.4
+tests:
+- test: custom0
+  expectedresult: true
+  object: releases
+  custom:
+    type: release
+    parameters:
+      minimum: R2023.3
+`
+
+func TestCustomEvaluator(t *testing.T) {
+	scribe.RegisterEvaluator("release", newReleaseEvaluator)
+	defer scribe.RegisterEvaluator("release", nil)
+
+	doc := genericTestExec(t, customEvaluatorDoc)
+	genericTestExec(t, customEvaluatorYAMLDoc)
+
+	e, err := doc.ExplainTest("custom0")
+	if err != nil {
+		t.Fatalf("Document.ExplainTest: %v", err)
+	}
+	if e.Evaluator != "custom" || len(e.Criteria) != 2 ||
+		e.Criteria[0].Reason != "custom evaluator release returned true" {
+		t.Fatalf("unexpected explanation %+v", e)
+	}
+
+	found := false
+	for _, x := range scribe.GetCapabilities().Evaluators {
+		if x.Name == "custom:release" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("custom evaluator not included in capabilities")
+	}
+
+	// Invalid parameters, and evaluators that are not registered, cause
+	// the document to fail to load.
+	bad := strings.Replace(customEvaluatorDoc, "R2024.1", "2024", 1)
+	_, err = scribe.LoadDocument(strings.NewReader(bad))
+	if err == nil || !strings.Contains(err.Error(), "invalid release") {
+		t.Fatalf("document with invalid parameters loaded: %v", err)
+	}
+	scribe.RegisterEvaluator("release", nil)
+	_, err = scribe.LoadDocument(strings.NewReader(customEvaluatorDoc))
+	if err == nil || !strings.Contains(err.Error(), `"release" is not registered`) {
+		t.Fatalf("document with unregistered evaluator loaded: %v", err)
+	}
+}
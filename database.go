@@ -0,0 +1,224 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Database is used to perform tests against the results of a query run
+// against a local database, for example to check for database users
+// without a password.
+//
+// Driver is the name of the database/sql driver used to connect to the
+// database, such as postgres or mysql. The driver must be registered by the
+// program using scribe; the scribe command registers the postgres driver.
+//
+// The data source name used to connect is set using DSN, or if it contains
+// credentials is obtained from the secret named by DSNSecret so
+// the credentials are kept out of the document. The DSN format depends on
+// the driver.
+//
+// Query is run in a read only transaction, and must be a SELECT, SHOW or
+// WITH statement. Each cell in the result becomes a criteria, with the
+// value of the cell as the test value. If IdentifierColumn is set the
+// identifier is the value of that column in the row followed by a colon and
+// the name of the column, otherwise the row number (starting at 1) is used
+// in place of the column value. The identifier column is not returned as a
+// criteria unless it is the only column. NULL values are returned as null.
+//
+// Timeout is the maximum time the query can run for, as a duration such as
+// 10s. The default is 30 seconds, or the timeout set using
+// SetSourceTimeout().
+type Database struct {
+	Driver           string `json:"driver,omitempty" yaml:"driver,omitempty"`
+	DSN              string `json:"dsn,omitempty" yaml:"dsn,omitempty"`
+	DSNSecret        string `json:"dsnsecret,omitempty" yaml:"dsnsecret,omitempty"`
+	Query            string `json:"query,omitempty" yaml:"query,omitempty"`
+	IdentifierColumn string `json:"identifiercolumn,omitempty" yaml:"identifiercolumn,omitempty"`
+	Timeout          string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+
+	matches []databaseMatch
+}
+
+type databaseMatch struct {
+	identifier string
+	value      string
+}
+
+const defaultDatabaseTimeout = 30 * time.Second
+
+func (db *Database) isChain() bool {
+	return false
+}
+
+func (db *Database) fireChains(d *Document) ([]evaluationCriteria, error) {
+	return nil, nil
+}
+
+func (db *Database) mergeCriteria(c []evaluationCriteria) {
+}
+
+func (db *Database) validate(d *Document) error {
+	if len(db.Driver) == 0 {
+		return fmt.Errorf("database driver must be set")
+	}
+	if (db.DSN == "") == (db.DSNSecret == "") {
+		return fmt.Errorf("database must set one of dsn or dsnsecret")
+	}
+	if len(db.Query) == 0 {
+		return fmt.Errorf("database query must be set")
+	}
+	if !readOnlyQuery(db.Query) {
+		return fmt.Errorf("database query must be a SELECT, SHOW or WITH statement")
+	}
+	if db.Timeout != "" {
+		_, err := time.ParseDuration(db.Timeout)
+		if err != nil {
+			return fmt.Errorf("database timeout: %v", err)
+		}
+	}
+	return nil
+}
+
+// Return true if the query is a statement that only reads data. This is in
+// addition to the query being run in a read only transaction.
+func readOnlyQuery(q string) bool {
+	f := strings.Fields(q)
+	if len(f) == 0 {
+		return false
+	}
+	switch strings.ToUpper(f[0]) {
+	case "SELECT", "SHOW", "WITH":
+		return !strings.Contains(strings.TrimSuffix(strings.TrimSpace(q), ";"), ";")
+	}
+	return false
+}
+
+func (db *Database) expandVariables(v []Variable) {
+	db.DSN = variableExpansion(v, db.DSN)
+}
+
+func (db *Database) getCriteria() (ret []evaluationCriteria) {
+	for _, x := range db.matches {
+		n := evaluationCriteria{}
+		n.identifier = x.identifier
+		n.testValue = x.value
+		ret = append(ret, n)
+	}
+	return ret
+}
+
+// Return the data source name used to connect to the database.
+func (db *Database) dsn() (string, error) {
+	if db.DSNSecret != "" {
+		return secretValue(db.DSNSecret)
+	}
+	return db.DSN, nil
+}
+
+func (db *Database) prepare() error {
+	debugPrint("prepare(): running %v query \"%v\"\n", db.Driver, db.Query)
+
+	found := false
+	for _, x := range sql.Drivers() {
+		if x == db.Driver {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("database driver %v is not available", db.Driver)
+	}
+	dsn, err := db.dsn()
+	if err != nil {
+		return err
+	}
+	timeout := sourceTimeout(defaultDatabaseTimeout)
+	if db.Timeout != "" {
+		timeout, err = time.ParseDuration(db.Timeout)
+		if err != nil {
+			return err
+		}
+	}
+
+	conn, err := sql.Open(db.Driver, dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	// The transaction is always rolled back, nothing is ever committed.
+	defer tx.Rollback()
+	rows, err := tx.QueryContext(ctx, db.Query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	idcol := -1
+	if db.IdentifierColumn != "" {
+		for i, x := range cols {
+			if x == db.IdentifierColumn {
+				idcol = i
+				break
+			}
+		}
+		if idcol == -1 {
+			return fmt.Errorf("query result has no column %v", db.IdentifierColumn)
+		}
+	}
+	rowno := 0
+	for rows.Next() {
+		rowno++
+		vals := make([]sql.NullString, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		err = rows.Scan(ptrs...)
+		if err != nil {
+			return err
+		}
+		rowid := strconv.Itoa(rowno)
+		if idcol != -1 {
+			rowid = databaseValue(vals[idcol])
+		}
+		for i, x := range cols {
+			// The identifier column is only returned as a criteria
+			// if it is the only column.
+			if i == idcol && len(cols) > 1 {
+				continue
+			}
+			m := databaseMatch{identifier: rowid + ":" + x, value: databaseValue(vals[i])}
+			debugPrint("prepare(): %v = \"%v\"\n", m.identifier, m.value)
+			db.matches = append(db.matches, m)
+		}
+	}
+	return rows.Err()
+}
+
+func databaseValue(v sql.NullString) string {
+	if !v.Valid {
+		return "null"
+	}
+	return v.String
+}
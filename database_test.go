@@ -0,0 +1,196 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mozilla/scribe"
+)
+
+// A database/sql driver returning a fixed result for any query, used to
+// test the database source without a database server.
+type testDBDriver struct{}
+
+type testDBConn struct{}
+
+type testDBRows struct {
+	n int
+}
+
+var testDBColumns = []string{"user", "host", "password"}
+
+var testDBResult = [][]driver.Value{
+	{"root", "localhost", "*81F5E21E35407D884A6CD4A731AEBFB6AF209E1B"},
+	{"backup", "%", ""},
+	{"app", "10.0.0.1", nil},
+}
+
+var testDBQueries []string
+
+func (d testDBDriver) Open(dsn string) (driver.Conn, error) {
+	if dsn != "user=scribe" {
+		return nil, fmt.Errorf("unexpected dsn %q", dsn)
+	}
+	return testDBConn{}, nil
+}
+
+func (c testDBConn) Prepare(q string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("not supported")
+}
+
+func (c testDBConn) Close() error {
+	return nil
+}
+
+func (c testDBConn) Begin() (driver.Tx, error) {
+	return nil, fmt.Errorf("not supported")
+}
+
+func (c testDBConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if !opts.ReadOnly {
+		return nil, fmt.Errorf("transaction is not read only")
+	}
+	return c, nil
+}
+
+func (c testDBConn) Commit() error {
+	return fmt.Errorf("transaction should not be committed")
+}
+
+func (c testDBConn) Rollback() error {
+	return nil
+}
+
+func (c testDBConn) QueryContext(ctx context.Context, q string, args []driver.NamedValue) (driver.Rows, error) {
+	testDBQueries = append(testDBQueries, q)
+	return &testDBRows{}, nil
+}
+
+func (r *testDBRows) Columns() []string {
+	return testDBColumns
+}
+
+func (r *testDBRows) Close() error {
+	return nil
+}
+
+func (r *testDBRows) Next(dest []driver.Value) error {
+	if r.n >= len(testDBResult) {
+		return io.EOF
+	}
+	copy(dest, testDBResult[r.n])
+	r.n++
+	return nil
+}
+
+func init() {
+	sql.Register("scribetest", testDBDriver{})
+}
+
+var databasePolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "users",
+		"database": {
+			"driver": "scribetest",
+			"dsnsecret": "testdsn",
+			"query": "SELECT user, host, password FROM mysql.user",
+			"identifiercolumn": "user"
+		}
+	},
+
+	{
+		"object": "rows",
+		"database": {
+			"driver": "scribetest",
+			"dsn": "user=scribe",
+			"query": "SELECT user, host, password FROM mysql.user;"
+		}
+	},
+
+	{
+		"object": "nodriver",
+		"database": {
+			"driver": "nodriver",
+			"dsn": "user=scribe",
+			"query": "SELECT 1"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "emptypassword",
+		"object": "users",
+		"expectedresult": true,
+		"exactmatch": { "value": "" }
+	},
+
+	{
+		"test": "nodriver",
+		"object": "nodriver",
+		"expecterror": true
+	}
+	]
+}
+`
+
+func TestDatabasePolicy(t *testing.T) {
+	os.Setenv("SCRIBE_TEST_DSN", "user=scribe")
+	defer os.Unsetenv("SCRIBE_TEST_DSN")
+	err := scribe.SetSecrets([]scribe.Secret{{Name: "testdsn", Provider: "env", Key: "SCRIBE_TEST_DSN"}})
+	if err != nil {
+		t.Fatalf("scribe.SetSecrets: %v", err)
+	}
+	defer scribe.SetSecrets(nil)
+	doc := genericTestExec(t, databasePolicyDoc)
+	expect := map[string][]string{
+		"users": {"root:host=localhost",
+			"root:password=*81F5E21E35407D884A6CD4A731AEBFB6AF209E1B",
+			"backup:host=%", "backup:password=", "app:host=10.0.0.1",
+			"app:password=null"},
+		"rows": {"1:user=root", "1:host=localhost",
+			"1:password=*81F5E21E35407D884A6CD4A731AEBFB6AF209E1B",
+			"2:user=backup", "2:host=%", "2:password=", "3:user=app",
+			"3:host=10.0.0.1", "3:password=null"},
+	}
+	for name, exp := range expect {
+		c, err := doc.EvaluateObject(name)
+		if err != nil {
+			t.Fatalf("EvaluateObject: %v", err)
+		}
+		got := make([]string, 0)
+		for _, x := range c {
+			got = append(got, x.Identifier+"="+x.Value)
+		}
+		if strings.Join(got, " ") != strings.Join(exp, " ") {
+			t.Fatalf("%v: unexpected criteria %v", name, got)
+		}
+	}
+}
+
+func TestDatabaseReadOnlyQuery(t *testing.T) {
+	docstr := `{"objects": [{"object": "o", "database": {"driver": "scribetest", ` +
+		`"dsn": "user=scribe", "query": %q}}]}`
+	for _, q := range []string{"DELETE FROM mysql.user", "SELECT 1; DROP TABLE x",
+		"update t set a = 1"} {
+		_, err := scribe.LoadDocument(strings.NewReader(fmt.Sprintf(docstr, q)))
+		if err == nil {
+			t.Fatalf("query %q should not have been accepted", q)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+// SetDeduplication enables or disables deduplication of criteria.
+//
+// Chains and overlapping objects can return the same criteria more than
+// once, for example where a file is reached through several chained paths.
+// By default criteria with the same identifier and value are evaluated
+// once, so such duplicates do not inflate the number of sub-results for a
+// test. The first occurrence of each criteria is kept, in the order
+// returned by the object. Passing false evaluates every criteria the
+// object returns.
+func SetDeduplication(f bool) {
+	sRuntime.noDedup = !f
+}
+
+// Return criteria with duplicates removed, unless deduplication is
+// disabled.
+func dedupCriteria(criteria []evaluationCriteria) []evaluationCriteria {
+	if sRuntime.noDedup || len(criteria) < 2 {
+		return criteria
+	}
+	type key struct {
+		identifier string
+		value      string
+	}
+	seen := make(map[key]bool, len(criteria))
+	ret := make([]evaluationCriteria, 0, len(criteria))
+	for _, x := range criteria {
+		k := key{x.identifier, x.testValue}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		ret = append(ret, x)
+	}
+	if n := len(criteria) - len(ret); n > 0 {
+		debugPrint("dedupCriteria(): removed %v duplicate criteria\n", n)
+	}
+	return ret
+}
@@ -0,0 +1,72 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"testing"
+
+	"github.com/mozilla/scribe"
+)
+
+// Used in TestDeduplication
+var dedupDoc = `
+{
+	"objects": [
+	{
+		"object": "users",
+		"raw": {
+			"identifiers": [
+			{ "identifier": "/etc/passwd", "value": "root" },
+			{ "identifier": "/etc/passwd", "value": "daemon" },
+			{ "identifier": "/etc/passwd", "value": "root" },
+			{ "identifier": "/etc/shadow", "value": "root" }
+			]
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "dedup0",
+		"expectedresult": true,
+		"object": "users",
+		"regexp": {
+			"value": "^root$"
+		}
+	}
+	]
+}
+`
+
+func TestDeduplication(t *testing.T) {
+	for _, x := range []struct {
+		dedup   bool
+		total   int
+		matched int
+	}{
+		{true, 3, 2},
+		{false, 4, 3},
+	} {
+		scribe.SetDeduplication(x.dedup)
+		doc := genericTestExec(t, dedupDoc)
+		tr, err := scribe.GetResults(doc, "dedup0")
+		if err != nil {
+			t.Fatalf("scribe.GetResults: %v", err)
+		}
+		ntrue := 0
+		for _, y := range tr.Results {
+			if y.Result {
+				ntrue++
+			}
+		}
+		if len(tr.Results) != x.total || ntrue != x.matched {
+			t.Fatalf("deduplication %v: %v sub-results with %v true", x.dedup, len(tr.Results), ntrue)
+		}
+	}
+	scribe.SetDeduplication(true)
+}
@@ -0,0 +1,79 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+)
+
+// DescriptionData is the data available to templates in test descriptions
+// and remediation text.
+//
+// Descriptions and remediation text can reference values matched by the
+// test using text/template syntax, for example
+// "found {{.Identifier}} with value {{.TestValue}}". Identifier and
+// TestValue are taken from the first result that had the same outcome as the
+// test, so for a test that evaluates to false they describe a value that
+// did not meet the criteria. Results contains all results for the test.
+type DescriptionData struct {
+	TestID     string
+	Identifier string
+	TestValue  string
+	Results    []DescriptionResult
+}
+
+// DescriptionResult describes an individual result in DescriptionData.
+type DescriptionResult struct {
+	Identifier string
+	TestValue  string
+	Result     bool
+}
+
+func newDescriptionData(t *Test) DescriptionData {
+	ret := DescriptionData{TestID: t.TestID}
+	found := false
+	for _, x := range t.results {
+		ret.Results = append(ret.Results, DescriptionResult{
+			Identifier: x.criteria.identifier,
+			TestValue:  x.criteria.testValue,
+			Result:     x.result,
+		})
+		if !found && x.result == t.masterResult {
+			ret.Identifier = x.criteria.identifier
+			ret.TestValue = x.criteria.testValue
+			found = true
+		}
+	}
+	if !found && len(t.results) > 0 {
+		ret.Identifier = t.results[0].criteria.identifier
+		ret.TestValue = t.results[0].criteria.testValue
+	}
+	return ret
+}
+
+// Render s as a template using the results of test t. If s is not a
+// template or can not be rendered it is returned unmodified.
+func describeTest(t *Test, s string) string {
+	if !strings.Contains(s, "{{") {
+		return s
+	}
+	tmpl, err := template.New(t.TestID).Option("missingkey=zero").Parse(s)
+	if err != nil {
+		debugPrint("describeTest(): %v: %v\n", t.TestID, err)
+		return s
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, newDescriptionData(t))
+	if err != nil {
+		debugPrint("describeTest(): %v: %v\n", t.TestID, err)
+		return s
+	}
+	return buf.String()
+}
@@ -0,0 +1,230 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DocumentDiff describes the differences between two versions of a
+// document, as returned by DiffDocuments().
+type DocumentDiff struct {
+	Variables []ItemDiff `json:"variables,omitempty"`
+	Tables    []ItemDiff `json:"tables,omitempty"`
+	Objects   []ItemDiff `json:"objects,omitempty"`
+	Tests     []ItemDiff `json:"tests,omitempty"`
+}
+
+// ItemDiff describes a variable, table, object or test that was added,
+// removed or modified. For modified items Fields lists the fields that
+// changed.
+type ItemDiff struct {
+	Name   string      `json:"name"`
+	Change string      `json:"change"` // added, removed or modified
+	Fields []FieldDiff `json:"fields,omitempty"`
+}
+
+// FieldDiff describes a changed field. Field is the path of the field
+// using the names in the JSON form of the document, such as
+// filecontent.expression, and Old and New are its values, empty if the
+// field is not set.
+type FieldDiff struct {
+	Field string `json:"field"`
+	Old   string `json:"old,omitempty"`
+	New   string `json:"new,omitempty"`
+}
+
+// DiffDocuments compares document a with a later version b, returning the
+// variables, tables, objects and tests that were added, removed or
+// modified. Items are matched by name, so the order they are written in
+// and the format of the documents (JSON or YAML) do not affect the result,
+// and fields that are not set are equivalent to fields set to their zero
+// value. Generators are compared by the tests and objects they expand to.
+func DiffDocuments(a *Document, b *Document) (DocumentDiff, error) {
+	var ret DocumentDiff
+	old, new := a.itemsByName(), b.itemsByName()
+	for i, x := range []*[]ItemDiff{&ret.Variables, &ret.Tables, &ret.Objects, &ret.Tests} {
+		var err error
+		*x, err = diffItems(old[i], new[i])
+		if err != nil {
+			return ret, err
+		}
+	}
+	return ret, nil
+}
+
+// Return the variables, tables, objects and tests of the document keyed by
+// name.
+func (d *Document) itemsByName() [4]map[string]interface{} {
+	ret := [4]map[string]interface{}{}
+	for i := range ret {
+		ret[i] = make(map[string]interface{})
+	}
+	for _, x := range d.Variables {
+		ret[0][x.Key] = x
+	}
+	for _, x := range d.Tables {
+		ret[1][x.Name] = x
+	}
+	for _, x := range d.Objects {
+		ret[2][x.Object] = x
+	}
+	for _, x := range d.Tests {
+		ret[3][x.TestID] = x
+	}
+	return ret
+}
+
+// Empty returns true if the documents compared are equivalent.
+func (d DocumentDiff) Empty() bool {
+	return len(d.Variables) == 0 && len(d.Tables) == 0 && len(d.Objects) == 0 && len(d.Tests) == 0
+}
+
+// String returns the differences in a form suitable for display, with a
+// line for each item changed followed by the fields changed, and the old
+// and new values of each field prefixed with - and +.
+func (d DocumentDiff) String() string {
+	var b strings.Builder
+	for _, x := range []struct {
+		kind  string
+		items []ItemDiff
+	}{
+		{"variable", d.Variables},
+		{"table", d.Tables},
+		{"object", d.Objects},
+		{"test", d.Tests},
+	} {
+		for _, y := range x.items {
+			fmt.Fprintf(&b, "%v %v %v\n", x.kind, y.Name, y.Change)
+			for _, z := range y.Fields {
+				fmt.Fprintf(&b, "\t%v:\n", z.Field)
+				if z.Old != "" {
+					fmt.Fprintf(&b, "\t\t- %v\n", z.Old)
+				}
+				if z.New != "" {
+					fmt.Fprintf(&b, "\t\t+ %v\n", z.New)
+				}
+			}
+		}
+	}
+	return b.String()
+}
+
+// Compare the items in old and new, keyed by name, sorting the result by
+// name.
+func diffItems(old map[string]interface{}, new map[string]interface{}) ([]ItemDiff, error) {
+	names := make([]string, 0, len(old)+len(new))
+	for k := range old {
+		names = append(names, k)
+	}
+	for k := range new {
+		if _, ok := old[k]; !ok {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	var ret []ItemDiff
+	for _, x := range names {
+		o, inOld := old[x]
+		n, inNew := new[x]
+		if !inOld {
+			ret = append(ret, ItemDiff{Name: x, Change: "added"})
+			continue
+		}
+		if !inNew {
+			ret = append(ret, ItemDiff{Name: x, Change: "removed"})
+			continue
+		}
+		ofields, err := flattenFields(o)
+		if err != nil {
+			return nil, err
+		}
+		nfields, err := flattenFields(n)
+		if err != nil {
+			return nil, err
+		}
+		var fields []FieldDiff
+		for k, v := range ofields {
+			if nfields[k] != v {
+				fields = append(fields, FieldDiff{Field: k, Old: v, New: nfields[k]})
+			}
+		}
+		for k, v := range nfields {
+			if _, ok := ofields[k]; !ok {
+				fields = append(fields, FieldDiff{Field: k, New: v})
+			}
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		sort.Slice(fields, func(i, j int) bool { return fields[i].Field < fields[j].Field })
+		ret = append(ret, ItemDiff{Name: x, Change: "modified", Fields: fields})
+	}
+	return ret, nil
+}
+
+// Return the fields of the JSON encoding of v that are set, keyed by
+// their path. Nested objects are flattened, and lists and values other
+// than strings are represented by their JSON encoding.
+func flattenFields(v interface{}) (map[string]string, error) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	var m interface{}
+	err = dec.Decode(&m)
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]string)
+	var walk func(prefix string, v interface{}) error
+	walk = func(prefix string, v interface{}) error {
+		switch x := v.(type) {
+		case nil:
+		case map[string]interface{}:
+			for k, y := range x {
+				p := k
+				if prefix != "" {
+					p = prefix + "." + k
+				}
+				if err := walk(p, y); err != nil {
+					return err
+				}
+			}
+		case string:
+			if x != "" {
+				ret[prefix] = x
+			}
+		case bool:
+			if x {
+				ret[prefix] = "true"
+			}
+		case json.Number:
+			if x.String() != "0" {
+				ret[prefix] = x.String()
+			}
+		default:
+			if l, ok := x.([]interface{}); ok && len(l) == 0 {
+				return nil
+			}
+			buf, err := json.Marshal(x)
+			if err != nil {
+				return err
+			}
+			ret[prefix] = string(buf)
+		}
+		return nil
+	}
+	return ret, walk("", m)
+}
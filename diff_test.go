@@ -0,0 +1,129 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mozilla/scribe"
+)
+
+var diffOldDoc = `
+{
+	"variables": [
+	{ "key": "root", "value": "/etc" }
+	],
+
+	"objects": [
+	{
+		"object": "sshd-config",
+		"filecontent": {
+			"path": "${root}/ssh",
+			"file": "sshd_config",
+			"expression": "^PermitRootLogin\\s+(\\S+)"
+		}
+	},
+	{
+		"object": "telnet",
+		"package": { "name": "telnet" }
+	}
+	],
+
+	"tests": [
+	{
+		"test": "sshd-root-login",
+		"object": "sshd-config",
+		"exactmatch": { "value": "no" }
+	},
+	{
+		"test": "telnet-absent",
+		"object": "telnet",
+		"expectedresult": true
+	}
+	]
+}
+`
+
+// The same document in YAML, reordered, with the expression of an object
+// changed, a test added and a test removed.
+var diffNewDoc = `
+tests:
+- test: sshd-password
+  object: sshd-password
+  exactmatch:
+    value: "no"
+- test: sshd-root-login
+  object: sshd-config
+  exactmatch:
+    value: "no"
+  owner: platform
+objects:
+- object: telnet
+  package:
+    name: telnet
+- object: sshd-password
+  filecontent:
+    path: ${root}/ssh
+    file: sshd_config
+    expression: ^PasswordAuthentication\s+(\S+)
+- object: sshd-config
+  filecontent:
+    file: sshd_config
+    path: ${root}/ssh
+    expression: ^(?i)PermitRootLogin\s+(\S+)
+variables:
+- key: root
+  value: /etc
+`
+
+func TestDiffDocuments(t *testing.T) {
+	old, err := scribe.LoadDocument(strings.NewReader(diffOldDoc))
+	if err != nil {
+		t.Fatalf("scribe.LoadDocument: %v", err)
+	}
+	new, err := scribe.LoadDocument(strings.NewReader(diffNewDoc))
+	if err != nil {
+		t.Fatalf("scribe.LoadDocument: %v", err)
+	}
+
+	d, err := scribe.DiffDocuments(&old, &old)
+	if err != nil {
+		t.Fatalf("scribe.DiffDocuments: %v", err)
+	}
+	if !d.Empty() || d.String() != "" {
+		t.Fatalf("document should not differ from itself: %v", d)
+	}
+
+	d, err = scribe.DiffDocuments(&old, &new)
+	if err != nil {
+		t.Fatalf("scribe.DiffDocuments: %v", err)
+	}
+	expect := scribe.DocumentDiff{
+		Objects: []scribe.ItemDiff{
+			{Name: "sshd-config", Change: "modified", Fields: []scribe.FieldDiff{
+				{Field: "filecontent.expression", Old: `^PermitRootLogin\s+(\S+)`, New: `^(?i)PermitRootLogin\s+(\S+)`},
+			}},
+			{Name: "sshd-password", Change: "added"},
+		},
+		Tests: []scribe.ItemDiff{
+			{Name: "sshd-password", Change: "added"},
+			{Name: "sshd-root-login", Change: "modified", Fields: []scribe.FieldDiff{
+				{Field: "owner", New: "platform"},
+			}},
+			{Name: "telnet-absent", Change: "removed"},
+		},
+	}
+	if !reflect.DeepEqual(d, expect) {
+		t.Fatalf("unexpected differences %+v", d)
+	}
+	if !strings.Contains(d.String(), "test sshd-root-login modified\n\towner:\n\t\t+ platform\n") {
+		t.Fatalf("unexpected differences output:\n%v", d)
+	}
+}
@@ -17,12 +17,105 @@ type Document struct {
 	Variables []Variable `json:"variables,omitempty" yaml:"variables,omitempty"`
 	Objects   []Object   `json:"objects,omitempty" yaml:"objects,omitempty"`
 	Tests     []Test     `json:"tests,omitempty" yaml:"tests,omitempty"`
+	Tables    []Table    `json:"tables,omitempty" yaml:"tables,omitempty"`
+
+	Generators []Generator `json:"generators,omitempty" yaml:"generators,omitempty"`
+
+	index *documentIndex
+	usage *resourceUsage
+}
+
+// documentIndex maps test and object names to their position in the
+// document, and is built when the document is validated. If the document is
+// modified after it has been indexed, lookups detect the stale index and
+// fall back to searching the document.
+type documentIndex struct {
+	tests       map[string]int
+	objects     map[string]int
+	objectTests map[string][]int
+	ntests      int
+	nobjects    int
+}
+
+func (d *Document) buildIndex() {
+	idx := &documentIndex{
+		tests:       make(map[string]int),
+		objects:     make(map[string]int),
+		objectTests: make(map[string][]int),
+		ntests:      len(d.Tests),
+		nobjects:    len(d.Objects),
+	}
+	for i := range d.Objects {
+		if _, ok := idx.objects[d.Objects[i].Object]; !ok {
+			idx.objects[d.Objects[i].Object] = i
+		}
+	}
+	for i := range d.Tests {
+		if _, ok := idx.tests[d.Tests[i].TestID]; !ok {
+			idx.tests[d.Tests[i].TestID] = i
+		}
+		idx.objectTests[d.Tests[i].Object] = append(idx.objectTests[d.Tests[i].Object], i)
+	}
+	d.index = idx
+}
+
+func (d *Document) indexValid() bool {
+	return d.index != nil && d.index.ntests == len(d.Tests) &&
+		d.index.nobjects == len(d.Objects)
+}
+
+// Return the position of the test with identifier testid, or -1.
+func (d *Document) testPosition(testid string) int {
+	if d.indexValid() {
+		i, ok := d.index.tests[testid]
+		if ok && d.Tests[i].TestID == testid {
+			return i
+		}
+	}
+	for i := range d.Tests {
+		if d.Tests[i].TestID == testid {
+			return i
+		}
+	}
+	return -1
+}
+
+// Return the position of the object named obj, or -1.
+func (d *Document) objectPosition(obj string) int {
+	if d.indexValid() {
+		i, ok := d.index.objects[obj]
+		if ok && d.Objects[i].Object == obj {
+			return i
+		}
+	}
+	for i := range d.Objects {
+		if d.Objects[i].Object == obj {
+			return i
+		}
+	}
+	return -1
 }
 
 // Validate a scribe document for consistency. This identifies any errors in
 // the document that are not JSON syntax related, including missing fields or
 // references to tests that do not exist. Returns an error if validation fails.
 func (d *Document) Validate() error {
+	d.buildIndex()
+	if d.usage == nil {
+		d.usage = &resourceUsage{}
+	}
+	d.removeUnsupported()
+	tables := make(map[string]bool)
+	for i := range d.Tables {
+		err := d.Tables[i].validate()
+		if err != nil {
+			return err
+		}
+		if tables[d.Tables[i].Name] {
+			return fmt.Errorf("table %v: name is not unique", d.Tables[i].Name)
+		}
+		tables[d.Tables[i].Name] = true
+	}
 	for i := range d.Objects {
 		err := d.Objects[i].validate(d)
 		if err != nil {
@@ -49,20 +142,56 @@ func (d *Document) GetTestIdentifiers() []string {
 }
 
 func (d *Document) prepareObjects() error {
-	// Mark any chain objects; these will be skipped during preparation
-	// as they are dependent on evaluation of the root object. Chain
-	// objects are objects that contain chain variables; that is they
-	// cannot be evaluated as they depend on information being passed
-	// from the previous object in the chain.
-	for i := range d.Objects {
-		d.Objects[i].markChain()
-	}
+	return d.prepareObjectsShared(nil)
+}
+
+// Prepare objects in the document. If cache is not nil, objects that have
+// already been prepared for another document with an identical definition
+// are copied from the cache rather than being prepared again, and objects
+// that are prepared are added to the cache.
+func (d *Document) prepareObjectsShared(cache map[string]*Object) error {
+	d.markChains()
+	d.usageBegin(true)
+	defer usageEnd()
+	locateCacheBegin()
+	defer locateCacheEnd()
 	// Note that prepare() will return an error if something goes wrong
 	// but we don't propagate this back. Errors within object preparation
 	// are kept localized to the object, and are not considered fatal to
 	// execution of the entire document.
+	//
+	// Objects that can be shared are copied once the objects they are
+	// shared with have been prepared, as objects may be prepared
+	// concurrently.
+	prepare := make([]int, 0, len(d.Objects))
+	shared := make(map[int]string)
+	for i := range d.Objects {
+		if cache == nil {
+			prepare = append(prepare, i)
+			continue
+		}
+		key := d.Objects[i].shareKey(d.Variables)
+		if key == "" {
+			prepare = append(prepare, i)
+			continue
+		}
+		if _, ok := cache[key]; ok {
+			shared[i] = key
+			continue
+		}
+		prepare = append(prepare, i)
+		cache[key] = &d.Objects[i]
+	}
+	d.prepareIndices(prepare)
 	for i := range d.Objects {
-		d.Objects[i].prepare(d)
+		key, ok := shared[i]
+		if !ok {
+			continue
+		}
+		debugPrint("prepareObjects(): sharing prepared object for \"%v\"\n", d.Objects[i].Object)
+		name := d.Objects[i].Object
+		d.Objects[i] = *cache[key]
+		d.Objects[i].Object = name
 	}
 	debugPrint("prepareObjects(): firing any import chains\n")
 	for i := range d.Objects {
@@ -71,15 +200,58 @@ func (d *Document) prepareObjects() error {
 	return nil
 }
 
-func (d *Document) objectPrepared(obj string) (bool, error) {
-	var objptr *Object
+// Mark any chain objects; these will be skipped during preparation as they
+// are dependent on evaluation of the root object. Chain objects are objects
+// that contain chain variables; that is they cannot be evaluated as they
+// depend on information being passed from the previous object in the chain.
+func (d *Document) markChains() {
 	for i := range d.Objects {
-		if d.Objects[i].Object == obj {
-			objptr = &d.Objects[i]
+		d.Objects[i].markChain()
+	}
+}
+
+// Prepare the objects referenced by test t and the tests it depends on that
+// have not already been prepared, and fire any import chains for them.
+func (d *Document) prepareTestObjects(t *Test) {
+	prepare := make([]int, 0)
+	seen := make(map[string]bool)
+	var walk func(*Test)
+	walk = func(t *Test) {
+		if seen[t.TestID] {
+			return
+		}
+		seen[t.TestID] = true
+		for _, x := range t.If {
+			dt, err := d.GetTest(x)
+			if err == nil {
+				walk(dt)
+			}
 		}
+		i := d.objectPosition(t.Object)
+		if i == -1 || d.Objects[i].isChain || d.Objects[i].prepared {
+			return
+		}
+		for _, j := range prepare {
+			if j == i {
+				return
+			}
+		}
+		prepare = append(prepare, i)
 	}
-	if objptr == nil {
-		return false, fmt.Errorf("unknown object \"%v\"", obj)
+	walk(t)
+	if len(prepare) == 0 {
+		return
+	}
+	d.prepareIndices(prepare)
+	for _, i := range prepare {
+		d.Objects[i].fireChains(d)
+	}
+}
+
+func (d *Document) objectPrepared(obj string) (bool, error) {
+	objptr, err := d.GetObject(obj)
+	if err != nil {
+		return false, err
 	}
 	// If an error occurred while preparing this object, return that here
 	// and note preparation as false.
@@ -89,43 +261,111 @@ func (d *Document) objectPrepared(obj string) (bool, error) {
 	return objptr.prepared, nil
 }
 
-func (d *Document) runTests() error {
+// Run all tests in the document. If resultFn is not nil, it is called with
+// the results of each test as the test completes.
+func (d *Document) runTests(resultFn func(TestResult) error) error {
+	d.usageBegin(false)
+	defer usageEnd()
+	return d.evaluateTests(false, resultFn)
+}
+
+// Prepare and run all tests in the document, calling resultFn with the
+// results of each test as the test completes. Rather than preparing all
+// objects before any test is run, the objects a test references are
+// prepared immediately before the test is run, so the results of a test do
+// not wait on preparation of objects only later tests reference.
+func (d *Document) streamTests(resultFn func(TestResult) error) error {
+	d.markChains()
+	d.usageBegin(true)
+	defer usageEnd()
+	locateCacheBegin()
+	defer locateCacheEnd()
+	return d.evaluateTests(true, resultFn)
+}
+
+func (d *Document) evaluateTests(prepare bool, resultFn func(TestResult) error) error {
 	// As documented prepareObjects(), we don't propagate errors here but
 	// instead keep them localized to the test.
 	for i := range d.Tests {
+		if prepare {
+			d.prepareTestObjects(&d.Tests[i])
+		}
 		d.Tests[i].runTest(d)
+		if resultFn == nil {
+			continue
+		}
+		tr, err := GetResults(d, d.Tests[i].TestID)
+		if err != nil {
+			return err
+		}
+		err = resultFn(tr)
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
 // Return a pointer to a test instance of the test whose identifier matches
 func (d *Document) GetTest(testid string) (*Test, error) {
+	i := d.testPosition(testid)
+	if i == -1 {
+		return nil, fmt.Errorf("unknown test \"%v\"", testid)
+	}
+	return &d.Tests[i], nil
+}
+
+// GetObject returns a pointer to the object with the name obj.
+func (d *Document) GetObject(obj string) (*Object, error) {
+	i := d.objectPosition(obj)
+	if i == -1 {
+		return nil, fmt.Errorf("unknown object \"%v\"", obj)
+	}
+	return &d.Objects[i], nil
+}
+
+// TestsReferencingObject returns pointers to all tests in the document that
+// reference the object with the name obj.
+func (d *Document) TestsReferencingObject(obj string) []*Test {
+	ret := make([]*Test, 0)
+	if d.indexValid() {
+		stale := false
+		for _, i := range d.index.objectTests[obj] {
+			if d.Tests[i].Object != obj {
+				stale = true
+				break
+			}
+			ret = append(ret, &d.Tests[i])
+		}
+		if !stale {
+			return ret
+		}
+		ret = ret[:0]
+	}
 	for i := range d.Tests {
-		if d.Tests[i].TestID == testid {
-			return &d.Tests[i], nil
+		if d.Tests[i].Object == obj {
+			ret = append(ret, &d.Tests[i])
 		}
 	}
-	return nil, fmt.Errorf("unknown test \"%v\"", testid)
+	return ret
 }
 
 // Given an object name, return a generic source interface for the object.
 func (d *Document) getObjectInterface(obj string) (genericSource, error) {
-	for i := range d.Objects {
-		if d.Objects[i].Object == obj {
-			return d.Objects[i].getSourceInterface(), nil
-		}
+	o, err := d.GetObject(obj)
+	if err != nil {
+		return nil, err
 	}
-	return nil, fmt.Errorf("unknown object \"%v\"", obj)
+	return o.getSourceInterface(), nil
 }
 
 // Given an object name, return a generic source interface to a copy of the
 // object.
 func (d *Document) getObjectInterfaceCopy(obj string) (genericSource, error) {
-	for i := range d.Objects {
-		if d.Objects[i].Object == obj {
-			newobj := d.Objects[i]
-			return newobj.getSourceInterface(), nil
-		}
+	o, err := d.GetObject(obj)
+	if err != nil {
+		return nil, err
 	}
-	return nil, fmt.Errorf("unknown object \"%v\"", obj)
+	newobj := *o
+	return newobj.getSourceInterface(), nil
 }
@@ -0,0 +1,228 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"debug/elf"
+	"fmt"
+)
+
+// ELF is used to perform tests against hardening properties of ELF binaries
+// located on the file system.
+//
+// Binaries are located using Path and File in the same way as for FileName.
+// Property specifies which property of the binary is returned as the test
+// value for each binary, and can be one of:
+//
+// relro: "full", "partial" or "none"
+//
+// pie: "true" if the binary is a position independent executable
+//
+// canary: "true" if the binary was built with stack protection
+//
+// nx: "true" if the binary requests a non-executable stack
+//
+// Files that are not valid ELF binaries are ignored.
+type ELF struct {
+	Path     string `json:"path,omitempty" yaml:"path,omitempty"`
+	File     string `json:"file,omitempty" yaml:"file,omitempty"`
+	Property string `json:"property,omitempty" yaml:"property,omitempty"`
+
+	LocatorOptions `yaml:",inline"`
+
+	fileRe  compiledRegexp
+	matches []elfStatus
+}
+
+type elfStatus struct {
+	path  string
+	value string
+}
+
+func (e *ELF) isChain() bool {
+	return false
+}
+
+func (e *ELF) fireChains(d *Document) ([]evaluationCriteria, error) {
+	return nil, nil
+}
+
+func (e *ELF) mergeCriteria(c []evaluationCriteria) {
+}
+
+func (e *ELF) validate(d *Document) error {
+	if len(e.Path) == 0 {
+		return fmt.Errorf("elf path must be set")
+	}
+	if len(e.File) == 0 {
+		return fmt.Errorf("elf file must be set")
+	}
+	_, err := e.fileRe.compile(e.fileExpression(e.File))
+	if err != nil {
+		return err
+	}
+	switch e.Property {
+	case "relro", "pie", "canary", "nx":
+	default:
+		return fmt.Errorf("elf property must be relro, pie, canary or nx")
+	}
+	return nil
+}
+
+func (e *ELF) expandVariables(v []Variable) {
+	e.Path = variableExpansion(v, e.Path)
+	e.File = variableExpansion(v, e.File)
+}
+
+func (e *ELF) getCriteria() (ret []evaluationCriteria) {
+	for _, x := range e.matches {
+		n := evaluationCriteria{}
+		n.identifier = x.path
+		n.testValue = x.value
+		ret = append(ret, n)
+	}
+	return ret
+}
+
+func (e *ELF) prepare() error {
+	debugPrint("prepare(): analyzing file system, path %v, file \"%v\"\n", e.Path, e.File)
+
+	re, err := e.fileRe.compile(e.fileExpression(e.File))
+	if err != nil {
+		return err
+	}
+
+	sfl := newSimpleFileLocator()
+	sfl.root = e.Path
+	sfl.opts = e.LocatorOptions
+	err = sfl.locateRegexp(re)
+	if err != nil {
+		return err
+	}
+
+	for _, x := range sfl.matches {
+		v, err := elfProperty(x, e.Property, e.LocatorOptions)
+		if err != nil {
+			debugPrint("prepare(): skipping %v: %v\n", x, err)
+			continue
+		}
+		debugPrint("prepare(): %v %v: %v\n", x, e.Property, v)
+		e.matches = append(e.matches, elfStatus{path: sfl.identifier(x), value: v})
+	}
+	return nil
+}
+
+// Return property of the ELF binary at path. Binaries on the file system
+// are read in place, so only the parts needed are read; other content, such as
+// archive members, is read into memory up to the maximum archive size.
+func elfProperty(path string, property string, opts LocatorOptions) (string, error) {
+	fd, err := openLocated(path, opts)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+	maxsize, _ := opts.archiveLimits()
+	ra, _, err := readerAtSize(fd, maxsize)
+	if err != nil {
+		return "", err
+	}
+	f, err := elf.NewFile(ra)
+	if err != nil {
+		return "", err
+	}
+
+	switch property {
+	case "relro":
+		return elfRelro(f), nil
+	case "pie":
+		return fmt.Sprintf("%v", elfPie(f)), nil
+	case "canary":
+		return fmt.Sprintf("%v", elfCanary(f)), nil
+	case "nx":
+		return fmt.Sprintf("%v", elfNX(f)), nil
+	}
+	return "", fmt.Errorf("unknown elf property %v", property)
+}
+
+func elfHasProg(f *elf.File, t elf.ProgType) *elf.Prog {
+	for _, x := range f.Progs {
+		if x.Type == t {
+			return x
+		}
+	}
+	return nil
+}
+
+// Returns true if any value for dynamic tag tag has flag set.
+func elfDynFlag(f *elf.File, tag elf.DynTag, flag uint64) bool {
+	vals, err := f.DynValue(tag)
+	if err != nil {
+		return false
+	}
+	for _, x := range vals {
+		if x&flag != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func elfRelro(f *elf.File) string {
+	if elfHasProg(f, elf.PT_GNU_RELRO) == nil {
+		return "none"
+	}
+	bn, err := f.DynValue(elf.DT_BIND_NOW)
+	if err == nil && len(bn) > 0 {
+		return "full"
+	}
+	if elfDynFlag(f, elf.DT_FLAGS, uint64(elf.DF_BIND_NOW)) ||
+		elfDynFlag(f, elf.DT_FLAGS_1, uint64(elf.DF_1_NOW)) {
+		return "full"
+	}
+	return "partial"
+}
+
+func elfPie(f *elf.File) bool {
+	if f.Type != elf.ET_DYN {
+		return false
+	}
+	// Shared libraries are also ET_DYN, so only consider the object an
+	// executable if it requests an interpreter or is flagged as PIE.
+	if elfHasProg(f, elf.PT_INTERP) != nil {
+		return true
+	}
+	return elfDynFlag(f, elf.DT_FLAGS_1, uint64(elf.DF_1_PIE))
+}
+
+func elfCanary(f *elf.File) bool {
+	check := func(syms []elf.Symbol) bool {
+		for _, x := range syms {
+			if x.Name == "__stack_chk_fail" || x.Name == "__stack_chk_guard" {
+				return true
+			}
+		}
+		return false
+	}
+	syms, err := f.DynamicSymbols()
+	if err == nil && check(syms) {
+		return true
+	}
+	syms, err = f.Symbols()
+	if err == nil && check(syms) {
+		return true
+	}
+	return false
+}
+
+func elfNX(f *elf.File) bool {
+	p := elfHasProg(f, elf.PT_GNU_STACK)
+	if p == nil {
+		return false
+	}
+	return p.Flags&elf.PF_X == 0
+}
@@ -0,0 +1,184 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"archive/zip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/mozilla/scribe"
+)
+
+// Used in TestELFPolicy. The binaries in test/elf are built without a C
+// library; hardened is a PIE with full RELRO, a non-executable stack and a
+// stack protector symbol, partial is a PIE with partial RELRO, and weak is
+// a static executable with an executable stack.
+var elfPolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "relro",
+		"elf": {
+			"path": "./test/elf",
+			"file": ".*",
+			"property": "relro"
+		}
+	},
+
+	{
+		"object": "pie",
+		"elf": {
+			"path": "./test/elf",
+			"file": ".*",
+			"property": "pie"
+		}
+	},
+
+	{
+		"object": "canary",
+		"elf": {
+			"path": "./test/elf",
+			"file": ".*",
+			"property": "canary"
+		}
+	},
+
+	{
+		"object": "nx",
+		"elf": {
+			"path": "./test/elf",
+			"file": ".*",
+			"property": "nx"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "elf0",
+		"expectedresult": true,
+		"object": "relro",
+		"exactmatch": {
+			"value": "full"
+		}
+	},
+
+	{
+		"test": "elf1",
+		"expectedresult": true,
+		"object": "pie",
+		"exactmatch": {
+			"value": "false"
+		}
+	},
+
+	{
+		"test": "elf2",
+		"expectedresult": true,
+		"object": "canary",
+		"exactmatch": {
+			"value": "true"
+		}
+	},
+
+	{
+		"test": "elf3",
+		"expectedresult": true,
+		"object": "nx",
+		"exactmatch": {
+			"value": "false"
+		}
+	}
+	]
+}
+`
+
+func TestELFPolicy(t *testing.T) {
+	doc := genericTestExec(t, elfPolicyDoc)
+	expect := map[string][]string{
+		"elf0": {"hardened:full", "partial:partial", "weak:none"},
+		"elf1": {"hardened:true", "partial:true", "weak:false"},
+		"elf2": {"hardened:true", "partial:false", "weak:false"},
+		"elf3": {"hardened:true", "partial:true", "weak:false"},
+	}
+	for k, v := range expect {
+		e, err := doc.ExplainTest(k)
+		if err != nil {
+			t.Fatalf("Document.ExplainTest: %v", err)
+		}
+		got := make([]string, 0)
+		for _, x := range e.Criteria {
+			got = append(got, filepath.Base(x.Identifier)+":"+x.Value)
+		}
+		sort.Strings(got)
+		sort.Strings(v)
+		if !reflect.DeepEqual(got, v) {
+			t.Fatalf("%v: unexpected criteria %v", k, got)
+		}
+	}
+}
+
+func TestELFArchive(t *testing.T) {
+	dir := t.TempDir()
+	buf, err := ioutil.ReadFile("./test/elf/hardened")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd, err := os.Create(filepath.Join(dir, "bin.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(fd)
+	w, err := zw.Create("bin/hardened")
+	if err == nil {
+		_, err = w.Write(buf)
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if cerr := fd.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Archive members are read into memory, up to the maximum archive
+	// size.
+	for _, x := range []struct {
+		maxsize int
+		want    []string
+	}{
+		{4096, []string{"hardened:full"}},
+		{1024, []string{}},
+	} {
+		doc := fmt.Sprintf(`{"objects": [{"object": "o", "elf": {"path": %q, "file": "^hardened$", `+
+			`"property": "relro", "archives": true, "archivemaxsize": %v}}]}`, dir, x.maxsize)
+		d, err := scribe.LoadDocument(strings.NewReader(doc))
+		if err != nil {
+			t.Fatalf("scribe.LoadDocument: %v", err)
+		}
+		c, err := d.EvaluateObject("o")
+		if err != nil {
+			t.Fatalf("EvaluateObject: %v", err)
+		}
+		got := make([]string, 0)
+		for _, y := range c {
+			got = append(got, filepath.Base(y.Identifier)+":"+y.Value)
+		}
+		if !reflect.DeepEqual(got, x.want) {
+			t.Fatalf("archivemaxsize %v: unexpected criteria %v", x.maxsize, got)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	goruntime "runtime"
+	"strconv"
+	"strings"
+)
+
+// Encryption is used to perform tests against the encryption status of
+// the block devices backing mounted file systems on Linux, so a policy can
+// require volumes to be encrypted using dm-crypt (for example with LUKS).
+// On other platforms no criteria are returned.
+//
+// Mount is a regular expression matched against the mount points of file
+// systems backed by a block device, for example ^/$ for the root file
+// system. A criteria is returned for each matching mount point, with the
+// mount point as the identifier. The device mapper stack under each file
+// system is followed, so a logical volume on an encrypted physical volume
+// is considered encrypted.
+//
+// Property specifies what is returned as the test value, and can be one
+// of:
+//
+// encrypted: true if the file system is on an encrypted device, otherwise
+// false
+//
+// type: the encryption type, luks1, luks2 or plain, or none if the file
+// system is not encrypted
+//
+// crypttab: true if the encrypted device is configured in /etc/crypttab so
+// it is unlocked at boot, otherwise false
+//
+// device: the device the file system is mounted from
+type Encryption struct {
+	Mount    string `json:"mount,omitempty" yaml:"mount,omitempty"`
+	Property string `json:"property,omitempty" yaml:"property,omitempty"`
+
+	mountRe compiledRegexp
+	matches []encryptionMatch
+}
+
+type encryptionMatch struct {
+	mount string
+	value string
+}
+
+type encryptionInfo struct {
+	mount    string
+	device   string
+	cryptTyp string // The encryption type, empty if not encrypted.
+	mapping  string // The name of the dm-crypt mapping.
+}
+
+// Paths used to determine the encryption status of file systems.
+var (
+	encryptionMountinfo = "/proc/self/mountinfo"
+	encryptionSysBlock  = "/sys/dev/block"
+	encryptionCrypttab  = "/etc/crypttab"
+)
+
+func (e *Encryption) isChain() bool {
+	return false
+}
+
+func (e *Encryption) fireChains(d *Document) ([]evaluationCriteria, error) {
+	return nil, nil
+}
+
+func (e *Encryption) mergeCriteria(c []evaluationCriteria) {
+}
+
+func (e *Encryption) validate(d *Document) error {
+	switch e.Property {
+	case "encrypted", "type", "crypttab", "device":
+	default:
+		return fmt.Errorf("encryption property must be encrypted, type, crypttab or device")
+	}
+	_, err := e.mountRe.compile(e.Mount)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (e *Encryption) expandVariables(v []Variable) {
+	e.Mount = variableExpansion(v, e.Mount)
+}
+
+func (e *Encryption) getCriteria() (ret []evaluationCriteria) {
+	for _, x := range e.matches {
+		n := evaluationCriteria{}
+		n.identifier = x.mount
+		n.testValue = x.value
+		ret = append(ret, n)
+	}
+	return ret
+}
+
+func (e *Encryption) prepare() error {
+	debugPrint("prepare(): inspecting disk encryption, mount \"%v\"\n", e.Mount)
+	re, err := e.mountRe.compile(e.Mount)
+	if err != nil {
+		return err
+	}
+	mountinfo, sysblock, crypttab := encryptionMountinfo, encryptionSysBlock, encryptionCrypttab
+	if sRuntime.testHooks {
+		mountinfo = "./test/encryption/mountinfo"
+		sysblock = "./test/encryption/sys/dev/block"
+		crypttab = "./test/encryption/crypttab"
+	} else if goruntime.GOOS != "linux" {
+		return nil
+	}
+	info, err := diskEncryptionStatus(mountinfo, sysblock)
+	if err != nil {
+		return err
+	}
+	configured := crypttabNames(crypttab)
+	for _, x := range info {
+		if !re.MatchString(x.mount) {
+			continue
+		}
+		var v string
+		switch e.Property {
+		case "encrypted":
+			v = strconv.FormatBool(x.cryptTyp != "")
+		case "type":
+			v = x.cryptTyp
+			if v == "" {
+				v = "none"
+			}
+		case "crypttab":
+			v = strconv.FormatBool(x.cryptTyp != "" && configured[x.mapping])
+		case "device":
+			v = x.device
+		}
+		e.matches = append(e.matches, encryptionMatch{x.mount, v})
+	}
+	return nil
+}
+
+// Return the encryption status of each file system in mountinfo backed by
+// a block device, sysblock being the sysfs directory containing block
+// devices by major and minor number.
+func diskEncryptionStatus(mountinfo string, sysblock string) ([]encryptionInfo, error) {
+	fd, err := os.Open(mountinfo)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	ret := make([]encryptionInfo, 0)
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		// Fields are the mount ID, parent ID, major:minor, root, mount
+		// point and options, followed by optional fields terminated by
+		// a separator, the file system type and the mount source.
+		f := strings.Fields(scanner.Text())
+		sep := -1
+		for i := 6; i < len(f); i++ {
+			if f[i] == "-" {
+				sep = i
+				break
+			}
+		}
+		if len(f) < 6 || sep == -1 || sep+2 >= len(f) {
+			continue
+		}
+		info := encryptionInfo{mount: unescapeMountinfo(f[4]), device: unescapeMountinfo(f[sep+2])}
+		dev := f[2]
+		if strings.HasPrefix(dev, "0:") {
+			// File systems such as btrfs report an anonymous device
+			// number, use the device the file system is mounted from.
+			fi, err := os.Stat(info.device)
+			if err != nil {
+				continue
+			}
+			rdev, ok := fileRdev(fi)
+			if !ok {
+				continue
+			}
+			dev = linuxDeviceString(rdev)
+		}
+		if _, err := os.Stat(sysBlockPath(sysblock, dev)); err != nil {
+			continue
+		}
+		info.cryptTyp, info.mapping = dmCryptStatus(sysblock, dev, 0)
+		ret = append(ret, info)
+	}
+	return ret, scanner.Err()
+}
+
+// Return the Linux device number rdev as major:minor.
+func linuxDeviceString(rdev uint64) string {
+	major := (rdev>>8)&0xfff | (rdev>>32)&^0xfff
+	minor := rdev&0xff | (rdev>>12)&^0xff
+	return fmt.Sprintf("%v:%v", major, minor)
+}
+
+// Return the path of block device dev (as major:minor) in sysblock. Test
+// data uses an underscore in place of the colon, which is not permitted in
+// file names in modules.
+func sysBlockPath(sysblock string, dev string) string {
+	if sRuntime.testHooks {
+		dev = strings.Replace(dev, ":", "_", 1)
+	}
+	return filepath.Join(sysblock, dev)
+}
+
+// Return the dm-crypt encryption type and mapping name for block device
+// dev (as major:minor), following the devices under device mapper devices
+// until an encrypted device is found.
+func dmCryptStatus(sysblock string, dev string, depth int) (string, string) {
+	if depth > 16 {
+		return "", ""
+	}
+	dir := sysBlockPath(sysblock, dev)
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "dm", "uuid"))
+	if err == nil {
+		// dm-crypt devices have a UUID such as CRYPT-LUKS2-<uuid>-<name>
+		// or CRYPT-PLAIN-<name>.
+		uuid := strings.TrimSpace(string(buf))
+		if strings.HasPrefix(uuid, "CRYPT-") {
+			s := strings.SplitN(uuid, "-", 3)
+			name, _ := ioutil.ReadFile(filepath.Join(dir, "dm", "name"))
+			return strings.ToLower(s[1]), strings.TrimSpace(string(name))
+		}
+	}
+	slaves, err := ioutil.ReadDir(filepath.Join(dir, "slaves"))
+	if err != nil {
+		return "", ""
+	}
+	for _, x := range slaves {
+		buf, err := ioutil.ReadFile(filepath.Join(dir, "slaves", x.Name(), "dev"))
+		if err != nil {
+			continue
+		}
+		typ, name := dmCryptStatus(sysblock, strings.TrimSpace(string(buf)), depth+1)
+		if typ != "" {
+			return typ, name
+		}
+	}
+	return "", ""
+}
+
+// Mount points in mountinfo escape spaces and other characters as octal.
+func unescapeMountinfo(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// Return the names of the mappings configured in crypttab.
+func crypttabNames(path string) map[string]bool {
+	ret := make(map[string]bool)
+	fd, err := os.Open(path)
+	if err != nil {
+		return ret
+	}
+	defer fd.Close()
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		f := strings.Fields(scanner.Text())
+		if len(f) < 2 || strings.HasPrefix(f[0], "#") {
+			continue
+		}
+		ret[f[0]] = true
+	}
+	return ret
+}
@@ -0,0 +1,104 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"testing"
+
+	"github.com/mozilla/scribe"
+)
+
+// Used in TestEncryptionPolicy
+var encryptionPolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "root-encrypted",
+		"encryption": {
+			"mount": "^/$",
+			"property": "encrypted"
+		}
+	},
+
+	{
+		"object": "encryption-type",
+		"encryption": {
+			"property": "type"
+		}
+	},
+
+	{
+		"object": "crypttab",
+		"encryption": {
+			"mount": "^/(srv|mnt)/",
+			"property": "crypttab"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "encryption0",
+		"expectedresult": true,
+		"object": "root-encrypted",
+		"exactmatch": {
+			"value": "true"
+		}
+	},
+
+	{
+		"test": "encryption1",
+		"expectedresult": true,
+		"object": "encryption-type",
+		"exactmatch": {
+			"value": "none"
+		}
+	},
+
+	{
+		"test": "encryption2",
+		"expectedresult": true,
+		"object": "crypttab",
+		"exactmatch": {
+			"value": "false"
+		}
+	}
+	]
+}
+`
+
+func TestEncryptionPolicy(t *testing.T) {
+	doc := genericTestExec(t, encryptionPolicyDoc)
+	e, err := doc.ExplainTest("encryption1")
+	if err != nil {
+		t.Fatalf("Document.ExplainTest: %v", err)
+	}
+	expect := map[string]string{
+		"/":                  "luks2",
+		"/boot":              "none",
+		"/srv/data":          "luks1",
+		"/mnt/scratch space": "plain",
+	}
+	if len(e.Criteria) != len(expect) {
+		t.Fatalf("unexpected encryption criteria %+v", e.Criteria)
+	}
+	for _, x := range e.Criteria {
+		if expect[x.Identifier] != x.Value {
+			t.Fatalf("unexpected encryption type %v for %v", x.Value, x.Identifier)
+		}
+	}
+	tr, err := scribe.GetResults(doc, "encryption2")
+	if err != nil {
+		t.Fatalf("scribe.GetResults: %v", err)
+	}
+	for _, x := range tr.Results {
+		if x.Result != (x.Identifier == "/mnt/scratch space") {
+			t.Fatalf("unexpected crypttab result for %v", x.Identifier)
+		}
+	}
+}
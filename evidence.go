@@ -0,0 +1,386 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Evidence archives are gzip compressed tar files. The manifest contains the
+// package inventory and the list of paths returned by the file locator, and
+// the content of each file read during evaluation is stored under the files
+// directory using the path it was read from, or under the relative
+// directory for relative paths. The manifest maps the name of each entry to
+// the path it was read from, as entry names do not preserve paths exactly.
+// Version 1 archives did not include the map, and only supported absolute
+// paths.
+const (
+	evidenceManifest = "manifest.json"
+	evidenceFiles    = "files"
+	evidenceRelative = "relative"
+	evidenceVersion  = 2
+)
+
+type evidenceManifestData struct {
+	Version  int               `json:"version"`
+	Hostname string            `json:"hostname"`
+	Created  time.Time         `json:"created"`
+	Located  []string          `json:"located"`
+	Packages []PackageInfo     `json:"packages"`
+	Homes    []evidenceHome    `json:"homes,omitempty"`
+	Files    map[string]string `json:"files"`
+}
+
+type evidenceHome struct {
+	User string `json:"user"`
+	Dir  string `json:"dir"`
+}
+
+// Sources that are satisfied from the evidence archive in replay mode. Other
+// sources inspect the host directly, so objects using them can not be
+// evaluated during replay, rather than mixing the evidence with data from
+// the host running the replay.
+var evidenceSources = map[string]bool{
+	"configkv":    true,
+	"configquery": true,
+	"elf":         true,
+	"filecontent": true,
+	"filehash":    true,
+	"filename":    true,
+	"hasline":     true,
+	"jar":         true,
+	"package":     true,
+	"plist":       true,
+	"raw":         true,
+	"xml":         true,
+}
+
+type evidenceStore struct {
+	sync.Mutex
+	replay   bool
+	hostname string
+	created  time.Time
+	located  map[string]bool
+	files    map[string][]byte
+	packages []PackageInfo
+	homes    []evidenceHome
+}
+
+func newEvidenceStore() *evidenceStore {
+	return &evidenceStore{
+		located: make(map[string]bool),
+		files:   make(map[string][]byte),
+	}
+}
+
+// RecordEvidence enables or disables collection of evidence.
+//
+// When enabled, raw data gathered by file and package sources during
+// analysis (paths returned by the file locator, the content of files that
+// are read, and the package inventory) is retained so it can be written
+// as an evidence archive using WriteEvidence(). Enabling recording discards
+// any previously collected evidence, and disables replay mode.
+func RecordEvidence(f bool) {
+	if !f {
+		sRuntime.evidence = nil
+		return
+	}
+	e := newEvidenceStore()
+	e.hostname, _ = os.Hostname()
+	e.created = time.Now().UTC()
+	sRuntime.evidence = e
+}
+
+// WriteEvidence writes the evidence collected since recording was enabled to
+// w as an evidence archive.
+func WriteEvidence(w io.Writer) error {
+	e := sRuntime.evidence
+	if e == nil || e.replay {
+		return fmt.Errorf("evidence recording is not enabled")
+	}
+	e.Lock()
+	defer e.Unlock()
+
+	man := evidenceManifestData{
+		Version:  evidenceVersion,
+		Hostname: e.hostname,
+		Created:  e.created,
+		Located:  make([]string, 0, len(e.located)),
+		Packages: e.packages,
+		Homes:    e.homes,
+		Files:    make(map[string]string),
+	}
+	for x := range e.located {
+		man.Located = append(man.Located, x)
+	}
+	sort.Strings(man.Located)
+	names := make([]string, 0, len(e.files))
+	for x := range e.files {
+		names = append(names, x)
+	}
+	sort.Strings(names)
+	entries := make([]string, 0, len(names))
+	for _, x := range names {
+		n := evidenceEntryName(x)
+		for i := 1; man.Files[n] != ""; i++ {
+			n = fmt.Sprintf("%v~%v", evidenceEntryName(x), i)
+		}
+		man.Files[n] = x
+		entries = append(entries, n)
+	}
+	buf, err := json.MarshalIndent(man, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	add := func(name string, data []byte) error {
+		hdr := &tar.Header{
+			Name:    name,
+			Mode:    0644,
+			Size:    int64(len(data)),
+			ModTime: e.created,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+	err = add(evidenceManifest, buf)
+	if err != nil {
+		return err
+	}
+	for i, x := range names {
+		err = add(entries[i], e.files[x])
+		if err != nil {
+			return err
+		}
+	}
+	err = tw.Close()
+	if err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// ReplayEvidence loads an evidence archive from r and enables replay mode.
+//
+// In replay mode, sources that locate or read files and the package source
+// do not inspect the host and are instead satisfied from the evidence
+// archive, so documents can be evaluated against the captured host
+// snapshot. Objects using other sources, such as filestat or sharedlib,
+// result in an error, or are not applicable if partial evaluation is
+// enabled. Files that were located but not read while the evidence was
+// recorded can be matched by file name, but their content is not
+// available. Call ReplayEvidence with a nil reader to disable replay mode.
+func ReplayEvidence(r io.Reader) error {
+	if r == nil {
+		sRuntime.evidence = nil
+		return nil
+	}
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	e := newEvidenceStore()
+	e.replay = true
+	var man evidenceManifestData
+	foundman := false
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		buf, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		if hdr.Name == evidenceManifest {
+			err = json.Unmarshal(buf, &man)
+			if err != nil {
+				return err
+			}
+			if man.Version < 1 || man.Version > evidenceVersion {
+				return fmt.Errorf("unsupported evidence version %v", man.Version)
+			}
+			e.hostname = man.Hostname
+			e.created = man.Created
+			e.packages = man.Packages
+			e.homes = man.Homes
+			for _, x := range man.Located {
+				e.located[x] = true
+			}
+			foundman = true
+			continue
+		}
+		// The manifest is written first, so the path of each file
+		// is known when the file is read.
+		p, ok := man.Files[hdr.Name]
+		if !ok && man.Version == 1 && strings.HasPrefix(hdr.Name, evidenceFiles+"/") {
+			p, ok = filepath.FromSlash(strings.TrimPrefix(hdr.Name, evidenceFiles)), true
+		}
+		if ok {
+			e.files[p] = buf
+			e.located[p] = true
+		}
+	}
+	if !foundman {
+		return fmt.Errorf("evidence archive has no manifest")
+	}
+	debugPrint("ReplayEvidence(): loaded evidence from %v (%v), %v files, %v packages\n",
+		e.hostname, e.created, len(e.files), len(e.packages))
+	sRuntime.evidence = e
+	return nil
+}
+
+// Return the name of the archive entry for a file read from path p.
+func evidenceEntryName(p string) string {
+	dir := evidenceRelative
+	if filepath.IsAbs(p) {
+		dir = evidenceFiles
+	}
+	ret := path.Join(dir, filepath.ToSlash(p))
+	// Relative paths can refer to parent directories.
+	if !strings.HasPrefix(ret, dir+"/") {
+		ret = path.Join(dir, path.Base(filepath.ToSlash(p)))
+	}
+	return ret
+}
+
+func evidenceRecording() *evidenceStore {
+	e := sRuntime.evidence
+	if e == nil || e.replay {
+		return nil
+	}
+	return e
+}
+
+func evidenceReplaying() *evidenceStore {
+	e := sRuntime.evidence
+	if e == nil || !e.replay {
+		return nil
+	}
+	return e
+}
+
+func (e *evidenceStore) addLocated(paths []string) {
+	e.Lock()
+	for _, x := range paths {
+		e.located[x] = true
+	}
+	e.Unlock()
+}
+
+// Record the content of a file read during evaluation, returning a reader
+// for the recorded content.
+func (e *evidenceStore) addFile(p string, rc io.ReadCloser) (io.ReadCloser, error) {
+	defer rc.Close()
+	buf, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	e.Lock()
+	e.files[p] = buf
+	e.located[p] = true
+	e.Unlock()
+	return ioutil.NopCloser(bytes.NewReader(buf)), nil
+}
+
+func (e *evidenceStore) setPackages(pkgs []pkgmgrInfo) {
+	e.Lock()
+	e.packages = make([]PackageInfo, 0, len(pkgs))
+	for _, x := range pkgs {
+		e.packages = append(e.packages, PackageInfo{Name: x.name,
+			Version: x.version, Type: x.pkgtype, Arch: x.arch})
+	}
+	e.Unlock()
+}
+
+func (e *evidenceStore) getPackages() []pkgmgrInfo {
+	ret := make([]pkgmgrInfo, 0, len(e.packages))
+	for _, x := range e.packages {
+		ret = append(ret, pkgmgrInfo{name: x.Name, version: x.Version,
+			pkgtype: x.Type, arch: x.Arch})
+	}
+	return ret
+}
+
+func (e *evidenceStore) setHomes(homes []homeDirectory) {
+	e.Lock()
+	e.homes = make([]evidenceHome, 0, len(homes))
+	for _, x := range homes {
+		e.homes = append(e.homes, evidenceHome{User: x.user, Dir: x.dir})
+	}
+	e.Unlock()
+}
+
+func (e *evidenceStore) getHomes() []homeDirectory {
+	ret := make([]homeDirectory, 0, len(e.homes))
+	for _, x := range e.homes {
+		ret = append(ret, homeDirectory{user: x.User, dir: x.Dir})
+	}
+	return ret
+}
+
+func (e *evidenceStore) open(p string) (io.ReadCloser, error) {
+	buf, ok := e.files[p]
+	if !ok {
+		return nil, fmt.Errorf("%v: content not present in evidence", p)
+	}
+	return ioutil.NopCloser(bytes.NewReader(buf)), nil
+}
+
+// Locate files in the evidence, applying the same root, depth and name
+// matching semantics as the file system locator.
+func (e *evidenceStore) locate(root string, maxDepth int, archives bool,
+	match locateMatchFunc) []string {
+	ret := make([]string, 0)
+	for x := range e.located {
+		fspath := x
+		name := filepath.Base(x)
+		if idx := strings.Index(x, archiveSeparator); idx != -1 {
+			if !archives {
+				continue
+			}
+			fspath = x[:idx]
+			name = path.Base(x[strings.LastIndex(x, archiveSeparator)+1:])
+		}
+		rel, err := filepath.Rel(root, fspath)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		if len(strings.Split(rel, string(filepath.Separator))) > maxDepth {
+			continue
+		}
+		if match(x, name) {
+			ret = append(ret, x)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
@@ -0,0 +1,228 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mozilla/scribe"
+)
+
+// Used in TestEvidenceReplay, the root path is substituted with a temporary
+// directory.
+var evidencePolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "config",
+		"filecontent": {
+			"path": "%v",
+			"file": "app.conf",
+			"expression": "^version = (\\S+)"
+		}
+	},
+
+	{
+		"object": "names",
+		"filename": {
+			"path": "%v",
+			"file": "(.*)\\.log$"
+		}
+	},
+
+	{
+		"object": "openssl",
+		"package": {
+			"name": "openssl"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "config-version",
+		"object": "config",
+		"regexp": {
+			"value": "^1\\.2$"
+		}
+	},
+
+	{
+		"test": "logs",
+		"object": "names"
+	},
+
+	{
+		"test": "openssl-present",
+		"object": "openssl"
+	}
+	]
+}
+`
+
+// Used in TestEvidenceReplay, filestat reads file metadata from the host so
+// can not be evaluated from evidence.
+var evidenceStatDoc = `
+{
+	"objects": [
+	{
+		"object": "mode",
+		"filestat": {
+			"path": "%v",
+			"file": "app.conf",
+			"property": "mode"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "config-mode",
+		"object": "mode"
+	}
+	]
+}
+`
+
+func evidenceAnalyze(t *testing.T, docstr string) []string {
+	doc, err := scribe.LoadDocument(strings.NewReader(docstr))
+	if err != nil {
+		t.Fatalf("scribe.LoadDocument: %v", err)
+	}
+	err = scribe.AnalyzeDocument(doc)
+	if err != nil {
+		t.Fatalf("scribe.AnalyzeDocument: %v", err)
+	}
+	ret := make([]string, 0)
+	for _, x := range doc.GetTestIdentifiers() {
+		tr, err := scribe.GetResults(&doc, x)
+		if err != nil {
+			t.Fatalf("scribe.GetResults: %v", err)
+		}
+		ret = append(ret, tr.SingleLineResults()...)
+	}
+	return ret
+}
+
+func TestEvidenceReplay(t *testing.T) {
+	root, err := ioutil.TempDir("", "scribe-evidence")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(root)
+	evidenceRoundTrip(t, root)
+}
+
+// Files located using a relative path are replayed using the same path.
+func TestEvidenceReplayRelative(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scribe-evidence")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("os.Getwd: %v", err)
+	}
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatalf("os.Chdir: %v", err)
+	}
+	defer os.Chdir(wd)
+	evidenceRoundTrip(t, "conf")
+}
+
+// Record evidence analyzing files created under root, then remove the files
+// and check the results replayed from the evidence are the same.
+func evidenceRoundTrip(t *testing.T, root string) {
+	files := map[string]string{
+		"app.conf":       "name = app\nversion = 1.2\n",
+		"sub/error.log":  "error\n",
+		"sub/access.log": "access\n",
+	}
+	for k, v := range files {
+		p := filepath.Join(root, k)
+		err := os.MkdirAll(filepath.Dir(p), 0755)
+		if err != nil {
+			t.Fatalf("os.MkdirAll: %v", err)
+		}
+		err = ioutil.WriteFile(p, []byte(v), 0644)
+		if err != nil {
+			t.Fatalf("ioutil.WriteFile: %v", err)
+		}
+	}
+	docstr := fmt.Sprintf(evidencePolicyDoc, root, root)
+
+	scribe.Bootstrap()
+	scribe.TestHooks(true)
+	scribe.RecordEvidence(true)
+	defer scribe.RecordEvidence(false)
+	recorded := evidenceAnalyze(t, docstr)
+	var buf bytes.Buffer
+	err := scribe.WriteEvidence(&buf)
+	if err != nil {
+		t.Fatalf("scribe.WriteEvidence: %v", err)
+	}
+
+	// Remove the host data, and disable test hooks so package data can
+	// only come from the evidence.
+	err = os.RemoveAll(root)
+	if err != nil {
+		t.Fatalf("os.RemoveAll: %v", err)
+	}
+	scribe.TestHooks(false)
+	defer scribe.TestHooks(true)
+	err = scribe.ReplayEvidence(&buf)
+	if err != nil {
+		t.Fatalf("scribe.ReplayEvidence: %v", err)
+	}
+	defer scribe.ReplayEvidence(nil)
+	replayed := evidenceAnalyze(t, docstr)
+
+	if len(recorded) == 0 {
+		t.Fatalf("no results recorded")
+	}
+	if strings.Join(recorded, "\n") != strings.Join(replayed, "\n") {
+		t.Fatalf("replayed results differ:\n%v\n---\n%v",
+			strings.Join(recorded, "\n"), strings.Join(replayed, "\n"))
+	}
+	for _, x := range recorded {
+		if strings.Contains(x, "false") {
+			t.Fatalf("unexpected false result: %v", x)
+		}
+	}
+
+	// Sources that are not satisfied from the evidence do not read the
+	// host, resulting in an error, or are not applicable with partial
+	// evaluation.
+	for _, partial := range []bool{false, true} {
+		scribe.SetPartialEvaluation(partial)
+		doc, err := scribe.LoadDocument(strings.NewReader(fmt.Sprintf(evidenceStatDoc, root)))
+		scribe.SetPartialEvaluation(false)
+		if err != nil {
+			t.Fatalf("scribe.LoadDocument: %v", err)
+		}
+		err = scribe.AnalyzeDocument(doc)
+		if err != nil {
+			t.Fatalf("scribe.AnalyzeDocument: %v", err)
+		}
+		tr, err := scribe.GetResults(&doc, "config-mode")
+		if err != nil {
+			t.Fatalf("scribe.GetResults: %v", err)
+		}
+		if partial && !tr.NotApplicable || !partial && !tr.IsError {
+			t.Fatalf("filestat should not be evaluated from evidence: %v", tr.String())
+		}
+	}
+}
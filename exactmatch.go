@@ -7,15 +7,47 @@
 
 package scribe
 
+import (
+	"fmt"
+)
+
 // ExactMatch is used to indicate a test should match Value exactly against
 // the referenced object
+//
+// If Type is set, the test value and Value are compared as values of the
+// type instead of as strings (see CompareTest), for example with a type of
+// bool "yes" matches "true", and with a type of int "022" matches "22".
 type ExactMatch struct {
 	Value string `json:"value,omitempty" yaml:"value,omitempty"`
+	Type  string `json:"type,omitempty" yaml:"type,omitempty"`
+
+	value typedValue
+}
+
+func (e *ExactMatch) validate() error {
+	var err error
+	e.value, err = parseTypedValue(e.Type, e.Value)
+	if err != nil {
+		return fmt.Errorf("exactmatch: %v", err)
+	}
+	return nil
 }
 
 func (e *ExactMatch) evaluate(c evaluationCriteria) (ret evaluationResult, err error) {
 	debugPrint("evaluate(): exactmatch %v \"%v\", \"%v\"\n", c.identifier, c.testValue, e.Value)
 	ret.criteria = c
+	if e.Type != "" {
+		v, err := parseTypedValue(e.Type, c.testValue)
+		if err != nil {
+			return ret, fmt.Errorf("%v: %v", c.identifier, err)
+		}
+		r, err := v.compare(e.value)
+		if err != nil {
+			return ret, err
+		}
+		ret.result = r == 0
+		return ret, nil
+	}
 	if c.testValue == e.Value {
 		ret.result = true
 	}
@@ -0,0 +1,86 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// ExpressionExample is an example line for the expression of a filecontent
+// object, and the expected result of matching it, so changes to the
+// expression can be checked against known inputs using VerifyExamples().
+// Match is true if the expression should match the line. If Groups is set
+// the values captured by the groups of the expression must equal Groups.
+type ExpressionExample struct {
+	Input  string   `json:"input" yaml:"input"`
+	Match  bool     `json:"match,omitempty" yaml:"match,omitempty"`
+	Groups []string `json:"groups,omitempty" yaml:"groups,omitempty"`
+}
+
+// ExampleResult is the outcome of checking an expression example. If the
+// example failed Reason describes the difference from the expected result.
+type ExampleResult struct {
+	Object string `json:"object"`
+	Input  string `json:"input"`
+	Passed bool   `json:"passed"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// VerifyExamples checks the examples of each filecontent object in the
+// document against its expression, returning a result for each example.
+// Examples are not used when documents are evaluated.
+func (d *Document) VerifyExamples() []ExampleResult {
+	ret := make([]ExampleResult, 0)
+	for _, x := range d.Objects {
+		if len(x.FileContent.Examples) == 0 {
+			continue
+		}
+		re, err := regexp.Compile(x.FileContent.Expression)
+		for _, y := range x.FileContent.Examples {
+			r := ExampleResult{Object: x.Object, Input: y.Input}
+			if err != nil {
+				r.Reason = err.Error()
+			} else {
+				r.Reason = checkExample(re, y)
+			}
+			r.Passed = r.Reason == ""
+			debugPrint("VerifyExamples(): %v %q passed %v\n", x.Object, y.Input, r.Passed)
+			ret = append(ret, r)
+		}
+	}
+	return ret
+}
+
+// Return why the example does not have the expected result, or an empty
+// string if it does.
+func checkExample(re *regexp.Regexp, e ExpressionExample) string {
+	m := re.FindStringSubmatch(e.Input)
+	if m == nil {
+		if e.Match {
+			return "expression does not match"
+		}
+		return ""
+	}
+	if !e.Match {
+		return "expression matches"
+	}
+	if len(e.Groups) == 0 {
+		return ""
+	}
+	groups := m[1:]
+	if len(groups) != len(e.Groups) {
+		return fmt.Sprintf("expression captured %v groups, expected %v", len(groups), len(e.Groups))
+	}
+	for i := range groups {
+		if groups[i] != e.Groups[i] {
+			return fmt.Sprintf("group %v captured %q, expected %q", i+1, groups[i], e.Groups[i])
+		}
+	}
+	return ""
+}
@@ -0,0 +1,80 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mozilla/scribe"
+)
+
+var examplesDoc = `
+objects:
+- object: sshd-root-login
+  filecontent:
+    path: /etc/ssh
+    file: ^sshd_config$
+    expression: ^PermitRootLogin\s+(\S+)
+    examples:
+    - input: PermitRootLogin no
+      match: true
+      groups: ["no"]
+    - input: "  PermitRootLogin yes"
+      match: true
+    - input: "#PermitRootLogin yes"
+    - input: PermitRootLogin prohibit-password
+      match: true
+      groups: ["without-password"]
+- object: ntp-server
+  filecontent:
+    path: /etc
+    file: ^chrony.conf$
+    expression: ^server\s+(\S+)
+    examples:
+    - input: pool 2.pool.ntp.org iburst
+- object: sshd-root-login-copy
+  filecontent:
+    path: /etc/ssh
+    file: ^sshd_config$
+    expression: ^PermitRootLogin\s+(\S+)
+tests:
+- test: root-login
+  object: sshd-root-login
+  exactmatch:
+    value: "no"
+`
+
+func TestVerifyExamples(t *testing.T) {
+	doc, err := scribe.LoadDocument(strings.NewReader(examplesDoc))
+	if err != nil {
+		t.Fatalf("scribe.LoadDocument: %v", err)
+	}
+	res := doc.VerifyExamples()
+	expect := []scribe.ExampleResult{
+		{Object: "sshd-root-login", Input: "PermitRootLogin no", Passed: true},
+		{Object: "sshd-root-login", Input: "  PermitRootLogin yes", Reason: "expression does not match"},
+		{Object: "sshd-root-login", Input: "#PermitRootLogin yes", Passed: true},
+		{Object: "sshd-root-login", Input: "PermitRootLogin prohibit-password",
+			Reason: `group 1 captured "prohibit-password", expected "without-password"`},
+		{Object: "ntp-server", Input: "pool 2.pool.ntp.org iburst", Passed: true},
+	}
+	if !reflect.DeepEqual(res, expect) {
+		t.Fatalf("unexpected example results %+v", res)
+	}
+
+	// Examples do not prevent identical objects being merged.
+	ndoc, err := doc.Normalize()
+	if err != nil {
+		t.Fatalf("Document.Normalize: %v", err)
+	}
+	if len(ndoc.Objects) != 2 {
+		t.Fatalf("expected objects with and without examples to be merged, got %v objects", len(ndoc.Objects))
+	}
+}
@@ -0,0 +1,206 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Explanation is a trace of the evaluation of a test, describing the object
+// and source that produced the criteria, the evaluator and parameters that
+// were applied to them, and why each criteria and the test itself evaluated
+// the way they did.
+type Explanation struct {
+	TestID string `json:"test" yaml:"test"`
+	Object string `json:"object" yaml:"object"`
+
+	Source           string      `json:"source" yaml:"source"`                                         // The type of source, such as filecontent.
+	SourceParameters interface{} `json:"sourceparameters,omitempty" yaml:"sourceparameters,omitempty"` // The source as specified in the document.
+
+	Evaluator           string      `json:"evaluator" yaml:"evaluator"`                                         // The evaluator, such as regexp, or none.
+	EvaluatorParameters interface{} `json:"evaluatorparameters,omitempty" yaml:"evaluatorparameters,omitempty"` // The evaluator as specified in the document.
+
+	Criteria     []ExplainedCriteria `json:"criteria" yaml:"criteria"`
+	Dependencies []Explanation       `json:"dependencies,omitempty" yaml:"dependencies,omitempty"` // Explanations for tests in If.
+
+	MasterResult bool   `json:"masterresult" yaml:"masterresult"`
+	Error        string `json:"error,omitempty" yaml:"error,omitempty"`
+	Reason       string `json:"reason" yaml:"reason"` // Why the test has its master result.
+}
+
+// ExplainedCriteria describes a single criteria returned by the object and
+// the result of applying the evaluator to it.
+type ExplainedCriteria struct {
+	Identifier string    `json:"identifier" yaml:"identifier"`
+	Value      string    `json:"value" yaml:"value"` // The value, with any redactions applied.
+	Location   *Location `json:"location,omitempty" yaml:"location,omitempty"`
+	Result     bool      `json:"result" yaml:"result"`
+	Reason     string    `json:"reason" yaml:"reason"`
+}
+
+// Evaluators can implement explainer to describe why a criteria evaluated
+// to a given result. Evaluators that do not implement it are described
+// using a generic reason.
+type explainer interface {
+	explain(evaluationResult) string
+}
+
+// ExplainTest evaluates the test with identifier testid on the host system,
+// in the same way as EvaluateTest(), and returns a trace of the evaluation
+// explaining the result. The document itself is not modified.
+func (d *Document) ExplainTest(testid string) (Explanation, error) {
+	nd, err := d.evaluateSubset(testid)
+	if err != nil {
+		return Explanation{}, err
+	}
+	return nd.explain(testid, make(map[string]bool))
+}
+
+func (d *Document) explain(testid string, seen map[string]bool) (Explanation, error) {
+	t, err := d.GetTest(testid)
+	if err != nil {
+		return Explanation{}, err
+	}
+	ret := Explanation{TestID: t.TestID, Object: t.Object, Criteria: make([]ExplainedCriteria, 0)}
+	seen[testid] = true
+	for _, x := range t.If {
+		if seen[x] {
+			continue
+		}
+		dep, err := d.explain(x, seen)
+		if err != nil {
+			return Explanation{}, err
+		}
+		ret.Dependencies = append(ret.Dependencies, dep)
+	}
+
+	if t.notApplicable != "" {
+		ret.Reason = fmt.Sprintf("the test is not applicable: %v", t.notApplicable)
+		return ret, nil
+	}
+	o, err := d.GetObject(t.Object)
+	if err != nil {
+		return Explanation{}, err
+	}
+	ret.Source, ret.SourceParameters = fieldForInterface(o, o.getSourceInterface())
+	ev := t.getEvaluationInterface()
+	if _, ok := ev.(*noop); ok {
+		ret.Evaluator = "none"
+	} else {
+		ret.Evaluator, ret.EvaluatorParameters = fieldForInterface(t, ev)
+	}
+
+	if t.err != nil {
+		ret.Error = t.err.Error()
+		ret.Reason = fmt.Sprintf("the test could not be evaluated: %v", t.err)
+		return ret, nil
+	}
+	ntrue := 0
+	for _, x := range t.results {
+		ec := ExplainedCriteria{
+			Identifier: x.criteria.identifier,
+			Value:      redact(x.criteria.testValue),
+			Location:   x.criteria.location,
+			Result:     x.result,
+		}
+		if e, ok := ev.(explainer); ok {
+			ec.Reason = e.explain(x)
+		} else {
+			ec.Reason = fmt.Sprintf("%v evaluator returned %v", ret.Evaluator, x.result)
+		}
+		if x.result {
+			ntrue++
+		}
+		ret.Criteria = append(ret.Criteria, ec)
+	}
+	ret.MasterResult = t.masterResult
+	ret.Reason = explainMasterResult(d, t, ev, ntrue)
+	return ret, nil
+}
+
+// Describe why the test has its master result.
+func explainMasterResult(d *Document, t *Test, ev genericEvaluator, ntrue int) string {
+	for _, x := range t.If {
+		dt, err := d.GetTest(x)
+		if err == nil && !dt.masterResult {
+			return fmt.Sprintf("dependency %v is false", x)
+		}
+	}
+	if _, ok := ev.(setEvaluator); ok {
+		return fmt.Sprintf("the evaluator compared all %v criteria together and returned %v",
+			len(t.results), t.masterResult)
+	}
+	if len(t.results) == 0 {
+		return "the object returned no criteria"
+	}
+	if ntrue == 0 {
+		return fmt.Sprintf("none of the %v criteria were true", len(t.results))
+	}
+	return fmt.Sprintf("%v of %v criteria were true", ntrue, len(t.results))
+}
+
+// Return the name (from the JSON field tag) and value of the field of the
+// struct pointed to by s that ptr points to, used to identify the source of
+// an object or evaluator of a test.
+func fieldForInterface(s interface{}, ptr interface{}) (string, interface{}) {
+	v := reflect.ValueOf(s).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		if !f.CanAddr() || !f.Addr().CanInterface() || f.Addr().Interface() != ptr {
+			continue
+		}
+		name := strings.Split(v.Type().Field(i).Tag.Get("json"), ",")[0]
+		return name, f.Interface()
+	}
+	return "unknown", nil
+}
+
+func (n *noop) explain(r evaluationResult) string {
+	return "the test has no evaluator, every criteria is true"
+}
+
+func (e *ExactMatch) explain(r evaluationResult) string {
+	if r.result {
+		return fmt.Sprintf("value is equal to %q", e.Value)
+	}
+	return fmt.Sprintf("value is not equal to %q", e.Value)
+}
+
+func (r *Regex) explain(res evaluationResult) string {
+	if res.result {
+		return fmt.Sprintf("value matches expression %q", r.Value)
+	}
+	return fmt.Sprintf("value does not match expression %q", r.Value)
+}
+
+func (c *CompareTest) explain(r evaluationResult) string {
+	if r.result {
+		return fmt.Sprintf("%v comparison %v %v is true", c.Type, c.Operation, c.Value)
+	}
+	return fmt.Sprintf("%v comparison %v %v is false", c.Type, c.Operation, c.Value)
+}
+
+func (c *CustomTest) explain(r evaluationResult) string {
+	return fmt.Sprintf("custom evaluator %v returned %v", c.Type, r.result)
+}
+
+func (s *ScriptTest) explain(r evaluationResult) string {
+	if s.message != "" {
+		return fmt.Sprintf("script returned %v: %v", r.result, s.message)
+	}
+	return fmt.Sprintf("script returned %v", r.result)
+}
+
+func (e *EVRTest) explain(r evaluationResult) string {
+	if r.result {
+		return fmt.Sprintf("version comparison %v %v is true", e.Operation, e.Value)
+	}
+	return fmt.Sprintf("version comparison %v %v is false", e.Operation, e.Value)
+}
@@ -0,0 +1,27 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+// SetEnumerateHook sets a function called with the root of each shared file
+// system enumeration before the file system is walked, so tests can observe
+// enumerations.
+func SetEnumerateHook(f func(root string)) {
+	enumerateHook = f
+}
+
+// OpenAsOwner opens a file as openAsOwner does for the AsOwner locator
+// option.
+var OpenAsOwner = openAsOwner
+
+// SetMountTablePath sets the mount table used to determine the file system
+// type of located files, returning the previous path.
+func SetMountTablePath(p string) string {
+	old := mountTablePath
+	mountTablePath = p
+	return old
+}
@@ -0,0 +1,395 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// FileAttr is used to perform tests against the access control lists and
+// extended attributes of files located on the file system, for example to
+// find binaries granted unexpected file capabilities. Extended attributes
+// are only available on Linux; on other platforms no criteria are returned.
+//
+// Files are located using Path and File in the same way as for FileName.
+// Property specifies what is returned as the test value for each file, and
+// can be one of:
+//
+// acl: each entry in the POSIX access control list of the file in the form
+// used by getfacl, such as user:alice:rw- or other::r--, with a criteria
+// returned for each entry. Files without an extended access control list
+// return the entries corresponding to the permission bits of the file.
+// Entries in the default access control list of a directory are prefixed
+// with default:.
+//
+// capability: the file capabilities of the file in the form used by
+// getcap, such as cap_net_raw=ep, if the file has capabilities.
+//
+// xattr: each extended attribute of the file with a name matching the
+// regular expression in Attribute (for example ^user\.), in the form
+// name=value. Values that are not printable text are shown in hex, prefixed
+// with 0x.
+type FileAttr struct {
+	Path      string `json:"path,omitempty" yaml:"path,omitempty"`
+	File      string `json:"file,omitempty" yaml:"file,omitempty"`
+	Property  string `json:"property,omitempty" yaml:"property,omitempty"`
+	Attribute string `json:"attribute,omitempty" yaml:"attribute,omitempty"`
+
+	LocatorOptions `yaml:",inline"`
+
+	fileRe  compiledRegexp
+	attrRe  compiledRegexp
+	matches []fileAttrMatch
+}
+
+type fileAttrMatch struct {
+	path  string
+	value string
+}
+
+// Extended attributes used to store access control lists and capabilities.
+const (
+	xattrACLAccess  = "system.posix_acl_access"
+	xattrACLDefault = "system.posix_acl_default"
+	xattrCapability = "security.capability"
+)
+
+func (f *FileAttr) isChain() bool {
+	return false
+}
+
+func (f *FileAttr) fireChains(d *Document) ([]evaluationCriteria, error) {
+	return nil, nil
+}
+
+func (f *FileAttr) mergeCriteria(c []evaluationCriteria) {
+}
+
+func (f *FileAttr) validate(d *Document) error {
+	if len(f.Path) == 0 {
+		return fmt.Errorf("fileattr path must be set")
+	}
+	if len(f.File) == 0 {
+		return fmt.Errorf("fileattr file must be set")
+	}
+	_, err := f.fileRe.compile(f.fileExpression(f.File))
+	if err != nil {
+		return err
+	}
+	switch f.Property {
+	case "acl", "capability":
+	case "xattr":
+		if f.Attribute == "" {
+			return fmt.Errorf("fileattr attribute must be set for property xattr")
+		}
+		_, err = f.attrRe.compile(f.Attribute)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("fileattr property must be acl, capability or xattr")
+	}
+	return nil
+}
+
+func (f *FileAttr) expandVariables(v []Variable) {
+	f.Path = variableExpansion(v, f.Path)
+	f.File = variableExpansion(v, f.File)
+}
+
+func (f *FileAttr) getCriteria() (ret []evaluationCriteria) {
+	for _, x := range f.matches {
+		n := evaluationCriteria{}
+		n.identifier = x.path
+		n.testValue = x.value
+		ret = append(ret, n)
+	}
+	return ret
+}
+
+func (f *FileAttr) prepare() error {
+	debugPrint("prepare(): analyzing file system, path %v, file \"%v\"\n", f.Path, f.File)
+
+	re, err := f.fileRe.compile(f.fileExpression(f.File))
+	if err != nil {
+		return err
+	}
+
+	sfl := newSimpleFileLocator()
+	sfl.root = f.Path
+	sfl.opts = f.LocatorOptions
+	err = sfl.locateRegexp(re)
+	if err != nil {
+		return err
+	}
+
+	for _, x := range sfl.matches {
+		values, err := f.fileValues(x)
+		if err != nil {
+			debugPrint("prepare(): skipping %v: %v\n", x, err)
+			continue
+		}
+		for _, y := range values {
+			debugPrint("prepare(): %v %v: %v\n", x, f.Property, y)
+			f.matches = append(f.matches, fileAttrMatch{path: sfl.identifier(x), value: y})
+		}
+	}
+	return nil
+}
+
+func (f *FileAttr) fileValues(path string) ([]string, error) {
+	attrs, err := getFileXattrs(path)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]string, 0)
+	switch f.Property {
+	case "acl":
+		if buf, ok := attrs[xattrACLAccess]; ok {
+			ret, err = parsePosixACL(buf, "")
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			fi, err := os.Stat(path)
+			if err != nil {
+				return nil, err
+			}
+			ret = modeACL(fi.Mode())
+		}
+		if buf, ok := attrs[xattrACLDefault]; ok {
+			l, err := parsePosixACL(buf, "default:")
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, l...)
+		}
+	case "capability":
+		if buf, ok := attrs[xattrCapability]; ok {
+			s, err := parseFileCapability(buf)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, s)
+		}
+	case "xattr":
+		re, err := f.attrRe.compile(f.Attribute)
+		if err != nil {
+			return nil, err
+		}
+		names := make([]string, 0)
+		for k := range attrs {
+			if re.MatchString(k) {
+				names = append(names, k)
+			}
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			ret = append(ret, k+"="+xattrValueString(attrs[k]))
+		}
+	}
+	return ret, nil
+}
+
+func getFileXattrs(path string) (map[string][]byte, error) {
+	if sRuntime.testHooks {
+		return testFileXattrs[filepath.Base(path)], nil
+	}
+	return fileXattrs(path)
+}
+
+// Return v as a string if it is printable text, otherwise in hex.
+func xattrValueString(v []byte) string {
+	s := strings.TrimRight(string(v), "\x00")
+	if !utf8.ValidString(s) {
+		return "0x" + hex.EncodeToString(v)
+	}
+	for _, c := range s {
+		if !unicode.IsPrint(c) {
+			return "0x" + hex.EncodeToString(v)
+		}
+	}
+	return s
+}
+
+// Return the access control list entries equivalent to permission bits m.
+func modeACL(m os.FileMode) []string {
+	p := uint16(m.Perm())
+	return []string{
+		"user::" + aclPermString(p>>6),
+		"group::" + aclPermString(p>>3),
+		"other::" + aclPermString(p),
+	}
+}
+
+func aclPermString(p uint16) string {
+	ret := []byte("---")
+	if p&4 != 0 {
+		ret[0] = 'r'
+	}
+	if p&2 != 0 {
+		ret[1] = 'w'
+	}
+	if p&1 != 0 {
+		ret[2] = 'x'
+	}
+	return string(ret)
+}
+
+// Parse a POSIX access control list in the format stored in extended
+// attributes by Linux, a version header followed by entries of a tag,
+// permissions and user or group ID. Entries are returned in the form used
+// by getfacl, each prefixed with prefix.
+func parsePosixACL(buf []byte, prefix string) ([]string, error) {
+	if len(buf) < 4 || binary.LittleEndian.Uint32(buf) != 2 || (len(buf)-4)%8 != 0 {
+		return nil, fmt.Errorf("invalid access control list")
+	}
+	ret := make([]string, 0)
+	for i := 4; i < len(buf); i += 8 {
+		tag := binary.LittleEndian.Uint16(buf[i:])
+		perm := aclPermString(binary.LittleEndian.Uint16(buf[i+2:]))
+		id := strconv.FormatUint(uint64(binary.LittleEndian.Uint32(buf[i+4:])), 10)
+		var e string
+		switch tag {
+		case 0x01:
+			e = "user::" + perm
+		case 0x02:
+			if u, err := user.LookupId(id); err == nil {
+				id = u.Username
+			}
+			e = "user:" + id + ":" + perm
+		case 0x04:
+			e = "group::" + perm
+		case 0x08:
+			if g, err := user.LookupGroupId(id); err == nil {
+				id = g.Name
+			}
+			e = "group:" + id + ":" + perm
+		case 0x10:
+			e = "mask::" + perm
+		case 0x20:
+			e = "other::" + perm
+		default:
+			return nil, fmt.Errorf("invalid access control list tag %v", tag)
+		}
+		ret = append(ret, prefix+e)
+	}
+	return ret, nil
+}
+
+// Capability names indexed by capability number.
+var capabilityNames = []string{
+	"cap_chown", "cap_dac_override", "cap_dac_read_search", "cap_fowner",
+	"cap_fsetid", "cap_kill", "cap_setgid", "cap_setuid", "cap_setpcap",
+	"cap_linux_immutable", "cap_net_bind_service", "cap_net_broadcast",
+	"cap_net_admin", "cap_net_raw", "cap_ipc_lock", "cap_ipc_owner",
+	"cap_sys_module", "cap_sys_rawio", "cap_sys_chroot", "cap_sys_ptrace",
+	"cap_sys_pacct", "cap_sys_admin", "cap_sys_boot", "cap_sys_nice",
+	"cap_sys_resource", "cap_sys_time", "cap_sys_tty_config", "cap_mknod",
+	"cap_lease", "cap_audit_write", "cap_audit_control", "cap_setfcap",
+	"cap_mac_override", "cap_mac_admin", "cap_syslog", "cap_wake_alarm",
+	"cap_block_suspend", "cap_audit_read", "cap_perfmon", "cap_bpf",
+	"cap_checkpoint_restore",
+}
+
+// Parse file capabilities in the format stored in the security.capability
+// extended attribute, returning them in the form used by getcap, with
+// capabilities having the same flags grouped together (for example
+// cap_net_admin,cap_net_raw=ep).
+func parseFileCapability(buf []byte) (string, error) {
+	if len(buf) < 4 {
+		return "", fmt.Errorf("invalid file capability")
+	}
+	magic := binary.LittleEndian.Uint32(buf)
+	var words int
+	switch magic & 0xff000000 {
+	case 0x01000000:
+		words = 1
+	case 0x02000000, 0x03000000:
+		words = 2
+	default:
+		return "", fmt.Errorf("unknown file capability revision %x", magic>>24)
+	}
+	if len(buf) < 4+words*8 {
+		return "", fmt.Errorf("invalid file capability")
+	}
+	var permitted, inheritable uint64
+	for i := 0; i < words; i++ {
+		permitted |= uint64(binary.LittleEndian.Uint32(buf[4+i*8:])) << uint(32*i)
+		inheritable |= uint64(binary.LittleEndian.Uint32(buf[8+i*8:])) << uint(32*i)
+	}
+	effective := magic&1 != 0
+	groups := make(map[string][]string)
+	order := make([]string, 0)
+	for i := uint(0); i < 64; i++ {
+		flags := ""
+		if effective && permitted&(1<<i) != 0 {
+			flags += "e"
+		}
+		if inheritable&(1<<i) != 0 {
+			flags += "i"
+		}
+		if permitted&(1<<i) != 0 {
+			flags += "p"
+		}
+		if flags == "" {
+			continue
+		}
+		name := fmt.Sprintf("cap_%v", i)
+		if int(i) < len(capabilityNames) {
+			name = capabilityNames[i]
+		}
+		if _, ok := groups[flags]; !ok {
+			order = append(order, flags)
+		}
+		groups[flags] = append(groups[flags], name)
+	}
+	l := make([]string, 0, len(order))
+	for _, x := range order {
+		l = append(l, strings.Join(groups[x], ",")+"="+x)
+	}
+	return strings.Join(l, " "), nil
+}
+
+// Functions and data related to file attribute tests
+
+// Extended attributes returned for files in test/fileattr, by file name.
+var testFileXattrs = map[string]map[string][]byte{
+	"ping": {
+		// cap_net_raw=ep, revision 2
+		xattrCapability: {0x01, 0x00, 0x00, 0x02, 0x00, 0x20, 0x00, 0x00,
+			0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+	},
+	"backup": {
+		// cap_dac_read_search,cap_setuid=ep, revision 2
+		xattrCapability: {0x01, 0x00, 0x00, 0x02, 0x84, 0x00, 0x00, 0x00,
+			0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+		"user.origin": []byte("https://example.com/backup"),
+	},
+	"shared": {
+		// user::rw-, user:4242:rwx, group::r--, mask::rwx, other::r--
+		xattrACLAccess: {0x02, 0x00, 0x00, 0x00,
+			0x01, 0x00, 0x06, 0x00, 0xff, 0xff, 0xff, 0xff,
+			0x02, 0x00, 0x07, 0x00, 0x92, 0x10, 0x00, 0x00,
+			0x04, 0x00, 0x04, 0x00, 0xff, 0xff, 0xff, 0xff,
+			0x10, 0x00, 0x07, 0x00, 0xff, 0xff, 0xff, 0xff,
+			0x20, 0x00, 0x04, 0x00, 0xff, 0xff, 0xff, 0xff},
+		"user.checksum": {0xde, 0xad, 0xbe, 0xef},
+		"trusted.note":  []byte("hidden"),
+	},
+}
@@ -0,0 +1,113 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// Used in TestFileAttrPolicy
+var fileAttrPolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "capabilities",
+		"fileattr": {
+			"path": "./test/fileattr",
+			"file": ".*",
+			"property": "capability"
+		}
+	},
+
+	{
+		"object": "shared-acl",
+		"fileattr": {
+			"path": "./test/fileattr",
+			"file": "^shared$",
+			"property": "acl"
+		}
+	},
+
+	{
+		"object": "user-xattrs",
+		"fileattr": {
+			"path": "./test/fileattr",
+			"file": ".*",
+			"property": "xattr",
+			"attribute": "^user\\."
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "fileattr0",
+		"expectedresult": true,
+		"object": "capabilities",
+		"regexp": {
+			"value": "cap_setuid"
+		}
+	},
+
+	{
+		"test": "fileattr1",
+		"expectedresult": true,
+		"object": "capabilities",
+		"exactmatch": {
+			"value": "cap_net_raw=ep"
+		}
+	},
+
+	{
+		"test": "fileattr2",
+		"expectedresult": true,
+		"object": "shared-acl",
+		"regexp": {
+			"value": "^user:[^:]+:rwx$"
+		}
+	},
+
+	{
+		"test": "fileattr3",
+		"expectedresult": true,
+		"object": "user-xattrs",
+		"exactmatch": {
+			"value": "user.checksum=0xdeadbeef"
+		}
+	}
+	]
+}
+`
+
+func TestFileAttrPolicy(t *testing.T) {
+	doc := genericTestExec(t, fileAttrPolicyDoc)
+	expect := map[string][]string{
+		"fileattr0": {"backup:cap_dac_read_search,cap_setuid=ep", "ping:cap_net_raw=ep"},
+		"fileattr2": {"shared:user::rw-", "shared:user:4242:rwx", "shared:group::r--",
+			"shared:mask::rwx", "shared:other::r--"},
+		"fileattr3": {"backup:user.origin=https://example.com/backup", "shared:user.checksum=0xdeadbeef"},
+	}
+	for k, v := range expect {
+		e, err := doc.ExplainTest(k)
+		if err != nil {
+			t.Fatalf("Document.ExplainTest: %v", err)
+		}
+		got := make([]string, 0)
+		for _, x := range e.Criteria {
+			got = append(got, filepath.Base(x.Identifier)+":"+x.Value)
+		}
+		sort.Strings(got)
+		sort.Strings(v)
+		if !reflect.DeepEqual(got, v) {
+			t.Fatalf("%v: unexpected criteria %v", k, got)
+		}
+	}
+}
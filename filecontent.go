@@ -8,39 +8,99 @@
 package scribe
 
 import (
-	"bufio"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
+	"strconv"
+	"strings"
 )
 
 // FileContent is used to perform tests against the content of a given file
 // on the file system.
+//
+// By default the identifier of each criteria is the path of the file the
+// match was found in. IdentifierFormat can be used to include additional
+// information in the identifier, so the exact location that resulted in a
+// criteria can be determined. The format can contain the following tokens:
+//
+// {path}: the path of the file
+//
+// {line}: the line number of the match
+//
+// {match}: the index of the match in the file, starting at 1
+//
+// {group}: the name of the capture group the value was captured by, or the
+// index of the group if it is not named
+//
+// For example, a format of {path}:{line} results in identifiers such as
+// /etc/ssh/sshd_config:32.
+//
+// If Context is set, the specified number of lines before and after each
+// match are captured and included in the results along with the matching
+// line, so matches can be reviewed without access to the host. Captured
+// lines are redacted using the expressions installed with SetRedactions().
+//
+// MaxMatchesPerFile limits the number of matching lines read from each file,
+// and StopOnFirstMatch stops the search once any file contains a match.
+// These avoid reading large files (such as logs) in their entirety when a
+// single match is sufficient.
+//
+// TailBytes and TailLines limit the search to lines at the end of each
+// file, either the lines starting within the last TailBytes bytes or the
+// last TailLines lines. If Reverse is set, lines are read starting at the
+// end of the file, so matches are returned most recent first; combined with
+// MaxMatchesPerFile this finds the most recent entries in a log without
+// reading it from the start. When any of these are set the file is read
+// from the end, and the line numbers of matches are not known.
+//
+// Examples are lines the expression is expected to match or not match,
+// checked using Document.VerifyExamples() so regressions are caught when the
+// expression is edited.
 type FileContent struct {
-	Path       string `json:"path,omitempty" yaml:"path,omitempty"`
-	File       string `json:"file,omitempty" yaml:"file,omitempty"`
-	Expression string `json:"expression,omitempty" yaml:"expression,omitempty"`
-	Concat     string `json:"concat,omitempty" yaml:"concat,omitempty"`
+	Path              string `json:"path,omitempty" yaml:"path,omitempty"`
+	File              string `json:"file,omitempty" yaml:"file,omitempty"`
+	Expression        string `json:"expression,omitempty" yaml:"expression,omitempty"`
+	Concat            string `json:"concat,omitempty" yaml:"concat,omitempty"`
+	IdentifierFormat  string `json:"identifierformat,omitempty" yaml:"identifierformat,omitempty"`
+	Context           int    `json:"context,omitempty" yaml:"context,omitempty"`
+	MaxMatchesPerFile int    `json:"maxmatchesperfile,omitempty" yaml:"maxmatchesperfile,omitempty"`
+	StopOnFirstMatch  bool   `json:"stoponfirstmatch,omitempty" yaml:"stoponfirstmatch,omitempty"`
+	TailBytes         int64  `json:"tailbytes,omitempty" yaml:"tailbytes,omitempty"`
+	TailLines         int    `json:"taillines,omitempty" yaml:"taillines,omitempty"`
+	Reverse           bool   `json:"reverse,omitempty" yaml:"reverse,omitempty"`
+
+	Examples []ExpressionExample `json:"examples,omitempty" yaml:"examples,omitempty"`
 
 	ImportChain []string `json:"import-chain,omitempty" yaml:"import-chain,omitempty"`
 
+	LocatorOptions `yaml:",inline"`
+
+	fileRe  compiledRegexp
+	exprRe  compiledRegexp
 	matches []contentMatch
 }
 
 type contentMatch struct {
-	path    string
-	matches []matchLine
+	path       string
+	identifier string
+	matches    []matchLine
 }
 
 type matchLine struct {
 	fullmatch string
 	groups    []string
+	located   bool  // Set if the match was read from a file.
+	line      int   // The line number of the match, 0 if not known.
+	offset    int64 // The byte offset of the match in the file.
+	context   []string
 }
 
+// Tokens that can be used in FileContent identifier formats.
+var identifierFormatTokens = regexp.MustCompile(`\{[^}]*\}`)
+
 func (f *FileContent) validate(d *Document) error {
 	if len(f.Path) == 0 {
 		return fmt.Errorf("filecontent path must be set")
@@ -48,17 +108,33 @@ func (f *FileContent) validate(d *Document) error {
 	if len(f.File) == 0 {
 		return fmt.Errorf("filecontent file must be set")
 	}
-	_, err := regexp.Compile(f.File)
+	_, err := f.fileRe.compile(f.fileExpression(f.File))
 	if err != nil {
 		return err
 	}
 	if len(f.Expression) == 0 {
 		return fmt.Errorf("filecontent expression must be set")
 	}
-	_, err = regexp.Compile(f.Expression)
+	if f.Context < 0 {
+		return fmt.Errorf("filecontent context must not be negative")
+	}
+	if f.MaxMatchesPerFile < 0 {
+		return fmt.Errorf("filecontent maxmatchesperfile must not be negative")
+	}
+	if f.TailBytes < 0 || f.TailLines < 0 {
+		return fmt.Errorf("filecontent tailbytes and taillines must not be negative")
+	}
+	_, err = f.exprRe.compile(f.Expression)
 	if err != nil {
 		return err
 	}
+	for _, x := range identifierFormatTokens.FindAllString(f.IdentifierFormat, -1) {
+		switch x {
+		case "{path}", "{line}", "{match}", "{group}":
+		default:
+			return fmt.Errorf("filecontent identifier format has unknown token %v", x)
+		}
+	}
 	err = validateChains(f.ImportChain, d)
 	if err != nil {
 		return err
@@ -130,6 +206,7 @@ func (f *FileContent) mergeCriteria(c []evaluationCriteria) {
 		nml.groups = append(nml.groups, x.testValue)
 		ncm := contentMatch{}
 		ncm.path = x.identifier
+		ncm.identifier = x.identifier
 		ncm.matches = append(ncm.matches, nml)
 		f.matches = append(f.matches, ncm)
 	}
@@ -149,11 +226,14 @@ func (f *FileContent) expandVariables(v []Variable) {
 
 func (f *FileContent) getCriteria() (ret []evaluationCriteria) {
 	for _, x := range f.matches {
-		for _, y := range x.matches {
-			for _, z := range y.groups {
+		for i, y := range x.matches {
+			for j, z := range y.groups {
 				n := evaluationCriteria{}
-				n.identifier = x.path
+				n.identifier = f.criteriaIdentifier(x, i, y, j)
 				n.testValue = z
+				if y.located {
+					n.location = &Location{Line: y.line, Offset: y.offset, Context: y.context}
+				}
 				ret = append(ret, n)
 			}
 		}
@@ -164,18 +244,61 @@ func (f *FileContent) getCriteria() (ret []evaluationCriteria) {
 	return ret
 }
 
+// Return the identifier for group g of match m in the file described by c,
+// according to the identifier format.
+func (f *FileContent) criteriaIdentifier(c contentMatch, m int, ml matchLine, g int) string {
+	// Criteria merged from chains do not have a location.
+	if f.IdentifierFormat == "" || !ml.located {
+		return c.identifier
+	}
+	group := strconv.Itoa(g + 1)
+	if f.exprRe.re != nil {
+		names := f.exprRe.re.SubexpNames()
+		if g+1 < len(names) && names[g+1] != "" {
+			group = names[g+1]
+		}
+	}
+	return strings.NewReplacer(
+		"{path}", c.identifier,
+		"{line}", strconv.Itoa(ml.line),
+		"{match}", strconv.Itoa(m+1),
+		"{group}", group,
+	).Replace(f.IdentifierFormat)
+}
+
 func (f *FileContent) prepare() error {
 	debugPrint("prepare(): analyzing file system, path %v, file \"%v\"\n", f.Path, f.File)
 
+	filere, err := f.fileRe.compile(f.fileExpression(f.File))
+	if err != nil {
+		return err
+	}
+	exprre, err := f.exprRe.compile(f.Expression)
+	if err != nil {
+		return err
+	}
+
 	sfl := newSimpleFileLocator()
 	sfl.root = f.Path
-	err := sfl.locate(f.File, true)
+	sfl.opts = f.LocatorOptions
+	err = sfl.locateRegexp(filere)
 	if err != nil {
 		return err
 	}
 
+	opts := contentCheckOptions{
+		context:    f.Context,
+		maxMatches: f.MaxMatchesPerFile,
+		tailBytes:  f.TailBytes,
+		tailLines:  f.TailLines,
+		reverse:    f.Reverse,
+		locator:    f.LocatorOptions,
+	}
+	if f.StopOnFirstMatch {
+		opts.maxMatches = 1
+	}
 	for _, x := range sfl.matches {
-		m, err := fileContentCheck(x, f.Expression)
+		m, err := fileContentCheck(x, exprre, opts)
 		// XXX These soft errors during preparation are ignored right
 		// now, but they should probably be tracked somewhere.
 		if err != nil {
@@ -187,6 +310,7 @@ func (f *FileContent) prepare() error {
 
 		ncm := contentMatch{}
 		ncm.path = x
+		ncm.identifier = sfl.identifier(x)
 		ncm.matches = m
 		f.matches = append(f.matches, ncm)
 		debugPrint("prepare(): content matches in %v\n", ncm.path)
@@ -196,6 +320,10 @@ func (f *FileContent) prepare() error {
 				debugPrint("prepare(): group %v: \"%v\"\n", j, i.groups[j])
 			}
 		}
+		if f.StopOnFirstMatch {
+			debugPrint("prepare(): stopping after first match\n")
+			break
+		}
 	}
 
 	return nil
@@ -207,7 +335,19 @@ type simpleFileLocator struct {
 	curDepth int
 	maxDepth int
 	matches  []string
+	names    []string
+	ids      []fileID
 	locator  func(string, bool, string, int) ([]string, error)
+
+	opts    LocatorOptions
+	rootDev uint64
+	mounts  []mountEntry
+
+	absRoot    string
+	seenDirs   map[fileID]string
+	dirAliases map[string][]string
+	aliases    map[string][]string
+	users      map[string]string
 }
 
 func newSimpleFileLocator() (ret simpleFileLocator) {
@@ -222,10 +362,103 @@ func newSimpleFileLocator() (ret simpleFileLocator) {
 }
 
 func (s *simpleFileLocator) locate(target string, useRegexp bool) error {
+	if useRegexp {
+		re, err := regexp.Compile(target)
+		if err != nil {
+			return err
+		}
+		return s.locateRegexp(re)
+	}
+	return s.locateMatch(target, useRegexp, func(p string, name string) bool {
+		if s.opts.PathMatch {
+			return p == target
+		}
+		return name == target
+	})
+}
+
+// Locate files with names matching the compiled expression re, or with
+// paths matching re if the PathMatch option is set.
+func (s *simpleFileLocator) locateRegexp(re *regexp.Regexp) error {
+	return s.locateMatch(re.String(), true, func(p string, name string) bool {
+		if s.opts.PathMatch {
+			return re.MatchString(p)
+		}
+		return re.MatchString(name)
+	})
+}
+
+func (s *simpleFileLocator) locateMatch(target string, useRegexp bool, match locateMatchFunc) error {
 	if s.executed {
 		return fmt.Errorf("locator has already been executed")
 	}
 	s.executed = true
+	if strings.Contains(s.root, ",") || strings.Contains(s.root, homeDirsVariable) {
+		roots, users := expandHomeRoots(locatorRoots(s.root))
+		return s.locateRoots(roots, users, target, useRegexp, match)
+	}
+	if e := evidenceReplaying(); e != nil {
+		s.matches = e.locate(s.root, s.maxDepth, s.opts.Archives, match)
+		return nil
+	}
+	err := s.locateHost(target, useRegexp, match)
+	if err != nil {
+		return err
+	}
+	s.filterFiles()
+	if e := evidenceRecording(); e != nil {
+		e.addLocated(s.matches)
+	}
+	return nil
+}
+
+// Locate files under each of the roots in turn, merging the results. A file
+// located under more than one root is only included once. If the entry in
+// users for a root is set, files located under the root belong to the user.
+func (s *simpleFileLocator) locateRoots(roots []string, users []string, target string,
+	useRegexp bool, match locateMatchFunc) error {
+	seen := make(map[string]bool)
+	for n, x := range roots {
+		sub := newSimpleFileLocator()
+		sub.root = x
+		sub.maxDepth = s.maxDepth
+		sub.locator = s.locator
+		sub.opts = s.opts
+		err := sub.locateMatch(target, useRegexp, match)
+		if err != nil {
+			return err
+		}
+		for i, y := range sub.matches {
+			if seen[y] {
+				continue
+			}
+			seen[y] = true
+			var (
+				name string
+				id   fileID
+			)
+			if i < len(sub.names) {
+				name, id = sub.names[i], sub.ids[i]
+			}
+			s.addMatch(y, name, id)
+			if users[n] != "" {
+				if s.users == nil {
+					s.users = make(map[string]string)
+				}
+				s.users[y] = users[n]
+			}
+			if len(sub.aliases[y]) > 0 {
+				if s.aliases == nil {
+					s.aliases = make(map[string][]string)
+				}
+				s.aliases[y] = sub.aliases[y]
+			}
+		}
+	}
+	return nil
+}
+
+func (s *simpleFileLocator) locateHost(target string, useRegexp bool, match locateMatchFunc) error {
 	if s.locator != nil {
 		buf, err := s.locator(target, useRegexp, s.root, s.maxDepth)
 		if err != nil {
@@ -234,7 +467,104 @@ func (s *simpleFileLocator) locate(target string, useRegexp bool) error {
 		s.matches = buf
 		return nil
 	}
-	return s.locateInner(target, useRegexp, "")
+	if locateCacheActive() {
+		s.locateShared(match)
+		s.deduplicate()
+		return nil
+	}
+	if !s.prepareOptions() {
+		return nil
+	}
+	s.locateInner(match, "")
+	s.deduplicate()
+	return nil
+}
+
+// Add a located file to the matches, name is the name the target was
+// matched against and id identifies the file if deduplication is enabled.
+func (s *simpleFileLocator) addMatch(path string, name string, id fileID) {
+	s.matches = append(s.matches, path)
+	s.names = append(s.names, name)
+	s.ids = append(s.ids, id)
+}
+
+// Prepare any state required to apply the locator options, returns false if
+// the root itself is excluded by the options and no search should occur.
+func (s *simpleFileLocator) prepareOptions() bool {
+	if sRuntime.ignore != nil {
+		var err error
+		s.absRoot, err = filepath.Abs(s.root)
+		if err != nil {
+			return false
+		}
+		if sRuntime.ignore.Match(s.absRoot, true) {
+			debugPrint("locate(): root %v is ignored\n", s.root)
+			return false
+		}
+	}
+	if len(s.opts.SkipFSTypes) > 0 {
+		s.mounts = loadMountTable()
+		if s.opts.skipFSType(mountFSType(s.mounts, s.root)) {
+			debugPrint("locate(): root %v is on excluded file system type\n", s.root)
+			return false
+		}
+	}
+	if s.opts.NoCrossDevice {
+		fi, err := os.Stat(s.root)
+		if err != nil {
+			return true
+		}
+		s.rootDev, _ = fileDevice(fi)
+	}
+	if s.opts.Deduplicate {
+		fi, err := os.Stat(s.root)
+		if err == nil {
+			id, _ := fileIdentity(fi)
+			s.seenDirectory(s.root, id)
+		}
+	}
+	return true
+}
+
+// Returns true if the directory should not be descended into based on the
+// locator options.
+func (s *simpleFileLocator) skipDirectory(path string, de os.DirEntry) bool {
+	if s.opts.NoCrossDevice {
+		// The directory entry is only stat'd if the device is needed.
+		fi, err := de.Info()
+		if err != nil {
+			return true
+		}
+		dev, ok := fileDevice(fi)
+		if ok && dev != s.rootDev {
+			debugPrint("locateInner(): not crossing device boundary at %v\n", path)
+			return true
+		}
+	}
+	if len(s.opts.SkipFSTypes) > 0 {
+		if s.opts.skipFSType(mountFSType(s.mounts, path)) {
+			debugPrint("locateInner(): skipping excluded file system type at %v\n", path)
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the path located under the root should be skipped based
+// on the installed ignore list.
+func (s *simpleFileLocator) ignored(path string, isDir bool) bool {
+	if sRuntime.ignore == nil {
+		return false
+	}
+	rel, err := filepath.Rel(s.root, path)
+	if err != nil {
+		return false
+	}
+	if sRuntime.ignore.Match(filepath.Join(s.absRoot, rel), isDir) {
+		debugPrint("locateInner(): ignoring %v\n", path)
+		return true
+	}
+	return false
 }
 
 func (s *simpleFileLocator) symFollowIsRegular(path string) (bool, error) {
@@ -248,24 +578,13 @@ func (s *simpleFileLocator) symFollowIsRegular(path string) (bool, error) {
 	return false, nil
 }
 
-func (s *simpleFileLocator) locateInner(target string, useRegexp bool, path string) error {
-	var (
-		spath string
-		re    *regexp.Regexp
-		err   error
-	)
+func (s *simpleFileLocator) locateInner(match locateMatchFunc, path string) {
+	var spath string
 
 	// If processing this directory would result in us exceeding the
 	// specified search depth, just ignore it.
 	if (s.curDepth + 1) > s.maxDepth {
-		return nil
-	}
-
-	if useRegexp {
-		re, err = regexp.Compile(target)
-		if err != nil {
-			return err
-		}
+		return
 	}
 
 	s.curDepth++
@@ -278,57 +597,83 @@ func (s *simpleFileLocator) locateInner(target string, useRegexp bool, path stri
 	} else {
 		spath = path
 	}
-	dirents, err := ioutil.ReadDir(spath)
+	// os.ReadDir returns entries with the file type as reported by the
+	// directory listing, so entries do not need to be stat'd individually.
+	dirents, err := os.ReadDir(spath)
 	if err != nil {
 		// If we encounter an error while reading a directory, just
 		// ignore it and keep going until we are finished.
-		return nil
+		return
 	}
 	for _, x := range dirents {
 		fname := filepath.Join(spath, x.Name())
+		if s.ignored(fname, x.IsDir()) {
+			continue
+		}
 		if x.IsDir() {
-			err = s.locateInner(target, useRegexp, fname)
-			if err != nil {
-				return err
+			if s.skipDirectory(fname, x) {
+				continue
 			}
-		} else if x.Mode().IsRegular() {
-			if !useRegexp {
-				if x.Name() == target {
-					s.matches = append(s.matches, fname)
-				}
-			} else {
-				if re.MatchString(x.Name()) {
-					s.matches = append(s.matches, fname)
-				}
+			if s.seenDirectory(fname, s.entryIdentity(fname, x)) {
+				continue
+			}
+			s.locateInner(match, fname)
+		} else if x.Type().IsRegular() {
+			if match(fname, x.Name()) {
+				s.addMatch(fname, x.Name(), s.entryIdentity(fname, x))
+			}
+			if s.opts.Archives && archiveType(x.Name()) != "" {
+				s.locateArchive(fname, match)
 			}
-		} else if (x.Mode() & os.ModeSymlink) > 0 {
+		} else if (x.Type() & os.ModeSymlink) > 0 {
 			isregsym, err := s.symFollowIsRegular(fname)
 			if err != nil {
 				// Ignore these errors and continue searching
-				return nil
+				return
 			}
 			if isregsym {
-				if !useRegexp {
-					if x.Name() == target {
-						s.matches = append(s.matches, fname)
-					}
-				} else {
-					if re.MatchString(x.Name()) {
-						s.matches = append(s.matches, fname)
-					}
+				if match(fname, x.Name()) {
+					s.addMatch(fname, x.Name(), s.entryIdentity(fname, x))
+				}
+				if s.opts.Archives && archiveType(x.Name()) != "" {
+					s.locateArchive(fname, match)
 				}
 			}
 		}
 	}
-	return nil
 }
 
-func fileContentCheck(path string, regex string) ([]matchLine, error) {
-	re, err := regexp.Compile(regex)
-	if err != nil {
-		return nil, err
-	}
-	fd, err := os.Open(path)
+// countingReader counts the bytes read from the underlying reader.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Options controlling fileContentCheck().
+type contentCheckOptions struct {
+	context    int            // The number of lines surrounding each match to capture.
+	maxMatches int            // Stop reading after this many matches if not 0.
+	tailBytes  int64          // Only scan lines in the last tailBytes bytes if not 0.
+	tailLines  int            // Only scan the last tailLines lines if not 0.
+	reverse    bool           // Scan lines starting at the end of the file.
+	locator    LocatorOptions // The options used to locate the file.
+}
+
+// Returns true if the file is scanned from the end rather than the start.
+func (o contentCheckOptions) fromEnd() bool {
+	return o.reverse || o.tailBytes > 0 || o.tailLines > 0
+}
+
+// Return the lines in the file at path matching re.
+func fileContentCheck(path string, re *regexp.Regexp, opts contentCheckOptions) ([]matchLine, error) {
+	context := opts.context
+	fd, err := openLocated(path, opts.locator)
 	if err != nil {
 		return nil, err
 	}
@@ -336,13 +681,29 @@ func fileContentCheck(path string, regex string) ([]matchLine, error) {
 		fd.Close()
 	}()
 
-	rdr := bufio.NewReader(fd)
+	next := forwardScanner(fd)
+	if opts.fromEnd() {
+		next, err = tailScanner(fd, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
 	ret := make([]matchLine, 0)
+	// The previous lines, and matches still waiting for lines following
+	// the match, used to capture context.
+	type pendingContext struct {
+		idx       int
+		remaining int
+	}
+	before := make([]string, 0, context)
+	pending := make([]pendingContext, 0)
 	for {
-		// XXX Ignore potential partial reads (prefix) here, for lines
-		// with excessive length we will just treat it as multiple
-		// lines
-		buf, _, err := rdr.ReadLine()
+		limited := opts.maxMatches > 0 && len(ret) >= opts.maxMatches
+		if limited && len(pending) == 0 {
+			debugPrint("fileContentCheck(): match limit reached in %v\n", path)
+			break
+		}
+		sl, err := next()
 		if err != nil {
 			if err == io.EOF {
 				break
@@ -350,19 +711,64 @@ func fileContentCheck(path string, regex string) ([]matchLine, error) {
 				return nil, err
 			}
 		}
-		ln := string(buf)
-		mtch := re.FindStringSubmatch(ln)
-		if len(mtch) > 0 {
+		ln := sl.text
+		rl := ""
+		if context > 0 {
+			rl = redact(ln)
+			n := 0
+			for _, x := range pending {
+				ret[x.idx].context = append(ret[x.idx].context, rl)
+				x.remaining--
+				if x.remaining > 0 {
+					pending[n] = x
+					n++
+				}
+			}
+			pending = pending[:n]
+		}
+		var idx []int
+		if !limited {
+			idx = re.FindStringSubmatchIndex(ln)
+		}
+		if idx != nil {
+			mtch := make([]string, len(idx)/2)
+			for i := range mtch {
+				if idx[2*i] >= 0 {
+					mtch[i] = ln[idx[2*i]:idx[2*i+1]]
+				}
+			}
 			newmatch := matchLine{}
 			newmatch.groups = make([]string, 0)
 			newmatch.fullmatch = mtch[0]
+			newmatch.located = true
+			newmatch.line = sl.line
+			newmatch.offset = sl.offset + int64(idx[0])
 			for i := 1; i < len(mtch); i++ {
 				newmatch.groups = append(newmatch.groups, mtch[i])
 			}
+			if context > 0 {
+				newmatch.context = append(append([]string{}, before...), rl)
+				pending = append(pending, pendingContext{idx: len(ret), remaining: context})
+			}
 			ret = append(ret, newmatch)
 		}
+		if context > 0 {
+			if len(before) == context {
+				before = before[1:]
+			}
+			before = append(before, rl)
+		}
 	}
 
+	if opts.reverse {
+		// Context was captured in the order the lines were scanned,
+		// return it in the order the lines appear in the file.
+		for _, x := range ret {
+			for i, j := 0, len(x.context)-1; i < j; i, j = i+1, j-1 {
+				x.context[i], x.context[j] = x.context[j], x.context[i]
+			}
+		}
+	}
 	if len(ret) == 0 {
 		return nil, nil
 	}
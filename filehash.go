@@ -0,0 +1,138 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// FileHash is used to perform tests against the cryptographic hash of files
+// located on the file system.
+//
+// Files are located using Path and File in the same way as for FileName.
+// Algorithm specifies the hash algorithm, and can be one of sha256 (the
+// default), sha512, sha1 or md5. The test value for each file is the hex
+// encoded hash of the file content.
+type FileHash struct {
+	Path      string `json:"path,omitempty" yaml:"path,omitempty"`
+	File      string `json:"file,omitempty" yaml:"file,omitempty"`
+	Algorithm string `json:"algorithm,omitempty" yaml:"algorithm,omitempty"`
+
+	LocatorOptions `yaml:",inline"`
+
+	fileRe  compiledRegexp
+	matches []fileHashStatus
+}
+
+type fileHashStatus struct {
+	path  string
+	value string
+}
+
+var fileHashAlgorithms = map[string]func() hash.Hash{
+	"":       sha256.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+	"sha1":   sha1.New,
+	"md5":    md5.New,
+}
+
+func (f *FileHash) isChain() bool {
+	return false
+}
+
+func (f *FileHash) fireChains(d *Document) ([]evaluationCriteria, error) {
+	return nil, nil
+}
+
+func (f *FileHash) mergeCriteria(c []evaluationCriteria) {
+}
+
+func (f *FileHash) validate(d *Document) error {
+	if len(f.Path) == 0 {
+		return fmt.Errorf("filehash path must be set")
+	}
+	if len(f.File) == 0 {
+		return fmt.Errorf("filehash file must be set")
+	}
+	_, err := f.fileRe.compile(f.fileExpression(f.File))
+	if err != nil {
+		return err
+	}
+	if _, ok := fileHashAlgorithms[f.Algorithm]; !ok {
+		return fmt.Errorf("filehash algorithm must be sha256, sha512, sha1 or md5")
+	}
+	return nil
+}
+
+func (f *FileHash) expandVariables(v []Variable) {
+	f.Path = variableExpansion(v, f.Path)
+	f.File = variableExpansion(v, f.File)
+}
+
+func (f *FileHash) getCriteria() (ret []evaluationCriteria) {
+	for _, x := range f.matches {
+		n := evaluationCriteria{}
+		n.identifier = x.path
+		n.testValue = x.value
+		ret = append(ret, n)
+	}
+	return ret
+}
+
+func (f *FileHash) prepare() error {
+	debugPrint("prepare(): analyzing file system, path %v, file \"%v\"\n", f.Path, f.File)
+
+	re, err := f.fileRe.compile(f.fileExpression(f.File))
+	if err != nil {
+		return err
+	}
+	newHash, ok := fileHashAlgorithms[f.Algorithm]
+	if !ok {
+		return fmt.Errorf("invalid filehash algorithm %v", f.Algorithm)
+	}
+
+	sfl := newSimpleFileLocator()
+	sfl.root = f.Path
+	sfl.opts = f.LocatorOptions
+	err = sfl.locateRegexp(re)
+	if err != nil {
+		return err
+	}
+
+	for _, x := range sfl.matches {
+		v, err := fileHashValue(x, newHash(), f.LocatorOptions)
+		if err != nil {
+			debugPrint("prepare(): skipping %v: %v\n", x, err)
+			continue
+		}
+		debugPrint("prepare(): %v %v\n", x, v)
+		f.matches = append(f.matches, fileHashStatus{path: sfl.identifier(x), value: v})
+	}
+	return nil
+}
+
+func fileHashValue(path string, h hash.Hash, opts LocatorOptions) (string, error) {
+	fd, err := openLocated(path, opts)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+	_, err = io.Copy(h, fd)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -10,7 +10,6 @@ package scribe
 import (
 	"fmt"
 	"path"
-	"regexp"
 )
 
 // FileName is used to perform tests against a given file name on
@@ -19,6 +18,9 @@ type FileName struct {
 	Path string `json:"path,omitempty" yaml:"path,omitempty"`
 	File string `json:"file,omitempty" yaml:"file,omitempty"`
 
+	LocatorOptions `yaml:",inline"`
+
+	fileRe  compiledRegexp
 	matches []nameMatch
 }
 
@@ -45,6 +47,10 @@ func (f *FileName) validate(d *Document) error {
 	if len(f.File) == 0 {
 		return fmt.Errorf("filename file must be set")
 	}
+	_, err := f.fileRe.compile(f.fileExpression(f.File))
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -65,26 +71,30 @@ func (f *FileName) getCriteria() (ret []evaluationCriteria) {
 func (f *FileName) prepare() error {
 	debugPrint("prepare(): analyzing file system, path %v, file \"%v\"\n", f.Path, f.File)
 
-	sfl := newSimpleFileLocator()
-	sfl.root = f.Path
-	err := sfl.locate(f.File, true)
+	re, err := f.fileRe.compile(f.fileExpression(f.File))
 	if err != nil {
 		return err
 	}
 
-	re, err := regexp.Compile(f.File)
+	sfl := newSimpleFileLocator()
+	sfl.root = f.Path
+	sfl.opts = f.LocatorOptions
+	err = sfl.locateRegexp(re)
 	if err != nil {
 		return err
 	}
 
 	for _, x := range sfl.matches {
 		_, testFilename := path.Split(x)
+		if f.PathMatch {
+			testFilename = x
+		}
 		mtch := re.FindStringSubmatch(testFilename)
 		if len(mtch) < 2 {
 			continue
 		}
 		nnm := nameMatch{}
-		nnm.path = x
+		nnm.path = sfl.identifier(x)
 		nnm.match = mtch[1]
 		f.matches = append(f.matches, nnm)
 	}
@@ -8,7 +8,19 @@
 package scribe_test
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/mozilla/scribe"
 )
 
 // Used in TestHasLinePolicy
@@ -313,3 +325,1867 @@ var fileNamePolicyDoc = `
 func TestFileNamePolicy(t *testing.T) {
 	genericTestExec(t, fileNamePolicyDoc)
 }
+
+var locatorOptionsPolicyDoc = `
+{
+	"variables": [
+	{ "key": "root", "value": "./test/filename" }
+	],
+
+	"objects": [
+	{
+		"object": "xdev",
+		"filename": {
+			"path": "${root}",
+			"file": "^(testfile0)$",
+			"xdev": true
+		}
+	},
+
+	{
+		"object": "skipfstypes",
+		"filecontent": {
+			"path": "${root}",
+			"file": "^testfile0$",
+			"expression": "(.*)",
+			"skipfstypes": [ "nfs", "cifs", "fuse" ]
+		}
+	},
+
+	{
+		"object": "icase",
+		"filename": {
+			"path": "${root}",
+			"file": "^(TESTFILE0)$",
+			"icase": true
+		}
+	},
+
+	{
+		"object": "partial",
+		"filename": {
+			"path": "${root}",
+			"file": "(testfile)"
+		}
+	},
+
+	{
+		"object": "fullmatch",
+		"filename": {
+			"path": "${root}",
+			"file": "(testfile)",
+			"fullmatch": true
+		}
+	},
+
+	{
+		"object": "fullmatch-icase",
+		"filename": {
+			"path": "${root}",
+			"file": "file-(\\S+)\\.TXT",
+			"fullmatch": true,
+			"icase": true
+		}
+	},
+
+	{
+		"object": "pathmatch",
+		"filename": {
+			"path": "${root}",
+			"file": "test/(filename|filecontent)/(testfile0)$",
+			"pathmatch": true
+		}
+	},
+
+	{
+		"object": "pathmatch-name",
+		"filename": {
+			"path": "${root}",
+			"file": "^(testfile0)$",
+			"pathmatch": true
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "locatoroptions0",
+		"expectedresult": true,
+		"object": "xdev"
+	},
+
+	{
+		"test": "locatoroptions1",
+		"expectedresult": true,
+		"object": "skipfstypes"
+	},
+
+	{
+		"test": "locatoroptions2",
+		"expectedresult": true,
+		"object": "icase"
+	},
+
+	{
+		"test": "locatoroptions3",
+		"expectedresult": true,
+		"object": "partial"
+	},
+
+	{
+		"test": "locatoroptions4",
+		"expectedresult": false,
+		"object": "fullmatch"
+	},
+
+	{
+		"test": "locatoroptions5",
+		"expectedresult": true,
+		"object": "fullmatch-icase",
+		"evr": {
+			"operation": "<",
+			"value": "1.6.0"
+		}
+	},
+
+	{
+		"test": "locatoroptions6",
+		"expectedresult": true,
+		"object": "pathmatch",
+		"regexp": {
+			"value": "^filename$"
+		}
+	},
+
+	{
+		"test": "locatoroptions7",
+		"expectedresult": false,
+		"object": "pathmatch-name"
+	}
+	]
+}
+`
+
+func TestLocatorOptionsPolicy(t *testing.T) {
+	genericTestExec(t, locatorOptionsPolicyDoc)
+}
+
+func TestLocatorSkipFSTypes(t *testing.T) {
+	dir := t.TempDir()
+	for _, x := range []string{"local", "remote", "proc", "net share"} {
+		err := os.Mkdir(filepath.Join(dir, x), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(filepath.Join(dir, x, "testfile"), []byte("entry\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The fixture mount table places the directories on a network file
+	// system, a pseudo file system and, with the space in its mount point
+	// escaped, a CIFS share.
+	mounts := fmt.Sprintf("/dev/sda1 / ext4 rw 0 0\n"+
+		"server:/export %v/remote nfs4 rw 0 0\n"+
+		"proc %v/proc proc rw 0 0\n"+
+		"//server/share %v/net\\040share cifs rw 0 0\n", dir, dir, dir)
+	table := filepath.Join(t.TempDir(), "mounts")
+	err := ioutil.WriteFile(table, []byte(mounts), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer scribe.SetMountTablePath(scribe.SetMountTablePath(table))
+
+	obj := func(name string, root string, opts string) string {
+		return fmt.Sprintf(`{"object": %q, "filecontent": {"path": %q, "file": "^testfile$", "expression": "(.*)"%v}}`,
+			name, root, opts)
+	}
+	skip := `, "skipfstypes": ["nfs4", "cifs", "proc"]`
+	docstr := fmt.Sprintf(`{"objects": [%v, %v, %v]}`,
+		obj("all", dir, ""),
+		obj("skipped", dir, skip),
+		obj("remoteroot", filepath.Join(dir, "remote"), skip))
+	scribe.Bootstrap()
+	doc, err := scribe.LoadDocument(strings.NewReader(docstr))
+	if err != nil {
+		t.Fatalf("scribe.LoadDocument: %v", err)
+	}
+	expect := map[string]string{
+		"all":        "local net share proc remote",
+		"skipped":    "local",
+		"remoteroot": "",
+	}
+	for name, exp := range expect {
+		c, err := doc.EvaluateObject(name)
+		if err != nil {
+			t.Fatalf("EvaluateObject: %v", err)
+		}
+		got := make([]string, 0)
+		for _, x := range c {
+			got = append(got, filepath.Base(filepath.Dir(x.Identifier)))
+		}
+		sort.Strings(got)
+		if strings.Join(got, " ") != exp {
+			t.Fatalf("%v: unexpected files %v", name, got)
+		}
+	}
+}
+
+func TestLocatorFileFilters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scribe-filters")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{"new.log": "entry\n", "old.log": "entry\n", "empty.log": ""}
+	for k, v := range files {
+		err = ioutil.WriteFile(filepath.Join(dir, k), []byte(v), 0644)
+		if err != nil {
+			t.Fatalf("ioutil.WriteFile: %v", err)
+		}
+	}
+	old := time.Now().Add(-72 * time.Hour)
+	err = os.Chtimes(filepath.Join(dir, "old.log"), old, old)
+	if err != nil {
+		t.Fatalf("os.Chtimes: %v", err)
+	}
+	err = os.Chmod(filepath.Join(dir, "new.log"), 0666)
+	if err != nil {
+		t.Fatalf("os.Chmod: %v", err)
+	}
+	obj := func(name string, opts string) string {
+		return fmt.Sprintf(`{"object": %q, "filename": {"path": %q, "file": "^(.+)\\.log$", %v}}`,
+			name, dir, opts)
+	}
+	uid := os.Getuid()
+	docstr := fmt.Sprintf(`{"objects": [%v, %v, %v, %v, %v, %v, %v]}`,
+		obj("recent", `"newerthan": "24h"`),
+		obj("stale", `"olderthan": "2d"`),
+		obj("nonempty", `"minsize": 1`),
+		obj("small", `"maxsize": 1`),
+		obj("writable", `"permany": "0002"`),
+		obj("owned", fmt.Sprintf(`"owner": "%v", "permall": "0644", "maxsize": 1`, uid)),
+		obj("notowned", fmt.Sprintf(`"owner": "!%v"`, uid)))
+	scribe.Bootstrap()
+	doc, err := scribe.LoadDocument(strings.NewReader(docstr))
+	if err != nil {
+		t.Fatalf("scribe.LoadDocument: %v", err)
+	}
+	expect := map[string]string{
+		"recent":   "empty.log new.log",
+		"stale":    "old.log",
+		"nonempty": "new.log old.log",
+		"small":    "empty.log",
+		"writable": "new.log",
+		"owned":    "empty.log",
+		"notowned": "",
+	}
+	for name, exp := range expect {
+		c, err := doc.EvaluateObject(name)
+		if err != nil {
+			t.Fatalf("EvaluateObject: %v", err)
+		}
+		got := make([]string, 0)
+		for _, x := range c {
+			got = append(got, filepath.Base(x.Identifier))
+		}
+		sort.Strings(got)
+		if strings.Join(got, " ") != exp {
+			t.Fatalf("%v: unexpected files %v", name, got)
+		}
+	}
+
+	_, err = scribe.LoadDocument(strings.NewReader(fmt.Sprintf(`{"objects": [%v]}`,
+		obj("invalid", `"newerthan": "yesterday"`))))
+	if err == nil {
+		t.Fatalf("invalid newerthan should fail validation")
+	}
+}
+
+// Used in TestLocatorSharedEnumeration, versions and names share a root and
+// options so the root is enumerated once.
+var sharedEnumerationDoc = `
+{
+	"objects": [
+	{
+		"object": "versions",
+		"filename": {
+			"path": "./test/filename",
+			"file": "^file-(.+)\\.txt$"
+		}
+	},
+
+	{
+		"object": "names",
+		"filename": {
+			"path": "./test/filename",
+			"file": "^(testfile0)$"
+		}
+	},
+
+	{
+		"object": "content",
+		"filecontent": {
+			"path": "./test/filecontent",
+			"file": "^testfile0$",
+			"expression": "^(Test)$"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "versions",
+		"object": "versions"
+	},
+
+	{
+		"test": "names",
+		"object": "names"
+	},
+
+	{
+		"test": "content",
+		"object": "content"
+	}
+	]
+}
+`
+
+func TestLocatorSharedEnumeration(t *testing.T) {
+	var lock sync.Mutex
+	walks := make(map[string]int)
+	scribe.SetEnumerateHook(func(root string) {
+		lock.Lock()
+		walks[root]++
+		lock.Unlock()
+	})
+	defer scribe.SetEnumerateHook(nil)
+	scribe.Bootstrap()
+	doc, err := scribe.LoadDocument(strings.NewReader(sharedEnumerationDoc))
+	if err != nil {
+		t.Fatalf("scribe.LoadDocument: %v", err)
+	}
+	err = scribe.AnalyzeDocument(doc)
+	if err != nil {
+		t.Fatalf("scribe.AnalyzeDocument: %v", err)
+	}
+	if !reflect.DeepEqual(walks, map[string]int{"./test/filename": 1, "./test/filecontent": 1}) {
+		t.Fatalf("unexpected enumerations %v", walks)
+	}
+	expect := map[string]string{
+		"versions": "file-1.2.3.txt file-1.5.0.txt",
+		"names":    "testfile0",
+		"content":  "testfile0",
+	}
+	for k, v := range expect {
+		tr, err := scribe.GetResults(&doc, k)
+		if err != nil {
+			t.Fatalf("scribe.GetResults: %v", err)
+		}
+		got := make([]string, 0)
+		for _, x := range tr.Results {
+			got = append(got, filepath.Base(x.Identifier))
+		}
+		sort.Strings(got)
+		if strings.Join(got, " ") != v {
+			t.Fatalf("%v: unexpected files %v", k, got)
+		}
+	}
+}
+
+func TestLocatorConcurrentEnumeration(t *testing.T) {
+	docstr := `{"objects": [
+	{ "object": "names", "filename": { "path": "./test/filename", "file": "^(testfile0)$" } },
+	{ "object": "content", "filecontent": { "path": "./test/filecontent", "file": "^testfile0$", "expression": "^(Test)$" } }
+	]}`
+	// The first enumeration to start waits for the other, which can only
+	// begin if enumerations of different roots are not serialized.
+	second := make(chan struct{})
+	overlapped := make(chan bool, 1)
+	var lock sync.Mutex
+	count := 0
+	scribe.SetEnumerateHook(func(root string) {
+		lock.Lock()
+		count++
+		first := count == 1
+		lock.Unlock()
+		if !first {
+			close(second)
+			return
+		}
+		select {
+		case <-second:
+			overlapped <- true
+		case <-time.After(5 * time.Second):
+			overlapped <- false
+		}
+	})
+	defer scribe.SetEnumerateHook(nil)
+	scribe.SetConcurrency(2)
+	defer scribe.SetConcurrency(1)
+	scribe.Bootstrap()
+	doc, err := scribe.LoadDocument(strings.NewReader(docstr))
+	if err != nil {
+		t.Fatalf("scribe.LoadDocument: %v", err)
+	}
+	err = scribe.AnalyzeDocument(doc)
+	if err != nil {
+		t.Fatalf("scribe.AnalyzeDocument: %v", err)
+	}
+	if !<-overlapped {
+		t.Fatalf("enumerations of different roots did not run concurrently")
+	}
+}
+
+func TestLocatorMultipleRoots(t *testing.T) {
+	docstr := `{"objects": [
+	{ "object": "roots", "filename": { "path": "./test/filename, ./test/filecontent", "file": "^(testfile0)$" } },
+	{ "object": "overlap", "filename": { "path": "./test/filename,./test/filename", "file": "^(testfile0)$" } }
+	]}`
+	scribe.Bootstrap()
+	doc, err := scribe.LoadDocument(strings.NewReader(docstr))
+	if err != nil {
+		t.Fatalf("scribe.LoadDocument: %v", err)
+	}
+	expect := map[string]string{
+		"roots":   "test/filecontent/testfile0 test/filename/testfile0",
+		"overlap": "test/filename/testfile0",
+	}
+	for name, exp := range expect {
+		c, err := doc.EvaluateObject(name)
+		if err != nil {
+			t.Fatalf("EvaluateObject: %v", err)
+		}
+		got := make([]string, 0)
+		for _, x := range c {
+			got = append(got, filepath.ToSlash(x.Identifier))
+		}
+		sort.Strings(got)
+		if strings.Join(got, " ") != exp {
+			t.Fatalf("%v: unexpected files %v", name, got)
+		}
+	}
+}
+
+var homeDirsPolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "netrc",
+		"filecontent": {
+			"path": "${homedirs}",
+			"file": "^\\.netrc$",
+			"expression": "login (\\S+)"
+		}
+	},
+
+	{
+		"object": "ssh-config",
+		"filecontent": {
+			"path": "${homedirs}/.ssh",
+			"file": "^config$",
+			"expression": "ForwardAgent (\\S+)"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "netrc",
+		"object": "netrc",
+		"expectedresult": true
+	},
+
+	{
+		"test": "ssh-config",
+		"object": "ssh-config",
+		"expectedresult": true,
+		"exactmatch": {
+			"value": "yes"
+		}
+	}
+	]
+}
+`
+
+func TestHomeDirsVariable(t *testing.T) {
+	scribe.TestHooks(true)
+	doc := genericTestExec(t, homeDirsPolicyDoc)
+	expect := map[string]string{
+		"netrc":      "alice:test/homedirs/alice/.netrc bob:test/homedirs/bob/.netrc",
+		"ssh-config": "alice:test/homedirs/alice/.ssh/config",
+	}
+	for name, exp := range expect {
+		tr, err := scribe.GetResults(doc, name)
+		if err != nil {
+			t.Fatalf("scribe.GetResults: %v", err)
+		}
+		got := make([]string, 0)
+		for _, x := range tr.Results {
+			got = append(got, filepath.ToSlash(x.Identifier))
+		}
+		sort.Strings(got)
+		if strings.Join(got, " ") != exp {
+			t.Fatalf("%v: unexpected identifiers %v", name, got)
+		}
+	}
+}
+
+func TestFileContentAsOwner(t *testing.T) {
+	if runtime.GOOS != "linux" || os.Geteuid() != 0 {
+		t.Skip("requires root on linux")
+	}
+	dir, err := ioutil.TempDir("", "scribe-asowner")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	err = os.Chmod(dir, 0755)
+	if err != nil {
+		t.Fatalf("os.Chmod: %v", err)
+	}
+	// A file owned by an unprivileged user that the user can not read,
+	// which root can.
+	p := filepath.Join(dir, "private")
+	err = ioutil.WriteFile(p, []byte("secret\n"), 0)
+	if err != nil {
+		t.Fatalf("ioutil.WriteFile: %v", err)
+	}
+	err = os.Chown(p, 65534, 65534)
+	if err != nil {
+		t.Fatalf("os.Chown: %v", err)
+	}
+	obj := func(name string, opts string) string {
+		return fmt.Sprintf(`{"object": %q, "filecontent": {"path": %q, "file": "^private$", `+
+			`"expression": "(.+)" %v}}`, name, dir, opts)
+	}
+	docstr := fmt.Sprintf(`{"objects": [%v, %v]}`, obj("root", ""), obj("owner", `, "asowner": true`))
+	scribe.Bootstrap()
+	doc, err := scribe.LoadDocument(strings.NewReader(docstr))
+	if err != nil {
+		t.Fatalf("scribe.LoadDocument: %v", err)
+	}
+	for name, exp := range map[string]int{"root": 1, "owner": 0} {
+		c, err := doc.EvaluateObject(name)
+		if err != nil {
+			t.Fatalf("EvaluateObject: %v", err)
+		}
+		if len(c) != exp {
+			t.Fatalf("%v: expected %v criteria, got %v", name, exp, len(c))
+		}
+	}
+}
+
+func TestOpenAsOwnerLinks(t *testing.T) {
+	if runtime.GOOS != "linux" || os.Geteuid() != 0 {
+		t.Skip("requires root on linux")
+	}
+	dir, err := ioutil.TempDir("", "scribe-asowner")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	err = os.Chmod(dir, 0755)
+	if err != nil {
+		t.Fatalf("os.Chmod: %v", err)
+	}
+	// A directory only root can access, and a directory owned by an
+	// unprivileged user with links into it.
+	private := filepath.Join(dir, "private")
+	home := filepath.Join(dir, "home")
+	for _, x := range []struct {
+		path  string
+		mode  os.FileMode
+		owner int
+	}{
+		{private, 0700, 0},
+		{home, 0755, 65534},
+	} {
+		err = os.Mkdir(x.path, x.mode)
+		if err != nil {
+			t.Fatalf("os.Mkdir: %v", err)
+		}
+		err = os.Chown(x.path, x.owner, x.owner)
+		if err != nil {
+			t.Fatalf("os.Chown: %v", err)
+		}
+	}
+	err = ioutil.WriteFile(filepath.Join(private, "secret"), []byte("secret\n"), 0600)
+	if err != nil {
+		t.Fatalf("ioutil.WriteFile: %v", err)
+	}
+	err = ioutil.WriteFile(filepath.Join(home, "file"), []byte("file\n"), 0600)
+	if err != nil {
+		t.Fatalf("ioutil.WriteFile: %v", err)
+	}
+	err = os.Chown(filepath.Join(home, "file"), 65534, 65534)
+	if err != nil {
+		t.Fatalf("os.Chown: %v", err)
+	}
+	for _, x := range []struct {
+		path   string
+		target string
+		owner  int
+	}{
+		{filepath.Join(dir, "rootlink"), "private", 0},
+		{filepath.Join(home, "dirlink"), "../private", 65534},
+		{filepath.Join(home, "filelink"), "../private/secret", 65534},
+		{filepath.Join(home, "abslink"), private, 65534},
+	} {
+		err = os.Symlink(x.target, x.path)
+		if err != nil {
+			t.Fatalf("os.Symlink: %v", err)
+		}
+		err = os.Lchown(x.path, x.owner, x.owner)
+		if err != nil {
+			t.Fatalf("os.Lchown: %v", err)
+		}
+	}
+	for _, x := range []struct {
+		path    string
+		content string
+	}{
+		{"private/secret", "secret\n"},
+		{"rootlink/secret", "secret\n"},
+		{"home/file", "file\n"},
+		{"home/../private/secret", "secret\n"},
+		{"home/dirlink/secret", ""},
+		{"home/filelink", ""},
+		{"home/abslink/secret", ""},
+	} {
+		fd, err := scribe.OpenAsOwner(filepath.Join(dir, x.path))
+		if x.content == "" {
+			if err == nil {
+				fd.Close()
+				t.Fatalf("%v: expected error opening through link owned by user", x.path)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%v: OpenAsOwner: %v", x.path, err)
+		}
+		buf, err := ioutil.ReadAll(fd)
+		fd.Close()
+		if err != nil {
+			t.Fatalf("%v: ioutil.ReadAll: %v", x.path, err)
+		}
+		if string(buf) != x.content {
+			t.Fatalf("%v: expected content %q, got %q", x.path, x.content, buf)
+		}
+	}
+}
+
+var jarPolicyDoc = `
+{
+	"variables": [
+	{ "key": "root", "value": "./test/jar" }
+	],
+
+	"objects": [
+	{
+		"object": "log4j-core",
+		"jar": {
+			"path": "${root}",
+			"file": "\\.(jar|war)$",
+			"artifact": "^log4j-core$"
+		}
+	},
+
+	{
+		"object": "util",
+		"jar": {
+			"path": "${root}",
+			"file": "\\.jar$",
+			"artifact": "^util$"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "jar0",
+		"expectedresult": true,
+		"object": "log4j-core",
+		"evr": {
+			"operation": "<",
+			"value": "2.17.1"
+		}
+	},
+
+	{
+		"test": "jar1",
+		"expectedresult": true,
+		"object": "util",
+		"exactmatch": {
+			"value": "1.4.2"
+		}
+	}
+	]
+}
+`
+
+func TestJARPolicy(t *testing.T) {
+	genericTestExec(t, jarPolicyDoc)
+}
+
+var archivePolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "tar-content",
+		"filecontent": {
+			"path": "./test/archive",
+			"file": "^app\\.conf$",
+			"expression": "^Version = (\\S+)",
+			"archives": true
+		}
+	},
+
+	{
+		"object": "nested-content",
+		"filecontent": {
+			"path": "./test/jar",
+			"file": "^pom\\.properties$",
+			"expression": "^version=(\\S+)",
+			"archives": true,
+			"archivedepth": 2
+		}
+	},
+
+	{
+		"object": "nested-depth",
+		"filename": {
+			"path": "./test/jar",
+			"file": "^(pom\\.properties)$",
+			"archives": true
+		}
+	},
+
+	{
+		"object": "member-content",
+		"filecontent": {
+			"path": "./test/archive",
+			"file": "\\.txt$",
+			"expression": "^Version = (\\S+)",
+			"archives": true
+		}
+	},
+
+	{
+		"object": "member-limit",
+		"filecontent": {
+			"path": "./test/archive",
+			"file": "\\.txt$",
+			"expression": "^Version = (\\S+)",
+			"archives": true,
+			"archivemaxsize": 1024
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "archive0",
+		"expectedresult": true,
+		"object": "tar-content",
+		"exactmatch": {
+			"value": "1.2.0"
+		}
+	},
+
+	{
+		"test": "archive1",
+		"expectedresult": true,
+		"object": "nested-content",
+		"evr": {
+			"operation": "<",
+			"value": "2.17.1"
+		}
+	},
+
+	{
+		"test": "archive2",
+		"expectedresult": false,
+		"object": "nested-depth"
+	},
+
+	{
+		"test": "archive3",
+		"expectedresult": true,
+		"object": "member-content",
+		"exactmatch": {
+			"value": "3.0.0"
+		}
+	},
+
+	{
+		"test": "archive4",
+		"expectedresult": false,
+		"object": "member-limit",
+		"exactmatch": {
+			"value": "3.0.0"
+		}
+	}
+	]
+}
+`
+
+func TestArchivePolicy(t *testing.T) {
+	doc := genericTestExec(t, archivePolicyDoc)
+	// Members larger than archivemaxsize can not be read, rather than
+	// being truncated, and smaller members of the same archive can.
+	for k, v := range map[string][]string{
+		"archive3": {"3.0.0", "3.1.0"},
+		"archive4": {"3.1.0"},
+	} {
+		e, err := doc.ExplainTest(k)
+		if err != nil {
+			t.Fatalf("Document.ExplainTest: %v", err)
+		}
+		got := make([]string, 0)
+		for _, x := range e.Criteria {
+			got = append(got, x.Value)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, v) {
+			t.Fatalf("%v: unexpected criteria %v", k, got)
+		}
+	}
+}
+
+var bootloaderPolicyDoc = `
+{
+	"variables": [
+	{ "key": "root", "value": "./test/bootloader" }
+	],
+
+	"objects": [
+	{
+		"object": "cmdline",
+		"bootloader": {
+			"loader": "all",
+			"paths": [ "${root}/grub.cfg", "${root}/grubenv", "${root}/entries/*.conf" ]
+		}
+	},
+
+	{
+		"object": "backlog",
+		"bootloader": {
+			"loader": "grub",
+			"parameter": "audit_backlog_limit",
+			"paths": [ "${root}/grub.cfg", "${root}/grubenv" ]
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "bootloader0",
+		"expectedresult": true,
+		"object": "cmdline",
+		"exactmatch": {
+			"value": "audit=1"
+		}
+	},
+
+	{
+		"test": "bootloader1",
+		"expectedresult": true,
+		"object": "cmdline",
+		"exactmatch": {
+			"value": "selinux=0"
+		}
+	},
+
+	{
+		"test": "bootloader2",
+		"expectedresult": true,
+		"object": "backlog",
+		"exactmatch": {
+			"value": "8192"
+		}
+	}
+	]
+}
+`
+
+func TestBootloaderPolicy(t *testing.T) {
+	genericTestExec(t, bootloaderPolicyDoc)
+}
+
+var pamPolicyDoc = `
+{
+	"variables": [
+	{ "key": "root", "value": "./test/pam" }
+	],
+
+	"objects": [
+	{
+		"object": "sshd-minlen",
+		"pam": {
+			"path": "${root}",
+			"service": "sshd",
+			"type": "password",
+			"module": "^pam_pwquality\\.so$",
+			"argument": "minlen"
+		}
+	},
+
+	{
+		"object": "sshd-auth",
+		"pam": {
+			"path": "${root}",
+			"service": "sshd",
+			"type": "auth"
+		}
+	},
+
+	{
+		"object": "sshd-session",
+		"pam": {
+			"path": "${root}",
+			"service": "sshd",
+			"type": "session"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "pam0",
+		"expectedresult": true,
+		"object": "sshd-minlen",
+		"evr": {
+			"operation": ">",
+			"value": "13"
+		}
+	},
+
+	{
+		"test": "pam1",
+		"expectedresult": true,
+		"object": "sshd-auth",
+		"exactmatch": {
+			"value": "auth [success=1 default=bad] pam_unix.so try_first_pass nullok"
+		}
+	},
+
+	{
+		"test": "pam2",
+		"expectedresult": true,
+		"object": "sshd-session",
+		"regexp": {
+			"value": "^session required pam_limits\\.so$"
+		}
+	}
+	]
+}
+`
+
+func TestPAMPolicy(t *testing.T) {
+	genericTestExec(t, pamPolicyDoc)
+}
+
+// Used in TestPlistPolicy, com.apple.SoftwareUpdate.plist is an XML
+// property list and com.apple.alf.plist a binary property list.
+var plistPolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "automatic-check",
+		"plist": {
+			"path": "./test/plist",
+			"file": "^com\\.apple\\.SoftwareUpdate\\.plist$",
+			"key": "AutomaticCheckEnabled"
+		}
+	},
+
+	{
+		"object": "last-update",
+		"plist": {
+			"path": "./test/plist",
+			"file": "^com\\.apple\\.SoftwareUpdate\\.plist$",
+			"key": "LastSuccessfulDate"
+		}
+	},
+
+	{
+		"object": "firewall-state",
+		"plist": {
+			"path": "./test/plist",
+			"file": "^com\\.apple\\.alf\\.plist$",
+			"key": "globalstate"
+		}
+	},
+
+	{
+		"object": "firewall-app",
+		"plist": {
+			"path": "./test/plist",
+			"file": "^com\\.apple\\.alf\\.plist$",
+			"key": ":applications:1:bundleid"
+		}
+	},
+
+	{
+		"object": "firewall-auths",
+		"plist": {
+			"path": "./test/plist",
+			"file": "^com\\.apple\\.alf\\.plist$",
+			"key": "explicitauths"
+		}
+	},
+
+	{
+		"object": "missing-key",
+		"plist": {
+			"path": "./test/plist",
+			"file": "\\.plist$",
+			"key": "applications:5:bundleid"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "plist0",
+		"expectedresult": true,
+		"object": "automatic-check",
+		"exactmatch": {
+			"value": "true"
+		}
+	},
+
+	{
+		"test": "plist1",
+		"expectedresult": true,
+		"object": "last-update",
+		"exactmatch": {
+			"value": "2024-05-01T12:00:00Z"
+		}
+	},
+
+	{
+		"test": "plist2",
+		"expectedresult": true,
+		"object": "firewall-state",
+		"exactmatch": {
+			"value": "1"
+		}
+	},
+
+	{
+		"test": "plist3",
+		"expectedresult": true,
+		"object": "firewall-app",
+		"exactmatch": {
+			"value": "com.example.\u00fc\u00f1\u00ed"
+		}
+	},
+
+	{
+		"test": "plist4",
+		"expectedresult": true,
+		"object": "firewall-auths",
+		"exactmatch": {
+			"value": "com.apple.python"
+		}
+	},
+
+	{
+		"test": "plist5",
+		"expectedresult": false,
+		"object": "missing-key"
+	}
+	]
+}
+`
+
+func TestPlistPolicy(t *testing.T) {
+	genericTestExec(t, plistPolicyDoc)
+}
+
+// Used in TestFileHashPolicy
+var fileHashPolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "bin",
+		"filehash": {
+			"path": "./test/filehash/bin",
+			"file": ".*"
+		}
+	},
+
+	{
+		"object": "all",
+		"filehash": {
+			"path": "./test/filehash",
+			"file": "^(tool|helper|daemon)$"
+		}
+	},
+
+	{
+		"object": "tool-sha1",
+		"filehash": {
+			"path": "./test/filehash",
+			"file": "^tool$",
+			"algorithm": "sha1"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "filehash0",
+		"expectedresult": true,
+		"object": "bin",
+		"allowlist": {
+			"file": "./test/filehash/allowlist"
+		}
+	},
+
+	{
+		"test": "filehash1",
+		"expectedresult": false,
+		"object": "all",
+		"allowlist": {
+			"file": "./test/filehash/allowlist"
+		}
+	},
+
+	{
+		"test": "filehash2",
+		"expectedresult": true,
+		"object": "all",
+		"allowlist": {
+			"file": "./test/filehash/allowlist",
+			"anypath": true
+		}
+	},
+
+	{
+		"test": "filehash3",
+		"expectedresult": false,
+		"object": "bin",
+		"allowlist": {
+			"file": "./test/filehash/allowlist-old"
+		}
+	},
+
+	{
+		"test": "filehash4",
+		"expectedresult": true,
+		"object": "tool-sha1",
+		"exactmatch": {
+			"value": "2d984c5ae529cf6a42803302997bdfb215660d74"
+		}
+	},
+
+	{
+		"test": "filehash5",
+		"expecterror": true,
+		"object": "bin",
+		"allowlist": {
+			"file": "./test/filehash/nonexistent"
+		}
+	}
+	]
+}
+`
+
+func TestFileHashPolicy(t *testing.T) {
+	genericTestExec(t, fileHashPolicyDoc)
+}
+
+// Used in TestLocatorDeduplicate, the root path is substituted with a
+// temporary directory as hard links can not be stored in the repository.
+var deduplicatePolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "dedup",
+		"filecontent": {
+			"path": "%v",
+			"file": "^app\\.conf$",
+			"expression": "^version = (\\S+)",
+			"dedup": true
+		}
+	},
+
+	{
+		"object": "nodedup",
+		"filecontent": {
+			"path": "%v",
+			"file": "^app\\.conf$",
+			"expression": "^version = (\\S+)"
+		}
+	}
+	],
+
+	"tests": [
+	{ "test": "dedup", "object": "dedup" },
+	{ "test": "nodedup", "object": "nodedup" }
+	]
+}
+`
+
+func TestLocatorDeduplicate(t *testing.T) {
+	root, err := ioutil.TempDir("", "scribe-dedup")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(root)
+	for _, x := range []string{"a", "b", "c"} {
+		err = os.Mkdir(filepath.Join(root, x), 0755)
+		if err != nil {
+			t.Fatalf("os.Mkdir: %v", err)
+		}
+	}
+	for _, x := range []string{"a", "c"} {
+		err = ioutil.WriteFile(filepath.Join(root, x, "app.conf"),
+			[]byte("version = 1.0\n"), 0644)
+		if err != nil {
+			t.Fatalf("ioutil.WriteFile: %v", err)
+		}
+	}
+	err = os.Link(filepath.Join(root, "a", "app.conf"), filepath.Join(root, "b", "app.conf"))
+	if err != nil {
+		t.Skipf("os.Link: %v", err)
+	}
+
+	doc, err := scribe.LoadDocument(strings.NewReader(fmt.Sprintf(deduplicatePolicyDoc, root, root)))
+	if err != nil {
+		t.Fatalf("scribe.LoadDocument: %v", err)
+	}
+	scribe.Bootstrap()
+	err = scribe.AnalyzeDocument(doc)
+	if err != nil {
+		t.Fatalf("scribe.AnalyzeDocument: %v", err)
+	}
+	identifiers := func(name string) []string {
+		tr, err := scribe.GetResults(&doc, name)
+		if err != nil {
+			t.Fatalf("scribe.GetResults: %v", err)
+		}
+		ret := make([]string, 0)
+		for _, x := range tr.Results {
+			ret = append(ret, x.Identifier)
+		}
+		return ret
+	}
+	want := []string{
+		filepath.Join(root, "a", "app.conf") + ", " + filepath.Join(root, "b", "app.conf"),
+		filepath.Join(root, "c", "app.conf"),
+	}
+	got := identifiers("dedup")
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected deduplicated identifiers: %v", got)
+	}
+	got = identifiers("nodedup")
+	if len(got) != 3 {
+		t.Fatalf("unexpected identifiers without deduplication: %v", got)
+	}
+}
+
+// Create a directory tree for the locator benchmarks, returning the root.
+var identifierFormatPolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "format",
+		"filecontent": {
+			"path": "./test/filecontent",
+			"file": "^testfile1$",
+			"expression": "^(?P<key>\\S+) = (\\S+)",
+			"identifierformat": "{path}:{line} match {match} group {group}"
+		}
+	}
+	],
+
+	"tests": [
+	{ "test": "format", "object": "format", "expectedresult": true }
+	]
+}
+`
+
+func TestFileContentIdentifierFormat(t *testing.T) {
+	doc := genericTestExec(t, identifierFormatPolicyDoc)
+	tr, err := scribe.GetResults(doc, "format")
+	if err != nil {
+		t.Fatalf("scribe.GetResults: %v", err)
+	}
+	got := make([]string, 0)
+	for _, x := range tr.Results {
+		got = append(got, x.Identifier)
+	}
+	want := []string{
+		"test/filecontent/testfile1:2 match 1 group key",
+		"test/filecontent/testfile1:2 match 1 group 2",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected identifiers: %v", got)
+	}
+
+	_, err = scribe.LoadDocument(strings.NewReader(strings.Replace(identifierFormatPolicyDoc,
+		"{group}", "{column}", 1)))
+	if err == nil {
+		t.Fatalf("scribe.LoadDocument should fail with unknown identifier format token")
+	}
+}
+
+func TestFileContentLocation(t *testing.T) {
+	doc := genericTestExec(t, fileContentPolicyDoc)
+	tr, err := scribe.GetResults(doc, "filecontent3")
+	if err != nil {
+		t.Fatalf("scribe.GetResults: %v", err)
+	}
+	if len(tr.Results) != 1 {
+		t.Fatalf("unexpected number of results %v", len(tr.Results))
+	}
+	loc := tr.Results[0].Location
+	if loc == nil || loc.Line != 2 || loc.Offset != 7 {
+		t.Fatalf("unexpected location %+v", loc)
+	}
+	lns := tr.SingleLineResults()
+	if !strings.HasSuffix(lns[len(lns)-1], " line:2 offset:7") {
+		t.Fatalf("location missing from single line results: %v", lns[len(lns)-1])
+	}
+}
+
+var contextPolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "context",
+		"filecontent": {
+			"path": "%v",
+			"file": "^app\\.conf$",
+			"expression": "^(\\w+) = 1$",
+			"context": 2
+		}
+	}
+	],
+
+	"tests": [
+	{ "test": "context", "object": "context" }
+	]
+}
+`
+
+func TestFileContentContext(t *testing.T) {
+	root, err := ioutil.TempDir("", "scribe-context")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(root)
+	err = ioutil.WriteFile(filepath.Join(root, "app.conf"),
+		[]byte("first = 1\npassword = secret\n# comment\nlast = 1\n"), 0644)
+	if err != nil {
+		t.Fatalf("ioutil.WriteFile: %v", err)
+	}
+	err = scribe.SetRedactions([]string{`password = (\S+)`})
+	if err != nil {
+		t.Fatalf("scribe.SetRedactions: %v", err)
+	}
+	defer scribe.SetRedactions(nil)
+
+	doc, err := scribe.LoadDocument(strings.NewReader(fmt.Sprintf(contextPolicyDoc, root)))
+	if err != nil {
+		t.Fatalf("scribe.LoadDocument: %v", err)
+	}
+	scribe.Bootstrap()
+	err = scribe.AnalyzeDocument(doc)
+	if err != nil {
+		t.Fatalf("scribe.AnalyzeDocument: %v", err)
+	}
+	tr, err := scribe.GetResults(&doc, "context")
+	if err != nil {
+		t.Fatalf("scribe.GetResults: %v", err)
+	}
+	want := []string{
+		"first = 1|password = [REDACTED]|# comment",
+		"password = [REDACTED]|# comment|last = 1",
+	}
+	if len(tr.Results) != len(want) {
+		t.Fatalf("unexpected number of results %v", len(tr.Results))
+	}
+	for i, x := range tr.Results {
+		if x.Location == nil {
+			t.Fatalf("result %v has no location", i)
+		}
+		got := strings.Join(x.Location.Context, "|")
+		if got != want[i] {
+			t.Fatalf("result %v: unexpected context %q", i, got)
+		}
+	}
+}
+
+var matchLimitPolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "all",
+		"filecontent": {
+			"path": "./test/filecontent",
+			"file": "^testfile[01]$",
+			"expression": "(.+)"
+		}
+	},
+
+	{
+		"object": "limited",
+		"filecontent": {
+			"path": "./test/filecontent",
+			"file": "^testfile[01]$",
+			"expression": "(.+)",
+			"maxmatchesperfile": 1
+		}
+	},
+
+	{
+		"object": "first",
+		"filecontent": {
+			"path": "./test/filecontent",
+			"file": "^testfile[01]$",
+			"expression": "(.+)",
+			"stoponfirstmatch": true
+		}
+	}
+	],
+
+	"tests": [
+	{ "test": "all", "object": "all", "expectedresult": true },
+	{ "test": "limited", "object": "limited", "expectedresult": true },
+	{ "test": "first", "object": "first", "expectedresult": true }
+	]
+}
+`
+
+func TestFileContentMatchLimit(t *testing.T) {
+	doc := genericTestExec(t, matchLimitPolicyDoc)
+	counts := make(map[string]int)
+	files := make(map[string]map[string]bool)
+	for _, x := range []string{"all", "limited", "first"} {
+		tr, err := scribe.GetResults(doc, x)
+		if err != nil {
+			t.Fatalf("scribe.GetResults: %v", err)
+		}
+		counts[x] = len(tr.Results)
+		files[x] = make(map[string]bool)
+		for _, y := range tr.Results {
+			files[x][y.Identifier] = true
+		}
+	}
+	if counts["all"] <= 2 || len(files["all"]) != 2 {
+		t.Fatalf("unexpected results without limit: %v", counts["all"])
+	}
+	if counts["limited"] != 2 || len(files["limited"]) != 2 {
+		t.Fatalf("unexpected results with maxmatchesperfile: %v", counts["limited"])
+	}
+	if counts["first"] != 1 {
+		t.Fatalf("unexpected results with stoponfirstmatch: %v", counts["first"])
+	}
+}
+
+func TestFileContentTail(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scribe-tail")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(filepath.Join(dir, "log"), []byte("line1\nline2\nline3\nline4\n"), 0644)
+	if err != nil {
+		t.Fatalf("ioutil.WriteFile: %v", err)
+	}
+	obj := func(name string, opts string) string {
+		return fmt.Sprintf(`{"object": %q, "filecontent": {"path": %q, "file": "^log$", `+
+			`"expression": "^(line\\d)$", %v}}`, name, dir, opts)
+	}
+	docstr := fmt.Sprintf(`{"objects": [%v, %v, %v]}`,
+		obj("lines", `"taillines": 2`),
+		obj("bytes", `"tailbytes": 8`),
+		obj("reverse", `"reverse": true, "maxmatchesperfile": 2, "context": 1`))
+	scribe.Bootstrap()
+	doc, err := scribe.LoadDocument(strings.NewReader(docstr))
+	if err != nil {
+		t.Fatalf("scribe.LoadDocument: %v", err)
+	}
+	expect := map[string][]string{
+		"lines":   {"line3@12", "line4@18"},
+		"bytes":   {"line4@18"},
+		"reverse": {"line4@18", "line3@12"},
+	}
+	for name, exp := range expect {
+		c, err := doc.EvaluateObject(name)
+		if err != nil {
+			t.Fatalf("EvaluateObject: %v", err)
+		}
+		got := make([]string, 0)
+		for _, x := range c {
+			if x.Location == nil || x.Location.Line != 0 {
+				t.Fatalf("%v: unexpected location %v", name, x.Location)
+			}
+			got = append(got, fmt.Sprintf("%v@%v", x.Value, x.Location.Offset))
+		}
+		if strings.Join(got, " ") != strings.Join(exp, " ") {
+			t.Fatalf("%v: unexpected criteria %v", name, got)
+		}
+		if name == "reverse" {
+			ctx := strings.Join(c[1].Location.Context, " ")
+			if ctx != "line2 line3 line4" {
+				t.Fatalf("unexpected context %q", ctx)
+			}
+		}
+	}
+}
+
+var configKVPolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "sshd",
+		"configkv": {
+			"path": "./test/configkv",
+			"file": "^sshd_config$",
+			"format": "sshd"
+		}
+	},
+
+	{
+		"object": "sshd-last",
+		"configkv": {
+			"path": "./test/configkv",
+			"file": "^sshd_config$",
+			"format": "sshd",
+			"key": "^PermitRootLogin$",
+			"precedence": "last"
+		}
+	},
+
+	{
+		"object": "sshd-first",
+		"configkv": {
+			"path": "./test/configkv",
+			"file": "^sshd_config$",
+			"format": "sshd",
+			"key": "^permitrootlogin$"
+		}
+	},
+
+	{
+		"object": "sysctl",
+		"configkv": {
+			"path": "./test/configkv",
+			"file": "^sysctl\\.conf$",
+			"format": "sysctl"
+		}
+	},
+
+	{
+		"object": "ini",
+		"configkv": {
+			"path": "./test/configkv",
+			"file": "^app\\.ini$",
+			"format": "ini",
+			"precedence": "all"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "sshd-rootlogin",
+		"object": "sshd-first",
+		"expectedresult": true,
+		"exactmatch": { "value": "no" }
+	},
+
+	{
+		"test": "sshd-rootlogin-last",
+		"object": "sshd-last",
+		"expectedresult": false,
+		"exactmatch": { "value": "no" }
+	}
+	]
+}
+`
+
+func TestConfigKVPolicy(t *testing.T) {
+	doc := genericTestExec(t, configKVPolicyDoc)
+	expect := map[string][]string{
+		"sshd": {
+			"port=22@2", "permitrootlogin=no@3", "passwordauthentication=yes@4",
+			"ciphers=aes256-ctr,aes128-ctr@6", "banner=/etc/issue net@7",
+			"match user backup.passwordauthentication=no@10",
+		},
+		"sshd-last": {"permitrootlogin=yes@5"},
+		"sysctl": {
+			"net.ipv4.ip_forward=0@6", "kernel.randomize_va_space=2@4",
+			"net.ipv4.tcp_syncookies=1@5",
+		},
+		"ini": {"debug=true@2", "server.port=8080@5", "server.tls=enabled@6", "server.port=8443@7"},
+	}
+	for name, exp := range expect {
+		c, err := doc.EvaluateObject(name)
+		if err != nil {
+			t.Fatalf("EvaluateObject: %v", err)
+		}
+		got := make([]string, 0)
+		for _, x := range c {
+			key := strings.SplitN(x.Identifier, ":", 2)[1]
+			got = append(got, fmt.Sprintf("%v=%v@%v", key, x.Value, x.Location.Line))
+		}
+		if strings.Join(got, " ") != strings.Join(exp, " ") {
+			t.Fatalf("%v: unexpected criteria %v", name, got)
+		}
+	}
+}
+
+var configQueryPolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "minversion",
+		"configquery": {
+			"path": "./test/configquery",
+			"file": "^app\\.(json|yaml|toml)$",
+			"query": ".tls.min_version"
+		}
+	},
+
+	{
+		"object": "ports",
+		"configquery": {
+			"path": "./test/configquery",
+			"file": "^app\\.(json|yaml|toml)$",
+			"query": ".servers[].port"
+		}
+	},
+
+	{
+		"object": "dotted",
+		"configquery": {
+			"path": "./test/configquery",
+			"file": "^app\\.(json|yaml|toml)$",
+			"query": ".\"log.level\""
+		}
+	},
+
+	{
+		"object": "toml",
+		"configquery": {
+			"path": "./test/configquery",
+			"file": "^app\\.toml$",
+			"query": ".servers[1]"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "minversion",
+		"object": "minversion",
+		"expectedresult": true,
+		"evr": { "operation": ">", "value": "1.1" }
+	},
+
+	{
+		"test": "ports",
+		"object": "ports",
+		"expectedresult": true,
+		"regexp": { "value": "^(8080|8443)$" }
+	}
+	]
+}
+`
+
+func TestConfigQueryPolicy(t *testing.T) {
+	doc := genericTestExec(t, configQueryPolicyDoc)
+	expect := map[string][]string{
+		"minversion": {"app.json:.tls.min_version=1.2",
+			"app.toml:.tls.min_version=1.3", "app.yaml:.tls.min_version=1.0"},
+		"ports": {"app.json:.servers[0].port=8080", "app.json:.servers[1].port=8443",
+			"app.toml:.servers[0].port=8080", "app.toml:.servers[1].port=8443",
+			"app.yaml:.servers[0].port=8080", "app.yaml:.servers[1].port=9090"},
+		"dotted": {"app.json:.\"log.level\"=info", "app.toml:.\"log.level\"=warn",
+			"app.yaml:.\"log.level\"=debug"},
+		"toml": {`app.toml:.servers[1]={"limits":{"burst":10,"rate":1.5},` +
+			`"name":"b","port":8443,"tags":["x","y"]}`},
+	}
+	for name, exp := range expect {
+		c, err := doc.EvaluateObject(name)
+		if err != nil {
+			t.Fatalf("EvaluateObject: %v", err)
+		}
+		got := make([]string, 0)
+		for _, x := range c {
+			got = append(got, fmt.Sprintf("%v=%v", filepath.Base(x.Identifier), x.Value))
+		}
+		sort.Strings(got)
+		if strings.Join(got, " ") != strings.Join(exp, " ") {
+			t.Fatalf("%v: unexpected criteria %v", name, got)
+		}
+	}
+}
+
+var xmlPolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "connectors",
+		"xml": {
+			"path": "./test/xml",
+			"file": "^server\\.xml$",
+			"xpath": "/Server/Service/Connector[@protocol='HTTP/1.1']/@port"
+		}
+	},
+
+	{
+		"object": "sslprotocol",
+		"xml": {
+			"path": "./test/xml",
+			"file": "^server\\.xml$",
+			"xpath": "//Connector[@SSLEnabled='true']/@sslProtocol"
+		}
+	},
+
+	{
+		"object": "timeout",
+		"xml": {
+			"path": "./test/xml",
+			"file": "^web\\.xml$",
+			"xpath": "//session-timeout"
+		}
+	},
+
+	{
+		"object": "cookie",
+		"xml": {
+			"path": "./test/xml",
+			"file": "^web\\.xml$",
+			"xpath": "/web-app/session-config/cookie-config/*"
+		}
+	},
+
+	{
+		"object": "listings",
+		"xml": {
+			"path": "./test/xml",
+			"file": "^web\\.xml$",
+			"xpath": "//init-param[param-name='listings']/param-value/text()"
+		}
+	},
+
+	{
+		"object": "second",
+		"xml": {
+			"path": "./test/xml",
+			"file": "^server\\.xml$",
+			"xpath": "/Server/Service/Connector[2]/@port"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "sslprotocol",
+		"object": "sslprotocol",
+		"expectedresult": true,
+		"exactmatch": { "value": "TLSv1.2" }
+	},
+
+	{
+		"test": "listings",
+		"object": "listings",
+		"expectedresult": true,
+		"exactmatch": { "value": "false" }
+	}
+	]
+}
+`
+
+func TestXMLPolicy(t *testing.T) {
+	doc := genericTestExec(t, xmlPolicyDoc)
+	expect := map[string][]string{
+		"connectors": {"/Server[1]/Service[1]/Connector[1]/@port=8080",
+			"/Server[1]/Service[1]/Connector[2]/@port=8443"},
+		"sslprotocol": {"/Server[1]/Service[1]/Connector[2]/@sslProtocol=TLSv1.2"},
+		"timeout":     {"/web-app[1]/session-config[1]/session-timeout[1]=30"},
+		"cookie": {"/web-app[1]/session-config[1]/cookie-config[1]/http-only[1]=true",
+			"/web-app[1]/session-config[1]/cookie-config[1]/secure[1]=false"},
+		"listings": {"/web-app[1]/servlet[1]/init-param[1]/param-value[1]/text()=false"},
+		"second":   {"/Server[1]/Service[1]/Connector[2]/@port=8443"},
+	}
+	for name, exp := range expect {
+		c, err := doc.EvaluateObject(name)
+		if err != nil {
+			t.Fatalf("EvaluateObject: %v", err)
+		}
+		got := make([]string, 0)
+		for _, x := range c {
+			node := strings.SplitN(x.Identifier, ":", 2)[1]
+			got = append(got, fmt.Sprintf("%v=%v", node, x.Value))
+		}
+		if strings.Join(got, " ") != strings.Join(exp, " ") {
+			t.Fatalf("%v: unexpected criteria %v", name, got)
+		}
+	}
+}
+
+func benchmarkTree(b *testing.B) string {
+	root, err := ioutil.TempDir("", "scribe-bench")
+	if err != nil {
+		b.Fatalf("ioutil.TempDir: %v", err)
+	}
+	for i := 0; i < 50; i++ {
+		dir := filepath.Join(root, fmt.Sprintf("dir%v", i), "sub")
+		err = os.MkdirAll(dir, 0755)
+		if err != nil {
+			b.Fatalf("os.MkdirAll: %v", err)
+		}
+		for j := 0; j < 40; j++ {
+			err = ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("file%v.conf", j)),
+				[]byte("value = 1\n"), 0644)
+			if err != nil {
+				b.Fatalf("ioutil.WriteFile: %v", err)
+			}
+		}
+	}
+	return root
+}
+
+func benchmarkLocate(b *testing.B, objects int) {
+	root := benchmarkTree(b)
+	defer os.RemoveAll(root)
+	objs := make([]string, 0)
+	tests := make([]string, 0)
+	for i := 0; i < objects; i++ {
+		objs = append(objs, fmt.Sprintf(`{"object": "o%v", "filename": `+
+			`{"path": %q, "file": "^(file%v)\\.conf$"}}`, i, root, i))
+		tests = append(tests, fmt.Sprintf(`{"test": "t%v", "object": "o%v"}`, i, i))
+	}
+	docstr := fmt.Sprintf(`{"objects": [%v], "tests": [%v]}`,
+		strings.Join(objs, ","), strings.Join(tests, ","))
+	scribe.Bootstrap()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		doc, err := scribe.LoadDocument(strings.NewReader(docstr))
+		if err != nil {
+			b.Fatalf("scribe.LoadDocument: %v", err)
+		}
+		err = scribe.AnalyzeDocument(doc)
+		if err != nil {
+			b.Fatalf("scribe.AnalyzeDocument: %v", err)
+		}
+	}
+}
+
+func BenchmarkLocate(b *testing.B) {
+	benchmarkLocate(b, 1)
+}
+
+func BenchmarkLocateSharedRoot(b *testing.B) {
+	benchmarkLocate(b, 10)
+}
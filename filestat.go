@@ -0,0 +1,173 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+)
+
+// FileStat is used to perform tests against the permissions and ownership
+// of files located on the file system.
+//
+// Files are located using Path and File in the same way as for FileName.
+// Property specifies which attribute of the file is returned as the test
+// value for each file, and can be one of:
+//
+// mode: the permission bits of the file as a four digit octal string,
+// including the setuid, setgid and sticky bits (for example "0644")
+//
+// owner: the name of the user owning the file, or the numeric user ID if
+// the user is not known
+//
+// group: the name of the group owning the file, or the numeric group ID if
+// the group is not known
+//
+// Ownership is not available on Windows, where only mode is supported.
+type FileStat struct {
+	Path     string `json:"path,omitempty" yaml:"path,omitempty"`
+	File     string `json:"file,omitempty" yaml:"file,omitempty"`
+	Property string `json:"property,omitempty" yaml:"property,omitempty"`
+
+	LocatorOptions `yaml:",inline"`
+
+	fileRe  compiledRegexp
+	matches []fileStatStatus
+}
+
+type fileStatStatus struct {
+	path  string
+	value string
+}
+
+func (f *FileStat) isChain() bool {
+	return false
+}
+
+func (f *FileStat) fireChains(d *Document) ([]evaluationCriteria, error) {
+	return nil, nil
+}
+
+func (f *FileStat) mergeCriteria(c []evaluationCriteria) {
+}
+
+func (f *FileStat) validate(d *Document) error {
+	if len(f.Path) == 0 {
+		return fmt.Errorf("filestat path must be set")
+	}
+	if len(f.File) == 0 {
+		return fmt.Errorf("filestat file must be set")
+	}
+	_, err := f.fileRe.compile(f.fileExpression(f.File))
+	if err != nil {
+		return err
+	}
+	switch f.Property {
+	case "mode", "owner", "group":
+	default:
+		return fmt.Errorf("filestat property must be mode, owner or group")
+	}
+	return nil
+}
+
+func (f *FileStat) expandVariables(v []Variable) {
+	f.Path = variableExpansion(v, f.Path)
+	f.File = variableExpansion(v, f.File)
+}
+
+func (f *FileStat) getCriteria() (ret []evaluationCriteria) {
+	for _, x := range f.matches {
+		n := evaluationCriteria{}
+		n.identifier = x.path
+		n.testValue = x.value
+		ret = append(ret, n)
+	}
+	return ret
+}
+
+func (f *FileStat) prepare() error {
+	debugPrint("prepare(): analyzing file system, path %v, file \"%v\"\n", f.Path, f.File)
+
+	re, err := f.fileRe.compile(f.fileExpression(f.File))
+	if err != nil {
+		return err
+	}
+
+	sfl := newSimpleFileLocator()
+	sfl.root = f.Path
+	sfl.opts = f.LocatorOptions
+	err = sfl.locateRegexp(re)
+	if err != nil {
+		return err
+	}
+
+	for _, x := range sfl.matches {
+		v, err := fileStatProperty(x, f.Property)
+		if err != nil {
+			debugPrint("prepare(): skipping %v: %v\n", x, err)
+			continue
+		}
+		debugPrint("prepare(): %v %v: %v\n", x, f.Property, v)
+		f.matches = append(f.matches, fileStatStatus{path: sfl.identifier(x), value: v})
+	}
+	return nil
+}
+
+func fileStatProperty(path string, property string) (string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	switch property {
+	case "mode":
+		return fileModeString(fi.Mode()), nil
+	case "owner", "group":
+		uid, gid, ok := fileOwner(fi)
+		if !ok {
+			return "", fmt.Errorf("file ownership not available")
+		}
+		if property == "owner" {
+			id := strconv.FormatUint(uint64(uid), 10)
+			u, err := user.LookupId(id)
+			if err != nil {
+				return id, nil
+			}
+			return u.Username, nil
+		}
+		id := strconv.FormatUint(uint64(gid), 10)
+		g, err := user.LookupGroupId(id)
+		if err != nil {
+			return id, nil
+		}
+		return g.Name, nil
+	}
+	return "", fmt.Errorf("unknown filestat property %v", property)
+}
+
+// Return the permission bits of m in octal, in the form used by chmod.
+func fileModeString(m os.FileMode) string {
+	return fmt.Sprintf("%04o", fileModeBits(m))
+}
+
+// Return the permission bits of m, including the setuid, setgid and sticky
+// bits, as used by chmod.
+func fileModeBits(m os.FileMode) uint32 {
+	v := uint32(m.Perm())
+	if m&os.ModeSetuid != 0 {
+		v |= 04000
+	}
+	if m&os.ModeSetgid != 0 {
+		v |= 02000
+	}
+	if m&os.ModeSticky != 0 {
+		v |= 01000
+	}
+	return v
+}
@@ -0,0 +1,150 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	goruntime "runtime"
+	"strconv"
+	"strings"
+)
+
+// Firmware is used to perform tests against the platform integrity
+// features of the system on Linux, such as UEFI Secure Boot and the
+// presence of a TPM. On other platforms no criteria are returned.
+//
+// Property specifies what is returned as the test value, with the property
+// as the identifier, and can be one of:
+//
+// uefi: true if the system booted using UEFI, otherwise false
+//
+// secureboot: true if UEFI Secure Boot is enabled, otherwise false
+//
+// setupmode: true if the firmware is in Secure Boot setup mode, in which
+// the platform key is not enrolled and Secure Boot is not enforced,
+// otherwise false
+//
+// tpm: true if a TPM is present, otherwise false
+//
+// tpmversion: the version of the TPM, 1.2 or 2.0, or none if no TPM is
+// present
+type Firmware struct {
+	Property string `json:"property,omitempty" yaml:"property,omitempty"`
+
+	matches []firmwareMatch
+}
+
+type firmwareMatch struct {
+	identifier string
+	value      string
+}
+
+// The root of the file system firmware state is read from.
+var firmwareRoot = "/"
+
+// The vendor GUID of global UEFI variables such as SecureBoot.
+const efiGlobalVariable = "8be4df61-93ca-11d2-aa0d-00e098032b8c"
+
+func (f *Firmware) isChain() bool {
+	return false
+}
+
+func (f *Firmware) fireChains(d *Document) ([]evaluationCriteria, error) {
+	return nil, nil
+}
+
+func (f *Firmware) mergeCriteria(c []evaluationCriteria) {
+}
+
+func (f *Firmware) validate(d *Document) error {
+	switch f.Property {
+	case "uefi", "secureboot", "setupmode", "tpm", "tpmversion":
+	default:
+		return fmt.Errorf("firmware property must be uefi, secureboot, setupmode, tpm or tpmversion")
+	}
+	return nil
+}
+
+func (f *Firmware) expandVariables(v []Variable) {
+}
+
+func (f *Firmware) getCriteria() (ret []evaluationCriteria) {
+	for _, x := range f.matches {
+		n := evaluationCriteria{}
+		n.identifier = x.identifier
+		n.testValue = x.value
+		ret = append(ret, n)
+	}
+	return ret
+}
+
+func (f *Firmware) prepare() error {
+	debugPrint("prepare(): inspecting firmware, property \"%v\"\n", f.Property)
+	root := firmwareRoot
+	if sRuntime.testHooks {
+		root = "./test/firmware"
+	} else if goruntime.GOOS != "linux" {
+		return nil
+	}
+	var v string
+	switch f.Property {
+	case "uefi":
+		_, err := os.Stat(filepath.Join(root, "sys/firmware/efi"))
+		v = strconv.FormatBool(err == nil)
+	case "secureboot":
+		v = strconv.FormatBool(efiBoolVariable(root, "SecureBoot"))
+	case "setupmode":
+		v = strconv.FormatBool(efiBoolVariable(root, "SetupMode"))
+	case "tpm":
+		v = strconv.FormatBool(tpmVersion(root) != "none")
+	case "tpmversion":
+		v = tpmVersion(root)
+	}
+	f.matches = append(f.matches, firmwareMatch{f.Property, v})
+	return nil
+}
+
+// Return the value of a global boolean UEFI variable, false if it does not
+// exist. In efivarfs variables are prefixed with 4 bytes of attributes.
+func efiBoolVariable(root string, name string) bool {
+	buf, err := ioutil.ReadFile(filepath.Join(root, "sys/firmware/efi/efivars", name+"-"+efiGlobalVariable))
+	if err != nil || len(buf) < 5 {
+		return false
+	}
+	return buf[4] == 1
+}
+
+// Return the version of the first TPM, or none if there is no TPM.
+func tpmVersion(root string) string {
+	dir := filepath.Join(root, "sys/class/tpm/tpm0")
+	if _, err := os.Stat(dir); err != nil {
+		return "none"
+	}
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "tpm_version_major"))
+	if err == nil {
+		switch strings.TrimSpace(string(buf)) {
+		case "1":
+			return "1.2"
+		case "2":
+			return "2.0"
+		}
+	}
+	// Kernels without tpm_version_major only report capabilities for
+	// TPM 1.2 devices, and only TPM 2.0 devices have a resource manager.
+	buf, err = ioutil.ReadFile(filepath.Join(dir, "caps"))
+	if err == nil && strings.Contains(string(buf), "TCG version: 1.2") {
+		return "1.2"
+	}
+	if _, err := os.Stat(filepath.Join(root, "dev/tpmrm0")); err == nil {
+		return "2.0"
+	}
+	return "1.2"
+}
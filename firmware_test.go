@@ -0,0 +1,91 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"testing"
+)
+
+// Used in TestFirmwarePolicy
+var firmwarePolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "uefi",
+		"firmware": {
+			"property": "uefi"
+		}
+	},
+
+	{
+		"object": "secureboot",
+		"firmware": {
+			"property": "secureboot"
+		}
+	},
+
+	{
+		"object": "setupmode",
+		"firmware": {
+			"property": "setupmode"
+		}
+	},
+
+	{
+		"object": "tpmversion",
+		"firmware": {
+			"property": "tpmversion"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "firmware0",
+		"expectedresult": true,
+		"object": "uefi",
+		"exactmatch": {
+			"value": "true"
+		}
+	},
+
+	{
+		"test": "firmware1",
+		"expectedresult": true,
+		"object": "secureboot",
+		"exactmatch": {
+			"value": "true"
+		}
+	},
+
+	{
+		"test": "firmware2",
+		"expectedresult": true,
+		"object": "setupmode",
+		"exactmatch": {
+			"value": "false"
+		}
+	},
+
+	{
+		"test": "firmware3",
+		"expectedresult": true,
+		"object": "tpmversion",
+		"compare": {
+			"type": "version",
+			"operation": ">=",
+			"value": "2.0"
+		}
+	}
+	]
+}
+`
+
+func TestFirmwarePolicy(t *testing.T) {
+	genericTestExec(t, firmwarePolicyDoc)
+}
@@ -0,0 +1,138 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+)
+
+// Generator expands templated objects and tests over a list of parameters
+// when a document is loaded, so large numbers of near identical checks (for
+// example a list of sysctl keys and their expected values) can be written
+// as a compact table.
+//
+// For each entry in Parameters, a copy of each object and test in the
+// generator is added to the document, with any occurrence of @{name} in
+// the object or test replaced with the value of the parameter name. Object
+// names and test identifiers must include a parameter so each copy is
+// unique. For example:
+//
+//	"generators": [
+//	{
+//		"parameters": [
+//		{ "key": "ip_forward", "value": "0" },
+//		{ "key": "tcp_syncookies", "value": "1" }
+//		],
+//		"objects": [
+//		{
+//			"object": "sysctl-@{key}",
+//			"filecontent": {
+//				"path": "/proc/sys/net/ipv4",
+//				"file": "^@{key}$",
+//				"expression": "(.*)"
+//			}
+//		}
+//		],
+//		"tests": [
+//		{
+//			"test": "sysctl-@{key}",
+//			"object": "sysctl-@{key}",
+//			"exactmatch": { "value": "@{value}" }
+//		}
+//		]
+//	}
+//	]
+//
+// Generators are removed from the document once they have been expanded.
+type Generator struct {
+	Parameters []map[string]string `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+	Objects    []Object            `json:"objects,omitempty" yaml:"objects,omitempty"`
+	Tests      []Test              `json:"tests,omitempty" yaml:"tests,omitempty"`
+}
+
+// Parameter references in generator templates.
+var generatorParameter = regexp.MustCompile(`@\{([^}]*)\}`)
+
+// Expand the generators in the document, adding the generated objects and
+// tests to the document and removing the generators.
+func (d *Document) expandGenerators() error {
+	if len(d.Generators) == 0 {
+		return nil
+	}
+	objects := make(map[string]bool)
+	tests := make(map[string]bool)
+	for _, x := range d.Objects {
+		objects[x.Object] = true
+	}
+	for _, x := range d.Tests {
+		tests[x.TestID] = true
+	}
+	for i, g := range d.Generators {
+		if len(g.Parameters) == 0 {
+			return fmt.Errorf("generator %v has no parameters", i)
+		}
+		for _, p := range g.Parameters {
+			for _, x := range g.Objects {
+				var o Object
+				err := expandTemplate(x, p, &o)
+				if err != nil {
+					return fmt.Errorf("generator %v: object %v: %v", i, x.Object, err)
+				}
+				if objects[o.Object] {
+					return fmt.Errorf("generator %v: object %v is not unique", i, o.Object)
+				}
+				objects[o.Object] = true
+				d.Objects = append(d.Objects, o)
+			}
+			for _, x := range g.Tests {
+				var t Test
+				err := expandTemplate(x, p, &t)
+				if err != nil {
+					return fmt.Errorf("generator %v: test %v: %v", i, x.TestID, err)
+				}
+				if tests[t.TestID] {
+					return fmt.Errorf("generator %v: test %v is not unique", i, t.TestID)
+				}
+				tests[t.TestID] = true
+				d.Tests = append(d.Tests, t)
+			}
+		}
+		debugPrint("expandGenerators(): generator %v expanded over %v parameter set(s)\n",
+			i, len(g.Parameters))
+	}
+	d.Generators = nil
+	return nil
+}
+
+// Substitute the parameters in params into the template tmpl, storing the
+// result in v.
+func expandTemplate(tmpl interface{}, params map[string]string, v interface{}) error {
+	buf, err := json.Marshal(tmpl)
+	if err != nil {
+		return err
+	}
+	var perr error
+	buf = generatorParameter.ReplaceAllFunc(buf, func(m []byte) []byte {
+		name := string(generatorParameter.FindSubmatch(m)[1])
+		val, ok := params[name]
+		if !ok {
+			perr = fmt.Errorf("undefined parameter %v", name)
+			return m
+		}
+		// The value is substituted into a JSON string, so it must be
+		// escaped.
+		esc, _ := json.Marshal(val)
+		return esc[1 : len(esc)-1]
+	})
+	if perr != nil {
+		return perr
+	}
+	return json.Unmarshal(buf, v)
+}
@@ -0,0 +1,83 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mozilla/scribe"
+)
+
+// Used in TestGenerators
+var generatorPolicyDoc = `
+{
+	"generators": [
+	{
+		"parameters": [
+		{ "file": "testfile0", "expect": "Test" },
+		{ "file": "testfile1", "expect": "Version = 0.5" }
+		],
+
+		"objects": [
+		{
+			"object": "content-@{file}",
+			"filecontent": {
+				"path": "./test/filecontent",
+				"file": "^@{file}$",
+				"expression": "(.*)"
+			}
+		}
+		],
+
+		"tests": [
+		{
+			"test": "content-@{file}",
+			"object": "content-@{file}",
+			"description": "@{file} contains @{expect}",
+			"expectedresult": true,
+			"regexp": {
+				"value": "@{expect}"
+			}
+		}
+		]
+	}
+	]
+}
+`
+
+func TestGenerators(t *testing.T) {
+	doc := genericTestExec(t, generatorPolicyDoc)
+	if len(doc.Generators) != 0 || len(doc.Objects) != 2 || len(doc.Tests) != 2 {
+		t.Fatalf("unexpected expansion: %v generators, %v objects, %v tests",
+			len(doc.Generators), len(doc.Objects), len(doc.Tests))
+	}
+	tst, err := doc.GetTest("content-testfile1")
+	if err != nil {
+		t.Fatalf("GetTest: %v", err)
+	}
+	if tst.Description != "testfile1 contains Version = 0.5" {
+		t.Fatalf("unexpected description %q", tst.Description)
+	}
+}
+
+func TestGeneratorInvalid(t *testing.T) {
+	for _, x := range []string{
+		// Undefined parameter.
+		`{"generators": [{"parameters": [{"a": "1"}],
+		"objects": [{"object": "o-@{b}", "raw": {"identifiers": [{"identifier": "a", "value": "b"}]}}]}]}`,
+		// Generated names are not unique.
+		`{"generators": [{"parameters": [{"a": "1"}, {"a": "2"}],
+		"objects": [{"object": "o", "raw": {"identifiers": [{"identifier": "a", "value": "@{a}"}]}}]}]}`,
+	} {
+		_, err := scribe.LoadDocument(strings.NewReader(x))
+		if err == nil {
+			t.Fatalf("document should fail to load: %v", x)
+		}
+	}
+}
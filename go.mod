@@ -0,0 +1,8 @@
+module github.com/mozilla/scribe
+
+go 1.16
+
+require (
+	github.com/lib/pq v1.0.0
+	gopkg.in/yaml.v2 v2.0.0
+)
@@ -0,0 +1,176 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// DocumentGraph describes the relationships between the variables, objects
+// and tests in a document, as returned by Graph(). It can be used by
+// maintainers of large documents to visualize and review the document, for
+// example using WriteDOT() to render it with Graphviz, or encoded as JSON
+// for other tools.
+type DocumentGraph struct {
+	Nodes []GraphNode `json:"nodes" yaml:"nodes"`
+	Edges []GraphEdge `json:"edges" yaml:"edges"`
+}
+
+// GraphNode is a variable, object or test in a DocumentGraph. The ID of the
+// node is the kind and name of the node separated by a colon, for example
+// object:sshd-config.
+type GraphNode struct {
+	ID     string `json:"id" yaml:"id"`
+	Kind   string `json:"kind" yaml:"kind"`                         // variable, object or test.
+	Name   string `json:"name" yaml:"name"`                         // The variable key, object name or test identifier.
+	Source string `json:"source,omitempty" yaml:"source,omitempty"` // The source type of an object.
+}
+
+// GraphEdge is a relationship between two nodes in a DocumentGraph.
+//
+// Kind is one of:
+//
+// object: a test references an object
+//
+// if: a test depends on another test
+//
+// chain: an object imports a chain object
+//
+// variable: an object uses a variable
+type GraphEdge struct {
+	From string `json:"from" yaml:"from"`
+	To   string `json:"to" yaml:"to"`
+	Kind string `json:"kind" yaml:"kind"`
+}
+
+// Graph returns the DocumentGraph for the document. The document does not
+// need to have been analyzed.
+func (d *Document) Graph() (DocumentGraph, error) {
+	ret := DocumentGraph{
+		Nodes: make([]GraphNode, 0),
+		Edges: make([]GraphEdge, 0),
+	}
+	for _, x := range d.Variables {
+		ret.Nodes = append(ret.Nodes, GraphNode{
+			ID:   "variable:" + x.Key,
+			Kind: "variable",
+			Name: x.Key,
+		})
+	}
+	for i := range d.Objects {
+		o := &d.Objects[i]
+		id := "object:" + o.Object
+		ret.Nodes = append(ret.Nodes, GraphNode{
+			ID:     id,
+			Kind:   "object",
+			Name:   o.Object,
+			Source: o.sourceName(),
+		})
+		for _, x := range o.FileContent.ImportChain {
+			ret.Edges = append(ret.Edges, GraphEdge{From: id, To: "object:" + x, Kind: "chain"})
+		}
+		// Variables can be used in any field of the source, so look
+		// for references in the encoded object.
+		buf, err := json.Marshal(o)
+		if err != nil {
+			return ret, err
+		}
+		for _, x := range d.Variables {
+			if strings.Contains(string(buf), "${"+x.Key+"}") {
+				ret.Edges = append(ret.Edges, GraphEdge{From: id, To: "variable:" + x.Key, Kind: "variable"})
+			}
+		}
+	}
+	for _, x := range d.Tests {
+		id := "test:" + x.TestID
+		ret.Nodes = append(ret.Nodes, GraphNode{
+			ID:   id,
+			Kind: "test",
+			Name: x.TestID,
+		})
+		ret.Edges = append(ret.Edges, GraphEdge{From: id, To: "object:" + x.Object, Kind: "object"})
+		for _, y := range x.If {
+			ret.Edges = append(ret.Edges, GraphEdge{From: id, To: "test:" + y, Kind: "if"})
+		}
+	}
+	return ret, nil
+}
+
+// Return the name of the source type used by the object, as used in the
+// document.
+func (o *Object) sourceName() string {
+	si := o.getSourceInterface()
+	if si == nil {
+		return ""
+	}
+	p := reflect.ValueOf(si).Pointer()
+	v := reflect.ValueOf(o).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		if f.Kind() != reflect.Struct || !f.CanAddr() || f.Addr().Pointer() != p {
+			continue
+		}
+		// Ensure this is the source itself, and not a zero size or
+		// leading field sharing its address.
+		if f.Addr().Type() != reflect.TypeOf(si) {
+			continue
+		}
+		return strings.Split(v.Type().Field(i).Tag.Get("json"), ",")[0]
+	}
+	return ""
+}
+
+// WriteDOT writes the graph to w in the Graphviz DOT language. Tests are
+// drawn as ellipses, objects as boxes and variables as notes. Test
+// dependencies are drawn as dashed edges, and variable usage as dotted
+// edges.
+func (g DocumentGraph) WriteDOT(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("digraph scribe {\n\trankdir=LR;\n")
+	for _, x := range g.Nodes {
+		label := x.Name
+		shape := "ellipse"
+		switch x.Kind {
+		case "object":
+			shape = "box"
+			if x.Source != "" {
+				label += "\n(" + x.Source + ")"
+			}
+		case "variable":
+			shape = "note"
+			label = "${" + x.Name + "}"
+		}
+		fmt.Fprintf(&b, "\t%v [label=%v, shape=%v];\n", dotQuote(x.ID), dotQuote(label), shape)
+	}
+	for _, x := range g.Edges {
+		attr := ""
+		switch x.Kind {
+		case "if":
+			attr = " [style=dashed, label=\"if\"]"
+		case "chain":
+			attr = " [label=\"chain\"]"
+		case "variable":
+			attr = " [style=dotted]"
+		}
+		fmt.Fprintf(&b, "\t%v -> %v%v;\n", dotQuote(x.From), dotQuote(x.To), attr)
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func dotQuote(s string) string {
+	s = strings.Replace(s, "\\", "\\\\", -1)
+	s = strings.Replace(s, "\"", "\\\"", -1)
+	s = strings.Replace(s, "\n", "\\n", -1)
+	return "\"" + s + "\""
+}
@@ -0,0 +1,114 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/mozilla/scribe"
+)
+
+var graphDoc = `
+{
+	"variables": [
+	{ "key": "root", "value": "./test/import-chain" }
+	],
+
+	"objects": [
+	{
+		"object": "config",
+		"filecontent": {
+			"path": "${root}",
+			"file": "testfile0",
+			"expression": "^(\\S+)",
+			"import-chain": [ "included" ]
+		}
+	},
+
+	{
+		"object": "included",
+		"filecontent": {
+			"path": "${chain_root}",
+			"file": "${chain_file}",
+			"expression": "^(\\S+)"
+		}
+	},
+
+	{
+		"object": "openssl",
+		"package": {
+			"name": "openssl"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "openssl-present",
+		"object": "openssl"
+	},
+
+	{
+		"test": "config-value",
+		"object": "config",
+		"if": [ "openssl-present" ]
+	}
+	]
+}
+`
+
+func TestGraph(t *testing.T) {
+	doc, err := scribe.LoadDocument(strings.NewReader(graphDoc))
+	if err != nil {
+		t.Fatalf("scribe.LoadDocument: %v", err)
+	}
+	g, err := doc.Graph()
+	if err != nil {
+		t.Fatalf("Graph: %v", err)
+	}
+	nodes := make([]string, 0)
+	for _, x := range g.Nodes {
+		nodes = append(nodes, x.ID+"/"+x.Source)
+	}
+	expect := "variable:root/ object:config/filecontent object:included/filecontent " +
+		"object:openssl/package test:openssl-present/ test:config-value/"
+	if strings.Join(nodes, " ") != expect {
+		t.Fatalf("unexpected nodes %v", nodes)
+	}
+	edges := make([]string, 0)
+	for _, x := range g.Edges {
+		edges = append(edges, x.From+" "+x.Kind+" "+x.To)
+	}
+	expect = "object:config chain object:included," +
+		"object:config variable variable:root," +
+		"test:openssl-present object object:openssl," +
+		"test:config-value object object:config," +
+		"test:config-value if test:openssl-present"
+	if strings.Join(edges, ",") != expect {
+		t.Fatalf("unexpected edges %v", edges)
+	}
+
+	var buf bytes.Buffer
+	err = g.WriteDOT(&buf)
+	if err != nil {
+		t.Fatalf("WriteDOT: %v", err)
+	}
+	for _, x := range []string{
+		"digraph scribe {",
+		"\t\"object:config\" [label=\"config\\n(filecontent)\", shape=box];",
+		"\t\"variable:root\" [label=\"${root}\", shape=note];",
+		"\t\"test:config-value\" -> \"test:openssl-present\" [style=dashed, label=\"if\"];",
+		"\t\"object:config\" -> \"variable:root\" [style=dotted];",
+	} {
+		if !strings.Contains(buf.String(), x) {
+			t.Fatalf("DOT output missing %q:\n%v", x, buf.String())
+		}
+	}
+}
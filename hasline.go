@@ -9,7 +9,6 @@ package scribe
 
 import (
 	"fmt"
-	"regexp"
 )
 
 // HasLine is used to perform tests against whether or not a file contains a given
@@ -19,6 +18,10 @@ type HasLine struct {
 	File       string `json:"file,omitempty" yaml:"file,omitempty"`
 	Expression string `json:"expression,omitempty" yaml:"expression,omitempty"`
 
+	LocatorOptions `yaml:",inline"`
+
+	fileRe  compiledRegexp
+	exprRe  compiledRegexp
 	matches []haslineStatus
 }
 
@@ -34,14 +37,14 @@ func (h *HasLine) validate(d *Document) error {
 	if len(h.File) == 0 {
 		return fmt.Errorf("hasline file must be set")
 	}
-	_, err := regexp.Compile(h.File)
+	_, err := h.fileRe.compile(h.fileExpression(h.File))
 	if err != nil {
 		return err
 	}
 	if len(h.Expression) == 0 {
 		return fmt.Errorf("hasline expression must be set")
 	}
-	_, err = regexp.Compile(h.Expression)
+	_, err = h.exprRe.compile(h.Expression)
 	if err != nil {
 		return err
 	}
@@ -77,22 +80,35 @@ func (h *HasLine) getCriteria() (ret []evaluationCriteria) {
 func (h *HasLine) prepare() error {
 	debugPrint("prepare(): analyzing file system, path %v, file \"%v\"\n", h.Path, h.File)
 
+	filere, err := h.fileRe.compile(h.fileExpression(h.File))
+	if err != nil {
+		return err
+	}
+	exprre, err := h.exprRe.compile(h.Expression)
+	if err != nil {
+		return err
+	}
+
 	sfl := newSimpleFileLocator()
 	sfl.root = h.Path
-	err := sfl.locate(h.File, true)
+	sfl.opts = h.LocatorOptions
+	err = sfl.locateRegexp(filere)
 	if err != nil {
 		return err
 	}
 
+	// Only the presence of the line is of interest, so stop reading each
+	// file at the first match.
+	opts := contentCheckOptions{maxMatches: 1, locator: h.LocatorOptions}
 	for _, x := range sfl.matches {
-		m, err := fileContentCheck(x, h.Expression)
+		m, err := fileContentCheck(x, exprre, opts)
 		// XXX These soft errors during preparation are ignored right
 		// now, but they should probably be tracked somewhere.
 		if err != nil {
 			continue
 		}
 		ncm := haslineStatus{}
-		ncm.path = x
+		ncm.path = sfl.identifier(x)
 		if m == nil || len(m) == 0 {
 			debugPrint("prepare(): content not found in \"%v\"\n", x)
 			ncm.found = false
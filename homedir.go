@@ -0,0 +1,111 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The built-in variable that can be used in the path of a filesystem based
+// object to search the home directory of every local user. The path is
+// searched once for each user with the variable replaced by the home
+// directory of the user, and the identifier of each located file is
+// prefixed with the name of the user followed by a colon, for example
+// alice:/home/alice/.netrc. Home directories are read from the passwd file.
+// Users sharing a home directory are only searched once, and a home
+// directory of / is never searched.
+const homeDirsVariable = "${homedirs}"
+
+// The path to the passwd file home directories are read from.
+var passwdPath = "/etc/passwd"
+
+type homeDirectory struct {
+	user string
+	dir  string
+}
+
+// Return the home directory of each local user, in the order listed in the
+// passwd file.
+func getHomeDirectories() []homeDirectory {
+	if e := evidenceReplaying(); e != nil {
+		return e.getHomes()
+	}
+	ret := hostHomeDirectories()
+	if e := evidenceRecording(); e != nil {
+		e.setHomes(ret)
+	}
+	return ret
+}
+
+func hostHomeDirectories() []homeDirectory {
+	if sRuntime.testHooks {
+		return testHomeDirectories()
+	}
+	ret := make([]homeDirectory, 0)
+	fd, err := os.Open(passwdPath)
+	if err != nil {
+		debugPrint("getHomeDirectories(): %v\n", err)
+		return ret
+	}
+	defer fd.Close()
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		s := strings.Split(scanner.Text(), ":")
+		if len(s) < 7 || strings.HasPrefix(s[0], "#") {
+			continue
+		}
+		dir := filepath.Clean(s[5])
+		if s[5] == "" || dir == "/" || seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		ret = append(ret, homeDirectory{user: s[0], dir: dir})
+	}
+	return ret
+}
+
+// Expand the home directory variable in roots, returning the new list of
+// roots and the user each root belongs to. The user is empty for roots that
+// do not use the variable.
+func expandHomeRoots(roots []string) ([]string, []string) {
+	var (
+		homes []homeDirectory
+		ret   = make([]string, 0, len(roots))
+		users = make([]string, 0, len(roots))
+	)
+	for _, x := range roots {
+		if !strings.Contains(x, homeDirsVariable) {
+			ret = append(ret, x)
+			users = append(users, "")
+			continue
+		}
+		if homes == nil {
+			homes = getHomeDirectories()
+		}
+		for _, y := range homes {
+			ret = append(ret, strings.Replace(x, homeDirsVariable, y.dir, -1))
+			users = append(users, y.user)
+		}
+	}
+	return ret, users
+}
+
+var testHomeDirectoryTable = []homeDirectory{
+	{"alice", "./test/homedirs/alice"},
+	{"bob", "./test/homedirs/bob"},
+}
+
+func testHomeDirectories() []homeDirectory {
+	ret := make([]homeDirectory, 0)
+	ret = append(ret, testHomeDirectoryTable...)
+	return ret
+}
@@ -0,0 +1,170 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// IgnoreList is a list of path patterns, as loaded from an ignore file using
+// LoadIgnore(). Ignore lists are kept separate from policy documents, so a
+// single list of exclusions (for example scratch directories or data
+// volumes) can be maintained for all documents evaluated on a system.
+//
+// The ignore file uses gitignore syntax. Each line contains a pattern, blank
+// lines and lines starting with # are ignored. A pattern starting with !
+// re-includes paths excluded by an earlier pattern, and a pattern ending
+// with / only matches directories. Patterns containing a / other than at
+// the end are anchored at the file system root, other patterns match a file
+// or directory name at any level. The wildcards *, ? and character classes
+// do not match /, and ** matches any number of directories. The last
+// pattern matching a path determines if it is ignored.
+type IgnoreList struct {
+	patterns []ignorePattern
+}
+
+type ignorePattern struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// LoadIgnore loads an ignore file from the reader specified by r.
+func LoadIgnore(r io.Reader) (*IgnoreList, error) {
+	ret := &IgnoreList{}
+	scanner := bufio.NewScanner(r)
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		p, ok, err := parseIgnorePattern(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("ignore file line %v: %v", lineno, err)
+		}
+		if ok {
+			ret.patterns = append(ret.patterns, p)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	debugPrint("loaded %v ignore pattern(s)\n", len(ret.patterns))
+	return ret, nil
+}
+
+// SetIgnore installs an ignore list that will be applied by all file system
+// based sources when locating files. Passing nil removes any installed
+// ignore list.
+func SetIgnore(l *IgnoreList) {
+	sRuntime.ignore = l
+}
+
+// Match returns true if the absolute path should be ignored, isDir indicates
+// if the path is a directory.
+func (l *IgnoreList) Match(path string, isDir bool) bool {
+	path = filepath.ToSlash(path)
+	ret := false
+	for _, x := range l.patterns {
+		if x.dirOnly && !isDir {
+			continue
+		}
+		if x.re.MatchString(path) {
+			ret = !x.negate
+		}
+	}
+	return ret
+}
+
+func parseIgnorePattern(line string) (ret ignorePattern, ok bool, err error) {
+	// Trailing spaces are ignored unless escaped.
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ret, false, nil
+	}
+	if strings.HasPrefix(line, "!") {
+		ret.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		ret.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return ret, false, nil
+	}
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	expr := "(?:^|/)"
+	if anchored {
+		expr = "^/"
+	}
+	if line == "**" {
+		expr += ".*"
+		line = ""
+	} else if strings.HasPrefix(line, "**/") {
+		expr = "(?:^|/)"
+		line = line[3:]
+	}
+	tail := ""
+	if strings.HasSuffix(line, "/**") {
+		tail = "/.*"
+		line = line[:len(line)-3]
+	}
+	buf, err := ignoreGlobExpression(line)
+	if err != nil {
+		return ret, false, err
+	}
+	ret.re, err = regexp.Compile(expr + buf + tail + "$")
+	if err != nil {
+		return ret, false, err
+	}
+	return ret, true, nil
+}
+
+// Convert a gitignore glob to a regular expression.
+func ignoreGlobExpression(glob string) (string, error) {
+	var ret strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "/**/"):
+			ret.WriteString("/(?:.*/)?")
+			i += 3
+		case c == '*':
+			ret.WriteString("[^/]*")
+		case c == '?':
+			ret.WriteString("[^/]")
+		case c == '\\' && i+1 < len(glob):
+			i++
+			ret.WriteString(regexp.QuoteMeta(string(glob[i])))
+		case c == '[':
+			end := strings.Index(glob[i+1:], "]")
+			if end == -1 {
+				return "", fmt.Errorf("unterminated character class in %q", glob)
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			ret.WriteString("[" + strings.Replace(class, "\\", "\\\\", -1) + "]")
+			i += end + 1
+		default:
+			ret.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return ret.String(), nil
+}
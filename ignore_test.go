@@ -0,0 +1,128 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mozilla/scribe"
+)
+
+var ignoreFile = `
+# Scratch and data directories
+tmp/
+/data/volumes
+*.bak
+!keep.bak
+/srv/**/cache
+logs/**
+\#literal
+`
+
+func TestIgnoreMatch(t *testing.T) {
+	l, err := scribe.LoadIgnore(strings.NewReader(ignoreFile))
+	if err != nil {
+		t.Fatalf("scribe.LoadIgnore: %v", err)
+	}
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"/home/user/tmp", true, true},
+		{"/home/user/tmp", false, false},
+		{"/data/volumes", true, true},
+		{"/mnt/data/volumes", true, false},
+		{"/etc/app.conf.bak", false, true},
+		{"/etc/keep.bak", false, false},
+		{"/srv/cache", true, true},
+		{"/srv/a/b/cache", true, true},
+		{"/logs/app.log", false, true},
+		{"/var/logs/app.log", false, false},
+		{"/logs", true, false},
+		{"/etc/#literal", false, true},
+		{"/etc/app.conf", false, false},
+	}
+	for _, x := range tests {
+		if got := l.Match(x.path, x.isDir); got != x.want {
+			t.Errorf("Match(%v, %v) = %v, want %v", x.path, x.isDir, got, x.want)
+		}
+	}
+
+	_, err = scribe.LoadIgnore(strings.NewReader("[abc\n"))
+	if err == nil {
+		t.Fatalf("scribe.LoadIgnore should have failed with invalid pattern")
+	}
+}
+
+// Used in TestIgnoreLocate, the root path is substituted with a temporary
+// directory.
+var ignorePolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "conf",
+		"filename": {
+			"path": "%v",
+			"file": "^(.*)\\.conf$"
+		}
+	}
+	],
+
+	"tests": [
+	{ "test": "conf", "object": "conf" }
+	]
+}
+`
+
+func TestIgnoreLocate(t *testing.T) {
+	root, err := ioutil.TempDir("", "scribe-ignore")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(root)
+	for _, x := range []string{"etc/app.conf", "scratch/tmp.conf", "etc/old.conf"} {
+		p := filepath.Join(root, x)
+		err = os.MkdirAll(filepath.Dir(p), 0755)
+		if err != nil {
+			t.Fatalf("os.MkdirAll: %v", err)
+		}
+		err = ioutil.WriteFile(p, []byte("\n"), 0644)
+		if err != nil {
+			t.Fatalf("ioutil.WriteFile: %v", err)
+		}
+	}
+	l, err := scribe.LoadIgnore(strings.NewReader("scratch/\nold.conf\n"))
+	if err != nil {
+		t.Fatalf("scribe.LoadIgnore: %v", err)
+	}
+	scribe.Bootstrap()
+	scribe.SetIgnore(l)
+	defer scribe.SetIgnore(nil)
+
+	doc, err := scribe.LoadDocument(strings.NewReader(fmt.Sprintf(ignorePolicyDoc, root)))
+	if err != nil {
+		t.Fatalf("scribe.LoadDocument: %v", err)
+	}
+	err = scribe.AnalyzeDocument(doc)
+	if err != nil {
+		t.Fatalf("scribe.AnalyzeDocument: %v", err)
+	}
+	tr, err := scribe.GetResults(&doc, "conf")
+	if err != nil {
+		t.Fatalf("scribe.GetResults: %v", err)
+	}
+	if len(tr.Results) != 1 || tr.Results[0].Identifier != filepath.Join(root, "etc/app.conf") {
+		t.Fatalf("unexpected results with ignore list: %+v", tr.Results)
+	}
+}
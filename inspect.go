@@ -0,0 +1,143 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Criteria describes a single criteria returned by an object, which is what
+// the evaluator of a test referencing the object is applied to.
+type Criteria struct {
+	Identifier string `json:"identifier" yaml:"identifier"` // The source of the criteria, such as a file name.
+	Value      string `json:"value" yaml:"value"`           // The value passed to the evaluator.
+
+	Location *Location `json:"location,omitempty" yaml:"location,omitempty"` // Location of the value, if known.
+}
+
+// EvaluateObject prepares the object named obj on the host system, and
+// returns the criteria it returns. Only the object and any chain objects it
+// may import are prepared, so individual objects can be inspected without
+// analyzing the entire document, for example while writing a policy. The
+// document itself is not modified.
+func (d *Document) EvaluateObject(obj string) ([]Criteria, error) {
+	nd, err := d.subset(map[string]bool{obj: true}, nil)
+	if err != nil {
+		return nil, err
+	}
+	o, err := nd.GetObject(obj)
+	if err != nil {
+		return nil, err
+	}
+	if o.isChain {
+		return nil, fmt.Errorf("chain object \"%v\" can only be evaluated from an object importing it", obj)
+	}
+	pkgmgrReset()
+	err = nd.prepareObjects()
+	if err != nil {
+		return nil, err
+	}
+	if o.err != nil {
+		return nil, o.err
+	}
+	ret := make([]Criteria, 0)
+	for _, x := range o.getSourceInterface().getCriteria() {
+		ret = append(ret, Criteria{Identifier: x.identifier, Value: x.testValue, Location: x.location})
+	}
+	return ret, nil
+}
+
+// EvaluateTest evaluates the test with identifier testid on the host system
+// and returns the results. Only the test, the tests it depends on, and the
+// objects they reference are evaluated. The document itself is not
+// modified.
+func (d *Document) EvaluateTest(testid string) (TestResult, error) {
+	nd, err := d.evaluateSubset(testid)
+	if err != nil {
+		return TestResult{}, err
+	}
+	return GetResults(&nd, testid)
+}
+
+// Evaluate the test with identifier testid in a copy of the document
+// containing only the test, the tests it depends on and the objects they
+// reference, returning the evaluated copy.
+func (d *Document) evaluateSubset(testid string) (Document, error) {
+	tests := make(map[string]bool)
+	objects := make(map[string]bool)
+	pending := []string{testid}
+	for len(pending) > 0 {
+		id := pending[0]
+		pending = pending[1:]
+		if tests[id] {
+			continue
+		}
+		t, err := d.GetTest(id)
+		if err != nil {
+			return Document{}, err
+		}
+		tests[id] = true
+		objects[t.Object] = true
+		pending = append(pending, t.If...)
+	}
+	nd, err := d.subset(objects, tests)
+	if err != nil {
+		return Document{}, err
+	}
+	pkgmgrReset()
+	err = nd.prepareObjects()
+	if err != nil {
+		return Document{}, err
+	}
+	err = nd.runTests(nil)
+	if err != nil {
+		return Document{}, err
+	}
+	return nd, nil
+}
+
+// Return a copy of the document that does not share any state with the
+// original, containing only the named objects and tests. All chain objects
+// are retained, as they may be imported by the named objects.
+func (d *Document) subset(objects map[string]bool, tests map[string]bool) (Document, error) {
+	var ret Document
+	buf, err := json.Marshal(d)
+	if err != nil {
+		return ret, err
+	}
+	err = json.Unmarshal(buf, &ret)
+	if err != nil {
+		return ret, err
+	}
+	for name := range objects {
+		if ret.objectPosition(name) == -1 {
+			return ret, fmt.Errorf("unknown object \"%v\"", name)
+		}
+	}
+	nobj := make([]Object, 0)
+	for _, x := range ret.Objects {
+		x.markChain()
+		if objects[x.Object] || x.isChain {
+			nobj = append(nobj, x)
+		}
+	}
+	ret.Objects = nobj
+	ntest := make([]Test, 0)
+	for _, x := range ret.Tests {
+		if tests[x.TestID] {
+			ntest = append(ntest, x)
+		}
+	}
+	ret.Tests = ntest
+	err = ret.Validate()
+	if err != nil {
+		return ret, err
+	}
+	return ret, nil
+}
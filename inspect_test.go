@@ -0,0 +1,137 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mozilla/scribe"
+)
+
+var inspectDoc = `
+{
+	"objects": [
+	{
+		"object": "versions",
+		"raw": {
+			"identifiers": [
+			{ "identifier": "libfoo", "value": "1.2.0" },
+			{ "identifier": "libbar", "value": "2.0.1" }
+			]
+		}
+	},
+
+	{
+		"object": "hasline",
+		"hasline": {
+			"path": "./test/hasline",
+			"file": "file0.txt",
+			"expression": ".*test.*"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "foo-version",
+		"object": "versions",
+		"evr": {
+			"operation": "<",
+			"value": "2.0.0"
+		}
+	},
+
+	{
+		"test": "dependent",
+		"object": "hasline",
+		"if": [ "foo-version" ]
+	}
+	]
+}
+`
+
+func TestEvaluateObject(t *testing.T) {
+	doc, err := scribe.LoadDocument(strings.NewReader(inspectDoc))
+	if err != nil {
+		t.Fatalf("scribe.LoadDocument: %v", err)
+	}
+	c, err := doc.EvaluateObject("versions")
+	if err != nil {
+		t.Fatalf("EvaluateObject: %v", err)
+	}
+	if len(c) != 2 || c[0].Identifier != "libfoo" || c[0].Value != "1.2.0" ||
+		c[1].Identifier != "libbar" || c[1].Value != "2.0.1" {
+		t.Fatalf("unexpected criteria %v", c)
+	}
+	_, err = doc.EvaluateObject("missing")
+	if err == nil {
+		t.Fatalf("EvaluateObject should fail for unknown object")
+	}
+
+	tr, err := doc.EvaluateTest("dependent")
+	if err != nil {
+		t.Fatalf("EvaluateTest: %v", err)
+	}
+	if !tr.MasterResult || tr.IsError || len(tr.Results) != 1 {
+		t.Fatalf("unexpected result for dependent test: %v", tr.String())
+	}
+	tr, err = doc.EvaluateTest("foo-version")
+	if err != nil {
+		t.Fatalf("EvaluateTest: %v", err)
+	}
+	if !tr.MasterResult || len(tr.Results) != 2 || tr.Results[1].Result {
+		t.Fatalf("unexpected result for foo-version: %v", tr.String())
+	}
+
+	// The document itself should not have been evaluated.
+	tr, err = scribe.GetResults(&doc, "foo-version")
+	if err != nil {
+		t.Fatalf("scribe.GetResults: %v", err)
+	}
+	if tr.MasterResult || len(tr.Results) != 0 {
+		t.Fatalf("document was modified by EvaluateTest")
+	}
+}
+
+func TestExplainTest(t *testing.T) {
+	doc, err := scribe.LoadDocument(strings.NewReader(inspectDoc))
+	if err != nil {
+		t.Fatalf("scribe.LoadDocument: %v", err)
+	}
+	e, err := doc.ExplainTest("dependent")
+	if err != nil {
+		t.Fatalf("ExplainTest: %v", err)
+	}
+	if e.Source != "hasline" || e.Evaluator != "none" || !e.MasterResult ||
+		len(e.Criteria) != 1 || e.Reason != "1 of 1 criteria were true" {
+		t.Fatalf("unexpected explanation %+v", e)
+	}
+	if len(e.Dependencies) != 1 {
+		t.Fatalf("dependency was not explained")
+	}
+	dep := e.Dependencies[0]
+	if dep.TestID != "foo-version" || dep.Source != "raw" || dep.Evaluator != "evr" {
+		t.Fatalf("unexpected dependency explanation %+v", dep)
+	}
+	if p, ok := dep.EvaluatorParameters.(scribe.EVRTest); !ok || p.Value != "2.0.0" {
+		t.Fatalf("unexpected evaluator parameters %v", dep.EvaluatorParameters)
+	}
+	if len(dep.Criteria) != 2 || !dep.Criteria[0].Result || dep.Criteria[1].Result ||
+		dep.Criteria[1].Identifier != "libbar" || dep.Criteria[1].Value != "2.0.1" ||
+		dep.Criteria[1].Reason != "version comparison < 2.0.0 is false" {
+		t.Fatalf("unexpected criteria %+v", dep.Criteria)
+	}
+	if dep.Reason != "1 of 2 criteria were true" {
+		t.Fatalf("unexpected reason %q", dep.Reason)
+	}
+	_, err = doc.ExplainTest("missing")
+	if err == nil {
+		t.Fatalf("ExplainTest should fail for unknown test")
+	}
+}
@@ -0,0 +1,162 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+// Package ber provides minimal support for the basic encoding rules (BER)
+// subset used by LDAP. Only single byte tags are supported.
+package ber
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// Universal tags.
+const (
+	Boolean     = 0x01
+	Integer     = 0x02
+	OctetString = 0x04
+	Enumerated  = 0x0a
+	Sequence    = 0x30
+	Set         = 0x31
+)
+
+// MaxLength is the maximum length of an element that will be read.
+const MaxLength = 16 * 1024 * 1024
+
+// Element is a decoded element.
+type Element struct {
+	Tag     byte
+	Content []byte
+}
+
+// Encode encodes an element with the given tag and content.
+func Encode(tag byte, content ...[]byte) []byte {
+	n := 0
+	for _, x := range content {
+		n += len(x)
+	}
+	ret := []byte{tag}
+	if n < 0x80 {
+		ret = append(ret, byte(n))
+	} else {
+		var l []byte
+		for v := n; v > 0; v >>= 8 {
+			l = append([]byte{byte(v)}, l...)
+		}
+		ret = append(ret, 0x80|byte(len(l)))
+		ret = append(ret, l...)
+	}
+	for _, x := range content {
+		ret = append(ret, x...)
+	}
+	return ret
+}
+
+// String encodes a string element.
+func String(tag byte, s string) []byte {
+	return Encode(tag, []byte(s))
+}
+
+// Int encodes an integer or enumerated element.
+func Int(tag byte, v int) []byte {
+	var b []byte
+	for {
+		b = append([]byte{byte(v)}, b...)
+		if v >= -0x80 && v < 0x80 {
+			break
+		}
+		v >>= 8
+	}
+	return Encode(tag, b)
+}
+
+// Bool encodes a boolean element.
+func Bool(v bool) []byte {
+	if v {
+		return Encode(Boolean, []byte{0xff})
+	}
+	return Encode(Boolean, []byte{0})
+}
+
+// Read reads a single element from r.
+func Read(r *bufio.Reader) (Element, error) {
+	var e Element
+	tag, err := r.ReadByte()
+	if err != nil {
+		return e, err
+	}
+	lb, err := r.ReadByte()
+	if err != nil {
+		return e, err
+	}
+	n := int(lb)
+	if lb&0x80 != 0 {
+		nb := int(lb & 0x7f)
+		if nb == 0 || nb > 4 {
+			return e, fmt.Errorf("unsupported ber length encoding")
+		}
+		n = 0
+		for i := 0; i < nb; i++ {
+			b, err := r.ReadByte()
+			if err != nil {
+				return e, err
+			}
+			n = n<<8 | int(b)
+		}
+	}
+	if n > MaxLength {
+		return e, fmt.Errorf("ber element of %v bytes too large", n)
+	}
+	e.Tag = tag
+	e.Content = make([]byte, n)
+	_, err = io.ReadFull(r, e.Content)
+	return e, err
+}
+
+// Elements decodes the elements contained in buf, for example the content of a
+// sequence.
+func Elements(buf []byte) ([]Element, error) {
+	ret := make([]Element, 0)
+	for len(buf) > 0 {
+		if len(buf) < 2 {
+			return nil, fmt.Errorf("truncated ber element")
+		}
+		tag := buf[0]
+		n := int(buf[1])
+		hdr := 2
+		if buf[1]&0x80 != 0 {
+			nb := int(buf[1] & 0x7f)
+			if nb == 0 || nb > 4 || len(buf) < 2+nb {
+				return nil, fmt.Errorf("invalid ber length")
+			}
+			n = 0
+			for _, b := range buf[2 : 2+nb] {
+				n = n<<8 | int(b)
+			}
+			hdr += nb
+		}
+		if n < 0 || len(buf) < hdr+n {
+			return nil, fmt.Errorf("truncated ber element")
+		}
+		ret = append(ret, Element{Tag: tag, Content: buf[hdr : hdr+n]})
+		buf = buf[hdr+n:]
+	}
+	return ret, nil
+}
+
+// Int decodes the content of an integer or enumerated element.
+func (e Element) Int() int {
+	v := 0
+	for i, b := range e.Content {
+		if i == 0 && b&0x80 != 0 {
+			v = -1
+		}
+		v = v<<8 | int(b)
+	}
+	return v
+}
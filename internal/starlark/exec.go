@@ -0,0 +1,1724 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package starlark
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Execution of scripts parsed by starParse().
+
+// Value is a script value, represented as nil (None), bool, int, string,
+// Tuple, *starList, *starDict, *starStruct, *starFunction or *starBuiltin.
+type Value interface{}
+
+// Tuple is a script tuple.
+type Tuple []Value
+
+type starList struct {
+	elems []Value
+}
+
+type starDict struct {
+	keys   []Value
+	values []Value
+	index  map[Value]int
+}
+
+// A read only value with named fields, such as a criteria.
+type starStruct struct {
+	name   string
+	fields map[string]Value
+}
+
+type starFunction struct {
+	def   *starDef
+	scope *starScope // The scope the function was defined in.
+}
+
+type starBuiltin struct {
+	name string
+	recv Value // The receiver, for methods.
+	fn   func(th *starThread, recv Value, args []Value, kwargs map[string]Value) (Value, error)
+}
+
+type starScope struct {
+	vars   map[string]Value
+	parent *starScope
+}
+
+// The state of a script execution.
+type starThread struct {
+	steps    int
+	maxSteps int
+	active   map[*starDef]bool // Functions being called, to reject recursion.
+}
+
+// Limits on script execution.
+const (
+	starMaxSteps = 1000000
+	starMaxSize  = 1 << 20 // The maximum length of strings and lists created by repetition or concatenation.
+)
+
+// Control flow outcomes of executing statements.
+const (
+	starNormal = iota
+	starReturned
+	starBroke
+	starContinued
+)
+
+func newStarThread() *starThread {
+	return &starThread{maxSteps: starMaxSteps, active: make(map[*starDef]bool)}
+}
+
+func newStarDict() *starDict {
+	return &starDict{index: make(map[Value]int)}
+}
+
+func (d *starDict) get(k Value) (Value, bool, error) {
+	if err := starHashable(k); err != nil {
+		return nil, false, err
+	}
+	i, ok := d.index[k]
+	if !ok {
+		return nil, false, nil
+	}
+	return d.values[i], true, nil
+}
+
+func (d *starDict) set(k Value, v Value) error {
+	if err := starHashable(k); err != nil {
+		return err
+	}
+	if i, ok := d.index[k]; ok {
+		d.values[i] = v
+		return nil
+	}
+	d.index[k] = len(d.keys)
+	d.keys = append(d.keys, k)
+	d.values = append(d.values, v)
+	return nil
+}
+
+func starHashable(v Value) error {
+	switch v.(type) {
+	case nil, bool, int, string:
+		return nil
+	}
+	return fmt.Errorf("unhashable type: %v", starType(v))
+}
+
+func (s *starScope) lookup(name string) (Value, bool) {
+	for x := s; x != nil; x = x.parent {
+		if v, ok := x.vars[name]; ok {
+			return v, true
+		}
+	}
+	v, ok := starBuiltins[name]
+	return v, ok
+}
+
+func (th *starThread) step() error {
+	th.steps++
+	if th.steps > th.maxSteps {
+		return fmt.Errorf("script exceeded %v execution steps", th.maxSteps)
+	}
+	return nil
+}
+
+// Execute statements in scope, returning the control flow outcome and the
+// value of a return statement.
+func (th *starThread) exec(stmts []starStmt, scope *starScope) (int, Value, error) {
+	for _, s := range stmts {
+		if err := th.step(); err != nil {
+			return 0, nil, err
+		}
+		switch x := s.(type) {
+		case *starDef:
+			scope.vars[x.name] = &starFunction{def: x, scope: scope}
+		case *starIf:
+			c, err := th.eval(x.cond, scope)
+			if err != nil {
+				return 0, nil, err
+			}
+			body := x.els
+			if starTruth(c) {
+				body = x.body
+			}
+			ctl, v, err := th.exec(body, scope)
+			if err != nil || ctl != starNormal {
+				return ctl, v, err
+			}
+		case *starFor:
+			it, err := th.eval(x.iter, scope)
+			if err != nil {
+				return 0, nil, err
+			}
+			elems, err := starIterate(it)
+			if err != nil {
+				return 0, nil, fmt.Errorf("line %v: %v", x.line, err)
+			}
+			for _, e := range elems {
+				err = th.assign(x.target, e, scope)
+				if err != nil {
+					return 0, nil, fmt.Errorf("line %v: %v", x.line, err)
+				}
+				ctl, v, err := th.exec(x.body, scope)
+				if err != nil || ctl == starReturned {
+					return ctl, v, err
+				}
+				if ctl == starBroke {
+					break
+				}
+			}
+		case *starReturn:
+			if x.value == nil {
+				return starReturned, nil, nil
+			}
+			v, err := th.eval(x.value, scope)
+			return starReturned, v, err
+		case *starBranch:
+			switch x.kind {
+			case "break":
+				return starBroke, nil, nil
+			case "continue":
+				return starContinued, nil, nil
+			}
+		case *starAssign:
+			v, err := th.eval(x.value, scope)
+			if err != nil {
+				return 0, nil, err
+			}
+			if x.op != "=" {
+				cur, err := th.eval(x.target, scope)
+				if err != nil {
+					return 0, nil, err
+				}
+				v, err = starBinaryOp(strings.TrimSuffix(x.op, "="), cur, v)
+				if err != nil {
+					return 0, nil, fmt.Errorf("line %v: %v", x.line, err)
+				}
+			}
+			err = th.assign(x.target, v, scope)
+			if err != nil {
+				return 0, nil, fmt.Errorf("line %v: %v", x.line, err)
+			}
+		case *starExprStmt:
+			_, err := th.eval(x.expr, scope)
+			if err != nil {
+				return 0, nil, err
+			}
+		}
+	}
+	return starNormal, nil, nil
+}
+
+func (th *starThread) assign(target starExpr, v Value, scope *starScope) error {
+	switch t := target.(type) {
+	case *starIdent:
+		scope.vars[t.name] = v
+		return nil
+	case *starIndexExpr:
+		x, err := th.eval(t.x, scope)
+		if err != nil {
+			return err
+		}
+		k, err := th.eval(t.index, scope)
+		if err != nil {
+			return err
+		}
+		switch c := x.(type) {
+		case *starList:
+			i, err := starIndex(k, len(c.elems))
+			if err != nil {
+				return err
+			}
+			c.elems[i] = v
+			return nil
+		case *starDict:
+			return c.set(k, v)
+		}
+		return fmt.Errorf("%v does not support item assignment", starType(x))
+	case *starTupleExpr:
+		return th.assignElems(t.elems, v, scope)
+	case *starListExpr:
+		return th.assignElems(t.elems, v, scope)
+	}
+	return fmt.Errorf("invalid assignment target")
+}
+
+func (th *starThread) assignElems(targets []starExpr, v Value, scope *starScope) error {
+	elems, err := starIterate(v)
+	if err != nil {
+		return err
+	}
+	if len(elems) != len(targets) {
+		return fmt.Errorf("can not unpack %v values into %v variables", len(elems), len(targets))
+	}
+	for i := range targets {
+		err = th.assign(targets[i], elems[i], scope)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (th *starThread) eval(e starExpr, scope *starScope) (Value, error) {
+	switch x := e.(type) {
+	case *starLiteral:
+		return x.value, nil
+	case *starIdent:
+		v, ok := scope.lookup(x.name)
+		if !ok {
+			return nil, fmt.Errorf("line %v: undefined: %v", x.line, x.name)
+		}
+		return v, nil
+	case *starListExpr:
+		elems, err := th.evalList(x.elems, scope)
+		if err != nil {
+			return nil, err
+		}
+		return &starList{elems: elems}, nil
+	case *starTupleExpr:
+		elems, err := th.evalList(x.elems, scope)
+		if err != nil {
+			return nil, err
+		}
+		return Tuple(elems), nil
+	case *starDictExpr:
+		ret := newStarDict()
+		for i := range x.keys {
+			k, err := th.eval(x.keys[i], scope)
+			if err != nil {
+				return nil, err
+			}
+			v, err := th.eval(x.values[i], scope)
+			if err != nil {
+				return nil, err
+			}
+			err = ret.set(k, v)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return ret, nil
+	case *starComprehension:
+		return th.comprehension(x, scope)
+	case *starCondExpr:
+		c, err := th.eval(x.cond, scope)
+		if err != nil {
+			return nil, err
+		}
+		if starTruth(c) {
+			return th.eval(x.yes, scope)
+		}
+		return th.eval(x.no, scope)
+	case *starUnary:
+		v, err := th.eval(x.operand, scope)
+		if err != nil {
+			return nil, err
+		}
+		if x.op == "not" {
+			return !starTruth(v), nil
+		}
+		n, ok := v.(int)
+		if !ok {
+			return nil, fmt.Errorf("line %v: unary %v not supported for %v", x.line, x.op, starType(v))
+		}
+		if x.op == "-" {
+			return -n, nil
+		}
+		return n, nil
+	case *starBinary:
+		l, err := th.eval(x.left, scope)
+		if err != nil {
+			return nil, err
+		}
+		switch x.op {
+		case "and":
+			if !starTruth(l) {
+				return l, nil
+			}
+			return th.eval(x.right, scope)
+		case "or":
+			if starTruth(l) {
+				return l, nil
+			}
+			return th.eval(x.right, scope)
+		}
+		r, err := th.eval(x.right, scope)
+		if err != nil {
+			return nil, err
+		}
+		v, err := starBinaryOp(x.op, l, r)
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %v", x.line, err)
+		}
+		return v, nil
+	case *starCall:
+		fn, err := th.eval(x.fn, scope)
+		if err != nil {
+			return nil, err
+		}
+		args, err := th.evalList(x.args, scope)
+		if err != nil {
+			return nil, err
+		}
+		kwargs := make(map[string]Value)
+		for _, y := range x.kwargs {
+			v, err := th.eval(y.value, scope)
+			if err != nil {
+				return nil, err
+			}
+			kwargs[y.name] = v
+		}
+		v, err := th.call(fn, args, kwargs)
+		if err != nil && !strings.HasPrefix(err.Error(), "line ") {
+			err = fmt.Errorf("line %v: %v", x.line, err)
+		}
+		return v, err
+	case *starIndexExpr:
+		v, err := th.eval(x.x, scope)
+		if err != nil {
+			return nil, err
+		}
+		k, err := th.eval(x.index, scope)
+		if err != nil {
+			return nil, err
+		}
+		r, err := starGetIndex(v, k)
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %v", x.line, err)
+		}
+		return r, nil
+	case *starSliceExpr:
+		v, err := th.eval(x.x, scope)
+		if err != nil {
+			return nil, err
+		}
+		var lo, hi Value
+		if x.lo != nil {
+			if lo, err = th.eval(x.lo, scope); err != nil {
+				return nil, err
+			}
+		}
+		if x.hi != nil {
+			if hi, err = th.eval(x.hi, scope); err != nil {
+				return nil, err
+			}
+		}
+		r, err := starSlice(v, lo, hi)
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %v", x.line, err)
+		}
+		return r, nil
+	case *starDot:
+		v, err := th.eval(x.x, scope)
+		if err != nil {
+			return nil, err
+		}
+		r, err := starAttr(v, x.name)
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %v", x.line, err)
+		}
+		return r, nil
+	}
+	return nil, fmt.Errorf("unsupported expression")
+}
+
+func (th *starThread) evalList(exprs []starExpr, scope *starScope) ([]Value, error) {
+	ret := make([]Value, 0, len(exprs))
+	for _, x := range exprs {
+		v, err := th.eval(x, scope)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, v)
+	}
+	return ret, nil
+}
+
+// Evaluate a comprehension. The loop variables are local to the
+// comprehension.
+func (th *starThread) comprehension(c *starComprehension, scope *starScope) (Value, error) {
+	list := &starList{}
+	dict := newStarDict()
+	inner := &starScope{vars: make(map[string]Value), parent: scope}
+	var run func(i int) error
+	run = func(i int) error {
+		if err := th.step(); err != nil {
+			return err
+		}
+		if i == len(c.clauses) {
+			k, err := th.eval(c.key, inner)
+			if err != nil {
+				return err
+			}
+			if !c.dict {
+				list.elems = append(list.elems, k)
+				return nil
+			}
+			v, err := th.eval(c.value, inner)
+			if err != nil {
+				return err
+			}
+			return dict.set(k, v)
+		}
+		cl := c.clauses[i]
+		if cl.target == nil {
+			v, err := th.eval(cl.expr, inner)
+			if err != nil {
+				return err
+			}
+			if !starTruth(v) {
+				return nil
+			}
+			return run(i + 1)
+		}
+		it, err := th.eval(cl.expr, inner)
+		if err != nil {
+			return err
+		}
+		elems, err := starIterate(it)
+		if err != nil {
+			return err
+		}
+		for _, e := range elems {
+			err = th.assign(cl.target, e, inner)
+			if err != nil {
+				return err
+			}
+			err = run(i + 1)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	err := run(0)
+	if err != nil {
+		return nil, err
+	}
+	if c.dict {
+		return dict, nil
+	}
+	return list, nil
+}
+
+func (th *starThread) call(fn Value, args []Value, kwargs map[string]Value) (Value, error) {
+	if err := th.step(); err != nil {
+		return nil, err
+	}
+	switch f := fn.(type) {
+	case *starBuiltin:
+		return f.fn(th, f.recv, args, kwargs)
+	case *starFunction:
+		if th.active[f.def] {
+			return nil, fmt.Errorf("function %v called recursively", f.def.name)
+		}
+		if len(kwargs) > 0 {
+			return nil, fmt.Errorf("function %v does not accept keyword arguments", f.def.name)
+		}
+		if len(args) != len(f.def.params) {
+			return nil, fmt.Errorf("function %v takes %v arguments, %v given", f.def.name, len(f.def.params), len(args))
+		}
+		local := &starScope{vars: make(map[string]Value), parent: f.scope}
+		for i, x := range f.def.params {
+			local.vars[x] = args[i]
+		}
+		th.active[f.def] = true
+		defer delete(th.active, f.def)
+		_, v, err := th.exec(f.def.body, local)
+		return v, err
+	}
+	return nil, fmt.Errorf("%v is not callable", starType(fn))
+}
+
+func starType(v Value) string {
+	switch x := v.(type) {
+	case nil:
+		return "NoneType"
+	case bool:
+		return "bool"
+	case int:
+		return "int"
+	case string:
+		return "string"
+	case Tuple:
+		return "tuple"
+	case *starList:
+		return "list"
+	case *starDict:
+		return "dict"
+	case *starStruct:
+		return x.name
+	case *starFunction:
+		return "function"
+	case *starBuiltin:
+		return "builtin_function_or_method"
+	}
+	return "unknown"
+}
+
+func starTruth(v Value) bool {
+	switch x := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return x
+	case int:
+		return x != 0
+	case string:
+		return x != ""
+	case Tuple:
+		return len(x) > 0
+	case *starList:
+		return len(x.elems) > 0
+	case *starDict:
+		return len(x.keys) > 0
+	}
+	return true
+}
+
+// Return the elements of an iterable value. Strings are not iterable, as in
+// Starlark.
+func starIterate(v Value) ([]Value, error) {
+	switch x := v.(type) {
+	case Tuple:
+		return x, nil
+	case *starList:
+		// Iterate over a copy, so the loop is not affected by changes
+		// to the list.
+		return append([]Value(nil), x.elems...), nil
+	case *starDict:
+		return append([]Value(nil), x.keys...), nil
+	}
+	return nil, fmt.Errorf("%v is not iterable", starType(v))
+}
+
+func starIndex(k Value, n int) (int, error) {
+	i, ok := k.(int)
+	if !ok {
+		return 0, fmt.Errorf("index must be int, not %v", starType(k))
+	}
+	if i < 0 {
+		i += n
+	}
+	if i < 0 || i >= n {
+		return 0, fmt.Errorf("index %v out of range", k)
+	}
+	return i, nil
+}
+
+func starGetIndex(v Value, k Value) (Value, error) {
+	switch x := v.(type) {
+	case string:
+		i, err := starIndex(k, len(x))
+		if err != nil {
+			return nil, err
+		}
+		return x[i : i+1], nil
+	case Tuple:
+		i, err := starIndex(k, len(x))
+		if err != nil {
+			return nil, err
+		}
+		return x[i], nil
+	case *starList:
+		i, err := starIndex(k, len(x.elems))
+		if err != nil {
+			return nil, err
+		}
+		return x.elems[i], nil
+	case *starDict:
+		r, ok, err := x.get(k)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("key %v not in dict", starRepr(k))
+		}
+		return r, nil
+	}
+	return nil, fmt.Errorf("%v is not indexable", starType(v))
+}
+
+func starSlice(v Value, lo Value, hi Value) (Value, error) {
+	n := 0
+	switch x := v.(type) {
+	case string:
+		n = len(x)
+	case Tuple:
+		n = len(x)
+	case *starList:
+		n = len(x.elems)
+	default:
+		return nil, fmt.Errorf("%v can not be sliced", starType(v))
+	}
+	bound := func(b Value, def int) (int, error) {
+		if b == nil {
+			return def, nil
+		}
+		i, ok := b.(int)
+		if !ok {
+			return 0, fmt.Errorf("slice index must be int, not %v", starType(b))
+		}
+		if i < 0 {
+			i += n
+		}
+		if i < 0 {
+			i = 0
+		}
+		if i > n {
+			i = n
+		}
+		return i, nil
+	}
+	i, err := bound(lo, 0)
+	if err != nil {
+		return nil, err
+	}
+	j, err := bound(hi, n)
+	if err != nil {
+		return nil, err
+	}
+	if j < i {
+		j = i
+	}
+	switch x := v.(type) {
+	case string:
+		return x[i:j], nil
+	case Tuple:
+		return append(Tuple(nil), x[i:j]...), nil
+	}
+	return &starList{elems: append([]Value(nil), v.(*starList).elems[i:j]...)}, nil
+}
+
+func starEqual(a Value, b Value) bool {
+	switch x := a.(type) {
+	case Tuple:
+		y, ok := b.(Tuple)
+		return ok && starElemsEqual(x, y)
+	case *starList:
+		y, ok := b.(*starList)
+		return ok && starElemsEqual(x.elems, y.elems)
+	case *starDict:
+		y, ok := b.(*starDict)
+		if !ok || len(x.keys) != len(y.keys) {
+			return false
+		}
+		for i, k := range x.keys {
+			v, found, _ := y.get(k)
+			if !found || !starEqual(x.values[i], v) {
+				return false
+			}
+		}
+		return true
+	case *starStruct:
+		return a == b
+	}
+	switch b.(type) {
+	case Tuple, *starList, *starDict, *starStruct:
+		return false
+	}
+	return a == b
+}
+
+func starElemsEqual(a []Value, b []Value) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !starEqual(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Compare two values of the same type for ordering.
+func starCompare(a Value, b Value) (int, error) {
+	switch x := a.(type) {
+	case int:
+		if y, ok := b.(int); ok {
+			switch {
+			case x < y:
+				return -1, nil
+			case x > y:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), nil
+		}
+	case bool:
+		if y, ok := b.(bool); ok {
+			switch {
+			case x == y:
+				return 0, nil
+			case !x:
+				return -1, nil
+			}
+			return 1, nil
+		}
+	case Tuple:
+		if y, ok := b.(Tuple); ok {
+			return starCompareElems(x, y)
+		}
+	case *starList:
+		if y, ok := b.(*starList); ok {
+			return starCompareElems(x.elems, y.elems)
+		}
+	}
+	return 0, fmt.Errorf("can not compare %v and %v", starType(a), starType(b))
+}
+
+func starCompareElems(a []Value, b []Value) (int, error) {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		c, err := starCompare(a[i], b[i])
+		if err != nil || c != 0 {
+			return c, err
+		}
+	}
+	return starCompare(len(a), len(b))
+}
+
+func starBinaryOp(op string, l Value, r Value) (Value, error) {
+	switch op {
+	case "==":
+		return starEqual(l, r), nil
+	case "!=":
+		return !starEqual(l, r), nil
+	case "<", "<=", ">", ">=":
+		c, err := starCompare(l, r)
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		}
+		return c >= 0, nil
+	case "in", "not in":
+		found, err := starContains(r, l)
+		if err != nil {
+			return nil, err
+		}
+		return found == (op == "in"), nil
+	}
+	switch x := l.(type) {
+	case int:
+		if y, ok := r.(int); ok {
+			switch op {
+			case "+":
+				return x + y, nil
+			case "-":
+				return x - y, nil
+			case "*":
+				return x * y, nil
+			case "//", "%":
+				if y == 0 {
+					return nil, fmt.Errorf("division by zero")
+				}
+				// Division rounds towards negative infinity, as in
+				// Starlark.
+				q, m := x/y, x%y
+				if m != 0 && (m < 0) != (y < 0) {
+					q--
+					m += y
+				}
+				if op == "//" {
+					return q, nil
+				}
+				return m, nil
+			case "/":
+				return nil, fmt.Errorf("floating point division is not supported, use //")
+			}
+		}
+		if op == "*" {
+			return starBinaryOp(op, r, l)
+		}
+	case string:
+		switch op {
+		case "+":
+			if y, ok := r.(string); ok {
+				if len(x)+len(y) > starMaxSize {
+					return nil, fmt.Errorf("string concatenation is too large")
+				}
+				return x + y, nil
+			}
+		case "*":
+			if n, ok := r.(int); ok {
+				// Compared by division, as the length of the result can
+				// overflow.
+				if n > 0 && len(x) > 0 && n > starMaxSize/len(x) {
+					return nil, fmt.Errorf("string repetition is too large")
+				}
+				if n < 0 {
+					n = 0
+				}
+				return strings.Repeat(x, n), nil
+			}
+		case "%":
+			return starFormat(x, r)
+		}
+	case Tuple:
+		switch op {
+		case "+":
+			if y, ok := r.(Tuple); ok {
+				if len(x)+len(y) > starMaxSize {
+					return nil, fmt.Errorf("concatenation is too large")
+				}
+				return append(append(Tuple(nil), x...), y...), nil
+			}
+		case "*":
+			if n, ok := r.(int); ok {
+				elems, err := starRepeat(x, n)
+				return Tuple(elems), err
+			}
+		}
+	case *starList:
+		switch op {
+		case "+":
+			if y, ok := r.(*starList); ok {
+				if len(x.elems)+len(y.elems) > starMaxSize {
+					return nil, fmt.Errorf("concatenation is too large")
+				}
+				return &starList{elems: append(append([]Value(nil), x.elems...), y.elems...)}, nil
+			}
+		case "*":
+			if n, ok := r.(int); ok {
+				elems, err := starRepeat(x.elems, n)
+				return &starList{elems: elems}, err
+			}
+		}
+	}
+	return nil, fmt.Errorf("unsupported operation %v %v %v", starType(l), op, starType(r))
+}
+
+func starRepeat(elems []Value, n int) ([]Value, error) {
+	if n > 0 && len(elems) > 0 && n > starMaxSize/len(elems) {
+		return nil, fmt.Errorf("repetition is too large")
+	}
+	ret := make([]Value, 0)
+	if len(elems) == 0 {
+		return ret, nil
+	}
+	for i := 0; i < n; i++ {
+		ret = append(ret, elems...)
+	}
+	return ret, nil
+}
+
+func starContains(container Value, v Value) (bool, error) {
+	switch x := container.(type) {
+	case string:
+		s, ok := v.(string)
+		if !ok {
+			return false, fmt.Errorf("'in <string>' requires string, not %v", starType(v))
+		}
+		return strings.Contains(x, s), nil
+	case Tuple, *starList:
+		elems, _ := starIterate(x)
+		for _, y := range elems {
+			if starEqual(y, v) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case *starDict:
+		_, ok, err := x.get(v)
+		return ok, err
+	}
+	return false, fmt.Errorf("'in' not supported for %v", starType(container))
+}
+
+// Apply a format string using %s, %d, %r and %%.
+func starFormat(f string, arg Value) (Value, error) {
+	args := []Value{arg}
+	if t, ok := arg.(Tuple); ok {
+		args = t
+	}
+	var b strings.Builder
+	n := 0
+	for i := 0; i < len(f); i++ {
+		if f[i] != '%' {
+			b.WriteByte(f[i])
+			continue
+		}
+		i++
+		if i >= len(f) {
+			return nil, fmt.Errorf("incomplete format")
+		}
+		if f[i] == '%' {
+			b.WriteByte('%')
+			continue
+		}
+		if n >= len(args) {
+			return nil, fmt.Errorf("not enough arguments for format string")
+		}
+		switch f[i] {
+		case 's':
+			b.WriteString(starStr(args[n]))
+		case 'r':
+			b.WriteString(starRepr(args[n]))
+		case 'd':
+			v, ok := args[n].(int)
+			if !ok {
+				return nil, fmt.Errorf("%%d format requires int, not %v", starType(args[n]))
+			}
+			b.WriteString(strconv.Itoa(v))
+		default:
+			return nil, fmt.Errorf("unsupported format %%%c", f[i])
+		}
+		n++
+	}
+	if n != len(args) {
+		return nil, fmt.Errorf("too many arguments for format string")
+	}
+	return b.String(), nil
+}
+
+// Return the string form of a value, as used by str().
+func starStr(v Value) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return starRepr(v)
+}
+
+func starRepr(v Value) string {
+	switch x := v.(type) {
+	case nil:
+		return "None"
+	case bool:
+		if x {
+			return "True"
+		}
+		return "False"
+	case int:
+		return strconv.Itoa(x)
+	case string:
+		return strconv.Quote(x)
+	case Tuple:
+		if len(x) == 1 {
+			return "(" + starRepr(x[0]) + ",)"
+		}
+		return "(" + starReprElems(x) + ")"
+	case *starList:
+		return "[" + starReprElems(x.elems) + "]"
+	case *starDict:
+		s := make([]string, 0, len(x.keys))
+		for i := range x.keys {
+			s = append(s, starRepr(x.keys[i])+": "+starRepr(x.values[i]))
+		}
+		return "{" + strings.Join(s, ", ") + "}"
+	case *starStruct:
+		names := make([]string, 0, len(x.fields))
+		for k := range x.fields {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		s := make([]string, 0, len(names))
+		for _, k := range names {
+			s = append(s, k+" = "+starRepr(x.fields[k]))
+		}
+		return x.name + "(" + strings.Join(s, ", ") + ")"
+	case *starFunction:
+		return "<function " + x.def.name + ">"
+	case *starBuiltin:
+		return "<built-in function " + x.name + ">"
+	}
+	return "?"
+}
+
+func starReprElems(elems []Value) string {
+	s := make([]string, 0, len(elems))
+	for _, x := range elems {
+		s = append(s, starRepr(x))
+	}
+	return strings.Join(s, ", ")
+}
+
+// Return the attribute name of v, a struct field or a method.
+func starAttr(v Value, name string) (Value, error) {
+	if s, ok := v.(*starStruct); ok {
+		if f, ok := s.fields[name]; ok {
+			return f, nil
+		}
+		return nil, fmt.Errorf("%v has no field %v", s.name, name)
+	}
+	var methods map[string]starMethod
+	switch v.(type) {
+	case string:
+		methods = starStringMethods
+	case *starList:
+		methods = starListMethods
+	case *starDict:
+		methods = starDictMethods
+	}
+	m, ok := methods[name]
+	if !ok {
+		return nil, fmt.Errorf("%v has no attribute %v", starType(v), name)
+	}
+	return &starBuiltin{name: name, recv: v, fn: m}, nil
+}
+
+type starMethod func(th *starThread, recv Value, args []Value, kwargs map[string]Value) (Value, error)
+
+// Check the number of positional arguments is between min and max, and
+// that there are no keyword arguments.
+func starArgs(name string, args []Value, kwargs map[string]Value, min int, max int) error {
+	if len(kwargs) > 0 {
+		return fmt.Errorf("%v does not accept keyword arguments", name)
+	}
+	if len(args) < min || len(args) > max {
+		if min == max {
+			return fmt.Errorf("%v takes %v arguments, %v given", name, min, len(args))
+		}
+		return fmt.Errorf("%v takes %v to %v arguments, %v given", name, min, max, len(args))
+	}
+	return nil
+}
+
+func starStringArg(name string, v Value) (string, error) {
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%v requires string, not %v", name, starType(v))
+	}
+	return s, nil
+}
+
+func starStringList(elems []string) *starList {
+	ret := &starList{elems: make([]Value, 0, len(elems))}
+	for _, x := range elems {
+		ret.elems = append(ret.elems, x)
+	}
+	return ret
+}
+
+// String methods with a single string argument returning a bool.
+func starStringPredicate(name string, f func(string, string) bool) starMethod {
+	return func(th *starThread, recv Value, args []Value, kwargs map[string]Value) (Value, error) {
+		if err := starArgs(name, args, kwargs, 1, 1); err != nil {
+			return nil, err
+		}
+		s, err := starStringArg(name, args[0])
+		if err != nil {
+			return nil, err
+		}
+		return f(recv.(string), s), nil
+	}
+}
+
+// String methods without arguments returning a string.
+func starStringTransform(name string, f func(string) string) starMethod {
+	return func(th *starThread, recv Value, args []Value, kwargs map[string]Value) (Value, error) {
+		if err := starArgs(name, args, kwargs, 0, 0); err != nil {
+			return nil, err
+		}
+		return f(recv.(string)), nil
+	}
+}
+
+// String strip methods, with an optional argument listing the characters
+// to remove.
+func starStringStrip(name string, f func(string, string) string) starMethod {
+	return func(th *starThread, recv Value, args []Value, kwargs map[string]Value) (Value, error) {
+		if err := starArgs(name, args, kwargs, 0, 1); err != nil {
+			return nil, err
+		}
+		cutset := " \t\n\r\v\f"
+		if len(args) == 1 && args[0] != nil {
+			s, err := starStringArg(name, args[0])
+			if err != nil {
+				return nil, err
+			}
+			cutset = s
+		}
+		return f(recv.(string), cutset), nil
+	}
+}
+
+var starStringMethods map[string]starMethod
+
+var starListMethods = map[string]starMethod{
+	"append": func(th *starThread, recv Value, args []Value, kwargs map[string]Value) (Value, error) {
+		if err := starArgs("append", args, kwargs, 1, 1); err != nil {
+			return nil, err
+		}
+		l := recv.(*starList)
+		if len(l.elems) >= starMaxSize {
+			return nil, fmt.Errorf("list is too large")
+		}
+		l.elems = append(l.elems, args[0])
+		return nil, nil
+	},
+	"extend": func(th *starThread, recv Value, args []Value, kwargs map[string]Value) (Value, error) {
+		if err := starArgs("extend", args, kwargs, 1, 1); err != nil {
+			return nil, err
+		}
+		elems, err := starIterate(args[0])
+		if err != nil {
+			return nil, err
+		}
+		l := recv.(*starList)
+		if len(l.elems)+len(elems) > starMaxSize {
+			return nil, fmt.Errorf("list is too large")
+		}
+		l.elems = append(l.elems, elems...)
+		return nil, nil
+	},
+	"index": func(th *starThread, recv Value, args []Value, kwargs map[string]Value) (Value, error) {
+		if err := starArgs("index", args, kwargs, 1, 1); err != nil {
+			return nil, err
+		}
+		for i, x := range recv.(*starList).elems {
+			if starEqual(x, args[0]) {
+				return i, nil
+			}
+		}
+		return nil, fmt.Errorf("value %v not in list", starRepr(args[0]))
+	},
+}
+
+var starDictMethods = map[string]starMethod{
+	"get": func(th *starThread, recv Value, args []Value, kwargs map[string]Value) (Value, error) {
+		if err := starArgs("get", args, kwargs, 1, 2); err != nil {
+			return nil, err
+		}
+		v, ok, err := recv.(*starDict).get(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if !ok && len(args) == 2 {
+			return args[1], nil
+		}
+		return v, nil
+	},
+	"keys": func(th *starThread, recv Value, args []Value, kwargs map[string]Value) (Value, error) {
+		if err := starArgs("keys", args, kwargs, 0, 0); err != nil {
+			return nil, err
+		}
+		return &starList{elems: append([]Value(nil), recv.(*starDict).keys...)}, nil
+	},
+	"values": func(th *starThread, recv Value, args []Value, kwargs map[string]Value) (Value, error) {
+		if err := starArgs("values", args, kwargs, 0, 0); err != nil {
+			return nil, err
+		}
+		return &starList{elems: append([]Value(nil), recv.(*starDict).values...)}, nil
+	},
+	"items": func(th *starThread, recv Value, args []Value, kwargs map[string]Value) (Value, error) {
+		if err := starArgs("items", args, kwargs, 0, 0); err != nil {
+			return nil, err
+		}
+		d := recv.(*starDict)
+		ret := &starList{}
+		for i := range d.keys {
+			ret.elems = append(ret.elems, Tuple{d.keys[i], d.values[i]})
+		}
+		return ret, nil
+	},
+}
+
+var starBuiltins map[string]Value
+
+func init() {
+	starStringMethods = map[string]starMethod{
+		"startswith": starStringPredicate("startswith", strings.HasPrefix),
+		"endswith":   starStringPredicate("endswith", strings.HasSuffix),
+		"lower":      starStringTransform("lower", strings.ToLower),
+		"upper":      starStringTransform("upper", strings.ToUpper),
+		"strip":      starStringStrip("strip", strings.Trim),
+		"lstrip":     starStringStrip("lstrip", strings.TrimLeft),
+		"rstrip":     starStringStrip("rstrip", strings.TrimRight),
+		"isdigit": starStringTransformBool("isdigit", func(s string) bool {
+			if s == "" {
+				return false
+			}
+			for _, c := range s {
+				if c < '0' || c > '9' {
+					return false
+				}
+			}
+			return true
+		}),
+		"split":      starStringSplit,
+		"splitlines": starStringSplitlines,
+		"join":       starStringJoin,
+		"replace":    starStringReplace,
+		"find":       starStringFind,
+		"count": func(th *starThread, recv Value, args []Value, kwargs map[string]Value) (Value, error) {
+			if err := starArgs("count", args, kwargs, 1, 1); err != nil {
+				return nil, err
+			}
+			s, err := starStringArg("count", args[0])
+			if err != nil {
+				return nil, err
+			}
+			return strings.Count(recv.(string), s), nil
+		},
+	}
+
+	starBuiltins = make(map[string]Value)
+	for name, fn := range map[string]starMethod{
+		"len":       starBuiltinLen,
+		"str":       starBuiltinStr,
+		"int":       starBuiltinInt,
+		"bool":      starBuiltinBool,
+		"list":      starBuiltinList,
+		"tuple":     starBuiltinTuple,
+		"dict":      starBuiltinDict,
+		"sorted":    starBuiltinSorted,
+		"range":     starBuiltinRange,
+		"min":       starBuiltinMinMax("min", -1),
+		"max":       starBuiltinMinMax("max", 1),
+		"any":       starBuiltinAnyAll("any", true),
+		"all":       starBuiltinAnyAll("all", false),
+		"enumerate": starBuiltinEnumerate,
+		"type":      starBuiltinType,
+		"repr":      starBuiltinRepr,
+		"fail":      starBuiltinFail,
+	} {
+		starBuiltins[name] = &starBuiltin{name: name, fn: fn}
+	}
+}
+
+func starStringTransformBool(name string, f func(string) bool) starMethod {
+	return func(th *starThread, recv Value, args []Value, kwargs map[string]Value) (Value, error) {
+		if err := starArgs(name, args, kwargs, 0, 0); err != nil {
+			return nil, err
+		}
+		return f(recv.(string)), nil
+	}
+}
+
+func starStringSplit(th *starThread, recv Value, args []Value, kwargs map[string]Value) (Value, error) {
+	if err := starArgs("split", args, kwargs, 0, 2); err != nil {
+		return nil, err
+	}
+	s := recv.(string)
+	max := -1
+	if len(args) == 2 {
+		n, ok := args[1].(int)
+		if !ok {
+			return nil, fmt.Errorf("split maxsplit must be int")
+		}
+		max = n
+	}
+	if len(args) == 0 || args[0] == nil {
+		if max < 0 {
+			return starStringList(strings.Fields(s)), nil
+		}
+		// Split on runs of white space at most max times.
+		ret := make([]string, 0)
+		rest := strings.TrimLeft(s, " \t\n\r\v\f")
+		for len(ret) < max && rest != "" {
+			i := strings.IndexAny(rest, " \t\n\r\v\f")
+			if i == -1 {
+				break
+			}
+			ret = append(ret, rest[:i])
+			rest = strings.TrimLeft(rest[i:], " \t\n\r\v\f")
+		}
+		if rest != "" {
+			ret = append(ret, rest)
+		}
+		return starStringList(ret), nil
+	}
+	sep, err := starStringArg("split", args[0])
+	if err != nil {
+		return nil, err
+	}
+	if sep == "" {
+		return nil, fmt.Errorf("split separator is empty")
+	}
+	n := -1
+	if max >= 0 {
+		n = max + 1
+	}
+	return starStringList(strings.SplitN(s, sep, n)), nil
+}
+
+func starStringSplitlines(th *starThread, recv Value, args []Value, kwargs map[string]Value) (Value, error) {
+	if err := starArgs("splitlines", args, kwargs, 0, 0); err != nil {
+		return nil, err
+	}
+	s := strings.Replace(recv.(string), "\r\n", "\n", -1)
+	s = strings.TrimSuffix(s, "\n")
+	if s == "" {
+		return &starList{}, nil
+	}
+	return starStringList(strings.Split(s, "\n")), nil
+}
+
+func starStringJoin(th *starThread, recv Value, args []Value, kwargs map[string]Value) (Value, error) {
+	if err := starArgs("join", args, kwargs, 1, 1); err != nil {
+		return nil, err
+	}
+	elems, err := starIterate(args[0])
+	if err != nil {
+		return nil, err
+	}
+	sep := recv.(string)
+	s := make([]string, 0, len(elems))
+	size := 0
+	for _, x := range elems {
+		v, err := starStringArg("join", x)
+		if err != nil {
+			return nil, err
+		}
+		size += len(v) + len(sep)
+		if size > starMaxSize+len(sep) {
+			return nil, fmt.Errorf("string is too large")
+		}
+		s = append(s, v)
+	}
+	return strings.Join(s, sep), nil
+}
+
+func starStringReplace(th *starThread, recv Value, args []Value, kwargs map[string]Value) (Value, error) {
+	if err := starArgs("replace", args, kwargs, 2, 2); err != nil {
+		return nil, err
+	}
+	old, err := starStringArg("replace", args[0])
+	if err != nil {
+		return nil, err
+	}
+	nw, err := starStringArg("replace", args[1])
+	if err != nil {
+		return nil, err
+	}
+	s := recv.(string)
+	// Checked before replacing, as the result can be far larger than the
+	// string.
+	if grow := len(nw) - len(old); grow > 0 {
+		if n := strings.Count(s, old); n > 0 && (len(s) > starMaxSize || grow > (starMaxSize-len(s))/n) {
+			return nil, fmt.Errorf("string is too large")
+		}
+	}
+	return strings.Replace(s, old, nw, -1), nil
+}
+
+func starStringFind(th *starThread, recv Value, args []Value, kwargs map[string]Value) (Value, error) {
+	if err := starArgs("find", args, kwargs, 1, 1); err != nil {
+		return nil, err
+	}
+	s, err := starStringArg("find", args[0])
+	if err != nil {
+		return nil, err
+	}
+	return strings.Index(recv.(string), s), nil
+}
+
+func starBuiltinLen(th *starThread, recv Value, args []Value, kwargs map[string]Value) (Value, error) {
+	if err := starArgs("len", args, kwargs, 1, 1); err != nil {
+		return nil, err
+	}
+	switch x := args[0].(type) {
+	case string:
+		return len(x), nil
+	case Tuple:
+		return len(x), nil
+	case *starList:
+		return len(x.elems), nil
+	case *starDict:
+		return len(x.keys), nil
+	}
+	return nil, fmt.Errorf("len not supported for %v", starType(args[0]))
+}
+
+func starBuiltinStr(th *starThread, recv Value, args []Value, kwargs map[string]Value) (Value, error) {
+	if err := starArgs("str", args, kwargs, 1, 1); err != nil {
+		return nil, err
+	}
+	return starStr(args[0]), nil
+}
+
+func starBuiltinRepr(th *starThread, recv Value, args []Value, kwargs map[string]Value) (Value, error) {
+	if err := starArgs("repr", args, kwargs, 1, 1); err != nil {
+		return nil, err
+	}
+	return starRepr(args[0]), nil
+}
+
+func starBuiltinType(th *starThread, recv Value, args []Value, kwargs map[string]Value) (Value, error) {
+	if err := starArgs("type", args, kwargs, 1, 1); err != nil {
+		return nil, err
+	}
+	return starType(args[0]), nil
+}
+
+func starBuiltinInt(th *starThread, recv Value, args []Value, kwargs map[string]Value) (Value, error) {
+	if err := starArgs("int", args, kwargs, 1, 2); err != nil {
+		return nil, err
+	}
+	switch x := args[0].(type) {
+	case int:
+		return x, nil
+	case bool:
+		if x {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		base := 10
+		if len(args) == 2 {
+			b, ok := args[1].(int)
+			if !ok {
+				return nil, fmt.Errorf("int base must be int")
+			}
+			base = b
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(x), base, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid literal for int(): %v", starRepr(x))
+		}
+		return int(n), nil
+	}
+	return nil, fmt.Errorf("int not supported for %v", starType(args[0]))
+}
+
+func starBuiltinBool(th *starThread, recv Value, args []Value, kwargs map[string]Value) (Value, error) {
+	if err := starArgs("bool", args, kwargs, 0, 1); err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return false, nil
+	}
+	return starTruth(args[0]), nil
+}
+
+func starBuiltinList(th *starThread, recv Value, args []Value, kwargs map[string]Value) (Value, error) {
+	if err := starArgs("list", args, kwargs, 0, 1); err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return &starList{}, nil
+	}
+	elems, err := starIterate(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return &starList{elems: elems}, nil
+}
+
+func starBuiltinTuple(th *starThread, recv Value, args []Value, kwargs map[string]Value) (Value, error) {
+	if err := starArgs("tuple", args, kwargs, 0, 1); err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return Tuple{}, nil
+	}
+	elems, err := starIterate(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return Tuple(elems), nil
+}
+
+func starBuiltinDict(th *starThread, recv Value, args []Value, kwargs map[string]Value) (Value, error) {
+	if len(args) > 1 {
+		return nil, fmt.Errorf("dict takes at most 1 argument, %v given", len(args))
+	}
+	ret := newStarDict()
+	if len(args) == 1 {
+		elems, err := starIterate(args[0])
+		if err != nil {
+			return nil, err
+		}
+		for _, x := range elems {
+			pair, err := starIterate(x)
+			if err != nil || len(pair) != 2 {
+				return nil, fmt.Errorf("dict requires a sequence of pairs")
+			}
+			err = ret.set(pair[0], pair[1])
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	names := make([]string, 0, len(kwargs))
+	for k := range kwargs {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		ret.set(k, kwargs[k])
+	}
+	return ret, nil
+}
+
+func starBuiltinSorted(th *starThread, recv Value, args []Value, kwargs map[string]Value) (Value, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("sorted takes 1 argument, %v given", len(args))
+	}
+	reverse := false
+	var key Value
+	for k, v := range kwargs {
+		switch k {
+		case "reverse":
+			reverse = starTruth(v)
+		case "key":
+			key = v
+		default:
+			return nil, fmt.Errorf("sorted got unexpected keyword argument %v", k)
+		}
+	}
+	elems, err := starIterate(args[0])
+	if err != nil {
+		return nil, err
+	}
+	keys := elems
+	if key != nil {
+		keys = make([]Value, len(elems))
+		for i, x := range elems {
+			keys[i], err = th.call(key, []Value{x}, nil)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	idx := make([]int, len(elems))
+	for i := range idx {
+		idx[i] = i
+	}
+	var cmpErr error
+	sort.SliceStable(idx, func(i, j int) bool {
+		c, err := starCompare(keys[idx[i]], keys[idx[j]])
+		if err != nil && cmpErr == nil {
+			cmpErr = err
+		}
+		if reverse {
+			return c > 0
+		}
+		return c < 0
+	})
+	if cmpErr != nil {
+		return nil, cmpErr
+	}
+	ret := &starList{elems: make([]Value, 0, len(elems))}
+	for _, i := range idx {
+		ret.elems = append(ret.elems, elems[i])
+	}
+	return ret, nil
+}
+
+func starBuiltinRange(th *starThread, recv Value, args []Value, kwargs map[string]Value) (Value, error) {
+	if err := starArgs("range", args, kwargs, 1, 3); err != nil {
+		return nil, err
+	}
+	n := make([]int, len(args))
+	for i, x := range args {
+		v, ok := x.(int)
+		if !ok {
+			return nil, fmt.Errorf("range requires int, not %v", starType(x))
+		}
+		n[i] = v
+	}
+	start, stop, step := 0, n[0], 1
+	if len(n) > 1 {
+		start, stop = n[0], n[1]
+	}
+	if len(n) > 2 {
+		step = n[2]
+	}
+	if step == 0 {
+		return nil, fmt.Errorf("range step can not be zero")
+	}
+	ret := &starList{}
+	for i := start; (step > 0 && i < stop) || (step < 0 && i > stop); i += step {
+		if len(ret.elems) >= starMaxSize {
+			return nil, fmt.Errorf("range is too large")
+		}
+		ret.elems = append(ret.elems, i)
+	}
+	return Tuple(ret.elems), nil
+}
+
+func starBuiltinMinMax(name string, sign int) starMethod {
+	return func(th *starThread, recv Value, args []Value, kwargs map[string]Value) (Value, error) {
+		if len(kwargs) > 0 {
+			return nil, fmt.Errorf("%v does not accept keyword arguments", name)
+		}
+		elems := args
+		if len(args) == 1 {
+			var err error
+			elems, err = starIterate(args[0])
+			if err != nil {
+				return nil, err
+			}
+		}
+		if len(elems) == 0 {
+			return nil, fmt.Errorf("%v of empty sequence", name)
+		}
+		ret := elems[0]
+		for _, x := range elems[1:] {
+			c, err := starCompare(x, ret)
+			if err != nil {
+				return nil, err
+			}
+			if c*sign > 0 {
+				ret = x
+			}
+		}
+		return ret, nil
+	}
+}
+
+func starBuiltinAnyAll(name string, any bool) starMethod {
+	return func(th *starThread, recv Value, args []Value, kwargs map[string]Value) (Value, error) {
+		if err := starArgs(name, args, kwargs, 1, 1); err != nil {
+			return nil, err
+		}
+		elems, err := starIterate(args[0])
+		if err != nil {
+			return nil, err
+		}
+		for _, x := range elems {
+			if starTruth(x) == any {
+				return any, nil
+			}
+		}
+		return !any, nil
+	}
+}
+
+func starBuiltinEnumerate(th *starThread, recv Value, args []Value, kwargs map[string]Value) (Value, error) {
+	if err := starArgs("enumerate", args, kwargs, 1, 1); err != nil {
+		return nil, err
+	}
+	elems, err := starIterate(args[0])
+	if err != nil {
+		return nil, err
+	}
+	ret := &starList{}
+	for i, x := range elems {
+		ret.elems = append(ret.elems, Tuple{i, x})
+	}
+	return ret, nil
+}
+
+func starBuiltinFail(th *starThread, recv Value, args []Value, kwargs map[string]Value) (Value, error) {
+	s := make([]string, 0, len(args))
+	for _, x := range args {
+		s = append(s, starStr(x))
+	}
+	return nil, fmt.Errorf("fail: %v", strings.Join(s, " "))
+}
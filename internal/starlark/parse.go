@@ -0,0 +1,1055 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package starlark
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Lexing and parsing of scripts.
+
+// Token kinds returned by the lexer.
+const (
+	starEOF = iota
+	starName
+	starInt
+	starString
+	starOp
+	starNewline
+	starIndent
+	starDedent
+)
+
+type starToken struct {
+	kind int
+	text string // The name, operator or decoded string value.
+	ival int
+	line int
+}
+
+func (t starToken) String() string {
+	switch t.kind {
+	case starEOF:
+		return "end of script"
+	case starNewline:
+		return "new line"
+	case starIndent:
+		return "indent"
+	case starDedent:
+		return "dedent"
+	case starString:
+		return strconv.Quote(t.text)
+	}
+	return t.text
+}
+
+var starOperators = []string{
+	"//=", "==", "!=", "<=", ">=", "//", "+=", "-=", "*=", "%=",
+	"+", "-", "*", "/", "%", "<", ">", "=", "(", ")", "[", "]", "{", "}",
+	",", ":", ".", ";",
+}
+
+// Split src into tokens, generating indent and dedent tokens from the
+// indentation of each line as Python does.
+func starLex(src string) ([]starToken, error) {
+	ret := make([]starToken, 0)
+	indents := []int{0}
+	depth := 0 // Nesting of brackets, within which new lines are ignored.
+	line := 1
+	atLineStart := true
+	i := 0
+	for i < len(src) {
+		if atLineStart && depth == 0 {
+			// Measure the indentation, skipping blank and comment
+			// only lines entirely.
+			n := 0
+			j := i
+			for j < len(src) && (src[j] == ' ' || src[j] == '\t') {
+				if src[j] == '\t' {
+					n += 8 - n%8
+				} else {
+					n++
+				}
+				j++
+			}
+			if j >= len(src) {
+				i = j
+				break
+			}
+			if src[j] == '\n' || src[j] == '\r' || src[j] == '#' {
+				for j < len(src) && src[j] != '\n' {
+					j++
+				}
+				if j < len(src) {
+					j++
+					line++
+				}
+				i = j
+				continue
+			}
+			i = j
+			atLineStart = false
+			if n > indents[len(indents)-1] {
+				indents = append(indents, n)
+				ret = append(ret, starToken{kind: starIndent, line: line})
+			}
+			for n < indents[len(indents)-1] {
+				indents = indents[:len(indents)-1]
+				ret = append(ret, starToken{kind: starDedent, line: line})
+			}
+			if n != indents[len(indents)-1] {
+				return nil, fmt.Errorf("line %v: inconsistent indentation", line)
+			}
+		}
+		c := src[i]
+		switch {
+		case c == '\n':
+			if depth == 0 {
+				ret = append(ret, starToken{kind: starNewline, line: line})
+				atLineStart = true
+			}
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case c == '\\' && i+1 < len(src) && src[i+1] == '\n':
+			i += 2
+			line++
+		case c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == '_' || isStarLetter(c):
+			j := i
+			for j < len(src) && (src[j] == '_' || isStarLetter(src[j]) || isStarDigit(src[j])) {
+				j++
+			}
+			ret = append(ret, starToken{kind: starName, text: src[i:j], line: line})
+			i = j
+		case isStarDigit(c):
+			j := i
+			for j < len(src) && (isStarDigit(src[j]) || isStarLetter(src[j])) {
+				j++
+			}
+			v, err := strconv.ParseInt(src[i:j], 0, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %v: invalid number %q", line, src[i:j])
+			}
+			ret = append(ret, starToken{kind: starInt, text: src[i:j], ival: int(v), line: line})
+			i = j
+		case c == '"' || c == '\'':
+			s, n, lines, err := starLexString(src[i:])
+			if err != nil {
+				return nil, fmt.Errorf("line %v: %v", line, err)
+			}
+			ret = append(ret, starToken{kind: starString, text: s, line: line})
+			i += n
+			line += lines
+		default:
+			found := false
+			for _, op := range starOperators {
+				if strings.HasPrefix(src[i:], op) {
+					switch op {
+					case "(", "[", "{":
+						depth++
+					case ")", "]", "}":
+						depth--
+					}
+					ret = append(ret, starToken{kind: starOp, text: op, line: line})
+					i += len(op)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("line %v: unexpected character %q", line, c)
+			}
+		}
+	}
+	if !atLineStart {
+		ret = append(ret, starToken{kind: starNewline, line: line})
+	}
+	for len(indents) > 1 {
+		indents = indents[:len(indents)-1]
+		ret = append(ret, starToken{kind: starDedent, line: line})
+	}
+	ret = append(ret, starToken{kind: starEOF, line: line})
+	return ret, nil
+}
+
+func isStarLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isStarDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// Decode the string literal at the start of s, returning the value, the
+// length of the literal and the number of new lines it contains.
+func starLexString(s string) (string, int, int, error) {
+	q := s[:1]
+	if strings.HasPrefix(s, q+q+q) {
+		q = q + q + q
+	}
+	var b strings.Builder
+	lines := 0
+	i := len(q)
+	for i < len(s) {
+		if strings.HasPrefix(s[i:], q) {
+			return b.String(), i + len(q), lines, nil
+		}
+		c := s[i]
+		if c == '\n' {
+			if len(q) == 1 {
+				break
+			}
+			lines++
+		}
+		if c != '\\' {
+			b.WriteByte(c)
+			i++
+			continue
+		}
+		if i+1 >= len(s) {
+			break
+		}
+		switch e := s[i+1]; e {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case '0':
+			b.WriteByte(0)
+		case '\\', '\'', '"':
+			b.WriteByte(e)
+		case '\n':
+			lines++
+		default:
+			b.WriteByte('\\')
+			b.WriteByte(e)
+		}
+		i += 2
+	}
+	return "", 0, 0, fmt.Errorf("unterminated string")
+}
+
+// Syntax tree nodes.
+
+type starStmt interface{}
+
+type starExpr interface{}
+
+type (
+	starDef struct {
+		name   string
+		params []string
+		body   []starStmt
+		line   int
+	}
+	starIf struct {
+		cond starExpr
+		body []starStmt
+		els  []starStmt
+	}
+	starFor struct {
+		target starExpr
+		iter   starExpr
+		body   []starStmt
+		line   int
+	}
+	starReturn struct {
+		value starExpr // nil for a bare return.
+	}
+	starAssign struct {
+		target starExpr
+		op     string // = or an augmented assignment operator such as +=.
+		value  starExpr
+		line   int
+	}
+	starExprStmt struct {
+		expr starExpr
+		line int
+	}
+	starBranch struct {
+		kind string // pass, break or continue.
+	}
+)
+
+type (
+	starLiteral struct {
+		value Value
+	}
+	starIdent struct {
+		name string
+		line int
+	}
+	starListExpr struct {
+		elems []starExpr
+	}
+	starTupleExpr struct {
+		elems []starExpr
+	}
+	starDictExpr struct {
+		keys   []starExpr
+		values []starExpr
+	}
+	starComprehension struct {
+		dict    bool
+		key     starExpr // The element for lists, the key for dicts.
+		value   starExpr
+		clauses []starClause
+	}
+	starCondExpr struct {
+		cond, yes, no starExpr
+	}
+	starBinary struct {
+		op          string
+		left, right starExpr
+		line        int
+	}
+	starUnary struct {
+		op      string
+		operand starExpr
+		line    int
+	}
+	starCall struct {
+		fn     starExpr
+		args   []starExpr
+		kwargs []starKwarg
+		line   int
+	}
+	starIndexExpr struct {
+		x, index starExpr
+		line     int
+	}
+	starSliceExpr struct {
+		x, lo, hi starExpr // lo and hi may be nil.
+		line      int
+	}
+	starDot struct {
+		x    starExpr
+		name string
+		line int
+	}
+)
+
+// A for or if clause of a comprehension.
+type starClause struct {
+	target starExpr // nil for an if clause.
+	expr   starExpr
+}
+
+type starKwarg struct {
+	name  string
+	value starExpr
+}
+
+type starParser struct {
+	toks []starToken
+	pos  int
+}
+
+// Parse a script into a list of statements.
+func starParse(src string) ([]starStmt, error) {
+	toks, err := starLex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &starParser{toks: toks}
+	ret := make([]starStmt, 0)
+	for p.peek().kind != starEOF {
+		s, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, s...)
+	}
+	return ret, nil
+}
+
+func (p *starParser) peek() starToken {
+	return p.toks[p.pos]
+}
+
+func (p *starParser) next() starToken {
+	t := p.toks[p.pos]
+	if t.kind != starEOF {
+		p.pos++
+	}
+	return t
+}
+
+// Return true if the next token is the operator or keyword s.
+func (p *starParser) at(s string) bool {
+	t := p.peek()
+	return (t.kind == starOp || t.kind == starName) && t.text == s
+}
+
+func (p *starParser) accept(s string) bool {
+	if p.at(s) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *starParser) expect(s string) error {
+	if !p.accept(s) {
+		return p.errorf("expected %q, found %v", s, p.peek())
+	}
+	return nil
+}
+
+func (p *starParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("line %v: %v", p.peek().line, fmt.Sprintf(format, args...))
+}
+
+var starKeywords = map[string]bool{
+	"and": true, "break": true, "continue": true, "def": true, "elif": true,
+	"else": true, "for": true, "if": true, "in": true, "not": true, "or": true,
+	"pass": true, "return": true, "None": true, "True": true, "False": true,
+	"lambda": true, "load": true, "while": true,
+}
+
+// Parse a statement, returning several statements for a line of simple
+// statements separated by semicolons.
+func (p *starParser) statement() ([]starStmt, error) {
+	var (
+		s   starStmt
+		err error
+	)
+	switch {
+	case p.at("def"):
+		s, err = p.def()
+	case p.at("if"):
+		s, err = p.ifStmt()
+	case p.at("for"):
+		s, err = p.forStmt()
+	case p.at("while"), p.at("lambda"), p.at("load"):
+		return nil, p.errorf("%v is not supported", p.peek().text)
+	default:
+		return p.simpleStatements()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []starStmt{s}, nil
+}
+
+func (p *starParser) simpleStatements() ([]starStmt, error) {
+	ret := make([]starStmt, 0)
+	for {
+		s, err := p.simpleStatement()
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, s)
+		if !p.accept(";") || p.peek().kind == starNewline {
+			break
+		}
+	}
+	if p.peek().kind != starNewline {
+		return nil, p.errorf("unexpected %v", p.peek())
+	}
+	p.next()
+	return ret, nil
+}
+
+func (p *starParser) simpleStatement() (starStmt, error) {
+	line := p.peek().line
+	switch {
+	case p.accept("return"):
+		if p.peek().kind == starNewline || p.at(";") {
+			return &starReturn{}, nil
+		}
+		v, err := p.exprList()
+		if err != nil {
+			return nil, err
+		}
+		return &starReturn{value: v}, nil
+	case p.at("pass"), p.at("break"), p.at("continue"):
+		return &starBranch{kind: p.next().text}, nil
+	}
+	x, err := p.exprList()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"=", "+=", "-=", "*=", "//=", "%="} {
+		if !p.accept(op) {
+			continue
+		}
+		err = starCheckTarget(x, op == "=")
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %v", line, err)
+		}
+		v, err := p.exprList()
+		if err != nil {
+			return nil, err
+		}
+		return &starAssign{target: x, op: op, value: v, line: line}, nil
+	}
+	return &starExprStmt{expr: x, line: line}, nil
+}
+
+// Check x can be assigned to; tuples of targets are only allowed for plain
+// assignment.
+func starCheckTarget(x starExpr, tuple bool) error {
+	switch t := x.(type) {
+	case *starIdent, *starIndexExpr:
+		return nil
+	case *starTupleExpr:
+		if tuple {
+			for _, y := range t.elems {
+				if err := starCheckTarget(y, true); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	case *starListExpr:
+		if tuple {
+			for _, y := range t.elems {
+				if err := starCheckTarget(y, true); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid assignment target")
+}
+
+// Parse the body of a compound statement following the colon, either an
+// indented block or simple statements on the same line.
+func (p *starParser) suite() ([]starStmt, error) {
+	err := p.expect(":")
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != starNewline {
+		return p.simpleStatements()
+	}
+	p.next()
+	if p.peek().kind != starIndent {
+		return nil, p.errorf("expected an indented block")
+	}
+	p.next()
+	ret := make([]starStmt, 0)
+	for p.peek().kind != starDedent && p.peek().kind != starEOF {
+		s, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, s...)
+	}
+	p.next()
+	return ret, nil
+}
+
+func (p *starParser) def() (starStmt, error) {
+	line := p.next().line
+	name := p.next()
+	if name.kind != starName || starKeywords[name.text] {
+		return nil, p.errorf("expected function name")
+	}
+	ret := &starDef{name: name.text, line: line}
+	err := p.expect("(")
+	if err != nil {
+		return nil, err
+	}
+	for !p.accept(")") {
+		t := p.next()
+		if t.kind != starName || starKeywords[t.text] {
+			return nil, p.errorf("expected parameter name, found %v", t)
+		}
+		ret.params = append(ret.params, t.text)
+		if !p.at(")") {
+			err = p.expect(",")
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	ret.body, err = p.suite()
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (p *starParser) ifStmt() (starStmt, error) {
+	p.next()
+	cond, err := p.test()
+	if err != nil {
+		return nil, err
+	}
+	ret := &starIf{cond: cond}
+	ret.body, err = p.suite()
+	if err != nil {
+		return nil, err
+	}
+	if p.at("elif") {
+		s, err := p.ifStmt()
+		if err != nil {
+			return nil, err
+		}
+		ret.els = []starStmt{s}
+	} else if p.accept("else") {
+		ret.els, err = p.suite()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+func (p *starParser) forStmt() (starStmt, error) {
+	line := p.next().line
+	target, err := p.targetList()
+	if err != nil {
+		return nil, err
+	}
+	err = p.expect("in")
+	if err != nil {
+		return nil, err
+	}
+	iter, err := p.exprList()
+	if err != nil {
+		return nil, err
+	}
+	body, err := p.suite()
+	if err != nil {
+		return nil, err
+	}
+	return &starFor{target: target, iter: iter, body: body, line: line}, nil
+}
+
+// Parse the loop variables of a for statement or clause.
+func (p *starParser) targetList() (starExpr, error) {
+	elems := make([]starExpr, 0)
+	for {
+		x, err := p.primary()
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, x)
+		if !p.accept(",") || p.at("in") {
+			break
+		}
+	}
+	var ret starExpr = &starTupleExpr{elems: elems}
+	if len(elems) == 1 {
+		ret = elems[0]
+	}
+	if err := starCheckTarget(ret, true); err != nil {
+		return nil, p.errorf("%v", err)
+	}
+	return ret, nil
+}
+
+// Parse one or more expressions separated by commas, returning a tuple if
+// there is more than one or a trailing comma.
+func (p *starParser) exprList() (starExpr, error) {
+	x, err := p.test()
+	if err != nil {
+		return nil, err
+	}
+	if !p.at(",") {
+		return x, nil
+	}
+	elems := []starExpr{x}
+	for p.accept(",") {
+		if p.endOfExprList() {
+			break
+		}
+		x, err = p.test()
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, x)
+	}
+	return &starTupleExpr{elems: elems}, nil
+}
+
+func (p *starParser) endOfExprList() bool {
+	t := p.peek()
+	if t.kind == starNewline || t.kind == starEOF {
+		return true
+	}
+	if t.kind != starOp {
+		return false
+	}
+	switch t.text {
+	case ")", "]", "}", "=", ";", ":", "+=", "-=", "*=", "//=", "%=":
+		return true
+	}
+	return false
+}
+
+// Parse an expression, including a conditional expression.
+func (p *starParser) test() (starExpr, error) {
+	x, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if !p.at("if") {
+		return x, nil
+	}
+	p.next()
+	cond, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	err = p.expect("else")
+	if err != nil {
+		return nil, err
+	}
+	no, err := p.test()
+	if err != nil {
+		return nil, err
+	}
+	return &starCondExpr{cond: cond, yes: x, no: no}, nil
+}
+
+func (p *starParser) or() (starExpr, error) {
+	x, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.at("or") {
+		line := p.next().line
+		y, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		x = &starBinary{op: "or", left: x, right: y, line: line}
+	}
+	return x, nil
+}
+
+func (p *starParser) and() (starExpr, error) {
+	x, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.at("and") {
+		line := p.next().line
+		y, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		x = &starBinary{op: "and", left: x, right: y, line: line}
+	}
+	return x, nil
+}
+
+func (p *starParser) not() (starExpr, error) {
+	if p.at("not") {
+		line := p.next().line
+		x, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return &starUnary{op: "not", operand: x, line: line}, nil
+	}
+	return p.comparison()
+}
+
+func (p *starParser) comparison() (starExpr, error) {
+	x, err := p.arith()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		line := p.peek().line
+		var op string
+		switch {
+		case p.at("=="), p.at("!="), p.at("<"), p.at("<="), p.at(">"), p.at(">="), p.at("in"):
+			op = p.next().text
+		case p.at("not") && p.toks[p.pos+1].kind == starName && p.toks[p.pos+1].text == "in":
+			p.pos += 2
+			op = "not in"
+		default:
+			return x, nil
+		}
+		y, err := p.arith()
+		if err != nil {
+			return nil, err
+		}
+		x = &starBinary{op: op, left: x, right: y, line: line}
+	}
+}
+
+func (p *starParser) arith() (starExpr, error) {
+	x, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for p.at("+") || p.at("-") {
+		t := p.next()
+		y, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		x = &starBinary{op: t.text, left: x, right: y, line: t.line}
+	}
+	return x, nil
+}
+
+func (p *starParser) term() (starExpr, error) {
+	x, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.at("*") || p.at("/") || p.at("//") || p.at("%") {
+		t := p.next()
+		y, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		x = &starBinary{op: t.text, left: x, right: y, line: t.line}
+	}
+	return x, nil
+}
+
+func (p *starParser) unary() (starExpr, error) {
+	if p.at("-") || p.at("+") {
+		t := p.next()
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &starUnary{op: t.text, operand: x, line: t.line}, nil
+	}
+	return p.primary()
+}
+
+func (p *starParser) primary() (starExpr, error) {
+	x, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		line := p.peek().line
+		switch {
+		case p.accept("."):
+			t := p.next()
+			if t.kind != starName {
+				return nil, p.errorf("expected attribute name, found %v", t)
+			}
+			x = &starDot{x: x, name: t.text, line: line}
+		case p.accept("("):
+			c, err := p.call(x, line)
+			if err != nil {
+				return nil, err
+			}
+			x = c
+		case p.accept("["):
+			var lo, hi starExpr
+			if !p.at(":") {
+				lo, err = p.exprList()
+				if err != nil {
+					return nil, err
+				}
+			}
+			if p.accept(":") {
+				if !p.at("]") {
+					hi, err = p.test()
+					if err != nil {
+						return nil, err
+					}
+				}
+				x = &starSliceExpr{x: x, lo: lo, hi: hi, line: line}
+			} else {
+				x = &starIndexExpr{x: x, index: lo, line: line}
+			}
+			err = p.expect("]")
+			if err != nil {
+				return nil, err
+			}
+		default:
+			return x, nil
+		}
+	}
+}
+
+func (p *starParser) call(fn starExpr, line int) (starExpr, error) {
+	ret := &starCall{fn: fn, line: line}
+	for !p.accept(")") {
+		if p.peek().kind == starName && p.toks[p.pos+1].kind == starOp && p.toks[p.pos+1].text == "=" {
+			name := p.next().text
+			p.next()
+			v, err := p.test()
+			if err != nil {
+				return nil, err
+			}
+			ret.kwargs = append(ret.kwargs, starKwarg{name: name, value: v})
+		} else {
+			if len(ret.kwargs) > 0 {
+				return nil, p.errorf("positional argument follows keyword argument")
+			}
+			v, err := p.test()
+			if err != nil {
+				return nil, err
+			}
+			ret.args = append(ret.args, v)
+		}
+		if !p.at(")") {
+			err := p.expect(",")
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return ret, nil
+}
+
+func (p *starParser) operand() (starExpr, error) {
+	t := p.next()
+	switch t.kind {
+	case starInt:
+		return &starLiteral{value: t.ival}, nil
+	case starString:
+		// Adjacent string literals are concatenated.
+		s := t.text
+		for p.peek().kind == starString {
+			s += p.next().text
+		}
+		return &starLiteral{value: s}, nil
+	case starName:
+		switch t.text {
+		case "None":
+			return &starLiteral{value: nil}, nil
+		case "True":
+			return &starLiteral{value: true}, nil
+		case "False":
+			return &starLiteral{value: false}, nil
+		}
+		if starKeywords[t.text] {
+			p.pos--
+			return nil, p.errorf("unexpected %v", t.text)
+		}
+		return &starIdent{name: t.text, line: t.line}, nil
+	case starOp:
+		switch t.text {
+		case "(":
+			if p.accept(")") {
+				return &starTupleExpr{}, nil
+			}
+			x, err := p.exprList()
+			if err != nil {
+				return nil, err
+			}
+			return x, p.expect(")")
+		case "[":
+			return p.listOrComprehension()
+		case "{":
+			return p.dictOrComprehension()
+		}
+	}
+	p.pos--
+	return nil, p.errorf("unexpected %v", t)
+}
+
+func (p *starParser) listOrComprehension() (starExpr, error) {
+	ret := &starListExpr{}
+	if p.accept("]") {
+		return ret, nil
+	}
+	x, err := p.test()
+	if err != nil {
+		return nil, err
+	}
+	if p.at("for") {
+		c := &starComprehension{key: x}
+		c.clauses, err = p.clauses()
+		if err != nil {
+			return nil, err
+		}
+		return c, p.expect("]")
+	}
+	ret.elems = append(ret.elems, x)
+	for p.accept(",") && !p.at("]") {
+		x, err = p.test()
+		if err != nil {
+			return nil, err
+		}
+		ret.elems = append(ret.elems, x)
+	}
+	return ret, p.expect("]")
+}
+
+func (p *starParser) dictOrComprehension() (starExpr, error) {
+	ret := &starDictExpr{}
+	if p.accept("}") {
+		return ret, nil
+	}
+	for {
+		k, err := p.test()
+		if err != nil {
+			return nil, err
+		}
+		err = p.expect(":")
+		if err != nil {
+			return nil, err
+		}
+		v, err := p.test()
+		if err != nil {
+			return nil, err
+		}
+		if len(ret.keys) == 0 && p.at("for") {
+			c := &starComprehension{dict: true, key: k, value: v}
+			c.clauses, err = p.clauses()
+			if err != nil {
+				return nil, err
+			}
+			return c, p.expect("}")
+		}
+		ret.keys = append(ret.keys, k)
+		ret.values = append(ret.values, v)
+		if !p.accept(",") || p.at("}") {
+			break
+		}
+	}
+	return ret, p.expect("}")
+}
+
+func (p *starParser) clauses() ([]starClause, error) {
+	ret := make([]starClause, 0)
+	for {
+		switch {
+		case p.accept("for"):
+			target, err := p.targetList()
+			if err != nil {
+				return nil, err
+			}
+			err = p.expect("in")
+			if err != nil {
+				return nil, err
+			}
+			x, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, starClause{target: target, expr: x})
+		case p.accept("if"):
+			x, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, starClause{expr: x})
+		default:
+			return ret, nil
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+// Package starlark is a minimal interpreter for the subset of Starlark used
+// by script tests. Scripts have no access to the system, and are limited in
+// the number of steps they can execute and the size of the values they
+// create.
+//
+// Supported statements are def, if/elif/else, for, return, break,
+// continue, pass, assignment (including augmented and tuple assignment)
+// and expression statements. Expressions support integers, strings, None,
+// True and False, lists, tuples, dicts, list and dict comprehensions,
+// conditional expressions, and the usual arithmetic, comparison, boolean
+// and membership operators. Floating point numbers, lambda, load and
+// keyword parameters in def are not supported. As in Starlark, functions
+// can not be recursive.
+package starlark
+
+import (
+	"fmt"
+)
+
+// Program is a parsed script.
+type Program struct {
+	stmts []starStmt
+}
+
+// Parse parses the script src.
+func Parse(src string) (*Program, error) {
+	stmts, err := starParse(src)
+	if err != nil {
+		return nil, err
+	}
+	return &Program{stmts: stmts}, nil
+}
+
+// Params returns the number of parameters of the function name defined at
+// the top level of the program, or false if it is not defined.
+func (p *Program) Params(name string) (int, bool) {
+	for _, x := range p.stmts {
+		if def, ok := x.(*starDef); ok && def.name == name {
+			return len(def.params), true
+		}
+	}
+	return 0, false
+}
+
+// Call executes the program and calls the function name defined by it with
+// args, returning the value returned and the number of steps executed.
+func (p *Program) Call(name string, args ...Value) (Value, int, error) {
+	th := newStarThread()
+	globals := &starScope{vars: make(map[string]Value)}
+	_, _, err := th.exec(p.stmts, globals)
+	if err != nil {
+		return nil, th.steps, err
+	}
+	fn, ok := globals.vars[name]
+	if !ok {
+		return nil, th.steps, fmt.Errorf("%v is not defined", name)
+	}
+	v, err := th.call(fn, args, nil)
+	return v, th.steps, err
+}
+
+// List returns a list of elems.
+func List(elems []Value) Value {
+	return &starList{elems: elems}
+}
+
+// Struct returns a read only value with the named fields, such as a
+// criteria.
+func Struct(name string, fields map[string]Value) Value {
+	return &starStruct{name: name, fields: fields}
+}
+
+// Str returns v converted to a string, as by str().
+func Str(v Value) string {
+	return starStr(v)
+}
+
+// Type returns the name of the type of v, as by type().
+func Type(v Value) string {
+	return starType(v)
+}
@@ -0,0 +1,335 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+// Package toml is a minimal TOML decoder, supporting the subset of TOML
+// commonly used in configuration files: tables, arrays of tables, dotted
+// keys, strings, integers, floats, booleans, arrays and inline tables.
+// Dates and times are returned as strings. Multi-line strings are not
+// supported.
+package toml
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Decode decodes the TOML document in buf. Tables are returned as
+// map[string]interface{}, and arrays as []interface{}.
+func Decode(buf []byte) (interface{}, error) {
+	root := make(map[string]interface{})
+	cur := root
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		p := &parser{s: scanner.Text()}
+		p.skipSpace()
+		if p.done() {
+			continue
+		}
+		var err error
+		if strings.HasPrefix(p.rest(), "[[") {
+			p.pos += 2
+			cur, err = p.arrayTable(root)
+		} else if p.peek() == '[' {
+			p.pos++
+			cur, err = p.table(root)
+		} else {
+			err = p.keyValue(cur)
+		}
+		if err == nil {
+			p.skipSpace()
+			if !p.done() {
+				err = fmt.Errorf("unexpected %q", p.rest())
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("toml line %v: %v", lineno, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+type parser struct {
+	s   string
+	pos int
+}
+
+func (p *parser) rest() string {
+	return p.s[p.pos:]
+}
+
+func (p *parser) peek() byte {
+	if p.pos >= len(p.s) {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+// Return true if the remainder of the line is empty or a comment.
+func (p *parser) done() bool {
+	return p.pos >= len(p.s) || p.s[p.pos] == '#'
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *parser) expect(c byte) error {
+	p.skipSpace()
+	if p.peek() != c {
+		return fmt.Errorf("expected %q at %q", c, p.rest())
+	}
+	p.pos++
+	return nil
+}
+
+// Parse a table header, returning the table.
+func (p *parser) table(root map[string]interface{}) (map[string]interface{}, error) {
+	keys, err := p.key()
+	if err != nil {
+		return nil, err
+	}
+	if err = p.expect(']'); err != nil {
+		return nil, err
+	}
+	return descend(root, keys)
+}
+
+// Parse an array of tables header, returning the new table appended to the
+// array.
+func (p *parser) arrayTable(root map[string]interface{}) (map[string]interface{}, error) {
+	keys, err := p.key()
+	if err != nil {
+		return nil, err
+	}
+	if err = p.expect(']'); err != nil {
+		return nil, err
+	}
+	if err = p.expect(']'); err != nil {
+		return nil, err
+	}
+	parent, err := descend(root, keys[:len(keys)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := keys[len(keys)-1]
+	t := make(map[string]interface{})
+	switch v := parent[last].(type) {
+	case nil:
+		parent[last] = []interface{}{t}
+	case []interface{}:
+		parent[last] = append(v, t)
+	default:
+		return nil, fmt.Errorf("%v is not an array of tables", last)
+	}
+	return t, nil
+}
+
+// Return the table at keys below t, creating tables as required. If a key
+// refers to an array of tables, the last table in the array is used.
+func descend(t map[string]interface{}, keys []string) (map[string]interface{}, error) {
+	for _, k := range keys {
+		switch v := t[k].(type) {
+		case nil:
+			n := make(map[string]interface{})
+			t[k] = n
+			t = n
+		case map[string]interface{}:
+			t = v
+		case []interface{}:
+			if len(v) == 0 {
+				return nil, fmt.Errorf("%v is an empty array", k)
+			}
+			n, ok := v[len(v)-1].(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%v is not a table", k)
+			}
+			t = n
+		default:
+			return nil, fmt.Errorf("%v is not a table", k)
+		}
+	}
+	return t, nil
+}
+
+// Parse a key = value pair, storing the value in t.
+func (p *parser) keyValue(t map[string]interface{}) error {
+	keys, err := p.key()
+	if err != nil {
+		return err
+	}
+	if err = p.expect('='); err != nil {
+		return err
+	}
+	v, err := p.value()
+	if err != nil {
+		return err
+	}
+	t, err = descend(t, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+	last := keys[len(keys)-1]
+	if _, ok := t[last]; ok {
+		return fmt.Errorf("duplicate key %v", last)
+	}
+	t[last] = v
+	return nil
+}
+
+// Parse a possibly dotted key.
+func (p *parser) key() ([]string, error) {
+	ret := make([]string, 0)
+	for {
+		p.skipSpace()
+		var k string
+		switch p.peek() {
+		case '"', '\'':
+			var err error
+			k, err = p.str()
+			if err != nil {
+				return nil, err
+			}
+		default:
+			start := p.pos
+			for p.pos < len(p.s) {
+				c := p.s[p.pos]
+				if !(c == '_' || c == '-' || (c >= 'a' && c <= 'z') ||
+					(c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')) {
+					break
+				}
+				p.pos++
+			}
+			if p.pos == start {
+				return nil, fmt.Errorf("expected key at %q", p.rest())
+			}
+			k = p.s[start:p.pos]
+		}
+		ret = append(ret, k)
+		p.skipSpace()
+		if p.peek() != '.' {
+			return ret, nil
+		}
+		p.pos++
+	}
+}
+
+// Parse a basic or literal string.
+func (p *parser) str() (string, error) {
+	q := p.peek()
+	if strings.HasPrefix(p.rest(), strings.Repeat(string(q), 3)) {
+		return "", fmt.Errorf("multi-line strings are not supported")
+	}
+	for i := p.pos + 1; i < len(p.s); i++ {
+		if q == '"' && p.s[i] == '\\' {
+			i++
+			continue
+		}
+		if p.s[i] == q {
+			raw := p.s[p.pos : i+1]
+			p.pos = i + 1
+			if q == '\'' {
+				return raw[1 : len(raw)-1], nil
+			}
+			return strconv.Unquote(raw)
+		}
+	}
+	return "", fmt.Errorf("unterminated string")
+}
+
+// Parse a value.
+func (p *parser) value() (interface{}, error) {
+	p.skipSpace()
+	switch p.peek() {
+	case '"', '\'':
+		return p.str()
+	case '[':
+		p.pos++
+		ret := make([]interface{}, 0)
+		for {
+			p.skipSpace()
+			if p.peek() == ']' {
+				p.pos++
+				return ret, nil
+			}
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, v)
+			p.skipSpace()
+			if p.peek() == ',' {
+				p.pos++
+			} else if p.peek() != ']' {
+				return nil, fmt.Errorf("expected , or ] at %q", p.rest())
+			}
+		}
+	case '{':
+		p.pos++
+		ret := make(map[string]interface{})
+		for {
+			p.skipSpace()
+			if p.peek() == '}' {
+				p.pos++
+				return ret, nil
+			}
+			err := p.keyValue(ret)
+			if err != nil {
+				return nil, err
+			}
+			p.skipSpace()
+			if p.peek() == ',' {
+				p.pos++
+			} else if p.peek() != '}' {
+				return nil, fmt.Errorf("expected , or } at %q", p.rest())
+			}
+		}
+	}
+	start := p.pos
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		if c == ',' || c == ']' || c == '}' || c == '#' || c == '\t' {
+			break
+		}
+		// A space may separate the date and time in a datetime.
+		if c == ' ' && !(p.pos+1 < len(p.s) && p.s[p.pos+1] >= '0' &&
+			p.s[p.pos+1] <= '9' && strings.Count(p.s[start:p.pos], "-") == 2) {
+			break
+		}
+		p.pos++
+	}
+	raw := p.s[start:p.pos]
+	switch raw {
+	case "":
+		return nil, fmt.Errorf("expected value at %q", p.rest())
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	num := strings.Replace(raw, "_", "", -1)
+	if i, err := strconv.ParseInt(num, 0, 64); err == nil {
+		return i, nil
+	}
+	if f, err := strconv.ParseFloat(num, 64); err == nil {
+		return f, nil
+	}
+	// Dates and times are returned as strings.
+	if raw[0] >= '0' && raw[0] <= '9' && strings.ContainsAny(raw, "-:") {
+		return raw, nil
+	}
+	return nil, fmt.Errorf("invalid value %q", raw)
+}
@@ -0,0 +1,51 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// The timeout applied to requests made to an inventory service.
+const inventoryTimeout = 30 * time.Second
+
+// InventoryPackageQuery returns a package query function for use with
+// InstallPackageQuery() that fetches the package list for host from an
+// inventory service, such as a CMDB or package snapshot server, rather than
+// the local system. This allows package tests to be evaluated centrally
+// without access to the host.
+//
+// The string {host} in urlTemplate is replaced with the escaped host name,
+// for example https://inventory.example.com/hosts/{host}/packages. The
+// service must respond with a JSON array of objects in PackageInfo form.
+func InventoryPackageQuery(urlTemplate string, host string) func() ([]PackageInfo, error) {
+	return func() ([]PackageInfo, error) {
+		u := strings.Replace(urlTemplate, "{host}", url.PathEscape(host), -1)
+		debugPrint("InventoryPackageQuery(): fetching %v\n", u)
+		client := HTTPClient(inventoryTimeout)
+		resp, err := client.Get(u)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("inventory service returned %v for %v", resp.Status, host)
+		}
+		var ret []PackageInfo
+		err = json.NewDecoder(resp.Body).Decode(&ret)
+		if err != nil {
+			return nil, fmt.Errorf("invalid inventory response: %v", err)
+		}
+		return ret, nil
+	}
+}
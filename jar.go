@@ -0,0 +1,277 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+// JAR is used to perform tests against Java archives (jar, war and ear
+// files) located on the file system.
+//
+// Archives are located using Path and File in the same way as for FileName.
+// For each archive, embedded Maven pom.properties files are read to
+// identify the artifacts contained in the archive. If an archive contains no
+// Maven metadata, the archive manifest is used instead. Archives nested
+// within the located archive (for example libraries in WEB-INF/lib in a war
+// file) are also inspected.
+//
+// Artifact is a regular expression matched against the artifact ID. The
+// test value for each matching artifact is the artifact version, and the
+// identifier is the path to the archive. For nested archives the identifier
+// is the path to the outer archive, followed by ! and the path to the nested
+// archive.
+type JAR struct {
+	Path     string `json:"path,omitempty" yaml:"path,omitempty"`
+	File     string `json:"file,omitempty" yaml:"file,omitempty"`
+	Artifact string `json:"artifact,omitempty" yaml:"artifact,omitempty"`
+
+	LocatorOptions `yaml:",inline"`
+
+	fileRe     compiledRegexp
+	artifactRe compiledRegexp
+	matches    []jarArtifact
+}
+
+type jarArtifact struct {
+	identifier string
+	groupID    string
+	artifactID string
+	version    string
+}
+
+// The maximum size of a nested archive that will be read into memory for
+// inspection.
+const jarMaxNestedSize = 64 * 1024 * 1024
+
+func (j *JAR) isChain() bool {
+	return false
+}
+
+func (j *JAR) fireChains(d *Document) ([]evaluationCriteria, error) {
+	return nil, nil
+}
+
+func (j *JAR) mergeCriteria(c []evaluationCriteria) {
+}
+
+func (j *JAR) validate(d *Document) error {
+	if len(j.Path) == 0 {
+		return fmt.Errorf("jar path must be set")
+	}
+	if len(j.File) == 0 {
+		return fmt.Errorf("jar file must be set")
+	}
+	_, err := j.fileRe.compile(j.fileExpression(j.File))
+	if err != nil {
+		return err
+	}
+	if len(j.Artifact) == 0 {
+		return fmt.Errorf("jar artifact must be set")
+	}
+	_, err = j.artifactRe.compile(j.Artifact)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (j *JAR) expandVariables(v []Variable) {
+	j.Path = variableExpansion(v, j.Path)
+	j.File = variableExpansion(v, j.File)
+}
+
+func (j *JAR) getCriteria() (ret []evaluationCriteria) {
+	for _, x := range j.matches {
+		n := evaluationCriteria{}
+		n.identifier = x.identifier
+		n.testValue = x.version
+		ret = append(ret, n)
+	}
+	return ret
+}
+
+func (j *JAR) prepare() error {
+	debugPrint("prepare(): analyzing file system, path %v, file \"%v\"\n", j.Path, j.File)
+
+	re, err := j.artifactRe.compile(j.Artifact)
+	if err != nil {
+		return err
+	}
+	filere, err := j.fileRe.compile(j.fileExpression(j.File))
+	if err != nil {
+		return err
+	}
+
+	sfl := newSimpleFileLocator()
+	sfl.root = j.Path
+	sfl.opts = j.LocatorOptions
+	err = sfl.locateRegexp(filere)
+	if err != nil {
+		return err
+	}
+
+	for _, x := range sfl.matches {
+		zr, err := jarOpen(x, j.LocatorOptions)
+		if err != nil {
+			debugPrint("prepare(): skipping %v: %v\n", x, err)
+			continue
+		}
+		arts := jarInspect(zr, x, true)
+		for _, y := range arts {
+			if !re.MatchString(y.artifactID) {
+				continue
+			}
+			debugPrint("prepare(): %v contains %v:%v %v\n", y.identifier,
+				y.groupID, y.artifactID, y.version)
+			j.matches = append(j.matches, y)
+		}
+	}
+	return nil
+}
+
+// Open the archive at path, a path returned by the file locator.
+func jarOpen(path string, opts LocatorOptions) (*zip.Reader, error) {
+	fd, err := openLocated(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := ioutil.ReadAll(fd)
+	fd.Close()
+	if err != nil {
+		return nil, err
+	}
+	return zip.NewReader(bytes.NewReader(buf), int64(len(buf)))
+}
+
+// Inspect an archive, returning any artifacts identified. If nested is true,
+// any archives contained within the archive are also inspected.
+func jarInspect(zr *zip.Reader, identifier string, nested bool) []jarArtifact {
+	ret := make([]jarArtifact, 0)
+	var manifest *zip.File
+	for _, x := range zr.File {
+		switch {
+		case strings.HasPrefix(x.Name, "META-INF/maven/") &&
+			path.Base(x.Name) == "pom.properties":
+			props, err := jarReadProperties(x)
+			if err != nil {
+				continue
+			}
+			na := jarArtifact{identifier: identifier}
+			na.groupID = props["groupId"]
+			na.artifactID = props["artifactId"]
+			na.version = props["version"]
+			if na.artifactID == "" || na.version == "" {
+				continue
+			}
+			ret = append(ret, na)
+		case x.Name == "META-INF/MANIFEST.MF":
+			manifest = x
+		case nested && jarIsArchive(x.Name):
+			if x.UncompressedSize64 > jarMaxNestedSize {
+				debugPrint("jarInspect(): skipping large nested archive %v\n", x.Name)
+				continue
+			}
+			buf, err := jarReadFile(x)
+			if err != nil {
+				continue
+			}
+			nzr, err := zip.NewReader(bytes.NewReader(buf), int64(len(buf)))
+			if err != nil {
+				continue
+			}
+			ret = append(ret, jarInspect(nzr, identifier+"!"+x.Name, false)...)
+		}
+	}
+	// If no Maven metadata was present in the archive itself, fall back
+	// to using the manifest.
+	found := false
+	for _, x := range ret {
+		if x.identifier == identifier {
+			found = true
+			break
+		}
+	}
+	if !found && manifest != nil {
+		na, err := jarReadManifest(manifest)
+		if err == nil {
+			na.identifier = identifier
+			ret = append(ret, na)
+		}
+	}
+	return ret
+}
+
+func jarIsArchive(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	return ext == ".jar" || ext == ".war" || ext == ".ear"
+}
+
+func jarReadFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ioutil.ReadAll(io.LimitReader(rc, jarMaxNestedSize))
+}
+
+func jarReadProperties(f *zip.File) (map[string]string, error) {
+	buf, err := jarReadFile(f)
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	for scanner.Scan() {
+		ln := strings.TrimSpace(scanner.Text())
+		if ln == "" || strings.HasPrefix(ln, "#") {
+			continue
+		}
+		s := strings.SplitN(ln, "=", 2)
+		if len(s) != 2 {
+			continue
+		}
+		ret[strings.TrimSpace(s[0])] = strings.TrimSpace(s[1])
+	}
+	return ret, nil
+}
+
+func jarReadManifest(f *zip.File) (ret jarArtifact, err error) {
+	buf, err := jarReadFile(f)
+	if err != nil {
+		return
+	}
+	attrs := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	for scanner.Scan() {
+		s := strings.SplitN(scanner.Text(), ":", 2)
+		if len(s) != 2 {
+			continue
+		}
+		attrs[strings.TrimSpace(s[0])] = strings.TrimSpace(s[1])
+	}
+	ret.artifactID = attrs["Implementation-Title"]
+	ret.version = attrs["Implementation-Version"]
+	ret.groupID = attrs["Implementation-Vendor-Id"]
+	if ret.artifactID == "" || ret.version == "" {
+		ret.artifactID = attrs["Bundle-SymbolicName"]
+		ret.version = attrs["Bundle-Version"]
+	}
+	if ret.artifactID == "" || ret.version == "" {
+		err = fmt.Errorf("manifest contains no artifact information")
+	}
+	return
+}
@@ -0,0 +1,315 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	goruntime "runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Journal is used to perform tests against log messages in the systemd
+// journal, for systems that no longer write log files under /var/log. The
+// journal is queried using journalctl. On platforms other than Linux no
+// criteria are returned.
+//
+// Expression is a regular expression applied to the message of each entry.
+// Entries can be restricted to those logged by the systemd unit Unit (for
+// example sshd.service), to those with a priority of Priority or more
+// important (a name such as err, or a number from 0 to 7), and to those
+// logged within Since of the time the object is prepared, as a duration
+// such as 24h (the default).
+//
+// For each matching entry a criteria is returned, the identifier being the
+// syslog identifier of the process that logged the entry (or the unit if
+// it has none) and the value being the first subexpression matched by
+// Expression, or the entire message if the expression has none.
+//
+// If Count is true, a single criteria is returned instead with the unit (or
+// journal if Unit is not set) as the identifier and the number of matching
+// entries as the value.
+type Journal struct {
+	Expression string `json:"expression,omitempty" yaml:"expression,omitempty"`
+	Unit       string `json:"unit,omitempty" yaml:"unit,omitempty"`
+	Priority   string `json:"priority,omitempty" yaml:"priority,omitempty"`
+	Since      string `json:"since,omitempty" yaml:"since,omitempty"`
+	Count      bool   `json:"count,omitempty" yaml:"count,omitempty"`
+
+	re      compiledRegexp
+	matches []journalMatch
+}
+
+type journalMatch struct {
+	identifier string
+	value      string
+}
+
+type journalEntry struct {
+	time       time.Time
+	priority   int
+	unit       string
+	identifier string
+	message    string
+}
+
+// The default time window for journal queries.
+const journalDefaultSince = 24 * time.Hour
+
+var journalPriorities = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+func (j *Journal) isChain() bool {
+	return false
+}
+
+func (j *Journal) fireChains(d *Document) ([]evaluationCriteria, error) {
+	return nil, nil
+}
+
+func (j *Journal) mergeCriteria(c []evaluationCriteria) {
+}
+
+func (j *Journal) validate(d *Document) error {
+	_, err := j.re.compile(j.Expression)
+	if err != nil {
+		return err
+	}
+	_, err = j.priority()
+	if err != nil {
+		return err
+	}
+	_, err = j.since()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Return the maximum priority of entries, 7 (debug) if it is not set.
+func (j *Journal) priority() (int, error) {
+	if j.Priority == "" {
+		return len(journalPriorities) - 1, nil
+	}
+	for i, x := range journalPriorities {
+		if strings.EqualFold(j.Priority, x) {
+			return i, nil
+		}
+	}
+	n, err := strconv.Atoi(j.Priority)
+	if err != nil || n < 0 || n >= len(journalPriorities) {
+		return 0, fmt.Errorf("journal priority %q is not valid", j.Priority)
+	}
+	return n, nil
+}
+
+func (j *Journal) since() (time.Duration, error) {
+	if j.Since == "" {
+		return journalDefaultSince, nil
+	}
+	d, err := time.ParseDuration(j.Since)
+	if err != nil {
+		return 0, fmt.Errorf("journal since: %v", err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("journal since must be positive")
+	}
+	return d, nil
+}
+
+func (j *Journal) expandVariables(v []Variable) {
+	j.Unit = variableExpansion(v, j.Unit)
+}
+
+func (j *Journal) getCriteria() (ret []evaluationCriteria) {
+	for _, x := range j.matches {
+		n := evaluationCriteria{}
+		n.identifier = x.identifier
+		n.testValue = x.value
+		ret = append(ret, n)
+	}
+	return ret
+}
+
+func (j *Journal) prepare() error {
+	debugPrint("prepare(): querying journal, unit \"%v\", expression \"%v\"\n", j.Unit, j.Expression)
+	re, err := j.re.compile(j.Expression)
+	if err != nil {
+		return err
+	}
+	prio, err := j.priority()
+	if err != nil {
+		return err
+	}
+	since, err := j.since()
+	if err != nil {
+		return err
+	}
+	start := time.Now().Add(-since)
+	entries, err := getJournalEntries(j.Unit, prio, start)
+	if err != nil {
+		return err
+	}
+	count := 0
+	for _, x := range entries {
+		// Entries are filtered again here, as journalctl -u also
+		// returns messages logged by systemd about the unit.
+		if x.time.Before(start) || x.priority > prio {
+			continue
+		}
+		if j.Unit != "" && x.unit != j.Unit {
+			continue
+		}
+		m := re.FindStringSubmatch(x.message)
+		if m == nil {
+			continue
+		}
+		count++
+		if j.Count {
+			continue
+		}
+		id := x.identifier
+		if id == "" {
+			id = x.unit
+		}
+		value := x.message
+		if len(m) > 1 {
+			value = m[1]
+		}
+		j.matches = append(j.matches, journalMatch{id, value})
+	}
+	if j.Count {
+		id := j.Unit
+		if id == "" {
+			id = "journal"
+		}
+		j.matches = append(j.matches, journalMatch{id, fmt.Sprintf("%v", count)})
+	}
+	return nil
+}
+
+func getJournalEntries(unit string, prio int, start time.Time) ([]journalEntry, error) {
+	if sRuntime.testHooks {
+		return testJournalEntries(), nil
+	}
+	if goruntime.GOOS != "linux" {
+		return nil, nil
+	}
+	args := []string{"-o", "json", "--no-pager", "-q", "-p", fmt.Sprintf("%v", prio),
+		"--since", fmt.Sprintf("@%v", start.Unix())}
+	if unit != "" {
+		args = append(args, "-u", unit)
+	}
+	buf, err := exec.Command("journalctl", args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("journalctl: %v", err)
+	}
+	return parseJournalJSON(buf)
+}
+
+// Parse journalctl JSON output, which contains one entry per line.
+func parseJournalJSON(buf []byte) ([]journalEntry, error) {
+	ret := make([]journalEntry, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var fields map[string]interface{}
+		err := json.Unmarshal(scanner.Bytes(), &fields)
+		if err != nil {
+			return nil, fmt.Errorf("journalctl: %v", err)
+		}
+		e := journalEntry{
+			unit:       journalField(fields, "_SYSTEMD_UNIT"),
+			identifier: journalField(fields, "SYSLOG_IDENTIFIER"),
+			message:    journalField(fields, "MESSAGE"),
+		}
+		if e.unit == "" {
+			e.unit = journalField(fields, "UNIT")
+		}
+		e.priority, err = strconv.Atoi(journalField(fields, "PRIORITY"))
+		if err != nil {
+			e.priority = len(journalPriorities) - 1
+		}
+		usec, err := strconv.ParseInt(journalField(fields, "__REALTIME_TIMESTAMP"), 10, 64)
+		if err == nil {
+			e.time = time.Unix(0, usec*1000)
+		}
+		ret = append(ret, e)
+	}
+	return ret, scanner.Err()
+}
+
+// Return a field of a journal entry as a string. Fields containing binary
+// data are represented as an array of bytes, and fields present more than
+// once in an entry as an array of values, the first of which is used.
+func journalField(fields map[string]interface{}, name string) string {
+	switch v := fields[name].(type) {
+	case string:
+		return v
+	case []interface{}:
+		if len(v) == 0 {
+			return ""
+		}
+		if s, ok := v[0].(string); ok {
+			return s
+		}
+		b := make([]byte, 0, len(v))
+		for _, x := range v {
+			n, ok := x.(float64)
+			if !ok {
+				return ""
+			}
+			b = append(b, byte(n))
+		}
+		return string(b)
+	}
+	return ""
+}
+
+// Functions and data related to journal tests
+
+func testJournalEntries() []journalEntry {
+	now := time.Now()
+	return []journalEntry{
+		{
+			time:       now.Add(-30 * time.Hour),
+			priority:   6,
+			unit:       "sshd.service",
+			identifier: "sshd",
+			message:    "Failed password for root from 203.0.113.9 port 52144 ssh2",
+		},
+		{
+			time:       now.Add(-2 * time.Hour),
+			priority:   6,
+			unit:       "sshd.service",
+			identifier: "sshd",
+			message:    "Failed password for invalid user admin from 198.51.100.7 port 40022 ssh2",
+		},
+		{
+			time:       now.Add(-time.Hour),
+			priority:   6,
+			unit:       "sshd.service",
+			identifier: "sshd",
+			message:    "Accepted publickey for deploy from 192.0.2.10 port 51000 ssh2",
+		},
+		{
+			time:       now.Add(-10 * time.Minute),
+			priority:   3,
+			unit:       "auditd.service",
+			identifier: "auditd",
+			message:    "Audit daemon log file is larger than max size",
+		},
+	}
+}
@@ -0,0 +1,98 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"testing"
+
+	"github.com/mozilla/scribe"
+)
+
+// Used in TestJournalPolicy
+var journalPolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "ssh-failures",
+		"journal": {
+			"unit": "sshd.service",
+			"expression": "Failed password for (?:invalid user )?(\\S+)"
+		}
+	},
+
+	{
+		"object": "ssh-failure-count",
+		"journal": {
+			"unit": "sshd.service",
+			"expression": "Failed password",
+			"since": "48h",
+			"count": true
+		}
+	},
+
+	{
+		"object": "errors",
+		"journal": {
+			"priority": "err",
+			"expression": ".*"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "journal0",
+		"expectedresult": true,
+		"object": "ssh-failures",
+		"exactmatch": {
+			"value": "admin"
+		}
+	},
+
+	{
+		"test": "journal1",
+		"expectedresult": false,
+		"object": "ssh-failures",
+		"exactmatch": {
+			"value": "root"
+		}
+	},
+
+	{
+		"test": "journal2",
+		"expectedresult": true,
+		"object": "ssh-failure-count",
+		"compare": {
+			"type": "int",
+			"operation": "=",
+			"value": "2"
+		}
+	},
+
+	{
+		"test": "journal3",
+		"expectedresult": true,
+		"object": "errors",
+		"regexp": {
+			"value": "^Audit daemon"
+		}
+	}
+	]
+}
+`
+
+func TestJournalPolicy(t *testing.T) {
+	doc := genericTestExec(t, journalPolicyDoc)
+	tr, err := scribe.GetResults(doc, "journal3")
+	if err != nil {
+		t.Fatalf("scribe.GetResults: %v", err)
+	}
+	if len(tr.Results) != 1 || tr.Results[0].Identifier != "auditd" {
+		t.Fatalf("unexpected journal results %+v", tr.Results)
+	}
+}
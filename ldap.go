@@ -0,0 +1,724 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mozilla/scribe/internal/ber"
+)
+
+// LDAP is used to perform tests against entries in an LDAP directory, so
+// identity related policies such as password policies or the membership of
+// administrative groups can be evaluated along with host checks.
+//
+// URL is the directory to connect to, using ldap:// or ldaps:// (LDAP over
+// TLS). If StartTLS is set, an ldap:// connection is upgraded to TLS using
+// the StartTLS operation before anything else is sent. TLS connections use
+// the configuration set with SetTLSOptions().
+//
+// If BindDN is set a simple bind is performed before searching, using the
+// password obtained from the secret named by PasswordSecret; otherwise the
+// search is anonymous. As a simple bind sends the password as is, binding
+// requires ldaps:// or StartTLS unless Insecure is set.
+//
+// The search starts at BaseDN, and Scope is base (only BaseDN), one (the
+// entries directly below BaseDN) or sub (BaseDN and all entries below it,
+// the default). Filter is an RFC 4515 search filter such as
+// (&(objectClass=group)(cn=admins)), and defaults to (objectClass=*).
+// Attributes lists the attributes to return, all attributes are returned if
+// it is not set.
+//
+// A criteria is returned for each value of each attribute in each entry
+// found. The identifier is the DN of the entry and the name of the
+// attribute separated by a colon, for example
+// cn=admins,ou=groups,dc=example,dc=com:member.
+//
+// Timeout is the maximum time the search can take, as a duration such as
+// 10s. The default is 30 seconds, or the timeout set using
+// SetSourceTimeout().
+type LDAP struct {
+	URL            string   `json:"url,omitempty" yaml:"url,omitempty"`
+	StartTLS       bool     `json:"starttls,omitempty" yaml:"starttls,omitempty"`
+	Insecure       bool     `json:"insecure,omitempty" yaml:"insecure,omitempty"`
+	BindDN         string   `json:"binddn,omitempty" yaml:"binddn,omitempty"`
+	PasswordSecret string   `json:"passwordsecret,omitempty" yaml:"passwordsecret,omitempty"`
+	BaseDN         string   `json:"basedn,omitempty" yaml:"basedn,omitempty"`
+	Scope          string   `json:"scope,omitempty" yaml:"scope,omitempty"`
+	Filter         string   `json:"filter,omitempty" yaml:"filter,omitempty"`
+	Attributes     []string `json:"attributes,omitempty" yaml:"attributes,omitempty"`
+	Timeout        string   `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+
+	matches []ldapMatch
+}
+
+type ldapMatch struct {
+	identifier string
+	value      string
+}
+
+// An entry returned by a search.
+type ldapEntry struct {
+	dn         string
+	attributes []ldapAttribute
+}
+
+type ldapAttribute struct {
+	name   string
+	values []string
+}
+
+const defaultLDAPTimeout = 30 * time.Second
+
+// LDAP protocol operation tags.
+const (
+	ldapBindRequest      = 0x60
+	ldapBindResponse     = 0x61
+	ldapUnbindRequest    = 0x42
+	ldapSearchRequest    = 0x63
+	ldapSearchResultItem = 0x64
+	ldapSearchResultDone = 0x65
+	ldapExtendedRequest  = 0x77
+	ldapExtendedResponse = 0x78
+)
+
+// The name of the StartTLS extended operation.
+const ldapStartTLSOID = "1.3.6.1.4.1.1466.20037"
+
+var ldapScopes = map[string]int{"base": 0, "one": 1, "sub": 2}
+
+func (l *LDAP) isChain() bool {
+	return false
+}
+
+func (l *LDAP) fireChains(d *Document) ([]evaluationCriteria, error) {
+	return nil, nil
+}
+
+func (l *LDAP) mergeCriteria(c []evaluationCriteria) {
+}
+
+func (l *LDAP) validate(d *Document) error {
+	if len(l.URL) == 0 {
+		return fmt.Errorf("ldap url must be set")
+	}
+	u, err := url.Parse(l.URL)
+	if err != nil {
+		return fmt.Errorf("ldap url: %v", err)
+	}
+	if u.Scheme != "ldap" && u.Scheme != "ldaps" {
+		return fmt.Errorf("ldap url must use ldap or ldaps")
+	}
+	if u.Scheme == "ldaps" && l.StartTLS {
+		return fmt.Errorf("ldap starttls can not be used with ldaps")
+	}
+	if (l.BindDN == "") != (l.PasswordSecret == "") {
+		return fmt.Errorf("ldap binddn and passwordsecret must be set together")
+	}
+	if l.BindDN != "" && u.Scheme == "ldap" && !l.StartTLS && !l.Insecure {
+		return fmt.Errorf("ldap binddn requires ldaps or starttls unless insecure is set")
+	}
+	if _, ok := ldapScopes[l.scope()]; !ok {
+		return fmt.Errorf("ldap scope must be base, one or sub")
+	}
+	_, err = parseLDAPFilter(l.filter())
+	if err != nil {
+		return fmt.Errorf("ldap filter: %v", err)
+	}
+	if l.Timeout != "" {
+		_, err = time.ParseDuration(l.Timeout)
+		if err != nil {
+			return fmt.Errorf("ldap timeout: %v", err)
+		}
+	}
+	return nil
+}
+
+func (l *LDAP) scope() string {
+	if l.Scope == "" {
+		return "sub"
+	}
+	return l.Scope
+}
+
+func (l *LDAP) filter() string {
+	if l.Filter == "" {
+		return "(objectClass=*)"
+	}
+	return l.Filter
+}
+
+func (l *LDAP) expandVariables(v []Variable) {
+	l.URL = variableExpansion(v, l.URL)
+	l.BindDN = variableExpansion(v, l.BindDN)
+	l.BaseDN = variableExpansion(v, l.BaseDN)
+	l.Filter = variableExpansion(v, l.Filter)
+}
+
+func (l *LDAP) getCriteria() (ret []evaluationCriteria) {
+	for _, x := range l.matches {
+		n := evaluationCriteria{}
+		n.identifier = x.identifier
+		n.testValue = x.value
+		ret = append(ret, n)
+	}
+	return ret
+}
+
+func (l *LDAP) prepare() error {
+	debugPrint("prepare(): searching %v, base \"%v\", filter \"%v\"\n", l.URL, l.BaseDN, l.filter())
+
+	filter, err := parseLDAPFilter(l.filter())
+	if err != nil {
+		return err
+	}
+	var entries []ldapEntry
+	if sRuntime.testHooks {
+		entries = testLDAPSearch(l.BaseDN, ldapScopes[l.scope()], filter)
+	} else {
+		entries, err = l.search(filter)
+		if err != nil {
+			return err
+		}
+	}
+	for _, e := range entries {
+		for _, a := range e.attributes {
+			if !l.wantAttribute(a.name) {
+				continue
+			}
+			for _, v := range a.values {
+				m := ldapMatch{identifier: e.dn + ":" + a.name, value: v}
+				debugPrint("prepare(): %v = \"%v\"\n", m.identifier, m.value)
+				l.matches = append(l.matches, m)
+			}
+		}
+	}
+	return nil
+}
+
+func (l *LDAP) wantAttribute(name string) bool {
+	if len(l.Attributes) == 0 {
+		return true
+	}
+	for _, x := range l.Attributes {
+		if strings.EqualFold(x, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Connect to the directory and perform the search.
+func (l *LDAP) search(filter *ldapFilter) ([]ldapEntry, error) {
+	timeout := sourceTimeout(defaultLDAPTimeout)
+	if l.Timeout != "" {
+		var err error
+		timeout, err = time.ParseDuration(l.Timeout)
+		if err != nil {
+			return nil, err
+		}
+	}
+	u, err := url.Parse(l.URL)
+	if err != nil {
+		return nil, err
+	}
+	host := u.Host
+	if u.Port() == "" {
+		port := "389"
+		if u.Scheme == "ldaps" {
+			port = "636"
+		}
+		host = net.JoinHostPort(u.Hostname(), port)
+	}
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	if u.Scheme == "ldaps" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, ldapTLSConfig(u.Hostname()))
+	} else {
+		conn, err = dialer.Dial("tcp", host)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	rdr := bufio.NewReader(conn)
+	msgid := 0
+	send := func(op []byte) error {
+		msgid++
+		_, err := conn.Write(ber.Encode(ber.Sequence, ber.Int(ber.Integer, msgid), op))
+		return err
+	}
+
+	if l.StartTLS {
+		err = send(ber.Encode(ldapExtendedRequest, ber.String(0x80, ldapStartTLSOID)))
+		if err != nil {
+			return nil, err
+		}
+		op, err := ldapReadResponse(rdr, msgid)
+		if err != nil {
+			return nil, err
+		}
+		if op.Tag != ldapExtendedResponse {
+			return nil, fmt.Errorf("unexpected ldap response 0x%x to starttls", op.Tag)
+		}
+		err = ldapResultError(op)
+		if err != nil {
+			return nil, fmt.Errorf("ldap starttls: %v", err)
+		}
+		if rdr.Buffered() != 0 {
+			return nil, fmt.Errorf("ldap starttls: unexpected data before tls handshake")
+		}
+		tconn := tls.Client(conn, ldapTLSConfig(u.Hostname()))
+		err = tconn.Handshake()
+		if err != nil {
+			return nil, fmt.Errorf("ldap starttls: %v", err)
+		}
+		conn = tconn
+		rdr = bufio.NewReader(conn)
+	}
+	defer send(ber.Encode(ldapUnbindRequest))
+
+	if l.BindDN != "" {
+		pw, err := secretValue(l.PasswordSecret)
+		if err != nil {
+			return nil, err
+		}
+		err = send(ber.Encode(ldapBindRequest, ber.Int(ber.Integer, 3),
+			ber.String(ber.OctetString, l.BindDN), ber.String(0x80, pw)))
+		if err != nil {
+			return nil, err
+		}
+		op, err := ldapReadResponse(rdr, msgid)
+		if err != nil {
+			return nil, err
+		}
+		if op.Tag != ldapBindResponse {
+			return nil, fmt.Errorf("unexpected ldap response 0x%x to bind", op.Tag)
+		}
+		err = ldapResultError(op)
+		if err != nil {
+			return nil, fmt.Errorf("ldap bind: %v", err)
+		}
+	}
+
+	attrs := make([][]byte, 0)
+	for _, x := range l.Attributes {
+		attrs = append(attrs, ber.String(ber.OctetString, x))
+	}
+	err = send(ber.Encode(ldapSearchRequest,
+		ber.String(ber.OctetString, l.BaseDN),
+		ber.Int(ber.Enumerated, ldapScopes[l.scope()]),
+		ber.Int(ber.Enumerated, 0), // Never dereference aliases.
+		ber.Int(ber.Integer, 0),    // No size limit.
+		ber.Int(ber.Integer, int(timeout/time.Second)),
+		ber.Bool(false),
+		filter.encode(),
+		ber.Encode(ber.Sequence, attrs...)))
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]ldapEntry, 0)
+	for {
+		op, err := ldapReadResponse(rdr, msgid)
+		if err != nil {
+			return nil, err
+		}
+		switch op.Tag {
+		case ldapSearchResultItem:
+			e, err := ldapDecodeEntry(op)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, e)
+		case ldapSearchResultDone:
+			err = ldapResultError(op)
+			if err != nil {
+				return nil, fmt.Errorf("ldap search: %v", err)
+			}
+			return ret, nil
+		}
+		// Other responses such as search result references are
+		// ignored.
+	}
+}
+
+// Return the TLS configuration used to connect to host, based on the
+// configuration set with SetTLSOptions().
+func ldapTLSConfig(host string) *tls.Config {
+	ret := &tls.Config{}
+	if sRuntime.tlsClient != nil {
+		ret = sRuntime.tlsClient.Clone()
+	}
+	if ret.ServerName == "" {
+		ret.ServerName = host
+	}
+	return ret
+}
+
+// Read LDAP messages until one with the message ID msgid is found,
+// returning the protocol operation.
+func ldapReadResponse(r *bufio.Reader, msgid int) (ber.Element, error) {
+	for {
+		msg, err := ber.Read(r)
+		if err != nil {
+			return ber.Element{}, err
+		}
+		if msg.Tag != ber.Sequence {
+			return ber.Element{}, fmt.Errorf("invalid ldap message")
+		}
+		els, err := ber.Elements(msg.Content)
+		if err != nil {
+			return ber.Element{}, err
+		}
+		if len(els) < 2 || els[0].Tag != ber.Integer {
+			return ber.Element{}, fmt.Errorf("invalid ldap message")
+		}
+		if els[0].Int() == msgid {
+			return els[1], nil
+		}
+	}
+}
+
+// Return an error if the LDAPResult in op is not success.
+func ldapResultError(op ber.Element) error {
+	els, err := ber.Elements(op.Content)
+	if err != nil {
+		return err
+	}
+	if len(els) < 3 {
+		return fmt.Errorf("invalid ldap result")
+	}
+	code := els[0].Int()
+	if code == 0 {
+		return nil
+	}
+	if len(els[2].Content) > 0 {
+		return fmt.Errorf("result code %v: %v", code, string(els[2].Content))
+	}
+	return fmt.Errorf("result code %v", code)
+}
+
+func ldapDecodeEntry(op ber.Element) (ldapEntry, error) {
+	var ret ldapEntry
+	els, err := ber.Elements(op.Content)
+	if err != nil {
+		return ret, err
+	}
+	if len(els) < 2 {
+		return ret, fmt.Errorf("invalid ldap search result entry")
+	}
+	ret.dn = string(els[0].Content)
+	attrs, err := ber.Elements(els[1].Content)
+	if err != nil {
+		return ret, err
+	}
+	for _, x := range attrs {
+		parts, err := ber.Elements(x.Content)
+		if err != nil || len(parts) < 2 {
+			return ret, fmt.Errorf("invalid ldap attribute in %v", ret.dn)
+		}
+		a := ldapAttribute{name: string(parts[0].Content)}
+		vals, err := ber.Elements(parts[1].Content)
+		if err != nil {
+			return ret, err
+		}
+		for _, v := range vals {
+			a.values = append(a.values, string(v.Content))
+		}
+		ret.attributes = append(ret.attributes, a)
+	}
+	return ret, nil
+}
+
+// A parsed RFC 4515 search filter.
+type ldapFilter struct {
+	op       byte // One of &, |, !, =, ~, >, < or * (presence).
+	children []*ldapFilter
+	attr     string
+	value    string
+	subs     []string // Substring components, if value contained *.
+}
+
+// Parse a search filter. The enclosing parentheses are optional for a
+// single item.
+func parseLDAPFilter(s string) (*ldapFilter, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "(") {
+		s = "(" + s + ")"
+	}
+	f, n, err := parseLDAPFilterAt(s)
+	if err != nil {
+		return nil, err
+	}
+	if n != len(s) {
+		return nil, fmt.Errorf("unexpected %q after filter", s[n:])
+	}
+	return f, nil
+}
+
+func parseLDAPFilterAt(s string) (*ldapFilter, int, error) {
+	if len(s) < 2 || s[0] != '(' {
+		return nil, 0, fmt.Errorf("expected ( at %q", s)
+	}
+	f := &ldapFilter{}
+	switch s[1] {
+	case '&', '|', '!':
+		f.op = s[1]
+		i := 2
+		for i < len(s) && s[i] == '(' {
+			c, n, err := parseLDAPFilterAt(s[i:])
+			if err != nil {
+				return nil, 0, err
+			}
+			f.children = append(f.children, c)
+			i += n
+		}
+		if i >= len(s) || s[i] != ')' {
+			return nil, 0, fmt.Errorf("unterminated filter %q", s)
+		}
+		if len(f.children) == 0 || (f.op == '!' && len(f.children) != 1) {
+			return nil, 0, fmt.Errorf("invalid %c filter", f.op)
+		}
+		return f, i + 1, nil
+	}
+	end := strings.Index(s, ")")
+	if end == -1 {
+		return nil, 0, fmt.Errorf("unterminated filter %q", s)
+	}
+	item := s[1:end]
+	eq := strings.Index(item, "=")
+	if eq < 1 {
+		return nil, 0, fmt.Errorf("invalid filter item %q", item)
+	}
+	f.attr = item[:eq]
+	f.op = '='
+	switch item[eq-1] {
+	case '~', '>', '<':
+		f.op = item[eq-1]
+		f.attr = item[:eq-1]
+	}
+	if f.attr == "" {
+		return nil, 0, fmt.Errorf("invalid filter item %q", item)
+	}
+	raw := item[eq+1:]
+	if f.op == '=' && raw == "*" {
+		f.op = '*'
+		return f, end + 1, nil
+	}
+	if f.op == '=' && strings.Contains(raw, "*") {
+		for _, x := range strings.Split(raw, "*") {
+			v, err := ldapUnescape(x)
+			if err != nil {
+				return nil, 0, err
+			}
+			f.subs = append(f.subs, v)
+		}
+		return f, end + 1, nil
+	}
+	v, err := ldapUnescape(raw)
+	if err != nil {
+		return nil, 0, err
+	}
+	f.value = v
+	return f, end + 1, nil
+}
+
+// Decode the \XX escapes in a filter value.
+func ldapUnescape(s string) (string, error) {
+	if !strings.Contains(s, "\\") {
+		return s, nil
+	}
+	var ret []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			ret = append(ret, s[i])
+			continue
+		}
+		if i+2 >= len(s) {
+			return "", fmt.Errorf("invalid escape in %q", s)
+		}
+		b, err := hex.DecodeString(s[i+1 : i+3])
+		if err != nil {
+			return "", fmt.Errorf("invalid escape in %q", s)
+		}
+		ret = append(ret, b...)
+		i += 2
+	}
+	return string(ret), nil
+}
+
+// Encode the filter for a search request.
+func (f *ldapFilter) encode() []byte {
+	switch f.op {
+	case '&', '|', '!':
+		tags := map[byte]byte{'&': 0xa0, '|': 0xa1, '!': 0xa2}
+		children := make([][]byte, 0)
+		for _, x := range f.children {
+			children = append(children, x.encode())
+		}
+		return ber.Encode(tags[f.op], children...)
+	case '*':
+		return ber.String(0x87, f.attr)
+	}
+	if f.subs != nil {
+		parts := make([][]byte, 0)
+		for i, x := range f.subs {
+			if x == "" {
+				continue
+			}
+			var tag byte = 0x81 // any
+			if i == 0 {
+				tag = 0x80 // initial
+			} else if i == len(f.subs)-1 {
+				tag = 0x82 // final
+			}
+			parts = append(parts, ber.String(tag, x))
+		}
+		return ber.Encode(0xa4, ber.String(ber.OctetString, f.attr), ber.Encode(ber.Sequence, parts...))
+	}
+	tags := map[byte]byte{'=': 0xa3, '>': 0xa5, '<': 0xa6, '~': 0xa8}
+	return ber.Encode(tags[f.op], ber.String(ber.OctetString, f.attr), ber.String(ber.OctetString, f.value))
+}
+
+// Return true if the entry matches the filter. Values are compared ignoring
+// case. This is used to search the test directory.
+func (f *ldapFilter) match(e ldapEntry) bool {
+	switch f.op {
+	case '&':
+		for _, x := range f.children {
+			if !x.match(e) {
+				return false
+			}
+		}
+		return true
+	case '|':
+		for _, x := range f.children {
+			if x.match(e) {
+				return true
+			}
+		}
+		return false
+	case '!':
+		return !f.children[0].match(e)
+	}
+	for _, a := range e.attributes {
+		if !strings.EqualFold(a.name, f.attr) {
+			continue
+		}
+		if f.op == '*' {
+			return true
+		}
+		for _, v := range a.values {
+			if f.matchValue(strings.ToLower(v)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (f *ldapFilter) matchValue(v string) bool {
+	if f.subs != nil {
+		for i, x := range f.subs {
+			x = strings.ToLower(x)
+			switch {
+			case i == 0:
+				if !strings.HasPrefix(v, x) {
+					return false
+				}
+				v = v[len(x):]
+			case i == len(f.subs)-1:
+				return strings.HasSuffix(v, x)
+			default:
+				j := strings.Index(v, x)
+				if j == -1 {
+					return false
+				}
+				v = v[j+len(x):]
+			}
+		}
+		return true
+	}
+	want := strings.ToLower(f.value)
+	switch f.op {
+	case '>':
+		return v >= want
+	case '<':
+		return v <= want
+	}
+	return v == want
+}
+
+var testLDAPTable = []ldapEntry{
+	{"dc=example,dc=com", []ldapAttribute{
+		{"objectClass", []string{"top", "domain"}},
+		{"dc", []string{"example"}},
+	}},
+	{"ou=policies,dc=example,dc=com", []ldapAttribute{
+		{"objectClass", []string{"organizationalUnit"}},
+		{"ou", []string{"policies"}},
+	}},
+	{"cn=default,ou=policies,dc=example,dc=com", []ldapAttribute{
+		{"objectClass", []string{"pwdPolicy", "person"}},
+		{"cn", []string{"default"}},
+		{"pwdMinLength", []string{"8"}},
+		{"pwdMaxAge", []string{"7776000"}},
+		{"pwdLockout", []string{"TRUE"}},
+	}},
+	{"ou=groups,dc=example,dc=com", []ldapAttribute{
+		{"objectClass", []string{"organizationalUnit"}},
+		{"ou", []string{"groups"}},
+	}},
+	{"cn=admins,ou=groups,dc=example,dc=com", []ldapAttribute{
+		{"objectClass", []string{"groupOfNames"}},
+		{"cn", []string{"admins"}},
+		{"member", []string{"uid=alice,ou=people,dc=example,dc=com",
+			"uid=mallory,ou=people,dc=example,dc=com"}},
+	}},
+	{"cn=developers,ou=groups,dc=example,dc=com", []ldapAttribute{
+		{"objectClass", []string{"groupOfNames"}},
+		{"cn", []string{"developers"}},
+		{"member", []string{"uid=bob,ou=people,dc=example,dc=com"}},
+	}},
+}
+
+// Search the test directory.
+func testLDAPSearch(base string, scope int, filter *ldapFilter) []ldapEntry {
+	ret := make([]ldapEntry, 0)
+	base = strings.ToLower(base)
+	for _, x := range testLDAPTable {
+		dn := strings.ToLower(x.dn)
+		switch scope {
+		case 0:
+			if dn != base {
+				continue
+			}
+		case 1:
+			i := strings.Index(dn, ",")
+			if i == -1 || dn[i+1:] != base {
+				continue
+			}
+		default:
+			if dn != base && !strings.HasSuffix(dn, ","+base) {
+				continue
+			}
+		}
+		if filter.match(x) {
+			ret = append(ret, x)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,265 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mozilla/scribe"
+)
+
+// Searches are run against the test directory when test hooks are enabled.
+var ldapPolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "minlength",
+		"ldap": {
+			"url": "ldaps://ldap.example.com",
+			"basedn": "ou=policies,dc=example,dc=com",
+			"filter": "(objectClass=pwdPolicy)",
+			"attributes": [ "pwdMinLength" ]
+		}
+	},
+
+	{
+		"object": "admins",
+		"ldap": {
+			"url": "ldap://ldap.example.com",
+			"basedn": "ou=groups,dc=example,dc=com",
+			"scope": "one",
+			"filter": "(&(objectClass=groupOfNames)(cn=adm*))",
+			"attributes": [ "member" ]
+		}
+	},
+
+	{
+		"object": "groups",
+		"ldap": {
+			"url": "ldap://ldap.example.com",
+			"basedn": "dc=example,dc=com",
+			"filter": "(|(cn=developers)(!(ou=*)))",
+			"attributes": [ "cn" ]
+		}
+	},
+
+	{
+		"object": "base",
+		"ldap": {
+			"url": "ldap://ldap.example.com",
+			"basedn": "DC=example,DC=com",
+			"scope": "base"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "minlength",
+		"object": "minlength",
+		"expectedresult": true,
+		"evr": { "operation": ">", "value": "7" }
+	},
+
+	{
+		"test": "admins",
+		"object": "admins",
+		"expectedresult": false,
+		"absent": { "expression": "^uid=mallory," }
+	}
+	]
+}
+`
+
+func TestLDAPPolicy(t *testing.T) {
+	doc := genericTestExec(t, ldapPolicyDoc)
+	expect := map[string][]string{
+		"minlength": {"cn=default,ou=policies,dc=example,dc=com:pwdMinLength=8"},
+		"admins": {"cn=admins,ou=groups,dc=example,dc=com:member=uid=alice,ou=people,dc=example,dc=com",
+			"cn=admins,ou=groups,dc=example,dc=com:member=uid=mallory,ou=people,dc=example,dc=com"},
+		"groups": {"cn=default,ou=policies,dc=example,dc=com:cn=default",
+			"cn=admins,ou=groups,dc=example,dc=com:cn=admins",
+			"cn=developers,ou=groups,dc=example,dc=com:cn=developers"},
+		"base": {"dc=example,dc=com:objectClass=top", "dc=example,dc=com:objectClass=domain",
+			"dc=example,dc=com:dc=example"},
+	}
+	for name, exp := range expect {
+		c, err := doc.EvaluateObject(name)
+		if err != nil {
+			t.Fatalf("EvaluateObject: %v", err)
+		}
+		got := make([]string, 0)
+		for _, x := range c {
+			got = append(got, x.Identifier+"="+x.Value)
+		}
+		if strings.Join(got, " ") != strings.Join(exp, " ") {
+			t.Fatalf("%v: unexpected criteria %v", name, got)
+		}
+	}
+}
+
+func TestLDAPInvalidFilter(t *testing.T) {
+	docstr := `{"objects": [{"object": "o", "ldap": {"url": "ldap://localhost", ` +
+		`"filter": %q}}]}`
+	for _, f := range []string{"(cn=a", "(&)", "(!(a=1)(b=2))", "(=x)", "(cn=\\zz)"} {
+		_, err := scribe.LoadDocument(strings.NewReader(fmt.Sprintf(docstr, f)))
+		if err == nil {
+			t.Fatalf("filter %q should not have been accepted", f)
+		}
+	}
+}
+
+func TestLDAPTransport(t *testing.T) {
+	docstr := `{"objects": [{"object": "o", "ldap": {"url": %q, %v}}]}`
+	for _, x := range []struct {
+		url  string
+		opts string
+		ok   bool
+	}{
+		{"ldap://localhost", `"binddn": "cn=scribe", "passwordsecret": "pw"`, false},
+		{"ldap://localhost", `"binddn": "cn=scribe", "passwordsecret": "pw", "starttls": true`, true},
+		{"ldap://localhost", `"binddn": "cn=scribe", "passwordsecret": "pw", "insecure": true`, true},
+		{"ldaps://localhost", `"binddn": "cn=scribe", "passwordsecret": "pw"`, true},
+		{"ldaps://localhost", `"starttls": true`, false},
+		{"ldap://localhost", `"scope": "sub"`, true},
+	} {
+		_, err := scribe.LoadDocument(strings.NewReader(fmt.Sprintf(docstr, x.url, x.opts)))
+		if (err == nil) != x.ok {
+			t.Fatalf("%v %v: unexpected result %v", x.url, x.opts, err)
+		}
+	}
+}
+
+// Read a BER encoded LDAP message, returning the tag of the protocol
+// operation.
+func readLDAPMessage(r *bufio.Reader) (byte, error) {
+	read := func() ([]byte, error) {
+		if _, err := r.ReadByte(); err != nil {
+			return nil, err
+		}
+		n, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		l := int(n)
+		if n&0x80 != 0 {
+			l = 0
+			for i := 0; i < int(n&0x7f); i++ {
+				b, err := r.ReadByte()
+				if err != nil {
+					return nil, err
+				}
+				l = l<<8 | int(b)
+			}
+		}
+		buf := make([]byte, l)
+		_, err = io.ReadFull(r, buf)
+		return buf, err
+	}
+	msg, err := read()
+	if err != nil {
+		return 0, err
+	}
+	// Skip the message ID to the protocol operation.
+	return msg[msg[1]+2], nil
+}
+
+func TestLDAPStartTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, cakey := writeCert(t, dir, "ca", nil, nil)
+	writeCert(t, dir, "server", ca, cakey)
+	cert, err := tls.LoadX509KeyPair(filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key"))
+	if err != nil {
+		t.Fatalf("tls.LoadX509KeyPair: %v", err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	defer l.Close()
+	// The server answers StartTLS and then a search with no entries,
+	// reporting the operations seen.
+	ops := make(chan string, 1)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				seen := make([]string, 0)
+				defer func() { ops <- strings.Join(seen, " ") }()
+				tag, err := readLDAPMessage(bufio.NewReader(conn))
+				if err != nil || tag != 0x77 {
+					return
+				}
+				seen = append(seen, "starttls")
+				conn.Write([]byte{0x30, 0x0c, 0x02, 0x01, 0x01, 0x78, 0x07, 0x0a, 0x01, 0x00, 0x04, 0x00, 0x04, 0x00})
+				tconn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}})
+				if tconn.Handshake() != nil {
+					return
+				}
+				seen = append(seen, "handshake")
+				rdr := bufio.NewReader(tconn)
+				tag, err = readLDAPMessage(rdr)
+				if err != nil || tag != 0x63 {
+					return
+				}
+				seen = append(seen, "search")
+				tconn.Write([]byte{0x30, 0x0c, 0x02, 0x01, 0x02, 0x65, 0x07, 0x0a, 0x01, 0x00, 0x04, 0x00, 0x04, 0x00})
+				readLDAPMessage(rdr)
+			}(conn)
+		}
+	}()
+
+	scribe.Bootstrap()
+	scribe.TestHooks(false)
+	defer scribe.TestHooks(true)
+	docstr := fmt.Sprintf(`{"objects": [{"object": "o", "ldap": {"url": "ldap://%v", "starttls": true, `+
+		`"basedn": "dc=example,dc=com"}}]}`, l.Addr())
+	doc, err := scribe.LoadDocument(strings.NewReader(docstr))
+	if err != nil {
+		t.Fatalf("scribe.LoadDocument: %v", err)
+	}
+	// The server certificate is only trusted with the CA set using
+	// SetTLSOptions().
+	_, err = doc.EvaluateObject("o")
+	if err == nil {
+		t.Fatalf("search should have failed without CA")
+	}
+	if seen := <-ops; seen != "starttls" {
+		t.Fatalf("unexpected operations %q", seen)
+	}
+	err = scribe.SetTLSOptions(scribe.TLSOptions{CAFile: filepath.Join(dir, "ca.pem")})
+	if err != nil {
+		t.Fatalf("scribe.SetTLSOptions: %v", err)
+	}
+	defer scribe.SetTLSOptions(scribe.TLSOptions{})
+	doc, err = scribe.LoadDocument(strings.NewReader(docstr))
+	if err != nil {
+		t.Fatalf("scribe.LoadDocument: %v", err)
+	}
+	c, err := doc.EvaluateObject("o")
+	if err != nil {
+		t.Fatalf("EvaluateObject: %v", err)
+	}
+	if len(c) != 0 {
+		t.Fatalf("expected no criteria, got %v", len(c))
+	}
+	if seen := <-ops; seen != "starttls handshake search" {
+		t.Fatalf("unexpected operations %q", seen)
+	}
+}
@@ -0,0 +1,215 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// ResourceLimits describes ceilings on the resources used by the analysis
+// of a single document, so an agent evaluating documents from several teams
+// is protected from a document that reads large parts of the file system.
+// A limit of zero is not enforced.
+//
+// MaxFiles and MaxBytes limit the number of files opened and bytes read by
+// file based sources such as filecontent, configkv and filehash. MaxTime
+// limits the wall time spent preparing objects and evaluating tests.
+//
+// Once a limit is exceeded the analysis degrades rather than aborting.
+// Files can no longer be read, and file system objects being prepared when
+// the limit is exceeded, or prepared after, result in an error describing
+// the limit rather than returning incomplete criteria. If the time limit is exceeded, objects and tests
+// not yet prepared or evaluated also result in an error. The results of
+// tests evaluated before the limit was reached remain available.
+type ResourceLimits struct {
+	MaxFiles int
+	MaxBytes int64
+	MaxTime  time.Duration
+}
+
+// ResourceUsage describes the resources used by the last analysis of a
+// document, as returned by Document.ResourceUsage(). Exceeded describes the
+// limit that was exceeded, if any.
+type ResourceUsage struct {
+	FilesOpened int           `json:"filesopened" yaml:"filesopened"`
+	BytesRead   int64         `json:"bytesread" yaml:"bytesread"`
+	Elapsed     time.Duration `json:"elapsed" yaml:"elapsed"`
+	Exceeded    string        `json:"exceeded,omitempty" yaml:"exceeded,omitempty"`
+}
+
+// The resource usage of a document. Time is only accumulated while the
+// document is active, so documents prepared and evaluated together in a
+// RunSet are accounted separately.
+type resourceUsage struct {
+	sync.Mutex
+	usage    ResourceUsage
+	since    time.Time // When the document became active, zero if not active.
+	timedOut bool      // True if the time limit was exceeded.
+}
+
+var (
+	usageLock   sync.Mutex
+	usageActive *resourceUsage // The usage of the document being analyzed.
+)
+
+// SetResourceLimits sets the resource limits applied to the analysis of
+// each document. Passing a zero ResourceLimits removes all limits.
+func SetResourceLimits(l ResourceLimits) {
+	usageLock.Lock()
+	sRuntime.limits = l
+	usageLock.Unlock()
+}
+
+// ResourceUsage returns the resources used by the last analysis of the
+// document.
+func (d *Document) ResourceUsage() ResourceUsage {
+	if d.usage == nil {
+		return ResourceUsage{}
+	}
+	d.usage.Lock()
+	defer d.usage.Unlock()
+	ret := d.usage.usage
+	if !d.usage.since.IsZero() {
+		ret.Elapsed += time.Since(d.usage.since)
+	}
+	return ret
+}
+
+// Begin accounting resources used to the document. If reset is true, usage
+// from previous analysis of the document is discarded.
+func (d *Document) usageBegin(reset bool) {
+	if d.usage == nil {
+		d.usage = &resourceUsage{}
+	}
+	d.usage.Lock()
+	if reset {
+		d.usage.usage = ResourceUsage{}
+		d.usage.timedOut = false
+	}
+	d.usage.since = time.Now()
+	d.usage.Unlock()
+	usageLock.Lock()
+	usageActive = d.usage
+	usageLock.Unlock()
+}
+
+// Stop accounting resources to the active document.
+func usageEnd() {
+	usageLock.Lock()
+	u := usageActive
+	usageActive = nil
+	usageLock.Unlock()
+	if u == nil {
+		return
+	}
+	u.Lock()
+	u.usage.Elapsed += time.Since(u.since)
+	u.since = time.Time{}
+	u.Unlock()
+}
+
+// Add files and bytes to the usage of the active document, returning an
+// error if a limit has been exceeded.
+func usageAdd(files int, bytes int64) error {
+	u, l := usageCurrent()
+	if u == nil {
+		return nil
+	}
+	u.Lock()
+	defer u.Unlock()
+	if u.usage.Exceeded == "" {
+		u.usage.FilesOpened += files
+		u.usage.BytesRead += bytes
+		switch {
+		case l.MaxFiles > 0 && u.usage.FilesOpened > l.MaxFiles:
+			u.exceed(fmt.Sprintf("more than %v files opened", l.MaxFiles))
+		case l.MaxBytes > 0 && u.usage.BytesRead > l.MaxBytes:
+			u.exceed(fmt.Sprintf("more than %v bytes read", l.MaxBytes))
+		}
+	}
+	u.checkTime(l)
+	if u.usage.Exceeded != "" {
+		return fmt.Errorf("resource limit exceeded: %v", u.usage.Exceeded)
+	}
+	return nil
+}
+
+// Return an error if the time limit has been exceeded by the active
+// document. Objects that do not read files can still be prepared, and
+// tests evaluated, once the file or byte limits have been exceeded.
+func usageDeadline() error {
+	u, l := usageCurrent()
+	if u == nil {
+		return nil
+	}
+	u.Lock()
+	defer u.Unlock()
+	if u.checkTime(l) {
+		return fmt.Errorf("resource limit exceeded: analysis took longer than %v", l.MaxTime)
+	}
+	return nil
+}
+
+// Return an error if a limit has been exceeded by the active document.
+func usageCheck() error {
+	return usageAdd(0, 0)
+}
+
+func usageCurrent() (*resourceUsage, ResourceLimits) {
+	usageLock.Lock()
+	defer usageLock.Unlock()
+	return usageActive, sRuntime.limits
+}
+
+// Return true if the time limit has been exceeded, recording it in the
+// usage.
+func (u *resourceUsage) checkTime(l ResourceLimits) bool {
+	if !u.timedOut && l.MaxTime > 0 && u.usage.Elapsed+time.Since(u.since) > l.MaxTime {
+		u.timedOut = true
+		u.exceed(fmt.Sprintf("analysis took longer than %v", l.MaxTime))
+	}
+	return u.timedOut
+}
+
+func (u *resourceUsage) exceed(reason string) {
+	debugPrint("exceed(): resource limit exceeded, %v\n", reason)
+	if u.usage.Exceeded != "" {
+		u.usage.Exceeded += ", "
+	}
+	u.usage.Exceeded += reason
+}
+
+// A reader accounting the bytes read from a file to the active document.
+type usageReader struct {
+	io.ReadCloser
+}
+
+func (u *usageReader) Read(p []byte) (int, error) {
+	n, err := u.ReadCloser.Read(p)
+	if lerr := usageAdd(0, int64(n)); lerr != nil {
+		return n, lerr
+	}
+	return n, err
+}
+
+// A usageReader for sources reading files at arbitrary offsets, such as
+// when scanning from the end of a file.
+type usageReaderAt struct {
+	io.ReaderAt
+}
+
+func (u usageReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := u.ReaderAt.ReadAt(p, off)
+	if lerr := usageAdd(0, int64(n)); lerr != nil {
+		return n, lerr
+	}
+	return n, err
+}
@@ -0,0 +1,102 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mozilla/scribe"
+)
+
+// Used in TestResourceLimits
+var resourceLimitsDoc = `
+{
+	"objects": [
+	{
+		"object": "files",
+		"filecontent": {
+			"path": "./test/filecontent",
+			"file": "^testfile[0-2]$",
+			"expression": "(.+)"
+		}
+	},
+
+	{
+		"object": "raw",
+		"raw": {
+			"identifiers": [
+			{ "identifier": "a", "value": "b" }
+			]
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "files",
+		"expectedresult": true,
+		"object": "files"
+	},
+
+	{
+		"test": "raw",
+		"expectedresult": true,
+		"object": "raw"
+	}
+	]
+}
+`
+
+func TestResourceLimits(t *testing.T) {
+	defer scribe.SetResourceLimits(scribe.ResourceLimits{})
+
+	doc := genericTestExec(t, resourceLimitsDoc)
+	u := doc.ResourceUsage()
+	if u.FilesOpened != 3 || u.BytesRead != 72 || u.Exceeded != "" || u.Elapsed == 0 {
+		t.Fatalf("unexpected resource usage %+v", u)
+	}
+
+	for _, x := range []struct {
+		limits scribe.ResourceLimits
+		want   string
+		rawok  bool // True if the raw test is evaluated.
+	}{
+		{scribe.ResourceLimits{MaxFiles: 2}, "more than 2 files opened", true},
+		{scribe.ResourceLimits{MaxBytes: 40}, "more than 40 bytes read", true},
+		{scribe.ResourceLimits{MaxTime: time.Nanosecond}, "analysis took longer than 1ns", false},
+	} {
+		scribe.SetResourceLimits(x.limits)
+		doc, err := scribe.LoadDocument(strings.NewReader(resourceLimitsDoc))
+		if err != nil {
+			t.Fatalf("scribe.LoadDocument: %v", err)
+		}
+		err = scribe.AnalyzeDocument(doc)
+		if err != nil {
+			t.Fatalf("scribe.AnalyzeDocument: %v", err)
+		}
+		if u := doc.ResourceUsage(); u.Exceeded != x.want {
+			t.Fatalf("unexpected resource usage %+v", u)
+		}
+		tr, err := scribe.GetResults(&doc, "files")
+		if err != nil {
+			t.Fatalf("scribe.GetResults: %v", err)
+		}
+		if !tr.IsError || !strings.Contains(tr.Error, "resource limit exceeded: "+x.want) {
+			t.Fatalf("unexpected result %+v", tr)
+		}
+		tr, err = scribe.GetResults(&doc, "raw")
+		if err != nil {
+			t.Fatalf("scribe.GetResults: %v", err)
+		}
+		if tr.MasterResult != x.rawok || tr.IsError == x.rawok {
+			t.Fatalf("unexpected result %+v", tr)
+		}
+	}
+}
@@ -0,0 +1,684 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LocatorOptions can be included in filesystem based objects to control how
+// the file system is traversed when candidate files are being located.
+//
+// The path of an object including LocatorOptions can list more than one
+// root to search, separated by commas, for example /root,/home. Each root
+// is searched with the same options, and a file located under more than one
+// root is only included once.
+//
+// The path can also contain the built-in variable ${homedirs}, which
+// searches the home directory of every local user listed in the passwd
+// file, for example ${homedirs}/.ssh. The identifier of each file located
+// this way is prefixed with the name of the user and a colon, for example
+// alice:/home/alice/.netrc.
+//
+// If NoCrossDevice is true, the locator will not descend into directories
+// that reside on a different device than the root path of the object,
+// similar to the -xdev option to find.
+//
+// SkipFSTypes can contain a list of file system types (for example nfs, cifs
+// or fuse) that should not be traversed. A type such as fuse will also match
+// subtypes such as fuse.sshfs.
+//
+// If Archives is true, tar and zip archives (including jar and war files)
+// found during location are also searched for matching files. Matching
+// members are identified using the path to the archive, followed by ! and
+// the path of the member in the archive. ArchiveDepth controls how many
+// levels of nested archives are searched (default 1), and ArchiveMaxSize
+// is the maximum size of an archive that will be searched, and of members
+// read from archives (default 64MB). Reading a member larger than
+// ArchiveMaxSize results in an error rather than truncated content.
+//
+// IgnoreCase and FullMatch modify how the file name expression of the object
+// is applied. If IgnoreCase is true the expression is case insensitive, and
+// if FullMatch is true the expression must match the entire file name rather
+// than any part of it (for example conf will match conf but not
+// resolv.conf.bak).
+//
+// If PathMatch is true, the file name expression is applied to the full path
+// of each candidate file (the object path joined with the path of the file
+// under it) rather than only the file name, for example
+// ^/etc/nginx/(sites-enabled|conf\.d)/.*\.conf$.
+//
+// If Deduplicate is true, files and directories are tracked by device and
+// inode. A directory that has already been traversed under another path (for
+// example a bind mount of another part of the tree) is not traversed again,
+// and a file matched under more than one path (for example a hard link) is
+// only examined once. The identifier reported for such a file lists each
+// known path, separated by a comma. Matching is applied to the path through
+// which a directory was first traversed.
+//
+// NewerThan and OlderThan select files by modification time. Each is either
+// an age relative to the time of analysis, such as 24h or 7d (a duration as
+// accepted by time.ParseDuration, or a number of days followed by d), or an
+// RFC 3339 timestamp. For example a NewerThan of 24h selects files modified
+// in the last day. MinSize and MaxSize select files by size in bytes, for
+// example a MinSize of 1 skips empty placeholder files. For archive members
+// the modification time and size of the archive are used.
+//
+// Owner and Group select files owned by a user or group, given as a name or
+// numeric ID. Prefixing the value with ! selects files not owned by the
+// user or group, for example !root. PermAll selects files with all of the
+// permission bits in the octal mask set, and PermAny files with any of the
+// bits set, similar to the -perm -mode and -perm /mode options to find. For
+// example a PermAny of 0002 selects world-writable files, and 6000 setuid or
+// setgid files. Owner and Group are not supported on Windows, where no files
+// are selected if they are set.
+//
+// If AsOwner is true and analysis is running as root, the content of each
+// located file is read with the privileges of the user owning the file
+// rather than as root. This is useful when reading files in user home
+// directories, both for correctness on NFS exports with root squashing and
+// to avoid reading files a user could otherwise access through symbolic
+// links. AsOwner is only supported on Linux, and is applied by sources that
+// read file content, such as filecontent, hasline, filehash and elf.
+type LocatorOptions struct {
+	NoCrossDevice  bool     `json:"xdev,omitempty" yaml:"xdev,omitempty"`
+	SkipFSTypes    []string `json:"skipfstypes,omitempty" yaml:"skipfstypes,omitempty"`
+	Archives       bool     `json:"archives,omitempty" yaml:"archives,omitempty"`
+	ArchiveDepth   int      `json:"archivedepth,omitempty" yaml:"archivedepth,omitempty"`
+	ArchiveMaxSize int64    `json:"archivemaxsize,omitempty" yaml:"archivemaxsize,omitempty"`
+	IgnoreCase     bool     `json:"icase,omitempty" yaml:"icase,omitempty"`
+	FullMatch      bool     `json:"fullmatch,omitempty" yaml:"fullmatch,omitempty"`
+	PathMatch      bool     `json:"pathmatch,omitempty" yaml:"pathmatch,omitempty"`
+	Deduplicate    bool     `json:"dedup,omitempty" yaml:"dedup,omitempty"`
+	NewerThan      string   `json:"newerthan,omitempty" yaml:"newerthan,omitempty"`
+	OlderThan      string   `json:"olderthan,omitempty" yaml:"olderthan,omitempty"`
+	MinSize        int64    `json:"minsize,omitempty" yaml:"minsize,omitempty"`
+	MaxSize        int64    `json:"maxsize,omitempty" yaml:"maxsize,omitempty"`
+	Owner          string   `json:"owner,omitempty" yaml:"owner,omitempty"`
+	Group          string   `json:"group,omitempty" yaml:"group,omitempty"`
+	PermAll        string   `json:"permall,omitempty" yaml:"permall,omitempty"`
+	PermAny        string   `json:"permany,omitempty" yaml:"permany,omitempty"`
+	AsOwner        bool     `json:"asowner,omitempty" yaml:"asowner,omitempty"`
+}
+
+// locatorSource is implemented by sources that include LocatorOptions.
+type locatorSource interface {
+	validateLocator() error
+}
+
+func (o LocatorOptions) validateLocator() error {
+	if o.MinSize < 0 || o.MaxSize < 0 {
+		return fmt.Errorf("minsize and maxsize must not be negative")
+	}
+	if o.MaxSize != 0 && o.MinSize > o.MaxSize {
+		return fmt.Errorf("minsize must not be greater than maxsize")
+	}
+	for _, x := range []string{o.NewerThan, o.OlderThan} {
+		if x == "" {
+			continue
+		}
+		_, err := fileTimeLimit(x, time.Now())
+		if err != nil {
+			return err
+		}
+	}
+	for _, x := range []string{o.Owner, o.Group} {
+		if x == "!" {
+			return fmt.Errorf("owner and group must name a user or group")
+		}
+	}
+	for _, x := range []string{o.PermAll, o.PermAny} {
+		if x == "" {
+			continue
+		}
+		_, err := parsePermMask(x)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Return the permission mask described by the octal string s.
+func parsePermMask(s string) (uint32, error) {
+	v, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || v > 07777 {
+		return 0, fmt.Errorf("invalid permission mask %q, must be octal such as 0002", s)
+	}
+	return uint32(v), nil
+}
+
+// ownerFilter selects files by the owning user or group ID.
+type ownerFilter struct {
+	id     uint32
+	negate bool
+}
+
+// Return a filter for the owner specification s, looking up the user or
+// group name if required.
+func newOwnerFilter(s string, group bool) (ret ownerFilter, err error) {
+	if strings.HasPrefix(s, "!") {
+		ret.negate = true
+		s = s[1:]
+	}
+	if v, perr := strconv.ParseUint(s, 10, 32); perr == nil {
+		ret.id = uint32(v)
+		return ret, nil
+	}
+	id := ""
+	if group {
+		var g *user.Group
+		g, err = user.LookupGroup(s)
+		if err == nil {
+			id = g.Gid
+		}
+	} else {
+		var u *user.User
+		u, err = user.Lookup(s)
+		if err == nil {
+			id = u.Uid
+		}
+	}
+	if err != nil {
+		return ret, err
+	}
+	v, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return ret, err
+	}
+	ret.id = uint32(v)
+	return ret, nil
+}
+
+func (o ownerFilter) match(id uint32) bool {
+	return (id == o.id) != o.negate
+}
+
+// Returns true if the options contain filters applied to located files.
+func (o LocatorOptions) hasFileFilters() bool {
+	return o.NewerThan != "" || o.OlderThan != "" || o.MinSize != 0 || o.MaxSize != 0 ||
+		o.Owner != "" || o.Group != "" || o.PermAll != "" || o.PermAny != ""
+}
+
+// Return the time described by the file age s, either a timestamp or an age
+// relative to now.
+func fileTimeLimit(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.ParseFloat(strings.TrimSuffix(s, "d"), 64)
+		if err == nil {
+			return now.Add(-time.Duration(days * float64(24*time.Hour))), nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid file age %q, must be a duration or RFC 3339 timestamp", s)
+	}
+	return now.Add(-d), nil
+}
+
+// The filters applied to located files, as described by LocatorOptions.
+type fileFilters struct {
+	newer, older     time.Time
+	minSize          int64
+	maxSize          int64
+	owner, group     *ownerFilter
+	permAll, permAny uint32
+}
+
+// Return the filters described by the options, or an error if an owner or
+// group can not be found.
+func (o LocatorOptions) fileFilters() (ret fileFilters, err error) {
+	now := time.Now()
+	if o.NewerThan != "" {
+		ret.newer, _ = fileTimeLimit(o.NewerThan, now)
+	}
+	if o.OlderThan != "" {
+		ret.older, _ = fileTimeLimit(o.OlderThan, now)
+	}
+	ret.minSize, ret.maxSize = o.MinSize, o.MaxSize
+	if o.Owner != "" {
+		f, err := newOwnerFilter(o.Owner, false)
+		if err != nil {
+			return ret, err
+		}
+		ret.owner = &f
+	}
+	if o.Group != "" {
+		f, err := newOwnerFilter(o.Group, true)
+		if err != nil {
+			return ret, err
+		}
+		ret.group = &f
+	}
+	if o.PermAll != "" {
+		ret.permAll, _ = parsePermMask(o.PermAll)
+	}
+	if o.PermAny != "" {
+		ret.permAny, _ = parsePermMask(o.PermAny)
+	}
+	return ret, nil
+}
+
+// Returns true if the file described by fi satisfies the filters.
+func (f fileFilters) match(fi os.FileInfo) bool {
+	if !f.newer.IsZero() && !fi.ModTime().After(f.newer) {
+		return false
+	}
+	if !f.older.IsZero() && !fi.ModTime().Before(f.older) {
+		return false
+	}
+	if fi.Size() < f.minSize || (f.maxSize != 0 && fi.Size() > f.maxSize) {
+		return false
+	}
+	if f.owner != nil || f.group != nil {
+		uid, gid, ok := fileOwner(fi)
+		if !ok {
+			return false
+		}
+		if f.owner != nil && !f.owner.match(uid) {
+			return false
+		}
+		if f.group != nil && !f.group.match(gid) {
+			return false
+		}
+	}
+	mode := fileModeBits(fi.Mode())
+	if mode&f.permAll != f.permAll {
+		return false
+	}
+	if f.permAny != 0 && mode&f.permAny == 0 {
+		return false
+	}
+	return true
+}
+
+// Remove located files that do not satisfy the file filters.
+func (s *simpleFileLocator) filterFiles() {
+	if !s.opts.hasFileFilters() {
+		return
+	}
+	filters, err := s.opts.fileFilters()
+	if err != nil {
+		debugPrint("filterFiles(): %v, no files selected\n", err)
+		s.matches, s.names, s.ids = s.matches[:0], nil, nil
+		return
+	}
+	n := 0
+	for i, x := range s.matches {
+		p := x
+		if idx := strings.Index(p, archiveSeparator); idx != -1 {
+			p = p[:idx]
+		}
+		fi, err := os.Stat(p)
+		if err != nil || !filters.match(fi) {
+			continue
+		}
+		s.matches[n] = x
+		if i < len(s.names) {
+			s.names[n] = s.names[i]
+			s.ids[n] = s.ids[i]
+		}
+		n++
+	}
+	debugPrint("filterFiles(): %v of %v located files selected\n", n, len(s.matches))
+	s.matches = s.matches[:n]
+	if n < len(s.names) {
+		s.names = s.names[:n]
+		s.ids = s.ids[:n]
+	}
+}
+
+// Return the roots listed in the path of a filesystem based object.
+func locatorRoots(path string) []string {
+	if !strings.Contains(path, ",") {
+		return []string{path}
+	}
+	ret := make([]string, 0)
+	for _, x := range strings.Split(path, ",") {
+		x = strings.TrimSpace(x)
+		if x != "" {
+			ret = append(ret, x)
+		}
+	}
+	return ret
+}
+
+// A locateMatchFunc returns true if the file at path with the file name name
+// matches the locator target. For archive members, path is the identifier of
+// the member and name is the base name of the member.
+type locateMatchFunc func(path string, name string) bool
+
+// Return the file name expression expr modified according to the matching
+// options. A non-capturing group is used so submatch indexes are preserved.
+func (o LocatorOptions) fileExpression(expr string) string {
+	if o.FullMatch {
+		expr = "^(?:" + expr + ")$"
+	}
+	if o.IgnoreCase {
+		expr = "(?i)" + expr
+	}
+	return expr
+}
+
+type mountEntry struct {
+	mountPoint string
+	fsType     string
+}
+
+// The path to the mount table; this is only present on Linux systems, on
+// other platforms file system type restrictions have no effect.
+var mountTablePath = "/proc/self/mounts"
+
+// Unescape octal sequences used in the mount table to represent characters
+// such as spaces in mount point names.
+func mountUnescape(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	var ret []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			v, err := strconv.ParseUint(s[i+1:i+4], 8, 8)
+			if err == nil {
+				ret = append(ret, byte(v))
+				i += 3
+				continue
+			}
+		}
+		ret = append(ret, s[i])
+	}
+	return string(ret)
+}
+
+func loadMountTable() []mountEntry {
+	ret := make([]mountEntry, 0)
+	fd, err := os.Open(mountTablePath)
+	if err != nil {
+		return ret
+	}
+	defer fd.Close()
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		s := strings.Fields(scanner.Text())
+		if len(s) < 3 {
+			continue
+		}
+		ret = append(ret, mountEntry{mountPoint: mountUnescape(s[1]), fsType: s[2]})
+	}
+	return ret
+}
+
+// Return true if the file system type fstype is in the list of types to be
+// skipped.
+func (l *LocatorOptions) skipFSType(fstype string) bool {
+	for _, x := range l.SkipFSTypes {
+		if fstype == x || strings.HasPrefix(fstype, x+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Given a path, return the type of the file system it resides on using the
+// longest matching mount point in the mount table.
+func mountFSType(mounts []mountEntry, path string) string {
+	var (
+		ret    string
+		retlen = -1
+	)
+	p, err := filepath.Abs(path)
+	if err != nil {
+		return ""
+	}
+	for _, x := range mounts {
+		mp := x.mountPoint
+		if p != mp && mp != "/" && !strings.HasPrefix(p, mp+"/") {
+			continue
+		}
+		// Later entries in the mount table take precedence over earlier
+		// entries with the same mount point.
+		if len(mp) >= retlen {
+			ret = x.fsType
+			retlen = len(mp)
+		}
+	}
+	return ret
+}
+
+// Within a preparation pass, the result of enumerating the file system
+// under a given root is shared by all locators using the same root, depth
+// and options. The enumeration is performed once, and each locator then
+// applies its own target to the enumerated files. locateCache is nil if no
+// preparation pass is active. The lock only guards the map; enumerations of
+// different roots run concurrently, and a locator needing an enumeration
+// already in progress waits for it to complete.
+var locateCache map[string]*locateCall
+var locateCacheLock sync.Mutex
+
+// If set, enumerateHook is called with the root of each enumeration before
+// the file system is walked.
+var enumerateHook func(root string)
+
+type locateEntry struct {
+	path string
+	name string
+	id   fileID
+}
+
+type locateResult struct {
+	entries    []locateEntry
+	dirAliases map[string][]string
+}
+
+// An enumeration in the locate cache, done is closed once res is set.
+type locateCall struct {
+	done chan struct{}
+	res  locateResult
+}
+
+func locateCacheBegin() {
+	locateCacheLock.Lock()
+	locateCache = make(map[string]*locateCall)
+	locateCacheLock.Unlock()
+}
+
+func locateCacheEnd() {
+	locateCacheLock.Lock()
+	locateCache = nil
+	locateCacheLock.Unlock()
+}
+
+func locateCacheActive() bool {
+	locateCacheLock.Lock()
+	defer locateCacheLock.Unlock()
+	return locateCache != nil
+}
+
+// Return all files under the locator root, enumerating the file system if
+// no locator in the current pass has done so already.
+func (s *simpleFileLocator) enumerate() locateResult {
+	// Options that only control matching or filtering do not alter the
+	// enumeration.
+	opts := s.opts
+	opts.IgnoreCase = false
+	opts.FullMatch = false
+	opts.PathMatch = false
+	opts.NewerThan, opts.OlderThan = "", ""
+	opts.MinSize, opts.MaxSize = 0, 0
+	opts.Owner, opts.Group = "", ""
+	opts.PermAll, opts.PermAny = "", ""
+	opts.AsOwner = false
+	buf, _ := json.Marshal(opts)
+	key := fmt.Sprintf("%v\x00%v\x00%s", s.root, s.maxDepth, buf)
+	locateCacheLock.Lock()
+	if c, ok := locateCache[key]; ok {
+		locateCacheLock.Unlock()
+		debugPrint("enumerate(): using shared enumeration of %v\n", s.root)
+		<-c.done
+		return c.res
+	}
+	c := &locateCall{done: make(chan struct{})}
+	if locateCache != nil {
+		locateCache[key] = c
+	}
+	locateCacheLock.Unlock()
+	defer close(c.done)
+
+	e := newSimpleFileLocator()
+	e.root = s.root
+	e.maxDepth = s.maxDepth
+	e.opts = s.opts
+	ret := locateResult{entries: make([]locateEntry, 0)}
+	if e.prepareOptions() {
+		if enumerateHook != nil {
+			enumerateHook(e.root)
+		}
+		e.locateInner(func(string, string) bool { return true }, "")
+		for i := range e.matches {
+			ret.entries = append(ret.entries, locateEntry{
+				path: e.matches[i],
+				name: e.names[i],
+				id:   e.ids[i],
+			})
+		}
+		ret.dirAliases = e.dirAliases
+	}
+	c.res = ret
+	return ret
+}
+
+func (s *simpleFileLocator) locateShared(match locateMatchFunc) {
+	res := s.enumerate()
+	for _, x := range res.entries {
+		if match(x.path, x.name) {
+			s.addMatch(x.path, x.name, x.id)
+		}
+	}
+	s.dirAliases = res.dirAliases
+}
+
+// fileID identifies a file by device and inode, valid is false if the
+// identity of the file is not known.
+type fileID struct {
+	dev   uint64
+	ino   uint64
+	valid bool
+}
+
+// Return the identity of the file at path described by directory entry de
+// if deduplication is enabled. Symbolic links are identified by the file
+// they refer to.
+func (s *simpleFileLocator) entryIdentity(path string, de os.DirEntry) fileID {
+	if !s.opts.Deduplicate {
+		return fileID{}
+	}
+	var (
+		fi  os.FileInfo
+		err error
+	)
+	if (de.Type() & os.ModeSymlink) > 0 {
+		fi, err = os.Stat(path)
+	} else {
+		fi, err = de.Info()
+	}
+	if err != nil {
+		return fileID{}
+	}
+	id, _ := fileIdentity(fi)
+	return id
+}
+
+// Returns true if the directory at path has already been traversed under
+// another path, in which case path is recorded as an alias of the directory.
+func (s *simpleFileLocator) seenDirectory(path string, id fileID) bool {
+	if !id.valid {
+		return false
+	}
+	if s.seenDirs == nil {
+		s.seenDirs = make(map[fileID]string)
+		s.dirAliases = make(map[string][]string)
+	}
+	if p, ok := s.seenDirs[id]; ok {
+		debugPrint("locateInner(): %v already traversed as %v\n", path, p)
+		s.dirAliases[p] = append(s.dirAliases[p], path)
+		return true
+	}
+	s.seenDirs[id] = path
+	return false
+}
+
+// Merge matches that refer to the same file, and record the other paths
+// each remaining match is known by, including paths through directories
+// that were not traversed as they had already been seen.
+func (s *simpleFileLocator) deduplicate() {
+	if !s.opts.Deduplicate {
+		return
+	}
+	s.aliases = make(map[string][]string)
+	seen := make(map[fileID]string)
+	matches := make([]string, 0, len(s.matches))
+	names := make([]string, 0, len(s.names))
+	ids := make([]fileID, 0, len(s.ids))
+	for i, x := range s.matches {
+		if s.ids[i].valid {
+			if p, ok := seen[s.ids[i]]; ok {
+				debugPrint("deduplicate(): %v is the same file as %v\n", x, p)
+				s.aliases[p] = append(s.aliases[p], x)
+				continue
+			}
+			seen[s.ids[i]] = x
+		}
+		matches = append(matches, x)
+		names = append(names, s.names[i])
+		ids = append(ids, s.ids[i])
+	}
+	s.matches, s.names, s.ids = matches, names, ids
+
+	for _, x := range s.matches {
+		paths := append([]string{x}, s.aliases[x]...)
+		for _, p := range paths {
+			for dir, alts := range s.dirAliases {
+				rel, err := filepath.Rel(dir, p)
+				if err != nil || strings.HasPrefix(rel, "..") {
+					continue
+				}
+				for _, y := range alts {
+					s.aliases[x] = append(s.aliases[x], filepath.Join(y, rel))
+				}
+			}
+		}
+		sort.Strings(s.aliases[x])
+	}
+}
+
+// Return the identifier to be used for the located file path, which includes
+// any other paths the file is known by, and the user the file belongs to if
+// it was located in a home directory.
+func (s *simpleFileLocator) identifier(path string) string {
+	ret := path
+	if len(s.aliases[path]) != 0 {
+		ret = strings.Join(append([]string{path}, s.aliases[path]...), ", ")
+	}
+	if u, ok := s.users[path]; ok {
+		ret = u + ":" + ret
+	}
+	return ret
+}
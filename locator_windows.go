@@ -0,0 +1,37 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+//go:build windows
+// +build windows
+
+package scribe
+
+import (
+	"os"
+)
+
+// Device identifiers are not available on Windows, so device boundary
+// restrictions have no effect.
+func fileDevice(fi os.FileInfo) (uint64, bool) {
+	return 0, false
+}
+
+// File ownership is not represented by user and group IDs on Windows.
+func fileOwner(fi os.FileInfo) (uint32, uint32, bool) {
+	return 0, 0, false
+}
+
+// File identities are not available from os.FileInfo on Windows, so
+// deduplication has no effect.
+func fileIdentity(fi os.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
+
+// Device special files are not available on Windows.
+func fileRdev(fi os.FileInfo) (uint64, bool) {
+	return 0, false
+}
@@ -8,7 +8,10 @@
 package scribe_test
 
 import (
+	"strings"
 	"testing"
+
+	"github.com/mozilla/scribe"
 )
 
 // Used in testConcatPolicy
@@ -183,3 +186,164 @@ var rawPolicyDoc = `
 func TestRawPolicy(t *testing.T) {
 	genericTestExec(t, rawPolicyDoc)
 }
+
+func TestCoverage(t *testing.T) {
+	doc := genericTestExec(t, importChainPolicyDoc)
+	cov := doc.Coverage()
+	if len(cov.UnusedObjects) != 0 {
+		t.Fatalf("import chain document should have no unused objects: %v", cov.UnusedObjects)
+	}
+	if len(cov.Paths) != 1 || cov.Paths[0] != "./test/import-chain" {
+		t.Fatalf("unexpected coverage paths: %v", cov.Paths)
+	}
+
+	doc = genericTestExec(t, concatPolicyDoc)
+	cov = doc.Coverage()
+	if len(cov.NoEvaluation) != 1 || cov.NoEvaluation[0] != "testfile0-noop" {
+		t.Fatalf("unexpected tests with no evaluation criteria: %v", cov.NoEvaluation)
+	}
+
+	doc = genericTestExec(t, packagePolicyDoc)
+	cov = doc.Coverage()
+	if len(cov.Packages) != 4 {
+		t.Fatalf("unexpected coverage packages: %v", cov.Packages)
+	}
+}
+
+func TestDocumentIndex(t *testing.T) {
+	doc, err := scribe.LoadDocument(strings.NewReader(packagePolicyDoc))
+	if err != nil {
+		t.Fatalf("scribe.LoadDocument: %v", err)
+	}
+	o, err := doc.GetObject("grub-common-package")
+	if err != nil {
+		t.Fatalf("Document.GetObject: %v", err)
+	}
+	if o.Package.Name != "grub-common" {
+		t.Fatalf("unexpected object returned: %v", o.Object)
+	}
+	_, err = doc.GetObject("nonexistent")
+	if err == nil {
+		t.Fatalf("Document.GetObject should fail for unknown object")
+	}
+	tests := doc.TestsReferencingObject("grub-common-package")
+	if len(tests) != 4 || tests[0].TestID != "package2" || tests[3].TestID != "package5" {
+		t.Fatalf("unexpected tests referencing object: %v", tests)
+	}
+	// Tests added after the document is loaded are still found.
+	doc.Tests = append(doc.Tests, scribe.Test{TestID: "added", Object: "grub-common-package"})
+	if _, err = doc.GetTest("added"); err != nil {
+		t.Fatalf("Document.GetTest: %v", err)
+	}
+	if len(doc.TestsReferencingObject("grub-common-package")) != 5 {
+		t.Fatalf("added test not referencing object")
+	}
+}
+
+// Used in TestDescriptionTemplate
+var descriptionTemplateDoc = `
+{
+	"objects": [
+	{
+		"object": "raw",
+		"raw": {
+			"identifiers": [
+			{ "identifier": "/etc/app.conf", "value": "1.0" },
+			{ "identifier": "/etc/other.conf", "value": "2.0" }
+			]
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "version",
+		"object": "raw",
+		"description": "found {{.Identifier}} with value {{.TestValue}}",
+		"remediation": "update{{range .Results}} {{.Identifier}}{{end}}",
+		"owner": "platform",
+		"contact": "platform@example.com",
+		"exactmatch": { "value": "2.0" },
+		"expectedresult": true
+	},
+
+	{
+		"test": "plain",
+		"object": "raw",
+		"description": "no {template} here",
+		"expectedresult": true
+	}
+	]
+}
+`
+
+func TestDescriptionTemplate(t *testing.T) {
+	doc := genericTestExec(t, descriptionTemplateDoc)
+	tr, err := scribe.GetResults(doc, "version")
+	if err != nil {
+		t.Fatalf("scribe.GetResults: %v", err)
+	}
+	if tr.Description != "found /etc/other.conf with value 2.0" {
+		t.Fatalf("unexpected description: %v", tr.Description)
+	}
+	if tr.Remediation != "update /etc/app.conf /etc/other.conf" {
+		t.Fatalf("unexpected remediation: %v", tr.Remediation)
+	}
+	if tr.Owner != "platform" || tr.Contact != "platform@example.com" {
+		t.Fatalf("unexpected owner: %v (%v)", tr.Owner, tr.Contact)
+	}
+	tr, err = scribe.GetResults(doc, "plain")
+	if err != nil {
+		t.Fatalf("scribe.GetResults: %v", err)
+	}
+	if tr.Description != "no {template} here" {
+		t.Fatalf("unexpected description: %v", tr.Description)
+	}
+
+	_, err = scribe.LoadDocument(strings.NewReader(strings.Replace(descriptionTemplateDoc,
+		"{{.TestValue}}", "{{.TestValue", 1)))
+	if err == nil {
+		t.Fatalf("document with invalid description template should not load")
+	}
+}
+
+// Used in TestNormalize, objects b and c are identical to a.
+var normalizePolicyDoc = `
+{
+	"objects": [
+	{ "object": "c", "package": { "name": "openssl" } },
+	{ "object": "a", "package": { "name": "openssl" } },
+	{ "object": "b", "package": { "name": "openssl" } },
+	{ "object": "d", "package": { "name": "libbind" } }
+	],
+
+	"tests": [
+	{ "test": "t3", "object": "d" },
+	{ "test": "t2", "object": "c" },
+	{ "test": "t1", "object": "b" }
+	]
+}
+`
+
+func TestNormalize(t *testing.T) {
+	doc, err := scribe.LoadDocument(strings.NewReader(normalizePolicyDoc))
+	if err != nil {
+		t.Fatalf("scribe.LoadDocument: %v", err)
+	}
+	ndoc, err := doc.Normalize()
+	if err != nil {
+		t.Fatalf("Document.Normalize: %v", err)
+	}
+	if len(ndoc.Objects) != 2 || ndoc.Objects[0].Object != "a" || ndoc.Objects[1].Object != "d" {
+		t.Fatalf("unexpected normalized objects: %+v", ndoc.Objects)
+	}
+	if len(ndoc.Tests) != 3 || ndoc.Tests[0].TestID != "t1" || ndoc.Tests[2].TestID != "t3" {
+		t.Fatalf("unexpected normalized tests")
+	}
+	if ndoc.Tests[0].Object != "a" || ndoc.Tests[1].Object != "a" || ndoc.Tests[2].Object != "d" {
+		t.Fatalf("test references not rewritten")
+	}
+	if len(doc.Objects) != 4 || doc.Tests[1].Object != "c" {
+		t.Fatalf("original document was modified")
+	}
+}
@@ -0,0 +1,96 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// Normalize returns a normalized copy of the document.
+//
+// Objects with identical definitions are merged into a single object, which
+// keeps the lowest sorting name of the merged objects, and references to the
+// merged objects from tests and import chains are rewritten. Variables,
+// objects and tests are then sorted by name, so documents with the same
+// content normalize to the same document regardless of the order they were
+// written in. This is primarily useful for documents that are generated
+// automatically, which often contain many redundant objects.
+func (d *Document) Normalize() (Document, error) {
+	var ret Document
+	// Round trip the document to obtain a copy that does not share any
+	// state with the original.
+	buf, err := json.Marshal(d)
+	if err != nil {
+		return ret, err
+	}
+	err = json.Unmarshal(buf, &ret)
+	if err != nil {
+		return ret, err
+	}
+
+	sort.SliceStable(ret.Objects, func(i, j int) bool {
+		return ret.Objects[i].Object < ret.Objects[j].Object
+	})
+	rename := make(map[string]string)
+	seen := make(map[string]string)
+	objects := make([]Object, 0, len(ret.Objects))
+	for _, x := range ret.Objects {
+		key, err := x.definitionKey()
+		if err != nil {
+			return ret, err
+		}
+		if name, ok := seen[key]; ok {
+			debugPrint("Normalize(): merging object \"%v\" into \"%v\"\n", x.Object, name)
+			rename[x.Object] = name
+			continue
+		}
+		seen[key] = x.Object
+		objects = append(objects, x)
+	}
+	ret.Objects = objects
+
+	for i := range ret.Objects {
+		chain := ret.Objects[i].FileContent.ImportChain
+		for j := range chain {
+			if n, ok := rename[chain[j]]; ok {
+				chain[j] = n
+			}
+		}
+	}
+	for i := range ret.Tests {
+		if n, ok := rename[ret.Tests[i].Object]; ok {
+			ret.Tests[i].Object = n
+		}
+	}
+
+	sort.SliceStable(ret.Variables, func(i, j int) bool {
+		return ret.Variables[i].Key < ret.Variables[j].Key
+	})
+	sort.SliceStable(ret.Tests, func(i, j int) bool {
+		return ret.Tests[i].TestID < ret.Tests[j].TestID
+	})
+	err = ret.Validate()
+	if err != nil {
+		return ret, err
+	}
+	return ret, nil
+}
+
+// Return a key identifying the definition of the object, excluding its name.
+func (o *Object) definitionKey() (string, error) {
+	c := *o
+	c.Object = ""
+	// Examples do not affect evaluation.
+	c.FileContent.Examples = nil
+	buf, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
@@ -0,0 +1,285 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+// Package notify sends scribe run summaries and test failures to webhooks,
+// so compliance failures can be alerted on directly.
+//
+// A Summary is built from the results of a run, and passed to
+// Webhook.Notify(). The webhook can receive a generic JSON document, or a
+// payload compatible with Slack incoming webhooks. Requests that fail due to
+// a network error or a server error are retried with exponential backoff.
+// A Router sends the failures of tests to different webhooks depending on
+// the owner of each test.
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mozilla/scribe"
+)
+
+// Summary describes the outcome of a run.
+type Summary struct {
+	Host          string            `json:"host"`
+	Time          time.Time         `json:"time"`
+	Metadata      map[string]string `json:"metadata,omitempty"`
+	Total         int               `json:"total"`
+	Passed        int               `json:"passed"`
+	Failed        int               `json:"failed"`
+	Waived        int               `json:"waived"`
+	NotApplicable int               `json:"notapplicable,omitempty"`
+	Failures      []Failure         `json:"failures,omitempty"`
+}
+
+// Failure describes a failed test.
+type Failure struct {
+	TestID      string           `json:"testid"`
+	Name        string           `json:"name,omitempty"`
+	Error       string           `json:"error,omitempty"`
+	Identifiers []string         `json:"identifiers,omitempty"` // Identifiers that evaluated to false.
+	Tags        []scribe.TestTag `json:"tags,omitempty"`
+	Owner       string           `json:"owner,omitempty"`
+	Contact     string           `json:"contact,omitempty"`
+}
+
+// NewSummary returns an empty summary for a run on host.
+func NewSummary(host string) Summary {
+	return Summary{Host: host, Time: time.Now().UTC()}
+}
+
+// Add records the result of a test in the summary, failed indicates if the
+// test is considered to have failed (for example if the result does not
+// match the expected result of the test). Waived and not applicable
+// results are not considered failures.
+func (s *Summary) Add(tr scribe.TestResult, failed bool) {
+	s.Total++
+	if s.Metadata == nil && len(tr.Metadata) > 0 {
+		s.Metadata = tr.Metadata
+	}
+	if tr.Waived {
+		s.Waived++
+		return
+	}
+	if tr.NotApplicable {
+		s.NotApplicable++
+		return
+	}
+	if !failed {
+		s.Passed++
+		return
+	}
+	s.Failed++
+	f := Failure{TestID: tr.TestID, Name: tr.TestName, Tags: tr.Tags, Owner: tr.Owner, Contact: tr.Contact}
+	if tr.IsError {
+		f.Error = tr.Error
+	}
+	for _, x := range tr.Results {
+		if !x.Result {
+			f.Identifiers = append(f.Identifiers, x.Identifier)
+		}
+	}
+	s.Failures = append(s.Failures, f)
+}
+
+// Webhook describes a webhook notifications are sent to.
+type Webhook struct {
+	URL string
+
+	// Format is json (the default) to send the Summary or Failure as a
+	// JSON document, or slack to send a Slack compatible message.
+	Format string
+
+	// If PerFailure is true, a request is made for each failed test
+	// rather than a single request with the summary of the run. No
+	// requests are made if there are no failures.
+	PerFailure bool
+
+	Retries int           // The number of times a request is retried (default 3).
+	Backoff time.Duration // The delay before the first retry, doubled for each retry (default 1s).
+
+	Client *http.Client // The client used for requests, scribe.HTTPClient(0) if nil.
+}
+
+const (
+	defaultRetries = 3
+	defaultBackoff = time.Second
+)
+
+// Notify sends the summary to the webhook.
+func (w *Webhook) Notify(s Summary) error {
+	switch w.Format {
+	case "", "json", "slack":
+	default:
+		return fmt.Errorf("webhook format must be json or slack")
+	}
+	if !w.PerFailure {
+		var payload interface{} = s
+		if w.Format == "slack" {
+			payload = slackMessage{Text: slackSummary(s)}
+		}
+		return w.post(payload)
+	}
+	for _, x := range s.Failures {
+		var payload interface{} = struct {
+			Host string `json:"host"`
+			Failure
+		}{s.Host, x}
+		if w.Format == "slack" {
+			payload = slackMessage{Text: slackFailure(s.Host, x)}
+		}
+		err := w.post(payload)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Notifier sends run summaries, implemented by Webhook and Router.
+type Notifier interface {
+	Notify(s Summary) error
+}
+
+// Router sends the failures of tests to the notifier for the owner of
+// each test. Owners maps test owners to notifiers, and Default receives
+// the failures of tests with no owner or with an owner not in Owners.
+//
+// Each notifier receives the summary of the run with only the failures
+// it is responsible for, and Failed set to their number. Owners are only
+// notified of runs in which their tests failed; Default, if set, is
+// notified of every run.
+type Router struct {
+	Owners  map[string]Notifier
+	Default Notifier
+}
+
+// Notify sends the failures in the summary to their owners. Every notifier
+// is attempted, and the first error encountered is returned.
+func (r *Router) Notify(s Summary) error {
+	routed := make(map[string][]Failure)
+	var rest []Failure
+	for _, x := range s.Failures {
+		if _, ok := r.Owners[x.Owner]; ok && x.Owner != "" {
+			routed[x.Owner] = append(routed[x.Owner], x)
+			continue
+		}
+		rest = append(rest, x)
+	}
+	owners := make([]string, 0, len(routed))
+	for k := range routed {
+		owners = append(owners, k)
+	}
+	sort.Strings(owners)
+	var ret error
+	send := func(n Notifier, failures []Failure) {
+		c := s
+		c.Failures = failures
+		c.Failed = len(failures)
+		if err := n.Notify(c); err != nil && ret == nil {
+			ret = err
+		}
+	}
+	for _, x := range owners {
+		send(r.Owners[x], routed[x])
+	}
+	if r.Default != nil {
+		send(r.Default, rest)
+	}
+	return ret
+}
+
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+func slackSummary(s Summary) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "scribe on %v: %v of %v tests failed", s.Host, s.Failed, s.Total)
+	if s.Waived > 0 {
+		fmt.Fprintf(&b, " (%v waived)", s.Waived)
+	}
+	if s.NotApplicable > 0 {
+		fmt.Fprintf(&b, " (%v not applicable)", s.NotApplicable)
+	}
+	for _, x := range s.Failures {
+		fmt.Fprintf(&b, "\n• %v", failureName(x))
+		if x.Owner != "" {
+			fmt.Fprintf(&b, " (owner %v)", x.Owner)
+		}
+	}
+	return b.String()
+}
+
+func slackFailure(host string, f Failure) string {
+	ret := fmt.Sprintf("scribe on %v: test %v failed", host, failureName(f))
+	if f.Owner != "" {
+		ret += fmt.Sprintf("\nowner: %v", f.Owner)
+		if f.Contact != "" {
+			ret += fmt.Sprintf(" (%v)", f.Contact)
+		}
+	}
+	if f.Error != "" {
+		ret += fmt.Sprintf("\nerror: %v", f.Error)
+	}
+	for _, x := range f.Identifiers {
+		ret += fmt.Sprintf("\n• %v", x)
+	}
+	return ret
+}
+
+func failureName(f Failure) string {
+	if f.Name != "" {
+		return fmt.Sprintf("%v (%v)", f.TestID, f.Name)
+	}
+	return f.TestID
+}
+
+// Post the JSON encoding of payload to the webhook, retrying on network
+// errors, server errors and rate limiting.
+func (w *Webhook) post(payload interface{}) error {
+	buf, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	client := w.Client
+	if client == nil {
+		client = scribe.HTTPClient(0)
+	}
+	retries := w.Retries
+	if retries == 0 {
+		retries = defaultRetries
+	}
+	backoff := w.Backoff
+	if backoff == 0 {
+		backoff = defaultBackoff
+	}
+	for i := 0; ; i++ {
+		var retry bool
+		resp, err := client.Post(w.URL, "application/json", bytes.NewReader(buf))
+		if err != nil {
+			retry = true
+		} else {
+			resp.Body.Close()
+			if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+				return nil
+			}
+			err = fmt.Errorf("webhook returned %v", resp.Status)
+			retry = resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		}
+		if !retry || i >= retries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
@@ -0,0 +1,195 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package notify_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mozilla/scribe"
+	"github.com/mozilla/scribe/notify"
+)
+
+var testResults = []scribe.TestResult{
+	{
+		TestID:       "sshd-root-login",
+		TestName:     "root login disabled",
+		Owner:        "platform",
+		Contact:      "platform@example.com",
+		MasterResult: false,
+		Results: []scribe.TestSubResult{
+			{Result: false, Identifier: "/etc/ssh/sshd_config"},
+		},
+	},
+	{
+		TestID:       "auditd",
+		MasterResult: true,
+	},
+	{
+		TestID:  "ntp",
+		IsError: true,
+		Error:   "chronyc not found",
+	},
+	{
+		TestID: "telnet",
+		Waived: true,
+	},
+}
+
+func testSummary() notify.Summary {
+	s := notify.NewSummary("web1")
+	for _, x := range testResults {
+		s.Add(x, x.IsError || !x.MasterResult)
+	}
+	return s
+}
+
+// Start a server that fails the first fail requests with a server error,
+// returning the server and a function returning the bodies of successful
+// requests.
+func testServer(fail int) (*httptest.Server, func() []string) {
+	var (
+		lock   sync.Mutex
+		bodies []string
+		count  int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		count++
+		if count <= fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		buf, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(buf))
+	}))
+	return srv, func() []string {
+		lock.Lock()
+		defer lock.Unlock()
+		return bodies
+	}
+}
+
+func TestSummary(t *testing.T) {
+	s := testSummary()
+	if s.Total != 4 || s.Passed != 1 || s.Failed != 2 || s.Waived != 1 {
+		t.Fatalf("unexpected summary counts: %+v", s)
+	}
+	if s.Failures[0].Identifiers[0] != "/etc/ssh/sshd_config" || s.Failures[1].Error == "" {
+		t.Fatalf("unexpected summary failures: %+v", s.Failures)
+	}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	srv, bodies := testServer(2)
+	defer srv.Close()
+	w := notify.Webhook{URL: srv.URL, Backoff: time.Millisecond}
+	err := w.Notify(testSummary())
+	if err != nil {
+		t.Fatalf("Webhook.Notify: %v", err)
+	}
+	b := bodies()
+	if len(b) != 1 {
+		t.Fatalf("expected one successful request, got %v", len(b))
+	}
+	var s notify.Summary
+	err = json.Unmarshal([]byte(b[0]), &s)
+	if err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if s.Host != "web1" || s.Failed != 2 {
+		t.Fatalf("unexpected summary payload: %v", b[0])
+	}
+
+	srv2, _ := testServer(10)
+	defer srv2.Close()
+	w = notify.Webhook{URL: srv2.URL, Retries: 2, Backoff: time.Millisecond}
+	err = w.Notify(testSummary())
+	if err == nil {
+		t.Fatalf("Webhook.Notify should fail once retries are exhausted")
+	}
+}
+
+func TestWebhookSlackPerFailure(t *testing.T) {
+	srv, bodies := testServer(0)
+	defer srv.Close()
+	w := notify.Webhook{URL: srv.URL, Format: "slack", PerFailure: true}
+	err := w.Notify(testSummary())
+	if err != nil {
+		t.Fatalf("Webhook.Notify: %v", err)
+	}
+	b := bodies()
+	if len(b) != 2 {
+		t.Fatalf("expected a request per failure, got %v", len(b))
+	}
+	var m struct {
+		Text string `json:"text"`
+	}
+	err = json.Unmarshal([]byte(b[0]), &m)
+	if err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if !strings.Contains(m.Text, "sshd-root-login (root login disabled)") ||
+		!strings.Contains(m.Text, "/etc/ssh/sshd_config") {
+		t.Fatalf("unexpected slack message: %v", m.Text)
+	}
+}
+
+func TestRouter(t *testing.T) {
+	platform, platformBodies := testServer(0)
+	defer platform.Close()
+	security, securityBodies := testServer(0)
+	defer security.Close()
+	def, defBodies := testServer(0)
+	defer def.Close()
+	r := notify.Router{
+		Owners: map[string]notify.Notifier{
+			"platform": &notify.Webhook{URL: platform.URL},
+			"security": &notify.Webhook{URL: security.URL},
+		},
+		Default: &notify.Webhook{URL: def.URL},
+	}
+	err := r.Notify(testSummary())
+	if err != nil {
+		t.Fatalf("Router.Notify: %v", err)
+	}
+	if len(securityBodies()) != 0 {
+		t.Fatalf("owner without failures should not be notified")
+	}
+	for _, x := range []struct {
+		bodies []string
+		testid string
+	}{
+		{platformBodies(), "sshd-root-login"},
+		{defBodies(), "ntp"},
+	} {
+		if len(x.bodies) != 1 {
+			t.Fatalf("expected one request for %v, got %v", x.testid, len(x.bodies))
+		}
+		var s notify.Summary
+		err = json.Unmarshal([]byte(x.bodies[0]), &s)
+		if err != nil {
+			t.Fatalf("json.Unmarshal: %v", err)
+		}
+		if s.Total != 4 || s.Failed != 1 || s.Failures[0].TestID != x.testid {
+			t.Fatalf("unexpected routed summary: %v", x.bodies[0])
+		}
+	}
+	var s notify.Summary
+	json.Unmarshal([]byte(platformBodies()[0]), &s)
+	if s.Failures[0].Owner != "platform" || s.Failures[0].Contact != "platform@example.com" {
+		t.Fatalf("owner not included in failure: %+v", s.Failures[0])
+	}
+}
@@ -17,11 +17,38 @@ import (
 // criteria will be compared to.
 type Object struct {
 	Object      string      `json:"object" yaml:"object"`
+	Cost        string      `json:"cost,omitempty" yaml:"cost,omitempty"` // Preparation cost hint.
 	FileContent FileContent `json:"filecontent" yaml:"filecontent"`
 	FileName    FileName    `json:"filename" yaml:"filename"`
 	Package     Pkg         `json:"package" yaml:"package"`
 	Raw         Raw         `json:"raw" yaml:"raw"`
 	HasLine     HasLine     `json:"hasline" yaml:"hasline"`
+	SharedLib   SharedLib   `json:"sharedlib" yaml:"sharedlib"`
+	Restart     Restart     `json:"restart" yaml:"restart"`
+	ELF         ELF         `json:"elf" yaml:"elf"`
+	JAR         JAR         `json:"jar" yaml:"jar"`
+	Container   Container   `json:"container" yaml:"container"`
+	Cloud       Cloud       `json:"cloud" yaml:"cloud"`
+	TimeSync    TimeSync    `json:"timesync" yaml:"timesync"`
+	Bootloader  Bootloader  `json:"bootloader" yaml:"bootloader"`
+	PAM         PAM         `json:"pam" yaml:"pam"`
+	FileStat    FileStat    `json:"filestat" yaml:"filestat"`
+	FileAttr    FileAttr    `json:"fileattr" yaml:"fileattr"`
+	Encryption  Encryption  `json:"encryption" yaml:"encryption"`
+	Firmware    Firmware    `json:"firmware" yaml:"firmware"`
+	Repository  Repository  `json:"repository" yaml:"repository"`
+	WASM        WASM        `json:"wasm" yaml:"wasm"`
+	WinService  WinService  `json:"winservice" yaml:"winservice"`
+	WinTask     WinTask     `json:"wintask" yaml:"wintask"`
+	WinEvent    WinEvent    `json:"winevent" yaml:"winevent"`
+	Journal     Journal     `json:"journal" yaml:"journal"`
+	Plist       Plist       `json:"plist" yaml:"plist"`
+	FileHash    FileHash    `json:"filehash" yaml:"filehash"`
+	ConfigKV    ConfigKV    `json:"configkv" yaml:"configkv"`
+	ConfigQuery ConfigQuery `json:"configquery" yaml:"configquery"`
+	XML         XML         `json:"xml" yaml:"xml"`
+	Database    Database    `json:"database" yaml:"database"`
+	LDAP        LDAP        `json:"ldap" yaml:"ldap"`
 
 	isChain  bool  // True if object is part of an import chain.
 	prepared bool  // True if object has been prepared.
@@ -46,10 +73,20 @@ func (o *Object) validate(d *Document) error {
 	if si == nil {
 		return fmt.Errorf("%v: no valid source interface", o.Object)
 	}
-	err := si.validate(d)
+	err := validateCost(o.Cost)
 	if err != nil {
 		return fmt.Errorf("%v: %v", o.Object, err)
 	}
+	err = si.validate(d)
+	if err != nil {
+		return fmt.Errorf("%v: %v", o.Object, err)
+	}
+	if l, ok := si.(locatorSource); ok {
+		err = l.validateLocator()
+		if err != nil {
+			return fmt.Errorf("%v: %v", o.Object, err)
+		}
+	}
 	return nil
 }
 
@@ -68,6 +105,58 @@ func (o *Object) getSourceInterface() genericSource {
 		return &o.Raw
 	} else if o.HasLine.Path != "" {
 		return &o.HasLine
+	} else if o.SharedLib.Library != "" {
+		return &o.SharedLib
+	} else if o.Restart.Check != "" {
+		return &o.Restart
+	} else if o.ELF.Path != "" {
+		return &o.ELF
+	} else if o.JAR.Path != "" {
+		return &o.JAR
+	} else if o.Container.Property != "" {
+		return &o.Container
+	} else if o.Cloud.Field != "" {
+		return &o.Cloud
+	} else if o.TimeSync.Field != "" {
+		return &o.TimeSync
+	} else if o.Bootloader.Loader != "" {
+		return &o.Bootloader
+	} else if o.PAM.Service != "" {
+		return &o.PAM
+	} else if o.FileStat.Path != "" {
+		return &o.FileStat
+	} else if o.FileAttr.Path != "" {
+		return &o.FileAttr
+	} else if o.Encryption.Property != "" {
+		return &o.Encryption
+	} else if o.Firmware.Property != "" {
+		return &o.Firmware
+	} else if o.Repository.Property != "" {
+		return &o.Repository
+	} else if o.WASM.Module != "" {
+		return &o.WASM
+	} else if o.WinService.Property != "" {
+		return &o.WinService
+	} else if o.WinTask.Property != "" {
+		return &o.WinTask
+	} else if o.WinEvent.Channel != "" {
+		return &o.WinEvent
+	} else if o.Journal.Expression != "" {
+		return &o.Journal
+	} else if o.Plist.Path != "" {
+		return &o.Plist
+	} else if o.FileHash.Path != "" {
+		return &o.FileHash
+	} else if o.ConfigKV.Path != "" {
+		return &o.ConfigKV
+	} else if o.ConfigQuery.Path != "" {
+		return &o.ConfigQuery
+	} else if o.XML.Path != "" {
+		return &o.XML
+	} else if o.Database.Driver != "" {
+		return &o.Database
+	} else if o.LDAP.URL != "" {
+		return &o.LDAP
 	}
 	return nil
 }
@@ -111,11 +200,32 @@ func (o *Object) prepare(d *Document) error {
 		o.err = fmt.Errorf("object has no valid interface")
 		return o.err
 	}
+	if evidenceReplaying() != nil {
+		if name := o.sourceName(); !evidenceSources[name] {
+			o.err = fmt.Errorf("source %v can not be evaluated from evidence", name)
+			return o.err
+		}
+	}
+	err := usageDeadline()
+	if err != nil {
+		o.err = err
+		return err
+	}
 	p.expandVariables(d.Variables)
-	err := p.prepare()
+	err = p.prepare()
 	if err != nil {
 		o.err = err
 		return err
 	}
+	// Sources skip files they can not read, so file system sources that
+	// were refused files once a resource limit was exceeded would return
+	// incomplete criteria.
+	if _, ok := p.(locatorSource); ok {
+		err = usageCheck()
+		if err != nil {
+			o.err = err
+			return err
+		}
+	}
 	return nil
 }
@@ -0,0 +1,65 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package output
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+
+	"github.com/mozilla/scribe"
+	"github.com/mozilla/scribe/collector"
+)
+
+// The collector sink submits the results of a run to a scribe collector
+// once the run finishes. The configuration is the base URL of the
+// collector, and the agent token is read from SCRIBE_COLLECTOR_TOKEN. The
+// token may be omitted for collectors using HTTPS if the agent
+// authenticates with the client certificate set with
+// scribe.SetTLSOptions().
+
+const collectorTokenEnv = "SCRIBE_COLLECTOR_TOKEN"
+
+func init() {
+	Register("collector", newCollectorSink)
+}
+
+type collectorSink struct {
+	client collector.Client
+	sub    collector.Submission
+}
+
+func newCollectorSink(w io.Writer, config string) (Sink, error) {
+	u, err := url.Parse(config)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("collector sink configuration must be the URL of the collector")
+	}
+	token := os.Getenv(collectorTokenEnv)
+	if token == "" && u.Scheme != "https" {
+		return nil, fmt.Errorf("collector sink token is not set in %v", collectorTokenEnv)
+	}
+	return &collectorSink{client: collector.Client{URL: config, Token: token}}, nil
+}
+
+func (c *collectorSink) Start(info RunInfo) error {
+	c.sub = collector.Submission{Host: info.Host, Document: info.Document, Time: info.Time}
+	return nil
+}
+
+func (c *collectorSink) WriteResult(tr scribe.TestResult) error {
+	c.sub.Results = append(c.sub.Results, tr)
+	return nil
+}
+
+func (c *collectorSink) Finish() error {
+	return c.client.Submit(c.sub)
+}
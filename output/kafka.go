@@ -0,0 +1,433 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package output
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/mozilla/scribe"
+)
+
+// The kafka sink publishes each test result as a JSON message to a Kafka
+// topic, using the host name as the message key so all results for a host
+// are written to the same partition. The configuration is the topic and
+// a comma separated list of bootstrap brokers, in the form
+// host:port[,host:port]/topic.
+//
+// Results are published in a single batch when the run finishes, and the
+// sink waits for the partition leader to acknowledge the batch. Only
+// plaintext connections without authentication are supported.
+
+const (
+	kafkaAPIProduce  = 0
+	kafkaAPIMetadata = 3
+
+	kafkaClientID = "scribe"
+	kafkaTimeout  = 30 * time.Second
+
+	// The maximum size of a response that will be read.
+	kafkaMaxResponse = 16 * 1024 * 1024
+)
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+func init() {
+	Register("kafka", newKafkaSink)
+}
+
+type kafkaSink struct {
+	brokers []string
+	topic   string
+	key     []byte
+	values  [][]byte
+	corrid  int32
+}
+
+func newKafkaSink(w io.Writer, config string) (Sink, error) {
+	i := strings.LastIndex(config, "/")
+	if i == -1 || i == len(config)-1 {
+		return nil, fmt.Errorf("kafka sink configuration must be host:port[,host:port]/topic")
+	}
+	ret := &kafkaSink{topic: config[i+1:]}
+	for _, x := range strings.Split(config[:i], ",") {
+		x = strings.TrimSpace(x)
+		if x == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(x); err != nil {
+			return nil, fmt.Errorf("kafka broker %v: %v", x, err)
+		}
+		ret.brokers = append(ret.brokers, x)
+	}
+	if len(ret.brokers) == 0 {
+		return nil, fmt.Errorf("kafka sink requires at least one broker")
+	}
+	return ret, nil
+}
+
+func (k *kafkaSink) Start(info RunInfo) error {
+	k.key = []byte(info.Host)
+	return nil
+}
+
+func (k *kafkaSink) WriteResult(tr scribe.TestResult) error {
+	k.values = append(k.values, []byte(tr.JSON()))
+	return nil
+}
+
+func (k *kafkaSink) Finish() error {
+	if len(k.values) == 0 {
+		return nil
+	}
+	var (
+		md  kafkaMetadata
+		err error
+	)
+	for _, x := range k.brokers {
+		md, err = k.metadata(x)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("kafka metadata: %v", err)
+	}
+	if len(md.partitions) == 0 {
+		return fmt.Errorf("kafka topic %v has no partitions", k.topic)
+	}
+	partition := kafkaPartition(k.key, len(md.partitions))
+	leader, ok := md.brokers[md.partitions[partition]]
+	if !ok {
+		return fmt.Errorf("kafka topic %v partition %v has no leader", k.topic, partition)
+	}
+	err = k.produce(leader, int32(partition))
+	if err != nil {
+		return fmt.Errorf("kafka produce: %v", err)
+	}
+	return nil
+}
+
+type kafkaMetadata struct {
+	brokers    map[int32]string // Broker addresses indexed by node ID.
+	partitions map[int]int32    // Partition leaders indexed by partition.
+}
+
+// Send a request to addr and return the response body following the
+// correlation ID.
+func (k *kafkaSink) roundTrip(addr string, api int16, version int16, body []byte) ([]byte, error) {
+	c, err := net.DialTimeout("tcp", addr, kafkaTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(kafkaTimeout))
+	k.corrid++
+	var e kafkaEncoder
+	e.int16(api)
+	e.int16(version)
+	e.int32(k.corrid)
+	e.string(kafkaClientID)
+	e.buf.Write(body)
+	var req kafkaEncoder
+	req.bytes(e.buf.Bytes())
+	_, err = c.Write(req.buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(c)
+	var n int32
+	err = binary.Read(r, binary.BigEndian, &n)
+	if err != nil {
+		return nil, err
+	}
+	if n < 4 || n > kafkaMaxResponse {
+		return nil, fmt.Errorf("invalid response length %v", n)
+	}
+	resp := make([]byte, n)
+	_, err = io.ReadFull(r, resp)
+	if err != nil {
+		return nil, err
+	}
+	if int32(binary.BigEndian.Uint32(resp)) != k.corrid {
+		return nil, fmt.Errorf("response correlation id mismatch")
+	}
+	return resp[4:], nil
+}
+
+// Request topic metadata (version 1) from the broker at addr.
+func (k *kafkaSink) metadata(addr string) (kafkaMetadata, error) {
+	ret := kafkaMetadata{brokers: make(map[int32]string), partitions: make(map[int]int32)}
+	var e kafkaEncoder
+	e.int32(1)
+	e.string(k.topic)
+	resp, err := k.roundTrip(addr, kafkaAPIMetadata, 1, e.buf.Bytes())
+	if err != nil {
+		return ret, err
+	}
+	d := kafkaDecoder{buf: resp}
+	nb := d.int32()
+	for i := int32(0); i < nb && d.err == nil; i++ {
+		id := d.int32()
+		host := d.string()
+		port := d.int32()
+		d.string() // rack
+		ret.brokers[id] = net.JoinHostPort(host, fmt.Sprint(port))
+	}
+	d.int32() // controller
+	nt := d.int32()
+	for i := int32(0); i < nt && d.err == nil; i++ {
+		ec := d.int16()
+		name := d.string()
+		d.int8() // internal
+		if ec != 0 {
+			return ret, fmt.Errorf("topic %v: error code %v", name, ec)
+		}
+		np := d.int32()
+		for j := int32(0); j < np && d.err == nil; j++ {
+			d.int16() // partition error
+			idx := d.int32()
+			leader := d.int32()
+			d.int32s() // replicas
+			d.int32s() // isr
+			if name == k.topic {
+				ret.partitions[int(idx)] = leader
+			}
+		}
+	}
+	if d.err != nil {
+		return ret, d.err
+	}
+	return ret, nil
+}
+
+// Send the results to partition on the leader at addr using a version 3
+// produce request, waiting for the leader to acknowledge the write.
+func (k *kafkaSink) produce(addr string, partition int32) error {
+	batch := kafkaRecordBatch(k.key, k.values, time.Now())
+	var e kafkaEncoder
+	e.int16(-1) // transactional id
+	e.int16(1)  // acks
+	e.int32(int32(kafkaTimeout / time.Millisecond))
+	e.int32(1)
+	e.string(k.topic)
+	e.int32(1)
+	e.int32(partition)
+	e.bytes(batch)
+	resp, err := k.roundTrip(addr, kafkaAPIProduce, 3, e.buf.Bytes())
+	if err != nil {
+		return err
+	}
+	d := kafkaDecoder{buf: resp}
+	nt := d.int32()
+	for i := int32(0); i < nt && d.err == nil; i++ {
+		d.string()
+		np := d.int32()
+		for j := int32(0); j < np && d.err == nil; j++ {
+			idx := d.int32()
+			ec := d.int16()
+			d.int64() // base offset
+			d.int64() // log append time
+			if ec != 0 && d.err == nil {
+				return fmt.Errorf("partition %v: error code %v", idx, ec)
+			}
+		}
+	}
+	return d.err
+}
+
+// Encode values as a version 2 record batch, each record using key.
+func kafkaRecordBatch(key []byte, values [][]byte, ts time.Time) []byte {
+	var records kafkaEncoder
+	for i, x := range values {
+		var r kafkaEncoder
+		r.int8(0)   // attributes
+		r.varint(0) // timestamp delta
+		r.varint(i) // offset delta
+		r.varint(len(key))
+		r.buf.Write(key)
+		r.varint(len(x))
+		r.buf.Write(x)
+		r.varint(0) // headers
+		records.varint(r.buf.Len())
+		records.buf.Write(r.buf.Bytes())
+	}
+	ms := ts.UnixNano() / int64(time.Millisecond)
+	var body kafkaEncoder
+	body.int16(0) // attributes
+	body.int32(int32(len(values) - 1))
+	body.int64(ms)
+	body.int64(ms)
+	body.int64(-1) // producer id
+	body.int16(-1) // producer epoch
+	body.int32(-1) // base sequence
+	body.int32(int32(len(values)))
+	body.buf.Write(records.buf.Bytes())
+
+	var e kafkaEncoder
+	e.int64(0) // base offset
+	e.int32(int32(4 + 1 + 4 + body.buf.Len()))
+	e.int32(-1) // partition leader epoch
+	e.int8(2)   // magic
+	e.int32(int32(crc32.Checksum(body.buf.Bytes(), crc32c)))
+	e.buf.Write(body.buf.Bytes())
+	return e.buf.Bytes()
+}
+
+// Select the partition for key in the same way as the default partitioner
+// of the Java client, so results for a host are written to the same
+// partition regardless of the client that produced them.
+func kafkaPartition(key []byte, n int) int {
+	return int(kafkaMurmur2(key)&0x7fffffff) % n
+}
+
+func kafkaMurmur2(data []byte) int32 {
+	const (
+		seed = 0x9747b28c
+		m    = 0x5bd1e995
+		r    = 24
+	)
+	h := uint32(seed) ^ uint32(len(data))
+	n := len(data) / 4
+	for i := 0; i < n; i++ {
+		k := binary.LittleEndian.Uint32(data[i*4:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+	tail := data[n*4:]
+	switch len(tail) {
+	case 3:
+		h ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(tail[0])
+		h *= m
+	}
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return int32(h)
+}
+
+type kafkaEncoder struct {
+	buf bytes.Buffer
+}
+
+func (e *kafkaEncoder) int8(v int8) {
+	e.buf.WriteByte(byte(v))
+}
+
+func (e *kafkaEncoder) int16(v int16) {
+	binary.Write(&e.buf, binary.BigEndian, v)
+}
+
+func (e *kafkaEncoder) int32(v int32) {
+	binary.Write(&e.buf, binary.BigEndian, v)
+}
+
+func (e *kafkaEncoder) int64(v int64) {
+	binary.Write(&e.buf, binary.BigEndian, v)
+}
+
+func (e *kafkaEncoder) string(s string) {
+	e.int16(int16(len(s)))
+	e.buf.WriteString(s)
+}
+
+func (e *kafkaEncoder) bytes(b []byte) {
+	e.int32(int32(len(b)))
+	e.buf.Write(b)
+}
+
+// Write a zig-zag encoded variable length integer.
+func (e *kafkaEncoder) varint(v int) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(b[:], int64(v))
+	e.buf.Write(b[:n])
+}
+
+// Decode a response, recording the first error encountered so fields can
+// be read without checking each one.
+type kafkaDecoder struct {
+	buf []byte
+	err error
+}
+
+func (d *kafkaDecoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.buf) < n {
+		d.err = fmt.Errorf("truncated response")
+		return nil
+	}
+	ret := d.buf[:n]
+	d.buf = d.buf[n:]
+	return ret
+}
+
+func (d *kafkaDecoder) int8() int8 {
+	b := d.next(1)
+	if b == nil {
+		return 0
+	}
+	return int8(b[0])
+}
+
+func (d *kafkaDecoder) int16() int16 {
+	b := d.next(2)
+	if b == nil {
+		return 0
+	}
+	return int16(binary.BigEndian.Uint16(b))
+}
+
+func (d *kafkaDecoder) int32() int32 {
+	b := d.next(4)
+	if b == nil {
+		return 0
+	}
+	return int32(binary.BigEndian.Uint32(b))
+}
+
+func (d *kafkaDecoder) int64() int64 {
+	b := d.next(8)
+	if b == nil {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(b))
+}
+
+// Read a nullable string, returning an empty string for null.
+func (d *kafkaDecoder) string() string {
+	n := d.int16()
+	if n == -1 {
+		return ""
+	}
+	return string(d.next(int(n)))
+}
+
+func (d *kafkaDecoder) int32s() {
+	n := d.int32()
+	for i := int32(0); i < n && d.err == nil; i++ {
+		d.int32()
+	}
+}
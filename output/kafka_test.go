@@ -0,0 +1,181 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package output_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/mozilla/scribe/output"
+)
+
+type kafkaRecord struct {
+	topic     string
+	partition int32
+	key       string
+	value     string
+}
+
+// A fake broker answering metadata and produce requests, sending the
+// records of produce requests to recv.
+func fakeKafkaBroker(t *testing.T, l net.Listener, recv chan kafkaRecord) {
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	portn, _ := strconv.Atoi(port)
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		var n int32
+		binary.Read(c, binary.BigEndian, &n)
+		req := make([]byte, n)
+		io.ReadFull(c, req)
+		api := binary.BigEndian.Uint16(req)
+		corrid := req[4:8]
+		cidlen := int(binary.BigEndian.Uint16(req[8:]))
+		body := bytes.NewReader(req[10+cidlen:])
+
+		var resp bytes.Buffer
+		resp.Write(corrid)
+		switch api {
+		case 3:
+			binary.Write(&resp, binary.BigEndian, int32(1))
+			binary.Write(&resp, binary.BigEndian, int32(7))
+			writeString(&resp, host)
+			binary.Write(&resp, binary.BigEndian, int32(portn))
+			binary.Write(&resp, binary.BigEndian, int16(-1))
+			binary.Write(&resp, binary.BigEndian, int32(7))
+			binary.Write(&resp, binary.BigEndian, int32(1))
+			binary.Write(&resp, binary.BigEndian, int16(0))
+			writeString(&resp, "compliance")
+			resp.WriteByte(0)
+			binary.Write(&resp, binary.BigEndian, int32(2))
+			for i := int32(0); i < 2; i++ {
+				binary.Write(&resp, binary.BigEndian, int16(0))
+				binary.Write(&resp, binary.BigEndian, i)
+				binary.Write(&resp, binary.BigEndian, int32(7))
+				binary.Write(&resp, binary.BigEndian, int32(0))
+				binary.Write(&resp, binary.BigEndian, int32(0))
+			}
+		case 0:
+			var (
+				tid, acks int16
+				timeout   int32
+				nt, np    int32
+				partition int32
+				size      int32
+			)
+			binary.Read(body, binary.BigEndian, &tid)
+			binary.Read(body, binary.BigEndian, &acks)
+			binary.Read(body, binary.BigEndian, &timeout)
+			binary.Read(body, binary.BigEndian, &nt)
+			topic := readString(body)
+			binary.Read(body, binary.BigEndian, &np)
+			binary.Read(body, binary.BigEndian, &partition)
+			binary.Read(body, binary.BigEndian, &size)
+			batch := make([]byte, size)
+			io.ReadFull(body, batch)
+			crc := binary.BigEndian.Uint32(batch[17:])
+			if crc != crc32.Checksum(batch[21:], crc32.MakeTable(crc32.Castagnoli)) {
+				t.Errorf("record batch crc mismatch")
+			}
+			nrec := binary.BigEndian.Uint32(batch[57:])
+			records := bytes.NewReader(batch[61:])
+			for i := uint32(0); i < nrec; i++ {
+				binary.ReadVarint(records) // length
+				records.ReadByte()         // attributes
+				binary.ReadVarint(records) // timestamp delta
+				binary.ReadVarint(records) // offset delta
+				kl, _ := binary.ReadVarint(records)
+				key := make([]byte, kl)
+				io.ReadFull(records, key)
+				vl, _ := binary.ReadVarint(records)
+				value := make([]byte, vl)
+				io.ReadFull(records, value)
+				binary.ReadVarint(records) // headers
+				recv <- kafkaRecord{topic, partition, string(key), string(value)}
+			}
+			binary.Write(&resp, binary.BigEndian, int32(1))
+			writeString(&resp, topic)
+			binary.Write(&resp, binary.BigEndian, int32(1))
+			binary.Write(&resp, binary.BigEndian, partition)
+			binary.Write(&resp, binary.BigEndian, int16(0))
+			binary.Write(&resp, binary.BigEndian, int64(0))
+			binary.Write(&resp, binary.BigEndian, int64(-1))
+			binary.Write(&resp, binary.BigEndian, int32(0))
+		}
+		binary.Write(c, binary.BigEndian, int32(resp.Len()))
+		c.Write(resp.Bytes())
+		c.Close()
+	}
+}
+
+func writeString(w *bytes.Buffer, s string) {
+	binary.Write(w, binary.BigEndian, int16(len(s)))
+	w.WriteString(s)
+}
+
+func readString(r io.Reader) string {
+	var n int16
+	binary.Read(r, binary.BigEndian, &n)
+	buf := make([]byte, n)
+	io.ReadFull(r, buf)
+	return string(buf)
+}
+
+func TestKafkaSink(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	defer l.Close()
+	recv := make(chan kafkaRecord, len(testResults))
+	go fakeKafkaBroker(t, l, recv)
+
+	s, err := output.New("kafka", nil, l.Addr().String()+"/compliance")
+	if err != nil {
+		t.Fatalf("output.New: %v", err)
+	}
+	s.Start(output.RunInfo{Document: "policy.json", Host: "host1"})
+	for _, x := range testResults {
+		s.WriteResult(x)
+	}
+	err = s.Finish()
+	if err != nil {
+		t.Fatalf("Finish: %v", err)
+	}
+	close(recv)
+	n := 0
+	for x := range recv {
+		if x.topic != "compliance" || x.key != "host1" {
+			t.Fatalf("unexpected record %+v", x)
+		}
+		// The Java client default partitioner places host1 in partition 1
+		// of 2.
+		if x.partition != 1 {
+			t.Fatalf("record published to partition %v", x.partition)
+		}
+		if !bytes.HasPrefix([]byte(x.value), []byte(`{"testid":"`+testResults[n].TestID+`"`)) {
+			t.Fatalf("unexpected record value %v", x.value)
+		}
+		n++
+	}
+	if n != len(testResults) {
+		t.Fatalf("broker received %v records, expected %v", n, len(testResults))
+	}
+
+	_, err = output.New("kafka", nil, "localhost:9092")
+	if err == nil {
+		t.Fatalf("kafka sink without topic should fail")
+	}
+}
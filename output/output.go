@@ -0,0 +1,194 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+// Package output writes scribe test results to pluggable output sinks.
+//
+// A Sink receives the results of a run: Start is called once before any
+// results, WriteResult once for each test result, and Finish once after
+// the last result. Sinks are created by name using New(), and exporters for
+// other systems can be added using Register() without changing scribe
+// itself.
+//
+// The built-in sinks write to the io.Writer passed to New():
+//
+// text: the human readable form of each result
+//
+// lines: one line per result and sub-result, suitable for grep
+//
+// json: one JSON document per result
+//
+// html, markdown: a report rendered once all results are written, the
+// configuration string is the tag key used to group report sections
+package output
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mozilla/scribe"
+	"github.com/mozilla/scribe/report"
+)
+
+// RunInfo describes the run results are written for.
+type RunInfo struct {
+	Document string    // The path of the document evaluated.
+	Host     string    // The host the document was evaluated on.
+	Time     time.Time // The time the run started.
+}
+
+// Sink receives the results of a run.
+type Sink interface {
+	Start(info RunInfo) error
+	WriteResult(tr scribe.TestResult) error
+	Finish() error
+}
+
+// Factory creates a sink. w is where the sink should write output if it
+// writes to a stream, and config is a sink specific configuration string,
+// which may be empty.
+type Factory func(w io.Writer, config string) (Sink, error)
+
+var (
+	factories    = make(map[string]Factory)
+	factoryMutex sync.Mutex
+)
+
+func init() {
+	Register("text", func(w io.Writer, config string) (Sink, error) {
+		return &streamSink{w: w, format: func(tr scribe.TestResult) []string {
+			return []string{tr.String()}
+		}}, nil
+	})
+	Register("lines", func(w io.Writer, config string) (Sink, error) {
+		return &streamSink{w: w, format: func(tr scribe.TestResult) []string {
+			return tr.SingleLineResults()
+		}}, nil
+	})
+	Register("json", func(w io.Writer, config string) (Sink, error) {
+		return &streamSink{w: w, format: func(tr scribe.TestResult) []string {
+			return []string{tr.JSON()}
+		}}, nil
+	})
+	Register("html", func(w io.Writer, config string) (Sink, error) {
+		return &reportSink{w: w, render: report.HTML, group: config}, nil
+	})
+	Register("markdown", func(w io.Writer, config string) (Sink, error) {
+		return &reportSink{w: w, render: report.Markdown, group: config}, nil
+	})
+}
+
+// Register makes a sink available to New() using name. Registering a sink
+// with the name of an existing sink replaces it.
+func Register(name string, f Factory) {
+	factoryMutex.Lock()
+	defer factoryMutex.Unlock()
+	factories[name] = f
+}
+
+// Names returns the names of the registered sinks in sorted order.
+func Names() []string {
+	factoryMutex.Lock()
+	defer factoryMutex.Unlock()
+	ret := make([]string, 0, len(factories))
+	for k := range factories {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// New creates the sink registered as name.
+func New(name string, w io.Writer, config string) (Sink, error) {
+	factoryMutex.Lock()
+	f, ok := factories[name]
+	factoryMutex.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown output sink \"%v\"", name)
+	}
+	return f(w, config)
+}
+
+// Multi returns a sink that writes results to each of sinks. Each call is
+// made on every sink, and the first error encountered is returned.
+func Multi(sinks ...Sink) Sink {
+	return multiSink(sinks)
+}
+
+type multiSink []Sink
+
+func (m multiSink) each(f func(Sink) error) error {
+	var ret error
+	for _, x := range m {
+		err := f(x)
+		if err != nil && ret == nil {
+			ret = err
+		}
+	}
+	return ret
+}
+
+func (m multiSink) Start(info RunInfo) error {
+	return m.each(func(s Sink) error { return s.Start(info) })
+}
+
+func (m multiSink) WriteResult(tr scribe.TestResult) error {
+	return m.each(func(s Sink) error { return s.WriteResult(tr) })
+}
+
+func (m multiSink) Finish() error {
+	return m.each(func(s Sink) error { return s.Finish() })
+}
+
+// A sink writing each result as it is received.
+type streamSink struct {
+	w      io.Writer
+	format func(scribe.TestResult) []string
+}
+
+func (s *streamSink) Start(info RunInfo) error {
+	return nil
+}
+
+func (s *streamSink) WriteResult(tr scribe.TestResult) error {
+	for _, x := range s.format(tr) {
+		_, err := fmt.Fprintf(s.w, "%v\n", x)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *streamSink) Finish() error {
+	return nil
+}
+
+// A sink collecting results and rendering a report when finished.
+type reportSink struct {
+	w       io.Writer
+	render  func(io.Writer, []scribe.TestResult, report.Options) error
+	group   string
+	title   string
+	results []scribe.TestResult
+}
+
+func (s *reportSink) Start(info RunInfo) error {
+	s.title = info.Document
+	return nil
+}
+
+func (s *reportSink) WriteResult(tr scribe.TestResult) error {
+	s.results = append(s.results, tr)
+	return nil
+}
+
+func (s *reportSink) Finish() error {
+	return s.render(s.w, s.results, report.Options{Title: s.title, GroupTag: s.group})
+}
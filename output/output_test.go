@@ -0,0 +1,130 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package output_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/mozilla/scribe"
+	"github.com/mozilla/scribe/output"
+)
+
+var testResults = []scribe.TestResult{
+	{
+		TestID:       "sshd-root",
+		MasterResult: false,
+		Tags:         []scribe.TestTag{{Key: "section", Value: "ssh"}},
+		Results: []scribe.TestSubResult{
+			{Result: false, Identifier: "/etc/ssh/sshd_config"},
+		},
+	},
+	{
+		TestID:       "pkg-openssl",
+		MasterResult: true,
+		Results: []scribe.TestSubResult{
+			{Result: true, Identifier: "openssl"},
+		},
+	},
+}
+
+func runSink(t *testing.T, name string, config string) string {
+	var buf bytes.Buffer
+	s, err := output.New(name, &buf, config)
+	if err != nil {
+		t.Fatalf("output.New: %v", err)
+	}
+	err = s.Start(output.RunInfo{Document: "policy.json", Host: "web01"})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	for _, x := range testResults {
+		err = s.WriteResult(x)
+		if err != nil {
+			t.Fatalf("WriteResult: %v", err)
+		}
+	}
+	err = s.Finish()
+	if err != nil {
+		t.Fatalf("Finish: %v", err)
+	}
+	return buf.String()
+}
+
+func TestBuiltinSinks(t *testing.T) {
+	out := runSink(t, "json", "")
+	if strings.Count(out, "\n") != 2 || !strings.HasPrefix(out, `{"testid":"sshd-root"`) {
+		t.Fatalf("unexpected json output %q", out)
+	}
+	out = runSink(t, "lines", "")
+	if !strings.Contains(out, `sub [false] name:"sshd-root" id:"sshd-root" identifier:"/etc/ssh/sshd_config"`) {
+		t.Fatalf("unexpected lines output %q", out)
+	}
+	out = runSink(t, "text", "")
+	if !strings.Contains(out, `result for "pkg-openssl"`) {
+		t.Fatalf("unexpected text output %q", out)
+	}
+	out = runSink(t, "markdown", "section")
+	if !strings.Contains(out, "policy.json") || !strings.Contains(out, "ssh") {
+		t.Fatalf("unexpected markdown output %q", out)
+	}
+	_, err := output.New("missing", &bytes.Buffer{}, "")
+	if err == nil {
+		t.Fatalf("output.New should fail for unknown sink")
+	}
+}
+
+type countSink struct {
+	started, results, finished int
+}
+
+func (c *countSink) Start(info output.RunInfo) error {
+	c.started++
+	return nil
+}
+
+func (c *countSink) WriteResult(tr scribe.TestResult) error {
+	c.results++
+	return nil
+}
+
+func (c *countSink) Finish() error {
+	c.finished++
+	return nil
+}
+
+func TestRegisterSink(t *testing.T) {
+	c := &countSink{}
+	output.Register("count", func(w io.Writer, config string) (output.Sink, error) {
+		return c, nil
+	})
+	found := false
+	for _, x := range output.Names() {
+		if x == "count" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("registered sink not in %v", output.Names())
+	}
+	runSink(t, "count", "")
+	if c.started != 1 || c.results != 2 || c.finished != 1 {
+		t.Fatalf("unexpected sink calls %+v", c)
+	}
+
+	c2 := &countSink{}
+	m := output.Multi(c, c2)
+	m.Start(output.RunInfo{})
+	m.WriteResult(testResults[0])
+	m.Finish()
+	if c.results != 3 || c2.started != 1 || c2.results != 1 || c2.finished != 1 {
+		t.Fatalf("unexpected multi sink calls %+v %+v", c, c2)
+	}
+}
@@ -0,0 +1,281 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package output
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mozilla/scribe"
+	"github.com/mozilla/scribe/report"
+)
+
+// The upload sink stores the results of a run in an object storage bucket
+// once the run finishes, as two objects: the results as JSON, one result
+// per line, and a rendered report. The configuration is a URL in the form
+// s3://bucket/key or gs://bucket/key, where key is a template for the
+// object keys and can contain the following placeholders:
+//
+// {date}: the date the run started, as 2006-01-02
+//
+// {time}: the time the run started, as 20060102T150405Z
+//
+// {host}: the host name
+//
+// {document}: the base name of the document without the extension
+//
+// The extension .json is added to the key for the results, and .html or
+// .md for the report. The query parameters report (html, markdown or none,
+// html by default) and group (the report group tag) control the report.
+//
+// Requests are signed using AWS signature version 4. For s3 the
+// credentials are read from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// optionally AWS_SESSION_TOKEN, and the region from AWS_REGION (us-east-1
+// by default); AWS_ENDPOINT_URL can be set to use an S3 compatible
+// service. For gs the HMAC key for the service account is read from
+// GCS_HMAC_KEY_ID and GCS_HMAC_SECRET.
+
+const uploadTimeout = 60 * time.Second
+
+func init() {
+	Register("upload", newUploadSink)
+}
+
+type uploadSink struct {
+	bucket   string
+	template string
+	report   string
+	group    string
+
+	endpoint  string // The service URL, the bucket is added as a path element.
+	region    string
+	keyID     string
+	secret    string
+	token     string
+	virtualHS bool // Address the bucket using a virtual host name.
+
+	info    RunInfo
+	results []scribe.TestResult
+}
+
+func newUploadSink(w io.Writer, config string) (Sink, error) {
+	u, err := url.Parse(config)
+	if err != nil {
+		return nil, err
+	}
+	ret := &uploadSink{
+		bucket:   u.Host,
+		template: strings.TrimPrefix(u.Path, "/"),
+		report:   "html",
+		group:    u.Query().Get("group"),
+	}
+	if ret.bucket == "" || ret.template == "" {
+		return nil, fmt.Errorf("upload sink configuration must be s3://bucket/key or gs://bucket/key")
+	}
+	if r := u.Query().Get("report"); r != "" {
+		if r != "html" && r != "markdown" && r != "none" {
+			return nil, fmt.Errorf("upload sink report must be html, markdown or none")
+		}
+		ret.report = r
+	}
+	switch u.Scheme {
+	case "s3":
+		ret.keyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		ret.secret = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		ret.token = os.Getenv("AWS_SESSION_TOKEN")
+		ret.region = os.Getenv("AWS_REGION")
+		if ret.region == "" {
+			ret.region = "us-east-1"
+		}
+		ret.endpoint = os.Getenv("AWS_ENDPOINT_URL")
+		if ret.endpoint == "" {
+			ret.endpoint = fmt.Sprintf("https://s3.%v.amazonaws.com", ret.region)
+			ret.virtualHS = !strings.Contains(ret.bucket, ".")
+		}
+	case "gs":
+		ret.keyID = os.Getenv("GCS_HMAC_KEY_ID")
+		ret.secret = os.Getenv("GCS_HMAC_SECRET")
+		ret.region = "auto"
+		ret.endpoint = "https://storage.googleapis.com"
+	default:
+		return nil, fmt.Errorf("upload sink scheme must be s3 or gs")
+	}
+	if ret.keyID == "" || ret.secret == "" {
+		return nil, fmt.Errorf("upload sink credentials for %v are not set", u.Scheme)
+	}
+	return ret, nil
+}
+
+func (u *uploadSink) Start(info RunInfo) error {
+	u.info = info
+	return nil
+}
+
+func (u *uploadSink) WriteResult(tr scribe.TestResult) error {
+	u.results = append(u.results, tr)
+	return nil
+}
+
+func (u *uploadSink) Finish() error {
+	key := u.key()
+	var buf bytes.Buffer
+	for _, x := range u.results {
+		fmt.Fprintf(&buf, "%v\n", x.JSON())
+	}
+	err := u.put(key+".json", "application/json", buf.Bytes())
+	if err != nil {
+		return err
+	}
+	if u.report == "none" {
+		return nil
+	}
+	buf.Reset()
+	opts := report.Options{Title: u.info.Document, GroupTag: u.group}
+	if u.report == "html" {
+		err = report.HTML(&buf, u.results, opts)
+		if err == nil {
+			err = u.put(key+".html", "text/html; charset=utf-8", buf.Bytes())
+		}
+	} else {
+		err = report.Markdown(&buf, u.results, opts)
+		if err == nil {
+			err = u.put(key+".md", "text/markdown; charset=utf-8", buf.Bytes())
+		}
+	}
+	return err
+}
+
+// Expand the placeholders in the key template.
+func (u *uploadSink) key() string {
+	t := u.info.Time.UTC()
+	if u.info.Time.IsZero() {
+		t = time.Now().UTC()
+	}
+	doc := path.Base(strings.Replace(u.info.Document, "\\", "/", -1))
+	doc = strings.TrimSuffix(doc, path.Ext(doc))
+	host := u.info.Host
+	if host == "" {
+		host = "unknown"
+	}
+	r := strings.NewReplacer(
+		"{date}", t.Format("2006-01-02"),
+		"{time}", t.Format("20060102T150405Z"),
+		"{host}", host,
+		"{document}", doc,
+	)
+	return r.Replace(u.template)
+}
+
+// Store buf as the object key.
+func (u *uploadSink) put(key string, ctype string, buf []byte) error {
+	ep, err := url.Parse(u.endpoint)
+	if err != nil {
+		return fmt.Errorf("upload endpoint: %v", err)
+	}
+	objpath := "/" + u.bucket + "/" + key
+	if u.virtualHS {
+		ep.Host = u.bucket + "." + ep.Host
+		objpath = "/" + key
+	}
+	ep.Path = strings.TrimSuffix(ep.Path, "/") + objpath
+	ep.RawPath = awsEscapePath(ep.Path)
+	req, err := http.NewRequest("PUT", ep.String(), bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", ctype)
+	u.sign(req, buf, time.Now().UTC())
+	client := http.Client{Timeout: uploadTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("uploading %v: %v", key, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("uploading %v: %v %v", key, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// Sign req using AWS signature version 4.
+func (u *uploadSink) sign(req *http.Request, payload []byte, now time.Time) {
+	amzdate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	phash := sha256.Sum256(payload)
+	req.Header.Set("X-Amz-Date", amzdate)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(phash[:]))
+	if u.token != "" {
+		req.Header.Set("X-Amz-Security-Token", u.token)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canon bytes.Buffer
+	canon.WriteString(req.Method + "\n")
+	canon.WriteString(awsEscapePath(req.URL.Path) + "\n")
+	canon.WriteString(req.URL.RawQuery + "\n")
+	for _, x := range names {
+		canon.WriteString(x + ":" + headers[x] + "\n")
+	}
+	signed := strings.Join(names, ";")
+	canon.WriteString("\n" + signed + "\n")
+	canon.WriteString(hex.EncodeToString(phash[:]))
+
+	scope := date + "/" + u.region + "/s3/aws4_request"
+	chash := sha256.Sum256(canon.Bytes())
+	tosign := "AWS4-HMAC-SHA256\n" + amzdate + "\n" + scope + "\n" + hex.EncodeToString(chash[:])
+	k := hmacSHA256([]byte("AWS4"+u.secret), date)
+	k = hmacSHA256(k, u.region)
+	k = hmacSHA256(k, "s3")
+	k = hmacSHA256(k, "aws4_request")
+	sig := hex.EncodeToString(hmacSHA256(k, tosign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%v/%v, SignedHeaders=%v, Signature=%v",
+		u.keyID, scope, signed, sig))
+}
+
+// Escape p as required by signature version 4, where every byte other than
+// the unreserved characters and the path separator is percent encoded.
+func awsEscapePath(p string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			buf.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&buf, "%%%02X", c)
+	}
+	return buf.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,79 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package output_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mozilla/scribe/output"
+)
+
+func TestUploadSink(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		objects = make(map[string]string)
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if r.Method != "PUT" || !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDTEST/") ||
+			!strings.Contains(auth, "/us-west-2/s3/aws4_request") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		objects[r.URL.Path] = string(body)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	os.Setenv("AWS_ACCESS_KEY_ID", "AKIDTEST")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	os.Setenv("AWS_REGION", "us-west-2")
+	os.Setenv("AWS_ENDPOINT_URL", srv.URL)
+	defer func() {
+		os.Unsetenv("AWS_ACCESS_KEY_ID")
+		os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+		os.Unsetenv("AWS_REGION")
+		os.Unsetenv("AWS_ENDPOINT_URL")
+	}()
+
+	s, err := output.New("upload", nil, "s3://scans/{date}/{host}/{document}?report=markdown")
+	if err != nil {
+		t.Fatalf("output.New: %v", err)
+	}
+	start := time.Date(2024, 3, 9, 12, 0, 0, 0, time.UTC)
+	s.Start(output.RunInfo{Document: "/etc/scribe/policy.json", Host: "web01", Time: start})
+	for _, x := range testResults {
+		s.WriteResult(x)
+	}
+	err = s.Finish()
+	if err != nil {
+		t.Fatalf("Finish: %v", err)
+	}
+	res, ok := objects["/scans/2024-03-09/web01/policy.json"]
+	if !ok || strings.Count(res, "\n") != len(testResults) {
+		t.Fatalf("results not uploaded as expected: %v", objects)
+	}
+	rep, ok := objects["/scans/2024-03-09/web01/policy.md"]
+	if !ok || !strings.HasPrefix(rep, "# /etc/scribe/policy.json") {
+		t.Fatalf("report not uploaded as expected: %v", objects)
+	}
+
+	_, err = output.New("upload", nil, "ftp://scans/{host}")
+	if err == nil {
+		t.Fatalf("upload sink with unsupported scheme should fail")
+	}
+}
@@ -36,6 +36,7 @@ type Pkg struct {
 	Name         string `json:"name,omitempty" yaml:"name,omitempty"`
 	CollectMatch string `json:"collectmatch,omitempty" yaml:"collectmatch,omitempty"`
 	OnlyNewest   bool   `json:"onlynewest,omitempty" yaml:"onlynewest,omitempty"`
+	collectRe    compiledRegexp
 	pkgInfo      []packageInfo
 }
 
@@ -53,7 +54,7 @@ func (p *Pkg) validate(d *Document) error {
 		return fmt.Errorf("package must specify name")
 	}
 	if len(p.CollectMatch) > 0 {
-		_, err := regexp.Compile(p.CollectMatch)
+		_, err := p.collectRe.compile(p.CollectMatch)
 		if err != nil {
 			return err
 		}
@@ -101,7 +102,18 @@ func newestPackage(r pkgmgrResult) (ret packageInfo, err error) {
 func (p *Pkg) prepare() error {
 	debugPrint("prepare(): preparing information for package \"%v\"\n", p.Name)
 	p.pkgInfo = make([]packageInfo, 0)
-	ret := getPackage(p.Name, p.CollectMatch)
+	var collect *regexp.Regexp
+	if len(p.CollectMatch) > 0 {
+		var err error
+		collect, err = p.collectRe.compile(p.CollectMatch)
+		if err != nil {
+			return err
+		}
+	}
+	ret := getPackage(p.Name, collect)
+	if ret.err != nil {
+		return ret.err
+	}
 	if p.OnlyNewest && len(ret.results) > 0 {
 		pir, err := newestPackage(ret)
 		if err != nil {
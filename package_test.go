@@ -8,8 +8,15 @@
 package scribe_test
 
 import (
-	"github.com/mozilla/scribe"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+
+	"github.com/mozilla/scribe"
 )
 
 // Used in TestPackagePolicy
@@ -152,3 +159,144 @@ func TestPackageQuery(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+// Used in TestInventoryPackageQuery
+var inventoryPolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "openssl-package",
+		"package": {
+			"name": "openssl"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "inventory0",
+		"expectedresult": true,
+		"object": "openssl-package",
+		"evr": {
+			"operation": "<",
+			"value": "1.1.1k"
+		}
+	}
+	]
+}
+`
+
+// Used in TestInventoryPackageQuery, the inventory service is unavailable.
+var inventoryErrorPolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "openssl-package",
+		"package": {
+			"name": "openssl"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "inventory0",
+		"expecterror": true,
+		"object": "openssl-package"
+	}
+	]
+}
+`
+
+func TestInventoryPackageQuery(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/hosts/web1/packages" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode([]scribe.PackageInfo{
+			{Name: "openssl", Version: "1.1.1f", Type: "dpkg", Arch: "amd64"},
+			{Name: "bash", Version: "5.0-6", Type: "dpkg", Arch: "amd64"},
+		})
+	}))
+	defer srv.Close()
+	defer scribe.InstallPackageQuery(nil)
+
+	scribe.InstallPackageQuery(scribe.InventoryPackageQuery(srv.URL+"/hosts/{host}/packages", "web1"))
+	genericTestExec(t, inventoryPolicyDoc)
+	pinfo := scribe.QueryPackages()
+	if len(pinfo) != 2 || pinfo[1].Name != "bash" {
+		t.Fatalf("unexpected packages from inventory: %+v", pinfo)
+	}
+
+	scribe.InstallPackageQuery(scribe.InventoryPackageQuery(srv.URL+"/hosts/{host}/packages", "db1"))
+	genericTestExec(t, inventoryErrorPolicyDoc)
+}
+
+// Used in TestPackageReset
+var packageResetDoc = `
+{
+	"objects": [
+	{
+		"object": "openssl-package",
+		"package": {
+			"name": "openssl"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "openssl-version",
+		"object": "openssl-package",
+		"exactmatch": {
+			"value": "%v"
+		}
+	}
+	]
+}
+`
+
+// Each analysis collects a new package inventory, so a later analysis does
+// not return packages from an earlier one.
+func TestPackageReset(t *testing.T) {
+	scribe.Bootstrap()
+	scribe.TestHooks(true)
+	defer scribe.InstallPackageQuery(nil)
+	for _, v := range []string{"1.0.2k", "1.1.1f", "3.0.2"} {
+		version := v
+		scribe.InstallPackageQuery(func() ([]scribe.PackageInfo, error) {
+			return []scribe.PackageInfo{{Name: "openssl", Version: version, Type: "rpm", Arch: "x86_64"}}, nil
+		})
+		doc, err := scribe.LoadDocument(strings.NewReader(fmt.Sprintf(packageResetDoc, version)))
+		if err != nil {
+			t.Fatalf("scribe.LoadDocument: %v", err)
+		}
+		// Query the inventory while the document is analyzed, which
+		// must see either the previous or the new inventory.
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for _, x := range scribe.QueryPackages() {
+					if x.Name != "openssl" {
+						t.Errorf("unexpected package %v", x.Name)
+					}
+				}
+			}()
+		}
+		err = scribe.AnalyzeDocument(doc)
+		wg.Wait()
+		if err != nil {
+			t.Fatalf("scribe.AnalyzeDocument: %v", err)
+		}
+		tr, err := scribe.GetResults(&doc, "openssl-version")
+		if err != nil {
+			t.Fatalf("scribe.GetResults: %v", err)
+		}
+		if tr.IsError || !tr.MasterResult {
+			t.Fatalf("expected openssl %v to be found: %v", version, tr.String())
+		}
+	}
+}
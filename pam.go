@@ -0,0 +1,252 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// PAM is used to perform tests against the PAM configuration for a service.
+//
+// The configuration for Service is read from Path (by default /etc/pam.d),
+// with include and substack directives resolved so the complete stack for
+// the service is evaluated. Type can be set to only return entries of a
+// given management group (auth, account, password or session), and Module
+// can be set to a regular expression that is matched against the module
+// name (for example ^pam_pwquality\.so$).
+//
+// A criteria is returned for each matching entry with the service as the
+// identifier, and the normalized entry (type, control, module and arguments
+// separated by single spaces) as the value. If Argument is set, the value
+// is instead the value of the named module argument (for example the value
+// of minlen), and entries without the argument are not returned.
+type PAM struct {
+	Service  string `json:"service,omitempty" yaml:"service,omitempty"`
+	Path     string `json:"path,omitempty" yaml:"path,omitempty"`
+	Type     string `json:"type,omitempty" yaml:"type,omitempty"`
+	Module   string `json:"module,omitempty" yaml:"module,omitempty"`
+	Argument string `json:"argument,omitempty" yaml:"argument,omitempty"`
+
+	matches []pamMatch
+}
+
+type pamMatch struct {
+	service string
+	value   string
+}
+
+type pamEntry struct {
+	pamType string
+	control string
+	module  string
+	args    []string
+}
+
+func (p *pamEntry) String() string {
+	s := []string{p.pamType, p.control, p.module}
+	return strings.Join(append(s, p.args...), " ")
+}
+
+const defaultPAMPath = "/etc/pam.d"
+
+// The maximum depth include directives will be followed to.
+const pamMaxIncludeDepth = 10
+
+func (p *PAM) isChain() bool {
+	return false
+}
+
+func (p *PAM) fireChains(d *Document) ([]evaluationCriteria, error) {
+	return nil, nil
+}
+
+func (p *PAM) mergeCriteria(c []evaluationCriteria) {
+}
+
+func (p *PAM) validate(d *Document) error {
+	if len(p.Service) == 0 {
+		return fmt.Errorf("pam service must be set")
+	}
+	switch p.Type {
+	case "", "auth", "account", "password", "session":
+	default:
+		return fmt.Errorf("pam type must be auth, account, password or session")
+	}
+	if len(p.Module) > 0 {
+		_, err := regexp.Compile(p.Module)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *PAM) expandVariables(v []Variable) {
+	p.Service = variableExpansion(v, p.Service)
+	p.Path = variableExpansion(v, p.Path)
+}
+
+func (p *PAM) getCriteria() (ret []evaluationCriteria) {
+	for _, x := range p.matches {
+		n := evaluationCriteria{}
+		n.identifier = x.service
+		n.testValue = x.value
+		ret = append(ret, n)
+	}
+	return ret
+}
+
+func (p *PAM) prepare() error {
+	var re *regexp.Regexp
+	debugPrint("prepare(): analyzing pam configuration for \"%v\"\n", p.Service)
+	if len(p.Module) > 0 {
+		var err error
+		re, err = regexp.Compile(p.Module)
+		if err != nil {
+			return err
+		}
+	}
+	root := p.Path
+	if root == "" {
+		root = defaultPAMPath
+	}
+	entries, err := pamReadService(root, p.Service, "", 0)
+	if err != nil {
+		return err
+	}
+	for _, x := range entries {
+		if p.Type != "" && x.pamType != p.Type {
+			continue
+		}
+		if re != nil && !re.MatchString(x.module) {
+			continue
+		}
+		if p.Argument == "" {
+			p.matches = append(p.matches, pamMatch{p.Service, x.String()})
+			continue
+		}
+		for _, y := range x.args {
+			s := strings.SplitN(y, "=", 2)
+			if s[0] != p.Argument {
+				continue
+			}
+			if len(s) == 2 {
+				p.matches = append(p.matches, pamMatch{p.Service, s[1]})
+			} else {
+				p.matches = append(p.matches, pamMatch{p.Service, y})
+			}
+		}
+	}
+	return nil
+}
+
+// Read the PAM configuration for service, resolving any included
+// configuration. If onlyType is set, only entries of the given type are
+// returned.
+func pamReadService(root string, service string, onlyType string, depth int) ([]pamEntry, error) {
+	if depth > pamMaxIncludeDepth {
+		return nil, fmt.Errorf("pam include depth exceeded for %v", service)
+	}
+	fd, err := os.Open(filepath.Join(root, service))
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	ret := make([]pamEntry, 0)
+	scanner := bufio.NewScanner(fd)
+	var buf string
+	for scanner.Scan() {
+		ln := strings.TrimSpace(scanner.Text())
+		// Handle line continuation.
+		if strings.HasSuffix(ln, "\\") {
+			buf += strings.TrimSuffix(ln, "\\") + " "
+			continue
+		}
+		ln = buf + ln
+		buf = ""
+		if i := strings.Index(ln, "#"); i != -1 {
+			ln = ln[:i]
+		}
+		if ln == "" {
+			continue
+		}
+		if strings.HasPrefix(ln, "@include") {
+			s := strings.Fields(ln)
+			if len(s) < 2 {
+				continue
+			}
+			inc, err := pamReadService(root, s[1], onlyType, depth+1)
+			if err != nil {
+				debugPrint("pamReadService(): include %v failed: %v\n", s[1], err)
+				continue
+			}
+			ret = append(ret, inc...)
+			continue
+		}
+		ent, err := pamParseEntry(ln)
+		if err != nil {
+			debugPrint("pamReadService(): %v: %v\n", service, err)
+			continue
+		}
+		if onlyType != "" && ent.pamType != onlyType {
+			continue
+		}
+		if ent.control == "include" || ent.control == "substack" {
+			inc, err := pamReadService(root, ent.module, ent.pamType, depth+1)
+			if err != nil {
+				debugPrint("pamReadService(): include %v failed: %v\n", ent.module, err)
+				continue
+			}
+			ret = append(ret, inc...)
+			continue
+		}
+		ret = append(ret, ent)
+	}
+	return ret, scanner.Err()
+}
+
+func pamParseEntry(ln string) (ret pamEntry, err error) {
+	s := strings.Fields(ln)
+	if len(s) < 3 {
+		return ret, fmt.Errorf("invalid entry \"%v\"", ln)
+	}
+	// A leading - indicates the entry should be ignored if the module is
+	// missing, this does not change the meaning of the entry.
+	ret.pamType = strings.ToLower(strings.TrimPrefix(s[0], "-"))
+	idx := 1
+	if strings.HasPrefix(s[1], "[") {
+		// Bracketed controls can contain spaces.
+		var ctl []string
+		for ; idx < len(s); idx++ {
+			ctl = append(ctl, s[idx])
+			if strings.HasSuffix(s[idx], "]") {
+				break
+			}
+		}
+		ret.control = strings.Join(ctl, " ")
+	} else {
+		ret.control = s[1]
+	}
+	idx++
+	if idx >= len(s) {
+		return ret, fmt.Errorf("invalid entry \"%v\"", ln)
+	}
+	ret.module = s[idx]
+	if ret.control != "include" && ret.control != "substack" {
+		ret.module = path.Base(ret.module)
+	}
+	ret.args = s[idx+1:]
+	return ret, nil
+}
@@ -20,6 +20,14 @@ import (
 // LoadDocument loads a scribe JSON or YAML document from the reader
 // specified by r. Returns a Document type that can be passed to
 // AnalyzeDocument(). On error, LoadDocument() returns the error that occurred.
+//
+// Documents encrypted using EncryptDocument() are decrypted using the
+// document key before being loaded.
+//
+// By default fields in the document that are not known to scribe are
+// ignored, so documents using features added in later versions can still be
+// loaded. If strict parsing is enabled using SetStrictParsing(), unknown
+// fields result in an error.
 func LoadDocument(r io.Reader) (Document, error) {
 	var ret Document
 
@@ -28,6 +36,13 @@ func LoadDocument(r io.Reader) (Document, error) {
 	if err != nil {
 		return ret, err
 	}
+	if isEncryptedDocument(b) {
+		debugPrint("document is encrypted\n")
+		b, err = decryptDocument(b)
+		if err != nil {
+			return ret, err
+		}
+	}
 	// clean up leading spaces, tabs and newlines
 	b = bytes.TrimLeft(b, " \n\t")
 	if len(b) < 10 {
@@ -36,11 +51,24 @@ func LoadDocument(r io.Reader) (Document, error) {
 	switch b[0] {
 	case '{', '[':
 		debugPrint("document is in JSON format\n")
-		err = json.Unmarshal(b, &ret)
+		dec := json.NewDecoder(bytes.NewReader(b))
+		if sRuntime.strict {
+			dec.DisallowUnknownFields()
+		}
+		err = dec.Decode(&ret)
 	default:
 		debugPrint("document is in YAML format\n")
-		err = yaml.Unmarshal(b, &ret)
+		if sRuntime.strict {
+			err = yaml.UnmarshalStrict(b, &ret)
+		} else {
+			err = yaml.Unmarshal(b, &ret)
+		}
+	}
+	if err != nil {
+		return ret, err
 	}
+	ret.overrideVariables()
+	err = ret.expandGenerators()
 	if err != nil {
 		return ret, err
 	}
@@ -58,6 +86,17 @@ func LoadDocument(r io.Reader) (Document, error) {
 	return ret, nil
 }
 
+// SetStrictParsing enables or disables strict parsing of documents loaded
+// after the call. With strict parsing, LoadDocument() returns an error if a
+// document contains a field scribe does not know about, so a misspelled
+// field (for example "experssion" in an object) is reported when the
+// document is loaded rather than producing an object or test that silently
+// matches nothing. Note this includes source types and evaluators added in
+// later versions of scribe, which are otherwise ignored.
+func SetStrictParsing(f bool) {
+	sRuntime.strict = f
+}
+
 // AnalyzeDocument analyzes a scribe document on the host system. The will
 // prepare and execute all tests specified in the scribe document. Returns
 // an error if a fatal error occurs.
@@ -66,11 +105,50 @@ func LoadDocument(r io.Reader) (Document, error) {
 // a fatal error condition. In these cases, the test itself will be marked
 // as having an error condition (stored in the Err field of the Test).
 func AnalyzeDocument(d Document) error {
+	return analyzeDocument(d, nil)
+}
+
+// AnalyzeDocumentStream analyzes a scribe document in the same way as
+// AnalyzeDocument(), but writes the results of each test to w as newline
+// delimited JSON as soon as the test has been evaluated, rather than
+// requiring the caller to collect results once analysis is complete. The
+// objects a test references are prepared when the test is reached, so the
+// first results are written before later objects have been prepared.
+func AnalyzeDocumentStream(d Document, w io.Writer) error {
+	return analyzeDocument(d, func(tr TestResult) error {
+		_, err := fmt.Fprintf(w, "%v\n", tr.JSON())
+		return err
+	})
+}
+
+// Analyze the document. If resultFn is nil, all objects are prepared before
+// any test is run so they can be prepared concurrently. Otherwise objects
+// are prepared as tests reference them, and resultFn is called with the
+// results of each test as it completes.
+func analyzeDocument(d Document, resultFn func(TestResult) error) error {
+	// Package information is collected at most once per analysis.
+	pkgmgrReset()
+	if resultFn != nil {
+		debugPrint("analyzing document, streaming results...\n")
+		return d.streamTests(resultFn)
+	}
 	debugPrint("preparing objects...\n")
 	err := d.prepareObjects()
 	if err != nil {
 		return err
 	}
 	debugPrint("analyzing document...\n")
-	return d.runTests()
+	return d.runTests(nil)
+}
+
+// AnalyzeDocumentReader starts analysis of a scribe document, returning an
+// io.Reader the newline delimited JSON results of each test can be read
+// from as analysis progresses. If a fatal error occurs during analysis, it
+// is returned by the reader.
+func AnalyzeDocumentReader(d Document) io.Reader {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(AnalyzeDocumentStream(d, pw))
+	}()
+	return pr
 }
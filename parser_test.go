@@ -0,0 +1,76 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mozilla/scribe"
+)
+
+// The test misspells expectedresult, so is silently expected to be false
+// unless strict parsing is enabled.
+var strictParsingJSON = `
+{
+	"objects": [
+	{
+		"object": "file-hasline",
+		"hasline": {
+			"path": "./test/hasline",
+			"file": ".*\\.txt",
+			"expression": ".*test.*"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "files-with-line",
+		"object": "file-hasline",
+		"expectedreslt": true
+	}
+	]
+}
+`
+
+var strictParsingYAML = `
+objects:
+  - object: file-hasline
+    hasline:
+      path: ./test/hasline
+      file: .*\.txt
+      expression: .*test.*
+tests:
+  - test: files-with-line
+    object: file-hasline
+    expectedreslt: true
+`
+
+func TestStrictParsing(t *testing.T) {
+	scribe.Bootstrap()
+	for _, x := range []string{strictParsingJSON, strictParsingYAML} {
+		_, err := scribe.LoadDocument(strings.NewReader(x))
+		if err != nil {
+			t.Fatalf("scribe.LoadDocument: %v", err)
+		}
+	}
+
+	scribe.SetStrictParsing(true)
+	defer scribe.SetStrictParsing(false)
+	for _, x := range []string{strictParsingJSON, strictParsingYAML} {
+		_, err := scribe.LoadDocument(strings.NewReader(x))
+		if err == nil || !strings.Contains(err.Error(), "expectedreslt") {
+			t.Fatalf("scribe.LoadDocument should have failed with unknown field, got %v", err)
+		}
+	}
+	_, err := scribe.LoadDocument(strings.NewReader(strings.Replace(strictParsingJSON, "expectedreslt", "expectedresult", 1)))
+	if err != nil {
+		t.Fatalf("scribe.LoadDocument: %v", err)
+	}
+}
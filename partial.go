@@ -0,0 +1,101 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"fmt"
+	goruntime "runtime"
+)
+
+// SetPartialEvaluation enables or disables partial evaluation of documents
+// loaded after the call.
+//
+// By default a document containing an object without a supported source,
+// for example a source type added in a later version of scribe, fails to
+// load. With partial evaluation enabled such objects, and objects using
+// sources that are not supported on this platform, are removed from the
+// document when it is loaded. Tests using them, and tests depending on
+// those tests, are not evaluated and their results are marked as not
+// applicable, while the remaining tests are evaluated as usual.
+func SetPartialEvaluation(f bool) {
+	sRuntime.partial = f
+}
+
+// Return the reason the object can not be evaluated on this system, or an
+// empty string if it can.
+func (o *Object) unsupportedReason() string {
+	name := o.sourceName()
+	if name == "" {
+		return "no supported source"
+	}
+	if evidenceReplaying() != nil && !evidenceSources[name] {
+		return fmt.Sprintf("source %v can not be evaluated from evidence", name)
+	}
+	platforms, ok := sourcePlatforms[name]
+	if !ok {
+		return ""
+	}
+	for _, x := range platforms {
+		if x == goruntime.GOOS {
+			return ""
+		}
+	}
+	return fmt.Sprintf("source %v is not supported on %v", name, goruntime.GOOS)
+}
+
+// If partial evaluation is enabled, remove objects that can not be
+// evaluated from the document, and mark tests using them or depending on
+// tests using them as not applicable.
+func (d *Document) removeUnsupported() {
+	if !sRuntime.partial {
+		return
+	}
+	reasons := make(map[string]string)
+	objects := make([]Object, 0, len(d.Objects))
+	for _, x := range d.Objects {
+		r := x.unsupportedReason()
+		if r == "" {
+			objects = append(objects, x)
+			continue
+		}
+		debugPrint("removeUnsupported(): removing object \"%v\": %v\n", x.Object, r)
+		reasons[x.Object] = r
+	}
+	if len(reasons) == 0 {
+		return
+	}
+	d.Objects = objects
+	na := make(map[string]bool)
+	for i := range d.Tests {
+		t := &d.Tests[i]
+		if r, ok := reasons[t.Object]; ok {
+			t.notApplicable = fmt.Sprintf("object %v: %v", t.Object, r)
+			na[t.TestID] = true
+		}
+	}
+	// Dependencies can appear after the tests that use them, so repeat
+	// until no further tests are marked.
+	for changed := true; changed; {
+		changed = false
+		for i := range d.Tests {
+			t := &d.Tests[i]
+			if na[t.TestID] {
+				continue
+			}
+			for _, x := range t.If {
+				if na[x] {
+					t.notApplicable = fmt.Sprintf("dependency %v is not applicable", x)
+					na[t.TestID] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	d.buildIndex()
+}
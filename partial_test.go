@@ -0,0 +1,99 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mozilla/scribe"
+)
+
+// The futuresource object uses a source type this version of scribe does
+// not know about.
+var partialDoc = `
+{
+	"objects": [
+	{
+		"object": "file-hasline",
+		"hasline": {
+			"path": "./test/hasline",
+			"file": ".*\\.txt",
+			"expression": ".*test.*"
+		}
+	},
+	{
+		"object": "future",
+		"futuresource": {
+			"name": "value"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "files-with-line",
+		"expectedresult": true,
+		"object": "file-hasline"
+	},
+	{
+		"test": "future-test",
+		"object": "future",
+		"if": [ "files-with-line" ]
+	},
+	{
+		"test": "depends-on-future",
+		"object": "file-hasline",
+		"if": [ "future-test" ]
+	}
+	]
+}
+`
+
+func TestPartialEvaluation(t *testing.T) {
+	scribe.Bootstrap()
+	_, err := scribe.LoadDocument(strings.NewReader(partialDoc))
+	if err == nil {
+		t.Fatalf("scribe.LoadDocument should fail without partial evaluation")
+	}
+
+	scribe.SetPartialEvaluation(true)
+	defer scribe.SetPartialEvaluation(false)
+	doc, err := scribe.LoadDocument(strings.NewReader(partialDoc))
+	if err != nil {
+		t.Fatalf("scribe.LoadDocument: %v", err)
+	}
+	err = scribe.AnalyzeDocument(doc)
+	if err != nil {
+		t.Fatalf("scribe.AnalyzeDocument: %v", err)
+	}
+	tr, err := scribe.GetResults(&doc, "files-with-line")
+	if err != nil {
+		t.Fatalf("scribe.GetResults: %v", err)
+	}
+	if tr.NotApplicable || tr.IsError || !tr.MasterResult {
+		t.Fatalf("files-with-line should have been evaluated")
+	}
+	expect := map[string]string{
+		"future-test":       "object future: no supported source",
+		"depends-on-future": "dependency future-test is not applicable",
+	}
+	for k, v := range expect {
+		tr, err = scribe.GetResults(&doc, k)
+		if err != nil {
+			t.Fatalf("scribe.GetResults: %v", err)
+		}
+		if !tr.NotApplicable || tr.NotApplicableReason != v {
+			t.Fatalf("%v: unexpected result %+v", k, tr)
+		}
+		if tr.IsError || len(tr.SingleLineResults()) != 1 ||
+			!strings.Contains(tr.SingleLineResults()[0], "[notapplicable]") {
+			t.Fatalf("%v: unexpected single line results %v", k, tr.SingleLineResults())
+		}
+	}
+}
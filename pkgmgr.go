@@ -11,13 +11,21 @@ import (
 	"os/exec"
 	"regexp"
 	"strings"
+	"sync"
 )
 
+// The package inventory is collected from the package manager once per
+// document analysis, and the snapshot is shared by all package objects in
+// the document. pkgmgrReset() is called at the start of each analysis so
+// subsequent runs see current package information.
 var pkgmgrInitialized bool
 var pkgmgrCache []pkgmgrInfo
+var pkgmgrErr error
+var pkgmgrLock sync.Mutex
 
 type pkgmgrResult struct {
 	results []pkgmgrInfo
+	err     error // Set if the package inventory could not be collected.
 }
 
 type pkgmgrInfo struct {
@@ -50,22 +58,22 @@ func QueryPackages() []PackageInfo {
 	return ret
 }
 
-func getPackage(name string, collectexp string) (ret pkgmgrResult) {
+func getPackage(name string, collect *regexp.Regexp) (ret pkgmgrResult) {
 	ret.results = make([]pkgmgrInfo, 0)
+	pkgmgrLock.Lock()
+	defer pkgmgrLock.Unlock()
 	if !pkgmgrInitialized {
 		pkgmgrInit()
 	}
+	ret.err = pkgmgrErr
 	debugPrint("getPackage(): looking for \"%v\"\n", name)
 	for _, x := range pkgmgrCache {
-		if collectexp == "" {
+		if collect == nil {
 			if x.name != name {
 				continue
 			}
-		} else {
-			mtch, err := regexp.MatchString(collectexp, x.name)
-			if err != nil || !mtch {
-				continue
-			}
+		} else if !collect.MatchString(x.name) {
+			continue
 		}
 		debugPrint("getPackage(): found %v, %v, %v\n", x.name, x.version, x.pkgtype)
 		ret.results = append(ret.results, x)
@@ -77,6 +85,8 @@ func getPackage(name string, collectexp string) (ret pkgmgrResult) {
 func getAllPackages() pkgmgrResult {
 	ret := pkgmgrResult{}
 	ret.results = make([]pkgmgrInfo, 0)
+	pkgmgrLock.Lock()
+	defer pkgmgrLock.Unlock()
 	if !pkgmgrInitialized {
 		pkgmgrInit()
 	}
@@ -86,14 +96,45 @@ func getAllPackages() pkgmgrResult {
 	return ret
 }
 
+// Discard the package inventory snapshot, the next package query will
+// collect a new snapshot from the package manager.
+func pkgmgrReset() {
+	pkgmgrLock.Lock()
+	pkgmgrInitialized = false
+	pkgmgrCache = nil
+	pkgmgrErr = nil
+	pkgmgrLock.Unlock()
+}
+
 func pkgmgrInit() {
 	debugPrint("pkgmgrInit(): initializing package manager...\n")
 	pkgmgrCache = make([]pkgmgrInfo, 0)
-	if sRuntime.testHooks {
+	if e := evidenceReplaying(); e != nil {
+		pkgmgrCache = append(pkgmgrCache, e.getPackages()...)
+	} else if sRuntime.pkgQuery != nil {
+		pkgs, err := sRuntime.pkgQuery()
+		if err != nil {
+			debugPrint("pkgmgrInit(): package query failed: %v\n", err)
+			pkgmgrErr = err
+		}
+		for _, x := range pkgs {
+			pkgmgrCache = append(pkgmgrCache, pkgmgrInfo{
+				name:    x.Name,
+				version: x.Version,
+				pkgtype: x.Type,
+				arch:    x.Arch,
+			})
+		}
+	} else if sRuntime.testHooks {
 		pkgmgrCache = append(pkgmgrCache, testGetPackages()...)
 	} else {
 		pkgmgrCache = append(pkgmgrCache, rpmGetPackages()...)
 		pkgmgrCache = append(pkgmgrCache, dpkgGetPackages()...)
+		pkgmgrCache = append(pkgmgrCache, pkgutilGetPackages()...)
+		pkgmgrCache = append(pkgmgrCache, brewGetPackages()...)
+	}
+	if e := evidenceRecording(); e != nil {
+		e.setPackages(pkgmgrCache)
 	}
 	pkgmgrInitialized = true
 	debugPrint("pkgmgrInit(): initialized with %v packages\n", len(pkgmgrCache))
@@ -155,6 +196,66 @@ func dpkgGetPackages() []pkgmgrInfo {
 	return ret
 }
 
+// Return packages installed using the macOS installer, as recorded in the
+// package receipts database. The package name is the package identifier,
+// for example com.apple.pkg.XProtectPlistConfigData.
+func pkgutilGetPackages() []pkgmgrInfo {
+	ret := make([]pkgmgrInfo, 0)
+
+	buf, err := exec.Command("pkgutil", "--pkgs").Output()
+	if err != nil {
+		return ret
+	}
+	for _, x := range strings.Split(string(buf), "\n") {
+		id := strings.TrimSpace(x)
+		if id == "" {
+			continue
+		}
+		info, err := exec.Command("pkgutil", "--pkg-info", id).Output()
+		if err != nil {
+			continue
+		}
+		newpkg := pkgmgrInfo{}
+		newpkg.name = id
+		newpkg.pkgtype = "pkgutil"
+		for _, y := range strings.Split(string(info), "\n") {
+			s := strings.SplitN(y, ":", 2)
+			if len(s) == 2 && s[0] == "version" {
+				newpkg.version = strings.TrimSpace(s[1])
+			}
+		}
+		ret = append(ret, newpkg)
+	}
+	return ret
+}
+
+// Return formulae and casks installed using Homebrew. If more than one
+// version of a formula is installed, an entry is returned for each version.
+func brewGetPackages() []pkgmgrInfo {
+	ret := make([]pkgmgrInfo, 0)
+
+	for _, x := range []string{"--formula", "--cask"} {
+		buf, err := exec.Command("brew", "list", x, "--versions").Output()
+		if err != nil {
+			continue
+		}
+		for _, y := range strings.Split(string(buf), "\n") {
+			s := strings.Fields(y)
+			if len(s) < 2 {
+				continue
+			}
+			for _, v := range s[1:] {
+				newpkg := pkgmgrInfo{}
+				newpkg.name = s[0]
+				newpkg.version = v
+				newpkg.pkgtype = "brew"
+				ret = append(ret, newpkg)
+			}
+		}
+	}
+	return ret
+}
+
 // Functions and data related to package tests
 
 var testPkgTable = []struct {
@@ -0,0 +1,510 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Plist is used to perform tests against values stored in property list
+// files, as used for configuration on macOS. Both XML and binary property
+// lists are supported.
+//
+// Files are located using Path and File in the same way as for FileName.
+// Key is the path to the value in the property list, with dictionary keys
+// and array indexes separated by : (for example
+// AutomaticCheckEnabled or Sharing:0:Name). If the value is an array, a
+// criteria is returned for each element. Boolean values are returned as
+// true or false, and dates in RFC 3339 format.
+//
+// The identifier for each criteria is the path to the property list file.
+type Plist struct {
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+	File string `json:"file,omitempty" yaml:"file,omitempty"`
+	Key  string `json:"key,omitempty" yaml:"key,omitempty"`
+
+	LocatorOptions `yaml:",inline"`
+
+	fileRe  compiledRegexp
+	matches []plistMatch
+}
+
+type plistMatch struct {
+	path  string
+	value string
+}
+
+func (p *Plist) isChain() bool {
+	return false
+}
+
+func (p *Plist) fireChains(d *Document) ([]evaluationCriteria, error) {
+	return nil, nil
+}
+
+func (p *Plist) mergeCriteria(c []evaluationCriteria) {
+}
+
+func (p *Plist) validate(d *Document) error {
+	if len(p.Path) == 0 {
+		return fmt.Errorf("plist path must be set")
+	}
+	if len(p.File) == 0 {
+		return fmt.Errorf("plist file must be set")
+	}
+	if len(p.Key) == 0 {
+		return fmt.Errorf("plist key must be set")
+	}
+	_, err := p.fileRe.compile(p.fileExpression(p.File))
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (p *Plist) expandVariables(v []Variable) {
+	p.Path = variableExpansion(v, p.Path)
+	p.File = variableExpansion(v, p.File)
+}
+
+func (p *Plist) getCriteria() (ret []evaluationCriteria) {
+	for _, x := range p.matches {
+		n := evaluationCriteria{}
+		n.identifier = x.path
+		n.testValue = x.value
+		ret = append(ret, n)
+	}
+	return ret
+}
+
+func (p *Plist) prepare() error {
+	debugPrint("prepare(): analyzing file system, path %v, file \"%v\"\n", p.Path, p.File)
+
+	re, err := p.fileRe.compile(p.fileExpression(p.File))
+	if err != nil {
+		return err
+	}
+
+	sfl := newSimpleFileLocator()
+	sfl.root = p.Path
+	sfl.opts = p.LocatorOptions
+	err = sfl.locateRegexp(re)
+	if err != nil {
+		return err
+	}
+
+	for _, x := range sfl.matches {
+		root, err := plistLoad(x, p.LocatorOptions)
+		if err != nil {
+			debugPrint("prepare(): skipping %v: %v\n", x, err)
+			continue
+		}
+		v, ok := plistLookup(root, p.Key)
+		if !ok {
+			debugPrint("prepare(): %v has no key %v\n", x, p.Key)
+			continue
+		}
+		for _, y := range plistValues(v) {
+			debugPrint("prepare(): %v %v: %v\n", x, p.Key, y)
+			p.matches = append(p.matches, plistMatch{path: sfl.identifier(x), value: y})
+		}
+	}
+	return nil
+}
+
+// Load and decode the property list at path.
+func plistLoad(path string, opts LocatorOptions) (interface{}, error) {
+	fd, err := openLocated(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	buf, err := ioutil.ReadAll(fd)
+	if err != nil {
+		return nil, err
+	}
+	return plistDecode(buf)
+}
+
+// Decode a property list, returning the root value. Dictionaries are
+// returned as map[string]interface{}, and arrays as []interface{}.
+func plistDecode(buf []byte) (interface{}, error) {
+	if bytes.HasPrefix(buf, []byte("bplist00")) {
+		return bplistDecode(buf)
+	}
+	return xmlPlistDecode(bytes.NewReader(buf))
+}
+
+// Return the value at the : separated key path in the property list.
+func plistLookup(v interface{}, key string) (interface{}, bool) {
+	for _, x := range strings.Split(strings.TrimPrefix(key, ":"), ":") {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			nv, ok := t[x]
+			if !ok {
+				return nil, false
+			}
+			v = nv
+		case []interface{}:
+			idx, err := strconv.Atoi(x)
+			if err != nil || idx < 0 || idx >= len(t) {
+				return nil, false
+			}
+			v = t[idx]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// Convert a property list value into test values. Dictionaries have no
+// test value.
+func plistValues(v interface{}) []string {
+	switch t := v.(type) {
+	case []interface{}:
+		ret := make([]string, 0)
+		for _, x := range t {
+			ret = append(ret, plistValues(x)...)
+		}
+		return ret
+	case map[string]interface{}:
+		return nil
+	case time.Time:
+		return []string{t.UTC().Format(time.RFC3339)}
+	case []byte:
+		return []string{base64.StdEncoding.EncodeToString(t)}
+	case float64:
+		return []string{strconv.FormatFloat(t, 'f', -1, 64)}
+	}
+	return []string{fmt.Sprintf("%v", v)}
+}
+
+func xmlPlistDecode(r io.Reader) (interface{}, error) {
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			if err == io.EOF {
+				return nil, fmt.Errorf("property list contains no value")
+			}
+			return nil, err
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok || se.Name.Local == "plist" {
+			continue
+		}
+		return xmlPlistValue(dec, se)
+	}
+}
+
+func xmlPlistValue(dec *xml.Decoder, se xml.StartElement) (interface{}, error) {
+	switch se.Name.Local {
+	case "dict":
+		ret := make(map[string]interface{})
+		var key *string
+		for {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch t := tok.(type) {
+			case xml.EndElement:
+				return ret, nil
+			case xml.StartElement:
+				if t.Name.Local == "key" {
+					var k string
+					err = dec.DecodeElement(&k, &t)
+					if err != nil {
+						return nil, err
+					}
+					key = &k
+					continue
+				}
+				if key == nil {
+					return nil, fmt.Errorf("dictionary value without key")
+				}
+				v, err := xmlPlistValue(dec, t)
+				if err != nil {
+					return nil, err
+				}
+				ret[*key] = v
+				key = nil
+			}
+		}
+	case "array":
+		ret := make([]interface{}, 0)
+		for {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch t := tok.(type) {
+			case xml.EndElement:
+				return ret, nil
+			case xml.StartElement:
+				v, err := xmlPlistValue(dec, t)
+				if err != nil {
+					return nil, err
+				}
+				ret = append(ret, v)
+			}
+		}
+	case "true", "false":
+		err := dec.Skip()
+		return se.Name.Local == "true", err
+	}
+	var s string
+	err := dec.DecodeElement(&s, &se)
+	if err != nil {
+		return nil, err
+	}
+	switch se.Name.Local {
+	case "string":
+		return s, nil
+	case "integer":
+		return strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	case "real":
+		return strconv.ParseFloat(strings.TrimSpace(s), 64)
+	case "date":
+		return time.Parse(time.RFC3339, strings.TrimSpace(s))
+	case "data":
+		return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+	}
+	return nil, fmt.Errorf("unknown property list element %v", se.Name.Local)
+}
+
+// The reference date for dates in binary property lists.
+var bplistEpoch = time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// The maximum nesting of containers in a binary property list, which also
+// prevents loops through object references.
+const bplistMaxDepth = 64
+
+type bplistDecoder struct {
+	buf     []byte
+	offsets []uint64
+	refSize int
+}
+
+func bplistDecode(buf []byte) (interface{}, error) {
+	if len(buf) < 40 {
+		return nil, fmt.Errorf("binary property list is truncated")
+	}
+	trailer := buf[len(buf)-32:]
+	offSize := int(trailer[6])
+	d := bplistDecoder{buf: buf, refSize: int(trailer[7])}
+	count := binary.BigEndian.Uint64(trailer[8:])
+	top := binary.BigEndian.Uint64(trailer[16:])
+	tableOff := binary.BigEndian.Uint64(trailer[24:])
+	if offSize < 1 || offSize > 8 || d.refSize < 1 || d.refSize > 8 {
+		return nil, fmt.Errorf("invalid binary property list trailer")
+	}
+	if count > uint64(len(buf)) || tableOff > uint64(len(buf)) ||
+		tableOff+count*uint64(offSize) > uint64(len(buf)) {
+		return nil, fmt.Errorf("invalid binary property list offset table")
+	}
+	for i := uint64(0); i < count; i++ {
+		p := tableOff + i*uint64(offSize)
+		d.offsets = append(d.offsets, bplistUint(buf[p:p+uint64(offSize)]))
+	}
+	return d.object(top, 0)
+}
+
+func bplistUint(b []byte) uint64 {
+	var ret uint64
+	for _, x := range b {
+		ret = ret<<8 | uint64(x)
+	}
+	return ret
+}
+
+// Return n bytes of the buffer starting at off.
+func (d *bplistDecoder) bytes(off uint64, n uint64) ([]byte, error) {
+	if off > uint64(len(d.buf)) || n > uint64(len(d.buf))-off {
+		return nil, fmt.Errorf("binary property list object out of range")
+	}
+	return d.buf[off : off+n], nil
+}
+
+// Return the length of the object with the marker at off, and the offset
+// of the object data.
+func (d *bplistDecoder) length(off uint64, info byte) (uint64, uint64, error) {
+	if info != 0x0f {
+		return uint64(info), off + 1, nil
+	}
+	b, err := d.bytes(off+1, 1)
+	if err != nil {
+		return 0, 0, err
+	}
+	if b[0]&0xf0 != 0x10 {
+		return 0, 0, fmt.Errorf("invalid binary property list length")
+	}
+	n := uint64(1) << (b[0] & 0x0f)
+	lb, err := d.bytes(off+2, n)
+	if err != nil {
+		return 0, 0, err
+	}
+	l := bplistUint(lb)
+	if l > uint64(len(d.buf)) {
+		return 0, 0, fmt.Errorf("invalid binary property list length")
+	}
+	return l, off + 2 + n, nil
+}
+
+func (d *bplistDecoder) object(ref uint64, depth int) (interface{}, error) {
+	if depth > bplistMaxDepth {
+		return nil, fmt.Errorf("binary property list nesting too deep")
+	}
+	if ref >= uint64(len(d.offsets)) {
+		return nil, fmt.Errorf("invalid binary property list reference")
+	}
+	off := d.offsets[ref]
+	mb, err := d.bytes(off, 1)
+	if err != nil {
+		return nil, err
+	}
+	kind, info := mb[0]>>4, mb[0]&0x0f
+	switch kind {
+	case 0x0:
+		switch info {
+		case 0x08:
+			return false, nil
+		case 0x09:
+			return true, nil
+		}
+		return nil, nil
+	case 0x1:
+		b, err := d.bytes(off+1, 1<<info)
+		if err != nil {
+			return nil, err
+		}
+		// 16 byte integers are only used for values that do not fit in
+		// a signed 64 bit integer, the low 64 bits are used.
+		if len(b) > 8 {
+			b = b[len(b)-8:]
+		}
+		return int64(bplistUint(b)), nil
+	case 0x2:
+		b, err := d.bytes(off+1, 1<<info)
+		if err != nil {
+			return nil, err
+		}
+		switch len(b) {
+		case 4:
+			return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), nil
+		case 8:
+			return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+		}
+		return nil, fmt.Errorf("invalid binary property list real")
+	case 0x3:
+		b, err := d.bytes(off+1, 8)
+		if err != nil {
+			return nil, err
+		}
+		secs := math.Float64frombits(binary.BigEndian.Uint64(b))
+		return bplistEpoch.Add(time.Duration(secs * float64(time.Second))), nil
+	case 0x8:
+		b, err := d.bytes(off+1, uint64(info)+1)
+		if err != nil {
+			return nil, err
+		}
+		return int64(bplistUint(b)), nil
+	}
+
+	n, data, err := d.length(off, info)
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case 0x4:
+		b, err := d.bytes(data, n)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{}, b...), nil
+	case 0x5:
+		b, err := d.bytes(data, n)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case 0x6:
+		b, err := d.bytes(data, n*2)
+		if err != nil {
+			return nil, err
+		}
+		u := make([]uint16, n)
+		for i := range u {
+			u[i] = binary.BigEndian.Uint16(b[i*2:])
+		}
+		return string(utf16.Decode(u)), nil
+	case 0xa:
+		refs, err := d.refs(data, n)
+		if err != nil {
+			return nil, err
+		}
+		ret := make([]interface{}, 0, len(refs))
+		for _, x := range refs {
+			v, err := d.object(x, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, v)
+		}
+		return ret, nil
+	case 0xd:
+		refs, err := d.refs(data, n*2)
+		if err != nil {
+			return nil, err
+		}
+		ret := make(map[string]interface{})
+		for i := uint64(0); i < n; i++ {
+			k, err := d.object(refs[i], depth+1)
+			if err != nil {
+				return nil, err
+			}
+			ks, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("binary property list dictionary key is not a string")
+			}
+			v, err := d.object(refs[n+i], depth+1)
+			if err != nil {
+				return nil, err
+			}
+			ret[ks] = v
+		}
+		return ret, nil
+	}
+	return nil, fmt.Errorf("unsupported binary property list object type %#x", kind)
+}
+
+// Read n object references starting at off.
+func (d *bplistDecoder) refs(off uint64, n uint64) ([]uint64, error) {
+	b, err := d.bytes(off, n*uint64(d.refSize))
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]uint64, 0, n)
+	for i := uint64(0); i < n; i++ {
+		p := i * uint64(d.refSize)
+		ret = append(ret, bplistUint(b[p:p+uint64(d.refSize)]))
+	}
+	return ret, nil
+}
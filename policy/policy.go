@@ -0,0 +1,392 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+// Package policy keeps a local directory of documents in sync with a policy
+// server, downloading only the documents that changed.
+//
+// The policy server publishes a Manifest over HTTPS, listing each document
+// and its SHA-256 digest. A Syncer fetches the manifest, compares the
+// digests with the documents already in the directory, and downloads only
+// those that differ, verifying the digest of each before it replaces the
+// local copy. Documents removed from the manifest are removed from the
+// directory. The manifest is fetched conditionally, so when nothing has
+// changed a sync costs a single request with an empty response.
+package policy
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mozilla/scribe"
+)
+
+// Manifest lists the documents published by a policy server. Serial is the
+// version of the manifest, and must be increased each time the manifest is
+// changed; a Syncer rejects a manifest with a lower serial than the last
+// manifest it applied, so an old manifest can not be served again to roll
+// back documents. Signature is a base64 encoded ed25519 signature over the
+// JSON encoding of the manifest without the signature.
+type Manifest struct {
+	Serial    uint64     `json:"serial,omitempty"`
+	Documents []Document `json:"documents"`
+	Signature string     `json:"signature,omitempty"`
+}
+
+// Document describes a document in a manifest. Name is the slash separated
+// path of the document relative to the local directory, and SHA256 the hex
+// encoded digest of its content. URL is where the document is fetched from,
+// resolved relative to the manifest URL, and defaults to Name.
+type Document struct {
+	Name   string `json:"name"`
+	SHA256 string `json:"sha256"`
+	URL    string `json:"url,omitempty"`
+}
+
+// Result describes a sync. Documents are the paths of the documents in the
+// local directory, in manifest order, and Fetched and Removed the names of
+// the documents downloaded and removed.
+type Result struct {
+	Documents []string
+	Fetched   []string
+	Removed   []string
+}
+
+// The maximum size of a manifest and of a document.
+const (
+	maxManifestSize = 1 << 20
+	maxDocumentSize = 64 << 20
+)
+
+const defaultTimeout = 5 * time.Minute
+
+// The manifest of the last sync is kept in the directory, so documents
+// removed from the manifest can be removed after a restart.
+const stateFile = ".manifest.json"
+
+func (m *Manifest) signedPayload() ([]byte, error) {
+	c := *m
+	c.Signature = ""
+	return json.Marshal(c)
+}
+
+// Sign signs the manifest using the ed25519 private key key, setting the
+// Signature field.
+func (m *Manifest) Sign(key ed25519.PrivateKey) error {
+	buf, err := m.signedPayload()
+	if err != nil {
+		return err
+	}
+	m.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, buf))
+	return nil
+}
+
+// Verify verifies the manifest signature using the ed25519 public key key.
+func (m *Manifest) Verify(key ed25519.PublicKey) error {
+	if m.Signature == "" {
+		return fmt.Errorf("policy manifest is not signed")
+	}
+	sig, err := base64.StdEncoding.DecodeString(m.Signature)
+	if err != nil {
+		return err
+	}
+	payload, err := m.signedPayload()
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(key, payload, sig) {
+		return fmt.Errorf("policy manifest signature is invalid")
+	}
+	return nil
+}
+
+// Validate the manifest, checking that names are usable as local paths and
+// digests are well formed.
+func (m *Manifest) validate() error {
+	seen := make(map[string]bool)
+	for _, x := range m.Documents {
+		if x.Name == "" || path.Clean(x.Name) != x.Name || path.IsAbs(x.Name) || strings.Contains(x.Name, "\\") {
+			return fmt.Errorf("policy manifest has invalid document name %q", x.Name)
+		}
+		for _, y := range strings.Split(x.Name, "/") {
+			// Also rejects .. and the state file.
+			if strings.HasPrefix(y, ".") {
+				return fmt.Errorf("policy manifest has invalid document name %q", x.Name)
+			}
+		}
+		if seen[x.Name] {
+			return fmt.Errorf("policy manifest lists %v more than once", x.Name)
+		}
+		seen[x.Name] = true
+		d, err := hex.DecodeString(x.SHA256)
+		if err != nil || len(d) != sha256.Size {
+			return fmt.Errorf("policy manifest has invalid sha256 for %v", x.Name)
+		}
+	}
+	return nil
+}
+
+// Syncer keeps the documents in Dir in sync with the manifest at
+// ManifestURL. The manifest must be signed using Key, unless Insecure is
+// set and Key is nil, in which case the manifest is not verified.
+// ManifestURL and document URLs must use HTTPS. If Client is nil
+// scribe.HTTPClient() is used with a timeout of 5 minutes.
+type Syncer struct {
+	ManifestURL string
+	Dir         string
+	Key         ed25519.PublicKey
+	Insecure    bool
+	Client      *http.Client
+
+	etag     string // The entity tag of the manifest, if the server sent one.
+	manifest *Manifest
+}
+
+// Sync fetches the manifest and brings the directory in sync with it. If
+// some documents can not be fetched the local copies are left in place,
+// and an error is returned along with the result. If the manifest can not
+// be fetched, the result lists the documents of the last sync.
+func (s *Syncer) Sync() (Result, error) {
+	var ret Result
+	if s.Key == nil && !s.Insecure {
+		return ret, fmt.Errorf("policy manifests can not be verified without a public key")
+	}
+	if s.Key != nil && len(s.Key) != ed25519.PublicKeySize {
+		return ret, fmt.Errorf("invalid policy public key")
+	}
+	m, err := s.fetchManifest()
+	if err != nil {
+		for _, x := range s.lastSync().Documents {
+			p := filepath.Join(s.Dir, filepath.FromSlash(x.Name))
+			if _, err := os.Stat(p); err == nil {
+				ret.Documents = append(ret.Documents, p)
+			}
+		}
+		return ret, err
+	}
+	err = os.MkdirAll(s.Dir, 0755)
+	if err != nil {
+		return ret, err
+	}
+	var ferr error
+	for _, x := range m.Documents {
+		p := filepath.Join(s.Dir, filepath.FromSlash(x.Name))
+		fetched, err := s.syncDocument(x, p)
+		if err != nil && ferr == nil {
+			ferr = fmt.Errorf("%v: %v", x.Name, err)
+		}
+		if fetched {
+			ret.Fetched = append(ret.Fetched, x.Name)
+		}
+		if _, err := os.Stat(p); err == nil {
+			ret.Documents = append(ret.Documents, p)
+		}
+	}
+	ret.Removed, err = s.removeStale(m)
+	if err != nil && ferr == nil {
+		ferr = err
+	}
+	return ret, ferr
+}
+
+// Fetch the manifest, returning the previous manifest if it has not
+// changed.
+func (s *Syncer) fetchManifest() (*Manifest, error) {
+	u, err := url.Parse(s.ManifestURL)
+	if err != nil {
+		return nil, err
+	}
+	etag := ""
+	if s.manifest != nil {
+		etag = s.etag
+	}
+	buf, etag, err := s.get(u, maxManifestSize, etag)
+	if err != nil {
+		return nil, err
+	}
+	if buf == nil {
+		return s.manifest, nil
+	}
+	var m Manifest
+	err = json.Unmarshal(buf, &m)
+	if err != nil {
+		return nil, fmt.Errorf("policy manifest: %v", err)
+	}
+	if s.Key != nil {
+		err = m.Verify(s.Key)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = m.validate()
+	if err != nil {
+		return nil, err
+	}
+	if last := s.lastSync(); m.Serial < last.Serial {
+		return nil, fmt.Errorf("policy manifest serial %v is older than the last applied serial %v",
+			m.Serial, last.Serial)
+	}
+	s.manifest, s.etag = &m, etag
+	return &m, nil
+}
+
+// Bring the local copy of document d at p in sync, returning true if it was
+// downloaded.
+func (s *Syncer) syncDocument(d Document, p string) (bool, error) {
+	want := strings.ToLower(d.SHA256)
+	buf, err := ioutil.ReadFile(p)
+	if err == nil {
+		sum := sha256.Sum256(buf)
+		if hex.EncodeToString(sum[:]) == want {
+			return false, nil
+		}
+	}
+	ref := d.URL
+	if ref == "" {
+		ref = d.Name
+	}
+	base, err := url.Parse(s.ManifestURL)
+	if err != nil {
+		return false, err
+	}
+	u, err := base.Parse(ref)
+	if err != nil {
+		return false, err
+	}
+	buf, _, err = s.get(u, maxDocumentSize, "")
+	if err != nil {
+		return false, err
+	}
+	sum := sha256.Sum256(buf)
+	if hex.EncodeToString(sum[:]) != want {
+		return false, fmt.Errorf("sha256 does not match manifest")
+	}
+	return true, writeFile(p, buf)
+}
+
+// Remove documents listed in the manifest of the previous sync but not in
+// m, and record m as the manifest of the last sync.
+func (s *Syncer) removeStale(m *Manifest) ([]string, error) {
+	var ret []string
+	prev := s.lastSync()
+	keep := make(map[string]bool)
+	for _, x := range m.Documents {
+		keep[x.Name] = true
+	}
+	for _, x := range prev.Documents {
+		if keep[x.Name] {
+			continue
+		}
+		err := os.Remove(filepath.Join(s.Dir, filepath.FromSlash(x.Name)))
+		if err != nil && !os.IsNotExist(err) {
+			return ret, err
+		}
+		ret = append(ret, x.Name)
+	}
+	buf, err := json.Marshal(m)
+	if err != nil {
+		return ret, err
+	}
+	return ret, writeFile(filepath.Join(s.Dir, stateFile), buf)
+}
+
+// Return the manifest of the last sync, or an empty manifest if there is
+// none. A state file that can not be parsed is ignored, as if there had
+// been no sync.
+func (s *Syncer) lastSync() Manifest {
+	var ret Manifest
+	buf, err := ioutil.ReadFile(filepath.Join(s.Dir, stateFile))
+	if err != nil {
+		return ret
+	}
+	if json.Unmarshal(buf, &ret) != nil || ret.validate() != nil {
+		return Manifest{}
+	}
+	return ret
+}
+
+// Write buf to a temporary file in the directory of p and rename it to p,
+// so a document is never left partially written.
+func writeFile(p string, buf []byte) error {
+	err := os.MkdirAll(filepath.Dir(p), 0755)
+	if err != nil {
+		return err
+	}
+	fd, err := ioutil.TempFile(filepath.Dir(p), "."+filepath.Base(p)+".sync")
+	if err != nil {
+		return err
+	}
+	tmp := fd.Name()
+	_, err = fd.Write(buf)
+	if err == nil {
+		err = fd.Sync()
+	}
+	if cerr := fd.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp, p)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// Fetch u, which must use HTTPS, reading at most max bytes. If etag is set
+// the request is conditional, and nil is returned if the resource has not
+// changed. Returns the entity tag of the response.
+func (s *Syncer) get(u *url.URL, max int64, etag string) ([]byte, string, error) {
+	if u.Scheme != "https" {
+		return nil, "", fmt.Errorf("%v: policy URLs must use https", u)
+	}
+	client := s.Client
+	if client == nil {
+		client = scribe.HTTPClient(defaultTimeout)
+	}
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if etag != "" && resp.StatusCode == http.StatusNotModified {
+		return nil, etag, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("%v: %v", u, resp.Status)
+	}
+	buf, err := ioutil.ReadAll(io.LimitReader(resp.Body, max+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(len(buf)) > max {
+		return nil, "", fmt.Errorf("%v: response is too large", u)
+	}
+	return buf, resp.Header.Get("ETag"), nil
+}
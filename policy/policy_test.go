@@ -0,0 +1,195 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package policy_test
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mozilla/scribe/policy"
+)
+
+func digest(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestSync(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey: %v", err)
+	}
+	docs := map[string]string{
+		"/docs/base.json": `{ "tests": [] }`,
+		"/docs/ssh.json":  `{ "objects": [] }`,
+	}
+	var manifest []byte
+	var requests []string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		if r.URL.Path == "/docs/manifest.json" {
+			etag := fmt.Sprintf("%q", digest(string(manifest)))
+			if r.Header.Get("If-None-Match") == etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", etag)
+			w.Write(manifest)
+			return
+		}
+		d, ok := docs[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(d))
+	}))
+	defer srv.Close()
+	var serial uint64
+	setManifest := func(m policy.Manifest) {
+		serial++
+		m.Serial = serial
+		err := m.Sign(priv)
+		if err != nil {
+			t.Fatalf("Manifest.Sign: %v", err)
+		}
+		manifest, err = json.Marshal(m)
+		if err != nil {
+			t.Fatalf("json.Marshal: %v", err)
+		}
+	}
+	setManifest(policy.Manifest{Documents: []policy.Document{
+		{Name: "base.json", SHA256: digest(docs["/docs/base.json"])},
+		{Name: "team/ssh.json", SHA256: digest(docs["/docs/ssh.json"]), URL: "ssh.json"},
+	}})
+
+	dir := t.TempDir()
+	s := policy.Syncer{ManifestURL: srv.URL + "/docs/manifest.json", Dir: dir, Key: pub, Client: srv.Client()}
+	base, ssh := filepath.Join(dir, "base.json"), filepath.Join(dir, "team", "ssh.json")
+	r, err := s.Sync()
+	if err != nil {
+		t.Fatalf("Syncer.Sync: %v", err)
+	}
+	if !reflect.DeepEqual(r.Documents, []string{base, ssh}) || len(r.Fetched) != 2 || len(r.Removed) != 0 {
+		t.Fatalf("unexpected result %+v", r)
+	}
+	buf, err := ioutil.ReadFile(ssh)
+	if err != nil || string(buf) != docs["/docs/ssh.json"] {
+		t.Fatalf("unexpected document content %q: %v", buf, err)
+	}
+
+	// Unchanged, the manifest is not downloaded again and no documents
+	// are fetched.
+	requests = nil
+	r, err = s.Sync()
+	if err != nil || len(r.Documents) != 2 || len(r.Fetched) != 0 || len(requests) != 1 {
+		t.Fatalf("unexpected result %+v %v: %v", r, requests, err)
+	}
+
+	// Only the changed document is fetched, and documents removed from
+	// the manifest are removed.
+	docs["/docs/ssh.json"] = `{ "objects": [], "tests": [] }`
+	setManifest(policy.Manifest{Documents: []policy.Document{
+		{Name: "team/ssh.json", SHA256: digest(docs["/docs/ssh.json"]), URL: "ssh.json"},
+	}})
+	requests = nil
+	r, err = s.Sync()
+	if err != nil || !reflect.DeepEqual(r.Documents, []string{ssh}) || !reflect.DeepEqual(r.Fetched, []string{"team/ssh.json"}) ||
+		!reflect.DeepEqual(r.Removed, []string{"base.json"}) || !reflect.DeepEqual(requests, []string{"/docs/manifest.json", "/docs/ssh.json"}) {
+		t.Fatalf("unexpected result %+v %v: %v", r, requests, err)
+	}
+	if _, err := os.Stat(base); !os.IsNotExist(err) {
+		t.Fatalf("removed document was not deleted: %v", err)
+	}
+
+	// A document that does not match its digest does not replace the
+	// local copy.
+	docs["/docs/ssh.json"] = "tampered"
+	setManifest(policy.Manifest{Documents: []policy.Document{
+		{Name: "team/ssh.json", SHA256: digest("expected"), URL: "ssh.json"},
+	}})
+	r, err = s.Sync()
+	if err == nil || !strings.Contains(err.Error(), "sha256 does not match") || len(r.Documents) != 1 {
+		t.Fatalf("unexpected result %+v: %v", r, err)
+	}
+	buf, err = ioutil.ReadFile(ssh)
+	if err != nil || string(buf) != `{ "objects": [], "tests": [] }` {
+		t.Fatalf("unexpected document content %q: %v", buf, err)
+	}
+
+	// If the manifest can not be fetched the documents of the last sync
+	// are returned.
+	s.ManifestURL = srv.URL + "/docs/missing.json"
+	r, err = s.Sync()
+	if err == nil || !reflect.DeepEqual(r.Documents, []string{ssh}) {
+		t.Fatalf("unexpected result %+v: %v", r, err)
+	}
+
+	// A manifest older than the last one applied is rejected, including
+	// after a restart, so documents can not be rolled back.
+	s.ManifestURL = srv.URL + "/docs/manifest.json"
+	old := manifest
+	docs["/docs/ssh.json"] = `{ "objects": [] }`
+	setManifest(policy.Manifest{Documents: []policy.Document{
+		{Name: "team/ssh.json", SHA256: digest(docs["/docs/ssh.json"]), URL: "ssh.json"},
+	}})
+	_, err = s.Sync()
+	if err != nil {
+		t.Fatalf("Syncer.Sync: %v", err)
+	}
+	latest := manifest
+	manifest = old
+	restarted := policy.Syncer{ManifestURL: s.ManifestURL, Dir: dir, Key: pub, Client: srv.Client()}
+	r, err = restarted.Sync()
+	if err == nil || !strings.Contains(err.Error(), "older than the last applied") || !reflect.DeepEqual(r.Documents, []string{ssh}) {
+		t.Fatalf("Syncer.Sync should have failed for old manifest %+v: %v", r, err)
+	}
+	buf, err = ioutil.ReadFile(ssh)
+	if err != nil || string(buf) != `{ "objects": [] }` {
+		t.Fatalf("unexpected document content %q: %v", buf, err)
+	}
+
+	// Manifests are only accepted without a key if Insecure is set.
+	manifest = latest
+	nokey := policy.Syncer{ManifestURL: s.ManifestURL, Dir: t.TempDir(), Client: srv.Client()}
+	_, err = nokey.Sync()
+	if err == nil || !strings.Contains(err.Error(), "without a public key") {
+		t.Fatalf("Syncer.Sync should have failed without a key: %v", err)
+	}
+	nokey.Insecure = true
+	_, err = nokey.Sync()
+	if err != nil {
+		t.Fatalf("Syncer.Sync: %v", err)
+	}
+
+	// Unsigned manifests and names outside the directory are rejected.
+	m := policy.Manifest{Documents: []policy.Document{{Name: "base.json", SHA256: digest(docs["/docs/base.json"])}}}
+	manifest, _ = json.Marshal(m)
+	_, err = s.Sync()
+	if err == nil || !strings.Contains(err.Error(), "not signed") {
+		t.Fatalf("Syncer.Sync should have failed for unsigned manifest: %v", err)
+	}
+	for _, x := range []string{"../base.json", "/etc/base.json", "team/../../base.json", ".manifest.json", ""} {
+		setManifest(policy.Manifest{Documents: []policy.Document{{Name: x, SHA256: digest("")}}})
+		_, err = s.Sync()
+		if err == nil || !strings.Contains(err.Error(), "invalid document name") {
+			t.Fatalf("Syncer.Sync should have failed for %q: %v", x, err)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+//go:build linux
+// +build linux
+
+package scribe
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	goruntime "runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// O_PATH from linux/fcntl.h, which the syscall package does not define on
+// every architecture; the value is the same on all architectures supported.
+const oPath = 0x200000
+
+// The number of symbolic links followed while resolving a path, matching
+// the limit of the kernel.
+const maxSymlinks = 40
+
+// userLinkError is returned when resolving a path as root finds a symbolic
+// link owned by a user other than root.
+type userLinkError struct {
+	uid uint32
+	gid uint32
+}
+
+func (e *userLinkError) Error() string {
+	return fmt.Sprintf("symbolic link owned by uid %v", e.uid)
+}
+
+// Open the file at p with the privileges of the user owning it. When
+// running as root, the path is resolved as root one component at a time and
+// the owner of the opened file is taken from the descriptor. Files owned by
+// root are returned as opened; otherwise the file is opened again with the
+// file system user and group IDs and the supplementary groups of the calling
+// thread set to the owner and the groups of the owner, so the file is only
+// opened if the owner could open it (for example on NFS exports with root
+// squashing), and the result must be the file opened as root.
+//
+// Symbolic links owned by root are followed. If the path contains a link
+// owned by another user, the whole path is resolved with the privileges of
+// the owner of the link, so links created by a user can not be used to read
+// files the user can not access. If the credentials can not be changed the
+// file is not opened.
+func openAsOwner(p string) (*os.File, error) {
+	if os.Geteuid() != 0 {
+		return os.Open(p)
+	}
+	fd, err := openRootPath(p)
+	if lerr, ok := err.(*userLinkError); ok {
+		return openAs(p, lerr.uid, lerr.gid, 0)
+	}
+	if err != nil {
+		if !os.IsPermission(err) {
+			return nil, err
+		}
+		// Root can be denied access, for example with root squashing. The
+		// file is opened as the owner reported by Lstat; this can not give
+		// access to more than root has, and links are not followed.
+		fi, lerr := os.Lstat(p)
+		if lerr != nil {
+			return nil, err
+		}
+		uid, gid, ok := fileOwner(fi)
+		if !ok || uid == 0 {
+			return nil, err
+		}
+		return openAs(p, uid, gid, syscall.O_NOFOLLOW)
+	}
+	fi, err := fd.Stat()
+	if err != nil {
+		fd.Close()
+		return nil, err
+	}
+	uid, gid, ok := fileOwner(fi)
+	if !ok || uid == 0 {
+		return fd, nil
+	}
+	fd.Close()
+	ofd, err := openAs(p, uid, gid, syscall.O_NOFOLLOW)
+	if err != nil {
+		return nil, err
+	}
+	ofi, err := ofd.Stat()
+	if err != nil {
+		ofd.Close()
+		return nil, err
+	}
+	if !os.SameFile(fi, ofi) {
+		ofd.Close()
+		return nil, fmt.Errorf("%v: file changed while it was opened", p)
+	}
+	return ofd, nil
+}
+
+// Open the file at p as root. The path is resolved one component at a time
+// relative to the descriptor of the directory containing it, without
+// following symbolic links, so a component replaced while the path is
+// resolved can not redirect the open. Symbolic links owned by root are read
+// through a descriptor and resolved the same way; if a link owned by another
+// user is found a *userLinkError is returned.
+func openRootPath(p string) (*os.File, error) {
+	comps := splitPath(p)
+	dirfd, err := openRootDir(p)
+	if err != nil {
+		return nil, err
+	}
+	links := 0
+	for len(comps) > 0 {
+		name := comps[0]
+		comps = comps[1:]
+		flags := syscall.O_RDONLY | syscall.O_CLOEXEC | syscall.O_NOFOLLOW
+		if len(comps) > 0 {
+			flags |= syscall.O_DIRECTORY
+		}
+		fd, err := syscall.Openat(dirfd, name, flags, 0)
+		// A symbolic link fails with ELOOP, or with ENOTDIR if a directory
+		// is expected; in the latter case the component may also not be a
+		// link, which readlinkat reports with EINVAL.
+		if err == syscall.ELOOP || err == syscall.ENOTDIR {
+			links++
+			if links > maxSymlinks {
+				syscall.Close(dirfd)
+				return nil, &os.PathError{Op: "open", Path: p, Err: syscall.ELOOP}
+			}
+			target, lerr := readRootLink(dirfd, name)
+			if lerr != nil {
+				syscall.Close(dirfd)
+				if _, ok := lerr.(*userLinkError); ok {
+					return nil, lerr
+				}
+				if lerr == syscall.EINVAL {
+					return nil, &os.PathError{Op: "open", Path: p, Err: err}
+				}
+				return nil, &os.PathError{Op: "readlink", Path: p, Err: lerr}
+			}
+			comps = append(splitPath(target), comps...)
+			if filepath.IsAbs(target) {
+				syscall.Close(dirfd)
+				dirfd, err = openRootDir(target)
+				if err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+		syscall.Close(dirfd)
+		if err != nil {
+			return nil, &os.PathError{Op: "open", Path: p, Err: err}
+		}
+		dirfd = fd
+	}
+	return os.NewFile(uintptr(dirfd), p), nil
+}
+
+// Open the directory a path is resolved from, the root directory for an
+// absolute path or the working directory otherwise.
+func openRootDir(p string) (int, error) {
+	dir := "."
+	if filepath.IsAbs(p) {
+		dir = "/"
+	}
+	fd, err := syscall.Open(dir, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, &os.PathError{Op: "open", Path: dir, Err: err}
+	}
+	return fd, nil
+}
+
+// Split a path into its components, omitting empty and "." components.
+func splitPath(p string) []string {
+	ret := make([]string, 0)
+	for _, x := range strings.Split(p, "/") {
+		if x == "" || x == "." {
+			continue
+		}
+		ret = append(ret, x)
+	}
+	return ret
+}
+
+// Return the target of the symbolic link name in the directory dirfd if it
+// is owned by root. The link is opened with O_PATH and read through that
+// descriptor, so the owner checked is the owner of the link that is read.
+func readRootLink(dirfd int, name string) (string, error) {
+	fd, err := syscall.Openat(dirfd, name, oPath|syscall.O_NOFOLLOW|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return "", err
+	}
+	defer syscall.Close(fd)
+	var st syscall.Stat_t
+	err = syscall.Fstat(fd, &st)
+	if err != nil {
+		return "", err
+	}
+	if st.Uid != 0 {
+		return "", &userLinkError{uid: st.Uid, gid: st.Gid}
+	}
+	// readlinkat with an empty path reads the link the descriptor refers to.
+	empty := []byte{0}
+	buf := make([]byte, syscall.PathMax)
+	n, _, errno := syscall.Syscall6(syscall.SYS_READLINKAT, uintptr(fd),
+		uintptr(unsafe.Pointer(&empty[0])), uintptr(unsafe.Pointer(&buf[0])),
+		uintptr(len(buf)), 0, 0)
+	if errno != 0 {
+		return "", errno
+	}
+	return string(buf[:n]), nil
+}
+
+// Open the file at p with the credentials of uid, the primary group of the
+// user, or gid if the user is unknown, and the groups of the user. flag is
+// added to the flags the file is opened with.
+func openAs(p string, uid, gid uint32, flag int) (*os.File, error) {
+	groups := make([]uint32, 0)
+	if u, err := user.LookupId(strconv.FormatUint(uint64(uid), 10)); err == nil {
+		if v, err := strconv.ParseUint(u.Gid, 10, 32); err == nil {
+			gid = uint32(v)
+		}
+		if ids, err := u.GroupIds(); err == nil {
+			for _, x := range ids {
+				if v, err := strconv.ParseUint(x, 10, 32); err == nil && uint32(v) != gid {
+					groups = append(groups, uint32(v))
+				}
+			}
+		}
+	}
+	groups = append(groups, gid)
+	debugPrint("openAs(): opening %v as uid %v gid %v groups %v\n", p, uid, gid, groups)
+	// Credentials apply to the calling thread only. The file is opened in a
+	// goroutine locked to its thread and the credentials are not restored;
+	// the thread exits with the goroutine, so it is never reused with the
+	// credentials of the owner.
+	type openResult struct {
+		fd  *os.File
+		err error
+	}
+	ch := make(chan openResult)
+	go func() {
+		goruntime.LockOSThread()
+		var r openResult
+		r.err = setThreadCredentials(uid, gid, groups)
+		if r.err == nil {
+			r.fd, r.err = os.OpenFile(p, os.O_RDONLY|flag, 0)
+		}
+		ch <- r
+	}()
+	r := <-ch
+	return r.fd, r.err
+}
+
+// Set the file system user and group IDs and the supplementary groups of
+// the calling thread. The system calls are made directly, as the wrappers
+// in the syscall package either apply to all threads or do not report
+// failure; setfsuid and setfsgid only indicate failure by returning the
+// previous ID, so each is checked by calling it again with an invalid ID.
+func setThreadCredentials(uid, gid uint32, groups []uint32) error {
+	_, _, errno := syscall.RawSyscall(sysSetgroups, uintptr(len(groups)),
+		uintptr(unsafe.Pointer(&groups[0])), 0)
+	if errno != 0 {
+		return fmt.Errorf("setgroups: %v", errno)
+	}
+	for _, x := range []struct {
+		name string
+		trap uintptr
+		id   uint32
+	}{
+		{"setfsgid", sysSetfsgid, gid},
+		{"setfsuid", sysSetfsuid, uid},
+	} {
+		syscall.RawSyscall(x.trap, uintptr(x.id), 0, 0)
+		cur, _, _ := syscall.RawSyscall(x.trap, uintptr(^uint32(0)), 0, 0)
+		if uint32(cur) != x.id {
+			return fmt.Errorf("%v: id is %v, expected %v", x.name, uint32(cur), x.id)
+		}
+	}
+	return nil
+}
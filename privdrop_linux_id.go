@@ -0,0 +1,22 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+//go:build linux && !386 && !arm
+// +build linux,!386,!arm
+
+package scribe
+
+import (
+	"syscall"
+)
+
+// System calls used to set the credentials of a thread.
+const (
+	sysSetfsuid  = syscall.SYS_SETFSUID
+	sysSetfsgid  = syscall.SYS_SETFSGID
+	sysSetgroups = syscall.SYS_SETGROUPS
+)
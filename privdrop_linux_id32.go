@@ -0,0 +1,24 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+//go:build linux && (386 || arm)
+// +build linux
+// +build 386 arm
+
+package scribe
+
+import (
+	"syscall"
+)
+
+// The system calls using 32-bit user and group IDs, the original calls on
+// these architectures use 16-bit IDs.
+const (
+	sysSetfsuid  = syscall.SYS_SETFSUID32
+	sysSetfsgid  = syscall.SYS_SETFSGID32
+	sysSetgroups = syscall.SYS_SETGROUPS32
+)
@@ -0,0 +1,22 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+//go:build !linux
+// +build !linux
+
+package scribe
+
+import (
+	"os"
+)
+
+// Opening files with the privileges of the owner requires per thread file
+// system IDs, which are only available on Linux, so files are opened
+// normally on other platforms.
+func openAsOwner(p string) (*os.File, error) {
+	return os.Open(p)
+}
@@ -0,0 +1,65 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"regexp"
+	"strings"
+)
+
+// The text substituted for redacted content.
+const redactedText = "[REDACTED]"
+
+// SetRedactions installs regular expressions used to redact content from
+// the host that is included in results, such as the context lines captured
+// around file content matches. This prevents sensitive data (for example
+// passwords in configuration files) from being included in results that are
+// sent elsewhere.
+//
+// If an expression contains capture groups, only the content matched by the
+// groups is redacted, otherwise the entire match is redacted. For example,
+// the expression (?i)password\s*=\s*(\S+) retains the name of the setting
+// but redacts its value. Passing nil removes any installed expressions.
+// Values used in evaluation are never redacted.
+func SetRedactions(exprs []string) error {
+	ret := make([]*regexp.Regexp, 0, len(exprs))
+	for _, x := range exprs {
+		re, err := regexp.Compile(x)
+		if err != nil {
+			return err
+		}
+		ret = append(ret, re)
+	}
+	sRuntime.redactions = ret
+	return nil
+}
+
+// Apply the installed redaction expressions to s.
+func redact(s string) string {
+	for _, re := range sRuntime.redactions {
+		if re.NumSubexp() == 0 {
+			s = re.ReplaceAllLiteralString(s, redactedText)
+			continue
+		}
+		var b strings.Builder
+		last := 0
+		for _, m := range re.FindAllStringSubmatchIndex(s, -1) {
+			for i := 2; i < len(m); i += 2 {
+				if m[i] < last {
+					continue
+				}
+				b.WriteString(s[last:m[i]])
+				b.WriteString(redactedText)
+				last = m[i+1]
+			}
+		}
+		b.WriteString(s[last:])
+		s = b.String()
+	}
+	return s
+}
@@ -14,12 +14,38 @@ import (
 // Regex is used to specify regular expression matching criteria within a test.
 type Regex struct {
 	Value string `json:"value,omitempty" yaml:"value,omitempty"`
+
+	re compiledRegexp
+}
+
+// compiledRegexp retains a compiled regular expression along with the
+// expression it was compiled from. Expressions are compiled during
+// validation and reused during preparation and evaluation; as fields may
+// change after validation as a result of variable expansion, the
+// expression is only compiled again if it differs from the one that was
+// compiled previously.
+type compiledRegexp struct {
+	expr string
+	re   *regexp.Regexp
+}
+
+func (c *compiledRegexp) compile(expr string) (*regexp.Regexp, error) {
+	if c.re != nil && c.expr == expr {
+		return c.re, nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	c.expr = expr
+	c.re = re
+	return re, nil
 }
 
 func (r *Regex) evaluate(c evaluationCriteria) (ret evaluationResult, err error) {
 	var re *regexp.Regexp
 	debugPrint("evaluate(): regexp %v \"%v\", \"%v\"\n", c.identifier, c.testValue, r.Value)
-	re, err = regexp.Compile(r.Value)
+	re, err = r.re.compile(r.Value)
 	if err != nil {
 		return
 	}
@@ -0,0 +1,153 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+// Package remote implements evaluation of scribe documents on remote hosts
+// over SSH.
+//
+// The executor uses the system ssh client, so existing SSH configuration
+// (keys, agents, known hosts and jump hosts) applies. A helper binary (a
+// scribecmd build for the remote platform) is streamed to a temporary file
+// on the remote host, the document is evaluated by the helper with results
+// streamed back as newline delimited JSON, and the helper is removed. No
+// software needs to be installed on the remote host.
+package remote
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/mozilla/scribe"
+)
+
+// Executor runs documents on a remote host.
+type Executor struct {
+	Host         string   // The remote host, optionally in user@host form.
+	Port         int      // The SSH port, if not the default.
+	IdentityFile string   // An optional private key to authenticate with.
+	HelperPath   string   // Local path to the helper binary for the remote platform.
+	SSHCommand   string   // The ssh client to use, defaults to ssh.
+	SSHArgs      []string // Additional arguments passed to the ssh client.
+	HelperArgs   []string // Additional arguments passed to the helper.
+}
+
+func (e *Executor) sshArgs(command string) []string {
+	args := []string{"-o", "BatchMode=yes"}
+	if e.Port != 0 {
+		args = append(args, "-p", strconv.Itoa(e.Port))
+	}
+	if e.IdentityFile != "" {
+		args = append(args, "-i", e.IdentityFile)
+	}
+	args = append(args, e.SSHArgs...)
+	// The host follows --, so a host beginning with - is not taken as an
+	// option.
+	return append(args, "--", e.Host, command)
+}
+
+func (e *Executor) ssh(command string, stdin io.Reader, stdout io.Writer) error {
+	sshcmd := e.SSHCommand
+	if sshcmd == "" {
+		sshcmd = "ssh"
+	}
+	var stderr bytes.Buffer
+	c := exec.Command(sshcmd, e.sshArgs(command)...)
+	c.Stdin = stdin
+	c.Stdout = stdout
+	c.Stderr = &stderr
+	err := c.Run()
+	if err != nil {
+		return fmt.Errorf("%v: %v: %v", e.Host, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// Quote s for use as a single argument in a remote shell command.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", "'\\''", -1) + "'"
+}
+
+// Upload the helper binary to the remote host, returning the remote path.
+func (e *Executor) upload() (string, error) {
+	fd, err := os.Open(e.HelperPath)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+	var out bytes.Buffer
+	err = e.ssh(`f=$(mktemp) && cat > "$f" && chmod 700 "$f" && echo "$f"`, fd, &out)
+	if err != nil {
+		return "", err
+	}
+	ret := strings.TrimSpace(out.String())
+	if ret == "" {
+		return "", fmt.Errorf("%v: unable to create remote helper", e.Host)
+	}
+	return ret, nil
+}
+
+// Run evaluates the document read from doc on the remote host, returning
+// the results of each test. The helper exits with a non-zero status when
+// tests fail, so the results it wrote are returned regardless of the exit
+// status; an error is returned if no results were written and the helper
+// or ssh failed, or if the results are not valid.
+func (e *Executor) Run(doc io.Reader) ([]scribe.TestResult, error) {
+	if e.Host == "" {
+		return nil, fmt.Errorf("remote host must be set")
+	}
+	if e.HelperPath == "" {
+		return nil, fmt.Errorf("remote helper path must be set")
+	}
+	helper, err := e.upload()
+	if err != nil {
+		return nil, err
+	}
+	args := []string{shellQuote(helper), "-s", "-f", "-"}
+	for _, x := range e.HelperArgs {
+		args = append(args, shellQuote(x))
+	}
+	// Always remove the helper, preserving the exit status of the run.
+	command := fmt.Sprintf("%v; rc=$?; rm -f %v; exit $rc", strings.Join(args, " "),
+		shellQuote(helper))
+	var out bytes.Buffer
+	runErr := e.ssh(command, doc, &out)
+	ret, err := decodeResults(&out)
+	if err != nil {
+		if runErr != nil {
+			return nil, runErr
+		}
+		return nil, fmt.Errorf("%v: invalid results: %v", e.Host, err)
+	}
+	if len(ret) == 0 && runErr != nil {
+		return nil, runErr
+	}
+	return ret, nil
+}
+
+// Decode newline delimited JSON results as produced by
+// scribe.AnalyzeDocumentStream().
+func decodeResults(r io.Reader) ([]scribe.TestResult, error) {
+	ret := make([]scribe.TestResult, 0)
+	dec := json.NewDecoder(r)
+	for {
+		var tr scribe.TestResult
+		err := dec.Decode(&tr)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, tr)
+	}
+	return ret, nil
+}
@@ -0,0 +1,132 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package remote_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/mozilla/scribe/remote"
+)
+
+// The ssh client used in tests records its arguments and runs the remote
+// command locally.
+const fakeSSH = `#!/bin/sh
+printf '%s\n' "$@" > "$REMOTE_TEST_DIR/ssh-args"
+for x; do cmd=$x; done
+exec sh -c "$cmd"
+`
+
+// The helper records its path, consumes the document and writes the output
+// and exit status set by the test.
+const fakeHelper = `#!/bin/sh
+echo "$0" > "$REMOTE_TEST_DIR/helper-path"
+cat > "$REMOTE_TEST_DIR/document"
+printf '%s' "$REMOTE_TEST_OUTPUT"
+exit $REMOTE_TEST_STATUS
+`
+
+const testResults = `{"testid": "sshd-root", "masterresult": true}
+{"testid": "telnet", "masterresult": false}
+`
+
+// Install the fake ssh client on PATH, returning the executor and the
+// directory the fake commands record to.
+func setupFakeSSH(t *testing.T) (remote.Executor, string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "bin")
+	err := os.Mkdir(bin, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(bin, "ssh"), []byte(fakeSSH), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	helper := filepath.Join(dir, "helper")
+	err = ioutil.WriteFile(helper, []byte(fakeHelper), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("REMOTE_TEST_DIR", dir)
+	return remote.Executor{Host: "-oProxyCommand=false", Port: 2222, HelperPath: helper}, dir
+}
+
+func TestExecutorRun(t *testing.T) {
+	e, dir := setupFakeSSH(t)
+	// Failing tests give a non-zero exit status, which is not an error.
+	t.Setenv("REMOTE_TEST_OUTPUT", testResults)
+	t.Setenv("REMOTE_TEST_STATUS", "1")
+	res, err := e.Run(strings.NewReader(`{"tests": []}`))
+	if err != nil {
+		t.Fatalf("Executor.Run: %v", err)
+	}
+	if len(res) != 2 || res[0].TestID != "sshd-root" || !res[0].MasterResult ||
+		res[1].TestID != "telnet" || res[1].MasterResult {
+		t.Fatalf("unexpected results %+v", res)
+	}
+
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "ssh-args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := strings.Split(strings.TrimSpace(string(buf)), "\n")
+	if len(args) < 3 || args[len(args)-3] != "--" || args[len(args)-2] != e.Host {
+		t.Fatalf("host does not follow --: %q", args)
+	}
+	buf, err = ioutil.ReadFile(filepath.Join(dir, "document"))
+	if err != nil || string(buf) != `{"tests": []}` {
+		t.Fatalf("document was not passed to the helper: %q %v", buf, err)
+	}
+	// The uploaded helper is removed after the run.
+	buf, err = ioutil.ReadFile(filepath.Join(dir, "helper-path"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(strings.TrimSpace(string(buf))); !os.IsNotExist(err) {
+		t.Fatalf("remote helper was not removed: %v", err)
+	}
+}
+
+func TestExecutorRunErrors(t *testing.T) {
+	e, _ := setupFakeSSH(t)
+	for _, x := range []struct {
+		output string
+		status string
+		want   string
+	}{
+		{"", "1", "exit status 1"},
+		{"", "255", "exit status 255"},
+		{"{\"testid\": ", "0", "invalid results"},
+		{"not json\n", "0", "invalid results"},
+		{testResults + "{\"testid\"", "2", "exit status 2"},
+	} {
+		t.Setenv("REMOTE_TEST_OUTPUT", x.output)
+		t.Setenv("REMOTE_TEST_STATUS", x.status)
+		_, err := e.Run(strings.NewReader("{}"))
+		if err == nil || !strings.Contains(err.Error(), x.want) {
+			t.Fatalf("output %q status %v: expected error containing %q, got %v", x.output, x.status, x.want, err)
+		}
+	}
+
+	// Without output and with a zero exit status there are no results.
+	t.Setenv("REMOTE_TEST_OUTPUT", "")
+	t.Setenv("REMOTE_TEST_STATUS", "0")
+	res, err := e.Run(strings.NewReader("{}"))
+	if err != nil || len(res) != 0 {
+		t.Fatalf("unexpected results %v %v", res, err)
+	}
+}
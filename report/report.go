@@ -0,0 +1,240 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+// Package report renders scribe test results into human readable reports.
+//
+// Reports are self-contained HTML or Markdown documents, with results
+// grouped into sections based on the value of a test tag. Each test includes
+// the outcome, description, an excerpt of any identifiers that evaluated to
+// false, and the remediation text for the test if present.
+package report
+
+import (
+	"fmt"
+	htemplate "html/template"
+	"io"
+	"sort"
+	"strings"
+	ttemplate "text/template"
+
+	"github.com/mozilla/scribe"
+)
+
+// Options controls how a report is rendered.
+type Options struct {
+	Title       string // The title of the report.
+	GroupTag    string // The test tag key used to group results into sections.
+	MaxExcerpts int    // The maximum number of false identifiers shown per test.
+}
+
+const defaultMaxExcerpts = 10
+
+type reportSection struct {
+	Name  string
+	Tests []reportTest
+}
+
+type reportTest struct {
+	Name        string
+	TestID      string
+	Outcome     string
+	Description string
+	Remediation string
+	Owner       string
+	Contact     string
+	Error       string
+	Waiver      string
+	Reason      string // The reason a test is not applicable.
+	Tags        []scribe.TestTag
+	Excerpts    []string
+	Omitted     int
+}
+
+type reportData struct {
+	Title    string
+	Sections []reportSection
+	Counts   map[string]int
+}
+
+func outcome(r scribe.TestResult) string {
+	if r.Waived {
+		return "waived"
+	}
+	if r.NotApplicable {
+		return "notapplicable"
+	}
+	if r.IsError {
+		return "error"
+	}
+	if r.MasterResult {
+		return "true"
+	}
+	return "false"
+}
+
+func buildReport(results []scribe.TestResult, opts Options) reportData {
+	ret := reportData{Title: opts.Title, Counts: make(map[string]int)}
+	if ret.Title == "" {
+		ret.Title = "scribe report"
+	}
+	maxex := opts.MaxExcerpts
+	if maxex == 0 {
+		maxex = defaultMaxExcerpts
+	}
+	sections := make(map[string]*reportSection)
+	order := make([]string, 0)
+	for _, x := range results {
+		name := "other"
+		if opts.GroupTag != "" {
+			for _, y := range x.Tags {
+				if y.Key == opts.GroupTag {
+					name = y.Value
+					break
+				}
+			}
+		} else {
+			name = "results"
+		}
+		sec, ok := sections[name]
+		if !ok {
+			sec = &reportSection{Name: name}
+			sections[name] = sec
+			order = append(order, name)
+		}
+		rt := reportTest{
+			Name:        x.TestName,
+			TestID:      x.TestID,
+			Outcome:     outcome(x),
+			Description: x.Description,
+			Remediation: x.Remediation,
+			Owner:       x.Owner,
+			Contact:     x.Contact,
+			Error:       x.Error,
+			Waiver:      x.WaiverJustification,
+			Reason:      x.NotApplicableReason,
+			Tags:        x.Tags,
+		}
+		if rt.Name == "" {
+			rt.Name = x.TestID
+		}
+		for _, y := range x.Results {
+			if y.Result {
+				continue
+			}
+			if len(rt.Excerpts) >= maxex {
+				rt.Omitted++
+				continue
+			}
+			if y.Location != nil && y.Location.Line != 0 {
+				rt.Excerpts = append(rt.Excerpts, fmt.Sprintf("%v:%v", y.Identifier, y.Location.Line))
+				continue
+			}
+			rt.Excerpts = append(rt.Excerpts, y.Identifier)
+		}
+		rt.Omitted += x.OmittedResults
+		ret.Counts[rt.Outcome]++
+		sec.Tests = append(sec.Tests, rt)
+	}
+	sort.Strings(order)
+	for _, x := range order {
+		ret.Sections = append(ret.Sections, *sections[x])
+	}
+	return ret
+}
+
+var htmlReport = htemplate.Must(htemplate.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.4em; text-align: left; vertical-align: top; }
+.true { background-color: #d4edda; }
+.false { background-color: #f8d7da; }
+.error { background-color: #fff3cd; }
+.waived { background-color: #e2e3e5; }
+.notapplicable { background-color: #e2e3e5; }
+pre { margin: 0; white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>true: {{index .Counts "true"}}, false: {{index .Counts "false"}}, error: {{index .Counts "error"}}, waived: {{index .Counts "waived"}}{{with index .Counts "notapplicable"}}, not applicable: {{.}}{{end}}</p>
+{{range .Sections}}<h2>{{.Name}}</h2>
+<table>
+<tr><th>Test</th><th>Outcome</th><th>Details</th></tr>
+{{range .Tests}}<tr class="{{.Outcome}}">
+<td>{{.Name}}<br><small>{{.TestID}}</small></td>
+<td>{{.Outcome}}</td>
+<td>{{if .Description}}<p>{{.Description}}</p>{{end}}{{if .Error}}<p>error: {{.Error}}</p>{{end}}{{if .Waiver}}<p>waived: {{.Waiver}}</p>{{end}}{{if .Reason}}<p>not applicable: {{.Reason}}</p>{{end}}{{if .Excerpts}}<p>false identifiers:</p>
+<pre>{{range .Excerpts}}{{.}}
+{{end}}{{if .Omitted}}({{.Omitted}} more omitted)
+{{end}}</pre>{{end}}{{if .Remediation}}<p>remediation: {{.Remediation}}</p>{{end}}{{if .Owner}}<p>owner: {{.Owner}}{{if .Contact}} ({{.Contact}}){{end}}</p>{{end}}</td>
+</tr>
+{{end}}</table>
+{{end}}</body>
+</html>
+`))
+
+var markdownReport = ttemplate.Must(ttemplate.New("report").Funcs(ttemplate.FuncMap{
+	"md": mdEscape,
+}).Parse(`# {{md .Title}}
+
+true: {{index .Counts "true"}}, false: {{index .Counts "false"}}, error: {{index .Counts "error"}}, waived: {{index .Counts "waived"}}{{with index .Counts "notapplicable"}}, not applicable: {{.}}{{end}}
+{{range .Sections}}
+## {{md .Name}}
+{{range .Tests}}
+### {{md .Name}} ({{md .TestID}})
+
+**Outcome:** {{.Outcome}}
+{{if .Description}}
+{{md .Description}}
+{{end}}{{if .Error}}
+**Error:** {{md .Error}}
+{{end}}{{if .Waiver}}
+**Waived:** {{md .Waiver}}
+{{end}}{{if .Reason}}
+**Not applicable:** {{md .Reason}}
+{{end}}{{if .Excerpts}}
+False identifiers:
+
+` + "```" + `
+{{range .Excerpts}}{{.}}
+{{end}}{{if .Omitted}}({{.Omitted}} more omitted)
+{{end}}` + "```" + `
+{{end}}{{if .Remediation}}
+**Remediation:** {{md .Remediation}}
+{{end}}{{if .Owner}}
+**Owner:** {{md .Owner}}{{if .Contact}} ({{md .Contact}}){{end}}
+{{end}}{{end}}{{end}}`))
+
+func mdEscape(s string) string {
+	r := strings.NewReplacer("\\", "\\\\", "*", "\\*", "_", "\\_", "`", "\\`",
+		"#", "\\#", "<", "&lt;", ">", "&gt;")
+	return r.Replace(s)
+}
+
+// HTML renders results as a self-contained HTML report, writing the report
+// to w.
+func HTML(w io.Writer, results []scribe.TestResult, opts Options) error {
+	err := htmlReport.Execute(w, buildReport(results, opts))
+	if err != nil {
+		return fmt.Errorf("rendering html report: %v", err)
+	}
+	return nil
+}
+
+// Markdown renders results as a Markdown report, writing the report to w.
+func Markdown(w io.Writer, results []scribe.TestResult, opts Options) error {
+	err := markdownReport.Execute(w, buildReport(results, opts))
+	if err != nil {
+		return fmt.Errorf("rendering markdown report: %v", err)
+	}
+	return nil
+}
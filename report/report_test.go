@@ -0,0 +1,67 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package report_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/mozilla/scribe"
+	"github.com/mozilla/scribe/report"
+)
+
+var testResults = []scribe.TestResult{
+	{
+		TestID:       "sshd-root-login",
+		TestName:     "root login disabled",
+		Tags:         []scribe.TestTag{{Key: "section", Value: "ssh"}},
+		Remediation:  "Set PermitRootLogin no",
+		MasterResult: false,
+		Results: []scribe.TestSubResult{
+			{Result: false, Identifier: "/etc/ssh/sshd_config"},
+		},
+	},
+	{
+		TestID:       "auditd",
+		MasterResult: true,
+		Tags:         []scribe.TestTag{{Key: "section", Value: "audit"}},
+	},
+}
+
+func TestMarkdown(t *testing.T) {
+	var buf bytes.Buffer
+	err := report.Markdown(&buf, testResults, report.Options{GroupTag: "section"})
+	if err != nil {
+		t.Fatalf("report.Markdown: %v", err)
+	}
+	out := buf.String()
+	for _, x := range []string{"## audit", "## ssh", "/etc/ssh/sshd_config", "Set PermitRootLogin no"} {
+		if !strings.Contains(out, x) {
+			t.Fatalf("markdown report missing %q", x)
+		}
+	}
+	if strings.Index(out, "## audit") > strings.Index(out, "## ssh") {
+		t.Fatalf("markdown report sections not sorted")
+	}
+}
+
+func TestHTML(t *testing.T) {
+	var buf bytes.Buffer
+	err := report.HTML(&buf, testResults, report.Options{Title: "<baseline>"})
+	if err != nil {
+		t.Fatalf("report.HTML: %v", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "&lt;baseline&gt;") {
+		t.Fatalf("html report title not escaped")
+	}
+	if !strings.Contains(out, `<tr class="false">`) {
+		t.Fatalf("html report missing outcome class")
+	}
+}
@@ -0,0 +1,586 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Repository is used to perform tests against the package repositories
+// configured for APT and YUM/DNF, so a policy can assert only approved
+// repositories are configured and that package signatures are verified.
+//
+// APT repositories are read from sources.list and sources.list.d (in both
+// the one line and deb822 formats), and YUM/DNF repositories from
+// yum.repos.d. The identifier for each criteria is the repository, in the
+// form type uri suite for APT (for example deb http://deb.debian.org/debian
+// bookworm) and the repository ID for YUM. If Name is set, only
+// repositories with an identifier matching this regular expression are
+// included.
+//
+// Property specifies what is returned as the test value, and can be one
+// of:
+//
+// url: the URL of the repository; for YUM repositories a criteria is
+// returned for each baseurl, mirrorlist and metalink
+//
+// enabled: true if the repository is enabled, otherwise false
+//
+// gpgcheck: true if package signatures from the repository are verified,
+// otherwise false. APT repositories are verified unless trusted=yes is set,
+// YUM repositories if gpgcheck is enabled for the repository, or in the
+// main configuration if the repository does not set it.
+//
+// key: the fingerprint of each OpenPGP key trusted to sign the repository,
+// in upper case hex. For APT repositories these are the keys in signed-by,
+// or in the global trusted keyrings if signed-by is not set; for YUM
+// repositories the keys in local gpgkey files.
+//
+// Disabled repositories are only included for the enabled property.
+type Repository struct {
+	Property string `json:"property,omitempty" yaml:"property,omitempty"`
+	Name     string `json:"name,omitempty" yaml:"name,omitempty"`
+
+	nameRe  compiledRegexp
+	matches []repositoryMatch
+}
+
+type repositoryMatch struct {
+	identifier string
+	value      string
+}
+
+type repositoryInfo struct {
+	identifier string
+	urls       []string
+	enabled    bool
+	gpgcheck   bool
+	keyFiles   []string // Paths of keyrings, relative to the root.
+	keys       []string // Inline armored keys.
+}
+
+// The root of the file system repository configuration is read from.
+var repositoryRoot = "/"
+
+func (r *Repository) isChain() bool {
+	return false
+}
+
+func (r *Repository) fireChains(d *Document) ([]evaluationCriteria, error) {
+	return nil, nil
+}
+
+func (r *Repository) mergeCriteria(c []evaluationCriteria) {
+}
+
+func (r *Repository) validate(d *Document) error {
+	switch r.Property {
+	case "url", "enabled", "gpgcheck", "key":
+	default:
+		return fmt.Errorf("repository property must be url, enabled, gpgcheck or key")
+	}
+	_, err := r.nameRe.compile(r.Name)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *Repository) expandVariables(v []Variable) {
+}
+
+func (r *Repository) getCriteria() (ret []evaluationCriteria) {
+	for _, x := range r.matches {
+		n := evaluationCriteria{}
+		n.identifier = x.identifier
+		n.testValue = x.value
+		ret = append(ret, n)
+	}
+	return ret
+}
+
+func (r *Repository) prepare() error {
+	debugPrint("prepare(): inspecting package repositories, property \"%v\"\n", r.Property)
+	re, err := r.nameRe.compile(r.Name)
+	if err != nil {
+		return err
+	}
+	root := repositoryRoot
+	if sRuntime.testHooks {
+		root = "./test/repository"
+	}
+	repos := append(aptRepositories(root), yumRepositories(root)...)
+	for _, x := range repos {
+		if !re.MatchString(x.identifier) {
+			continue
+		}
+		if r.Property == "enabled" {
+			r.matches = append(r.matches, repositoryMatch{x.identifier, strconv.FormatBool(x.enabled)})
+			continue
+		}
+		if !x.enabled {
+			continue
+		}
+		switch r.Property {
+		case "url":
+			for _, y := range x.urls {
+				r.matches = append(r.matches, repositoryMatch{x.identifier, y})
+			}
+		case "gpgcheck":
+			r.matches = append(r.matches, repositoryMatch{x.identifier, strconv.FormatBool(x.gpgcheck)})
+		case "key":
+			for _, y := range repositoryKeys(root, x) {
+				r.matches = append(r.matches, repositoryMatch{x.identifier, y})
+			}
+		}
+	}
+	return nil
+}
+
+// Return the fingerprints of the keys trusted by repository x.
+func repositoryKeys(root string, x repositoryInfo) []string {
+	seen := make(map[string]bool)
+	ret := make([]string, 0)
+	add := func(buf []byte) {
+		fps, err := pgpFingerprints(buf)
+		if err != nil {
+			debugPrint("repositoryKeys(): %v: %v\n", x.identifier, err)
+			return
+		}
+		for _, y := range fps {
+			if !seen[y] {
+				seen[y] = true
+				ret = append(ret, y)
+			}
+		}
+	}
+	for _, y := range x.keys {
+		add([]byte(y))
+	}
+	for _, y := range x.keyFiles {
+		buf, err := ioutil.ReadFile(filepath.Join(root, y))
+		if err != nil {
+			debugPrint("repositoryKeys(): %v: %v\n", x.identifier, err)
+			continue
+		}
+		add(buf)
+	}
+	return ret
+}
+
+// Return the files matching pattern under root, sorted.
+func rootGlob(root string, pattern string) []string {
+	ret, _ := filepath.Glob(filepath.Join(root, pattern))
+	sort.Strings(ret)
+	return ret
+}
+
+// Return the APT repositories configured under root.
+func aptRepositories(root string) []repositoryInfo {
+	// Repositories without signed-by trust the global keyrings.
+	global := []string{"/etc/apt/trusted.gpg"}
+	for _, x := range append(rootGlob(root, "/etc/apt/trusted.gpg.d/*.gpg"), rootGlob(root, "/etc/apt/trusted.gpg.d/*.asc")...) {
+		rel, err := filepath.Rel(root, x)
+		if err == nil {
+			global = append(global, "/"+filepath.ToSlash(rel))
+		}
+	}
+	ret := make([]repositoryInfo, 0)
+	files := append(rootGlob(root, "/etc/apt/sources.list"), rootGlob(root, "/etc/apt/sources.list.d/*.list")...)
+	for _, x := range files {
+		buf, err := ioutil.ReadFile(x)
+		if err != nil {
+			continue
+		}
+		ret = append(ret, parseAptList(buf, global)...)
+	}
+	for _, x := range rootGlob(root, "/etc/apt/sources.list.d/*.sources") {
+		buf, err := ioutil.ReadFile(x)
+		if err != nil {
+			continue
+		}
+		ret = append(ret, parseAptSources(buf, global)...)
+	}
+	return ret
+}
+
+// Parse APT repositories in the one line format, such as
+// deb [signed-by=/usr/share/keyrings/example.gpg] https://example.com stable main
+func parseAptList(buf []byte, global []string) []repositoryInfo {
+	ret := make([]repositoryInfo, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i != -1 {
+			line = line[:i]
+		}
+		f := strings.Fields(line)
+		if len(f) < 3 || (f[0] != "deb" && f[0] != "deb-src") {
+			continue
+		}
+		opts := make(map[string]string)
+		if strings.HasPrefix(f[1], "[") {
+			i := 1
+			for ; i < len(f); i++ {
+				s := strings.Trim(f[i], "[]")
+				if kv := strings.SplitN(s, "=", 2); len(kv) == 2 {
+					opts[kv[0]] = kv[1]
+				}
+				if strings.HasSuffix(f[i], "]") {
+					break
+				}
+			}
+			f = append([]string{f[0]}, f[i+1:]...)
+		}
+		if len(f) < 3 {
+			continue
+		}
+		ret = append(ret, aptRepository(f[0], f[1], f[2], opts["signed-by"], opts["trusted"], true, global))
+	}
+	return ret
+}
+
+// Parse APT repositories in the deb822 format, where each stanza can
+// describe several repositories.
+func parseAptSources(buf []byte, global []string) []repositoryInfo {
+	ret := make([]repositoryInfo, 0)
+	for _, stanza := range parseDeb822(buf) {
+		enabled := !strings.EqualFold(stanza["enabled"], "no")
+		for _, t := range strings.Fields(stanza["types"]) {
+			for _, u := range strings.Fields(stanza["uris"]) {
+				for _, s := range strings.Fields(stanza["suites"]) {
+					ret = append(ret, aptRepository(t, u, s, stanza["signed-by"], stanza["trusted"], enabled, global))
+				}
+			}
+		}
+	}
+	return ret
+}
+
+func aptRepository(typ string, uri string, suite string, signedBy string, trusted string, enabled bool, global []string) repositoryInfo {
+	ret := repositoryInfo{
+		identifier: typ + " " + uri + " " + suite,
+		urls:       []string{uri},
+		enabled:    enabled,
+		gpgcheck:   !strings.EqualFold(trusted, "yes"),
+	}
+	switch {
+	case strings.Contains(signedBy, "BEGIN PGP PUBLIC KEY BLOCK"):
+		ret.keys = []string{signedBy}
+	case signedBy != "":
+		// signed-by can also list fingerprints, which are used as is.
+		for _, x := range strings.FieldsFunc(signedBy, func(c rune) bool { return c == ',' || c == ' ' }) {
+			if strings.HasPrefix(x, "/") {
+				ret.keyFiles = append(ret.keyFiles, x)
+			} else {
+				ret.keys = append(ret.keys, x)
+			}
+		}
+	default:
+		ret.keyFiles = global
+	}
+	return ret
+}
+
+// Parse deb822 stanzas into maps of lower case field names to values.
+// Continuation lines are joined with newlines, with a line containing only
+// a period representing an empty line.
+func parseDeb822(buf []byte) []map[string]string {
+	ret := make([]map[string]string, 0)
+	cur := make(map[string]string)
+	last := ""
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.TrimSpace(line) == "":
+			if len(cur) > 0 {
+				ret = append(ret, cur)
+				cur = make(map[string]string)
+			}
+			last = ""
+		case strings.HasPrefix(line, "#"):
+		case line[0] == ' ' || line[0] == '\t':
+			if last == "" {
+				continue
+			}
+			s := strings.TrimSpace(line)
+			if s == "." {
+				s = ""
+			}
+			cur[last] += "\n" + s
+		default:
+			kv := strings.SplitN(line, ":", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			last = strings.ToLower(strings.TrimSpace(kv[0]))
+			cur[last] = strings.TrimSpace(kv[1])
+		}
+	}
+	if len(cur) > 0 {
+		ret = append(ret, cur)
+	}
+	return ret
+}
+
+// Return the YUM/DNF repositories configured under root.
+func yumRepositories(root string) []repositoryInfo {
+	// Repositories that do not set gpgcheck use the value from the main
+	// configuration.
+	defcheck := false
+	for _, x := range []string{"/etc/dnf/dnf.conf", "/etc/yum.conf"} {
+		buf, err := ioutil.ReadFile(filepath.Join(root, x))
+		if err != nil {
+			continue
+		}
+		for _, s := range parseINISections(buf) {
+			if s.name == "main" {
+				if v, ok := s.values["gpgcheck"]; ok {
+					defcheck = yumBool(v)
+				}
+			}
+		}
+		break
+	}
+	ret := make([]repositoryInfo, 0)
+	for _, x := range rootGlob(root, "/etc/yum.repos.d/*.repo") {
+		buf, err := ioutil.ReadFile(x)
+		if err != nil {
+			continue
+		}
+		for _, s := range parseINISections(buf) {
+			r := repositoryInfo{identifier: s.name, enabled: true, gpgcheck: defcheck}
+			if v, ok := s.values["enabled"]; ok {
+				r.enabled = yumBool(v)
+			}
+			if v, ok := s.values["gpgcheck"]; ok {
+				r.gpgcheck = yumBool(v)
+			}
+			for _, k := range []string{"baseurl", "mirrorlist", "metalink"} {
+				r.urls = append(r.urls, strings.Fields(strings.Replace(s.values[k], ",", " ", -1))...)
+			}
+			for _, k := range strings.Fields(strings.Replace(s.values["gpgkey"], ",", " ", -1)) {
+				u, err := url.Parse(k)
+				if err != nil || u.Scheme != "file" {
+					continue
+				}
+				r.keyFiles = append(r.keyFiles, u.Path)
+			}
+			ret = append(ret, r)
+		}
+	}
+	return ret
+}
+
+func yumBool(s string) bool {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "1", "yes", "true", "on":
+		return true
+	}
+	return false
+}
+
+type iniSection struct {
+	name   string
+	values map[string]string
+}
+
+// Parse the sections of an INI style file as used by YUM, where values can
+// continue on following indented lines.
+func parseINISections(buf []byte) []iniSection {
+	ret := make([]iniSection, 0)
+	var cur *iniSection
+	last := ""
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	for scanner.Scan() {
+		line := scanner.Text()
+		s := strings.TrimSpace(line)
+		if s == "" || strings.HasPrefix(s, "#") || strings.HasPrefix(s, ";") {
+			continue
+		}
+		if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+			ret = append(ret, iniSection{name: strings.TrimSpace(s[1 : len(s)-1]), values: make(map[string]string)})
+			cur = &ret[len(ret)-1]
+			last = ""
+			continue
+		}
+		if cur == nil {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && last != "" {
+			cur.values[last] += " " + s
+			continue
+		}
+		kv := strings.SplitN(s, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		last = strings.ToLower(strings.TrimSpace(kv[0]))
+		cur.values[last] = strings.TrimSpace(kv[1])
+	}
+	return ret
+}
+
+// Return the fingerprints of the primary keys in an OpenPGP keyring, in
+// binary or ASCII armored form. A string that is already a fingerprint is
+// returned as is.
+func pgpFingerprints(buf []byte) ([]string, error) {
+	s := strings.TrimSpace(string(buf))
+	if len(s) >= 40 && strings.Trim(strings.ToUpper(s), "0123456789ABCDEF") == "" {
+		return []string{strings.ToUpper(s)}, nil
+	}
+	if strings.Contains(s, "-----BEGIN PGP PUBLIC KEY BLOCK-----") {
+		ret := make([]string, 0)
+		for _, x := range pgpDearmor(s) {
+			fps, err := pgpPacketFingerprints(x)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, fps...)
+		}
+		return ret, nil
+	}
+	return pgpPacketFingerprints(buf)
+}
+
+// Decode the armored public key blocks in s.
+func pgpDearmor(s string) [][]byte {
+	ret := make([][]byte, 0)
+	var (
+		body    strings.Builder
+		inBlock bool
+		inData  bool
+	)
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "-----BEGIN PGP PUBLIC KEY BLOCK-----":
+			inBlock, inData = true, false
+			body.Reset()
+		case !inBlock:
+		case strings.HasPrefix(line, "-----END"):
+			buf, err := base64.StdEncoding.DecodeString(body.String())
+			if err == nil {
+				ret = append(ret, buf)
+			}
+			inBlock = false
+		case !inData:
+			// Armor headers are terminated by an empty line.
+			if line == "" {
+				inData = true
+			}
+		case strings.HasPrefix(line, "="):
+			// The checksum.
+		default:
+			body.WriteString(line)
+		}
+	}
+	return ret
+}
+
+// Return the fingerprints of the public key packets in binary OpenPGP
+// data. Version 4 fingerprints are a SHA-1 hash and version 5 and 6
+// fingerprints a SHA-256 hash of the key packet.
+func pgpPacketFingerprints(buf []byte) ([]string, error) {
+	ret := make([]string, 0)
+	for len(buf) > 0 {
+		tag, body, rest, err := pgpPacket(buf)
+		if err != nil {
+			return nil, err
+		}
+		buf = rest
+		if tag != 6 || len(body) == 0 {
+			continue
+		}
+		var h hash.Hash
+		switch body[0] {
+		case 4:
+			h = sha1.New()
+			h.Write([]byte{0x99, byte(len(body) >> 8), byte(len(body))})
+		case 5, 6:
+			h = sha256.New()
+			hdr := make([]byte, 5)
+			hdr[0] = 0x95 + body[0]
+			binary.BigEndian.PutUint32(hdr[1:], uint32(len(body)))
+			h.Write(hdr)
+		default:
+			continue
+		}
+		h.Write(body)
+		ret = append(ret, fmt.Sprintf("%X", h.Sum(nil)))
+	}
+	return ret, nil
+}
+
+// Read an OpenPGP packet from buf, returning the packet tag, the packet
+// body and the remaining data.
+func pgpPacket(buf []byte) (int, []byte, []byte, error) {
+	if len(buf) < 2 || buf[0]&0x80 == 0 {
+		return 0, nil, nil, fmt.Errorf("invalid OpenPGP packet")
+	}
+	var (
+		tag    int
+		length int
+		hlen   int
+	)
+	if buf[0]&0x40 != 0 {
+		tag = int(buf[0] & 0x3f)
+		switch l := int(buf[1]); {
+		case l < 192:
+			length, hlen = l, 2
+		case l < 224:
+			if len(buf) < 3 {
+				return 0, nil, nil, fmt.Errorf("invalid OpenPGP packet")
+			}
+			length, hlen = (l-192)<<8+int(buf[2])+192, 3
+		case l == 255:
+			if len(buf) < 6 {
+				return 0, nil, nil, fmt.Errorf("invalid OpenPGP packet")
+			}
+			length, hlen = int(binary.BigEndian.Uint32(buf[2:])), 6
+		default:
+			return 0, nil, nil, fmt.Errorf("partial OpenPGP packet lengths are not supported")
+		}
+	} else {
+		tag = int(buf[0]>>2) & 0x0f
+		switch buf[0] & 3 {
+		case 0:
+			length, hlen = int(buf[1]), 2
+		case 1:
+			if len(buf) < 3 {
+				return 0, nil, nil, fmt.Errorf("invalid OpenPGP packet")
+			}
+			length, hlen = int(binary.BigEndian.Uint16(buf[1:])), 3
+		case 2:
+			if len(buf) < 5 {
+				return 0, nil, nil, fmt.Errorf("invalid OpenPGP packet")
+			}
+			length, hlen = int(binary.BigEndian.Uint32(buf[1:])), 5
+		default:
+			length, hlen = len(buf)-1, 1
+		}
+	}
+	if length < 0 || hlen+length > len(buf) {
+		return 0, nil, nil, fmt.Errorf("truncated OpenPGP packet")
+	}
+	return tag, buf[hlen : hlen+length], buf[hlen+length:], nil
+}
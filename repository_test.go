@@ -0,0 +1,133 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// Used in TestRepositoryPolicy
+var repositoryPolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "repourl",
+		"repository": {
+			"property": "url"
+		}
+	},
+
+	{
+		"object": "repoenabled",
+		"repository": {
+			"property": "enabled",
+			"name": "^example|staging"
+		}
+	},
+
+	{
+		"object": "repogpgcheck",
+		"repository": {
+			"property": "gpgcheck"
+		}
+	},
+
+	{
+		"object": "repokey",
+		"repository": {
+			"property": "key"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "repository0",
+		"expectedresult": true,
+		"object": "repourl",
+		"regexp": {
+			"value": "^(https://|http://deb\\.debian\\.org/)"
+		}
+	},
+
+	{
+		"test": "repository1",
+		"expectedresult": true,
+		"object": "repoenabled",
+		"exactmatch": {
+			"value": "false"
+		}
+	},
+
+	{
+		"test": "repository2",
+		"expectedresult": true,
+		"object": "repogpgcheck",
+		"exactmatch": {
+			"value": "false"
+		}
+	},
+
+	{
+		"test": "repository3",
+		"expectedresult": true,
+		"object": "repokey",
+		"regexp": {
+			"value": "^[0-9A-F]{40}$"
+		}
+	}
+	]
+}
+`
+
+func TestRepositoryPolicy(t *testing.T) {
+	doc := genericTestExec(t, repositoryPolicyDoc)
+	var (
+		debian   = "4D64FEC119C2029067D6E791F8D2585B8783D481"
+		security = "05AB90340C0C5E797F44A8C8254CF3B5AEC0A8F0"
+	)
+	expect := map[string][]string{
+		"repository1": {
+			"example-base:true", "example-debug:false", "example-nocheck:true",
+			"deb https://staging.example.com/apt testing:false",
+		},
+		"repository2": {
+			"deb http://deb.debian.org/debian bookworm:true",
+			"deb-src http://deb.debian.org/debian bookworm:true",
+			"deb https://packages.example.com/apt stable:true",
+			"deb http://mirror.example.net/unsigned ./:false",
+			"deb http://deb.debian.org/debian-security bookworm-security:true",
+			"example-base:true", "example-nocheck:false",
+		},
+		"repository3": {
+			"deb http://deb.debian.org/debian bookworm:" + debian,
+			"deb-src http://deb.debian.org/debian bookworm:" + debian,
+			"deb https://packages.example.com/apt stable:" + security,
+			"deb http://mirror.example.net/unsigned ./:" + debian,
+			"deb http://deb.debian.org/debian-security bookworm-security:" + security,
+			"example-base:" + debian,
+		},
+	}
+	for k, v := range expect {
+		e, err := doc.ExplainTest(k)
+		if err != nil {
+			t.Fatalf("Document.ExplainTest: %v", err)
+		}
+		got := make([]string, 0)
+		for _, x := range e.Criteria {
+			got = append(got, x.Identifier+":"+x.Value)
+		}
+		sort.Strings(got)
+		sort.Strings(v)
+		if !reflect.DeepEqual(got, v) {
+			t.Fatalf("%v: unexpected criteria %v", k, got)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Restart is used to determine if the system or services running on the
+// system need to be restarted, for example following package upgrades.
+//
+// If Check is set to "reboot", the version of the running kernel is compared
+// to the newest installed kernel package. A single criteria is returned with
+// the running kernel version as the identifier, and a value of "true" if a
+// reboot is required, or "false" if not. KernelMatch can optionally be set
+// to a regular expression used to identify kernel packages.
+//
+// If Check is set to "service", the shared libraries mapped by running
+// processes are inspected. A criteria is returned for each process that is
+// still using a library that has been deleted from disk (for example
+// because the package that provided it has been upgraded), with the process
+// ID and name as the identifier and the deleted library as the value.
+type Restart struct {
+	Check       string `json:"check,omitempty" yaml:"check,omitempty"`
+	KernelMatch string `json:"kernelmatch,omitempty" yaml:"kernelmatch,omitempty"`
+
+	results []restartStatus
+}
+
+type restartStatus struct {
+	identifier string
+	value      string
+}
+
+const defaultKernelMatch = "^(kernel|kernel-core|linux-image-[0-9].*)$"
+
+// The file created on Debian based systems when a reboot is required.
+var rebootRequiredPath = "/var/run/reboot-required"
+
+func (r *Restart) isChain() bool {
+	return false
+}
+
+func (r *Restart) fireChains(d *Document) ([]evaluationCriteria, error) {
+	return nil, nil
+}
+
+func (r *Restart) mergeCriteria(c []evaluationCriteria) {
+}
+
+func (r *Restart) expandVariables(v []Variable) {
+}
+
+func (r *Restart) validate(d *Document) error {
+	switch r.Check {
+	case "reboot", "service":
+	default:
+		return fmt.Errorf("restart check must be reboot or service")
+	}
+	if len(r.KernelMatch) > 0 {
+		_, err := regexp.Compile(r.KernelMatch)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Restart) getCriteria() (ret []evaluationCriteria) {
+	for _, x := range r.results {
+		n := evaluationCriteria{}
+		n.identifier = x.identifier
+		n.testValue = x.value
+		ret = append(ret, n)
+	}
+	return ret
+}
+
+func (r *Restart) prepare() error {
+	debugPrint("prepare(): checking if %v restart is required\n", r.Check)
+	r.results = make([]restartStatus, 0)
+	if r.Check == "reboot" {
+		return r.prepareReboot()
+	}
+	return r.prepareService()
+}
+
+func (r *Restart) prepareReboot() error {
+	kmatch := r.KernelMatch
+	if kmatch == "" {
+		kmatch = defaultKernelMatch
+	}
+	running, err := runningKernel()
+	if err != nil {
+		return err
+	}
+	newest, err := newestKernel(kmatch)
+	if err != nil {
+		return err
+	}
+	required := false
+	if newest != "" && newest != running {
+		debugPrint("prepare(): running kernel %v, newest kernel %v\n", running, newest)
+		required = true
+	}
+	if !sRuntime.testHooks {
+		_, err = os.Stat(rebootRequiredPath)
+		if err == nil {
+			debugPrint("prepare(): %v exists\n", rebootRequiredPath)
+			required = true
+		}
+	}
+	r.results = append(r.results, restartStatus{identifier: running,
+		value: fmt.Sprintf("%v", required)})
+	return nil
+}
+
+func (r *Restart) prepareService() error {
+	consumers, err := getLibConsumers()
+	if err != nil {
+		return err
+	}
+	for _, x := range consumers {
+		for _, y := range x.libs {
+			if !y.deleted {
+				continue
+			}
+			debugPrint("prepare(): %v uses deleted library %v\n", x.identifier, y.path)
+			r.results = append(r.results, restartStatus{identifier: x.identifier,
+				value: y.path})
+		}
+	}
+	return nil
+}
+
+func runningKernel() (string, error) {
+	if sRuntime.testHooks {
+		return "2.6.32-504.12.2.el6.x86_64", nil
+	}
+	buf, err := ioutil.ReadFile("/proc/sys/kernel/osrelease")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(buf)), nil
+}
+
+// Return the kernel release string of the newest installed kernel package,
+// in the same format as would be reported by the running kernel.
+func newestKernel(kmatch string) (string, error) {
+	var ret string
+	re, err := regexp.Compile(kmatch)
+	if err != nil {
+		return "", err
+	}
+	for _, x := range getAllPackages().results {
+		if !re.MatchString(x.name) {
+			continue
+		}
+		var krel string
+		if x.pkgtype == "dpkg" {
+			// On Debian based systems the kernel release is part
+			// of the package name.
+			krel = strings.TrimPrefix(x.name, "linux-image-")
+		} else {
+			krel = x.version
+			if i := strings.Index(krel, ":"); i != -1 {
+				krel = krel[i+1:]
+			}
+			if x.arch != "" {
+				krel = krel + "." + x.arch
+			}
+		}
+		if ret == "" {
+			ret = krel
+			continue
+		}
+		f, err := evrCompare(EvropLessThan, ret, krel)
+		if err != nil {
+			return "", err
+		}
+		if f {
+			ret = krel
+		}
+	}
+	return ret, nil
+}
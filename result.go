@@ -10,6 +10,7 @@ package scribe
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 )
 
@@ -21,13 +22,39 @@ type TestResult struct {
 	Description string    `json:"description" yaml:"description"`       // Test description
 	Tags        []TestTag `json:"tags,omitempty" yaml:"tags,omitempty"` // Tags for the test.
 
+	Remediation string `json:"remediation,omitempty" yaml:"remediation,omitempty"` // Remediation steps for the test.
+	Owner       string `json:"owner,omitempty" yaml:"owner,omitempty"`             // The owner of the test.
+	Contact     string `json:"contact,omitempty" yaml:"contact,omitempty"`         // Contact details for the owner.
+
+	Waived              bool   `json:"waived,omitempty" yaml:"waived,omitempty"`                           // True if a failure was waived.
+	WaiverExpires       string `json:"waiverexpires,omitempty" yaml:"waiverexpires,omitempty"`             // Expiry date of the waiver.
+	WaiverJustification string `json:"waiverjustification,omitempty" yaml:"waiverjustification,omitempty"` // Justification for the waiver.
+
+	Metadata map[string]string `json:"metadata,omitempty" yaml:"metadata,omitempty"` // Metadata attached to the run.
+
+	// NotApplicable is true if the test was not evaluated because it
+	// uses an object that can not be evaluated on this system, when
+	// partial evaluation is enabled using SetPartialEvaluation().
+	NotApplicable       bool   `json:"notapplicable,omitempty" yaml:"notapplicable,omitempty"`
+	NotApplicableReason string `json:"notapplicablereason,omitempty" yaml:"notapplicablereason,omitempty"`
+
 	IsError bool   `json:"iserror" yaml:"iserror"` // True of error is encountered during evaluation.
 	Error   string `json:"error" yaml:"error"`     // Error associated with test.
 
 	MasterResult   bool `json:"masterresult" yaml:"masterresult"`     // Master result of test.
 	HasTrueResults bool `json:"hastrueresults" yaml:"hastrueresults"` // True if > 0 evaluations resulted in true.
 
+	Message string `json:"message,omitempty" yaml:"message,omitempty"` // Message returned by a script evaluator.
+
 	Results []TestSubResult `json:"results" yaml:"results"` // The sub-results for the test.
+
+	// If the number of false sub-results exceeded the limit for the
+	// test, the false sub-results over the limit are omitted from
+	// Results. TotalResults is the number of sub-results before any were
+	// omitted, and OmittedResults the number omitted. Both are zero if
+	// no sub-results were omitted.
+	TotalResults   int `json:"totalresults,omitempty" yaml:"totalresults,omitempty"`
+	OmittedResults int `json:"omittedresults,omitempty" yaml:"omittedresults,omitempty"`
 }
 
 // TestSubResult describes a sub-result for a test.
@@ -36,8 +63,30 @@ type TestResult struct {
 // criteria. For example, multiple files can be identified with a given
 // filename. Each test tracks individual results for these cases.
 type TestSubResult struct {
-	Result     bool   `json:"result" yaml:"result"`         // The result of evaluation for an identifier source.
-	Identifier string `json:"identifier" yaml:"identifier"` // The identifier for the source.
+	Result     bool      `json:"result" yaml:"result"`                         // The result of evaluation for an identifier source.
+	Identifier string    `json:"identifier" yaml:"identifier"`                 // The identifier for the source.
+	Location   *Location `json:"location,omitempty" yaml:"location,omitempty"` // Location of the match, if known.
+}
+
+// Location describes the position in a file content was matched at, so
+// tooling can point at the exact line that resulted in a criteria.
+type Location struct {
+	Line   int   `json:"line" yaml:"line"`     // The line number, starting at 1, or 0 if not known.
+	Offset int64 `json:"offset" yaml:"offset"` // The byte offset of the match from the start of the file.
+
+	Context []string `json:"context,omitempty" yaml:"context,omitempty"` // Lines surrounding the match, if captured.
+}
+
+// SetMaxFailures sets the maximum number of false sub-results included in
+// the results of tests that do not set a limit using maxfailures, so results
+// for objects matching very large numbers of files remain bounded. False
+// sub-results over the limit are counted in OmittedResults but not
+// included. The default of 0 includes all sub-results.
+func SetMaxFailures(n int) {
+	if n < 0 {
+		n = 0
+	}
+	sRuntime.maxFailures = n
 }
 
 // GetResults returns test results for a given test. Returns an error if for
@@ -50,24 +99,72 @@ func GetResults(d *Document, name string) (TestResult, error) {
 	ret := TestResult{}
 	ret.TestID = t.TestID
 	ret.TestName = t.TestName
-	ret.Description = t.Description
+	ret.Description = describeTest(t, t.Description)
+	ret.Remediation = describeTest(t, t.Remediation)
+	ret.Owner = t.Owner
+	ret.Contact = t.Contact
 	ret.Tags = t.Tags
+	if len(sRuntime.metadata) > 0 {
+		ret.Metadata = make(map[string]string)
+		for k, v := range sRuntime.metadata {
+			ret.Metadata[k] = v
+		}
+	}
+	if t.notApplicable != "" {
+		ret.NotApplicable = true
+		ret.NotApplicableReason = t.notApplicable
+		return ret, nil
+	}
 	if t.err != nil {
 		ret.Error = fmt.Sprintf("%v", t.err)
 		ret.IsError = true
+		ret.applyWaiver(t)
 		return ret, nil
 	}
 	ret.MasterResult = t.masterResult
 	ret.HasTrueResults = t.hasTrueResults
+	ret.Message = t.Script.message
+	limit := t.MaxFailures
+	if limit == 0 {
+		limit = sRuntime.maxFailures
+	}
+	nfalse := 0
 	for _, x := range t.results {
+		if !x.result {
+			nfalse++
+			if limit > 0 && nfalse > limit {
+				ret.OmittedResults++
+				continue
+			}
+		}
 		nr := TestSubResult{}
 		nr.Result = x.result
 		nr.Identifier = x.criteria.identifier
+		nr.Location = x.criteria.location
 		ret.Results = append(ret.Results, nr)
 	}
+	if ret.OmittedResults > 0 {
+		ret.TotalResults = len(t.results)
+	}
+	ret.applyWaiver(t)
 	return ret, nil
 }
 
+// If the test failed and an active waiver exists for the test, mark the
+// result as waived.
+func (r *TestResult) applyWaiver(t *Test) {
+	if !r.IsError && r.MasterResult == t.ExpectedResult {
+		return
+	}
+	w := getWaiver(t.TestID)
+	if w == nil {
+		return
+	}
+	r.Waived = true
+	r.WaiverExpires = w.Expires
+	r.WaiverJustification = w.Justification
+}
+
 // SingleLineResults is a helper function to convert Testresult r into a slice
 // of greppable single line results. Note that each line returned is not terminated
 // with a line feed.
@@ -75,7 +172,9 @@ func (r *TestResult) SingleLineResults() []string {
 	lns := make([]string, 0)
 
 	rs := "[error]"
-	if !r.IsError {
+	if r.NotApplicable {
+		rs = "[notapplicable]"
+	} else if !r.IsError {
 		if r.MasterResult {
 			rs = "[true]"
 		} else {
@@ -88,6 +187,19 @@ func (r *TestResult) SingleLineResults() []string {
 	}
 	buf := fmt.Sprintf("master %v name:\"%v\" id:\"%v\" hastrue:%v error:\"%v\"",
 		rs, namestr, r.TestID, r.HasTrueResults, r.Error)
+	if r.Waived {
+		buf += fmt.Sprintf(" waived:\"%v\"", r.WaiverExpires)
+	}
+	if r.OmittedResults > 0 {
+		buf += fmt.Sprintf(" omitted:%v", r.OmittedResults)
+	}
+	if len(r.Metadata) > 0 {
+		md := make([]string, 0)
+		for _, k := range r.metadataKeys() {
+			md = append(md, fmt.Sprintf("%v=%v", k, r.Metadata[k]))
+		}
+		buf += fmt.Sprintf(" metadata:\"%v\"", strings.Join(md, ","))
+	}
 	lns = append(lns, buf)
 
 	for _, x := range r.Results {
@@ -98,12 +210,25 @@ func (r *TestResult) SingleLineResults() []string {
 		}
 		buf := fmt.Sprintf("sub %v name:\"%v\" id:\"%v\" identifier:\"%v\"",
 			rs, namestr, r.TestID, x.Identifier)
+		if x.Location != nil {
+			buf += fmt.Sprintf(" line:%v offset:%v", x.Location.Line, x.Location.Offset)
+		}
 		lns = append(lns, buf)
 	}
 
 	return lns
 }
 
+// Return the metadata keys for the result in sorted order.
+func (r *TestResult) metadataKeys() []string {
+	ret := make([]string, 0, len(r.Metadata))
+	for k := range r.Metadata {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
 // JSON is a helper function to convert TestResult into a JSON string.
 func (r *TestResult) JSON() string {
 	buf, err := json.Marshal(r)
@@ -127,6 +252,13 @@ func (r *TestResult) String() string {
 		buf := fmt.Sprintf("\tdescription: %v", r.Description)
 		lns = append(lns, buf)
 	}
+	if r.Owner != "" {
+		buf := fmt.Sprintf("\towner: %v", r.Owner)
+		if r.Contact != "" {
+			buf += fmt.Sprintf(" (%v)", r.Contact)
+		}
+		lns = append(lns, buf)
+	}
 	if r.MasterResult {
 		lns = append(lns, "\tmaster result: true")
 	} else {
@@ -145,9 +277,30 @@ func (r *TestResult) String() string {
 		buf := fmt.Sprintf("\t[error] error: %v", r.Error)
 		lns = append(lns, buf)
 	}
+	if r.NotApplicable {
+		lns = append(lns, fmt.Sprintf("\t[notapplicable] %v", r.NotApplicableReason))
+	}
+	if r.Waived {
+		buf := fmt.Sprintf("\t[waived] until %v: %v", r.WaiverExpires, r.WaiverJustification)
+		lns = append(lns, buf)
+	}
+	for _, k := range r.metadataKeys() {
+		lns = append(lns, fmt.Sprintf("\tmetadata: %v: %v", k, r.Metadata[k]))
+	}
 	for _, x := range r.Results {
 		buf := fmt.Sprintf("\t[%v] identifier: \"%v\"", x.Result, x.Identifier)
+		if x.Location != nil {
+			buf += fmt.Sprintf(" (line %v, offset %v)", x.Location.Line, x.Location.Offset)
+		}
 		lns = append(lns, buf)
+		if x.Location != nil {
+			for _, y := range x.Location.Context {
+				lns = append(lns, fmt.Sprintf("\t\t| %v", y))
+			}
+		}
+	}
+	if r.OmittedResults > 0 {
+		lns = append(lns, fmt.Sprintf("\t%v of %v results omitted", r.OmittedResults, r.TotalResults))
 	}
 	return strings.Join(lns, "\n")
 }
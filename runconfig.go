@@ -0,0 +1,352 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mozilla/scribe/internal/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// RunConfig describes the operational settings for a run, so settings such
+// as concurrency and exclusions can be kept in a single file instead of in
+// the scripts that invoke scribe. A run configuration is loaded using
+// LoadRunConfig() and installed using Apply().
+//
+// Documents, Outputs, Timeout, Schedules, Jitter, Blackouts, Reload and the
+// policy settings are not used by the library itself, and are interpreted
+// by the program using the configuration. Documents lists the paths of
+// documents to evaluate, Outputs the output sinks results are written to
+// (as name[=config]), and Timeout the maximum duration of the run.
+// Schedules maps document paths to cron expressions the documents are
+// evaluated on in agent mode, Jitter is the maximum random delay added to
+// each agent run, Blackouts are cron expressions matching the minutes
+// during which the agent does not evaluate documents, and Reload is how
+// often the agent checks documents for changes. Policy is the URL of a
+// policy server manifest documents are fetched from into PolicyDir,
+// instead of using Documents, and PolicyKey the path of the public key the
+// manifest must be signed with.
+//
+// SourceTimeout is the default timeout for sources that query network
+// services, such as database and ldap, used where the object does not set
+// a timeout. MaxFiles, MaxBytes and MaxTime set the resource limits for the
+// analysis of each document, see ResourceLimits. Exclusions are ignore
+// patterns using the syntax described for IgnoreList, and Variables
+// overrides the values of variables in documents loaded after the
+// configuration is applied. TLSCA, TLSCert, TLSKey and TLSMinVersion set
+// the TLS options used for network connections, see TLSOptions. Secrets
+// are the secrets sources in documents can refer to, see SetSecrets.
+type RunConfig struct {
+	Documents     []string          `json:"documents,omitempty" yaml:"documents,omitempty"`
+	Concurrency   int               `json:"concurrency,omitempty" yaml:"concurrency,omitempty"`
+	Timeout       string            `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	SourceTimeout string            `json:"sourcetimeout,omitempty" yaml:"sourcetimeout,omitempty"`
+	Exclusions    []string          `json:"exclusions,omitempty" yaml:"exclusions,omitempty"`
+	Outputs       []string          `json:"outputs,omitempty" yaml:"outputs,omitempty"`
+	Variables     map[string]string `json:"variables,omitempty" yaml:"variables,omitempty"`
+	Metadata      map[string]string `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+	Redactions    []string          `json:"redactions,omitempty" yaml:"redactions,omitempty"`
+	MaxFailures   int               `json:"maxfailures,omitempty" yaml:"maxfailures,omitempty"`
+	MaxFiles      int               `json:"maxfiles,omitempty" yaml:"maxfiles,omitempty"`
+	MaxBytes      int64             `json:"maxbytes,omitempty" yaml:"maxbytes,omitempty"`
+	MaxTime       string            `json:"maxtime,omitempty" yaml:"maxtime,omitempty"`
+	Schedules     map[string]string `json:"schedules,omitempty" yaml:"schedules,omitempty"`
+	Jitter        string            `json:"jitter,omitempty" yaml:"jitter,omitempty"`
+	Blackouts     []string          `json:"blackouts,omitempty" yaml:"blackouts,omitempty"`
+	Reload        string            `json:"reload,omitempty" yaml:"reload,omitempty"`
+	Policy        string            `json:"policy,omitempty" yaml:"policy,omitempty"`
+	PolicyDir     string            `json:"policydir,omitempty" yaml:"policydir,omitempty"`
+	PolicyKey     string            `json:"policykey,omitempty" yaml:"policykey,omitempty"`
+	TLSCA         string            `json:"tlsca,omitempty" yaml:"tlsca,omitempty"`
+	TLSCert       string            `json:"tlscert,omitempty" yaml:"tlscert,omitempty"`
+	TLSKey        string            `json:"tlskey,omitempty" yaml:"tlskey,omitempty"`
+	TLSMinVersion string            `json:"tlsminversion,omitempty" yaml:"tlsminversion,omitempty"`
+	Secrets       []Secret          `json:"secrets,omitempty" yaml:"secrets,omitempty"`
+}
+
+// LoadRunConfig loads a run configuration in YAML, TOML or JSON format from
+// the reader specified by r.
+func LoadRunConfig(r io.Reader) (RunConfig, error) {
+	var ret RunConfig
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return ret, err
+	}
+	switch runConfigFormat(b) {
+	case "json":
+		err = json.Unmarshal(b, &ret)
+	case "toml":
+		var v interface{}
+		v, err = toml.Decode(b)
+		if err != nil {
+			break
+		}
+		// Decode the TOML through JSON, so the same field names are
+		// used as for JSON documents.
+		var buf []byte
+		buf, err = json.Marshal(v)
+		if err != nil {
+			break
+		}
+		err = json.Unmarshal(buf, &ret)
+	default:
+		err = yaml.UnmarshalStrict(b, &ret)
+	}
+	if err != nil {
+		return ret, fmt.Errorf("run configuration: %v", err)
+	}
+	err = ret.validate()
+	if err != nil {
+		return ret, fmt.Errorf("run configuration: %v", err)
+	}
+	return ret, nil
+}
+
+// Determine the format of a run configuration from the first line that is
+// not blank or a comment; TOML uses = to assign values, or starts with a
+// table, where YAML uses a colon.
+func runConfigFormat(b []byte) string {
+	b = bytes.TrimLeft(b, " \r\n\t")
+	if len(b) > 0 && b[0] == '{' {
+		return "json"
+	}
+	for _, x := range strings.Split(string(b), "\n") {
+		x = strings.TrimSpace(x)
+		if x == "" || strings.HasPrefix(x, "#") {
+			continue
+		}
+		if strings.HasPrefix(x, "[") {
+			return "toml"
+		}
+		eq := strings.Index(x, "=")
+		colon := strings.Index(x, ":")
+		if eq != -1 && (colon == -1 || eq < colon) {
+			return "toml"
+		}
+		break
+	}
+	return "yaml"
+}
+
+func (c *RunConfig) validate() error {
+	if c.Concurrency < 0 {
+		return fmt.Errorf("concurrency must not be negative")
+	}
+	if c.MaxFailures < 0 {
+		return fmt.Errorf("maxfailures must not be negative")
+	}
+	if c.MaxFiles < 0 || c.MaxBytes < 0 {
+		return fmt.Errorf("resource limits must not be negative")
+	}
+	for _, x := range []string{c.Timeout, c.SourceTimeout, c.MaxTime} {
+		if x == "" {
+			continue
+		}
+		d, err := time.ParseDuration(x)
+		if err != nil {
+			return err
+		}
+		if d <= 0 {
+			return fmt.Errorf("timeout %v must be positive", x)
+		}
+	}
+	if c.Reload != "" {
+		d, err := time.ParseDuration(c.Reload)
+		if err != nil {
+			return err
+		}
+		if d <= 0 {
+			return fmt.Errorf("reload %v must be positive", c.Reload)
+		}
+	}
+	if c.Jitter != "" {
+		d, err := time.ParseDuration(c.Jitter)
+		if err != nil {
+			return err
+		}
+		if d < 0 {
+			return fmt.Errorf("jitter must not be negative")
+		}
+	}
+	if c.TLSMinVersion != "" && c.TLSMinVersion != "1.2" && c.TLSMinVersion != "1.3" {
+		return fmt.Errorf("tlsminversion must be 1.2 or 1.3")
+	}
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		return fmt.Errorf("tlscert and tlskey must be specified together")
+	}
+	if c.Policy != "" && c.PolicyDir == "" {
+		return fmt.Errorf("policy requires policydir")
+	}
+	for k := range c.Variables {
+		if k == "" {
+			return fmt.Errorf("variable override has no key")
+		}
+	}
+	secrets := make(map[string]bool)
+	for _, x := range c.Secrets {
+		err := x.validate()
+		if err != nil {
+			return err
+		}
+		if secrets[x.Name] {
+			return fmt.Errorf("secret %v: name is not unique", x.Name)
+		}
+		secrets[x.Name] = true
+	}
+	return nil
+}
+
+// JitterDuration returns the maximum random delay added to agent runs, or 0
+// if the configuration does not set jitter.
+func (c *RunConfig) JitterDuration() time.Duration {
+	d, _ := time.ParseDuration(c.Jitter)
+	return d
+}
+
+// ReloadDuration returns how often the agent checks documents for changes,
+// or 0 if the configuration does not set reload.
+func (c *RunConfig) ReloadDuration() time.Duration {
+	d, _ := time.ParseDuration(c.Reload)
+	return d
+}
+
+// TimeoutDuration returns the maximum duration of the run, or 0 if the
+// configuration does not set a timeout.
+func (c *RunConfig) TimeoutDuration() time.Duration {
+	d, _ := time.ParseDuration(c.Timeout)
+	return d
+}
+
+// TLSOptions returns the TLS options set in the configuration.
+func (c *RunConfig) TLSOptions() TLSOptions {
+	return TLSOptions{CAFile: c.TLSCA, CertFile: c.TLSCert, KeyFile: c.TLSKey, MinVersion: c.TLSMinVersion}
+}
+
+// Apply installs the settings in the configuration in the library. Settings
+// that are not present in the configuration are left unchanged.
+func (c *RunConfig) Apply() error {
+	if c.Concurrency != 0 {
+		SetConcurrency(c.Concurrency)
+	}
+	if c.MaxFailures != 0 {
+		SetMaxFailures(c.MaxFailures)
+	}
+	if c.SourceTimeout != "" {
+		d, err := time.ParseDuration(c.SourceTimeout)
+		if err != nil {
+			return err
+		}
+		SetSourceTimeout(d)
+	}
+	if c.MaxFiles != 0 || c.MaxBytes != 0 || c.MaxTime != "" {
+		l := ResourceLimits{MaxFiles: c.MaxFiles, MaxBytes: c.MaxBytes}
+		if c.MaxTime != "" {
+			d, err := time.ParseDuration(c.MaxTime)
+			if err != nil {
+				return err
+			}
+			l.MaxTime = d
+		}
+		SetResourceLimits(l)
+	}
+	if len(c.Exclusions) != 0 {
+		l, err := LoadIgnore(strings.NewReader(strings.Join(c.Exclusions, "\n")))
+		if err != nil {
+			return err
+		}
+		SetIgnore(l)
+	}
+	if len(c.Redactions) != 0 {
+		err := SetRedactions(c.Redactions)
+		if err != nil {
+			return err
+		}
+	}
+	if len(c.Metadata) != 0 {
+		SetMetadata(c.Metadata)
+	}
+	if len(c.Variables) != 0 {
+		SetVariables(c.Variables)
+	}
+	if o := c.TLSOptions(); !o.IsZero() {
+		err := SetTLSOptions(o)
+		if err != nil {
+			return err
+		}
+	}
+	if len(c.Secrets) != 0 {
+		err := SetSecrets(c.Secrets)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetSourceTimeout sets the default timeout for sources that query network
+// services, used where an object does not set a timeout. Passing 0 restores
+// the built-in defaults.
+func SetSourceTimeout(d time.Duration) {
+	sRuntime.sourceTimeout = d
+}
+
+// Return the timeout for a source, def being the built-in default.
+func sourceTimeout(def time.Duration) time.Duration {
+	if sRuntime.sourceTimeout != 0 {
+		return sRuntime.sourceTimeout
+	}
+	return def
+}
+
+// SetVariables overrides the values of variables in documents loaded after
+// the call, for example to adapt a shared document to a particular
+// environment. Variables in m that are not defined in a document are added
+// to it. Passing nil removes any overrides.
+func SetVariables(m map[string]string) {
+	if m == nil {
+		sRuntime.variables = nil
+		return
+	}
+	sRuntime.variables = make(map[string]string)
+	for k, v := range m {
+		sRuntime.variables[k] = v
+	}
+}
+
+// Apply any installed variable overrides to the document.
+func (d *Document) overrideVariables() {
+	if len(sRuntime.variables) == 0 {
+		return
+	}
+	seen := make(map[string]bool)
+	for i := range d.Variables {
+		if v, ok := sRuntime.variables[d.Variables[i].Key]; ok {
+			debugPrint("overriding variable %v\n", d.Variables[i].Key)
+			d.Variables[i].Value = v
+			seen[d.Variables[i].Key] = true
+		}
+	}
+	keys := make([]string, 0)
+	for k := range sRuntime.variables {
+		if !seen[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		d.Variables = append(d.Variables, Variable{Key: k, Value: sRuntime.variables[k]})
+	}
+}
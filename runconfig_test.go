@@ -0,0 +1,157 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mozilla/scribe"
+)
+
+var runConfigYAML = `
+# Nightly fleet scan
+documents:
+  - /etc/scribe/base.json
+  - /etc/scribe/ssh.yaml
+concurrency: 4
+timeout: 10m
+sourcetimeout: 15s
+exclusions:
+  - /proc/
+  - "*.tmp"
+outputs:
+  - json
+  - upload=s3://scans/{date}/{host}/{document}
+variables:
+  root: ./test/hasline
+metadata:
+  env: prod
+maxfailures: 20
+`
+
+var runConfigTOML = `
+# Nightly fleet scan
+documents = ["/etc/scribe/base.json", "/etc/scribe/ssh.yaml"]
+concurrency = 4
+timeout = "10m"
+sourcetimeout = "15s"
+exclusions = ["/proc/", "*.tmp"]
+outputs = ["json", "upload=s3://scans/{date}/{host}/{document}"]
+maxfailures = 20
+
+[variables]
+root = "./test/hasline"
+
+[metadata]
+env = "prod"
+`
+
+var runConfigJSON = `{
+	"documents": ["/etc/scribe/base.json", "/etc/scribe/ssh.yaml"],
+	"concurrency": 4,
+	"timeout": "10m",
+	"sourcetimeout": "15s",
+	"exclusions": ["/proc/", "*.tmp"],
+	"outputs": ["json", "upload=s3://scans/{date}/{host}/{document}"],
+	"variables": { "root": "./test/hasline" },
+	"metadata": { "env": "prod" },
+	"maxfailures": 20
+}`
+
+// The document uses a root that does not exist unless it is overridden by
+// the run configuration.
+var runConfigDoc = `
+{
+	"variables": [
+	{ "key": "root", "value": "./test/nonexistent" }
+	],
+
+	"objects": [
+	{
+		"object": "file-hasline",
+		"hasline": {
+			"path": "${root}",
+			"file": ".*\\.txt",
+			"expression": ".*test.*"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "files-with-line",
+		"expectedresult": true,
+		"object": "file-hasline"
+	}
+	]
+}
+`
+
+func TestLoadRunConfig(t *testing.T) {
+	expect := scribe.RunConfig{
+		Documents:     []string{"/etc/scribe/base.json", "/etc/scribe/ssh.yaml"},
+		Concurrency:   4,
+		Timeout:       "10m",
+		SourceTimeout: "15s",
+		Exclusions:    []string{"/proc/", "*.tmp"},
+		Outputs:       []string{"json", "upload=s3://scans/{date}/{host}/{document}"},
+		Variables:     map[string]string{"root": "./test/hasline"},
+		Metadata:      map[string]string{"env": "prod"},
+		MaxFailures:   20,
+	}
+	for _, x := range []string{runConfigYAML, runConfigTOML, runConfigJSON} {
+		cfg, err := scribe.LoadRunConfig(strings.NewReader(x))
+		if err != nil {
+			t.Fatalf("scribe.LoadRunConfig: %v", err)
+		}
+		if !reflect.DeepEqual(cfg, expect) {
+			t.Fatalf("unexpected run configuration %+v", cfg)
+		}
+		if cfg.TimeoutDuration() != 10*time.Minute {
+			t.Fatalf("unexpected timeout %v", cfg.TimeoutDuration())
+		}
+	}
+
+	for _, x := range []string{"concurrency: -1\n", "timeout: soon\n", "concurency: 4\n", "jitter: -1m\n",
+		"tlsminversion: \"1.1\"\n", "secrets:\n- {name: a, provider: vault, key: x}\n"} {
+		_, err := scribe.LoadRunConfig(strings.NewReader(x))
+		if err == nil {
+			t.Fatalf("scribe.LoadRunConfig should have failed for %q", x)
+		}
+	}
+}
+
+func TestRunConfigApply(t *testing.T) {
+	cfg, err := scribe.LoadRunConfig(strings.NewReader(runConfigYAML))
+	if err != nil {
+		t.Fatalf("scribe.LoadRunConfig: %v", err)
+	}
+	err = cfg.Apply()
+	if err != nil {
+		t.Fatalf("RunConfig.Apply: %v", err)
+	}
+	defer func() {
+		scribe.SetConcurrency(1)
+		scribe.SetMaxFailures(0)
+		scribe.SetSourceTimeout(0)
+		scribe.SetIgnore(nil)
+		scribe.SetMetadata(nil)
+		scribe.SetVariables(nil)
+	}()
+	doc := genericTestExec(t, runConfigDoc)
+	tr, err := scribe.GetResults(doc, "files-with-line")
+	if err != nil {
+		t.Fatalf("scribe.GetResults: %v", err)
+	}
+	if tr.Metadata["env"] != "prod" {
+		t.Fatalf("run configuration metadata not attached to result")
+	}
+}
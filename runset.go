@@ -0,0 +1,128 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// RunSet can be used to evaluate multiple documents together, for example
+// where policies from several sources are applied to the same system.
+//
+// Objects that are identical across documents are only prepared once, with
+// the prepared object being shared by each document that contains it. The
+// results of all documents can then be obtained as a single merged set,
+// where each result indicates the document it originated from.
+type RunSet struct {
+	docs []runSetDocument
+}
+
+type runSetDocument struct {
+	name string
+	doc  Document
+}
+
+// RunSetResult is a test result returned from a RunSet, including the name
+// of the document the test is contained in.
+type RunSetResult struct {
+	Document string `json:"document" yaml:"document"` // The name of the document.
+	TestResult
+}
+
+// NewRunSet returns a new empty RunSet.
+func NewRunSet() *RunSet {
+	return &RunSet{docs: make([]runSetDocument, 0)}
+}
+
+// Add adds document d to the run set, using name to identify the document
+// in results. Names must be unique within the run set.
+func (r *RunSet) Add(name string, d Document) error {
+	for _, x := range r.docs {
+		if x.name == name {
+			return fmt.Errorf("document \"%v\" already exists in run set", name)
+		}
+	}
+	r.docs = append(r.docs, runSetDocument{name: name, doc: d})
+	return nil
+}
+
+// Load loads a document from the reader specified by rdr using
+// LoadDocument(), and adds it to the run set.
+func (r *RunSet) Load(name string, rdr io.Reader) error {
+	d, err := LoadDocument(rdr)
+	if err != nil {
+		return fmt.Errorf("%v: %v", name, err)
+	}
+	return r.Add(name, d)
+}
+
+// Analyze analyzes all documents in the run set. Returns an error if a fatal
+// error occurs.
+func (r *RunSet) Analyze() error {
+	pkgmgrReset()
+	cache := make(map[string]*Object)
+	for i := range r.docs {
+		debugPrint("runset: preparing objects for \"%v\"\n", r.docs[i].name)
+		err := r.docs[i].doc.prepareObjectsShared(cache)
+		if err != nil {
+			return err
+		}
+	}
+	for i := range r.docs {
+		debugPrint("runset: analyzing \"%v\"\n", r.docs[i].name)
+		err := r.docs[i].doc.runTests(nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Results returns the results of all tests in all documents in the run set,
+// in the order the documents were added.
+func (r *RunSet) Results() ([]RunSetResult, error) {
+	ret := make([]RunSetResult, 0)
+	for i := range r.docs {
+		d := &r.docs[i].doc
+		for _, x := range d.GetTestIdentifiers() {
+			tr, err := GetResults(d, x)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, RunSetResult{Document: r.docs[i].name, TestResult: tr})
+		}
+	}
+	return ret, nil
+}
+
+// Return a key identifying the definition of an object, objects with the
+// same key in different documents will return the same data. Returns an
+// empty string if the object cannot be shared.
+func (o *Object) shareKey(v []Variable) string {
+	// Objects that are part of, or fire, import chains depend on other
+	// objects in the document and are not shared.
+	if o.isChain || len(o.FileContent.ImportChain) > 0 {
+		return ""
+	}
+	key, err := o.definitionKey()
+	if err != nil {
+		return ""
+	}
+	// Include the value of any variables used by the object in the key.
+	vars := make([]string, 0)
+	for _, x := range v {
+		if strings.Contains(key, "${"+x.Key+"}") {
+			vars = append(vars, x.Key+"="+x.Value)
+		}
+	}
+	sort.Strings(vars)
+	return key + strings.Join(vars, "\n")
+}
@@ -0,0 +1,156 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"fmt"
+	goruntime "runtime"
+	"sort"
+	"sync"
+)
+
+// Cost hints that can be set in the cost field of an object, describing the
+// resources required to prepare the object. Objects without a cost hint
+// are considered to be of moderate cost, with no particular resource
+// constraint.
+const (
+	CostFast     = "fast"      // Inexpensive to prepare, for example raw objects.
+	CostIOHeavy  = "io-heavy"  // Large file system scans, or reading many files.
+	CostCPUHeavy = "cpu-heavy" // Hashing or parsing large amounts of data.
+)
+
+// The order objects are started in by cost; expensive objects are started
+// first so they do not delay completion of the preparation pass.
+var costOrder = map[string]int{
+	CostIOHeavy:  0,
+	CostCPUHeavy: 1,
+	"":           2,
+	CostFast:     3,
+}
+
+// SetConcurrency sets the number of objects prepared concurrently during
+// analysis. The default of 1 prepares objects one at a time, in document
+// order.
+//
+// When objects are prepared concurrently, the cost hint of each object is
+// used to decide the order objects are started in and the mix of objects
+// running together. Objects with higher costs are started first. At most
+// one quarter of the workers (but at least one) prepare io-heavy objects at
+// any time, so expensive disk scans do not all start simultaneously, and
+// cpu-heavy objects are limited to the number of CPUs.
+func SetConcurrency(n int) {
+	if n < 1 {
+		n = 1
+	}
+	sRuntime.concurrency = n
+}
+
+func validateCost(c string) error {
+	if _, ok := costOrder[c]; !ok {
+		return fmt.Errorf("cost must be %v, %v or %v", CostFast, CostIOHeavy, CostCPUHeavy)
+	}
+	return nil
+}
+
+// Return the number of objects of each cost that can be prepared at the
+// same time with n workers, 0 indicating no limit.
+func costLimits(n int) map[string]int {
+	ioLimit := n / 4
+	if ioLimit < 1 {
+		ioLimit = 1
+	}
+	cpuLimit := goruntime.NumCPU()
+	if cpuLimit > n {
+		cpuLimit = n
+	}
+	return map[string]int{CostIOHeavy: ioLimit, CostCPUHeavy: cpuLimit}
+}
+
+// prepareScheduler prepares a set of objects in a document concurrently.
+type prepareScheduler struct {
+	sync.Mutex
+	cond    *sync.Cond
+	queue   []*Object
+	running map[string]int
+	limits  map[string]int
+}
+
+// Prepare the objects in the document with the indices specified in idx,
+// concurrently if enabled.
+func (d *Document) prepareIndices(idx []int) {
+	n := sRuntime.concurrency
+	if n <= 1 || len(idx) <= 1 {
+		for _, i := range idx {
+			d.Objects[i].prepare(d)
+		}
+		return
+	}
+	s := &prepareScheduler{
+		running: make(map[string]int),
+		limits:  costLimits(n),
+	}
+	s.cond = sync.NewCond(s)
+	for _, i := range idx {
+		s.queue = append(s.queue, &d.Objects[i])
+	}
+	sort.SliceStable(s.queue, func(i, j int) bool {
+		return costOrder[s.queue[i].Cost] < costOrder[s.queue[j].Cost]
+	})
+	if n > len(s.queue) {
+		n = len(s.queue)
+	}
+	debugPrint("prepareIndices(): preparing %v objects with %v workers\n", len(s.queue), n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				o := s.next()
+				if o == nil {
+					return
+				}
+				o.prepare(d)
+				s.done(o)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Return the next object that can be started within the cost limits,
+// waiting for running objects to complete if required. Returns nil once
+// all objects have been started.
+func (s *prepareScheduler) next() *Object {
+	s.Lock()
+	defer s.Unlock()
+	for len(s.queue) > 0 {
+		for i, o := range s.queue {
+			limit := s.limits[o.Cost]
+			if limit != 0 && s.running[o.Cost] >= limit {
+				continue
+			}
+			s.queue = append(s.queue[:i], s.queue[i+1:]...)
+			s.running[o.Cost]++
+			debugPrint("next(): starting \"%v\" (%v running with cost \"%v\")\n",
+				o.Object, s.running[o.Cost], o.Cost)
+			return o
+		}
+		// Everything remaining is waiting on a cost limit, which will
+		// change once a running object completes.
+		s.cond.Wait()
+	}
+	return nil
+}
+
+func (s *prepareScheduler) done(o *Object) {
+	s.Lock()
+	s.running[o.Cost]--
+	s.Unlock()
+	s.cond.Broadcast()
+}
@@ -0,0 +1,82 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mozilla/scribe"
+)
+
+var scheduleDoc = `
+{
+	"objects": [
+	{ "object": "names", "cost": "io-heavy", "filename": { "path": "./test", "file": "^(file\\d)\\.txt$" } },
+	{ "object": "lines", "cost": "io-heavy", "hasline": { "path": "./test/hasline", "file": ".*", "expression": "test" } },
+	{ "object": "hashes", "cost": "cpu-heavy", "filehash": { "path": "./test/filehash", "file": ".*", "algorithm": "sha256" } },
+	{ "object": "openssl", "package": { "name": "openssl" } },
+	{ "object": "libc", "package": { "name": "libc6" } },
+	{ "object": "raw", "cost": "fast", "raw": { "identifiers": [ { "identifier": "a", "value": "1" } ] } },
+	{ "object": "config", "filecontent": { "path": "./test/filecontent", "file": ".*", "expression": "^(\\S+)" } }
+	],
+
+	"tests": [
+	{ "test": "names", "object": "names" },
+	{ "test": "lines", "object": "lines" },
+	{ "test": "hashes", "object": "hashes" },
+	{ "test": "openssl", "object": "openssl" },
+	{ "test": "libc", "object": "libc" },
+	{ "test": "raw", "object": "raw" },
+	{ "test": "config", "object": "config" }
+	]
+}
+`
+
+func scheduleAnalyze(t *testing.T) string {
+	doc, err := scribe.LoadDocument(strings.NewReader(scheduleDoc))
+	if err != nil {
+		t.Fatalf("scribe.LoadDocument: %v", err)
+	}
+	err = scribe.AnalyzeDocument(doc)
+	if err != nil {
+		t.Fatalf("scribe.AnalyzeDocument: %v", err)
+	}
+	ret := make([]string, 0)
+	for _, x := range doc.GetTestIdentifiers() {
+		tr, err := scribe.GetResults(&doc, x)
+		if err != nil {
+			t.Fatalf("scribe.GetResults: %v", err)
+		}
+		if tr.IsError {
+			t.Fatalf("%v: %v", x, tr.Error)
+		}
+		ret = append(ret, tr.SingleLineResults()...)
+	}
+	return strings.Join(ret, "\n")
+}
+
+func TestConcurrentPreparation(t *testing.T) {
+	scribe.Bootstrap()
+	scribe.TestHooks(true)
+	sequential := scheduleAnalyze(t)
+	scribe.SetConcurrency(8)
+	defer scribe.SetConcurrency(1)
+	for i := 0; i < 5; i++ {
+		concurrent := scheduleAnalyze(t)
+		if concurrent != sequential {
+			t.Fatalf("concurrent results differ:\n%v\n---\n%v", sequential, concurrent)
+		}
+	}
+
+	_, err := scribe.LoadDocument(strings.NewReader(`{"objects": [{"object": "raw",
+		"cost": "expensive", "raw": {"identifiers": [{"identifier": "a", "value": "1"}]}}]}`))
+	if err == nil {
+		t.Fatalf("scribe.LoadDocument should fail for invalid cost")
+	}
+}
@@ -9,20 +9,51 @@
 package scribe
 
 import (
+	"crypto/tls"
 	"fmt"
 	"io"
+	"regexp"
+	"sync"
+	"time"
 )
 
 type runtime struct {
-	debugging   bool
-	debugWriter io.Writer
-	excall      func(TestResult)
-	testHooks   bool
-	fileLocator func(string, bool, string, int) ([]string, error)
+	debugging     bool
+	debugWriter   io.Writer
+	excall        func(TestResult)
+	testHooks     bool
+	fileLocator   func(string, bool, string, int) ([]string, error)
+	waivers       *Waivers
+	evidence      *evidenceStore
+	metadata      map[string]string
+	ignore        *IgnoreList
+	documentKey   func() ([]byte, error)
+	pkgQuery      func() ([]PackageInfo, error)
+	baseline      *baselineStore
+	concurrency   int
+	maxFailures   int
+	redactions    []*regexp.Regexp
+	variables     map[string]string
+	sourceTimeout time.Duration
+	partial       bool
+	strict        bool
+	noDedup       bool
+	wasmRuntime   string
+	limits        ResourceLimits
+	tlsClient     *tls.Config
+	debugLock     sync.Mutex
+
+	secretProviders map[string]SecretProvider
+	secrets         map[string]Secret
+	secretLock      sync.Mutex
+
+	evaluators    map[string]EvaluatorFactory
+	evaluatorLock sync.Mutex
 }
 
-// Version is the scribe library version
-const Version = "0.5"
+// Version is the scribe library version. It follows semantic versioning,
+// and each release of the module is tagged v followed by the version.
+const Version = "0.5.0"
 
 var sRuntime runtime
 
@@ -65,6 +96,32 @@ func InstallFileLocator(f func(string, bool, string, int) ([]string, error)) {
 	sRuntime.fileLocator = f
 }
 
+// InstallPackageQuery installs an alternate package query function.
+//
+// The function is called once per document analysis to obtain the package
+// inventory, in place of querying the package managers on the local system.
+// This can be used to evaluate package tests against inventory data
+// collected elsewhere, see InventoryPackageQuery(). If the function returns
+// an error, package objects in the document fail with the error. Passing
+// nil restores querying the local system.
+func InstallPackageQuery(f func() ([]PackageInfo, error)) {
+	sRuntime.pkgQuery = f
+}
+
+// SetMetadata attaches key/value metadata describing the run (for example an
+// asset identifier, environment or owner) to all results subsequently
+// returned by GetResults(). Passing nil removes any metadata.
+func SetMetadata(m map[string]string) {
+	if m == nil {
+		sRuntime.metadata = nil
+		return
+	}
+	sRuntime.metadata = make(map[string]string)
+	for k, v := range m {
+		sRuntime.metadata[k] = v
+	}
+}
+
 // TestHooks enables or disables testing hooks in the library.
 //
 // Enable or disable test hooks. If test hooks are enabled, certain functions
@@ -79,7 +136,11 @@ func debugPrint(s string, args ...interface{}) {
 		return
 	}
 	buf := fmt.Sprintf(s, args...)
+	// Objects may be prepared concurrently, serialize writes so debug
+	// output is not interleaved.
+	sRuntime.debugLock.Lock()
 	fmt.Fprintf(sRuntime.debugWriter, "[scribe] %v", buf)
+	sRuntime.debugLock.Unlock()
 }
 
 // SetDebug enables or disables debugging. If debugging is enabled, output is written
@@ -9,6 +9,9 @@ package scribe_test
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -174,3 +177,233 @@ func TestResultsFormatting(t *testing.T) {
 		t.Fatalf("json result has incorrect format")
 	}
 }
+
+func TestAnalyzeDocumentReader(t *testing.T) {
+	rdr := strings.NewReader(resultsFormattingDoc)
+	scribe.Bootstrap()
+	scribe.TestHooks(true)
+	doc, err := scribe.LoadDocument(rdr)
+	if err != nil {
+		t.Fatalf("scribe.LoadDocument: %v", err)
+	}
+	buf, err := ioutil.ReadAll(scribe.AnalyzeDocumentReader(doc))
+	if err != nil {
+		t.Fatalf("reading streamed results: %v", err)
+	}
+	json_compare := `{"testid":"test1","name":"a test","description":"","iserror":false,"error":"","masterresult":true,"hastrueresults":true,"results":[{"result":true,"identifier":"test"}]}` + "\n"
+	if string(buf) != json_compare {
+		t.Fatalf("streamed result has incorrect format")
+	}
+}
+
+// A writer that calls f with each write.
+type writeFunc func(p []byte) (int, error)
+
+func (f writeFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+func TestAnalyzeDocumentStream(t *testing.T) {
+	dir := t.TempDir()
+	for _, x := range []string{"first", "second"} {
+		err := os.Mkdir(filepath.Join(dir, x), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(filepath.Join(dir, x, x), nil, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	docstr := fmt.Sprintf(`{
+	"variables": [ { "key": "root", "value": %q } ],
+	"objects": [
+	{ "object": "first", "filename": { "path": "${root}/first", "file": "^(first)$" } },
+	{ "object": "second", "filename": { "path": "${root}/second", "file": "^(second)$" } }
+	],
+	"tests": [
+	{ "test": "first", "expectedresult": true, "object": "first" },
+	{ "test": "second", "expectedresult": true, "object": "second" }
+	]
+}`, dir)
+	scribe.Bootstrap()
+	scribe.TestHooks(true)
+	doc, err := scribe.LoadDocument(strings.NewReader(docstr))
+	if err != nil {
+		t.Fatalf("scribe.LoadDocument: %v", err)
+	}
+	var roots []string
+	scribe.SetEnumerateHook(func(root string) {
+		roots = append(roots, filepath.Base(root))
+	})
+	defer scribe.SetEnumerateHook(nil)
+
+	// The result of the first test is written before the object only the
+	// second test references is prepared.
+	var lines []string
+	err = scribe.AnalyzeDocumentStream(doc, writeFunc(func(p []byte) (int, error) {
+		lines = append(lines, string(p))
+		if len(lines) == 1 && strings.Join(roots, ",") != "first" {
+			t.Errorf("first result written after enumerating %v", roots)
+		}
+		return len(p), nil
+	}))
+	if err != nil {
+		t.Fatalf("scribe.AnalyzeDocumentStream: %v", err)
+	}
+	if len(lines) != 2 || !strings.Contains(lines[0], `"testid":"first"`) ||
+		!strings.Contains(lines[1], `"testid":"second"`) ||
+		!strings.Contains(lines[1], `"masterresult":true`) {
+		t.Fatalf("unexpected streamed results %q", lines)
+	}
+}
+
+func TestRunSet(t *testing.T) {
+	scribe.Bootstrap()
+	scribe.TestHooks(true)
+	rs := scribe.NewRunSet()
+	err := rs.Load("formatting", strings.NewReader(resultsFormattingDoc))
+	if err != nil {
+		t.Fatalf("RunSet.Load: %v", err)
+	}
+	err = rs.Load("packages", strings.NewReader(packagePolicyDoc))
+	if err != nil {
+		t.Fatalf("RunSet.Load: %v", err)
+	}
+	err = rs.Load("packages", strings.NewReader(packagePolicyDoc))
+	if err == nil {
+		t.Fatalf("RunSet.Load should fail with duplicate document name")
+	}
+	err = rs.Analyze()
+	if err != nil {
+		t.Fatalf("RunSet.Analyze: %v", err)
+	}
+	results, err := rs.Results()
+	if err != nil {
+		t.Fatalf("RunSet.Results: %v", err)
+	}
+	if len(results) != 10 {
+		t.Fatalf("RunSet.Results returned %v results", len(results))
+	}
+	if results[0].Document != "formatting" || results[0].TestID != "test1" {
+		t.Fatalf("RunSet result has incorrect attribution")
+	}
+	for _, x := range results[1:] {
+		if x.Document != "packages" {
+			t.Fatalf("RunSet result has incorrect attribution")
+		}
+		if x.IsError && x.TestID != "package6" {
+			t.Fatalf("RunSet result %v resulted in an error", x.TestID)
+		}
+	}
+}
+
+// Invalid regular expressions in objects and tests should be identified
+// when the document is loaded.
+func TestInvalidExpressions(t *testing.T) {
+	docs := []string{
+		`{"objects": [{"object": "o", "filename": {"path": "/", "file": "(["}}],
+		"tests": [{"test": "t", "object": "o"}]}`,
+		`{"objects": [{"object": "o", "filecontent": {"path": "/", "file": "x", "expression": "(["}}],
+		"tests": [{"test": "t", "object": "o"}]}`,
+		`{"objects": [{"object": "o", "raw": {"identifiers": [{"identifier": "a", "value": "b"}]}}],
+		"tests": [{"test": "t", "object": "o", "regexp": {"value": "(["}}]}`,
+	}
+	for i, x := range docs {
+		_, err := scribe.LoadDocument(strings.NewReader(x))
+		if err == nil {
+			t.Fatalf("document %v with invalid expression loaded without error", i)
+		}
+	}
+}
+
+func TestResultMetadata(t *testing.T) {
+	scribe.SetMetadata(map[string]string{"asset": "web01", "env": "prod"})
+	defer scribe.SetMetadata(nil)
+	doc := genericTestExec(t, rawPolicyDoc)
+	tr, err := scribe.GetResults(doc, doc.GetTestIdentifiers()[0])
+	if err != nil {
+		t.Fatalf("scribe.GetResults: %v", err)
+	}
+	if !strings.Contains(tr.JSON(), `"metadata":{"asset":"web01","env":"prod"}`) {
+		t.Fatalf("json result missing metadata: %v", tr.JSON())
+	}
+	if !strings.Contains(tr.SingleLineResults()[0], `metadata:"asset=web01,env=prod"`) {
+		t.Fatalf("single line result missing metadata: %v", tr.SingleLineResults()[0])
+	}
+	if !strings.Contains(tr.String(), "metadata: env: prod") {
+		t.Fatalf("result missing metadata: %v", tr.String())
+	}
+}
+
+var maxFailuresDoc = `
+{
+	"objects": [
+	{
+		"object": "files",
+		"raw": {
+			"identifiers": [
+			{ "identifier": "a", "value": "bad" },
+			{ "identifier": "b", "value": "good" },
+			{ "identifier": "c", "value": "bad" },
+			{ "identifier": "d", "value": "bad" },
+			{ "identifier": "e", "value": "bad" }
+			]
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "limited",
+		"object": "files",
+		"expectedresult": true,
+		"exactmatch": { "value": "good" },
+		"maxfailures": 2
+	},
+
+	{
+		"test": "unlimited",
+		"object": "files",
+		"expectedresult": true,
+		"exactmatch": { "value": "good" }
+	}
+	]
+}
+`
+
+func TestMaxFailures(t *testing.T) {
+	doc := genericTestExec(t, maxFailuresDoc)
+	tr, err := scribe.GetResults(doc, "limited")
+	if err != nil {
+		t.Fatalf("scribe.GetResults: %v", err)
+	}
+	ids := make([]string, 0)
+	for _, x := range tr.Results {
+		ids = append(ids, x.Identifier)
+	}
+	if strings.Join(ids, ",") != "a,b,c" || tr.TotalResults != 5 || tr.OmittedResults != 2 {
+		t.Fatalf("unexpected limited results: %v", tr.JSON())
+	}
+	if !strings.Contains(tr.String(), "2 of 5 results omitted") {
+		t.Fatalf("result missing omitted count: %v", tr.String())
+	}
+	tr, err = scribe.GetResults(doc, "unlimited")
+	if err != nil {
+		t.Fatalf("scribe.GetResults: %v", err)
+	}
+	if len(tr.Results) != 5 || tr.TotalResults != 0 || tr.OmittedResults != 0 {
+		t.Fatalf("unexpected unlimited results: %v", tr.JSON())
+	}
+
+	// The global limit applies to tests without a limit.
+	scribe.SetMaxFailures(1)
+	defer scribe.SetMaxFailures(0)
+	tr, err = scribe.GetResults(doc, "unlimited")
+	if err != nil {
+		t.Fatalf("scribe.GetResults: %v", err)
+	}
+	if len(tr.Results) != 2 || tr.OmittedResults != 3 {
+		t.Fatalf("unexpected globally limited results: %v", tr.JSON())
+	}
+}
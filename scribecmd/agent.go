@@ -0,0 +1,218 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"github.com/mozilla/scribe"
+	"github.com/mozilla/scribe/agent"
+	"github.com/mozilla/scribe/auth"
+	"github.com/mozilla/scribe/output"
+	"github.com/mozilla/scribe/policy"
+	"github.com/mozilla/scribe/update"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// agentOptions describes when the agent evaluates documents, and where it
+// gets them from.
+type agentOptions struct {
+	interval  time.Duration     // Time between runs of unscheduled documents.
+	schedule  string            // Cron expression for documents not in schedules.
+	schedules map[string]string // Cron expressions by document path.
+	jitter    time.Duration
+	blackouts listFlag
+	reload    time.Duration  // How often documents are checked for changes.
+	policy    *policy.Syncer // Fetches the documents from a policy server, if set.
+	healthTLS scribe.TLSOptions
+	// Authenticates requests to the health endpoint, if set.
+	healthAuth auth.Authenticator
+	// Checks for updates every updateEvery, if set, restarting the agent
+	// when one is installed.
+	updater     *update.Updater
+	updateEvery time.Duration
+}
+
+// Evaluate the documents on their schedules, writing the results of each
+// run using sink. If addr is set the status of the agent is served over
+// HTTP at addr, using TLS if opts.healthTLS includes a certificate, and
+// requiring client certificates if it also includes a CA, and requests are
+// authenticated by opts.healthAuth if set. If opts.updater is set the agent
+// checks for updates every opts.updateEvery, and restarts the new
+// executable once one is installed. Only returns if the agent can not be
+// started or restarted.
+func runAgent(docpaths []string, opts agentOptions, addr string, sink output.Sink, onlyTrue bool) int {
+	hostname, _ := os.Hostname()
+	a := &agent.Agent{
+		Documents: docpaths,
+		Interval:  opts.interval,
+		Schedules: make(map[string]*agent.Schedule),
+		Jitter:    opts.jitter,
+		Reload:    opts.reload,
+		Open:      openDocument,
+		Results: func(path string, doc *scribe.Document) error {
+			err := sink.Start(output.RunInfo{Document: path, Host: hostname, Time: time.Now().UTC()})
+			if err != nil {
+				return err
+			}
+			for _, x := range doc.GetTestIdentifiers() {
+				tr, err := scribe.GetResults(doc, x)
+				if err != nil {
+					return err
+				}
+				if onlyTrue && !tr.MasterResult {
+					continue
+				}
+				err = sink.WriteResult(tr)
+				if err != nil {
+					return err
+				}
+			}
+			return sink.Finish()
+		},
+		OnError: func(path string, err error) {
+			if path == "" {
+				fmt.Fprintf(os.Stderr, "error: policy: %v\n", err)
+				return
+			}
+			fmt.Fprintf(os.Stderr, "error: %v: %v\n", path, err)
+		},
+	}
+	if opts.policy != nil {
+		a.Sync = func() ([]string, error) {
+			r, err := opts.policy.Sync()
+			return r.Documents, err
+		}
+	}
+	if opts.schedule != "" {
+		s, err := agent.ParseSchedule(opts.schedule)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
+		a.Schedule = s
+	}
+	for k, v := range opts.schedules {
+		s, err := agent.ParseSchedule(v)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v: %v\n", k, err)
+			return 1
+		}
+		a.Schedules[k] = s
+	}
+	if opts.updater != nil {
+		a.UpdateInterval = opts.updateEvery
+		a.Update = func() (bool, error) {
+			v, err := opts.updater.Update(scribe.Version)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: update: %v\n", err)
+				return false, err
+			}
+			if v != "" {
+				fmt.Fprintf(os.Stderr, "scribe updated from %v to %v, restarting\n", scribe.Version, v)
+			}
+			return v != "", nil
+		}
+	}
+	for _, x := range opts.blackouts {
+		s, err := agent.ParseSchedule(x)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: blackout: %v\n", err)
+			return 1
+		}
+		a.Blackouts = append(a.Blackouts, s)
+	}
+	var srv *http.Server
+	if addr != "" {
+		// Listen before starting the agent so an address that can not
+		// be used is reported immediately.
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
+		if opts.healthTLS.CertFile != "" {
+			cfg, err := opts.healthTLS.ServerConfig()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: health endpoint: %v\n", err)
+				return 1
+			}
+			ln = tls.NewListener(ln, cfg)
+		}
+		h := a.Handler()
+		if opts.healthAuth != nil {
+			h = auth.Middleware(opts.healthAuth, h)
+		}
+		srv = &http.Server{Handler: h}
+		go func() {
+			err := srv.Serve(ln)
+			if err == http.ErrServerClosed {
+				return
+			}
+			fmt.Fprintf(os.Stderr, "error: health endpoint: %v\n", err)
+			os.Exit(1)
+		}()
+	}
+	err := a.Run(context.Background())
+	if err != agent.ErrUpdated {
+		return 0
+	}
+	// The health endpoint is closed so the new executable can listen on
+	// the address.
+	if srv != nil {
+		srv.Close()
+	}
+	err = restart(opts.updater.Path)
+	fmt.Fprintf(os.Stderr, "error: restarting %v: %v\n", opts.updater.Path, err)
+	return 1
+}
+
+// Replace the running process with the executable at path, using the same
+// arguments and environment. On Windows, where a process can not be
+// replaced, the executable is started and this process exits. Only returns
+// if the executable can not be started.
+func restart(path string) error {
+	if runtime.GOOS != "windows" {
+		return syscall.Exec(path, os.Args, os.Environ())
+	}
+	cmd := exec.Command(path, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	err := cmd.Start()
+	if err != nil {
+		return err
+	}
+	os.Exit(0)
+	return nil
+}
+
+// Return the authenticator for the health endpoint, accepting the bearer
+// tokens in the file at path, and client certificates if the endpoint
+// requires them. Returns nil if neither is used.
+func healthAuth(path string, opts scribe.TLSOptions) (auth.Authenticator, error) {
+	var ret []auth.Authenticator
+	if path != "" {
+		tokens, err := auth.LoadTokens(path)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, auth.Tokens(tokens))
+	}
+	if opts.CAFile != "" && opts.CertFile != "" {
+		ret = append(ret, auth.ClientCert())
+	}
+	if len(ret) == 0 {
+		return nil, nil
+	}
+	return auth.Any(ret...), nil
+}
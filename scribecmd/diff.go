@@ -0,0 +1,74 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/mozilla/scribe"
+	"os"
+)
+
+// Exit status of the diff command when the documents differ.
+const diffExitChanged = 2
+
+// Run the diff command, comparing two versions of a document and writing
+// the variables, tables, objects and tests that changed. Returns the exit
+// status.
+func runDiff(args []string) int {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	jsonFmt := fs.Bool("j", false, "JSON output mode")
+	debug := fs.Bool("d", false, "enable debugging")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: scribecmd diff [-d] [-j] old new\n\n"+
+			"exit status is 0 if the documents are equivalent, %v if they differ, and 1 on error\n", diffExitChanged)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 1
+	}
+	if *debug {
+		scribe.SetDebug(true, os.Stderr)
+	}
+
+	var docs [2]scribe.Document
+	for i := range docs {
+		fd, err := openDocument(fs.Arg(i))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
+		docs[i], err = scribe.LoadDocument(fd)
+		fd.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v: %v\n", fs.Arg(i), err)
+			return 1
+		}
+	}
+	d, err := scribe.DiffDocuments(&docs[0], &docs[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	if *jsonFmt {
+		buf, err := json.MarshalIndent(d, "", "    ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
+		fmt.Fprintf(os.Stdout, "%s\n", buf)
+	} else {
+		fmt.Fprint(os.Stdout, d.String())
+	}
+	if !d.Empty() {
+		return diffExitChanged
+	}
+	return 0
+}
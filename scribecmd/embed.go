@@ -0,0 +1,30 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+//go:build embed
+// +build embed
+
+package main
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// The documents in the embedded directory, see the static target in the
+// Makefile.
+//
+//go:embed embedded
+var embeddedFS embed.FS
+
+func init() {
+	sub, err := fs.Sub(embeddedFS, "embedded")
+	if err != nil {
+		panic(err)
+	}
+	embeddedDocs = sub
+}
@@ -0,0 +1,59 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Documents compiled into the binary, set when built with the embed tag.
+// Embedded documents are evaluated if no document is specified, and can be
+// selected individually as embedded:name.
+var embeddedDocs fs.FS
+
+const embeddedPrefix = "embedded:"
+
+// Return the paths of the embedded documents, sorted by name.
+func embeddedDocuments() ([]string, error) {
+	ret := make([]string, 0)
+	if embeddedDocs == nil {
+		return ret, nil
+	}
+	ents, err := fs.ReadDir(embeddedDocs, ".")
+	if err != nil {
+		return nil, err
+	}
+	for _, x := range ents {
+		if x.IsDir() {
+			continue
+		}
+		switch path.Ext(x.Name()) {
+		case ".json", ".yaml", ".yml":
+			ret = append(ret, embeddedPrefix+x.Name())
+		}
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// Open the document at p, which is a file, an embedded document or - for
+// stdin.
+func openDocument(p string) (io.ReadCloser, error) {
+	if p == "-" {
+		return os.Stdin, nil
+	}
+	if strings.HasPrefix(p, embeddedPrefix) && embeddedDocs != nil {
+		return embeddedDocs.Open(strings.TrimPrefix(p, embeddedPrefix))
+	}
+	return os.Open(p)
+}
@@ -0,0 +1,107 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mozilla/scribe"
+)
+
+// The exit status used when the exit policy is not satisfied.
+const exitPolicyStatus = 3
+
+// exitPolicy determines the exit status of the command based on test
+// outcomes, so scribecmd can be used to gate pipelines on compliance.
+//
+// A test is considered to have failed if it resulted in an error, or if the
+// master result of the test does not match the expectedresult value of the
+// test. Failures that have been waived are not considered failures.
+//
+// The policy can be one of:
+//
+// zero: always exit with zero status
+//
+// any: fail if any test fails
+//
+// critical: fail if any critical test fails, critical tests are identified
+// using a tag in the form key=value (severity=critical by default)
+//
+// score:N: fail if less than N percent of tests pass
+type exitPolicy struct {
+	mode        string
+	minScore    float64
+	criticalKey string
+	criticalVal string
+
+	total          int
+	failed         int
+	criticalFailed int
+}
+
+func newExitPolicy(policy string, critical string) (ret exitPolicy, err error) {
+	s := strings.SplitN(critical, "=", 2)
+	if len(s) != 2 {
+		return ret, fmt.Errorf("critical tag must be in the form key=value")
+	}
+	ret.criticalKey = s[0]
+	ret.criticalVal = s[1]
+	switch {
+	case policy == "zero", policy == "any", policy == "critical":
+		ret.mode = policy
+	case strings.HasPrefix(policy, "score:"):
+		ret.mode = "score"
+		ret.minScore, err = strconv.ParseFloat(strings.TrimPrefix(policy, "score:"), 64)
+		if err != nil || ret.minScore < 0 || ret.minScore > 100 {
+			return ret, fmt.Errorf("invalid score threshold in exit policy %v", policy)
+		}
+	default:
+		return ret, fmt.Errorf("invalid exit policy %v", policy)
+	}
+	return ret, nil
+}
+
+// Record the outcome of a test.
+func (e *exitPolicy) add(t *scribe.Test, tr scribe.TestResult) {
+	e.total++
+	if tr.Waived || tr.NotApplicable || (!tr.IsError && tr.MasterResult == t.ExpectedResult) {
+		return
+	}
+	e.failed++
+	for _, x := range t.Tags {
+		if x.Key == e.criticalKey && x.Value == e.criticalVal {
+			e.criticalFailed++
+			break
+		}
+	}
+}
+
+// Return the exit status and a description of why the policy failed, if it
+// did.
+func (e *exitPolicy) status() (int, string) {
+	switch e.mode {
+	case "any":
+		if e.failed > 0 {
+			return exitPolicyStatus, fmt.Sprintf("%v of %v tests failed", e.failed, e.total)
+		}
+	case "critical":
+		if e.criticalFailed > 0 {
+			return exitPolicyStatus, fmt.Sprintf("%v critical tests failed", e.criticalFailed)
+		}
+	case "score":
+		if e.total == 0 {
+			return 0, ""
+		}
+		score := float64(e.total-e.failed) / float64(e.total) * 100
+		if score < e.minScore {
+			return exitPolicyStatus, fmt.Sprintf("score %.1f%% is below %v%%", score, e.minScore)
+		}
+	}
+	return 0, ""
+}
@@ -7,10 +7,24 @@
 package main
 
 import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
 	"flag"
 	"fmt"
+	_ "github.com/lib/pq"
 	"github.com/mozilla/scribe"
+	"github.com/mozilla/scribe/notify"
+	"github.com/mozilla/scribe/output"
+	"github.com/mozilla/scribe/remote"
+	"github.com/mozilla/scribe/siem"
+	"github.com/mozilla/scribe/update"
+	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
 var flagDebug bool
@@ -23,12 +37,65 @@ func failExit(t scribe.TestResult) {
 func main() {
 	var (
 		docpath      string
+		configPath   string
+		showCaps     bool
+		compatPath   string
+		partial      bool
+		strict       bool
 		expectedExit bool
 		testHooks    bool
 		showVersion  bool
 		lineFmt      bool
 		jsonFmt      bool
 		onlyTrue     bool
+		streamFmt    bool
+		reportFmt    string
+		outputSinks  listFlag
+		reportGroup  string
+		showCoverage bool
+		exitMode     string
+		criticalTag  string
+		waiverPath   string
+		waiverKey    string
+		waiverNoKey  bool
+		remoteHost   string
+		remoteHelper string
+		evidencePath string
+		replayPath   string
+		metadata     = make(metadataFlag)
+		normalize    bool
+		verifyEx     bool
+		ignorePath   string
+		encrypt      bool
+		invURL       string
+		invHost      string
+		hookURL      string
+		hookFormat   string
+		hookFailures bool
+		hookRoutes   listFlag
+		baselinePath string
+		baselineRec  string
+		siemFmt      string
+		siemAddr     string
+		graphFmt     string
+		explainTest  string
+		concurrency  int
+		maxFailures  int
+		redactions   listFlag
+		updateURL    string
+		updateKey    string
+		noDedup      bool
+		wasmRuntime  string
+		limits       scribe.ResourceLimits
+		agentEvery   time.Duration
+		healthAddr   string
+		healthTokens string
+		agentOpts    agentOptions
+		policyURL    string
+		policyDir    string
+		policyKey    string
+		policyNoKey  bool
+		tlsOpts      scribe.TLSOptions
 	)
 
 	err := scribe.Bootstrap()
@@ -37,14 +104,83 @@ func main() {
 		os.Exit(1)
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "repl" {
+		os.Exit(runRepl(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		os.Exit(runDiff(os.Args[2:]))
+	}
+
+	flag.DurationVar(&agentEvery, "agent", 0, "run as an agent, evaluating documents every interval")
+	flag.Var(&agentOpts.blackouts, "blackout", "do not evaluate documents in agent mode during minutes matching cron expression (can be repeated)")
+	flag.StringVar(&baselinePath, "baseline", "", "compare baseline tests against baseline at path")
+	flag.StringVar(&baselineRec, "baseline-record", "", "record baseline tests to baseline at path")
+	flag.StringVar(&compatPath, "compat", "", "check document against agent capabilities (from -capabilities) at path and exit")
+	flag.StringVar(&configPath, "config", "", "path to run configuration file (YAML, TOML or JSON)")
 	flag.BoolVar(&flagDebug, "d", false, "enable debugging")
+	flag.BoolVar(&showCoverage, "c", false, "show document coverage and exit")
+	flag.BoolVar(&showCaps, "capabilities", false, "write the features supported by this build to stdout and exit")
 	flag.BoolVar(&expectedExit, "e", false, "exit if result is unexpected")
-	flag.StringVar(&docpath, "f", "", "path to document")
+	flag.BoolVar(&encrypt, "encrypt", false, "write document encrypted with the key in "+scribe.DocumentKeyEnv+" to stdout and exit")
+	flag.StringVar(&evidencePath, "E", "", "record evidence archive to path")
+	flag.StringVar(&explainTest, "explain", "", "evaluate test and write an explanation of the result to stdout and exit")
+	flag.StringVar(&docpath, "f", "", "path to document, - for stdin, or embedded:name for an embedded document")
+	flag.StringVar(&healthAddr, "health", "", "serve agent health and status at address (e.g. :9100)")
+	flag.StringVar(&healthTokens, "health-tokens", "", "require bearer token from file at path, each optionally followed by a name, for -health")
+	flag.StringVar(&remoteHost, "H", "", "evaluate document on remote host over ssh")
+	flag.StringVar(&remoteHelper, "helper", "", "helper binary for remote host (default this binary)")
+	flag.StringVar(&graphFmt, "graph", "", "write document graph to stdout and exit (dot or json)")
+	flag.StringVar(&criticalTag, "k", "severity=critical", "tag identifying critical tests for exit policy")
+	flag.StringVar(&invURL, "inventory", "", "query packages from inventory service URL, {host} is replaced with the host name")
+	flag.StringVar(&invHost, "inventory-host", "", "host name used for inventory queries (default this host)")
+	flag.StringVar(&ignorePath, "i", "", "path to ignore file excluding paths from file system sources")
+	flag.DurationVar(&agentOpts.jitter, "jitter", 0, "delay each agent run by a random duration of up to jitter")
 	flag.BoolVar(&lineFmt, "l", false, "output one result per line")
+	flag.Int64Var(&limits.MaxBytes, "max-bytes", 0, "limit bytes read from files per document (0 for no limit)")
+	flag.IntVar(&limits.MaxFiles, "max-files", 0, "limit files opened per document (0 for no limit)")
+	flag.DurationVar(&limits.MaxTime, "max-time", 0, "limit analysis time per document (0 for no limit)")
+	flag.IntVar(&maxFailures, "max-failures", 0, "include at most N false sub-results per test in results (0 for no limit)")
+	flag.Var(&outputSinks, "o", "write results using output sink name[=config] (can be repeated; "+strings.Join(output.Names(), ", ")+")")
+	flag.BoolVar(&normalize, "n", false, "write normalized document to stdout and exit")
+	flag.BoolVar(&noDedup, "no-dedup", false, "evaluate duplicate criteria (same identifier and value) separately")
+	flag.Var(metadata, "m", "attach key=value metadata to results (can be repeated)")
 	flag.BoolVar(&jsonFmt, "j", false, "JSON output mode")
+	flag.StringVar(&siemFmt, "S", "", "output one syslog message per result (rfc5424 or cef)")
+	flag.StringVar(&siemAddr, "syslog", "", "send -S messages to collector (udp://host:port or tcp://host:port) instead of stdout")
+	flag.BoolVar(&strict, "strict", false, "reject documents containing unknown fields")
+	flag.BoolVar(&streamFmt, "s", false, "stream JSON results as tests are evaluated")
+	flag.BoolVar(&partial, "partial", false, "mark tests using sources unsupported on this platform as not applicable instead of failing")
+	flag.IntVar(&concurrency, "p", 1, "number of objects to prepare concurrently")
+	flag.StringVar(&policyURL, "policy", "", "fetch changed documents from policy server manifest at HTTPS URL and evaluate them")
+	flag.StringVar(&policyDir, "policy-dir", "", "directory documents fetched with -policy are kept in")
+	flag.StringVar(&policyKey, "policy-key", "", "path to base64 encoded ed25519 public key policy manifests must be signed with")
+	flag.BoolVar(&policyNoKey, "insecure-policy", false, "fetch documents with -policy without -policy-key, without verifying the manifest signature")
+	flag.Var(&redactions, "redact", "redact matches of expression from captured content (can be repeated)")
+	flag.StringVar(&reportFmt, "r", "", "render a report (html or markdown)")
+	flag.StringVar(&replayPath, "R", "", "evaluate against evidence archive instead of host")
+	flag.DurationVar(&agentOpts.reload, "reload", 0, "check documents for changes every duration in agent mode (default before each run)")
+	flag.StringVar(&agentOpts.schedule, "schedule", "", "run as an agent, evaluating documents on cron expression (e.g. \"0 3 * * *\")")
+	flag.StringVar(&reportGroup, "g", "", "tag key used to group report sections")
 	flag.BoolVar(&testHooks, "t", false, "enable test hooks")
 	flag.BoolVar(&onlyTrue, "T", false, "only show true outcomes in results")
+	flag.StringVar(&tlsOpts.CAFile, "tls-ca", "", "path to PEM CA certificates servers must be signed by, and agent health clients with -tls-cert")
+	flag.StringVar(&tlsOpts.CertFile, "tls-cert", "", "path to PEM client certificate, also used to serve -health over TLS")
+	flag.StringVar(&tlsOpts.KeyFile, "tls-key", "", "path to PEM private key for -tls-cert")
+	flag.StringVar(&tlsOpts.MinVersion, "tls-min-version", "", "minimum TLS version for network connections (1.2 or 1.3, default 1.2)")
+	flag.StringVar(&updateURL, "update", "", "update this executable from signed release manifest at HTTPS URL and exit")
+	flag.DurationVar(&agentOpts.updateEvery, "update-every", 0, "in agent mode, check -update every duration and restart when updated")
+	flag.StringVar(&updateKey, "update-key", "", "path to base64 encoded ed25519 public key for release manifests")
 	flag.BoolVar(&showVersion, "v", false, "show version")
+	flag.BoolVar(&verifyEx, "verify-examples", false, "check filecontent expressions against the examples in documents and exit")
+	flag.StringVar(&wasmRuntime, "wasm-runtime", "", "WebAssembly runtime used by the wasm source (default wasmtime)")
+	flag.StringVar(&hookURL, "webhook", "", "send run summary to webhook URL")
+	flag.StringVar(&hookFormat, "webhook-format", "json", "webhook payload format (json or slack)")
+	flag.BoolVar(&hookFailures, "webhook-failures", false, "send a webhook request for each failed test instead of a summary")
+	flag.Var(&hookRoutes, "webhook-route", "send failures of tests with owner to webhook URL instead of -webhook, as owner=URL (can be repeated)")
+	flag.StringVar(&waiverPath, "w", "", "path to waivers file")
+	flag.StringVar(&waiverKey, "W", "", "path to base64 encoded ed25519 public key for waivers")
+	flag.BoolVar(&waiverNoKey, "insecure-waivers", false, "load waivers file without -W, without verifying its signature")
+	flag.StringVar(&exitMode, "x", "zero", "exit policy (zero, any, critical, or score:N)")
 	flag.Parse()
 
 	if showVersion {
@@ -56,60 +192,856 @@ func main() {
 		scribe.SetDebug(true, os.Stderr)
 	}
 
-	if docpath == "" {
-		fmt.Fprintf(os.Stderr, "error: must specify document path\n")
-		os.Exit(1)
+	if updateURL != "" && agentOpts.updateEvery == 0 {
+		err = scribe.SetTLSOptions(tlsOpts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(selfUpdate(updateURL, updateKey))
 	}
 
-	scribe.TestHooks(testHooks)
+	scribe.SetStrictParsing(strict)
+
+	if showCaps {
+		buf, err := json.MarshalIndent(scribe.GetCapabilities(), "", "    ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stdout, "%s\n", buf)
+		os.Exit(0)
+	}
 
-	fd, err := os.Open(docpath)
+	// Settings in a run configuration apply unless the equivalent option
+	// is specified on the command line.
+	var docpaths []string
+	if configPath != "" {
+		cfg, err := loadRunConfig(configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		set := make(map[string]bool)
+		flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+		if !set["p"] && cfg.Concurrency != 0 {
+			concurrency = cfg.Concurrency
+		}
+		if !set["max-failures"] && cfg.MaxFailures != 0 {
+			maxFailures = cfg.MaxFailures
+		}
+		if !set["max-files"] && cfg.MaxFiles != 0 {
+			limits.MaxFiles = cfg.MaxFiles
+		}
+		if !set["max-bytes"] && cfg.MaxBytes != 0 {
+			limits.MaxBytes = cfg.MaxBytes
+		}
+		if !set["max-time"] && cfg.MaxTime != "" {
+			limits.MaxTime, err = time.ParseDuration(cfg.MaxTime)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: maxtime: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		if !set["redact"] {
+			redactions = cfg.Redactions
+		}
+		for k, v := range cfg.Metadata {
+			if _, ok := metadata[k]; !ok {
+				metadata[k] = v
+			}
+		}
+		if !set["o"] && !set["j"] && !set["l"] && !set["r"] {
+			outputSinks = cfg.Outputs
+		}
+		if docpath == "" {
+			docpaths = cfg.Documents
+		}
+		if !set["policy"] && cfg.Policy != "" {
+			policyURL = cfg.Policy
+		}
+		if !set["policy-dir"] && cfg.PolicyDir != "" {
+			policyDir = cfg.PolicyDir
+		}
+		if !set["policy-key"] && cfg.PolicyKey != "" {
+			policyKey = cfg.PolicyKey
+		}
+		agentOpts.schedules = cfg.Schedules
+		if !set["jitter"] && cfg.Jitter != "" {
+			agentOpts.jitter = cfg.JitterDuration()
+		}
+		if !set["blackout"] {
+			agentOpts.blackouts = cfg.Blackouts
+		}
+		if !set["reload"] && cfg.Reload != "" {
+			agentOpts.reload = cfg.ReloadDuration()
+		}
+		if !set["tls-ca"] && cfg.TLSCA != "" {
+			tlsOpts.CAFile = cfg.TLSCA
+		}
+		if !set["tls-cert"] && !set["tls-key"] && cfg.TLSCert != "" {
+			tlsOpts.CertFile, tlsOpts.KeyFile = cfg.TLSCert, cfg.TLSKey
+		}
+		if !set["tls-min-version"] && cfg.TLSMinVersion != "" {
+			tlsOpts.MinVersion = cfg.TLSMinVersion
+		}
+		if d := cfg.TimeoutDuration(); d != 0 {
+			time.AfterFunc(d, func() {
+				fmt.Fprintf(os.Stderr, "error: run did not complete within %v\n", d)
+				os.Exit(1)
+			})
+		}
+	}
+	// TLS options apply to all network connections, so are set before
+	// documents are fetched.
+	err = scribe.SetTLSOptions(tlsOpts)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		os.Exit(1)
 	}
-	defer fd.Close()
-	doc, err := scribe.LoadDocument(fd)
+	if docpath != "" {
+		docpaths = []string{docpath}
+	} else if policyURL != "" {
+		agentOpts.policy, err = newSyncer(policyURL, policyDir, policyKey, policyNoKey)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		docpaths, err = syncPolicy(agentOpts.policy)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if len(docpaths) == 0 {
+		docpaths, err = embeddedDocuments()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if len(docpaths) == 0 {
+		fmt.Fprintf(os.Stderr, "error: must specify document path\n")
+		os.Exit(1)
+	}
+	if len(docpaths) > 1 && (normalize || graphFmt != "" || explainTest != "" || showCoverage || compatPath != "" ||
+		streamFmt || encrypt || remoteHost != "") {
+		fmt.Fprintf(os.Stderr, "error: option can only be used with a single document\n")
+		os.Exit(1)
+	}
+	agentOpts.interval = agentEvery
+	agentMode := agentEvery != 0 || agentOpts.schedule != ""
+	if agentMode && (normalize || graphFmt != "" || explainTest != "" || showCoverage || compatPath != "" ||
+		streamFmt || encrypt || remoteHost != "" || evidencePath != "" || baselineRec != "" || expectedExit || verifyEx) {
+		fmt.Fprintf(os.Stderr, "error: option can not be used in agent mode\n")
+		os.Exit(1)
+	}
+	// Agent settings in a run configuration are ignored outside agent
+	// mode, but the equivalent options are rejected.
+	if !agentMode && (healthAddr != "" || flagSet("jitter") || flagSet("blackout") || flagSet("reload")) {
+		fmt.Fprintf(os.Stderr, "error: -health, -jitter, -blackout and -reload require -agent or -schedule\n")
+		os.Exit(1)
+	}
+	if agentOpts.updateEvery != 0 {
+		if !agentMode || updateURL == "" {
+			fmt.Fprintf(os.Stderr, "error: -update-every requires -update and -agent or -schedule\n")
+			os.Exit(1)
+		}
+		agentOpts.updater, err = newUpdater(updateURL, updateKey)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if healthTokens != "" && healthAddr == "" {
+		fmt.Fprintf(os.Stderr, "error: -health-tokens requires -health\n")
+		os.Exit(1)
+	}
+	notifier, err := newNotifier(hookURL, hookRoutes, hookFormat, hookFailures)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		os.Exit(1)
 	}
+	if graphFmt != "" && graphFmt != "dot" && graphFmt != "json" {
+		fmt.Fprintf(os.Stderr, "error: graph format must be dot or json\n")
+		os.Exit(1)
+	}
+	if reportFmt != "" && reportFmt != "html" && reportFmt != "markdown" {
+		fmt.Fprintf(os.Stderr, "error: report format must be html or markdown\n")
+		os.Exit(1)
+	}
 
-	// In expectedExit mode, set a callback in the scribe module that will
-	// be called immediately during analysis if a test result does not
-	// match the boolean expectedresult parameter in the test. The will
-	// result in the tool exiting with return code 2.
-	if expectedExit {
-		scribe.ExpectedCallback(failExit)
+	// Select the output sinks for results; -o takes precedence over the
+	// format flags. In streaming mode results are written to stdout as
+	// they are evaluated, so only sinks given using -o are used.
+	if len(outputSinks) == 0 && !streamFmt {
+		if reportFmt != "" {
+			outputSinks = append(outputSinks, reportFmt+"="+reportGroup)
+		} else if lineFmt {
+			outputSinks = append(outputSinks, "lines")
+		} else if jsonFmt {
+			outputSinks = append(outputSinks, "json")
+		} else {
+			outputSinks = append(outputSinks, "text")
+		}
 	}
+	sinks := make([]output.Sink, 0)
+	for _, x := range outputSinks {
+		name, config := x, ""
+		if i := strings.Index(x, "="); i != -1 {
+			name, config = x[:i], x[i+1:]
+		}
+		s, err := output.New(name, os.Stdout, config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		sinks = append(sinks, s)
+	}
+	sink := output.Multi(sinks...)
 
-	err = scribe.AnalyzeDocument(doc)
+	if siemFmt == "" && siemAddr != "" {
+		siemFmt = "rfc5424"
+	}
+	if streamFmt && siemFmt != "" && siemAddr == "" {
+		fmt.Fprintf(os.Stderr, "error: -s can only be used with -S if messages are sent using -syslog\n")
+		os.Exit(1)
+	}
+	var (
+		siemOut  *siem.Writer
+		siemConn io.WriteCloser
+	)
+	if siemFmt != "" {
+		var w io.Writer = os.Stdout
+		if siemAddr != "" {
+			siemConn, err = siem.Dial(siemAddr)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+			w = siemConn
+		}
+		siemOut, err = siem.NewWriter(w, siemFmt)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	policy, err := newExitPolicy(exitMode, criticalTag)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		os.Exit(1)
 	}
 
-	for _, x := range doc.GetTestIdentifiers() {
-		tr, err := scribe.GetResults(&doc, x)
+	scribe.TestHooks(testHooks)
+	scribe.SetMetadata(metadata)
+	scribe.SetConcurrency(concurrency)
+	scribe.SetPartialEvaluation(partial)
+	scribe.SetDeduplication(!noDedup)
+	if wasmRuntime != "" {
+		scribe.SetWASMRuntime(wasmRuntime)
+	}
+	scribe.SetMaxFailures(maxFailures)
+	scribe.SetResourceLimits(limits)
+	err = scribe.SetRedactions(redactions)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if waiverPath != "" {
+		err = loadWaivers(waiverPath, waiverKey, waiverNoKey)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if invURL != "" {
+		if invHost == "" {
+			invHost, err = os.Hostname()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		scribe.InstallPackageQuery(scribe.InventoryPackageQuery(invURL, invHost))
+	}
+
+	if ignorePath != "" {
+		err = loadIgnore(ignorePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if baselinePath != "" && baselineRec != "" {
+		fmt.Fprintf(os.Stderr, "error: baseline can not be recorded and compared together\n")
+		os.Exit(1)
+	}
+	if baselinePath != "" {
+		err = loadBaseline(baselinePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	} else if baselineRec != "" {
+		scribe.RecordBaseline(true)
+	}
+
+	if replayPath != "" {
+		err = replayEvidence(replayPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	} else if evidencePath != "" {
+		scribe.RecordEvidence(true)
+	}
+
+	if agentMode {
+		agentOpts.healthTLS = tlsOpts
+		agentOpts.healthAuth, err = healthAuth(healthTokens, tlsOpts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(runAgent(docpaths, agentOpts, healthAddr, sink, onlyTrue))
+	}
+
+	// Each document is loaded and analyzed in turn; options that write
+	// something other than results and exit are only accepted with a
+	// single document.
+	analyzed := make([]*scribe.Document, 0, len(docpaths))
+	examplesPassed := true
+	for _, docpath := range docpaths {
+		fd, err := openDocument(docpath)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "error obtaining results for \"%v\": %v\n", x, err)
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+
+		if encrypt {
+			err = scribe.EncryptDocument(os.Stdout, fd)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+			os.Exit(0)
+		}
+
+		if remoteHost != "" {
+			if ignorePath != "" {
+				fmt.Fprintf(os.Stderr, "error: ignore file can not be used with remote evaluation\n")
+				os.Exit(1)
+			}
+			if baselinePath != "" || baselineRec != "" {
+				fmt.Fprintf(os.Stderr, "error: baseline can not be used with remote evaluation\n")
+				os.Exit(1)
+			}
+			os.Exit(runRemote(fd, remoteHost, remoteHelper, testHooks, metadata, jsonFmt))
+		}
+
+		doc, err := scribe.LoadDocument(fd)
+		fd.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+
+		if verifyEx {
+			if !verifyExamples(docpath, &doc) {
+				examplesPassed = false
+			}
 			continue
 		}
-		if onlyTrue {
-			if !tr.MasterResult {
-				continue
+
+		if normalize {
+			ndoc, err := doc.Normalize()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+			buf, err := json.MarshalIndent(ndoc, "", "    ")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
 			}
+			fmt.Fprintf(os.Stdout, "%s\n", buf)
+			os.Exit(0)
 		}
-		if lineFmt {
-			for _, x := range tr.SingleLineResults() {
-				fmt.Fprintf(os.Stdout, "%v\n", x)
+
+		if graphFmt != "" {
+			g, err := doc.Graph()
+			if err == nil {
+				if graphFmt == "dot" {
+					err = g.WriteDOT(os.Stdout)
+				} else {
+					var buf []byte
+					buf, err = json.MarshalIndent(g, "", "    ")
+					if err == nil {
+						fmt.Fprintf(os.Stdout, "%s\n", buf)
+					}
+				}
 			}
-		} else if jsonFmt {
-			fmt.Fprintf(os.Stdout, "%v\n", tr.JSON())
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+			os.Exit(0)
+		}
+
+		if explainTest != "" {
+			e, err := doc.ExplainTest(explainTest)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+			buf, err := json.MarshalIndent(e, "", "    ")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Fprintf(os.Stdout, "%s\n", buf)
+			os.Exit(0)
+		}
+
+		if compatPath != "" {
+			os.Exit(checkCompatibility(&doc, compatPath))
+		}
+
+		if showCoverage {
+			cov := doc.Coverage()
+			for _, x := range cov.UnusedObjects {
+				fmt.Fprintf(os.Stdout, "unused object: %v\n", x)
+			}
+			for _, x := range cov.NoEvaluation {
+				fmt.Fprintf(os.Stdout, "test without evaluation criteria: %v\n", x)
+			}
+			for _, x := range cov.Paths {
+				fmt.Fprintf(os.Stdout, "path: %v\n", x)
+			}
+			for _, x := range cov.Packages {
+				fmt.Fprintf(os.Stdout, "package: %v\n", x)
+			}
+			os.Exit(0)
+		}
+
+		// In expectedExit mode, set a callback in the scribe module that will
+		// be called immediately during analysis if a test result does not
+		// match the boolean expectedresult parameter in the test. The will
+		// result in the tool exiting with return code 2.
+		if expectedExit {
+			scribe.ExpectedCallback(failExit)
+		}
+
+		// In streaming mode, results are written as each test completes,
+		// and are then processed in the same way as other results.
+		if streamFmt {
+			err = scribe.AnalyzeDocumentStream(doc, os.Stdout)
+		} else {
+			err = scribe.AnalyzeDocument(doc)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v: %v\n", docpath, err)
+			os.Exit(1)
+		}
+		if u := doc.ResourceUsage(); u.Exceeded != "" {
+			fmt.Fprintf(os.Stderr, "warning: %v: resource limit exceeded, %v\n", docpath, u.Exceeded)
+		}
+		analyzed = append(analyzed, &doc)
+	}
+	if verifyEx {
+		if !examplesPassed {
+			os.Exit(2)
+		}
+		os.Exit(0)
+	}
+	writeEvidence(evidencePath, replayPath)
+	writeBaseline(baselineRec)
+
+	hostname, _ := os.Hostname()
+	summary := notify.NewSummary(hostname)
+	err = sink.Start(output.RunInfo{Document: strings.Join(docpaths, ","), Host: hostname, Time: summary.Time})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	for _, doc := range analyzed {
+		for _, x := range doc.GetTestIdentifiers() {
+			tr, err := scribe.GetResults(doc, x)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error obtaining results for \"%v\": %v\n", x, err)
+				continue
+			}
+			t, err := doc.GetTest(x)
+			if err == nil {
+				failed := !tr.NotApplicable && (tr.IsError || tr.MasterResult != t.ExpectedResult)
+				policy.add(t, tr)
+				summary.Add(tr, failed)
+				if siemOut != nil {
+					err = siemOut.Write(tr, failed)
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "error writing syslog message: %v\n", err)
+					}
+				}
+			}
+			if siemOut != nil && siemAddr == "" {
+				continue
+			}
+			if onlyTrue {
+				if !tr.MasterResult {
+					continue
+				}
+			}
+			err = sink.WriteResult(tr)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error writing result for \"%v\": %v\n", x, err)
+			}
+		}
+	}
+	err = sink.Finish()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if notifier != nil {
+		err = notifier.Notify(summary)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error sending webhook notification: %v\n", err)
+		}
+	}
+
+	if siemConn != nil {
+		siemConn.Close()
+	}
+
+	status, reason := policy.status()
+	if status != 0 {
+		fmt.Fprintf(os.Stderr, "exit policy failed: %v\n", reason)
+	}
+	os.Exit(status)
+}
+
+// Return the notifier sending results to the webhook at url, and to the
+// webhooks for test owners in routes, given as owner=URL. Returns nil if
+// no webhooks are used.
+func newNotifier(url string, routes []string, format string, perFailure bool) (notify.Notifier, error) {
+	if url == "" && len(routes) == 0 {
+		return nil, nil
+	}
+	if format != "json" && format != "slack" {
+		return nil, fmt.Errorf("webhook format must be json or slack")
+	}
+	var def notify.Notifier
+	if url != "" {
+		def = &notify.Webhook{URL: url, Format: format, PerFailure: perFailure}
+	}
+	if len(routes) == 0 {
+		return def, nil
+	}
+	ret := &notify.Router{Owners: make(map[string]notify.Notifier), Default: def}
+	for _, x := range routes {
+		args := strings.SplitN(x, "=", 2)
+		if len(args) != 2 || args[0] == "" || args[1] == "" {
+			return nil, fmt.Errorf("webhook route must be owner=URL")
+		}
+		ret.Owners[args[0]] = &notify.Webhook{URL: args[1], Format: format, PerFailure: perFailure}
+	}
+	return ret, nil
+}
+
+// Check the document against agent capabilities stored at path, writing
+// anything that cannot be evaluated and returning the exit status.
+func checkCompatibility(doc *scribe.Document, path string) int {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	var caps scribe.Capabilities
+	err = json.Unmarshal(buf, &caps)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v: %v\n", path, err)
+		return 1
+	}
+	res := scribe.CheckCompatibility(doc, caps)
+	for _, x := range res {
+		switch {
+		case x.Secret != "":
+			fmt.Fprintf(os.Stdout, "secret %v: %v\n", x.Secret, x.Reason)
+		case x.Object != "":
+			fmt.Fprintf(os.Stdout, "object %v: %v\n", x.Object, x.Reason)
+		default:
+			fmt.Fprintf(os.Stdout, "test %v: %v\n", x.Test, x.Reason)
+		}
+	}
+	if len(res) != 0 {
+		return 2
+	}
+	return 0
+}
+
+// Check the expression examples in the document at path, writing the
+// examples that failed and a summary. Returns true if all examples passed.
+func verifyExamples(path string, doc *scribe.Document) bool {
+	res := doc.VerifyExamples()
+	failed := 0
+	for _, x := range res {
+		if !x.Passed {
+			fmt.Fprintf(os.Stdout, "%v: object %v: example %q: %v\n", path, x.Object, x.Input, x.Reason)
+			failed++
+		}
+	}
+	fmt.Fprintf(os.Stdout, "%v: %v of %v examples passed\n", path, len(res)-failed, len(res))
+	return failed == 0
+}
+
+func loadRunConfig(path string) (scribe.RunConfig, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return scribe.RunConfig{}, err
+	}
+	defer fd.Close()
+	cfg, err := scribe.LoadRunConfig(fd)
+	if err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.Apply()
+}
+
+// Load a base64 encoded ed25519 public key from path.
+func loadPublicKey(path string) (ed25519.PublicKey, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(buf)))
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("%v: invalid public key", path)
+	}
+	return key, nil
+}
+
+// Load the waivers file at path, verifying it using the key at keypath
+// unless insecure is true and no key is given.
+func loadWaivers(path string, keypath string, insecure bool) error {
+	if keypath == "" && !insecure {
+		return fmt.Errorf("-w requires -W to verify the waivers, or -insecure-waivers")
+	}
+	fd, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	var w scribe.Waivers
+	if keypath == "" {
+		fmt.Fprintf(os.Stderr, "warning: waivers in %v are not verified\n", path)
+		w, err = scribe.LoadUnsignedWaivers(fd)
+	} else {
+		var key ed25519.PublicKey
+		key, err = loadPublicKey(keypath)
+		if err != nil {
+			return err
+		}
+		w, err = scribe.LoadWaivers(fd, key)
+	}
+	if err != nil {
+		return err
+	}
+	scribe.SetWaivers(&w)
+	return nil
+}
+
+// Return an updater for this executable using the release manifest at
+// manifestURL, which is signed using the key at keypath.
+func newUpdater(manifestURL string, keypath string) (*update.Updater, error) {
+	if keypath == "" {
+		return nil, fmt.Errorf("-update requires -update-key")
+	}
+	key, err := loadPublicKey(keypath)
+	if err != nil {
+		return nil, err
+	}
+	path, err := os.Executable()
+	if err == nil {
+		path, err = filepath.EvalSymlinks(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &update.Updater{ManifestURL: manifestURL, Key: key, Path: path}, nil
+}
+
+// Update this executable from the release manifest at manifestURL, which
+// is signed using the key at keypath, returning the exit status.
+func selfUpdate(manifestURL string, keypath string) int {
+	u, err := newUpdater(manifestURL, keypath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	v, err := u.Update(scribe.Version)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: update: %v\n", err)
+		return 1
+	}
+	if v == "" {
+		fmt.Fprintf(os.Stdout, "scribe %v is current\n", scribe.Version)
+	} else {
+		fmt.Fprintf(os.Stdout, "scribe updated from %v to %v\n", scribe.Version, v)
+	}
+	return 0
+}
+
+func loadIgnore(path string) error {
+	fd, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	l, err := scribe.LoadIgnore(fd)
+	if err != nil {
+		return err
+	}
+	scribe.SetIgnore(l)
+	return nil
+}
+
+func loadBaseline(path string) error {
+	fd, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	return scribe.LoadBaseline(fd)
+}
+
+func writeBaseline(path string) {
+	if path == "" {
+		return
+	}
+	fd, err := os.Create(path)
+	if err == nil {
+		err = scribe.WriteBaseline(fd)
+		cerr := fd.Close()
+		if err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: writing baseline: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// Evaluate the document on a remote host, displaying results and returning
+// the exit status.
+func runRemote(doc io.Reader, host string, helper string, testHooks bool,
+	metadata metadataFlag, jsonFmt bool) int {
+	var err error
+	if helper == "" {
+		helper, err = os.Executable()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
+	}
+	e := remote.Executor{Host: host, HelperPath: helper}
+	if testHooks {
+		e.HelperArgs = append(e.HelperArgs, "-t")
+	}
+	for k, v := range metadata {
+		e.HelperArgs = append(e.HelperArgs, "-m", k+"="+v)
+	}
+	results, err := e.Run(doc)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	for _, x := range results {
+		if jsonFmt {
+			fmt.Fprintf(os.Stdout, "%v\n", x.JSON())
 		} else {
-			fmt.Fprintf(os.Stdout, "%v\n", tr.String())
+			fmt.Fprintf(os.Stdout, "%v\n", x.String())
+		}
+	}
+	return 0
+}
+
+func replayEvidence(path string) error {
+	fd, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	return scribe.ReplayEvidence(fd)
+}
+
+// Write the evidence archive if recording was requested, exiting on error.
+func writeEvidence(path string, replayPath string) {
+	if path == "" || replayPath != "" {
+		return
+	}
+	fd, err := os.Create(path)
+	if err == nil {
+		err = scribe.WriteEvidence(fd)
+		cerr := fd.Close()
+		if err == nil {
+			err = cerr
 		}
 	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: writing evidence: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// metadataFlag collects key=value pairs specified with repeated -m flags.
+type metadataFlag map[string]string
+
+func (m metadataFlag) String() string {
+	ret := make([]string, 0)
+	for k, v := range m {
+		ret = append(ret, k+"="+v)
+	}
+	return strings.Join(ret, ",")
+}
+
+func (m metadataFlag) Set(s string) error {
+	args := strings.SplitN(s, "=", 2)
+	if len(args) != 2 || args[0] == "" {
+		return fmt.Errorf("metadata must be specified as key=value")
+	}
+	m[args[0]] = args[1]
+	return nil
+}
+
+// Return true if the flag was specified on the command line.
+func flagSet(name string) bool {
+	ret := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			ret = true
+		}
+	})
+	return ret
+}
+
+// listFlag collects values specified with repeated flags.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
 
-	os.Exit(0)
+func (l *listFlag) Set(s string) error {
+	*l = append(*l, s)
+	return nil
 }
@@ -0,0 +1,48 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+package main
+
+import (
+	"fmt"
+	"github.com/mozilla/scribe/policy"
+	"os"
+)
+
+// Create a syncer fetching documents from the policy server manifest at
+// manifestURL into dir. The manifest must be signed using the key at
+// keypath, unless insecure is true and no key is given.
+func newSyncer(manifestURL string, dir string, keypath string, insecure bool) (*policy.Syncer, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("-policy requires -policy-dir")
+	}
+	if keypath == "" && !insecure {
+		return nil, fmt.Errorf("-policy requires -policy-key to verify the manifest, or -insecure-policy")
+	}
+	s := &policy.Syncer{ManifestURL: manifestURL, Dir: dir, Insecure: insecure}
+	if keypath != "" {
+		key, err := loadPublicKey(keypath)
+		if err != nil {
+			return nil, err
+		}
+		s.Key = key
+	}
+	return s, nil
+}
+
+// Sync the documents from the policy server, returning the paths of the
+// documents to evaluate. If some documents could not be fetched a warning
+// is written and the local copies are used.
+func syncPolicy(s *policy.Syncer) ([]string, error) {
+	r, err := s.Sync()
+	if err != nil {
+		if len(r.Documents) == 0 {
+			return nil, fmt.Errorf("policy: %v", err)
+		}
+		fmt.Fprintf(os.Stderr, "warning: policy: %v\n", err)
+	}
+	return r.Documents, nil
+}
@@ -0,0 +1,376 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/mozilla/scribe"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const replHelp = `commands:
+  load <path>                   load a document
+  objects                       list objects in the document
+  tests                         list tests in the document
+  show <name>                   show the definition of an object or test
+  set <name> <field> <value>    set a field of an object or test, nested
+                                fields are separated with . (for example
+                                filecontent.expression), value is parsed
+                                as JSON if possible
+  object <json>                 add or replace an object definition
+  test <json>                   add or replace a test definition
+  criteria <object>             evaluate an object and show its criteria
+  eval <test>                   evaluate a test and show the results
+  write <path>                  write the document to path
+  help                          show this help
+  quit                          exit
+`
+
+// repl is an interactive session used to prototype documents, where objects
+// and tests can be modified and evaluated individually.
+type repl struct {
+	doc scribe.Document
+	out io.Writer
+}
+
+// Run the interactive mode, returning the exit status.
+func runRepl(args []string) int {
+	fs := flag.NewFlagSet("repl", flag.ExitOnError)
+	th := fs.Bool("t", false, "enable test hooks")
+	debug := fs.Bool("d", false, "enable debugging")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: scribecmd repl [-d] [-t] [document]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	scribe.TestHooks(*th)
+	if *debug {
+		scribe.SetDebug(true, os.Stderr)
+	}
+
+	r := &repl{out: os.Stdout}
+	if fs.NArg() > 0 {
+		r.command("load " + fs.Arg(0))
+	}
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for {
+		fmt.Fprintf(r.out, "scribe> ")
+		if !scanner.Scan() {
+			fmt.Fprintf(r.out, "\n")
+			break
+		}
+		if !r.command(scanner.Text()) {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// Execute a single command, returning false if the session should end.
+func (r *repl) command(line string) bool {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return true
+	}
+	args := strings.SplitN(line, " ", 2)
+	cmd, arg := args[0], ""
+	if len(args) > 1 {
+		arg = strings.TrimSpace(args[1])
+	}
+	var err error
+	switch cmd {
+	case "quit", "exit":
+		return false
+	case "help", "?":
+		fmt.Fprint(r.out, replHelp)
+	case "load":
+		err = r.load(arg)
+	case "objects":
+		for _, x := range r.doc.Objects {
+			fmt.Fprintf(r.out, "%v\n", x.Object)
+		}
+	case "tests":
+		for _, x := range r.doc.Tests {
+			fmt.Fprintf(r.out, "%v (object %v)\n", x.TestID, x.Object)
+		}
+	case "show":
+		err = r.show(arg)
+	case "set":
+		err = r.set(arg)
+	case "object", "test":
+		err = r.define(cmd, arg)
+	case "criteria":
+		err = r.criteria(arg)
+	case "eval":
+		err = r.eval(arg)
+	case "write":
+		err = r.write(arg)
+	default:
+		err = fmt.Errorf("unknown command %q, try help", cmd)
+	}
+	if err != nil {
+		fmt.Fprintf(r.out, "error: %v\n", err)
+	}
+	return true
+}
+
+func (r *repl) load(path string) error {
+	if path == "" {
+		return fmt.Errorf("load requires a path")
+	}
+	fd, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	doc, err := scribe.LoadDocument(fd)
+	if err != nil {
+		return err
+	}
+	r.doc = doc
+	fmt.Fprintf(r.out, "loaded %v objects and %v tests\n", len(doc.Objects), len(doc.Tests))
+	return nil
+}
+
+// Return the definition of the object or test named name, as a generic
+// map, and a function that replaces the definition in the document.
+func (r *repl) lookup(name string) (map[string]interface{}, func([]byte) error, error) {
+	var (
+		v       interface{}
+		replace func([]byte) error
+	)
+	if o, err := r.doc.GetObject(name); err == nil {
+		v = o
+		replace = func(buf []byte) error {
+			var n scribe.Object
+			err := json.Unmarshal(buf, &n)
+			if err != nil {
+				return err
+			}
+			return r.update(func(d *scribe.Document) { *mustObject(d, name) = n })
+		}
+	} else if t, err := r.doc.GetTest(name); err == nil {
+		v = t
+		replace = func(buf []byte) error {
+			var n scribe.Test
+			err := json.Unmarshal(buf, &n)
+			if err != nil {
+				return err
+			}
+			return r.update(func(d *scribe.Document) { *mustTest(d, name) = n })
+		}
+	} else {
+		return nil, nil, fmt.Errorf("no object or test named %q", name)
+	}
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return nil, nil, err
+	}
+	var m map[string]interface{}
+	err = json.Unmarshal(buf, &m)
+	if err != nil {
+		return nil, nil, err
+	}
+	return m, replace, nil
+}
+
+func mustObject(d *scribe.Document, name string) *scribe.Object {
+	o, _ := d.GetObject(name)
+	return o
+}
+
+func mustTest(d *scribe.Document, name string) *scribe.Test {
+	t, _ := d.GetTest(name)
+	return t
+}
+
+// Apply a modification to a copy of the document, replacing the document
+// only if the modified copy is valid.
+func (r *repl) update(f func(*scribe.Document)) error {
+	buf, err := json.Marshal(r.doc)
+	if err != nil {
+		return err
+	}
+	var nd scribe.Document
+	err = json.Unmarshal(buf, &nd)
+	if err != nil {
+		return err
+	}
+	f(&nd)
+	err = nd.Validate()
+	if err != nil {
+		return err
+	}
+	r.doc = nd
+	return nil
+}
+
+func (r *repl) show(name string) error {
+	m, _, err := r.lookup(name)
+	if err != nil {
+		return err
+	}
+	buf, err := json.MarshalIndent(prune(m), "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(r.out, "%s\n", buf)
+	return nil
+}
+
+// Remove empty values from a definition, which would otherwise include an
+// empty entry for every source and evaluator type.
+func prune(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		for k, e := range x {
+			e = prune(e)
+			if e == nil {
+				delete(x, k)
+				continue
+			}
+			x[k] = e
+		}
+		if len(x) == 0 {
+			return nil
+		}
+	case []interface{}:
+		if len(x) == 0 {
+			return nil
+		}
+	case string:
+		if x == "" {
+			return nil
+		}
+	case bool:
+		if !x {
+			return nil
+		}
+	case float64:
+		if x == 0 {
+			return nil
+		}
+	}
+	return v
+}
+
+func (r *repl) set(arg string) error {
+	args := strings.SplitN(arg, " ", 3)
+	if len(args) != 3 {
+		return fmt.Errorf("usage: set <name> <field> <value>")
+	}
+	m, replace, err := r.lookup(args[0])
+	if err != nil {
+		return err
+	}
+	path := strings.Split(args[1], ".")
+	ptr := m
+	for _, x := range path[:len(path)-1] {
+		next, ok := ptr[x].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			ptr[x] = next
+		}
+		ptr = next
+	}
+	key := path[len(path)-1]
+	// Try the value as JSON first, so booleans and lists can be set, and
+	// fall back to a string if that fails.
+	var v interface{}
+	if json.Unmarshal([]byte(args[2]), &v) == nil {
+		ptr[key] = v
+		buf, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		if replace(buf) == nil {
+			return nil
+		}
+	}
+	ptr[key] = args[2]
+	buf, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return replace(buf)
+}
+
+func (r *repl) define(kind string, arg string) error {
+	if kind == "object" {
+		var n scribe.Object
+		err := json.Unmarshal([]byte(arg), &n)
+		if err != nil {
+			return err
+		}
+		return r.update(func(d *scribe.Document) {
+			if o, err := d.GetObject(n.Object); err == nil {
+				*o = n
+				return
+			}
+			d.Objects = append(d.Objects, n)
+		})
+	}
+	var n scribe.Test
+	err := json.Unmarshal([]byte(arg), &n)
+	if err != nil {
+		return err
+	}
+	return r.update(func(d *scribe.Document) {
+		if t, err := d.GetTest(n.TestID); err == nil {
+			*t = n
+			return
+		}
+		d.Tests = append(d.Tests, n)
+	})
+}
+
+func (r *repl) criteria(name string) error {
+	c, err := r.doc.EvaluateObject(name)
+	if err != nil {
+		return err
+	}
+	for _, x := range c {
+		if x.Location != nil && x.Location.Line != 0 {
+			fmt.Fprintf(r.out, "%v:%v: %q\n", x.Identifier, x.Location.Line, x.Value)
+			continue
+		}
+		fmt.Fprintf(r.out, "%v: %q\n", x.Identifier, x.Value)
+	}
+	fmt.Fprintf(r.out, "%v criteria\n", len(c))
+	return nil
+}
+
+func (r *repl) eval(name string) error {
+	tr, err := r.doc.EvaluateTest(name)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(r.out, "%v\n", tr.String())
+	return nil
+}
+
+func (r *repl) write(path string) error {
+	if path == "" {
+		return fmt.Errorf("write requires a path")
+	}
+	buf, err := json.MarshalIndent(r.doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(buf, '\n'), 0644)
+}
@@ -0,0 +1,158 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"github.com/mozilla/scribe"
+	"github.com/mozilla/scribe/auth"
+	"github.com/mozilla/scribe/collector"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Read a token file, returning the fields of each line that is not blank
+// or a comment.
+func readTokens(path string) ([][]string, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	var ret [][]string
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ret = append(ret, strings.Fields(line))
+	}
+	return ret, scanner.Err()
+}
+
+// Load agent tokens from path, where each line is a token and the host it
+// may submit results for, or * for any host.
+func loadAgentTokens(path string) (map[string]string, error) {
+	lines, err := readTokens(path)
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]string)
+	for i, x := range lines {
+		if len(x) != 2 {
+			return nil, fmt.Errorf("%v: entry %v must be a token and a host", path, i+1)
+		}
+		ret[x[0]] = x[1]
+	}
+	return ret, nil
+}
+
+func main() {
+	var (
+		listenAddr string
+		dataPath   string
+		retention  time.Duration
+		agentPath  string
+		agentCerts bool
+		queryPath  string
+		queryCerts string
+		introspect string
+		tlsOpts    scribe.TLSOptions
+		insecure   bool
+	)
+	flag.BoolVar(&agentCerts, "agent-certs", false, "accept agent client certificates, each may submit for the host named by the certificate (requires -tls-ca)")
+	flag.StringVar(&agentPath, "agent-tokens", "", "path to file of agent tokens and the host each may submit for (* for any)")
+	flag.StringVar(&dataPath, "data", "", "path to file submissions are stored in (default in memory only)")
+	flag.StringVar(&introspect, "introspect", "", "validate query bearer tokens with OAuth 2.0 introspection endpoint at HTTPS URL")
+	flag.BoolVar(&insecure, "insecure", false, "serve HTTP without TLS, for use behind a TLS terminating proxy")
+	flag.StringVar(&listenAddr, "listen", ":8443", "address to listen on")
+	flag.StringVar(&queryCerts, "query-certs", "", "comma separated names of client certificates accepted for queries (requires -tls-ca)")
+	flag.StringVar(&queryPath, "query-tokens", "", "path to file of tokens accepted for queries, each optionally followed by a name")
+	flag.DurationVar(&retention, "retention", 30*24*time.Hour, "discard submissions older than retention (0 to keep all)")
+	flag.StringVar(&tlsOpts.CAFile, "tls-ca", "", "path to PEM CA certificates clients must present a certificate signed by")
+	flag.StringVar(&tlsOpts.CertFile, "tls-cert", "", "path to TLS certificate")
+	flag.StringVar(&tlsOpts.KeyFile, "tls-key", "", "path to TLS private key")
+	flag.StringVar(&tlsOpts.MinVersion, "tls-min-version", "", "minimum TLS version (1.2 or 1.3, default 1.2)")
+	flag.Parse()
+
+	if (agentPath == "" && !agentCerts) || (queryPath == "" && queryCerts == "" && introspect == "") {
+		fmt.Fprintf(os.Stderr, "error: one of -agent-tokens or -agent-certs and one of -query-tokens, -query-certs or -introspect must be specified\n")
+		os.Exit(1)
+	}
+	if (agentCerts || queryCerts != "") && tlsOpts.CAFile == "" {
+		fmt.Fprintf(os.Stderr, "error: -agent-certs and -query-certs require -tls-ca\n")
+		os.Exit(1)
+	}
+	if !insecure && (tlsOpts.CertFile == "" || tlsOpts.KeyFile == "") {
+		fmt.Fprintf(os.Stderr, "error: -tls-cert and -tls-key must be specified unless -insecure is used\n")
+		os.Exit(1)
+	}
+	if insecure && !tlsOpts.IsZero() {
+		fmt.Fprintf(os.Stderr, "error: TLS options can not be used with -insecure\n")
+		os.Exit(1)
+	}
+	// Agents are accepted with either of the configured credentials. The
+	// name of the identity authenticated by an agent token is the host it
+	// may submit results for.
+	var agentAuth []auth.Authenticator
+	if agentPath != "" {
+		tokens, err := loadAgentTokens(agentPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		agentAuth = append(agentAuth, auth.Tokens(tokens))
+	}
+	if agentCerts {
+		agentAuth = append(agentAuth, auth.ClientCert())
+	}
+	// Queries are accepted with any of the configured credentials.
+	var queryAuth []auth.Authenticator
+	if queryPath != "" {
+		tokens, err := auth.LoadTokens(queryPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		queryAuth = append(queryAuth, auth.Tokens(tokens))
+	}
+	if queryCerts != "" {
+		queryAuth = append(queryAuth, auth.ClientCert(strings.Split(queryCerts, ",")...))
+	}
+	if introspect != "" {
+		i := &auth.Introspector{
+			URL:          introspect,
+			ClientID:     os.Getenv("SCRIBE_INTROSPECT_CLIENT_ID"),
+			ClientSecret: os.Getenv("SCRIBE_INTROSPECT_CLIENT_SECRET"),
+		}
+		queryAuth = append(queryAuth, auth.Validator(i.Validate))
+	}
+	store, err := collector.OpenStore(dataPath, retention)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+
+	srv := &collector.Server{Store: store, AgentAuth: auth.Any(agentAuth...), QueryAuth: auth.Any(queryAuth...)}
+	hs := &http.Server{Addr: listenAddr, Handler: srv.Handler(), ReadHeaderTimeout: 30 * time.Second}
+	if insecure {
+		err = hs.ListenAndServe()
+	} else {
+		hs.TLSConfig, err = tlsOpts.ServerConfig()
+		if err == nil {
+			err = hs.ListenAndServeTLS("", "")
+		}
+	}
+	fmt.Fprintf(os.Stderr, "error: %v\n", err)
+	os.Exit(1)
+}
@@ -0,0 +1,112 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"fmt"
+
+	"github.com/mozilla/scribe/internal/starlark"
+)
+
+// ScriptTest is used to evaluate criteria using a short script, for logic
+// the other evaluators can not express. The script is written in a subset
+// of Starlark, and must define a function check(criteria). The function is
+// called once with a list of all criteria returned by the object, each
+// having the fields identifier and value, and returns either a bool or a
+// tuple of a bool and a message explaining the result. For example:
+//
+//	def check(criteria):
+//	    ports = [int(c.value) for c in criteria]
+//	    bad = [p for p in ports if p < 1024 and p not in (22, 443)]
+//	    if bad:
+//	        return False, "unexpected privileged ports %s" % bad
+//	    return True
+//
+// The return value is the master result of the test, and the result of
+// each criteria. The message is included in the results of the test.
+//
+// Scripts can not access the system, can not define recursive functions
+// and are limited in the number of steps they execute; a script exceeding
+// the limit results in an error for the test.
+type ScriptTest struct {
+	Source string `json:"source,omitempty" yaml:"source,omitempty"`
+
+	prog    *starlark.Program
+	message string // The message returned by the last evaluation.
+}
+
+func (s *ScriptTest) validate() error {
+	prog, err := starlark.Parse(s.Source)
+	if err != nil {
+		return fmt.Errorf("script: %v", err)
+	}
+	n, found := prog.Params("check")
+	if !found {
+		return fmt.Errorf("script: check function is not defined")
+	}
+	if n != 1 {
+		return fmt.Errorf("script: check must take one argument")
+	}
+	s.prog = prog
+	return nil
+}
+
+func (s *ScriptTest) evaluate(c evaluationCriteria) (ret evaluationResult, err error) {
+	res, _, err := s.evaluateSet([]evaluationCriteria{c})
+	if err != nil {
+		return
+	}
+	return res[0], nil
+}
+
+func (s *ScriptTest) evaluateSet(c []evaluationCriteria) (ret []evaluationResult, result bool, err error) {
+	// A fault in the interpreter fails the test rather than the process
+	// evaluating it.
+	defer func() {
+		if r := recover(); r != nil {
+			ret, result, err = nil, false, fmt.Errorf("script: %v", r)
+		}
+	}()
+	return s.run(c)
+}
+
+// Run the script, returning the results of the criteria.
+func (s *ScriptTest) run(c []evaluationCriteria) ([]evaluationResult, bool, error) {
+	if s.prog == nil {
+		err := s.validate()
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	s.message = ""
+	arg := make([]starlark.Value, 0, len(c))
+	for _, x := range c {
+		arg = append(arg, starlark.Struct("criteria", map[string]starlark.Value{
+			"identifier": x.identifier,
+			"value":      x.testValue,
+		}))
+	}
+	v, steps, err := s.prog.Call("check", starlark.List(arg))
+	if err != nil {
+		return nil, false, fmt.Errorf("script: %v", err)
+	}
+	result, ok := v.(bool)
+	if t, isTuple := v.(starlark.Tuple); isTuple && len(t) == 2 {
+		result, ok = t[0].(bool)
+		s.message = starlark.Str(t[1])
+	}
+	if !ok {
+		return nil, false, fmt.Errorf("script: check returned %v, must return a bool or a tuple of a bool and a message", starlark.Type(v))
+	}
+	debugPrint("evaluateSet(): script returned %v \"%v\" after %v steps\n", result, s.message, steps)
+	ret := make([]evaluationResult, 0, len(c))
+	for _, x := range c {
+		ret = append(ret, evaluationResult{criteria: x, result: result})
+	}
+	return ret, result, nil
+}
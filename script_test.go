@@ -0,0 +1,226 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mozilla/scribe"
+)
+
+// Used in TestScriptEvaluator
+var scriptDoc = `
+objects:
+- object: ports
+  raw:
+    identifiers:
+    - identifier: sshd
+      value: "22"
+    - identifier: httpd
+      value: "443"
+    - identifier: telnetd
+      value: "23"
+    - identifier: app
+      value: "8080"
+tests:
+- test: script0
+  expectedresult: false
+  object: ports
+  script:
+    source: |
+      ALLOWED = (22, 443)
+
+      def check(criteria):
+          ports = {c.identifier: int(c.value) for c in criteria}
+          bad = sorted([k for k, v in ports.items() if v < 1024 and v not in ALLOWED])
+          if bad:
+              return False, "unexpected privileged ports: %s" % ", ".join(bad)
+          return True
+- test: script1
+  expectedresult: true
+  object: ports
+  script:
+    source: |
+      def check(criteria):
+          total = 0
+          for c in criteria:
+              if not c.value.isdigit():
+                  fail("not a port", c.value)
+              total += int(c.value)
+          return total == 22 + 443 + 23 + 8080, "total %d" % total
+- test: script2
+  expectedresult: true
+  object: ports
+  script:
+    source: |
+      def names(criteria):
+          return [c.identifier.upper() for c in criteria if c.identifier.endswith("d")]
+      def check(criteria):
+          n = names(criteria)
+          return len(n) == 3 and n[-1] == "TELNETD" and max([len(x) for x in n]) == 7
+- test: script3
+  expecterror: true
+  object: ports
+  script:
+    source: |
+      def check(criteria):
+          for i in range(1000000):
+              for j in range(1000000):
+                  pass
+          return True
+- test: script4
+  expecterror: true
+  object: ports
+  script:
+    source: |
+      def check(criteria):
+          if len(criteria) > 0:
+              return check(criteria[1:])
+          return True
+- test: script5
+  expecterror: true
+  object: ports
+  script:
+    source: |
+      def check(criteria):
+          return "yes"
+`
+
+func TestScriptEvaluator(t *testing.T) {
+	doc := genericTestExec(t, scriptDoc)
+
+	r, err := scribe.GetResults(doc, "script0")
+	if err != nil {
+		t.Fatalf("scribe.GetResults: %v", err)
+	}
+	if r.Message != "unexpected privileged ports: telnetd" || len(r.Results) != 4 || r.Results[0].Result {
+		t.Fatalf("unexpected results %+v", r)
+	}
+	r, err = scribe.GetResults(doc, "script1")
+	if err != nil {
+		t.Fatalf("scribe.GetResults: %v", err)
+	}
+	if r.Message != "total 8568" {
+		t.Fatalf("unexpected message %q", r.Message)
+	}
+	e, err := doc.ExplainTest("script0")
+	if err != nil {
+		t.Fatalf("Document.ExplainTest: %v", err)
+	}
+	if e.Evaluator != "script" || e.Criteria[0].Reason != "script returned false: unexpected privileged ports: telnetd" {
+		t.Fatalf("unexpected explanation %+v", e)
+	}
+	for id, want := range map[string]string{
+		"script3": "execution steps",
+		"script4": "called recursively",
+		"script5": "check returned string",
+	} {
+		r, err = scribe.GetResults(doc, id)
+		if err != nil {
+			t.Fatalf("scribe.GetResults: %v", err)
+		}
+		if !strings.Contains(r.Error, want) {
+			t.Fatalf("%v: unexpected error %q", id, r.Error)
+		}
+	}
+
+	// Scripts with syntax errors, or without a check function, cause the
+	// document to fail to load.
+	for _, x := range []struct {
+		src  string
+		want string
+	}{
+		{"def check(criteria):\n    return (True\n", "line 3"},
+		{"def check(criteria):\n    while True:\n        pass\n", "while is not supported"},
+		{"def verify(criteria):\n    return True\n", "check function is not defined"},
+	} {
+		bad := "objects:\n- object: ports\n  raw:\n    identifiers:\n    - identifier: sshd\n      value: \"22\"\n" +
+			"tests:\n- test: bad\n  object: ports\n  script:\n    source: |\n      " +
+			strings.Replace(x.src, "\n", "\n      ", -1)
+		_, err = scribe.LoadDocument(strings.NewReader(bad))
+		if err == nil || !strings.Contains(err.Error(), x.want) {
+			t.Fatalf("script %q: unexpected error %v", x.src, err)
+		}
+	}
+}
+
+// Evaluate a test using script src, against a single criteria with
+// identifier sshd and value 22.
+func scriptResult(t *testing.T, src string) scribe.TestResult {
+	docstr := "objects:\n- object: ports\n  raw:\n    identifiers:\n    - identifier: sshd\n      value: \"22\"\n" +
+		"tests:\n- test: script\n  object: ports\n  script:\n    source: |\n      " +
+		strings.Replace(src, "\n", "\n      ", -1)
+	doc, err := scribe.LoadDocument(strings.NewReader(docstr))
+	if err != nil {
+		t.Fatalf("scribe.LoadDocument: %v", err)
+	}
+	err = scribe.AnalyzeDocument(doc)
+	if err != nil {
+		t.Fatalf("scribe.AnalyzeDocument: %v", err)
+	}
+	r, err := scribe.GetResults(&doc, "script")
+	if err != nil {
+		t.Fatalf("scribe.GetResults: %v", err)
+	}
+	return r
+}
+
+func TestScriptOperators(t *testing.T) {
+	scribe.Bootstrap()
+	for _, x := range []struct {
+		expr string
+		want string
+	}{
+		{"7 // 2, -7 // 2, 7 % -2, -7 % 2", "(3, -4, -1, 1)"},
+		{"2 + 3 * 4 - 1", "13"},
+		{`"ab" * 3, 2 * "ab", "ab" * -1, "" * 4611686018427387904`, `("ababab", "abab", "", "")`},
+		{"[1] * 3, (1, 2) + (3,), [1] + [2], [] * 4611686018427387904", "([1, 1, 1], (1, 2, 3), [1, 2], [])"},
+		{`"a" < "b", [1, 2] == [1, 2], 3 >= 4, 1 != 1`, "(True, True, False, False)"},
+		{`"ss" in "sshd", 2 in [1, 2], "x" not in {"x": 1}`, "(True, True, False)"},
+		{"1 < 2 and 3 or 4, 0 or [] or 5, not 0", "(3, 5, True)"},
+		{`"%s=%d" % ("port", 22), "%r" % "a"`, `("port=22", "\"a\"")`},
+		{`",".join(["a", "b"]), "a-b".replace("-", "+"), " x ".strip()`, `("a,b", "a+b", "x")`},
+		{"[x * 2 for x in range(4) if x % 2], {k: v for k, v in [(1, 2)]}", "([2, 6], {1: 2})"},
+		{`criteria[0].identifier, int(criteria[0].value) + 1`, `("sshd", 23)`},
+	} {
+		r := scriptResult(t, "def check(criteria):\n    return True, repr(("+x.expr+"))\n")
+		if r.IsError || r.Message != x.want {
+			t.Fatalf("%v: got %q, error %q, expected %q", x.expr, r.Message, r.Error, x.want)
+		}
+	}
+}
+
+func TestScriptErrors(t *testing.T) {
+	scribe.Bootstrap()
+	for _, x := range []struct {
+		body string
+		want string
+	}{
+		{`return "ab" * 4611686018427387904`, "string repetition is too large"},
+		{`return [1, 2] * 4611686018427387904`, "repetition is too large"},
+		{`return (1,) * 2097152`, "repetition is too large"},
+		{"s = \"x\" * 1048576\n    return s + s", "string concatenation is too large"},
+		{"l = [1] * 1048576\n    return l + l", "concatenation is too large"},
+		{"s = \"x\" * 1048576\n    return \"\".join([s, s])", "string is too large"},
+		{"s = \"x\" * 524288\n    return s.replace(\"x\", \"xxx\")", "string is too large"},
+		{"return 1 // 0", "division by zero"},
+		{"return 1 / 2", "floating point division is not supported"},
+		{"return 1 + \"a\"", "unsupported operation"},
+		{"return [1][5]", "out of range"},
+		{"return {}[\"a\"]", "key"},
+		{"return undefined", "undefined"},
+		{"fail(\"broken\")", "broken"},
+		{"return int(\"x\")", "int"},
+	} {
+		r := scriptResult(t, "def check(criteria):\n    "+x.body+"\n")
+		if !r.IsError || !strings.Contains(r.Error, x.want) {
+			t.Fatalf("%q: expected error containing %q, got %q", x.body, x.want, r.Error)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SecretProvider returns the value of the secret identified by key. The
+// meaning of key depends on the provider.
+type SecretProvider func(key string) (string, error)
+
+// Secret describes a credential used by sources such as database and ldap,
+// so credentials are never included in the document itself. Secrets are
+// defined by the operator running scribe using SetSecrets() or the secrets
+// of a run configuration, not by documents, as obtaining a secret can read
+// files or run commands; sources in documents refer to the secret by Name.
+//
+// Provider is the name of the provider used to obtain the secret, and Key
+// identifies the secret to the provider. The built-in providers are:
+//
+// env: Key is the name of an environment variable containing the secret
+//
+// file: Key is the path to a file containing the secret, trailing new lines
+// are removed
+//
+// exec: Key is a command (split on white space, without shell processing)
+// that writes the secret to standard output, trailing new lines are removed
+//
+// Other providers, for example to fetch secrets from a vault service, can
+// be installed using RegisterSecretProvider().
+type Secret struct {
+	Name     string `json:"name" yaml:"name"`
+	Provider string `json:"provider" yaml:"provider"`
+	Key      string `json:"key" yaml:"key"`
+}
+
+// The maximum time a command run by the exec provider can run for.
+const secretExecTimeout = 30 * time.Second
+
+var builtinSecretProviders = map[string]SecretProvider{
+	"env":  envSecret,
+	"file": fileSecret,
+	"exec": execSecret,
+}
+
+// RegisterSecretProvider installs a secret provider that can be referenced
+// by name in the secrets set with SetSecrets(), for example to obtain credentials
+// from a key management service. Registering a provider with the name of an
+// existing provider replaces it. Passing a nil provider removes it.
+func RegisterSecretProvider(name string, p SecretProvider) {
+	sRuntime.secretLock.Lock()
+	defer sRuntime.secretLock.Unlock()
+	if p == nil {
+		delete(sRuntime.secretProviders, name)
+		return
+	}
+	if sRuntime.secretProviders == nil {
+		sRuntime.secretProviders = make(map[string]SecretProvider)
+	}
+	sRuntime.secretProviders[name] = p
+}
+
+func getSecretProvider(name string) (SecretProvider, bool) {
+	sRuntime.secretLock.Lock()
+	p, ok := sRuntime.secretProviders[name]
+	sRuntime.secretLock.Unlock()
+	if ok {
+		return p, true
+	}
+	p, ok = builtinSecretProviders[name]
+	return p, ok
+}
+
+// SetSecrets sets the secrets sources in documents can refer to, replacing
+// any set previously. Passing nil removes all secrets. Secrets are obtained
+// when the objects using them are evaluated.
+func SetSecrets(secrets []Secret) error {
+	m := make(map[string]Secret)
+	for _, x := range secrets {
+		err := x.validate()
+		if err != nil {
+			return err
+		}
+		if _, ok := m[x.Name]; ok {
+			return fmt.Errorf("secret %v: name is not unique", x.Name)
+		}
+		m[x.Name] = x
+	}
+	sRuntime.secretLock.Lock()
+	sRuntime.secrets = m
+	sRuntime.secretLock.Unlock()
+	return nil
+}
+
+// Return the names of the secrets set with SetSecrets(), sorted by name.
+func secretNames() []string {
+	ret := make([]string, 0)
+	sRuntime.secretLock.Lock()
+	for k := range sRuntime.secrets {
+		ret = append(ret, k)
+	}
+	sRuntime.secretLock.Unlock()
+	sort.Strings(ret)
+	return ret
+}
+
+func (s *Secret) validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("a secret has no name")
+	}
+	if s.Key == "" {
+		return fmt.Errorf("secret %v: key must be set", s.Name)
+	}
+	if _, ok := getSecretProvider(s.Provider); !ok {
+		return fmt.Errorf("secret %v: unknown provider \"%v\"", s.Name, s.Provider)
+	}
+	return nil
+}
+
+// Obtain the value of the secret from the provider.
+func (s *Secret) value() (string, error) {
+	p, ok := getSecretProvider(s.Provider)
+	if !ok {
+		return "", fmt.Errorf("secret %v: unknown provider \"%v\"", s.Name, s.Provider)
+	}
+	debugPrint("value(): obtaining secret %v using provider %v\n", s.Name, s.Provider)
+	v, err := p(s.Key)
+	if err != nil {
+		return "", fmt.Errorf("secret %v: %v", s.Name, err)
+	}
+	return v, nil
+}
+
+// Return the value of the secret named name set with SetSecrets().
+func secretValue(name string) (string, error) {
+	sRuntime.secretLock.Lock()
+	s, ok := sRuntime.secrets[name]
+	sRuntime.secretLock.Unlock()
+	if !ok {
+		return "", fmt.Errorf("unknown secret \"%v\"", name)
+	}
+	return s.value()
+}
+
+func envSecret(key string) (string, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return "", fmt.Errorf("%v is not set", key)
+	}
+	return v, nil
+}
+
+func fileSecret(key string) (string, error) {
+	buf, err := ioutil.ReadFile(key)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(buf), "\r\n"), nil
+}
+
+func execSecret(key string) (string, error) {
+	args := strings.Fields(key)
+	if len(args) == 0 {
+		return "", fmt.Errorf("no command")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), secretExecTimeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg != "" {
+			return "", fmt.Errorf("%v: %v", err, msg)
+		}
+		return "", err
+	}
+	return strings.TrimRight(stdout.String(), "\r\n"), nil
+}
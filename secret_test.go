@@ -0,0 +1,123 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mozilla/scribe"
+)
+
+// Each secret set in TestSecretProviders provides the DSN for the test
+// database driver registered in database_test.go, so an object is only
+// evaluated successfully if the secret was obtained.
+var secretPolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "file",
+		"database": { "driver": "scribetest", "dsnsecret": "file", "query": "SELECT 1" }
+	},
+	{
+		"object": "exec",
+		"database": { "driver": "scribetest", "dsnsecret": "exec", "query": "SELECT 1" }
+	},
+	{
+		"object": "vault",
+		"database": { "driver": "scribetest", "dsnsecret": "vault", "query": "SELECT 1" }
+	},
+	{
+		"object": "failing",
+		"database": { "driver": "scribetest", "dsnsecret": "failing", "query": "SELECT 1" }
+	}
+	],
+
+	"tests": [
+	{ "test": "file", "object": "file", "expectedresult": true },
+	{ "test": "exec", "object": "exec", "expectedresult": true },
+	{ "test": "vault", "object": "vault", "expectedresult": true },
+	{ "test": "failing", "object": "failing", "expecterror": true }
+	]
+}
+`
+
+func TestSecretProviders(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scribe-secret")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dsn")
+	err = ioutil.WriteFile(path, []byte("user=scribe\n"), 0600)
+	if err != nil {
+		t.Fatalf("ioutil.WriteFile: %v", err)
+	}
+	scribe.RegisterSecretProvider("testvault", func(key string) (string, error) {
+		if key != "db/scribe" {
+			return "", fmt.Errorf("unknown key %v", key)
+		}
+		return "user=scribe", nil
+	})
+	defer scribe.RegisterSecretProvider("testvault", nil)
+	err = scribe.SetSecrets([]scribe.Secret{
+		{Name: "file", Provider: "file", Key: path},
+		{Name: "exec", Provider: "exec", Key: "echo user=scribe"},
+		{Name: "vault", Provider: "testvault", Key: "db/scribe"},
+		{Name: "failing", Provider: "exec", Key: "false"},
+	})
+	if err != nil {
+		t.Fatalf("scribe.SetSecrets: %v", err)
+	}
+	defer scribe.SetSecrets(nil)
+	genericTestExec(t, secretPolicyDoc)
+}
+
+func TestSecretValidation(t *testing.T) {
+	for _, x := range [][]scribe.Secret{
+		// Unknown provider.
+		{{Name: "a", Provider: "nope", Key: "x"}},
+		// Duplicate name.
+		{{Name: "a", Provider: "env", Key: "x"}, {Name: "a", Provider: "env", Key: "y"}},
+		// No key.
+		{{Name: "a", Provider: "env"}},
+	} {
+		if scribe.SetSecrets(x) == nil {
+			t.Fatalf("secrets should not have been accepted: %+v", x)
+		}
+	}
+
+	// Bind DN without a password.
+	_, err := scribe.LoadDocument(strings.NewReader(`{"objects": [{"object": "o",
+		"ldap": {"url": "ldaps://localhost", "binddn": "cn=scribe"}}]}`))
+	if err == nil {
+		t.Fatalf("ldap object without passwordsecret should not have been accepted")
+	}
+
+	// Documents can not define secrets, and a reference to a secret that
+	// is not set fails when the object is evaluated.
+	scribe.SetStrictParsing(true)
+	_, err = scribe.LoadDocument(strings.NewReader(`{"secrets": [{"name": "a", "provider": "exec", "key": "id"}]}`))
+	scribe.SetStrictParsing(false)
+	if err == nil {
+		t.Fatalf("document defining secrets should not have been accepted")
+	}
+	doc, err := scribe.LoadDocument(strings.NewReader(`{"objects": [{"object": "o", "database": {"driver": "scribetest",
+		"dsnsecret": "missing", "query": "SELECT 1"}}]}`))
+	if err != nil {
+		t.Fatalf("scribe.LoadDocument: %v", err)
+	}
+	_, err = doc.EvaluateObject("o")
+	if err == nil || !strings.Contains(err.Error(), "unknown secret") {
+		t.Fatalf("EvaluateObject should have failed for unknown secret: %v", err)
+	}
+}
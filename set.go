@@ -0,0 +1,95 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"fmt"
+)
+
+// SetTest is used to compare the values of all criteria returned by an
+// object, treated as a set, against a list of expected values. Unlike other
+// evaluators where the test is true if any criteria matches, the result of
+// the test is the result of the set comparison.
+//
+// Operation can be one of:
+//
+// exact: the set of values is the same as Values
+//
+// subset: every value is in Values (true if the object returns no
+// criteria)
+//
+// superset: every entry in Values is present in the values
+//
+// The result for each individual criteria indicates if the value is in
+// Values.
+type SetTest struct {
+	Operation string   `json:"operation,omitempty" yaml:"operation,omitempty"`
+	Values    []string `json:"values,omitempty" yaml:"values,omitempty"`
+}
+
+// A setEvaluator evaluates all criteria for a test together, returning the
+// results for each criteria and the master result for the test.
+type setEvaluator interface {
+	evaluateSet([]evaluationCriteria) ([]evaluationResult, bool, error)
+}
+
+func (s *SetTest) validate() error {
+	switch s.Operation {
+	case "exact", "subset", "superset":
+	default:
+		return fmt.Errorf("set operation must be exact, subset or superset")
+	}
+	return nil
+}
+
+func (s *SetTest) evaluate(c evaluationCriteria) (ret evaluationResult, err error) {
+	ret.criteria = c
+	for _, x := range s.Values {
+		if c.testValue == x {
+			ret.result = true
+			break
+		}
+	}
+	return
+}
+
+func (s *SetTest) evaluateSet(c []evaluationCriteria) ([]evaluationResult, bool, error) {
+	debugPrint("evaluateSet(): set %v %v\n", s.Operation, s.Values)
+	err := s.validate()
+	if err != nil {
+		return nil, false, err
+	}
+	ret := make([]evaluationResult, 0, len(c))
+	found := make(map[string]bool)
+	allExpected := true
+	for _, x := range c {
+		res, err := s.evaluate(x)
+		if err != nil {
+			return nil, false, err
+		}
+		if !res.result {
+			allExpected = false
+		}
+		found[x.testValue] = true
+		ret = append(ret, res)
+	}
+	allFound := true
+	for _, x := range s.Values {
+		if !found[x] {
+			debugPrint("evaluateSet(): expected value \"%v\" not found\n", x)
+			allFound = false
+		}
+	}
+	switch s.Operation {
+	case "subset":
+		return ret, allExpected, nil
+	case "superset":
+		return ret, allFound, nil
+	}
+	return ret, allExpected && allFound, nil
+}
@@ -0,0 +1,96 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"testing"
+)
+
+// Used in TestSetPolicy
+var setPolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "bash-users",
+		"raw": {
+			"identifiers": [
+			{ "identifier": "/etc/passwd", "value": "root" },
+			{ "identifier": "/etc/passwd", "value": "admin" },
+			{ "identifier": "/etc/passwd", "value": "root" }
+			]
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "set0",
+		"expectedresult": true,
+		"object": "bash-users",
+		"set": {
+			"operation": "exact",
+			"values": [ "admin", "root" ]
+		}
+	},
+
+	{
+		"test": "set1",
+		"expectedresult": false,
+		"object": "bash-users",
+		"set": {
+			"operation": "exact",
+			"values": [ "root" ]
+		}
+	},
+
+	{
+		"test": "set2",
+		"expectedresult": true,
+		"object": "bash-users",
+		"set": {
+			"operation": "subset",
+			"values": [ "root", "admin", "deploy" ]
+		}
+	},
+
+	{
+		"test": "set3",
+		"expectedresult": false,
+		"object": "bash-users",
+		"set": {
+			"operation": "exact",
+			"values": [ "root", "admin", "deploy" ]
+		}
+	},
+
+	{
+		"test": "set4",
+		"expectedresult": true,
+		"object": "bash-users",
+		"set": {
+			"operation": "superset",
+			"values": [ "root" ]
+		}
+	},
+
+	{
+		"test": "set5",
+		"expectedresult": false,
+		"object": "bash-users",
+		"set": {
+			"operation": "superset",
+			"values": [ "root", "ops" ]
+		}
+	}
+	]
+}
+`
+
+func TestSetPolicy(t *testing.T) {
+	genericTestExec(t, setPolicyDoc)
+}
@@ -0,0 +1,463 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"bufio"
+	"debug/elf"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SharedLib is used to perform tests against shared libraries that are
+// loaded by processes running on the system.
+//
+// Library is a regular expression that is matched against the base name of
+// each shared object mapped into a process. If the expression contains a
+// sub-group, the value of the first sub-group is used as the test value
+// (for example a version string from the library name), otherwise the full
+// path to the library is used. The identifier for each match is the process
+// ID and process name.
+//
+// If Process is set, only processes whose name matches this regular
+// expression are inspected.
+//
+// If Binaries is set, the process table is not used and instead the
+// dynamic section of each listed binary is read to determine which
+// libraries it would load. Libraries are located using the run path of the
+// object needing them, the directories listed in /etc/ld.so.conf and the
+// default library directories, as the dynamic linker would, and the
+// libraries they need are included as well. The binaries are not run. In
+// this case the identifier is the path to the binary.
+//
+// If Deleted is set, only libraries whose mapped file has been deleted from
+// disk are returned. This can be used to identify processes that are still
+// using a vulnerable version of a library after the package has been
+// upgraded but the process has not been restarted. Libraries found using
+// Binaries are never deleted.
+type SharedLib struct {
+	Library  string   `json:"library,omitempty" yaml:"library,omitempty"`
+	Process  string   `json:"process,omitempty" yaml:"process,omitempty"`
+	Binaries []string `json:"binaries,omitempty" yaml:"binaries,omitempty"`
+	Deleted  bool     `json:"deleted,omitempty" yaml:"deleted,omitempty"`
+
+	matches []sharedLibMatch
+}
+
+type sharedLibMatch struct {
+	identifier string
+	match      string
+}
+
+// A shared object mapped into a process, or loaded by a binary.
+type mappedLib struct {
+	path    string
+	deleted bool // True if the mapped file has been deleted from disk.
+}
+
+type libConsumer struct {
+	identifier string
+	pid        int
+	name       string
+	libs       []mappedLib
+}
+
+func (s *SharedLib) isChain() bool {
+	return false
+}
+
+func (s *SharedLib) fireChains(d *Document) ([]evaluationCriteria, error) {
+	return nil, nil
+}
+
+func (s *SharedLib) mergeCriteria(c []evaluationCriteria) {
+}
+
+func (s *SharedLib) validate(d *Document) error {
+	if len(s.Library) == 0 {
+		return fmt.Errorf("sharedlib library must be set")
+	}
+	_, err := regexp.Compile(s.Library)
+	if err != nil {
+		return err
+	}
+	if len(s.Process) > 0 {
+		_, err = regexp.Compile(s.Process)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SharedLib) expandVariables(v []Variable) {
+	s.Library = variableExpansion(v, s.Library)
+	s.Process = variableExpansion(v, s.Process)
+	for i := range s.Binaries {
+		s.Binaries[i] = variableExpansion(v, s.Binaries[i])
+	}
+}
+
+func (s *SharedLib) getCriteria() (ret []evaluationCriteria) {
+	for _, x := range s.matches {
+		n := evaluationCriteria{}
+		n.identifier = x.identifier
+		n.testValue = x.match
+		ret = append(ret, n)
+	}
+	return ret
+}
+
+func (s *SharedLib) prepare() error {
+	var (
+		consumers []libConsumer
+		err       error
+		procre    *regexp.Regexp
+	)
+	debugPrint("prepare(): analyzing shared libraries, library \"%v\"\n", s.Library)
+
+	re, err := regexp.Compile(s.Library)
+	if err != nil {
+		return err
+	}
+	if len(s.Process) > 0 {
+		procre, err = regexp.Compile(s.Process)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(s.Binaries) > 0 {
+		consumers, err = elfGetConsumers(s.Binaries)
+	} else {
+		consumers, err = getLibConsumers()
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, x := range consumers {
+		if procre != nil && !procre.MatchString(x.name) {
+			continue
+		}
+		for _, y := range x.libs {
+			if s.Deleted && !y.deleted {
+				continue
+			}
+			_, libname := path.Split(y.path)
+			mtch := re.FindStringSubmatch(libname)
+			if len(mtch) == 0 {
+				continue
+			}
+			nm := sharedLibMatch{}
+			nm.identifier = x.identifier
+			if len(mtch) > 1 {
+				nm.match = mtch[1]
+			} else {
+				nm.match = y.path
+			}
+			debugPrint("prepare(): %v uses %v\n", nm.identifier, y.path)
+			s.matches = append(s.matches, nm)
+		}
+	}
+	return nil
+}
+
+// Return the shared libraries loaded by each process running on the
+// system.
+func getLibConsumers() ([]libConsumer, error) {
+	if sRuntime.testHooks {
+		return testGetLibConsumers(), nil
+	}
+	return procGetLibConsumers()
+}
+
+func procGetLibConsumers() ([]libConsumer, error) {
+	ret := make([]libConsumer, 0)
+	dirents, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	for _, x := range dirents {
+		pid, err := strconv.Atoi(x.Name())
+		if err != nil || !x.IsDir() {
+			continue
+		}
+		libs, err := procMappedLibs(pid)
+		// Processes may exit while we are scanning, or we may not
+		// have access to inspect them; just ignore these.
+		if err != nil {
+			continue
+		}
+		nc := libConsumer{pid: pid, libs: libs}
+		buf, err := ioutil.ReadFile(filepath.Join("/proc", x.Name(), "comm"))
+		if err == nil {
+			nc.name = strings.TrimSpace(string(buf))
+		}
+		nc.identifier = fmt.Sprintf("%v:%v", pid, nc.name)
+		ret = append(ret, nc)
+	}
+	return ret, nil
+}
+
+func procMappedLibs(pid int) ([]mappedLib, error) {
+	fd, err := os.Open(filepath.Join("/proc", strconv.Itoa(pid), "maps"))
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	ret := make([]mappedLib, 0)
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		s := strings.Fields(scanner.Text())
+		if len(s) < 6 {
+			continue
+		}
+		nl := mappedLib{path: strings.Join(s[5:], " ")}
+		if strings.HasSuffix(nl.path, " (deleted)") {
+			nl.path = strings.TrimSuffix(nl.path, " (deleted)")
+			nl.deleted = true
+		}
+		if !strings.HasPrefix(nl.path, "/") || !isSharedObject(nl.path) {
+			continue
+		}
+		if seen[nl.path] {
+			continue
+		}
+		seen[nl.path] = true
+		ret = append(ret, nl)
+	}
+	return ret, scanner.Err()
+}
+
+func isSharedObject(p string) bool {
+	_, fname := path.Split(p)
+	if strings.HasSuffix(fname, ".so") || strings.Contains(fname, ".so.") {
+		return true
+	}
+	return false
+}
+
+// The maximum number of libraries resolved for a binary, including the
+// libraries needed by other libraries.
+const maxNeededLibs = 1024
+
+// Default directories searched for libraries after those in ld.so.conf.
+var defaultLibDirs = []string{"/lib64", "/usr/lib64", "/lib", "/usr/lib"}
+
+// Determine the shared libraries each binary would load.
+func elfGetConsumers(binaries []string) ([]libConsumer, error) {
+	ret := make([]libConsumer, 0)
+	var sysdirs []string
+	for _, x := range binaries {
+		nc := libConsumer{identifier: x}
+		_, nc.name = path.Split(x)
+		if sRuntime.testHooks {
+			nc.libs = testNeededLibs()
+			ret = append(ret, nc)
+			continue
+		}
+		if sysdirs == nil {
+			sysdirs = append(ldSoConfDirs("/etc/ld.so.conf", 0), defaultLibDirs...)
+		}
+		libs, err := elfNeededLibs(x, sysdirs)
+		if err != nil {
+			debugPrint("elfGetConsumers(): reading %v failed: %v\n", x, err)
+			continue
+		}
+		nc.libs = libs
+		ret = append(ret, nc)
+	}
+	return ret, nil
+}
+
+// Return the libraries the ELF binary at p needs, and the libraries needed
+// by those, in the order found. Each library is searched for in the run
+// path of the object needing it, then in sysdirs; candidates of a different
+// class or machine than the binary are skipped. Libraries that can not be
+// found are omitted.
+func elfNeededLibs(p string, sysdirs []string) ([]mappedLib, error) {
+	f, err := elf.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	class, machine := f.Class, f.Machine
+	ret := make([]mappedLib, 0)
+	seen := make(map[string]bool)
+	queue := []string{p}
+	for len(queue) > 0 {
+		obj := queue[0]
+		queue = queue[1:]
+		if f == nil {
+			f, err = elf.Open(obj)
+			if err != nil {
+				debugPrint("elfNeededLibs(): %v: %v\n", obj, err)
+				continue
+			}
+		}
+		needed, _ := f.ImportedLibraries()
+		dirs := elfRunPath(f, filepath.Dir(obj))
+		f.Close()
+		f = nil
+		dirs = append(dirs, sysdirs...)
+		for _, name := range needed {
+			lib := findLibrary(name, dirs, class, machine)
+			if lib == "" || seen[lib] {
+				continue
+			}
+			if len(ret) == maxNeededLibs {
+				return nil, fmt.Errorf("%v needs more than %v libraries", p, maxNeededLibs)
+			}
+			seen[lib] = true
+			ret = append(ret, mappedLib{path: lib})
+			queue = append(queue, lib)
+		}
+	}
+	return ret, nil
+}
+
+// Return the directories in the run path of f, DT_RUNPATH or if not set
+// DT_RPATH, replacing $ORIGIN with origin, the directory containing the
+// object.
+func elfRunPath(f *elf.File, origin string) []string {
+	ret := make([]string, 0)
+	rp, _ := f.DynString(elf.DT_RUNPATH)
+	if len(rp) == 0 {
+		rp, _ = f.DynString(elf.DT_RPATH)
+	}
+	for _, x := range rp {
+		for _, d := range strings.Split(x, ":") {
+			d = strings.Replace(d, "${ORIGIN}", origin, -1)
+			d = strings.Replace(d, "$ORIGIN", origin, -1)
+			if d != "" {
+				ret = append(ret, d)
+			}
+		}
+	}
+	return ret
+}
+
+// Return the path to the library name, searching dirs unless name contains
+// a slash, or an empty string if it is not found.
+func findLibrary(name string, dirs []string, class elf.Class, machine elf.Machine) string {
+	candidates := []string{name}
+	if !strings.Contains(name, "/") {
+		candidates = candidates[:0]
+		for _, d := range dirs {
+			candidates = append(candidates, filepath.Join(d, name))
+		}
+	}
+	for _, x := range candidates {
+		if !strings.HasPrefix(x, "/") {
+			continue
+		}
+		f, err := elf.Open(x)
+		if err != nil {
+			continue
+		}
+		ok := f.Class == class && f.Machine == machine
+		f.Close()
+		if ok {
+			return x
+		}
+	}
+	return ""
+}
+
+// Return the library directories listed in the ld.so.conf file p,
+// following include directives. depth limits the nesting of includes.
+func ldSoConfDirs(p string, depth int) []string {
+	ret := make([]string, 0)
+	if depth > 8 {
+		return ret
+	}
+	fd, err := os.Open(p)
+	if err != nil {
+		return ret
+	}
+	defer fd.Close()
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i != -1 {
+			line = line[:i]
+		}
+		s := strings.Fields(line)
+		if len(s) == 0 {
+			continue
+		}
+		if s[0] != "include" {
+			ret = append(ret, s[0])
+			continue
+		}
+		for _, pat := range s[1:] {
+			if !filepath.IsAbs(pat) {
+				pat = filepath.Join(filepath.Dir(p), pat)
+			}
+			matches, _ := filepath.Glob(pat)
+			for _, m := range matches {
+				ret = append(ret, ldSoConfDirs(m, depth+1)...)
+			}
+		}
+	}
+	return ret
+}
+
+// Functions and data related to shared library tests
+
+var testLibTable = []struct {
+	pid     int
+	name    string
+	lib     string
+	deleted bool
+}{
+	{1, "init", "/lib/x86_64-linux-gnu/libc-2.19.so", false},
+	{100, "sshd", "/lib/x86_64-linux-gnu/libc-2.19.so", false},
+	{100, "sshd", "/lib/x86_64-linux-gnu/libcrypto.so.1.0.0", true},
+	{200, "nginx", "/lib/x86_64-linux-gnu/libssl.so.1.0.2", false},
+}
+
+func testGetLibConsumers() []libConsumer {
+	ret := make([]libConsumer, 0)
+	for _, x := range testLibTable {
+		found := false
+		for i := range ret {
+			if ret[i].pid == x.pid {
+				ret[i].libs = append(ret[i].libs, mappedLib{path: x.lib, deleted: x.deleted})
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+		nc := libConsumer{pid: x.pid, name: x.name}
+		nc.identifier = fmt.Sprintf("%v:%v", x.pid, x.name)
+		nc.libs = append(nc.libs, mappedLib{path: x.lib, deleted: x.deleted})
+		ret = append(ret, nc)
+	}
+	return ret
+}
+
+func testNeededLibs() []mappedLib {
+	ret := make([]mappedLib, 0)
+	for _, x := range testLibTable {
+		if x.pid == 200 {
+			ret = append(ret, mappedLib{path: x.lib})
+		}
+	}
+	return ret
+}
@@ -0,0 +1,190 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"debug/elf"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mozilla/scribe"
+)
+
+// Used in TestSharedLibPolicy
+var sharedLibPolicyDoc = `
+{
+	"variables": [
+	{ "key": "daemon", "value": "sshd" }
+	],
+
+	"objects": [
+	{
+		"object": "libcrypto",
+		"sharedlib": {
+			"library": "^libcrypto\\.so\\.(\\S+)$"
+		}
+	},
+
+	{
+		"object": "libc-nginx",
+		"sharedlib": {
+			"library": "^libc-",
+			"process": "^nginx$"
+		}
+	},
+
+	{
+		"object": "deleted-libs",
+		"sharedlib": {
+			"library": "\\.so",
+			"process": "^${daemon}$",
+			"deleted": true
+		}
+	},
+
+	{
+		"object": "libssl-binary",
+		"sharedlib": {
+			"library": "^libssl\\.so\\.(\\S+)$",
+			"binaries": [ "/usr/sbin/nginx" ]
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "sharedlib0",
+		"expectedresult": true,
+		"object": "libcrypto",
+		"evr": {
+			"operation": "<",
+			"value": "1.0.1"
+		}
+	},
+
+	{
+		"test": "sharedlib1",
+		"expectedresult": false,
+		"object": "libc-nginx"
+	},
+
+	{
+		"test": "sharedlib-deleted",
+		"expectedresult": true,
+		"object": "deleted-libs",
+		"exactmatch": {
+			"value": "/lib/x86_64-linux-gnu/libcrypto.so.1.0.0"
+		}
+	},
+
+	{
+		"test": "sharedlib2",
+		"expectedresult": true,
+		"object": "libssl-binary",
+		"exactmatch": {
+			"value": "1.0.2"
+		}
+	}
+	]
+}
+`
+
+func TestSharedLibPolicy(t *testing.T) {
+	doc := genericTestExec(t, sharedLibPolicyDoc)
+	// Only the deleted library of the process is returned.
+	c, err := doc.EvaluateObject("deleted-libs")
+	if err != nil {
+		t.Fatalf("EvaluateObject: %v", err)
+	}
+	if len(c) != 1 || c[0].Identifier != "100:sshd" {
+		t.Fatalf("unexpected criteria %+v", c)
+	}
+}
+
+func TestSharedLibBinaries(t *testing.T) {
+	bin := "/bin/ls"
+	f, err := elf.Open(bin)
+	if err != nil {
+		t.Skipf("%v is not available: %v", bin, err)
+	}
+	needed, _ := f.ImportedLibraries()
+	f.Close()
+	libc := false
+	for _, x := range needed {
+		libc = libc || strings.HasPrefix(x, "libc.so")
+	}
+	if !libc {
+		t.Skipf("%v is not linked with libc", bin)
+	}
+	scribe.Bootstrap()
+	scribe.TestHooks(false)
+	defer scribe.TestHooks(true)
+	doc, err := scribe.LoadDocument(strings.NewReader(fmt.Sprintf(`{"objects": [{"object": "libc", `+
+		`"sharedlib": {"library": "^libc\\.so", "binaries": [%q]}}]}`, bin)))
+	if err != nil {
+		t.Fatalf("scribe.LoadDocument: %v", err)
+	}
+	c, err := doc.EvaluateObject("libc")
+	if err != nil {
+		t.Fatalf("EvaluateObject: %v", err)
+	}
+	if len(c) != 1 || c[0].Identifier != bin || !filepath.IsAbs(c[0].Value) {
+		t.Fatalf("unexpected criteria %+v", c)
+	}
+	if _, err := os.Stat(c[0].Value); err != nil {
+		t.Fatalf("library was not found: %v", err)
+	}
+}
+
+// Used in TestRestartPolicy
+var restartPolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "reboot",
+		"restart": {
+			"check": "reboot"
+		}
+	},
+
+	{
+		"object": "service",
+		"restart": {
+			"check": "service"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "restart0",
+		"expectedresult": true,
+		"object": "reboot",
+		"exactmatch": {
+			"value": "true"
+		}
+	},
+
+	{
+		"test": "restart1",
+		"expectedresult": true,
+		"object": "service",
+		"regexp": {
+			"value": "libcrypto"
+		}
+	}
+	]
+}
+`
+
+func TestRestartPolicy(t *testing.T) {
+	genericTestExec(t, restartPolicyDoc)
+}
@@ -0,0 +1,255 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+// Package siem writes scribe test results as syslog (RFC 5424) or CEF
+// messages, one message per test result, so results can be ingested by
+// SIEM pipelines without an intermediary parser.
+//
+// Messages can be written to any io.Writer, one message per line, or sent
+// to a syslog collector using Dial().
+package siem
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mozilla/scribe"
+)
+
+// The structured data ID used in RFC 5424 messages, using the example
+// private enterprise number reserved for documentation.
+const sdID = "scribe@32473"
+
+// Syslog severities used for test outcomes.
+const (
+	severityError   = 3
+	severityWarning = 4
+	severityInfo    = 6
+)
+
+// The syslog facility used for messages (user-level messages).
+const facilityUser = 1
+
+// Writer writes test results as syslog or CEF messages.
+type Writer struct {
+	w       io.Writer
+	format  string
+	stream  bool
+	Host    string // The host name included in messages, os.Hostname() by default.
+	AppName string // The application name included in syslog messages.
+}
+
+// NewWriter returns a Writer that writes messages to w. format is rfc5424
+// for syslog messages with the result in structured data, or cef for
+// Common Event Format messages.
+func NewWriter(w io.Writer, format string) (*Writer, error) {
+	switch format {
+	case "rfc5424", "cef":
+	default:
+		return nil, fmt.Errorf("format must be rfc5424 or cef")
+	}
+	host, _ := os.Hostname()
+	if host == "" {
+		host = "-"
+	}
+	return &Writer{w: w, format: format, Host: host, AppName: "scribe"}, nil
+}
+
+// Dial connects to the syslog collector at addr, in the form
+// udp://host:port or tcp://host:port, returning a connection that can be
+// passed to NewWriter(). Messages sent over TCP use octet counting framing
+// as described in RFC 6587.
+func Dial(addr string) (io.WriteCloser, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "udp" && u.Scheme != "tcp" {
+		return nil, fmt.Errorf("syslog address must use udp or tcp")
+	}
+	c, err := net.DialTimeout(u.Scheme, u.Host, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{Conn: c, framed: u.Scheme == "tcp"}, nil
+}
+
+// conn sends each message written to it as a single datagram, or as a
+// framed message for stream transports.
+type conn struct {
+	net.Conn
+	framed bool
+}
+
+func (c *conn) Write(b []byte) (int, error) {
+	msg := strings.TrimSuffix(string(b), "\n")
+	if c.framed {
+		msg = fmt.Sprintf("%d %s", len(msg), msg)
+	}
+	_, err := c.Conn.Write([]byte(msg))
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func outcome(tr scribe.TestResult, failed bool) (string, int) {
+	switch {
+	case tr.Waived:
+		return "waived", severityInfo
+	case tr.NotApplicable:
+		return "notapplicable", severityInfo
+	case tr.IsError:
+		return "error", severityError
+	case failed:
+		return "fail", severityWarning
+	}
+	return "pass", severityInfo
+}
+
+func falseIdentifiers(tr scribe.TestResult) []string {
+	ret := make([]string, 0)
+	for _, x := range tr.Results {
+		if !x.Result {
+			ret = append(ret, x.Identifier)
+		}
+	}
+	return ret
+}
+
+// Write writes a message for the test result, failed indicates if the test
+// is considered to have failed (for example if the result does not match
+// the expected result of the test).
+func (w *Writer) Write(tr scribe.TestResult, failed bool) error {
+	var msg string
+	if w.format == "cef" {
+		msg = w.cef(tr, failed)
+	} else {
+		msg = w.rfc5424(tr, failed)
+	}
+	_, err := fmt.Fprintf(w.w, "%v\n", msg)
+	return err
+}
+
+func (w *Writer) rfc5424(tr scribe.TestResult, failed bool) string {
+	out, sev := outcome(tr, failed)
+	params := [][2]string{
+		{"testid", tr.TestID},
+		{"outcome", out},
+		{"masterresult", fmt.Sprintf("%v", tr.MasterResult)},
+	}
+	if tr.TestName != "" {
+		params = append(params, [2]string{"name", tr.TestName})
+	}
+	if tr.Owner != "" {
+		params = append(params, [2]string{"owner", tr.Owner})
+	}
+	if tr.IsError {
+		params = append(params, [2]string{"error", tr.Error})
+	}
+	for _, x := range falseIdentifiers(tr) {
+		params = append(params, [2]string{"identifier", x})
+	}
+	for _, x := range tr.Tags {
+		params = append(params, [2]string{sdName("tag." + x.Key), x.Value})
+	}
+	for k, v := range tr.Metadata {
+		params = append(params, [2]string{sdName("meta." + k), v})
+	}
+	var sd strings.Builder
+	sd.WriteString("[" + sdID)
+	for _, x := range params {
+		fmt.Fprintf(&sd, " %v=\"%v\"", x[0], sdEscape(x[1]))
+	}
+	sd.WriteString("]")
+	return fmt.Sprintf("<%d>1 %v %v %v %d %v %v test %v %v",
+		facilityUser*8+sev, time.Now().UTC().Format(time.RFC3339Nano),
+		headerField(w.Host), headerField(w.AppName), os.Getpid(), "result",
+		sd.String(), tr.TestID, out)
+}
+
+// Header fields can not contain spaces, and are replaced with - if empty.
+func headerField(s string) string {
+	s = strings.Replace(s, " ", "_", -1)
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// Return a valid structured data parameter name, which is limited to 32
+// printable characters excluding =, space, ] and ".
+func sdName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, s)
+	if len(s) > 32 {
+		s = s[:32]
+	}
+	return s
+}
+
+func sdEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(s)
+}
+
+func (w *Writer) cef(tr scribe.TestResult, failed bool) string {
+	out, sev := outcome(tr, failed)
+	// CEF severity ranges from 0 to 10.
+	cefsev := map[int]int{severityInfo: 1, severityWarning: 7, severityError: 5}[sev]
+	name := tr.TestName
+	if name == "" {
+		name = tr.TestID
+	}
+	ext := [][2]string{
+		{"dvchost", w.Host},
+		{"outcome", out},
+		{"msg", fmt.Sprintf("test %v %v", tr.TestID, out)},
+	}
+	if ids := falseIdentifiers(tr); len(ids) > 0 {
+		ext = append(ext, [2]string{"cs1Label", "identifiers"}, [2]string{"cs1", strings.Join(ids, ",")})
+	}
+	if len(tr.Tags) > 0 {
+		tags := make([]string, 0)
+		for _, x := range tr.Tags {
+			tags = append(tags, x.Key+":"+x.Value)
+		}
+		ext = append(ext, [2]string{"cs2Label", "tags"}, [2]string{"cs2", strings.Join(tags, ",")})
+	}
+	if tr.Owner != "" {
+		ext = append(ext, [2]string{"cs3Label", "owner"}, [2]string{"cs3", tr.Owner})
+	}
+	if tr.IsError {
+		ext = append(ext, [2]string{"reason", tr.Error})
+	}
+	var e strings.Builder
+	for i, x := range ext {
+		if i > 0 {
+			e.WriteString(" ")
+		}
+		fmt.Fprintf(&e, "%v=%v", x[0], cefExtEscape(x[1]))
+	}
+	return fmt.Sprintf("CEF:0|Mozilla|scribe|%v|%v|%v|%d|%v",
+		cefHeaderEscape(scribe.Version), cefHeaderEscape(tr.TestID),
+		cefHeaderEscape(name), cefsev, e.String())
+}
+
+func cefHeaderEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ").Replace(s)
+}
+
+func cefExtEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`).Replace(s)
+}
@@ -0,0 +1,176 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package siem_test
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/mozilla/scribe"
+	"github.com/mozilla/scribe/siem"
+)
+
+var siemResults = []struct {
+	tr     scribe.TestResult
+	failed bool
+}{
+	{
+		tr: scribe.TestResult{
+			TestID:       "sshd-root",
+			TestName:     "sshd root login",
+			MasterResult: true,
+			Tags:         []scribe.TestTag{{Key: "severity", Value: "high"}},
+		},
+		failed: false,
+	},
+	{
+		tr: scribe.TestResult{
+			TestID:       "pkg|version",
+			TestName:     `openssl "version" ]`,
+			MasterResult: false,
+			Results: []scribe.TestSubResult{
+				{Result: false, Identifier: "openssl=1.0"},
+				{Result: true, Identifier: "libssl"},
+			},
+		},
+		failed: true,
+	},
+	{
+		tr: scribe.TestResult{
+			TestID:  "conf",
+			IsError: true,
+			Error:   "object not found",
+		},
+		failed: true,
+	},
+}
+
+func siemWrite(t *testing.T, format string) []string {
+	var buf bytes.Buffer
+	w, err := siem.NewWriter(&buf, format)
+	if err != nil {
+		t.Fatalf("siem.NewWriter: %v", err)
+	}
+	w.Host = "host1"
+	for _, x := range siemResults {
+		err = w.Write(x.tr, x.failed)
+		if err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+}
+
+func TestRFC5424(t *testing.T) {
+	lines := siemWrite(t, "rfc5424")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 messages, got %v", len(lines))
+	}
+	header := regexp.MustCompile(`^<(\d+)>1 \S+ host1 scribe \d+ result \[scribe@32473 `)
+	pri := []string{"14", "12", "11"}
+	for i, x := range lines {
+		m := header.FindStringSubmatch(x)
+		if m == nil {
+			t.Fatalf("invalid message: %v", x)
+		}
+		if m[1] != pri[i] {
+			t.Fatalf("message %v: expected priority %v, got %v", i, pri[i], m[1])
+		}
+	}
+	for _, x := range []string{`outcome="pass"`, `tag.severity="high"`} {
+		if !strings.Contains(lines[0], x) {
+			t.Fatalf("message 0 missing %v: %v", x, lines[0])
+		}
+	}
+	for _, x := range []string{`outcome="fail"`, `name="openssl \"version\" \]"`,
+		`identifier="openssl=1.0"`} {
+		if !strings.Contains(lines[1], x) {
+			t.Fatalf("message 1 missing %v: %v", x, lines[1])
+		}
+	}
+	if strings.Contains(lines[1], "libssl") {
+		t.Fatalf("message 1 contains true identifier: %v", lines[1])
+	}
+	if !strings.Contains(lines[2], `error="object not found"`) {
+		t.Fatalf("message 2 missing error: %v", lines[2])
+	}
+}
+
+func TestCEF(t *testing.T) {
+	lines := siemWrite(t, "cef")
+	expect := []string{
+		"CEF:0|Mozilla|scribe|" + scribe.Version + "|sshd-root|sshd root login|1|dvchost=host1 outcome=pass msg=test sshd-root pass cs2Label=tags cs2=severity:high",
+		"CEF:0|Mozilla|scribe|" + scribe.Version + `|pkg\|version|openssl "version" ]|7|dvchost=host1 outcome=fail msg=test pkg|version fail cs1Label=identifiers cs1=openssl\=1.0`,
+		"CEF:0|Mozilla|scribe|" + scribe.Version + "|conf|conf|5|dvchost=host1 outcome=error msg=test conf error reason=object not found",
+	}
+	if len(lines) != len(expect) {
+		t.Fatalf("expected %v messages, got %v", len(expect), len(lines))
+	}
+	for i := range expect {
+		if lines[i] != expect[i] {
+			t.Fatalf("message %v:\nexpected %v\ngot      %v", i, expect[i], lines[i])
+		}
+	}
+}
+
+func TestDialTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	defer l.Close()
+	recv := make(chan string)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			recv <- ""
+			return
+		}
+		defer c.Close()
+		r := bufio.NewReader(c)
+		var n int
+		for {
+			b, err := r.ReadByte()
+			if err != nil || b == ' ' {
+				break
+			}
+			n = n*10 + int(b-'0')
+		}
+		buf := make([]byte, n)
+		_, err = io.ReadFull(r, buf)
+		if err != nil {
+			recv <- ""
+			return
+		}
+		recv <- string(buf)
+	}()
+
+	conn, err := siem.Dial("tcp://" + l.Addr().String())
+	if err != nil {
+		t.Fatalf("siem.Dial: %v", err)
+	}
+	defer conn.Close()
+	w, err := siem.NewWriter(conn, "cef")
+	if err != nil {
+		t.Fatalf("siem.NewWriter: %v", err)
+	}
+	w.Host = "host1"
+	err = w.Write(siemResults[0].tr, siemResults[0].failed)
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	msg := <-recv
+	if !strings.HasPrefix(msg, "CEF:0|Mozilla|scribe|") || !strings.HasSuffix(msg, "cs2=severity:high") {
+		t.Fatalf("unexpected message received: %q", msg)
+	}
+}
@@ -0,0 +1,251 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Table describes an external data table that can be referenced by tests
+// in the document using a lookup evaluator. Tables allow data such as the
+// approved package versions for each release, or the ports that are
+// allowed to listen, to be maintained separately from the test logic and
+// shared by many tests.
+//
+// File is the path to the table, which is loaded when a test referencing
+// the table is evaluated. Format is csv or json, and if not set is
+// determined from the extension of the file. A CSV table has a header row
+// naming the columns. A JSON table is a list of objects, where the keys of
+// each object are the columns.
+type Table struct {
+	Name   string `json:"name" yaml:"name"`
+	File   string `json:"file" yaml:"file"`
+	Format string `json:"format,omitempty" yaml:"format,omitempty"`
+
+	rows []map[string]string
+}
+
+func (t *Table) validate() error {
+	if t.Name == "" {
+		return fmt.Errorf("a table in document has no name")
+	}
+	if t.File == "" {
+		return fmt.Errorf("table %v: file must be set", t.Name)
+	}
+	switch t.format() {
+	case "csv", "json":
+	default:
+		return fmt.Errorf("table %v: format must be csv or json", t.Name)
+	}
+	return nil
+}
+
+func (t *Table) format() string {
+	if t.Format != "" {
+		return t.Format
+	}
+	return strings.TrimPrefix(strings.ToLower(filepath.Ext(t.File)), ".")
+}
+
+// Load the rows of the table if they have not already been loaded.
+func (t *Table) load() error {
+	if t.rows != nil {
+		return nil
+	}
+	fd, err := os.Open(t.File)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	var rows []map[string]string
+	if t.format() == "csv" {
+		rows, err = loadCSVTable(fd)
+	} else {
+		rows, err = loadJSONTable(fd)
+	}
+	if err != nil {
+		return fmt.Errorf("table %v: %v", t.Name, err)
+	}
+	debugPrint("loaded %v row(s) for table %v from %v\n", len(rows), t.Name, t.File)
+	t.rows = rows
+	return nil
+}
+
+func loadCSVTable(r io.Reader) ([]map[string]string, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.TrimLeadingSpace = true
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]map[string]string, 0)
+	if len(records) == 0 {
+		return ret, nil
+	}
+	header := records[0]
+	for _, x := range records[1:] {
+		row := make(map[string]string)
+		for i, y := range x {
+			if i < len(header) {
+				row[header[i]] = y
+			}
+		}
+		ret = append(ret, row)
+	}
+	return ret, nil
+}
+
+func loadJSONTable(r io.Reader) ([]map[string]string, error) {
+	var records []map[string]interface{}
+	err := json.NewDecoder(r).Decode(&records)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]map[string]string, 0, len(records))
+	for _, x := range records {
+		row := make(map[string]string)
+		for k, v := range x {
+			switch y := v.(type) {
+			case string:
+				row[k] = y
+			case nil:
+			default:
+				// Numbers and booleans are compared using their
+				// JSON representation.
+				buf, _ := json.Marshal(y)
+				row[k] = string(buf)
+			}
+		}
+		ret = append(ret, row)
+	}
+	return ret, nil
+}
+
+// Return the table named name from the document.
+func (d *Document) getTable(name string) (*Table, error) {
+	for i := range d.Tables {
+		if d.Tables[i].Name == name {
+			return &d.Tables[i], nil
+		}
+	}
+	return nil, fmt.Errorf("unknown table \"%v\"", name)
+}
+
+// LookupTest compares criteria against a column of a Table included in the
+// document.
+//
+// Column names the column of the table the test value is compared with. If
+// KeyColumn is set, only rows where KeyColumn is equal to the identifier of
+// the criteria are used; for example with a package object, a table of
+// approved versions could have a package column used as the KeyColumn and
+// a version column used as the Column.
+//
+// Operation controls how the test value is compared with the values in
+// the column, and can be one of:
+//
+// exact: the value is equal to the column (the default)
+//
+// regexp: the value matches the column, which contains regular expressions
+//
+// <, > or =: the value is less than, greater than or equal to the column
+// using EVR version comparison
+//
+// A criteria is true if the comparison is true for any row.
+type LookupTest struct {
+	Table     string `json:"table,omitempty" yaml:"table,omitempty"`
+	Column    string `json:"column,omitempty" yaml:"column,omitempty"`
+	KeyColumn string `json:"keycolumn,omitempty" yaml:"keycolumn,omitempty"`
+	Operation string `json:"operation,omitempty" yaml:"operation,omitempty"`
+
+	table *Table
+	res   map[string]*regexp.Regexp
+}
+
+func (l *LookupTest) validate(d *Document) error {
+	if l.Column == "" {
+		return fmt.Errorf("lookup column must be set")
+	}
+	switch l.Operation {
+	case "", "exact", "regexp", "<", ">", "=":
+	default:
+		return fmt.Errorf("lookup operation must be exact, regexp, <, > or =")
+	}
+	_, err := d.getTable(l.Table)
+	return err
+}
+
+// Bind the evaluator to the table it references in the document, loading
+// the table if required.
+func (l *LookupTest) bind(d *Document) error {
+	t, err := d.getTable(l.Table)
+	if err != nil {
+		return err
+	}
+	err = t.load()
+	if err != nil {
+		return err
+	}
+	l.table = t
+	return nil
+}
+
+func (l *LookupTest) evaluate(c evaluationCriteria) (ret evaluationResult, err error) {
+	ret.criteria = c
+	if l.table == nil {
+		return ret, fmt.Errorf("lookup table %v not loaded", l.Table)
+	}
+	for _, row := range l.table.rows {
+		if l.KeyColumn != "" && row[l.KeyColumn] != c.identifier {
+			continue
+		}
+		v, ok := row[l.Column]
+		if !ok {
+			continue
+		}
+		match, err := l.compare(c.testValue, v)
+		if err != nil {
+			return ret, err
+		}
+		if match {
+			debugPrint("evaluate(): lookup %v matched %v against %v\n", l.Table, c.testValue, v)
+			ret.result = true
+			break
+		}
+	}
+	return ret, nil
+}
+
+func (l *LookupTest) compare(value string, column string) (bool, error) {
+	switch l.Operation {
+	case "regexp":
+		if l.res == nil {
+			l.res = make(map[string]*regexp.Regexp)
+		}
+		re, ok := l.res[column]
+		if !ok {
+			var err error
+			re, err = regexp.Compile(column)
+			if err != nil {
+				return false, err
+			}
+			l.res[column] = re
+		}
+		return re.MatchString(value), nil
+	case "<", ">", "=":
+		return evrCompare(evrLookupOperation(l.Operation), value, column)
+	}
+	return value == column, nil
+}
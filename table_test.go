@@ -0,0 +1,117 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mozilla/scribe"
+)
+
+// Used in TestLookupTables
+var lookupPolicyDoc = `
+{
+	"tables": [
+	{ "name": "versions", "file": "./test/tables/versions.csv" },
+	{ "name": "ports", "file": "./test/tables/ports.json" }
+	],
+
+	"objects": [
+	{
+		"object": "packages",
+		"raw": {
+			"identifiers": [
+			{ "identifier": "openssl", "value": "1.1.1w" },
+			{ "identifier": "bash", "value": "4.4" }
+			]
+		}
+	},
+
+	{
+		"object": "listening",
+		"raw": {
+			"identifiers": [
+			{ "identifier": "sshd", "value": "22" },
+			{ "identifier": "nginx", "value": "443" }
+			]
+		}
+	},
+
+	{
+		"object": "unapproved",
+		"raw": {
+			"identifiers": [
+			{ "identifier": "telnetd", "value": "23" }
+			]
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "outdated",
+		"object": "packages",
+		"expectedresult": true,
+		"lookup": {
+			"table": "versions",
+			"keycolumn": "package",
+			"column": "version",
+			"operation": "<"
+		}
+	},
+
+	{
+		"test": "ports-allowed",
+		"object": "listening",
+		"expectedresult": true,
+		"lookup": {
+			"table": "ports",
+			"column": "port"
+		}
+	},
+
+	{
+		"test": "ports-unapproved",
+		"object": "unapproved",
+		"expectedresult": false,
+		"lookup": {
+			"table": "ports",
+			"column": "port"
+		}
+	}
+	]
+}
+`
+
+func TestLookupTables(t *testing.T) {
+	doc := genericTestExec(t, lookupPolicyDoc)
+	tr, err := scribe.GetResults(doc, "outdated")
+	if err != nil {
+		t.Fatalf("scribe.GetResults: %v", err)
+	}
+	for _, x := range tr.Results {
+		if x.Result != (x.Identifier == "bash") {
+			t.Fatalf("unexpected result %v for %v", x.Result, x.Identifier)
+		}
+	}
+}
+
+func TestLookupInvalid(t *testing.T) {
+	for _, x := range []string{
+		`{"tests": [{"test": "t", "object": "o", "lookup": {"table": "missing", "column": "c"}}],
+		"objects": [{"object": "o", "raw": {"identifiers": [{"identifier": "a", "value": "b"}]}}]}`,
+		`{"tables": [{"name": "t", "file": "table.txt"}]}`,
+		`{"tables": [{"name": "t", "file": "a.csv"}, {"name": "t", "file": "b.csv"}]}`,
+	} {
+		_, err := scribe.LoadDocument(strings.NewReader(x))
+		if err == nil {
+			t.Fatalf("document should fail validation: %v", x)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// The size of the blocks read when scanning a file from the end.
+const reverseBlockSize = 64 * 1024
+
+// A line of a file being scanned for content.
+type scanLine struct {
+	text   string
+	line   int   // The line number, 0 if not known.
+	offset int64 // The byte offset of the start of the line.
+}
+
+// A function returning the next line to scan, or io.EOF once all lines
+// have been returned.
+type lineScanner func() (scanLine, error)
+
+// Return a scanner returning the lines read from r from the start.
+func forwardScanner(r io.Reader) lineScanner {
+	// The number of bytes consumed from the file is tracked to determine
+	// the offset of each line.
+	cr := &countingReader{r: r}
+	rdr := bufio.NewReader(cr)
+	lineno := 0
+	prefix := false
+	return func() (scanLine, error) {
+		start := cr.n - int64(rdr.Buffered())
+		// XXX Ignore potential partial reads (prefix) here, for lines
+		// with excessive length we will just treat it as multiple
+		// lines, all with the same line number
+		buf, isPrefix, err := rdr.ReadLine()
+		if err != nil {
+			return scanLine{}, err
+		}
+		if !prefix {
+			lineno++
+		}
+		prefix = isPrefix
+		return scanLine{text: string(buf), line: lineno, offset: start}, nil
+	}
+}
+
+// Return a scanner returning the lines at the end of the file read from r,
+// as limited by the tail options in opts. If the reverse option is set the
+// lines are returned starting with the last line of the file, otherwise
+// they are returned in the order they appear in the file. Line numbers are
+// not known when scanning from the end of a file.
+func tailScanner(r io.Reader, opts contentCheckOptions) (lineScanner, error) {
+	ra, size, err := readerAtSize(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	var limit int64
+	if opts.tailBytes > 0 && opts.tailBytes < size {
+		limit = size - opts.tailBytes
+	}
+	rr := newReverseLineReader(ra, size, limit)
+	if opts.reverse {
+		n := 0
+		return func() (scanLine, error) {
+			if opts.tailLines > 0 && n >= opts.tailLines {
+				return scanLine{}, io.EOF
+			}
+			n++
+			return rr.next()
+		}, nil
+	}
+	lines := make([]scanLine, 0)
+	for opts.tailLines == 0 || len(lines) < opts.tailLines {
+		l, err := rr.next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		lines = append(lines, l)
+	}
+	return func() (scanLine, error) {
+		if len(lines) == 0 {
+			return scanLine{}, io.EOF
+		}
+		l := lines[len(lines)-1]
+		lines = lines[:len(lines)-1]
+		return l, nil
+	}, nil
+}
+
+// Return r as an io.ReaderAt along with the size of the content. Regular
+// files are used directly, anything else (such as archive members or
+// content from evidence) is read into memory, returning an error if it is
+// larger than max bytes unless max is 0.
+func readerAtSize(r io.Reader, max int64) (io.ReaderAt, int64, error) {
+	if u, ok := r.(*usageReader); ok {
+		ra, size, err := readerAtSize(u.ReadCloser, max)
+		if err != nil {
+			return nil, 0, err
+		}
+		return usageReaderAt{ra}, size, nil
+	}
+	if fd, ok := r.(*os.File); ok {
+		fi, err := fd.Stat()
+		if err == nil && fi.Mode().IsRegular() {
+			return fd, fi.Size(), nil
+		}
+	}
+	if max > 0 {
+		r = io.LimitReader(r, max+1)
+	}
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	if max > 0 && int64(len(buf)) > max {
+		return nil, 0, fmt.Errorf("content exceeds maximum size of %v bytes", max)
+	}
+	return bytes.NewReader(buf), int64(len(buf)), nil
+}
+
+// reverseLineReader returns the lines of a file starting with the last
+// line, reading the file backwards in blocks so only the end of the file
+// needs to be read.
+type reverseLineReader struct {
+	r       io.ReaderAt
+	pos     int64  // The offset in the file buf starts at.
+	limit   int64  // Lines starting before this offset are not returned.
+	buf     []byte // Data read but not yet returned.
+	started bool
+	done    bool
+}
+
+func newReverseLineReader(r io.ReaderAt, size int64, limit int64) *reverseLineReader {
+	return &reverseLineReader{r: r, pos: size, limit: limit, done: size == 0}
+}
+
+func (r *reverseLineReader) next() (scanLine, error) {
+	for !r.done {
+		if i := bytes.LastIndexByte(r.buf, '\n'); i >= 0 {
+			ret := scanLine{text: trimCR(r.buf[i+1:]), offset: r.pos + int64(i) + 1}
+			r.buf = r.buf[:i]
+			return ret, nil
+		}
+		if r.pos > r.limit {
+			err := r.fill()
+			if err != nil {
+				return scanLine{}, err
+			}
+			continue
+		}
+		// The remaining data is the first line in the range being
+		// scanned, which is only returned if it is a complete line.
+		r.done = true
+		if r.pos > 0 {
+			var b [1]byte
+			_, err := r.r.ReadAt(b[:], r.pos-1)
+			if err != nil {
+				return scanLine{}, err
+			}
+			if b[0] != '\n' {
+				break
+			}
+		}
+		return scanLine{text: trimCR(r.buf), offset: r.pos}, nil
+	}
+	return scanLine{}, io.EOF
+}
+
+// Read the block preceding the data already read.
+func (r *reverseLineReader) fill() error {
+	n := int64(reverseBlockSize)
+	if r.pos-r.limit < n {
+		n = r.pos - r.limit
+	}
+	blk := make([]byte, n, n+int64(len(r.buf)))
+	rn, err := r.r.ReadAt(blk, r.pos-n)
+	if int64(rn) != n {
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	if !r.started {
+		// A newline at the end of the file terminates the last line,
+		// and does not start a new one.
+		r.started = true
+		if n > 0 && blk[n-1] == '\n' {
+			blk = blk[:n-1]
+		}
+	}
+	r.buf = append(blk, r.buf...)
+	r.pos -= n
+	return nil
+}
+
+func trimCR(b []byte) string {
+	return string(bytes.TrimSuffix(b, []byte{'\r'}))
+}
@@ -10,6 +10,7 @@ package scribe
 import (
 	"fmt"
 	"strings"
+	"text/template"
 )
 
 // TestTag describes arbitrary key value tags that can be associated with a test
@@ -26,16 +27,32 @@ type Test struct {
 	TestName    string `json:"name" yaml:"name"`     // An optional name for this test
 	Object      string `json:"object" yaml:"object"` // The object this test references.
 	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	Remediation string `json:"remediation,omitempty" yaml:"remediation,omitempty"` // Steps to remediate a failure
+	Owner       string `json:"owner,omitempty" yaml:"owner,omitempty"`             // The team or person responsible for the test
+	Contact     string `json:"contact,omitempty" yaml:"contact,omitempty"`         // How to reach the owner, such as an email address
 
 	// Evaluators
-	EVR    EVRTest    `json:"evr,omitempty" yaml:"evr,omitempty"`               // EVR version comparison
-	Regexp Regex      `json:"regexp,omitempty" yaml:"regexp,omitempty"`         // Regular expression comparison
-	EMatch ExactMatch `json:"exactmatch,omitempty" yaml:"exactmatch,omitempty"` // Exact string match
+	EVR       EVRTest       `json:"evr,omitempty" yaml:"evr,omitempty"`               // EVR version comparison
+	Regexp    Regex         `json:"regexp,omitempty" yaml:"regexp,omitempty"`         // Regular expression comparison
+	EMatch    ExactMatch    `json:"exactmatch,omitempty" yaml:"exactmatch,omitempty"` // Exact string match
+	CIDR      CIDRTest      `json:"cidr,omitempty" yaml:"cidr,omitempty"`             // IP address range membership
+	Set       SetTest       `json:"set,omitempty" yaml:"set,omitempty"`               // Set comparison of all values
+	Allowlist AllowlistTest `json:"allowlist,omitempty" yaml:"allowlist,omitempty"`   // File hash allowlist
+	Baseline  BaselineTest  `json:"baseline,omitempty" yaml:"baseline,omitempty"`     // Drift from a recorded baseline
+	Lookup    LookupTest    `json:"lookup,omitempty" yaml:"lookup,omitempty"`         // Comparison against a document table
+	Absent    AbsentTest    `json:"absent,omitempty" yaml:"absent,omitempty"`         // Assert values or criteria are absent
+	Compare   CompareTest   `json:"compare,omitempty" yaml:"compare,omitempty"`       // Typed value comparison
+	Custom    CustomTest    `json:"custom,omitempty" yaml:"custom,omitempty"`         // Registered custom evaluator
+	Script    ScriptTest    `json:"script,omitempty" yaml:"script,omitempty"`         // Starlark script evaluation
 
 	Tags []TestTag `json:"tags,omitempty" yaml:"tags,omitempty"` // Tags associated with the test
 
 	If []string `json:"if,omitempty" yaml:"if,omitempty"` // Slice of test names for dependencies
 
+	// The maximum number of false sub-results included in the results
+	// for the test, see SetMaxFailures().
+	MaxFailures int `json:"maxfailures,omitempty" yaml:"maxfailures,omitempty"`
+
 	// These values are optional but can be set to use the expected result
 	// callback handler. These are primarily used for testing but can also
 	// be used to trigger scribecmd to return and a non-zero exit status
@@ -48,6 +65,8 @@ type Test struct {
 
 	err error // The last error condition encountered during preparation or execution.
 
+	notApplicable string // If set, why the test can not be evaluated with partial evaluation.
+
 	// The final result for this test, a rolled up version of the results
 	// of this test for any identified candidates. If at least one
 	// candidate for the test evaluated to true, the master result will be
@@ -72,8 +91,9 @@ type evaluationResult struct {
 // this may be a filename or a package name. In those examples, the testValue
 // may be matched content from the file, or a package version string.
 type evaluationCriteria struct {
-	identifier string // The identifier used to track the source.
-	testValue  string // the actual test data passed to the evaluator.
+	identifier string    // The identifier used to track the source.
+	testValue  string    // the actual test data passed to the evaluator.
+	location   *Location // The location of the data in the source, if known.
 }
 
 type genericEvaluator interface {
@@ -87,6 +107,63 @@ func (t *Test) validate(d *Document) error {
 	if t.getEvaluationInterface() == nil {
 		return fmt.Errorf("%v: no valid evaluation interface", t.TestID)
 	}
+	if t.Regexp.Value != "" {
+		_, err := t.Regexp.re.compile(t.Regexp.Value)
+		if err != nil {
+			return fmt.Errorf("%v: %v", t.TestID, err)
+		}
+	}
+	if t.Set.Operation != "" {
+		err := t.Set.validate()
+		if err != nil {
+			return fmt.Errorf("%v: %v", t.TestID, err)
+		}
+	}
+	if t.Absent.Expression != "" || t.Absent.NoCriteria {
+		err := t.Absent.validate()
+		if err != nil {
+			return fmt.Errorf("%v: %v", t.TestID, err)
+		}
+	}
+	if t.Lookup.Table != "" {
+		err := t.Lookup.validate(d)
+		if err != nil {
+			return fmt.Errorf("%v: %v", t.TestID, err)
+		}
+	}
+	if t.EMatch.Type != "" {
+		err := t.EMatch.validate()
+		if err != nil {
+			return fmt.Errorf("%v: %v", t.TestID, err)
+		}
+	}
+	if t.Compare.Operation != "" || t.Compare.Type != "" {
+		err := t.Compare.validate()
+		if err != nil {
+			return fmt.Errorf("%v: %v", t.TestID, err)
+		}
+	}
+	if t.Custom.Type != "" {
+		err := t.Custom.validate()
+		if err != nil {
+			return fmt.Errorf("%v: %v", t.TestID, err)
+		}
+	}
+	if t.Script.Source != "" {
+		err := t.Script.validate()
+		if err != nil {
+			return fmt.Errorf("%v: %v", t.TestID, err)
+		}
+	}
+	if len(t.CIDR.Ranges) > 0 {
+		err := t.CIDR.compile()
+		if err != nil {
+			return fmt.Errorf("%v: %v", t.TestID, err)
+		}
+	}
+	if t.MaxFailures < 0 {
+		return fmt.Errorf("%v: maxfailures can not be negative", t.TestID)
+	}
 	for _, x := range t.If {
 		ptr, err := d.GetTest(x)
 		if err != nil {
@@ -96,6 +173,15 @@ func (t *Test) validate(d *Document) error {
 			return fmt.Errorf("%v: test cannot reference itself", t.TestID)
 		}
 	}
+	for _, x := range []string{t.Description, t.Remediation} {
+		if !strings.Contains(x, "{{") {
+			continue
+		}
+		_, err := template.New(t.TestID).Parse(x)
+		if err != nil {
+			return fmt.Errorf("%v: %v", t.TestID, err)
+		}
+	}
 	// Ensure the tags only contain valid characters
 	for _, x := range t.Tags {
 		if strings.ContainsRune(x.Key, '"') {
@@ -115,6 +201,24 @@ func (t *Test) getEvaluationInterface() genericEvaluator {
 		return &t.Regexp
 	} else if t.EMatch.Value != "" {
 		return &t.EMatch
+	} else if len(t.CIDR.Ranges) > 0 {
+		return &t.CIDR
+	} else if t.Set.Operation != "" {
+		return &t.Set
+	} else if t.Allowlist.File != "" {
+		return &t.Allowlist
+	} else if t.Baseline.Name != "" {
+		return &t.Baseline
+	} else if t.Lookup.Table != "" {
+		return &t.Lookup
+	} else if t.Absent.Expression != "" || t.Absent.NoCriteria {
+		return &t.Absent
+	} else if t.Compare.Operation != "" {
+		return &t.Compare
+	} else if t.Custom.Type != "" {
+		return &t.Custom
+	} else if t.Script.Source != "" {
+		return &t.Script
 	}
 	// If no evaluation criteria exists, use a no op evaluator
 	// which will always return true for the test if any source objects
@@ -148,6 +252,14 @@ func (t *Test) runTest(d *Document) error {
 
 	debugPrint("runTest(): running \"%v\"\n", t.TestID)
 	t.evaluated = true
+	if t.notApplicable != "" {
+		debugPrint("runTest(): \"%v\" is not applicable\n", t.TestID)
+		return nil
+	}
+	if err := usageDeadline(); err != nil {
+		t.err = err
+		return t.errorHandler(d)
+	}
 	// First, see if this test has any dependencies. If so, run those
 	// before we execute this one.
 	for _, x := range t.If {
@@ -168,6 +280,13 @@ func (t *Test) runTest(d *Document) error {
 		t.err = fmt.Errorf("test has no valid evaluation interface")
 		return t.errorHandler(d)
 	}
+	if lev, ok := ev.(*LookupTest); ok {
+		err := lev.bind(d)
+		if err != nil {
+			t.err = err
+			return t.errorHandler(d)
+		}
+	}
 	// Make sure the object is prepared before we use it.
 	flag, err := d.objectPrepared(t.Object)
 	if err != nil {
@@ -183,13 +302,25 @@ func (t *Test) runTest(d *Document) error {
 		t.err = fmt.Errorf("test has no valid source interface")
 		return t.errorHandler(d)
 	}
-	for _, x := range si.getCriteria() {
-		res, err := ev.evaluate(x)
+	// Set evaluators compare all criteria together and determine the
+	// master result themselves.
+	criteria := dedupCriteria(si.getCriteria())
+	setResult := false
+	if sev, ok := ev.(setEvaluator); ok {
+		t.results, setResult, err = sev.evaluateSet(criteria)
 		if err != nil {
 			t.err = err
 			return t.errorHandler(d)
 		}
-		t.results = append(t.results, res)
+	} else {
+		for _, x := range criteria {
+			res, err := ev.evaluate(x)
+			if err != nil {
+				t.err = err
+				return t.errorHandler(d)
+			}
+			t.results = append(t.results, res)
+		}
 	}
 
 	// Set the master result for the test. If any of the dependent tests
@@ -206,6 +337,9 @@ func (t *Test) runTest(d *Document) error {
 	if t.hasTrueResults {
 		t.masterResult = true
 	}
+	if _, ok := ev.(setEvaluator); ok {
+		t.masterResult = setResult
+	}
 	for _, x := range t.If {
 		dt, err := d.GetTest(x)
 		if err != nil {
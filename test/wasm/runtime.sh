@@ -0,0 +1,17 @@
+#!/bin/sh
+# Stands in for wasmtime in TestWASM: emulates a module that reports the
+# sshd settings named in its arguments from the file given as the first
+# argument, reading it from the directory mapped as the module root.
+[ "$1" = "run" ] && [ "$2" = "--dir" ] || exit 2
+root=${3%::/}
+module=$4
+shift 4
+[ -f "$module" ] || { echo "module not found" >&2; exit 1; }
+[ "$(dirname "$module")" = "$(dirname "$root")" ] || { echo "module not copied" >&2; exit 1; }
+[ -e "$root/etc/passwd" ] && { echo "undeclared file visible" >&2; exit 1; }
+file=$1
+shift
+for k in "$@"; do
+	v=$(awk -v k="$k" '$1 == k { print $2 }' "$root$file")
+	printf '{"identifier": "%s", "value": "%s"}\n' "$k" "$v"
+done
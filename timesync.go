@@ -0,0 +1,255 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// TimeSync is used to perform tests against the time synchronization status
+// of the system. chrony, ntpd and systemd-timesyncd are supported.
+//
+// Field specifies which value is returned as the test value, and can be one
+// of:
+//
+// synchronized: "true" if the clock is synchronized
+//
+// server: each configured time server, a criteria is returned for each
+// server
+//
+// offset: the current offset from the reference time in seconds
+//
+// The identifier for the criteria is the name of the time synchronization
+// daemon in use. If no supported daemon is found no criteria are returned.
+// If Daemon is set to chronyd, ntpd or systemd-timesyncd only that daemon
+// is queried, so for example a policy requiring chrony returns no criteria
+// on a system using ntpd.
+type TimeSync struct {
+	Field  string `json:"field,omitempty" yaml:"field,omitempty"`
+	Daemon string `json:"daemon,omitempty" yaml:"daemon,omitempty"`
+
+	matches []timeSyncMatch
+}
+
+type timeSyncMatch struct {
+	daemon string
+	value  string
+}
+
+type timeSyncStatus struct {
+	daemon       string
+	synchronized bool
+	offset       float64
+	servers      []string
+}
+
+// Configuration files time servers are read from for each daemon.
+var timeSyncConfigs = map[string][]string{
+	"chronyd":           {"/etc/chrony.conf", "/etc/chrony/chrony.conf"},
+	"ntpd":              {"/etc/ntp.conf", "/etc/ntpsec/ntp.conf"},
+	"systemd-timesyncd": {"/etc/systemd/timesyncd.conf"},
+}
+
+func (t *TimeSync) isChain() bool {
+	return false
+}
+
+func (t *TimeSync) fireChains(d *Document) ([]evaluationCriteria, error) {
+	return nil, nil
+}
+
+func (t *TimeSync) mergeCriteria(c []evaluationCriteria) {
+}
+
+func (t *TimeSync) expandVariables(v []Variable) {
+}
+
+func (t *TimeSync) validate(d *Document) error {
+	switch t.Field {
+	case "synchronized", "server", "offset":
+	default:
+		return fmt.Errorf("timesync field must be synchronized, server or offset")
+	}
+	switch t.Daemon {
+	case "", "chronyd", "ntpd", "systemd-timesyncd":
+	default:
+		return fmt.Errorf("timesync daemon must be chronyd, ntpd or systemd-timesyncd")
+	}
+	return nil
+}
+
+func (t *TimeSync) getCriteria() (ret []evaluationCriteria) {
+	for _, x := range t.matches {
+		n := evaluationCriteria{}
+		n.identifier = x.daemon
+		n.testValue = x.value
+		ret = append(ret, n)
+	}
+	return ret
+}
+
+func (t *TimeSync) prepare() error {
+	debugPrint("prepare(): checking time synchronization, field \"%v\"\n", t.Field)
+	st, found := getTimeSyncStatus(t.Daemon)
+	if !found {
+		debugPrint("prepare(): no time synchronization daemon found\n")
+		return nil
+	}
+	switch t.Field {
+	case "synchronized":
+		t.matches = append(t.matches, timeSyncMatch{st.daemon, fmt.Sprintf("%v", st.synchronized)})
+	case "offset":
+		t.matches = append(t.matches, timeSyncMatch{st.daemon, strconv.FormatFloat(st.offset, 'f', -1, 64)})
+	case "server":
+		for _, x := range st.servers {
+			t.matches = append(t.matches, timeSyncMatch{st.daemon, x})
+		}
+	}
+	return nil
+}
+
+// Return the status of the first supported daemon found, or of daemon if
+// it is set.
+func getTimeSyncStatus(daemon string) (timeSyncStatus, bool) {
+	for _, f := range []struct {
+		daemon string
+		status func() (timeSyncStatus, error)
+	}{
+		{"chronyd", chronyStatus},
+		{"ntpd", ntpdStatus},
+		{"systemd-timesyncd", timesyncdStatus},
+	} {
+		if daemon != "" && daemon != f.daemon {
+			continue
+		}
+		st, err := f.status()
+		if err != nil {
+			debugPrint("getTimeSyncStatus(): %v: %v\n", f.daemon, err)
+			continue
+		}
+		st.servers = timeSyncServers(st.daemon)
+		return st, true
+	}
+	return timeSyncStatus{}, false
+}
+
+// Run the command used to query the status of a daemon, returning the
+// output. With test hooks enabled the output is read from test/timesync.
+func timeSyncCommand(name string, args ...string) ([]byte, error) {
+	if sRuntime.testHooks {
+		return ioutil.ReadFile(filepath.Join("./test/timesync", name))
+	}
+	return exec.Command(name, args...).Output()
+}
+
+func chronyStatus() (ret timeSyncStatus, err error) {
+	buf, err := timeSyncCommand("chronyc", "-c", "tracking")
+	if err != nil {
+		return
+	}
+	// The CSV tracking output includes the system time offset in the
+	// fifth field and the leap status in the last field.
+	s := strings.Split(strings.TrimSpace(string(buf)), ",")
+	if len(s) < 14 {
+		return ret, fmt.Errorf("unexpected chronyc output")
+	}
+	ret.daemon = "chronyd"
+	ret.offset, _ = strconv.ParseFloat(s[4], 64)
+	ret.synchronized = s[len(s)-1] != "Not synchronised"
+	return ret, nil
+}
+
+func ntpdStatus() (ret timeSyncStatus, err error) {
+	buf, err := timeSyncCommand("ntpq", "-pn")
+	if err != nil {
+		return
+	}
+	ret.daemon = "ntpd"
+	for _, x := range strings.Split(string(buf), "\n") {
+		// The peer selected for synchronization is prefixed with *,
+		// the offset is reported in milliseconds.
+		if !strings.HasPrefix(x, "*") {
+			continue
+		}
+		s := strings.Fields(x)
+		if len(s) < 10 {
+			continue
+		}
+		ret.synchronized = true
+		off, err := strconv.ParseFloat(s[8], 64)
+		if err == nil {
+			ret.offset = off / 1000
+		}
+	}
+	return ret, nil
+}
+
+func timesyncdStatus() (ret timeSyncStatus, err error) {
+	buf, err := timeSyncCommand("timedatectl", "show")
+	if err != nil {
+		return
+	}
+	props := make(map[string]string)
+	for _, x := range strings.Split(string(buf), "\n") {
+		s := strings.SplitN(x, "=", 2)
+		if len(s) == 2 {
+			props[s[0]] = s[1]
+		}
+	}
+	if props["NTP"] != "yes" {
+		return ret, fmt.Errorf("systemd-timesyncd is not enabled")
+	}
+	ret.daemon = "systemd-timesyncd"
+	ret.synchronized = props["NTPSynchronized"] == "yes"
+	return ret, nil
+}
+
+// Return the time servers configured for the given daemon, read from the
+// first of the configuration files for the daemon that exists.
+func timeSyncServers(daemon string) []string {
+	ret := make([]string, 0)
+	for _, x := range timeSyncConfigs[daemon] {
+		if sRuntime.testHooks {
+			x = filepath.Join("./test/timesync", filepath.Base(x))
+		}
+		fd, err := os.Open(x)
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(fd)
+		for scanner.Scan() {
+			s := strings.Fields(scanner.Text())
+			if len(s) == 0 {
+				continue
+			}
+			if daemon == "systemd-timesyncd" {
+				if strings.HasPrefix(s[0], "NTP=") {
+					s[0] = strings.TrimPrefix(s[0], "NTP=")
+					if s[0] == "" {
+						s = s[1:]
+					}
+					ret = append(ret, s...)
+				}
+				continue
+			}
+			if (s[0] == "server" || s[0] == "pool" || s[0] == "peer") && len(s) > 1 {
+				ret = append(ret, s[1])
+			}
+		}
+		fd.Close()
+		break
+	}
+	return ret
+}
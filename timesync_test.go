@@ -0,0 +1,172 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/mozilla/scribe"
+)
+
+// Used in TestTimeSyncPolicy. With test hooks enabled the daemon status is
+// read from the command output in test/timesync, where chrony and ntpd are
+// synchronized and systemd-timesyncd is not.
+var timeSyncPolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "synchronized",
+		"timesync": {
+			"field": "synchronized"
+		}
+	},
+
+	{
+		"object": "offset",
+		"timesync": {
+			"field": "offset"
+		}
+	},
+
+	{
+		"object": "ntpd-offset",
+		"timesync": {
+			"field": "offset",
+			"daemon": "ntpd"
+		}
+	},
+
+	{
+		"object": "timesyncd-synchronized",
+		"timesync": {
+			"field": "synchronized",
+			"daemon": "systemd-timesyncd"
+		}
+	},
+
+	{
+		"object": "servers",
+		"timesync": {
+			"field": "server"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "timesync0",
+		"expectedresult": true,
+		"object": "synchronized",
+		"exactmatch": {
+			"value": "true"
+		}
+	},
+
+	{
+		"test": "timesync1",
+		"expectedresult": true,
+		"object": "offset",
+		"regexp": {
+			"value": "^-?0\\.0000"
+		}
+	},
+
+	{
+		"test": "timesync2",
+		"expectedresult": false,
+		"object": "ntpd-offset",
+		"regexp": {
+			"value": "^-?0\\.0000"
+		}
+	},
+
+	{
+		"test": "timesync3",
+		"expectedresult": false,
+		"object": "timesyncd-synchronized",
+		"exactmatch": {
+			"value": "true"
+		}
+	},
+
+	{
+		"test": "timesync4",
+		"expectedresult": true,
+		"object": "servers",
+		"set": {
+			"operation": "subset",
+			"values": ["2.pool.ntp.org", "time.example.com", "time2.example.com"]
+		}
+	}
+	]
+}
+`
+
+func TestTimeSyncPolicy(t *testing.T) {
+	doc := genericTestExec(t, timeSyncPolicyDoc)
+	expect := map[string][]string{
+		"timesync0": {"chronyd:true"},
+		"timesync1": {"chronyd:-0.0000125"},
+		"timesync2": {"ntpd:-0.000512"},
+		"timesync3": {"systemd-timesyncd:false"},
+		"timesync4": {"chronyd:2.pool.ntp.org", "chronyd:time.example.com"},
+	}
+	for k, v := range expect {
+		e, err := doc.ExplainTest(k)
+		if err != nil {
+			t.Fatalf("Document.ExplainTest: %v", err)
+		}
+		got := make([]string, 0)
+		for _, x := range e.Criteria {
+			got = append(got, x.Identifier+":"+x.Value)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, v) {
+			t.Fatalf("%v: unexpected criteria %v", k, got)
+		}
+	}
+}
+
+func TestTimeSyncServers(t *testing.T) {
+	for k, v := range map[string][]string{
+		"ntpd":              {"192.0.2.10", "192.0.2.11"},
+		"systemd-timesyncd": {"ntp1.example.com", "ntp2.example.com"},
+	} {
+		docstr := fmt.Sprintf(`{
+			"objects": [ { "object": "servers", "timesync": { "field": "server", "daemon": "%v" } } ],
+			"tests": [ { "test": "servers", "object": "servers", "expectedresult": true } ]
+		}`, k)
+		doc := genericTestExec(t, docstr)
+		e, err := doc.ExplainTest("servers")
+		if err != nil {
+			t.Fatalf("Document.ExplainTest: %v", err)
+		}
+		got := make([]string, 0)
+		for _, x := range e.Criteria {
+			if x.Identifier != k {
+				t.Fatalf("%v: unexpected identifier %v", k, x.Identifier)
+			}
+			got = append(got, x.Value)
+		}
+		if !reflect.DeepEqual(got, v) {
+			t.Fatalf("%v: unexpected servers %v", k, got)
+		}
+	}
+
+	_, err := scribe.LoadDocument(strings.NewReader(`{
+		"objects": [ { "object": "servers", "timesync": { "field": "server", "daemon": "openntpd" } } ],
+		"tests": [ { "test": "servers", "object": "servers" } ]
+	}`))
+	if err == nil {
+		t.Fatalf("scribe.LoadDocument should have failed with unsupported daemon")
+	}
+}
@@ -0,0 +1,129 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// TLSOptions describes the transport security of network connections,
+// such as submitting results to a collector, fetching documents from a
+// policy server, and the agent health endpoint.
+//
+// CAFile is a PEM file of the CA certificates peers must be signed by. For
+// clients it replaces the system roots, pinning the CAs servers are
+// trusted from; for servers it enables mutual TLS, requiring clients to
+// present a certificate signed by one of the CAs. CertFile and KeyFile are
+// the PEM certificate and key presented to peers, the client certificate
+// for clients. MinVersion is the minimum TLS version, 1.2 (the default) or
+// 1.3.
+type TLSOptions struct {
+	CAFile     string
+	CertFile   string
+	KeyFile    string
+	MinVersion string
+}
+
+// IsZero returns true if no options are set.
+func (o TLSOptions) IsZero() bool {
+	return o == TLSOptions{}
+}
+
+func (o TLSOptions) config() (*tls.Config, *x509.CertPool, error) {
+	ret := &tls.Config{MinVersion: tls.VersionTLS12}
+	switch o.MinVersion {
+	case "", "1.2":
+	case "1.3":
+		ret.MinVersion = tls.VersionTLS13
+	default:
+		return nil, nil, fmt.Errorf("tls minimum version must be 1.2 or 1.3")
+	}
+	if (o.CertFile == "") != (o.KeyFile == "") {
+		return nil, nil, fmt.Errorf("tls certificate and key must be specified together")
+	}
+	if o.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		ret.Certificates = []tls.Certificate{cert}
+	}
+	if o.CAFile == "" {
+		return ret, nil, nil
+	}
+	buf, err := ioutil.ReadFile(o.CAFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(buf) {
+		return nil, nil, fmt.Errorf("%v: no CA certificates found", o.CAFile)
+	}
+	return ret, pool, nil
+}
+
+// ClientConfig returns the TLS configuration for connections to servers.
+func (o TLSOptions) ClientConfig() (*tls.Config, error) {
+	ret, pool, err := o.config()
+	if err != nil {
+		return nil, err
+	}
+	ret.RootCAs = pool
+	return ret, nil
+}
+
+// ServerConfig returns the TLS configuration for servers, which requires a
+// certificate.
+func (o TLSOptions) ServerConfig() (*tls.Config, error) {
+	ret, pool, err := o.config()
+	if err != nil {
+		return nil, err
+	}
+	if len(ret.Certificates) == 0 {
+		return nil, fmt.Errorf("tls certificate and key must be specified for servers")
+	}
+	if pool != nil {
+		ret.ClientCAs = pool
+		ret.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return ret, nil
+}
+
+// SetTLSOptions sets the TLS configuration used for connections to servers
+// by HTTP clients returned by HTTPClient(). Passing zero options restores
+// the defaults.
+func SetTLSOptions(o TLSOptions) error {
+	if o.IsZero() {
+		sRuntime.tlsClient = nil
+		return nil
+	}
+	c, err := o.ClientConfig()
+	if err != nil {
+		return err
+	}
+	sRuntime.tlsClient = c
+	return nil
+}
+
+// HTTPClient returns an HTTP client with the timeout specified by timeout
+// (0 for none) using the TLS configuration set with SetTLSOptions(). The
+// library and the scribe packages use it for their requests.
+func HTTPClient(timeout time.Duration) *http.Client {
+	ret := &http.Client{Timeout: timeout}
+	if sRuntime.tlsClient != nil {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.TLSClientConfig = sRuntime.tlsClient.Clone()
+		ret.Transport = t
+	}
+	return ret
+}
@@ -0,0 +1,133 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mozilla/scribe"
+)
+
+// Create a certificate signed by parent (self-signed if nil), writing the
+// certificate and key to dir as name.pem and name.key.
+func writeCert(t *testing.T, dir string, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyder, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, name+".pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyder}), 0600)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestTLSOptions(t *testing.T) {
+	dir := t.TempDir()
+	ca, cakey := writeCert(t, dir, "ca", nil, nil)
+	writeCert(t, dir, "server", ca, cakey)
+	writeCert(t, dir, "client", ca, cakey)
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	// The server requires a client certificate signed by the CA.
+	server := scribe.TLSOptions{CAFile: path("ca.pem"), CertFile: path("server.pem"), KeyFile: path("server.key"), MinVersion: "1.3"}
+	cfg, err := server.ServerConfig()
+	if err != nil {
+		t.Fatalf("TLSOptions.ServerConfig: %v", err)
+	}
+	if cfg.ClientAuth != tls.RequireAndVerifyClientCert || cfg.MinVersion != tls.VersionTLS13 {
+		t.Fatalf("unexpected server configuration")
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = cfg
+	srv.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	srv.StartTLS()
+	defer srv.Close()
+
+	// Without a CA the server certificate is not trusted, and without a
+	// client certificate the server rejects the connection.
+	if resp, err := scribe.HTTPClient(time.Minute).Get(srv.URL); err == nil {
+		resp.Body.Close()
+		t.Fatalf("request should have failed without CA")
+	}
+	err = scribe.SetTLSOptions(scribe.TLSOptions{CAFile: path("ca.pem")})
+	if err != nil {
+		t.Fatalf("scribe.SetTLSOptions: %v", err)
+	}
+	defer scribe.SetTLSOptions(scribe.TLSOptions{})
+	if resp, err := scribe.HTTPClient(time.Minute).Get(srv.URL); err == nil {
+		resp.Body.Close()
+		t.Fatalf("request should have failed without client certificate")
+	}
+	err = scribe.SetTLSOptions(scribe.TLSOptions{CAFile: path("ca.pem"), CertFile: path("client.pem"), KeyFile: path("client.key")})
+	if err != nil {
+		t.Fatalf("scribe.SetTLSOptions: %v", err)
+	}
+	resp, err := scribe.HTTPClient(time.Minute).Get(srv.URL)
+	if err != nil {
+		t.Fatalf("request with client certificate failed: %v", err)
+	}
+	resp.Body.Close()
+
+	for _, x := range []scribe.TLSOptions{
+		{MinVersion: "1.1"},
+		{CertFile: path("client.pem")},
+		{CAFile: path("client.key")},
+	} {
+		if err := scribe.SetTLSOptions(x); err == nil {
+			t.Fatalf("scribe.SetTLSOptions should have failed for %+v", x)
+		}
+	}
+	if _, err := (scribe.TLSOptions{CAFile: path("ca.pem")}).ServerConfig(); err == nil {
+		t.Fatalf("TLSOptions.ServerConfig should have failed without certificate")
+	}
+}
@@ -0,0 +1,282 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+// Package update keeps scribe binaries deployed across a fleet current,
+// without a separate orchestration channel.
+//
+// Releases are described by a Manifest published over HTTPS, listing the
+// binary for each platform and its SHA-256 digest, and signed using an
+// ed25519 release key. An Updater fetches the manifest, verifies the
+// signature, and if the release is newer than the running version
+// downloads the binary for the platform, verifies the digest and replaces
+// the executable atomically.
+package update
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/mozilla/scribe"
+)
+
+// Manifest describes a release. Signature is a base64 encoded ed25519
+// signature over the JSON encoding of the manifest without the signature.
+type Manifest struct {
+	Version   string   `json:"version"`
+	Binaries  []Binary `json:"binaries"`
+	Signature string   `json:"signature,omitempty"`
+}
+
+// Binary describes the release binary for a platform. OS and Arch use the
+// values of GOOS and GOARCH, and SHA256 is the hex encoded digest of the
+// binary.
+type Binary struct {
+	OS     string `json:"os"`
+	Arch   string `json:"arch"`
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256"`
+}
+
+// The maximum size of a manifest and of a release binary.
+const (
+	maxManifestSize = 1 << 20
+	maxBinarySize   = 256 << 20
+)
+
+const defaultTimeout = 5 * time.Minute
+
+func (m *Manifest) signedPayload() ([]byte, error) {
+	c := *m
+	c.Signature = ""
+	return json.Marshal(c)
+}
+
+// Sign signs the manifest using the ed25519 private key key, setting the
+// Signature field.
+func (m *Manifest) Sign(key ed25519.PrivateKey) error {
+	buf, err := m.signedPayload()
+	if err != nil {
+		return err
+	}
+	m.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, buf))
+	return nil
+}
+
+// Verify verifies the manifest signature using the ed25519 public key key.
+func (m *Manifest) Verify(key ed25519.PublicKey) error {
+	if m.Signature == "" {
+		return fmt.Errorf("release manifest is not signed")
+	}
+	sig, err := base64.StdEncoding.DecodeString(m.Signature)
+	if err != nil {
+		return err
+	}
+	payload, err := m.signedPayload()
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(key, payload, sig) {
+		return fmt.Errorf("release manifest signature is invalid")
+	}
+	return nil
+}
+
+// Binary returns the release binary for the platform goos/goarch.
+func (m *Manifest) Binary(goos string, goarch string) (Binary, error) {
+	for _, x := range m.Binaries {
+		if x.OS == goos && x.Arch == goarch {
+			return x, nil
+		}
+	}
+	return Binary{}, fmt.Errorf("release %v has no binary for %v/%v", m.Version, goos, goarch)
+}
+
+// Updater updates the executable at Path (by default the running
+// executable) from the manifest at ManifestURL, which must be signed using
+// Key. ManifestURL and the binary URLs in the manifest must use HTTPS. If
+// Client is nil scribe.HTTPClient() is used with a timeout of 5 minutes.
+type Updater struct {
+	ManifestURL string
+	Key         ed25519.PublicKey
+	Path        string
+	Client      *http.Client
+}
+
+// Check fetches and verifies the release manifest, returning the manifest
+// and true if the release is newer than version current.
+func (u *Updater) Check(current string) (Manifest, bool, error) {
+	var m Manifest
+	if len(u.Key) != ed25519.PublicKeySize {
+		return m, false, fmt.Errorf("invalid release public key")
+	}
+	buf, err := u.get(u.ManifestURL, maxManifestSize)
+	if err != nil {
+		return m, false, err
+	}
+	err = json.Unmarshal(buf, &m)
+	if err != nil {
+		return m, false, fmt.Errorf("release manifest: %v", err)
+	}
+	err = m.Verify(u.Key)
+	if err != nil {
+		return m, false, err
+	}
+	newer, err := scribe.TestEvrCompare(scribe.EvropGreaterThan, m.Version, current)
+	if err != nil {
+		return m, false, err
+	}
+	return m, newer, nil
+}
+
+// Update updates the executable if a release newer than version current
+// is available, returning the version installed or an empty string if
+// the executable is already current. The new executable is used the next
+// time it is started.
+func (u *Updater) Update(current string) (string, error) {
+	m, newer, err := u.Check(current)
+	if err != nil || !newer {
+		return "", err
+	}
+	b, err := m.Binary(runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		return "", err
+	}
+	err = u.Install(b)
+	if err != nil {
+		return "", err
+	}
+	return m.Version, nil
+}
+
+// Install downloads binary b, verifies the digest and replaces the
+// executable with it.
+//
+// The binary is written to a temporary file in the directory of the
+// executable, and renamed over the executable so a failed update never
+// leaves a partially written executable. On Windows, where a running
+// executable can not be replaced, the executable is first renamed with the
+// extension .old, and renamed back if the new executable can not be put in
+// place.
+func (u *Updater) Install(b Binary) error {
+	want, err := hex.DecodeString(b.SHA256)
+	if err != nil || len(want) != sha256.Size {
+		return fmt.Errorf("release binary has invalid sha256")
+	}
+	path, err := u.path()
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	buf, err := u.get(b.URL, maxBinarySize)
+	if err != nil {
+		return err
+	}
+	got := sha256.Sum256(buf)
+	if hex.EncodeToString(got[:]) != strings.ToLower(b.SHA256) {
+		return fmt.Errorf("release binary sha256 does not match manifest")
+	}
+	fd, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".update")
+	if err != nil {
+		return err
+	}
+	tmp := fd.Name()
+	_, err = fd.Write(buf)
+	if err == nil {
+		err = fd.Sync()
+	}
+	if cerr := fd.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, fi.Mode().Perm())
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	old := ""
+	if runtime.GOOS == "windows" {
+		old = path + ".old"
+		os.Remove(old)
+		err = os.Rename(path, old)
+		if err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+	err = os.Rename(tmp, path)
+	if err != nil {
+		os.Remove(tmp)
+		// Restore the executable renamed on Windows, so a failed update
+		// does not leave no executable at all.
+		if old != "" {
+			if rerr := os.Rename(old, path); rerr != nil {
+				return fmt.Errorf("%v, and restoring %v failed: %v", err, old, rerr)
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+func (u *Updater) path() (string, error) {
+	if u.Path != "" {
+		return u.Path, nil
+	}
+	p, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(p)
+}
+
+// Fetch rawurl, which must use HTTPS, reading at most max bytes.
+func (u *Updater) get(rawurl string, max int64) ([]byte, error) {
+	p, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if p.Scheme != "https" {
+		return nil, fmt.Errorf("%v: update URLs must use https", rawurl)
+	}
+	client := u.Client
+	if client == nil {
+		client = scribe.HTTPClient(defaultTimeout)
+	}
+	resp, err := client.Get(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%v: %v", rawurl, resp.Status)
+	}
+	buf, err := ioutil.ReadAll(io.LimitReader(resp.Body, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(buf)) > max {
+		return nil, fmt.Errorf("%v: response is too large", rawurl)
+	}
+	return buf, nil
+}
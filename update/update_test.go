@@ -0,0 +1,136 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package update_test
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/mozilla/scribe/update"
+)
+
+func TestUpdate(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey: %v", err)
+	}
+	binary := []byte("#!/bin/sh\necho scribe 0.6\n")
+	digest := sha256.Sum256(binary)
+	var manifest []byte
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/manifest.json":
+			w.Write(manifest)
+		case "/scribecmd":
+			w.Write(binary)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	setManifest := func(m update.Manifest, key ed25519.PrivateKey) {
+		err := m.Sign(key)
+		if err != nil {
+			t.Fatalf("Manifest.Sign: %v", err)
+		}
+		manifest, err = json.Marshal(m)
+		if err != nil {
+			t.Fatalf("json.Marshal: %v", err)
+		}
+	}
+	m := update.Manifest{
+		Version: "0.6",
+		Binaries: []update.Binary{{
+			OS:     runtime.GOOS,
+			Arch:   runtime.GOARCH,
+			URL:    srv.URL + "/scribecmd",
+			SHA256: hex.EncodeToString(digest[:]),
+		}},
+	}
+	setManifest(m, priv)
+
+	dir, err := ioutil.TempDir("", "scribe-update")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	exe := filepath.Join(dir, "scribecmd")
+	err = ioutil.WriteFile(exe, []byte("old"), 0755)
+	if err != nil {
+		t.Fatalf("ioutil.WriteFile: %v", err)
+	}
+	u := update.Updater{ManifestURL: srv.URL + "/manifest.json", Key: pub, Path: exe, Client: srv.Client()}
+
+	v, err := u.Update("0.6")
+	if err != nil || v != "" {
+		t.Fatalf("Updater.Update: current version updated to %q: %v", v, err)
+	}
+	v, err = u.Update("0.5")
+	if err != nil {
+		t.Fatalf("Updater.Update: %v", err)
+	}
+	if v != "0.6" {
+		t.Fatalf("Updater.Update: unexpected version %q", v)
+	}
+	buf, err := ioutil.ReadFile(exe)
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile: %v", err)
+	}
+	if string(buf) != string(binary) {
+		t.Fatalf("executable was not replaced")
+	}
+	fi, err := os.Stat(exe)
+	if err != nil {
+		t.Fatalf("os.Stat: %v", err)
+	}
+	if runtime.GOOS != "windows" && fi.Mode().Perm() != 0755 {
+		t.Fatalf("executable has mode %v", fi.Mode())
+	}
+
+	// A manifest signed with another key, and a binary that does not
+	// match the digest, must be rejected without touching the executable.
+	ioutil.WriteFile(exe, []byte("old"), 0755)
+	_, other, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey: %v", err)
+	}
+	setManifest(m, other)
+	_, err = u.Update("0.5")
+	if err == nil {
+		t.Fatalf("Updater.Update accepted manifest with invalid signature")
+	}
+	m.Binaries[0].SHA256 = hex.EncodeToString(make([]byte, sha256.Size))
+	setManifest(m, priv)
+	_, err = u.Update("0.5")
+	if err == nil {
+		t.Fatalf("Updater.Update accepted binary with invalid digest")
+	}
+	buf, _ = ioutil.ReadFile(exe)
+	if string(buf) != "old" {
+		t.Fatalf("executable was modified by a failed update")
+	}
+	ents, _ := ioutil.ReadDir(dir)
+	if len(ents) != 1 {
+		t.Fatalf("temporary files left in executable directory")
+	}
+
+	u.ManifestURL = "http" + srv.URL[len("https"):] + "/manifest.json"
+	_, _, err = u.Check("0.5")
+	if err == nil {
+		t.Fatalf("Updater.Check accepted manifest URL without https")
+	}
+}
@@ -0,0 +1,114 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The value types supported by typed evaluator parameters. Sources return
+// criteria values as strings, which are coerced to the type of the
+// parameter they are compared with as follows:
+//
+// string: the value is used as is, and values are compared lexically.
+//
+// int: leading and trailing white space is removed, and the remainder must
+// be a base 10 integer with an optional sign that fits in 64 bits (for
+// example 10, -1 or +022). Values such as 1.5 or 10k are not integers.
+//
+// bool: leading and trailing white space is removed, and the remainder must
+// be one of true, yes, on or 1, or false, no, off or 0, ignoring case. Bool
+// values can only be compared for equality.
+//
+// version: leading and trailing white space is removed, and the remainder
+// is compared as a version in the same way as the evr evaluator.
+//
+// A criteria value that can not be coerced to the type is an error, rather
+// than a false result, so a source returning unexpected data is reported.
+const (
+	ValueString  = "string"
+	ValueInt     = "int"
+	ValueBool    = "bool"
+	ValueVersion = "version"
+)
+
+// A value coerced to one of the value types.
+type typedValue struct {
+	typ  string
+	str  string
+	num  int64
+	flag bool
+	ver  evr
+}
+
+// Coerce s to the value type typ.
+func parseTypedValue(typ string, s string) (ret typedValue, err error) {
+	ret.typ = typ
+	ret.str = s
+	switch typ {
+	case ValueString:
+	case ValueInt:
+		ret.num, err = strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		if err != nil {
+			return ret, fmt.Errorf("value %q is not a valid int", s)
+		}
+	case ValueBool:
+		switch strings.ToLower(strings.TrimSpace(s)) {
+		case "true", "yes", "on", "1":
+			ret.flag = true
+		case "false", "no", "off", "0":
+		default:
+			return ret, fmt.Errorf("value %q is not a valid bool", s)
+		}
+	case ValueVersion:
+		v := strings.TrimSpace(s)
+		if v == "" {
+			return ret, fmt.Errorf("value %q is not a valid version", s)
+		}
+		ret.ver, err = evrExtract(v)
+		if err != nil {
+			return ret, fmt.Errorf("value %q is not a valid version", s)
+		}
+	default:
+		return ret, fmt.Errorf("unknown value type %q", typ)
+	}
+	return ret, nil
+}
+
+// Return -1, 0 or 1 if v is less than, equal to or greater than w, which
+// must be of the same type. Bool values are either equal (0) or not (1).
+func (v typedValue) compare(w typedValue) (int, error) {
+	if v.typ != w.typ {
+		return 0, fmt.Errorf("can not compare %v value with %v value", v.typ, w.typ)
+	}
+	switch v.typ {
+	case ValueInt:
+		if v.num < w.num {
+			return -1, nil
+		} else if v.num > w.num {
+			return 1, nil
+		}
+		return 0, nil
+	case ValueBool:
+		if v.flag == w.flag {
+			return 0, nil
+		}
+		return 1, nil
+	case ValueVersion:
+		// evrRpmCompare returns 1 if the first version is less than the
+		// second, and -1 if it is greater.
+		r, err := evrRpmCompare(v.ver, w.ver)
+		if err != nil {
+			return 0, err
+		}
+		return -r, nil
+	}
+	return strings.Compare(v.str, w.str), nil
+}
@@ -0,0 +1,160 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+// Waiver describes an exception for a test. If a test with an active waiver
+// fails, the result is reported as waived rather than as a failure. A
+// waiver is active until the Expires date (in YYYY-MM-DD format) has
+// passed.
+type Waiver struct {
+	TestID        string `json:"test" yaml:"test"`
+	Justification string `json:"justification" yaml:"justification"`
+	Expires       string `json:"expires" yaml:"expires"`
+
+	expires time.Time
+}
+
+// Waivers is a list of waivers, as loaded from a waivers file using
+// LoadWaivers(). Waivers are kept separate from policy documents, so
+// exceptions are tracked explicitly rather than by editing tests out of the
+// policy.
+//
+// The waiver file is a JSON document containing the list of waivers, and a
+// base64 encoded ed25519 signature over the JSON encoding of the list.
+type Waivers struct {
+	Waivers   []Waiver `json:"waivers"`
+	Signature string   `json:"signature,omitempty"`
+}
+
+const waiverDateFormat = "2006-01-02"
+
+func (w *Waiver) validate() (err error) {
+	if len(w.TestID) == 0 {
+		return fmt.Errorf("waiver has no test identifier")
+	}
+	if len(w.Justification) == 0 {
+		return fmt.Errorf("waiver for %v has no justification", w.TestID)
+	}
+	w.expires, err = time.Parse(waiverDateFormat, w.Expires)
+	if err != nil {
+		return fmt.Errorf("waiver for %v has invalid expiry: %v", w.TestID, err)
+	}
+	return nil
+}
+
+// Returns true if the waiver has not expired at time t. Waivers are valid
+// up to and including the expiry date.
+func (w *Waiver) active(t time.Time) bool {
+	return t.Before(w.expires.AddDate(0, 0, 1))
+}
+
+func (w *Waivers) signedPayload() ([]byte, error) {
+	return json.Marshal(w.Waivers)
+}
+
+// Sign signs the waivers using the ed25519 private key key, setting the
+// Signature field.
+func (w *Waivers) Sign(key ed25519.PrivateKey) error {
+	buf, err := w.signedPayload()
+	if err != nil {
+		return err
+	}
+	w.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, buf))
+	return nil
+}
+
+// LoadWaivers loads a waivers file from the reader specified by r, and
+// verifies the signature in the waivers file using the ed25519 public key
+// key. An error is returned if key is nil or the signature is missing or
+// invalid, so tests can only be waived by the holder of the private key.
+func LoadWaivers(r io.Reader, key ed25519.PublicKey) (Waivers, error) {
+	if key == nil {
+		return Waivers{}, fmt.Errorf("a public key is required to verify waivers")
+	}
+	return loadWaivers(r, key)
+}
+
+// LoadUnsignedWaivers loads a waivers file from the reader specified by r
+// without verifying the signature. Anyone able to modify an unsigned
+// waivers file can waive any test, so this should only be used when
+// developing waivers.
+func LoadUnsignedWaivers(r io.Reader) (Waivers, error) {
+	return loadWaivers(r, nil)
+}
+
+func loadWaivers(r io.Reader, key ed25519.PublicKey) (Waivers, error) {
+	var ret Waivers
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return ret, err
+	}
+	err = json.Unmarshal(buf, &ret)
+	if err != nil {
+		return ret, err
+	}
+	for i := range ret.Waivers {
+		err = ret.Waivers[i].validate()
+		if err != nil {
+			return ret, err
+		}
+	}
+	if key != nil {
+		if ret.Signature == "" {
+			return ret, fmt.Errorf("waivers file is not signed")
+		}
+		sig, err := base64.StdEncoding.DecodeString(ret.Signature)
+		if err != nil {
+			return ret, err
+		}
+		payload, err := ret.signedPayload()
+		if err != nil {
+			return ret, err
+		}
+		if !ed25519.Verify(key, payload, sig) {
+			return ret, fmt.Errorf("waivers file signature is invalid")
+		}
+	}
+	debugPrint("loaded %v waiver(s)\n", len(ret.Waivers))
+	return ret, nil
+}
+
+// SetWaivers installs waivers that will be applied when results are
+// returned using GetResults(). Passing nil removes any installed waivers.
+func SetWaivers(w *Waivers) {
+	sRuntime.waivers = w
+}
+
+// Return the active waiver for a test, or nil if the test is not waived.
+func getWaiver(testid string) *Waiver {
+	if sRuntime.waivers == nil {
+		return nil
+	}
+	now := time.Now()
+	for i := range sRuntime.waivers.Waivers {
+		w := &sRuntime.waivers.Waivers[i]
+		if w.TestID != testid {
+			continue
+		}
+		if !w.active(now) {
+			debugPrint("getWaiver(): waiver for %v expired on %v\n", testid, w.Expires)
+			continue
+		}
+		return w
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/mozilla/scribe"
+)
+
+// Used in TestWaivers, test1 fails as the result does not match the
+// expected result.
+var waiverPolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "raw",
+		"raw": {
+			"identifiers": [
+			{
+				"identifier": "test",
+				"value": "value"
+			}
+			]
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "test1",
+		"object": "raw",
+		"expectedresult": false
+	},
+
+	{
+		"test": "test2",
+		"object": "raw",
+		"expectedresult": false
+	}
+	]
+}
+`
+
+func TestWaivers(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey: %v", err)
+	}
+	w := scribe.Waivers{Waivers: []scribe.Waiver{
+		{TestID: "test1", Justification: "accepted risk", Expires: "2999-01-01"},
+		{TestID: "test2", Justification: "expired", Expires: "2000-01-01"},
+	}}
+	err = w.Sign(priv)
+	if err != nil {
+		t.Fatalf("Waivers.Sign: %v", err)
+	}
+	buf, err := json.Marshal(w)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	loaded, err := scribe.LoadWaivers(bytes.NewReader(buf), pub)
+	if err != nil {
+		t.Fatalf("scribe.LoadWaivers: %v", err)
+	}
+	tampered := strings.Replace(string(buf), "accepted risk", "something else", 1)
+	_, err = scribe.LoadWaivers(strings.NewReader(tampered), pub)
+	if err == nil {
+		t.Fatalf("scribe.LoadWaivers should fail with invalid signature")
+	}
+	_, err = scribe.LoadWaivers(strings.NewReader(tampered), nil)
+	if err == nil {
+		t.Fatalf("scribe.LoadWaivers should fail without public key")
+	}
+	unsigned, err := scribe.LoadUnsignedWaivers(strings.NewReader(tampered))
+	if err != nil || unsigned.Waivers[0].Justification != "something else" {
+		t.Fatalf("scribe.LoadUnsignedWaivers: %v", err)
+	}
+
+	scribe.Bootstrap()
+	scribe.TestHooks(true)
+	scribe.SetWaivers(&loaded)
+	defer scribe.SetWaivers(nil)
+	doc, err := scribe.LoadDocument(strings.NewReader(waiverPolicyDoc))
+	if err != nil {
+		t.Fatalf("scribe.LoadDocument: %v", err)
+	}
+	err = scribe.AnalyzeDocument(doc)
+	if err != nil {
+		t.Fatalf("scribe.AnalyzeDocument: %v", err)
+	}
+	res, err := scribe.GetResults(&doc, "test1")
+	if err != nil {
+		t.Fatalf("scribe.GetResults: %v", err)
+	}
+	if !res.Waived || res.WaiverJustification != "accepted risk" {
+		t.Fatalf("test1 should have been waived")
+	}
+	res, err = scribe.GetResults(&doc, "test2")
+	if err != nil {
+		t.Fatalf("scribe.GetResults: %v", err)
+	}
+	if res.Waived {
+		t.Fatalf("test2 waiver has expired and should not apply")
+	}
+}
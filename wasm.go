@@ -0,0 +1,308 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// WASM is used to run a user supplied WebAssembly module implementing check
+// logic that can not be expressed using the other sources, without giving
+// the check the access to the system a script would have.
+//
+// Module is the path to a WASI module, which is run using the WebAssembly
+// runtime set with SetWASMRuntime() (wasmtime by default). If SHA256 is set,
+// the module is only run if the hex encoded SHA-256 digest of the module
+// matches. The module is copied to a private directory before it is
+// verified, and the copy is run.
+//
+// The module has no access to the system other than the files listed in
+// Files, which are copied into an otherwise empty directory made available
+// to the module as the root file system, so each file can be read by the
+// module at its original path. Args are passed to the module as arguments,
+// and the module has no environment variables.
+//
+// The module returns criteria by writing one JSON object per line to
+// standard output, containing identifier and value strings, for example
+// {"identifier": "/etc/ssh/sshd_config", "value": "yes"}. If the module
+// exits with a non-zero status, or runs for longer than Timeout (a
+// duration such as 10s, 30 seconds by default), the object fails.
+type WASM struct {
+	Module  string   `json:"module,omitempty" yaml:"module,omitempty"`
+	SHA256  string   `json:"sha256,omitempty" yaml:"sha256,omitempty"`
+	Files   []string `json:"files,omitempty" yaml:"files,omitempty"`
+	Args    []string `json:"args,omitempty" yaml:"args,omitempty"`
+	Timeout string   `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+
+	matches []wasmMatch
+}
+
+type wasmMatch struct {
+	Identifier string `json:"identifier"`
+	Value      string `json:"value"`
+}
+
+const (
+	defaultWASMTimeout = 30 * time.Second
+	wasmMaxOutput      = 1 << 20 // The maximum output read from a module.
+	wasmMaxFileSize    = 64 << 20
+)
+
+// SetWASMRuntime sets the WebAssembly runtime used to run modules for the
+// wasm source. The runtime is invoked as
+//
+//	runtime run --dir <root>::/ <module> [args]
+//
+// which is the interface of wasmtime. The default is wasmtime, found using
+// PATH.
+func SetWASMRuntime(path string) {
+	sRuntime.wasmRuntime = path
+}
+
+func (w *WASM) isChain() bool {
+	return false
+}
+
+func (w *WASM) fireChains(d *Document) ([]evaluationCriteria, error) {
+	return nil, nil
+}
+
+func (w *WASM) mergeCriteria(c []evaluationCriteria) {
+}
+
+func (w *WASM) validate(d *Document) error {
+	if w.SHA256 != "" {
+		buf, err := hex.DecodeString(w.SHA256)
+		if err != nil || len(buf) != sha256.Size {
+			return fmt.Errorf("wasm sha256 must be a hex encoded SHA-256 digest")
+		}
+	}
+	for _, x := range w.Files {
+		if !filepath.IsAbs(x) {
+			return fmt.Errorf("wasm file %v must be an absolute path", x)
+		}
+	}
+	_, err := w.timeout()
+	return err
+}
+
+func (w *WASM) timeout() (time.Duration, error) {
+	if w.Timeout == "" {
+		return defaultWASMTimeout, nil
+	}
+	d, err := time.ParseDuration(w.Timeout)
+	if err != nil {
+		return 0, fmt.Errorf("wasm timeout: %v", err)
+	}
+	return d, nil
+}
+
+func (w *WASM) expandVariables(v []Variable) {
+	w.Module = variableExpansion(v, w.Module)
+	for i := range w.Files {
+		w.Files[i] = variableExpansion(v, w.Files[i])
+	}
+	for i := range w.Args {
+		w.Args[i] = variableExpansion(v, w.Args[i])
+	}
+}
+
+func (w *WASM) getCriteria() (ret []evaluationCriteria) {
+	for _, x := range w.matches {
+		n := evaluationCriteria{}
+		n.identifier = x.Identifier
+		n.testValue = x.Value
+		ret = append(ret, n)
+	}
+	return ret
+}
+
+func (w *WASM) prepare() error {
+	debugPrint("prepare(): running wasm module \"%v\"\n", w.Module)
+	timeout, err := w.timeout()
+	if err != nil {
+		return err
+	}
+	// The module is copied into a private directory, outside the directory
+	// given to the module as its root, and only the copy is verified and
+	// run, so the module can not be replaced after it is verified.
+	dir, err := ioutil.TempDir("", "scribe-wasm")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	module := filepath.Join(dir, "module.wasm")
+	digest, err := copyWASMModule(module, w.Module)
+	if err != nil {
+		return err
+	}
+	if w.SHA256 != "" && digest != strings.ToLower(w.SHA256) {
+		return fmt.Errorf("wasm module %v does not match sha256", w.Module)
+	}
+	root := filepath.Join(dir, "root")
+	err = os.Mkdir(root, 0700)
+	if err != nil {
+		return err
+	}
+	for _, x := range w.Files {
+		err = copyWASMFile(root, x)
+		if err != nil {
+			return err
+		}
+	}
+
+	rt := sRuntime.wasmRuntime
+	if rt == "" {
+		rt = "wasmtime"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	args := append([]string{"run", "--dir", root + "::/", module}, w.Args...)
+	cmd := exec.CommandContext(ctx, rt, args...)
+	var stdout, stderr bytes.Buffer
+	out := &limitedBuffer{buf: &stdout, max: wasmMaxOutput}
+	cmd.Stdout = out
+	cmd.Stderr = &limitedBuffer{buf: &stderr, max: wasmMaxOutput}
+	err = cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("wasm module %v did not complete within %v", w.Module, timeout)
+	}
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg != "" {
+			return fmt.Errorf("wasm module %v: %v: %v", w.Module, err, msg)
+		}
+		return fmt.Errorf("wasm module %v: %v", w.Module, err)
+	}
+	if out.truncated {
+		return fmt.Errorf("wasm module %v wrote more than %v bytes", w.Module, wasmMaxOutput)
+	}
+	w.matches, err = parseWASMOutput(stdout.Bytes())
+	if err != nil {
+		return fmt.Errorf("wasm module %v: %v", w.Module, err)
+	}
+	return nil
+}
+
+// Copy the module at path to dst, returning the hex encoded SHA-256 digest
+// of the copy.
+func copyWASMModule(dst string, path string) (string, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0400)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(out, h), src)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Copy the file at path into root at the same path, so the module can read
+// it without access to anything else. Files that do not exist are skipped,
+// so the module can check for their absence.
+func copyWASMFile(root string, path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer src.Close()
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("wasm file %v is not a regular file", path)
+	}
+	if fi.Size() > wasmMaxFileSize {
+		return fmt.Errorf("wasm file %v is too large", path)
+	}
+	dst := filepath.Join(root, strings.TrimPrefix(filepath.Clean(path), filepath.VolumeName(path)))
+	err = os.MkdirAll(filepath.Dir(dst), 0700)
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0400)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, src)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Parse the criteria written by a module, one JSON object per line.
+func parseWASMOutput(buf []byte) ([]wasmMatch, error) {
+	ret := make([]wasmMatch, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	scanner.Buffer(make([]byte, 0, 64*1024), wasmMaxOutput)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var m wasmMatch
+		err := json.Unmarshal(line, &m)
+		if err != nil {
+			return nil, fmt.Errorf("invalid criteria %q: %v", line, err)
+		}
+		if m.Identifier == "" {
+			return nil, fmt.Errorf("criteria %q has no identifier", line)
+		}
+		ret = append(ret, m)
+	}
+	return ret, scanner.Err()
+}
+
+// limitedBuffer discards writes once max bytes have been written, so a
+// misbehaving module can not exhaust memory.
+type limitedBuffer struct {
+	buf       *bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (l *limitedBuffer) Write(p []byte) (int, error) {
+	n := l.max - l.buf.Len()
+	if len(p) > n {
+		l.truncated = true
+		if n > 0 {
+			l.buf.Write(p[:n])
+		}
+		return len(p), nil
+	}
+	l.buf.Write(p)
+	return len(p), nil
+}
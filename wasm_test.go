@@ -0,0 +1,82 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/mozilla/scribe"
+)
+
+// Used in TestWASM, the paths are filled in by the test
+var wasmPolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "sshd-settings",
+		"wasm": {
+			"module": %[1]q,
+			"sha256": "93a44bbb96c751218e4c00d479e4c14358122a389acca16205b1e4d0dc5f9476",
+			"files": [ %[2]q ],
+			"args": [ %[2]q, "PermitRootLogin", "PasswordAuthentication" ]
+		}
+	},
+
+	{
+		"object": "tampered",
+		"wasm": {
+			"module": %[1]q,
+			"sha256": "0000000000000000000000000000000000000000000000000000000000000000"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "wasm0",
+		"expectedresult": true,
+		"object": "sshd-settings",
+		"exactmatch": {
+			"value": "no"
+		}
+	},
+
+	{
+		"test": "wasm1",
+		"expecterror": true,
+		"object": "tampered"
+	}
+	]
+}
+`
+
+func TestWASM(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test runtime is a shell script")
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("os.Getwd: %v", err)
+	}
+	dir = filepath.Join(dir, "test", "wasm")
+	scribe.SetWASMRuntime(filepath.Join(dir, "runtime.sh"))
+	defer scribe.SetWASMRuntime("")
+	doc := genericTestExec(t, fmt.Sprintf(wasmPolicyDoc, filepath.Join(dir, "check.wasm"), filepath.Join(dir, "sshd_config")))
+	e, err := doc.ExplainTest("wasm0")
+	if err != nil {
+		t.Fatalf("Document.ExplainTest: %v", err)
+	}
+	if len(e.Criteria) != 2 || e.Criteria[0].Identifier != "PermitRootLogin" || e.Criteria[0].Value != "no" ||
+		e.Criteria[1].Identifier != "PasswordAuthentication" || e.Criteria[1].Value != "yes" {
+		t.Fatalf("unexpected criteria %+v", e.Criteria)
+	}
+}
@@ -0,0 +1,257 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WinEvent is used to perform tests against events in the Windows Event
+// Log, for example to verify audit policy changes have not been made. On
+// other platforms no criteria are returned.
+//
+// Channel is the log to query, such as Security or System. Events can be
+// restricted to those logged by Provider, to the event identifiers in
+// EventIDs, and to those logged within Since of the time the object is
+// prepared, as a duration such as 24h (the default). Channel and Provider
+// can contain letters, digits, spaces and the characters . _ / and -.
+//
+// Property specifies what is returned as the test value, and can be one
+// of:
+//
+// count: the number of matching events. If EventIDs is set a criteria is
+// returned for each event identifier with an identifier of the form
+// channel:id, including identifiers with no events; otherwise a single
+// criteria with the channel as the identifier is returned.
+//
+// message: the rendered message of each matching event
+//
+// field: the value of the event data field named Field in each matching
+// event, such as SubjectUserName
+//
+// For message and field the identifier for each criteria is of the form
+// channel:id:record, record being the event record number.
+type WinEvent struct {
+	Channel  string `json:"channel,omitempty" yaml:"channel,omitempty"`
+	Provider string `json:"provider,omitempty" yaml:"provider,omitempty"`
+	EventIDs []int  `json:"eventids,omitempty" yaml:"eventids,omitempty"`
+	Since    string `json:"since,omitempty" yaml:"since,omitempty"`
+	Property string `json:"property,omitempty" yaml:"property,omitempty"`
+	Field    string `json:"field,omitempty" yaml:"field,omitempty"`
+
+	matches []winEventMatch
+}
+
+type winEventMatch struct {
+	identifier string
+	value      string
+}
+
+type winEventInfo struct {
+	RecordID int64
+	ID       int
+	Provider string
+	Time     time.Time
+	Message  string
+	Data     map[string]string
+}
+
+// Channel and provider names are limited to characters found in event log
+// names, as they are passed to PowerShell.
+var winEventName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9 ._/-]*$`)
+
+// The default time window for event log queries.
+const winEventDefaultSince = 24 * time.Hour
+
+func (w *WinEvent) isChain() bool {
+	return false
+}
+
+func (w *WinEvent) fireChains(d *Document) ([]evaluationCriteria, error) {
+	return nil, nil
+}
+
+func (w *WinEvent) mergeCriteria(c []evaluationCriteria) {
+}
+
+func (w *WinEvent) validate(d *Document) error {
+	if !winEventName.MatchString(w.Channel) {
+		return fmt.Errorf("winevent channel %q is not valid", w.Channel)
+	}
+	if w.Provider != "" && !winEventName.MatchString(w.Provider) {
+		return fmt.Errorf("winevent provider %q is not valid", w.Provider)
+	}
+	switch w.Property {
+	case "count", "message":
+	case "field":
+		if w.Field == "" {
+			return fmt.Errorf("winevent field must be set for property field")
+		}
+	default:
+		return fmt.Errorf("winevent property must be count, message or field")
+	}
+	for _, x := range w.EventIDs {
+		if x < 0 || x > 65535 {
+			return fmt.Errorf("winevent event identifier %v is not valid", x)
+		}
+	}
+	_, err := w.since()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (w *WinEvent) since() (time.Duration, error) {
+	if w.Since == "" {
+		return winEventDefaultSince, nil
+	}
+	d, err := time.ParseDuration(w.Since)
+	if err != nil {
+		return 0, fmt.Errorf("winevent since: %v", err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("winevent since must be positive")
+	}
+	return d, nil
+}
+
+func (w *WinEvent) expandVariables(v []Variable) {
+}
+
+func (w *WinEvent) getCriteria() (ret []evaluationCriteria) {
+	for _, x := range w.matches {
+		n := evaluationCriteria{}
+		n.identifier = x.identifier
+		n.testValue = x.value
+		ret = append(ret, n)
+	}
+	return ret
+}
+
+// Return true if the event matches the filters of the object, start being
+// the beginning of the time window.
+func (w *WinEvent) matchEvent(e winEventInfo, start time.Time) bool {
+	if w.Provider != "" && !strings.EqualFold(w.Provider, e.Provider) {
+		return false
+	}
+	if e.Time.Before(start) {
+		return false
+	}
+	if len(w.EventIDs) == 0 {
+		return true
+	}
+	for _, x := range w.EventIDs {
+		if x == e.ID {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *WinEvent) prepare() error {
+	debugPrint("prepare(): querying event log channel \"%v\", property \"%v\"\n", w.Channel, w.Property)
+	since, err := w.since()
+	if err != nil {
+		return err
+	}
+	start := time.Now().Add(-since)
+	events, err := getWinEvents(w, start)
+	if err != nil {
+		return err
+	}
+	counts := make(map[int]int)
+	total := 0
+	for _, x := range events {
+		if !w.matchEvent(x, start) {
+			continue
+		}
+		counts[x.ID]++
+		total++
+		id := fmt.Sprintf("%v:%v:%v", w.Channel, x.ID, x.RecordID)
+		switch w.Property {
+		case "message":
+			w.matches = append(w.matches, winEventMatch{id, x.Message})
+		case "field":
+			if v, ok := x.Data[w.Field]; ok {
+				w.matches = append(w.matches, winEventMatch{id, v})
+			}
+		}
+	}
+	if w.Property != "count" {
+		return nil
+	}
+	if len(w.EventIDs) == 0 {
+		w.matches = append(w.matches, winEventMatch{w.Channel, fmt.Sprintf("%v", total)})
+		return nil
+	}
+	ids := append([]int{}, w.EventIDs...)
+	sort.Ints(ids)
+	for i, x := range ids {
+		if i > 0 && ids[i-1] == x {
+			continue
+		}
+		w.matches = append(w.matches, winEventMatch{fmt.Sprintf("%v:%v", w.Channel, x),
+			fmt.Sprintf("%v", counts[x])})
+	}
+	return nil
+}
+
+func getWinEvents(w *WinEvent, start time.Time) ([]winEventInfo, error) {
+	if sRuntime.testHooks {
+		return testWinEvents(w.Channel), nil
+	}
+	return winEventList(w.Channel, w.Provider, w.EventIDs, start)
+}
+
+// Functions and data related to Windows event log tests
+
+func testWinEvents(channel string) []winEventInfo {
+	if !strings.EqualFold(channel, "Security") {
+		return nil
+	}
+	now := time.Now()
+	return []winEventInfo{
+		{
+			RecordID: 1001,
+			ID:       4719,
+			Provider: "Microsoft-Windows-Security-Auditing",
+			Time:     now.Add(-48 * time.Hour),
+			Message:  "System audit policy was changed.",
+			Data:     map[string]string{"SubjectUserName": "admin"},
+		},
+		{
+			RecordID: 1002,
+			ID:       4625,
+			Provider: "Microsoft-Windows-Security-Auditing",
+			Time:     now.Add(-2 * time.Hour),
+			Message:  "An account failed to log on.",
+			Data:     map[string]string{"TargetUserName": "Administrator"},
+		},
+		{
+			RecordID: 1003,
+			ID:       4625,
+			Provider: "Microsoft-Windows-Security-Auditing",
+			Time:     now.Add(-time.Hour),
+			Message:  "An account failed to log on.",
+			Data:     map[string]string{"TargetUserName": "guest"},
+		},
+		{
+			RecordID: 1004,
+			ID:       1102,
+			Provider: "Microsoft-Windows-Eventlog",
+			Time:     now.Add(-30 * time.Minute),
+			Message:  "The audit log was cleared.",
+			Data:     map[string]string{"SubjectUserName": "admin"},
+		},
+	}
+}
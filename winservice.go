@@ -0,0 +1,169 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"fmt"
+	"strings"
+)
+
+// WinService is used to perform tests against services installed on
+// Windows systems. On other platforms no criteria are returned.
+//
+// Property specifies which property of each service is returned as the test
+// value, and can be one of:
+//
+// starttype: the start type of the service (auto, manual, disabled, boot or
+// system)
+//
+// account: the account the service runs as, for example LocalSystem
+//
+// binarypath: the command line used to start the service
+//
+// state: the current state of the service, for example running or stopped
+//
+// The identifier for each criteria is the service name. If Name is set, only
+// services with a name matching this regular expression are included.
+type WinService struct {
+	Property string `json:"property,omitempty" yaml:"property,omitempty"`
+	Name     string `json:"name,omitempty" yaml:"name,omitempty"`
+
+	nameRe  compiledRegexp
+	matches []winServiceMatch
+}
+
+type winServiceMatch struct {
+	name  string
+	value string
+}
+
+type winServiceInfo struct {
+	Name       string
+	StartType  string
+	Account    string
+	BinaryPath string
+	State      string
+}
+
+func (w *WinService) isChain() bool {
+	return false
+}
+
+func (w *WinService) fireChains(d *Document) ([]evaluationCriteria, error) {
+	return nil, nil
+}
+
+func (w *WinService) mergeCriteria(c []evaluationCriteria) {
+}
+
+func (w *WinService) validate(d *Document) error {
+	switch w.Property {
+	case "starttype", "account", "binarypath", "state":
+	default:
+		return fmt.Errorf("winservice property must be starttype, account, binarypath or state")
+	}
+	_, err := w.nameRe.compile(w.Name)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (w *WinService) expandVariables(v []Variable) {
+}
+
+func (w *WinService) getCriteria() (ret []evaluationCriteria) {
+	for _, x := range w.matches {
+		n := evaluationCriteria{}
+		n.identifier = x.name
+		n.testValue = x.value
+		ret = append(ret, n)
+	}
+	return ret
+}
+
+func (w *WinService) prepare() error {
+	debugPrint("prepare(): inspecting services, property \"%v\"\n", w.Property)
+	re, err := w.nameRe.compile(w.Name)
+	if err != nil {
+		return err
+	}
+	services, err := getWinServices()
+	if err != nil {
+		return err
+	}
+	for _, x := range services {
+		if !re.MatchString(x.Name) {
+			continue
+		}
+		var v string
+		switch w.Property {
+		case "starttype":
+			v = x.StartType
+		case "account":
+			v = x.Account
+		case "binarypath":
+			v = x.BinaryPath
+		case "state":
+			v = x.State
+		}
+		w.matches = append(w.matches, winServiceMatch{x.Name, v})
+	}
+	return nil
+}
+
+func getWinServices() ([]winServiceInfo, error) {
+	if sRuntime.testHooks {
+		return testWinServices, nil
+	}
+	ret, err := winServiceList()
+	if err != nil {
+		return nil, err
+	}
+	for i := range ret {
+		ret[i].StartType = winServiceStartType(ret[i].StartType)
+		ret[i].State = strings.ToLower(ret[i].State)
+	}
+	return ret, nil
+}
+
+// Normalize the start mode reported by WMI to the names used in service
+// configuration (Auto is reported for automatic start services).
+func winServiceStartType(s string) string {
+	s = strings.ToLower(s)
+	if s == "automatic" {
+		return "auto"
+	}
+	return s
+}
+
+// Functions and data related to Windows service tests
+
+var testWinServices = []winServiceInfo{
+	{
+		Name:       "RemoteRegistry",
+		StartType:  "disabled",
+		Account:    "NT AUTHORITY\\LocalService",
+		BinaryPath: "C:\\Windows\\system32\\svchost.exe -k localService -p",
+		State:      "stopped",
+	},
+	{
+		Name:       "W32Time",
+		StartType:  "auto",
+		Account:    "NT AUTHORITY\\LocalService",
+		BinaryPath: "C:\\Windows\\system32\\svchost.exe -k LocalService",
+		State:      "running",
+	},
+	{
+		Name:       "backupagent",
+		StartType:  "auto",
+		Account:    "LocalSystem",
+		BinaryPath: "C:\\Program Files\\Backup\\agent.exe --service",
+		State:      "running",
+	},
+}
@@ -0,0 +1,29 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+//go:build !windows
+// +build !windows
+
+package scribe
+
+import (
+	"time"
+)
+
+// Services, scheduled tasks and event log entries are only collected on
+// Windows, on other platforms objects using them return no criteria.
+func winServiceList() ([]winServiceInfo, error) {
+	return nil, nil
+}
+
+func winTaskList() ([]winTaskInfo, error) {
+	return nil, nil
+}
+
+func winEventList(channel string, provider string, ids []int, start time.Time) ([]winEventInfo, error) {
+	return nil, nil
+}
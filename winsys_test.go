@@ -0,0 +1,241 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mozilla/scribe"
+)
+
+// Used in TestWinServicePolicy
+var winServicePolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "remote-registry",
+		"winservice": {
+			"property": "starttype",
+			"name": "^RemoteRegistry$"
+		}
+	},
+
+	{
+		"object": "service-accounts",
+		"winservice": {
+			"property": "account"
+		}
+	},
+
+	{
+		"object": "service-paths",
+		"winservice": {
+			"property": "binarypath"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "winservice0",
+		"expectedresult": true,
+		"object": "remote-registry",
+		"exactmatch": {
+			"value": "disabled"
+		}
+	},
+
+	{
+		"test": "winservice1",
+		"expectedresult": true,
+		"object": "service-accounts",
+		"exactmatch": {
+			"value": "LocalSystem"
+		}
+	},
+
+	{
+		"test": "winservice2",
+		"expectedresult": false,
+		"object": "service-paths",
+		"regexp": {
+			"value": "^C:\\\\Users\\\\"
+		}
+	}
+	]
+}
+`
+
+func TestWinServicePolicy(t *testing.T) {
+	genericTestExec(t, winServicePolicyDoc)
+}
+
+// Used in TestWinTaskPolicy
+var winTaskPolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "task-commands",
+		"wintask": {
+			"property": "command"
+		}
+	},
+
+	{
+		"object": "defrag-state",
+		"wintask": {
+			"property": "state",
+			"name": "\\\\Defrag\\\\"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "wintask0",
+		"expectedresult": true,
+		"object": "task-commands",
+		"regexp": {
+			"value": "^C:\\\\Users\\\\"
+		}
+	},
+
+	{
+		"test": "wintask1",
+		"expectedresult": true,
+		"object": "defrag-state",
+		"exactmatch": {
+			"value": "ready"
+		}
+	}
+	]
+}
+`
+
+func TestWinTaskPolicy(t *testing.T) {
+	genericTestExec(t, winTaskPolicyDoc)
+}
+
+// Used in TestWinEventPolicy
+var winEventPolicyDoc = `
+{
+	"objects": [
+	{
+		"object": "audit-events",
+		"winevent": {
+			"channel": "Security",
+			"eventids": [ 4719, 1102 ],
+			"property": "count"
+		}
+	},
+
+	{
+		"object": "failed-logons",
+		"winevent": {
+			"channel": "Security",
+			"provider": "Microsoft-Windows-Security-Auditing",
+			"eventids": [ 4625 ],
+			"since": "90m",
+			"property": "field",
+			"field": "TargetUserName"
+		}
+	},
+
+	{
+		"object": "system-events",
+		"winevent": {
+			"channel": "System",
+			"property": "count"
+		}
+	}
+	],
+
+	"tests": [
+	{
+		"test": "winevent0",
+		"expectedresult": true,
+		"object": "audit-events",
+		"compare": {
+			"type": "int",
+			"operation": ">",
+			"value": "0"
+		}
+	},
+
+	{
+		"test": "winevent1",
+		"expectedresult": true,
+		"object": "failed-logons",
+		"exactmatch": {
+			"value": "guest"
+		}
+	},
+
+	{
+		"test": "winevent2",
+		"expectedresult": false,
+		"object": "failed-logons",
+		"exactmatch": {
+			"value": "Administrator"
+		}
+	},
+
+	{
+		"test": "winevent3",
+		"expectedresult": true,
+		"object": "system-events",
+		"exactmatch": {
+			"value": "0"
+		}
+	}
+	]
+}
+`
+
+func TestWinEventPolicy(t *testing.T) {
+	doc := genericTestExec(t, winEventPolicyDoc)
+	tr, err := scribe.GetResults(doc, "winevent0")
+	if err != nil {
+		t.Fatalf("scribe.GetResults: %v", err)
+	}
+	// The audit policy change is outside the default time window.
+	for _, x := range tr.Results {
+		want := x.Identifier == "Security:1102"
+		if x.Result != want {
+			t.Fatalf("unexpected winevent result for %v: %v", x.Identifier, x.Result)
+		}
+	}
+	if len(tr.Results) != 2 {
+		t.Fatalf("expected a count for each event identifier, got %v", len(tr.Results))
+	}
+}
+
+func TestWinEventValidate(t *testing.T) {
+	scribe.Bootstrap()
+	for _, x := range []string{
+		`"channel": ""`,
+		`"channel": "Security'; Remove-Item C:\\x; '"`,
+		`"channel": "Security\u2019; Remove-Item C:\\x; \u2019"`,
+		`"channel": "Security", "provider": "x\u2018)"`,
+		`"channel": "-Security"`,
+	} {
+		doc := fmt.Sprintf(`{"objects": [{"object": "events", "winevent": {%v, "property": "count"}}]}`, x)
+		_, err := scribe.LoadDocument(strings.NewReader(doc))
+		if err == nil {
+			t.Fatalf("%v: expected validation error", x)
+		}
+	}
+	doc := `{"objects": [{"object": "events", "winevent": {"channel": "Microsoft-Windows-Sysmon/Operational", ` +
+		`"provider": "Microsoft-Windows-Sysmon", "property": "count"}}]}`
+	_, err := scribe.LoadDocument(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("scribe.LoadDocument: %v", err)
+	}
+}
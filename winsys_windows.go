@@ -0,0 +1,115 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+//go:build windows
+// +build windows
+
+package scribe
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const winServiceScript = `Get-CimInstance Win32_Service | ForEach-Object {
+[pscustomobject]@{Name=$_.Name; StartType=$_.StartMode; Account=$_.StartName;
+BinaryPath=$_.PathName; State=$_.State} } | ConvertTo-Json -Compress`
+
+const winTaskScript = `Get-ScheduledTask | ForEach-Object {
+[pscustomobject]@{Path=$_.TaskPath + $_.TaskName; State=[string]$_.State;
+RunAs=$_.Principal.UserId; Author=$_.Author;
+Commands=@($_.Actions | Where-Object { $_.Execute } |
+ForEach-Object { ($_.Execute + ' ' + $_.Arguments).Trim() })} } |
+ConvertTo-Json -Compress`
+
+// The filter hash table is inserted before the pipeline. Event data fields
+// without a name are omitted.
+const winEventScript = ` | ForEach-Object {
+$x = [xml]$_.ToXml(); $d = @{};
+foreach ($e in $x.Event.EventData.Data) { if ($e.Name) { $d[$e.Name] = [string]$e.'#text' } };
+[pscustomobject]@{RecordID=$_.RecordId; ID=$_.Id; Provider=$_.ProviderName;
+Time=$_.TimeCreated.ToUniversalTime().ToString('o'); Message=$_.Message; Data=$d} } |
+ConvertTo-Json -Compress -Depth 3`
+
+// Quote s as a PowerShell single quoted string. PowerShell also treats the
+// typographic single quotes as quotes, so each is doubled as well.
+func powershellQuote(s string) string {
+	var b strings.Builder
+	b.WriteByte('\'')
+	for _, c := range s {
+		switch c {
+		case '\'', '\u2018', '\u2019', '\u201a', '\u201b':
+			b.WriteRune(c)
+		}
+		b.WriteRune(c)
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
+
+// Run a PowerShell script producing JSON output, decoding the output into
+// v which must be a pointer to a slice. ConvertTo-Json produces an object
+// rather than an array if there is a single result, this is handled by
+// wrapping the output in an array.
+func powershellJSON(script string, v interface{}) error {
+	buf, err := exec.Command("powershell.exe", "-NoProfile", "-NonInteractive",
+		"-Command", script).Output()
+	if err != nil {
+		return err
+	}
+	buf = bytes.TrimSpace(buf)
+	if len(buf) == 0 {
+		return nil
+	}
+	if buf[0] == '{' {
+		buf = append(append([]byte{'['}, buf...), ']')
+	}
+	return json.Unmarshal(buf, v)
+}
+
+func winServiceList() ([]winServiceInfo, error) {
+	var ret []winServiceInfo
+	err := powershellJSON(winServiceScript, &ret)
+	return ret, err
+}
+
+func winTaskList() ([]winTaskInfo, error) {
+	var ret []winTaskInfo
+	err := powershellJSON(winTaskScript, &ret)
+	if err != nil {
+		return nil, err
+	}
+	for i := range ret {
+		ret[i].Path = strings.TrimSpace(ret[i].Path)
+	}
+	return ret, nil
+}
+
+func winEventList(channel string, provider string, ids []int, start time.Time) ([]winEventInfo, error) {
+	filter := fmt.Sprintf("LogName=%v; StartTime=[datetime]::Parse(%v).ToLocalTime()",
+		powershellQuote(channel), powershellQuote(start.UTC().Format(time.RFC3339)))
+	if provider != "" {
+		filter += "; ProviderName=" + powershellQuote(provider)
+	}
+	if len(ids) > 0 {
+		l := make([]string, 0, len(ids))
+		for _, x := range ids {
+			l = append(l, fmt.Sprintf("%v", x))
+		}
+		filter += "; Id=" + strings.Join(l, ",")
+	}
+	// Get-WinEvent reports an error if no events match, so errors are
+	// ignored; a channel that does not exist returns no events.
+	script := "Get-WinEvent -ErrorAction SilentlyContinue -FilterHashtable @{" + filter + "}" + winEventScript
+	var ret []winEventInfo
+	err := powershellJSON(script, &ret)
+	return ret, err
+}
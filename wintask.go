@@ -0,0 +1,152 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"fmt"
+	"strings"
+)
+
+// WinTask is used to perform tests against scheduled tasks on Windows
+// systems. On other platforms no criteria are returned.
+//
+// Property specifies which property of each task is returned as the test
+// value, and can be one of:
+//
+// state: the state of the task (ready, disabled, running or queued)
+//
+// runas: the account the task runs as
+//
+// author: the author of the task
+//
+// command: each action executed by the task, including arguments; a
+// criteria is returned for each action
+//
+// The identifier for each criteria is the full path of the task, for example
+// \Microsoft\Windows\Defrag\ScheduledDefrag. If Name is set, only tasks with
+// a path matching this regular expression are included.
+type WinTask struct {
+	Property string `json:"property,omitempty" yaml:"property,omitempty"`
+	Name     string `json:"name,omitempty" yaml:"name,omitempty"`
+
+	nameRe  compiledRegexp
+	matches []winTaskMatch
+}
+
+type winTaskMatch struct {
+	path  string
+	value string
+}
+
+type winTaskInfo struct {
+	Path     string
+	State    string
+	RunAs    string
+	Author   string
+	Commands []string
+}
+
+func (w *WinTask) isChain() bool {
+	return false
+}
+
+func (w *WinTask) fireChains(d *Document) ([]evaluationCriteria, error) {
+	return nil, nil
+}
+
+func (w *WinTask) mergeCriteria(c []evaluationCriteria) {
+}
+
+func (w *WinTask) validate(d *Document) error {
+	switch w.Property {
+	case "state", "runas", "author", "command":
+	default:
+		return fmt.Errorf("wintask property must be state, runas, author or command")
+	}
+	_, err := w.nameRe.compile(w.Name)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (w *WinTask) expandVariables(v []Variable) {
+}
+
+func (w *WinTask) getCriteria() (ret []evaluationCriteria) {
+	for _, x := range w.matches {
+		n := evaluationCriteria{}
+		n.identifier = x.path
+		n.testValue = x.value
+		ret = append(ret, n)
+	}
+	return ret
+}
+
+func (w *WinTask) prepare() error {
+	debugPrint("prepare(): inspecting scheduled tasks, property \"%v\"\n", w.Property)
+	re, err := w.nameRe.compile(w.Name)
+	if err != nil {
+		return err
+	}
+	tasks, err := getWinTasks()
+	if err != nil {
+		return err
+	}
+	for _, x := range tasks {
+		if !re.MatchString(x.Path) {
+			continue
+		}
+		switch w.Property {
+		case "state":
+			w.matches = append(w.matches, winTaskMatch{x.Path, x.State})
+		case "runas":
+			w.matches = append(w.matches, winTaskMatch{x.Path, x.RunAs})
+		case "author":
+			w.matches = append(w.matches, winTaskMatch{x.Path, x.Author})
+		case "command":
+			for _, y := range x.Commands {
+				w.matches = append(w.matches, winTaskMatch{x.Path, y})
+			}
+		}
+	}
+	return nil
+}
+
+func getWinTasks() ([]winTaskInfo, error) {
+	if sRuntime.testHooks {
+		return testWinTasks, nil
+	}
+	ret, err := winTaskList()
+	if err != nil {
+		return nil, err
+	}
+	for i := range ret {
+		ret[i].State = strings.ToLower(ret[i].State)
+	}
+	return ret, nil
+}
+
+// Functions and data related to Windows scheduled task tests
+
+var testWinTasks = []winTaskInfo{
+	{
+		Path:     "\\Microsoft\\Windows\\Defrag\\ScheduledDefrag",
+		State:    "ready",
+		RunAs:    "SYSTEM",
+		Author:   "Microsoft Corporation",
+		Commands: []string{"%windir%\\system32\\defrag.exe -c -h -o -$"},
+	},
+	{
+		Path:     "\\Updater",
+		State:    "ready",
+		RunAs:    "Administrator",
+		Author:   "EXAMPLE\\admin",
+		Commands: []string{"C:\\Users\\Public\\update.exe", "cmd.exe /c del C:\\Temp\\*"},
+	},
+}
@@ -0,0 +1,57 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+//go:build linux
+// +build linux
+
+package scribe
+
+import (
+	"bytes"
+	"syscall"
+)
+
+// Return the extended attributes of the file at path, by name. Attributes
+// that can not be read, for example trusted attributes when not running as
+// root, are omitted.
+func fileXattrs(path string) (map[string][]byte, error) {
+	ret := make(map[string][]byte)
+	sz, err := syscall.Listxattr(path, nil)
+	if err != nil {
+		if err == syscall.ENOTSUP {
+			return ret, nil
+		}
+		return nil, err
+	}
+	if sz == 0 {
+		return ret, nil
+	}
+	buf := make([]byte, sz)
+	sz, err = syscall.Listxattr(path, buf)
+	if err != nil {
+		return nil, err
+	}
+	for _, x := range bytes.Split(buf[:sz], []byte{0}) {
+		if len(x) == 0 {
+			continue
+		}
+		name := string(x)
+		vsz, err := syscall.Getxattr(path, name, nil)
+		if err != nil {
+			continue
+		}
+		v := make([]byte, vsz)
+		if vsz > 0 {
+			vsz, err = syscall.Getxattr(path, name, v)
+			if err != nil {
+				continue
+			}
+		}
+		ret[name] = v[:vsz]
+	}
+	return ret, nil
+}
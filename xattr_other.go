@@ -0,0 +1,17 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+//go:build !linux
+// +build !linux
+
+package scribe
+
+// Extended attributes are only collected on Linux, on other platforms
+// files have none.
+func fileXattrs(path string) (map[string][]byte, error) {
+	return map[string][]byte{}, nil
+}
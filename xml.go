@@ -0,0 +1,421 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package scribe
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// XML is used to perform tests against values in XML files, such as the
+// server.xml and web.xml files used by Java application servers.
+//
+// Files are located using Path and File in the same way as for FileName.
+// XPath selects the nodes in the file, and supports the following subset of
+// XPath:
+//
+// /name selects child elements, and //name selects descendant elements. *
+// matches any element. Namespace prefixes are ignored when matching
+// element names.
+//
+// A step can have predicates, [n] selects the nth matching element
+// (starting at 1), [@attr] selects elements with the attribute, [@attr='v']
+// elements where the attribute has the value v, and [name='v'] elements
+// with a child element with text v.
+//
+// The final step can be @attr to select the value of an attribute, or
+// text() to select the text of an element.
+//
+// For example /Server/Service/Connector[@protocol='HTTP/1.1']/@port returns
+// the port of each HTTP connector in a tomcat server.xml. If an element is
+// selected, the test value is the text directly contained in the element,
+// with leading and trailing white space removed.
+//
+// The identifier of each criteria is the path of the file and the location
+// of the node in the file separated by a colon, for example
+// /etc/tomcat/server.xml:/Server/Service[1]/Connector[2]/@port.
+type XML struct {
+	Path  string `json:"path,omitempty" yaml:"path,omitempty"`
+	File  string `json:"file,omitempty" yaml:"file,omitempty"`
+	XPath string `json:"xpath,omitempty" yaml:"xpath,omitempty"`
+
+	LocatorOptions `yaml:",inline"`
+
+	fileRe  compiledRegexp
+	matches []xmlMatch
+}
+
+type xmlMatch struct {
+	path  string
+	node  string
+	value string
+}
+
+// An element in a decoded XML document.
+type xmlNode struct {
+	name     string
+	attrs    []xml.Attr
+	children []*xmlNode
+	text     string
+	parent   *xmlNode
+	location string
+}
+
+// A single step in an XPath expression.
+type xpathStep struct {
+	descendant bool
+	name       string
+	attr       string // Set if the step selects an attribute.
+	text       bool   // Set if the step selects text().
+	preds      []xpathPredicate
+}
+
+type xpathPredicate struct {
+	index    int    // Set for positional predicates.
+	attr     string // Set for attribute predicates.
+	child    string // Set for child element predicates.
+	value    string
+	hasValue bool
+}
+
+func (x *XML) isChain() bool {
+	return false
+}
+
+func (x *XML) fireChains(d *Document) ([]evaluationCriteria, error) {
+	return nil, nil
+}
+
+func (x *XML) mergeCriteria(c []evaluationCriteria) {
+}
+
+func (x *XML) validate(d *Document) error {
+	if len(x.Path) == 0 {
+		return fmt.Errorf("xml path must be set")
+	}
+	if len(x.File) == 0 {
+		return fmt.Errorf("xml file must be set")
+	}
+	if len(x.XPath) == 0 {
+		return fmt.Errorf("xml xpath must be set")
+	}
+	_, err := x.fileRe.compile(x.fileExpression(x.File))
+	if err != nil {
+		return err
+	}
+	_, err = parseXPath(x.XPath)
+	if err != nil {
+		return fmt.Errorf("xml xpath: %v", err)
+	}
+	return nil
+}
+
+func (x *XML) expandVariables(v []Variable) {
+	x.Path = variableExpansion(v, x.Path)
+	x.File = variableExpansion(v, x.File)
+}
+
+func (x *XML) getCriteria() (ret []evaluationCriteria) {
+	for _, y := range x.matches {
+		n := evaluationCriteria{}
+		n.identifier = y.path + ":" + y.node
+		n.testValue = y.value
+		ret = append(ret, n)
+	}
+	return ret
+}
+
+func (x *XML) prepare() error {
+	debugPrint("prepare(): analyzing file system, path %v, file \"%v\"\n", x.Path, x.File)
+
+	re, err := x.fileRe.compile(x.fileExpression(x.File))
+	if err != nil {
+		return err
+	}
+	steps, err := parseXPath(x.XPath)
+	if err != nil {
+		return err
+	}
+
+	sfl := newSimpleFileLocator()
+	sfl.root = x.Path
+	sfl.opts = x.LocatorOptions
+	err = sfl.locateRegexp(re)
+	if err != nil {
+		return err
+	}
+
+	for _, y := range sfl.matches {
+		fd, err := openLocated(y, x.LocatorOptions)
+		if err != nil {
+			debugPrint("prepare(): skipping %v: %v\n", y, err)
+			continue
+		}
+		root, err := xmlDecode(fd)
+		fd.Close()
+		if err != nil {
+			debugPrint("prepare(): skipping %v: %v\n", y, err)
+			continue
+		}
+		for _, z := range xpathSelect(root, steps) {
+			debugPrint("prepare(): %v %v: %v\n", y, z.node, z.value)
+			z.path = sfl.identifier(y)
+			x.matches = append(x.matches, z)
+		}
+	}
+	return nil
+}
+
+// Decode the XML document read from r, returning a node containing the
+// document element.
+func xmlDecode(r io.Reader) (*xmlNode, error) {
+	dec := xml.NewDecoder(r)
+	dec.Strict = false
+	root := &xmlNode{}
+	cur := root
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &xmlNode{name: t.Name.Local, attrs: t.Attr, parent: cur}
+			// Record the position of the element among its siblings
+			// with the same name for the identifier.
+			pos := 1
+			for _, x := range cur.children {
+				if x.name == n.name {
+					pos++
+				}
+			}
+			n.location = fmt.Sprintf("%v/%v[%v]", cur.location, n.name, pos)
+			cur.children = append(cur.children, n)
+			cur = n
+		case xml.EndElement:
+			if cur.parent == nil {
+				return nil, fmt.Errorf("unexpected end element %v", t.Name.Local)
+			}
+			cur = cur.parent
+		case xml.CharData:
+			cur.text += string(t)
+		}
+	}
+	if len(root.children) != 1 {
+		return nil, fmt.Errorf("no document element")
+	}
+	return root, nil
+}
+
+// Parse an XPath expression into steps.
+func parseXPath(expr string) ([]xpathStep, error) {
+	if !strings.HasPrefix(expr, "/") {
+		return nil, fmt.Errorf("expression must be absolute")
+	}
+	ret := make([]xpathStep, 0)
+	s := expr
+	for len(s) > 0 {
+		var step xpathStep
+		if strings.HasPrefix(s, "//") {
+			step.descendant = true
+			s = s[2:]
+		} else if strings.HasPrefix(s, "/") {
+			s = s[1:]
+		} else {
+			return nil, fmt.Errorf("expected / at %q", s)
+		}
+		// Find the end of the step, ignoring / in predicates.
+		depth, end := 0, len(s)
+		for i := 0; i < len(s); i++ {
+			if s[i] == '[' {
+				depth++
+			} else if s[i] == ']' {
+				depth--
+			} else if s[i] == '/' && depth == 0 {
+				end = i
+				break
+			}
+		}
+		tok := s[:end]
+		s = s[end:]
+		name := tok
+		if i := strings.Index(tok, "["); i != -1 {
+			name = tok[:i]
+			preds, err := parseXPathPredicates(tok[i:])
+			if err != nil {
+				return nil, err
+			}
+			step.preds = preds
+		}
+		switch {
+		case name == "":
+			return nil, fmt.Errorf("empty step in expression")
+		case name == "text()":
+			step.text = true
+		case strings.HasPrefix(name, "@"):
+			step.attr = stripXMLPrefix(name[1:])
+			if step.attr == "" {
+				return nil, fmt.Errorf("empty attribute name")
+			}
+		default:
+			step.name = stripXMLPrefix(name)
+		}
+		if (step.text || step.attr != "") && (len(s) > 0 || len(step.preds) > 0) {
+			return nil, fmt.Errorf("%v must be the final step and have no predicates", name)
+		}
+		ret = append(ret, step)
+	}
+	return ret, nil
+}
+
+func parseXPathPredicates(s string) ([]xpathPredicate, error) {
+	ret := make([]xpathPredicate, 0)
+	for len(s) > 0 {
+		if s[0] != '[' {
+			return nil, fmt.Errorf("expected [ at %q", s)
+		}
+		end := strings.Index(s, "]")
+		if end == -1 {
+			return nil, fmt.Errorf("unterminated predicate %q", s)
+		}
+		inner := strings.TrimSpace(s[1:end])
+		s = s[end+1:]
+		var p xpathPredicate
+		if idx, err := strconv.Atoi(inner); err == nil {
+			if idx < 1 {
+				return nil, fmt.Errorf("invalid position %v", idx)
+			}
+			p.index = idx
+			ret = append(ret, p)
+			continue
+		}
+		name := inner
+		if i := strings.Index(inner, "="); i != -1 {
+			name = strings.TrimSpace(inner[:i])
+			v := strings.TrimSpace(inner[i+1:])
+			if len(v) < 2 || (v[0] != '\'' && v[0] != '"') || v[len(v)-1] != v[0] {
+				return nil, fmt.Errorf("predicate value must be quoted: %v", inner)
+			}
+			p.value = v[1 : len(v)-1]
+			p.hasValue = true
+		}
+		if strings.HasPrefix(name, "@") {
+			p.attr = stripXMLPrefix(name[1:])
+		} else {
+			p.child = stripXMLPrefix(name)
+			if !p.hasValue {
+				return nil, fmt.Errorf("unsupported predicate %v", inner)
+			}
+		}
+		if p.attr == "" && p.child == "" {
+			return nil, fmt.Errorf("unsupported predicate %v", inner)
+		}
+		ret = append(ret, p)
+	}
+	return ret, nil
+}
+
+func stripXMLPrefix(name string) string {
+	if i := strings.Index(name, ":"); i != -1 {
+		return name[i+1:]
+	}
+	return name
+}
+
+// Return the value of the attribute name of the node, ignoring namespace
+// prefixes.
+func (n *xmlNode) attr(name string) (string, bool) {
+	for _, x := range n.attrs {
+		if x.Name.Local == name {
+			return x.Value, true
+		}
+	}
+	return "", false
+}
+
+// Return the descendants of the node, in document order.
+func (n *xmlNode) descendants() []*xmlNode {
+	ret := make([]*xmlNode, 0)
+	for _, x := range n.children {
+		ret = append(ret, x)
+		ret = append(ret, x.descendants()...)
+	}
+	return ret
+}
+
+func (p xpathPredicate) match(n *xmlNode) bool {
+	if p.attr != "" {
+		v, ok := n.attr(p.attr)
+		return ok && (!p.hasValue || v == p.value)
+	}
+	for _, x := range n.children {
+		if x.name == p.child && strings.TrimSpace(x.text) == p.value {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply the XPath steps to the document, returning the selected values.
+func xpathSelect(root *xmlNode, steps []xpathStep) []xmlMatch {
+	nodes := []*xmlNode{root}
+	ret := make([]xmlMatch, 0)
+	for _, s := range steps {
+		if s.attr != "" || s.text {
+			for _, n := range nodes {
+				if s.text {
+					ret = append(ret, xmlMatch{node: n.location + "/text()",
+						value: strings.TrimSpace(n.text)})
+				} else if v, ok := n.attr(s.attr); ok {
+					ret = append(ret, xmlMatch{node: n.location + "/@" + s.attr, value: v})
+				}
+			}
+			return ret
+		}
+		next := make([]*xmlNode, 0)
+		seen := make(map[*xmlNode]bool)
+		for _, n := range nodes {
+			candidates := n.children
+			if s.descendant {
+				candidates = n.descendants()
+			}
+			sel := make([]*xmlNode, 0)
+			for _, c := range candidates {
+				if s.name == "*" || c.name == s.name {
+					sel = append(sel, c)
+				}
+			}
+			for _, p := range s.preds {
+				filtered := make([]*xmlNode, 0)
+				for i, c := range sel {
+					if (p.index != 0 && p.index == i+1) || (p.index == 0 && p.match(c)) {
+						filtered = append(filtered, c)
+					}
+				}
+				sel = filtered
+			}
+			for _, c := range sel {
+				if !seen[c] {
+					seen[c] = true
+					next = append(next, c)
+				}
+			}
+		}
+		nodes = next
+	}
+	for _, n := range nodes {
+		ret = append(ret, xmlMatch{node: n.location, value: strings.TrimSpace(n.text)})
+	}
+	return ret
+}